@@ -5,6 +5,8 @@ export type AppSettings = {
   show_home_title: boolean
   auto_start: boolean
   auto_update: boolean
+  codex_model?: string
+  codex_wire_api?: string
 }
 
 const DEFAULT_SETTINGS: AppSettings = {
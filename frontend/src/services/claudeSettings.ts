@@ -30,3 +30,8 @@ export const enableProxy = async (platform: Platform): Promise<void> => {
 export const disableProxy = async (platform: Platform): Promise<void> => {
   await callByPlatform(platform, 'DisableProxy')
 }
+
+// 仅 Claude：启用代理并写入额外的 env（如 ANTHROPIC_MODEL、ANTHROPIC_CUSTOM_HEADERS）
+export const enableClaudeProxyWithEnv = async (extra: Record<string, string>): Promise<void> => {
+  await callByPlatform('claude', 'EnableProxyWithEnv', [extra])
+}
@@ -1,7 +1,7 @@
 import { Call } from '@wailsio/runtime'
 
-export type McpPlatform = 'claude-code' | 'codex'
-export type McpServerType = 'stdio' | 'http'
+export type McpPlatform = 'claude-code' | 'codex' | 'claude-desktop'
+export type McpServerType = 'stdio' | 'http' | 'sse'
 
 export type McpServer = {
   name: string
@@ -10,11 +10,13 @@ export type McpServer = {
   args: string[]
   env: Record<string, string>
   url?: string
+  headers?: Record<string, string>
   website?: string
   tips?: string
   enable_platform: McpPlatform[]
   enabled_in_claude: boolean
   enabled_in_codex: boolean
+  enabled_in_claude_desktop: boolean
   missing_placeholders: string[]
 }
 
@@ -23,6 +25,33 @@ export const fetchMcpServers = async (): Promise<McpServer[]> => {
   return (response as McpServer[]) ?? []
 }
 
+export type McpDefinition = {
+  command?: string
+  args?: string[]
+  env?: Record<string, string>
+  url?: string
+  headers?: Record<string, string>
+}
+
+export type McpConflict = {
+  name: string
+  platform: McpPlatform
+  path: string
+  fields: string[]
+  stored: McpDefinition
+  actual: McpDefinition
+}
+
+export const detectMcpConflicts = async (): Promise<McpConflict[]> => {
+  const response = await Call.ByName('codeswitch/services.MCPService.DetectConflicts')
+  return (response as McpConflict[]) ?? []
+}
+
 export const saveMcpServers = async (servers: McpServer[]): Promise<void> => {
   await Call.ByName('codeswitch/services.MCPService.SaveServers', servers)
 }
+
+export const validateMcpServer = async (server: McpServer): Promise<string[]> => {
+  const response = await Call.ByName('codeswitch/services.MCPService.ValidateServer', server)
+  return (response as string[]) ?? []
+}
@@ -4,9 +4,11 @@ import (
 	"codeswitch/services"
 	"embed"
 	_ "embed"
+	"errors"
 	"fmt"
 	"log"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/wailsapp/wails/v3/pkg/application"
@@ -27,12 +29,28 @@ var trayIcons embed.FS
 
 type AppService struct {
 	App *application.App
+
+	reportMu      sync.Mutex
+	startupReport *services.StartupReport
 }
 
 func (a *AppService) SetApp(app *application.App) {
 	a.App = app
 }
 
+// GetStartupReport 返回启动诊断报告，前端错过启动事件时可主动获取（尚未生成时为 nil）
+func (a *AppService) GetStartupReport() *services.StartupReport {
+	a.reportMu.Lock()
+	defer a.reportMu.Unlock()
+	return a.startupReport
+}
+
+func (a *AppService) setStartupReport(report *services.StartupReport) {
+	a.reportMu.Lock()
+	a.startupReport = report
+	a.reportMu.Unlock()
+}
+
 func (a *AppService) OpenSecondWindow() {
 	if a.App == nil {
 		fmt.Println("[ERROR] app not initialized")
@@ -61,6 +79,17 @@ func (a *AppService) OpenSecondWindow() {
 // and starts a goroutine that emits a time-based event every second. It subsequently runs the application and
 // logs any error that might occur.
 func main() {
+	// 单实例：已有实例在运行时通知其显示窗口后退出，避免争用 :18100 端口和配置文件
+	instanceLock, err := services.AcquireInstanceLock()
+	if errors.Is(err, services.ErrInstanceRunning) {
+		log.Printf("已有实例在运行，已通知其显示窗口")
+		return
+	}
+	if err != nil {
+		log.Printf("获取单实例锁失败，继续启动: %v", err)
+	}
+	defer instanceLock.Release()
+
 	appservice := &AppService{}
 
 	suiService, errt := services.NewSuiStore()
@@ -71,23 +100,37 @@ func main() {
 	settingsService := services.NewSettingsService()
 	blacklistService := services.NewBlacklistService(settingsService)
 	geminiService := services.NewGeminiService(":18100")
-	providerRelay := services.NewProviderRelayService(providerService, geminiService, blacklistService, ":18100")
+	providerRelay := services.NewProviderRelayService(providerService, geminiService, blacklistService, settingsService, ":18100")
+	// relay 创建时读取配置的端口，Gemini 服务先于 relay 创建，需要同步一次实际地址
+	if err := geminiService.SetRelayAddr(providerRelay.Addr()); err != nil {
+		log.Printf("⚠️  同步 Gemini 代理地址失败: %v", err)
+	}
 	claudeSettings := services.NewClaudeSettingsService(providerRelay.Addr())
 	codexSettings := services.NewCodexSettingsService(providerRelay.Addr())
+	providerService.BindProxySettings(claudeSettings, codexSettings)
 	logService := services.NewLogService()
+	logService.BindProviderService(providerService)
+	blacklistService.BindProviderService(providerService)
+	logStatsService := services.NewLogStatsService()
 	autoStartService := services.NewAutoStartService()
 	updateService := services.NewUpdateService(AppVersion)
 	appSettings := services.NewAppSettingsService(autoStartService)
+	providerService.BindAppSettings(appSettings)
+	codexSettings.BindAppSettings(appSettings)
 	mcpService := services.NewMCPService()
 	skillService := services.NewSkillService()
 	promptService := services.NewPromptService()
 	envCheckService := services.NewEnvCheckService()
-	importService := services.NewImportService(providerService, mcpService)
+	importService := services.NewImportService(providerService, mcpService, geminiService)
 	deeplinkService := services.NewDeepLinkService(providerService)
-	speedTestService := services.NewSpeedTestService()
+	speedTestService := services.NewSpeedTestService(providerService)
 	dockService := dock.New()
-	versionService := NewVersionService()
+	versionService := NewVersionService(updateService, providerRelay.Addr())
 	consoleService := services.NewConsoleService()
+	backupService := services.NewBackupService()
+	levelOptimizer := services.NewLevelOptimizerService(providerService, blacklistService)
+	manifestSync := services.NewManifestSyncService(providerService)
+	setupService := services.NewSetupService(providerService, geminiService, providerRelay, claudeSettings, codexSettings)
 
 	// 应用待处理的更新
 	go func() {
@@ -112,6 +155,33 @@ func main() {
 		}
 	}()
 
+	// 启动定时配置备份（未启用时仅做检查，不会执行备份）
+	backupService.StartScheduler()
+
+	// 启动定时自动调级（默认关闭，开启后按配置的间隔调整 provider Level）
+	levelOptimizer.StartScheduler()
+
+	// 启动团队清单定时同步（默认关闭）
+	manifestSync.StartScheduler()
+
+	// 启动请求日志清理定时器（启动时执行一次，之后每小时按保留天数删除过期日志）
+	go func() {
+		prune := func() {
+			if deleted, err := logService.PruneExpiredLogs(); err != nil {
+				log.Printf("清理过期请求日志失败: %v", err)
+			} else if deleted > 0 {
+				log.Printf("已清理 %d 条过期请求日志", deleted)
+			}
+		}
+		prune()
+
+		ticker := time.NewTicker(services.LogPruneInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			prune()
+		}
+	}()
+
 	// 启动黑名单自动恢复定时器（每分钟检查一次）
 	go func() {
 		ticker := time.NewTicker(1 * time.Minute)
@@ -142,6 +212,7 @@ func main() {
 			application.NewService(claudeSettings),
 			application.NewService(codexSettings),
 			application.NewService(logService),
+			application.NewService(logStatsService),
 			application.NewService(appSettings),
 			application.NewService(updateService),
 			application.NewService(mcpService),
@@ -155,6 +226,11 @@ func main() {
 			application.NewService(versionService),
 			application.NewService(geminiService),
 			application.NewService(consoleService),
+			application.NewService(providerRelay),
+			application.NewService(backupService),
+			application.NewService(setupService),
+			application.NewService(levelOptimizer),
+			application.NewService(manifestSync),
 		},
 		Assets: application.AssetOptions{
 			Handler: application.AssetFileServerFS(assets),
@@ -165,7 +241,11 @@ func main() {
 	})
 
 	app.OnShutdown(func() {
+		backupService.StopScheduler()
+		levelOptimizer.StopScheduler()
+		manifestSync.StopScheduler()
 		_ = providerRelay.Stop()
+		instanceLock.Release()
 	})
 
 	// Create a new window with the necessary options.
@@ -218,11 +298,31 @@ func main() {
 	showMainWindow(false)
 
 	mainWindow.RegisterHook(events.Common.WindowClosing, func(e *application.WindowEvent) {
+		// 每次关闭时读取设置，用户修改后无需重启即可生效；读取失败时保持默认的隐藏到托盘
+		settings, err := appSettings.GetAppSettings()
+		if err == nil && !settings.CloseToTray {
+			// 直接退出：保持 Dock 图标状态不变，由 app.Quit 统一清理
+			app.Quit()
+			return
+		}
 		mainWindow.Hide()
 		handleDockVisibility(dockService, false)
 		e.Cancel()
 	})
 
+	instanceLock.OnActivate(func() {
+		showMainWindow(true)
+	})
+
+	// bmai:// 链接：冷启动或 macOS 上由系统直接转交，已在运行时由新实例经实例锁转交
+	app.Event.OnApplicationEvent(events.Common.ApplicationLaunchedWithUrl, func(event *application.ApplicationEvent) {
+		showMainWindow(true)
+		_, _ = deeplinkService.HandleURL(event.Context().URL())
+	})
+	instanceLock.OnOpenURL(func(rawURL string) {
+		_, _ = deeplinkService.HandleURL(rawURL)
+	})
+
 	app.Event.OnApplicationEvent(events.Mac.ApplicationShouldHandleReopen, func(event *application.ApplicationEvent) {
 		showMainWindow(true)
 	})
@@ -246,13 +346,60 @@ func main() {
 	}
 
 	trayMenu := application.NewMenu()
-	trayMenu.Add("显示主窗口").OnClick(func(ctx *application.Context) {
-		showMainWindow(true)
+	buildTrayMenu := func() {
+		trayMenu.Clear()
+		addQuickSwitchMenu(trayMenu, providerService)
+		trayMenu.Add("显示主窗口").OnClick(func(ctx *application.Context) {
+			showMainWindow(true)
+		})
+		trayMenu.Add("退出").OnClick(func(ctx *application.Context) {
+			app.Quit()
+		})
+	}
+	buildTrayMenu()
+	systray.SetMenu(trayMenu)
+
+	// 供应商变更时经事件总线通知前端与托盘，托盘据此重建快速切换菜单
+	providerService.OnProvidersChanged(func(kind string) {
+		app.Event.Emit(providersChangedEvent, kind)
 	})
-	trayMenu.Add("退出").OnClick(func(ctx *application.Context) {
-		app.Quit()
+	app.Event.On(providersChangedEvent, func(event *application.CustomEvent) {
+		buildTrayMenu()
+		trayMenu.Update()
+	})
+
+	// provider 自动恢复后通知前端刷新黑名单状态，无需轮询
+	blacklistService.OnRecovered(func(recovered []services.BlacklistRecovery) {
+		app.Event.Emit(services.BlacklistRecoveredEvent, recovered)
+	})
+
+	// 自动调级后通知前端刷新供应商列表和 Level
+	levelOptimizer.OnAdjusted(func(adjustments []services.LevelAdjustment) {
+		app.Event.Emit(services.LevelAdjustedEvent, adjustments)
+	})
+
+	// relay 端口变更：重启 relay 并把已接入代理的 CLI 配置改写为新地址，任一步失败时整体回滚到原地址
+	settingsService.OnRelayPortChanged(func(port int) error {
+		return providerRelay.RestartWith(
+			func(addr string) error {
+				versionService.SetRelayAddr(addr)
+				return nil
+			},
+			claudeSettings.SetRelayAddr,
+			codexSettings.SetRelayAddr,
+			geminiService.SetRelayAddr,
+		)
+	})
+
+	// 团队清单同步后通知前端变更摘要
+	manifestSync.OnSynced(func(summary services.ManifestSyncSummary) {
+		app.Event.Emit(services.ManifestSyncedEvent, summary)
+	})
+
+	// 链接处理完成后通知前端弹出确认或错误提示
+	deeplinkService.OnHandled(func(result services.DeepLinkResult) {
+		app.Event.Emit(services.DeepLinkHandledEvent, result)
 	})
-	systray.SetMenu(trayMenu)
 
 	systray.OnClick(func() {
 		if !mainWindow.IsVisible() {
@@ -266,6 +413,22 @@ func main() {
 
 	appservice.SetApp(app)
 
+	// 启动诊断：等待 relay 就绪后汇总一次环境信息，输出到日志并通知前端，不阻塞启动
+	go func() {
+		report := services.CollectStartupReport(services.StartupReportSources{
+			Version:   AppVersion,
+			OS:        runtime.GOOS + "/" + runtime.GOARCH,
+			Relay:     providerRelay,
+			Providers: providerService,
+			Gemini:    geminiService,
+			Blacklist: blacklistService,
+			Update:    updateService,
+		})
+		report.Log()
+		appservice.setStartupReport(report)
+		app.Event.Emit(services.StartupReportEvent, report)
+	}()
+
 	// Create a goroutine that emits an event containing the current time every second.
 	// The frontend can listen to this event and update the UI accordingly.
 	go func() {
@@ -277,7 +440,7 @@ func main() {
 	}()
 
 	// Run the application. This blocks until the application has been exited.
-	err := app.Run()
+	err = app.Run()
 
 	// If an error occurred while running the application, log it and exit.
 	if err != nil {
@@ -285,6 +448,46 @@ func main() {
 	}
 }
 
+const providersChangedEvent = "providers:changed"
+
+// addQuickSwitchMenu 按平台添加供应商快速切换子菜单，点击后切换 relay 优先使用的供应商
+func addQuickSwitchMenu(menu *application.Menu, providerService *services.ProviderService) {
+	items, err := providerService.GetQuickSwitchMenu()
+	if err != nil {
+		log.Printf("failed to build tray quick switch menu: %v", err)
+		return
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	submenus := make(map[string]*application.Menu)
+	for _, item := range items {
+		submenu, ok := submenus[item.Platform]
+		if !ok {
+			submenu = menu.AddSubmenu(quickSwitchTitle(item.Platform))
+			submenus[item.Platform] = submenu
+		}
+		item := item
+		submenu.AddRadio(item.Name, item.Active).OnClick(func(ctx *application.Context) {
+			if err := providerService.SetActiveProvider(item.Platform, item.ID); err != nil {
+				log.Printf("failed to switch %s provider to %s: %v", item.Platform, item.Name, err)
+			}
+		})
+	}
+	menu.AddSeparator()
+}
+
+func quickSwitchTitle(platform string) string {
+	switch platform {
+	case "claude":
+		return "Claude 供应商"
+	case "codex":
+		return "Codex 供应商"
+	}
+	return platform
+}
+
 func loadTrayIcon(path string) []byte {
 	data, err := trayIcons.ReadFile(path)
 	if err != nil {
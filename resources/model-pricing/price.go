@@ -106,6 +106,51 @@ func NewService() (*Service, error) {
 	}, nil
 }
 
+// ModelPrice 自定义的模型单价（美元 / 百万 tokens）。
+// 缓存单价为 0 时按输入单价推算（创建 1.25 倍、读取 0.1 倍）。
+type ModelPrice struct {
+	Input       float64 `json:"input"`
+	Output      float64 `json:"output"`
+	CacheCreate float64 `json:"cache_create"`
+	CacheRead   float64 `json:"cache_read"`
+}
+
+// WithOverrides 返回叠加自定义单价后的服务实例，自定义单价优先于内置价格表；原实例不受影响。
+func (s *Service) WithOverrides(overrides map[string]ModelPrice) *Service {
+	if s == nil || len(overrides) == 0 {
+		return s
+	}
+	pricing := make(map[string]*PricingEntry, len(s.pricingMap)+len(overrides))
+	for key, entry := range s.pricingMap {
+		pricing[key] = entry
+	}
+	normalized := make(map[string]string, len(s.normalized)+len(overrides))
+	for key, value := range s.normalized {
+		normalized[key] = value
+	}
+	for model, price := range overrides {
+		model = strings.TrimSpace(model)
+		if model == "" {
+			continue
+		}
+		entry := &PricingEntry{
+			InputCostPerToken:           price.Input / 1e6,
+			OutputCostPerToken:          price.Output / 1e6,
+			CacheCreationInputTokenCost: price.CacheCreate / 1e6,
+			CacheReadInputTokenCost:     price.CacheRead / 1e6,
+		}
+		ensureCachePricing(entry)
+		pricing[model] = entry
+		normalized[normalizeName(model)] = model
+	}
+	return &Service{
+		pricingMap:   pricing,
+		normalized:   normalized,
+		ephemeral1h:  s.ephemeral1h,
+		longContexts: s.longContexts,
+	}
+}
+
 // CalculateCost 根据模型与 token 用量返回费用明细（美元）。
 func (s *Service) CalculateCost(model string, usage UsageSnapshot) CostBreakdown {
 	if s == nil || model == "" {
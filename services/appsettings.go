@@ -2,8 +2,10 @@ package services
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
@@ -17,6 +19,13 @@ type AppSettings struct {
 	ShowHomeTitle bool `json:"show_home_title"`
 	AutoStart     bool `json:"auto_start"`
 	AutoUpdate    bool `json:"auto_update"`
+	// 关闭主窗口时隐藏到托盘（false 时直接退出应用）
+	CloseToTray bool `json:"close_to_tray"`
+	// 托盘快速切换菜单展示的平台（claude / codex），为空则不展示
+	TrayQuickSwitchPlatforms []string `json:"tray_quick_switch_platforms"`
+	// 启用 Codex 代理时写入 config.toml 的 model 和 wire_api（responses / chat），为空时使用默认值
+	CodexModel   string `json:"codex_model"`
+	CodexWireAPI string `json:"codex_wire_api"`
 }
 
 type AppSettingsService struct {
@@ -47,10 +56,14 @@ func (as *AppSettingsService) defaultSettings() AppSettings {
 	}
 
 	return AppSettings{
-		ShowHeatmap:   true,
-		ShowHomeTitle: true,
-		AutoStart:     autoStartEnabled,
-		AutoUpdate:    true, // 默认开启自动更新
+		ShowHeatmap:              true,
+		ShowHomeTitle:            true,
+		AutoStart:                autoStartEnabled,
+		AutoUpdate:               true, // 默认开启自动更新
+		CloseToTray:              true, // 默认关闭窗口时隐藏到托盘
+		TrayQuickSwitchPlatforms: []string{"claude", "codex"},
+		CodexModel:               codexDefaultModel,
+		CodexWireAPI:             codexWireAPI,
 	}
 }
 
@@ -66,6 +79,14 @@ func (as *AppSettingsService) SaveAppSettings(settings AppSettings) (AppSettings
 	as.mu.Lock()
 	defer as.mu.Unlock()
 
+	settings.CodexModel = strings.TrimSpace(settings.CodexModel)
+	settings.CodexWireAPI = strings.ToLower(strings.TrimSpace(settings.CodexWireAPI))
+	switch settings.CodexWireAPI {
+	case "", "responses", "chat":
+	default:
+		return settings, fmt.Errorf("不支持的 Codex wire_api: %s（可选 responses、chat）", settings.CodexWireAPI)
+	}
+
 	// 同步开机自启动状态
 	if as.autoStartService != nil {
 		if settings.AutoStart {
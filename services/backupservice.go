@@ -0,0 +1,336 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+const (
+	backupDirPrefix     = "bmai-backup-"
+	backupTimeLayout    = "20060102-150405"
+	backupManifestFile  = "manifest.json"
+	backupDatabaseFile  = "app.db"
+	backupCheckInterval = time.Hour
+)
+
+// backupConfigFiles 需要备份的配置文件（相对于 ~/.code-switch）
+var backupConfigFiles = []string{
+	"claude-code.json",
+	"codex.json",
+	"gemini-providers.json",
+	"mcp.json",
+	"skill.json",
+	"prompts.json",
+	"blacklist-config.json",
+	"pricing.json",
+}
+
+// BackupSettings 定时备份配置
+type BackupSettings struct {
+	Enabled        bool   `json:"enabled"`        // 是否启用定时备份
+	Directory      string `json:"directory"`      // 备份目标目录（可以是 Dropbox/iCloud 等同步文件夹）
+	IntervalHours  int    `json:"intervalHours"`  // 备份间隔（小时），默认 24
+	RetentionCount int    `json:"retentionCount"` // 保留的备份份数，默认 7
+	LastBackupAt   string `json:"lastBackupAt"`   // 最近一次备份时间（RFC3339，只读）
+}
+
+// BackupManifest 备份清单
+type BackupManifest struct {
+	CreatedAt string   `json:"createdAt"`
+	Files     []string `json:"files"`
+}
+
+// BackupService 管理配置备份
+type BackupService struct {
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+func NewBackupService() *BackupService {
+	return &BackupService{}
+}
+
+// GetBackupSettings 获取定时备份配置
+func (bs *BackupService) GetBackupSettings() (*BackupSettings, error) {
+	settings := &BackupSettings{
+		Enabled:        getBoolSetting("backup_enabled", false),
+		IntervalHours:  24,
+		RetentionCount: 7,
+	}
+
+	values := map[string]*string{
+		"backup_directory": &settings.Directory,
+		"backup_last_at":   &settings.LastBackupAt,
+	}
+	for key, target := range values {
+		value, _, err := getSettingValue(key)
+		if err != nil {
+			return nil, err
+		}
+		*target = value
+	}
+
+	if value, found, err := getSettingValue("backup_interval_hours"); err == nil && found {
+		if hours, err := strconv.Atoi(value); err == nil && hours > 0 {
+			settings.IntervalHours = hours
+		}
+	}
+	if value, found, err := getSettingValue("backup_retention_count"); err == nil && found {
+		if count, err := strconv.Atoi(value); err == nil && count > 0 {
+			settings.RetentionCount = count
+		}
+	}
+
+	return settings, nil
+}
+
+// SaveBackupSettings 保存定时备份配置
+func (bs *BackupService) SaveBackupSettings(settings *BackupSettings) error {
+	if settings == nil {
+		return fmt.Errorf("备份配置不能为空")
+	}
+	directory := strings.TrimSpace(settings.Directory)
+	if settings.Enabled && directory == "" {
+		return fmt.Errorf("启用定时备份时必须指定备份目录")
+	}
+	if settings.IntervalHours < 1 || settings.IntervalHours > 24*30 {
+		return fmt.Errorf("备份间隔必须在 1-720 小时之间")
+	}
+	if settings.RetentionCount < 1 || settings.RetentionCount > 365 {
+		return fmt.Errorf("备份保留份数必须在 1-365 之间")
+	}
+
+	if err := setBoolSetting("backup_enabled", settings.Enabled); err != nil {
+		return err
+	}
+	if err := setSettingValue("backup_directory", directory); err != nil {
+		return err
+	}
+	if err := setSettingValue("backup_interval_hours", strconv.Itoa(settings.IntervalHours)); err != nil {
+		return err
+	}
+	return setSettingValue("backup_retention_count", strconv.Itoa(settings.RetentionCount))
+}
+
+// BackupNow 立即执行一次完整备份，返回本次备份所在目录
+// 备份内容：provider/gemini/mcp 等配置文件 + 数据库快照（使用 VACUUM INTO，避免直接复制正在写入的文件）
+func (bs *BackupService) BackupNow(destDir string) (string, error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	destDir = strings.TrimSpace(destDir)
+	if destDir == "" {
+		return "", fmt.Errorf("备份目录不能为空")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户目录失败: %w", err)
+	}
+
+	now := time.Now()
+	target := filepath.Join(destDir, backupDirPrefix+now.Format(backupTimeLayout))
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		return "", fmt.Errorf("创建备份目录失败: %w", err)
+	}
+
+	manifest := BackupManifest{CreatedAt: now.Format(time.RFC3339)}
+
+	configDir := filepath.Join(home, ".code-switch")
+	for _, name := range backupConfigFiles {
+		copied, err := copyFileIfExists(filepath.Join(configDir, name), filepath.Join(target, name))
+		if err != nil {
+			return "", fmt.Errorf("备份 %s 失败: %w", name, err)
+		}
+		if copied {
+			manifest.Files = append(manifest.Files, name)
+		}
+	}
+
+	appSettingsName := filepath.Join(appSettingsDir, appSettingsFile)
+	copied, err := copyFileIfExists(filepath.Join(home, appSettingsName), filepath.Join(target, appSettingsName))
+	if err != nil {
+		return "", fmt.Errorf("备份 %s 失败: %w", appSettingsName, err)
+	}
+	if copied {
+		manifest.Files = append(manifest.Files, filepath.ToSlash(appSettingsName))
+	}
+
+	if err := snapshotDatabase(filepath.Join(target, backupDatabaseFile)); err != nil {
+		return "", err
+	}
+	manifest.Files = append(manifest.Files, backupDatabaseFile)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("序列化备份清单失败: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(target, backupManifestFile), data, 0o644); err != nil {
+		return "", fmt.Errorf("写入备份清单失败: %w", err)
+	}
+
+	if err := setSettingValue("backup_last_at", now.Format(time.RFC3339)); err != nil {
+		log.Printf("⚠️  记录备份时间失败: %v", err)
+	}
+
+	log.Printf("💾 配置备份完成: %s（%d 个文件）", target, len(manifest.Files))
+	return target, nil
+}
+
+// StartScheduler 启动定时备份检查：启动时立即检查一次，之后每小时检查一次是否到达备份间隔
+// 经常重启的机器上，启动时已过期的备份不会因为等待首次检查而一再推迟
+func (bs *BackupService) StartScheduler() {
+	bs.scheduleNext()
+	go bs.runScheduledBackup(time.Now())
+}
+
+// scheduleNext 安排下一次备份检查
+func (bs *BackupService) scheduleNext() {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if bs.timer != nil {
+		bs.timer.Stop()
+	}
+	bs.timer = time.AfterFunc(backupCheckInterval, func() {
+		bs.runScheduledBackup(time.Now())
+
+		// StopScheduler 后不再重新调度
+		bs.mu.Lock()
+		active := bs.timer != nil
+		bs.mu.Unlock()
+		if active {
+			bs.scheduleNext()
+		}
+	})
+}
+
+// StopScheduler 停止定时备份
+func (bs *BackupService) StopScheduler() {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if bs.timer != nil {
+		bs.timer.Stop()
+		bs.timer = nil
+	}
+}
+
+// runScheduledBackup 到达备份间隔时执行备份并清理过期备份
+func (bs *BackupService) runScheduledBackup(now time.Time) {
+	settings, err := bs.GetBackupSettings()
+	if err != nil {
+		log.Printf("⚠️  读取备份配置失败: %v", err)
+		return
+	}
+	if !backupDue(settings, now) {
+		return
+	}
+
+	if _, err := bs.BackupNow(settings.Directory); err != nil {
+		log.Printf("⚠️  定时备份失败: %v", err)
+		return
+	}
+	if err := pruneBackups(settings.Directory, settings.RetentionCount); err != nil {
+		log.Printf("⚠️  清理旧备份失败: %v", err)
+	}
+}
+
+// backupDue 判断是否需要执行定时备份
+func backupDue(settings *BackupSettings, now time.Time) bool {
+	if !settings.Enabled || settings.Directory == "" {
+		return false
+	}
+	if settings.LastBackupAt == "" {
+		return true
+	}
+	last, err := time.Parse(time.RFC3339, settings.LastBackupAt)
+	if err != nil {
+		return true
+	}
+	return now.Sub(last) >= time.Duration(settings.IntervalHours)*time.Hour
+}
+
+// pruneBackups 只保留最近 retention 份备份（按目录名中的日期排序）
+func pruneBackups(destDir string, retention int) error {
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		return fmt.Errorf("读取备份目录失败: %w", err)
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), backupDirPrefix) {
+			continue
+		}
+		if _, err := time.Parse(backupTimeLayout, strings.TrimPrefix(entry.Name(), backupDirPrefix)); err != nil {
+			continue
+		}
+		backups = append(backups, entry.Name())
+	}
+	if len(backups) <= retention {
+		return nil
+	}
+
+	sort.Strings(backups)
+	for _, name := range backups[:len(backups)-retention] {
+		if err := os.RemoveAll(filepath.Join(destDir, name)); err != nil {
+			return fmt.Errorf("删除旧备份 %s 失败: %w", name, err)
+		}
+		log.Printf("🗑️  已删除旧备份: %s", name)
+	}
+	return nil
+}
+
+// snapshotDatabase 使用 VACUUM INTO 生成一致的数据库快照
+func snapshotDatabase(dest string) error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	if err := os.Remove(dest); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("清理旧数据库快照失败: %w", err)
+	}
+	defer beginBulkWrite()()
+	if _, err := db.Exec(`VACUUM INTO ?`, dest); err != nil {
+		return fmt.Errorf("备份数据库失败: %w", err)
+	}
+	return nil
+}
+
+// copyFileIfExists 复制文件，源文件不存在时返回 false
+func copyFileIfExists(src string, dest string) (bool, error) {
+	in, err := os.Open(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return false, err
+	}
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return false, err
+	}
+	return true, out.Close()
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestBackupNow(t *testing.T) {
+	setupTestEnv(t)
+
+	home, _ := os.UserHomeDir()
+	configDir := filepath.Join(home, ".code-switch")
+	if err := os.MkdirAll(configDir, 0o755); err != nil {
+		t.Fatalf("创建配置目录失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "claude-code.json"), []byte(`{"providers":[]}`), 0o644); err != nil {
+		t.Fatalf("写入配置失败: %v", err)
+	}
+	if err := setSettingValue("backup_test_marker", "ok"); err != nil {
+		t.Fatalf("写入数据库失败: %v", err)
+	}
+
+	bs := NewBackupService()
+	dest := t.TempDir()
+	target, err := bs.BackupNow(dest)
+	if err != nil {
+		t.Fatalf("备份失败: %v", err)
+	}
+
+	for _, name := range []string{"claude-code.json", backupManifestFile, backupDatabaseFile} {
+		if _, err := os.Stat(filepath.Join(target, name)); err != nil {
+			t.Errorf("备份中缺少 %s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(target, "mcp.json")); !os.IsNotExist(err) {
+		t.Errorf("不存在的配置文件不应出现在备份中")
+	}
+
+	// 数据库快照应可独立打开并包含数据
+	snapshot, err := sql.Open("sqlite", filepath.Join(target, backupDatabaseFile))
+	if err != nil {
+		t.Fatalf("打开数据库快照失败: %v", err)
+	}
+	defer snapshot.Close()
+	var value string
+	if err := snapshot.QueryRow(`SELECT value FROM app_settings WHERE key = 'backup_test_marker'`).Scan(&value); err != nil || value != "ok" {
+		t.Fatalf("数据库快照内容不正确: value=%q err=%v", value, err)
+	}
+
+	settings, err := bs.GetBackupSettings()
+	if err != nil || settings.LastBackupAt == "" {
+		t.Fatalf("备份后应记录最近备份时间: %+v err=%v", settings, err)
+	}
+}
+
+func TestPruneBackupsAndSchedule(t *testing.T) {
+	dest := t.TempDir()
+	base := time.Date(2025, 1, 1, 8, 0, 0, 0, time.Local)
+	for i := 0; i < 5; i++ {
+		name := backupDirPrefix + base.AddDate(0, 0, i).Format(backupTimeLayout)
+		if err := os.MkdirAll(filepath.Join(dest, name), 0o755); err != nil {
+			t.Fatalf("创建备份目录失败: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dest, "unrelated"), 0o755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+
+	if err := pruneBackups(dest, 2); err != nil {
+		t.Fatalf("清理备份失败: %v", err)
+	}
+	entries, _ := os.ReadDir(dest)
+	if len(entries) != 3 {
+		t.Fatalf("应保留 2 份备份和无关目录，实际 %d 项", len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(dest, backupDirPrefix+base.AddDate(0, 0, 4).Format(backupTimeLayout))); err != nil {
+		t.Fatalf("最新的备份不应被删除")
+	}
+
+	now := time.Now()
+	settings := &BackupSettings{Enabled: true, Directory: dest, IntervalHours: 24}
+	if !backupDue(settings, now) {
+		t.Fatalf("从未备份时应立即备份")
+	}
+	settings.LastBackupAt = now.Add(-2 * time.Hour).Format(time.RFC3339)
+	if backupDue(settings, now) {
+		t.Fatalf("未到备份间隔时不应备份")
+	}
+	settings.LastBackupAt = now.Add(-25 * time.Hour).Format(time.RFC3339)
+	if !backupDue(settings, now) {
+		t.Fatalf("超过备份间隔时应备份")
+	}
+	settings.Enabled = false
+	if backupDue(settings, now) {
+		t.Fatalf("未启用时不应备份")
+	}
+}
+
+func TestStartSchedulerRunsOverdueBackup(t *testing.T) {
+	setupTestEnv(t)
+
+	bs := NewBackupService()
+	dest := t.TempDir()
+	if err := bs.SaveBackupSettings(&BackupSettings{Enabled: true, Directory: dest, IntervalHours: 24, RetentionCount: 7}); err != nil {
+		t.Fatalf("保存备份配置失败: %v", err)
+	}
+	if err := setSettingValue("backup_last_at", time.Now().Add(-48*time.Hour).Format(time.RFC3339)); err != nil {
+		t.Fatalf("写入最近备份时间失败: %v", err)
+	}
+
+	bs.StartScheduler()
+	defer bs.StopScheduler()
+
+	// 启动时立即检查，不必等待一个检查周期
+	// 最近备份时间在备份完成后才更新
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		settings, err := bs.GetBackupSettings()
+		if err == nil {
+			if last, err := time.Parse(time.RFC3339, settings.LastBackupAt); err == nil && time.Since(last) < time.Hour {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("启动时已过期的备份应立即执行: %+v", settings)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if entries, _ := os.ReadDir(dest); len(entries) != 1 {
+		t.Fatalf("应生成 1 份备份，实际 %d 项", len(entries))
+	}
+}
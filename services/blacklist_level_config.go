@@ -7,7 +7,11 @@ import (
 	"path/filepath"
 )
 
-// GetBlacklistLevelConfigPath 获取等级拉黑配置文件路径
+// blacklistLevelConfigKey app_settings 中等级拉黑配置的配置键（JSON 对象）
+const blacklistLevelConfigKey = "blacklist_level_config"
+
+// GetBlacklistLevelConfigPath 获取旧版等级拉黑配置文件路径
+// 配置现保存在 app_settings 中，该文件只在尚未写入过新配置时读取（兼容旧版本和旧备份）
 func GetBlacklistLevelConfigPath() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -23,60 +27,65 @@ func GetBlacklistLevelConfigPath() (string, error) {
 	return filepath.Join(configDir, "blacklist-config.json"), nil
 }
 
-// GetBlacklistLevelConfig 获取等级拉黑配置
+// GetBlacklistLevelConfig 获取等级拉黑配置，缺失的字段使用默认值
+// 尚未保存过配置时依次回退到旧版配置文件、旧版的 blacklist_level_enabled 开关和默认配置
 func (ss *SettingsService) GetBlacklistLevelConfig() (*BlacklistLevelConfig, error) {
-	configPath, err := GetBlacklistLevelConfigPath()
+	value, found, err := getSettingValue(blacklistLevelConfigKey)
 	if err != nil {
 		return nil, err
 	}
+	if !found {
+		return loadLegacyBlacklistLevelConfig()
+	}
 
-	// 如果文件不存在，返回默认配置
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return DefaultBlacklistLevelConfig(), nil
+	config := DefaultBlacklistLevelConfig()
+	if err := json.Unmarshal([]byte(value), config); err != nil {
+		return nil, fmt.Errorf("解析等级拉黑配置失败: %w", err)
 	}
+	return config, nil
+}
 
-	// 读取配置文件
+// loadLegacyBlacklistLevelConfig 读取旧版本保存的等级拉黑配置
+func loadLegacyBlacklistLevelConfig() (*BlacklistLevelConfig, error) {
+	config := DefaultBlacklistLevelConfig()
+	if enabled, found, err := getSettingValue("blacklist_level_enabled"); err == nil && found {
+		config.EnableLevelBlacklist = enabled == "true"
+	}
+
+	configPath, err := GetBlacklistLevelConfigPath()
+	if err != nil {
+		return nil, err
+	}
 	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("读取配置文件失败: %w", err)
 	}
-
-	var config BlacklistLevelConfig
-	if err := json.Unmarshal(data, &config); err != nil {
+	if err := json.Unmarshal(data, config); err != nil {
 		return nil, fmt.Errorf("解析配置文件失败: %w", err)
 	}
-
-	return &config, nil
+	return config, nil
 }
 
-// SaveBlacklistLevelConfig 保存等级拉黑配置
+// SaveBlacklistLevelConfig 保存等级拉黑配置（不校验，外部调用请使用 UpdateBlacklistLevelConfig）
 func (ss *SettingsService) SaveBlacklistLevelConfig(config *BlacklistLevelConfig) error {
-	configPath, err := GetBlacklistLevelConfigPath()
-	if err != nil {
-		return err
+	if config == nil {
+		return fmt.Errorf("等级拉黑配置不能为空")
 	}
-
-	// 序列化配置
-	data, err := json.MarshalIndent(config, "", "  ")
+	data, err := json.Marshal(config)
 	if err != nil {
 		return fmt.Errorf("序列化配置失败: %w", err)
 	}
-
-	// 原子写入：先写临时文件，再重命名
-	tmpPath := configPath + ".tmp"
-	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
-		return fmt.Errorf("写入临时配置文件失败: %w", err)
-	}
-
-	if err := os.Rename(tmpPath, configPath); err != nil {
-		return fmt.Errorf("重命名配置文件失败: %w", err)
-	}
-
-	return nil
+	return setSettingValue(blacklistLevelConfigKey, string(data))
 }
 
 // UpdateBlacklistLevelConfig 更新等级拉黑配置
 func (ss *SettingsService) UpdateBlacklistLevelConfig(config *BlacklistLevelConfig) error {
+	if config == nil {
+		return fmt.Errorf("等级拉黑配置不能为空")
+	}
 	// 验证配置
 	if err := validateBlacklistLevelConfig(config); err != nil {
 		return err
@@ -132,5 +141,116 @@ func validateBlacklistLevelConfig(config *BlacklistLevelConfig) error {
 		return fmt.Errorf("fallback 拉黑时长必须在 1-10080 分钟之间")
 	}
 
+	if config.ProbationSuccessThreshold < 0 || config.ProbationSuccessThreshold > 100 {
+		return fmt.Errorf("观察期连续成功次数必须在 0-100 之间")
+	}
+
+	if config.ProbationTrafficPercent < 0 || config.ProbationTrafficPercent > 100 {
+		return fmt.Errorf("观察期流量百分比必须在 0-100 之间")
+	}
+
 	return nil
 }
+
+// blacklistPresetVersion 导出的等级拉黑预设格式版本
+const blacklistPresetVersion = 1
+
+// BlacklistConfigPreset 可分享的等级拉黑配置预设
+type BlacklistConfigPreset struct {
+	Version     int                   `json:"version"`
+	Name        string                `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Config      *BlacklistLevelConfig `json:"config"`
+}
+
+// builtinBlacklistPresets 内置预设
+func builtinBlacklistPresets() []BlacklistConfigPreset {
+	aggressive := DefaultBlacklistLevelConfig()
+	aggressive.EnableLevelBlacklist = true
+	aggressive.FailureThreshold = 2
+	aggressive.DedupeWindowSeconds = 15
+	aggressive.NormalDegradeIntervalHours = 2
+	aggressive.ForgivenessHours = 6
+	aggressive.JumpPenaltyWindowHours = 4
+	aggressive.L1DurationMinutes = 10
+	aggressive.L2DurationMinutes = 30
+	aggressive.L3DurationMinutes = 120
+	aggressive.L4DurationMinutes = 720
+	aggressive.L5DurationMinutes = 2880
+	aggressive.FallbackDurationMinutes = 60
+	aggressive.ProbationSuccessThreshold = 3
+
+	lenient := DefaultBlacklistLevelConfig()
+	lenient.EnableLevelBlacklist = true
+	lenient.FailureThreshold = 5
+	lenient.DedupeWindowSeconds = 60
+	lenient.NormalDegradeIntervalHours = 0.5
+	lenient.ForgivenessHours = 1
+	lenient.JumpPenaltyWindowHours = 1
+	lenient.L1DurationMinutes = 1
+	lenient.L2DurationMinutes = 5
+	lenient.L3DurationMinutes = 15
+	lenient.L4DurationMinutes = 60
+	lenient.L5DurationMinutes = 240
+	lenient.FallbackDurationMinutes = 10
+
+	off := DefaultBlacklistLevelConfig()
+	off.EnableLevelBlacklist = false
+	off.FallbackMode = "none"
+
+	return []BlacklistConfigPreset{
+		{Version: blacklistPresetVersion, Name: "aggressive", Description: "快速拉黑、长时间冷却，适合备选供应商充足的场景", Config: aggressive},
+		{Version: blacklistPresetVersion, Name: "lenient", Description: "多次失败才拉黑、短时间冷却，适合供应商较少的场景", Config: lenient},
+		{Version: blacklistPresetVersion, Name: "off", Description: "关闭等级拉黑且失败时不拉黑", Config: off},
+	}
+}
+
+// GetBlacklistPresets 获取内置的等级拉黑预设
+func (ss *SettingsService) GetBlacklistPresets() []BlacklistConfigPreset {
+	return builtinBlacklistPresets()
+}
+
+// ApplyPreset 一次性应用内置预设的全部配置项
+func (ss *SettingsService) ApplyPreset(name string) error {
+	for _, preset := range builtinBlacklistPresets() {
+		if preset.Name == name {
+			return ss.UpdateBlacklistLevelConfig(preset.Config)
+		}
+	}
+	return fmt.Errorf("未找到预设 '%s'", name)
+}
+
+// ExportBlacklistConfig 将当前等级拉黑配置导出为可分享的 JSON 预设
+func (ss *SettingsService) ExportBlacklistConfig() ([]byte, error) {
+	config, err := ss.GetBlacklistLevelConfig()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(BlacklistConfigPreset{
+		Version: blacklistPresetVersion,
+		Name:    "custom",
+		Config:  config,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("序列化配置失败: %w", err)
+	}
+	return data, nil
+}
+
+// ImportBlacklistConfig 导入 JSON 预设（缺失的字段使用默认值），校验通过后保存
+func (ss *SettingsService) ImportBlacklistConfig(data []byte) error {
+	preset := BlacklistConfigPreset{Config: DefaultBlacklistLevelConfig()}
+	if err := json.Unmarshal(data, &preset); err != nil {
+		return fmt.Errorf("解析预设失败: %w", err)
+	}
+	if preset.Version > blacklistPresetVersion {
+		return fmt.Errorf("不支持的预设版本: %d", preset.Version)
+	}
+	if preset.Config == nil {
+		return fmt.Errorf("预设中缺少 config 字段")
+	}
+	if err := validateBlacklistLevelConfig(preset.Config); err != nil {
+		return fmt.Errorf("预设 '%s' 无效: %w", preset.Name, err)
+	}
+	return ss.SaveBlacklistLevelConfig(preset.Config)
+}
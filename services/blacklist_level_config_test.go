@@ -0,0 +1,143 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestBlacklistConfigExportImportRoundTrip(t *testing.T) {
+	setupTestEnv(t)
+	ss := &SettingsService{}
+
+	config := DefaultBlacklistLevelConfig()
+	config.EnableLevelBlacklist = true
+	config.FailureThreshold = 4
+	config.L3DurationMinutes = 90
+	config.ProbationSuccessThreshold = 2
+	if err := ss.UpdateBlacklistLevelConfig(config); err != nil {
+		t.Fatalf("保存配置失败: %v", err)
+	}
+
+	data, err := ss.ExportBlacklistConfig()
+	if err != nil {
+		t.Fatalf("导出配置失败: %v", err)
+	}
+
+	if err := ss.ApplyPreset("off"); err != nil {
+		t.Fatalf("应用预设失败: %v", err)
+	}
+	if err := ss.ImportBlacklistConfig(data); err != nil {
+		t.Fatalf("导入配置失败: %v", err)
+	}
+	got, err := ss.GetBlacklistLevelConfig()
+	if err != nil {
+		t.Fatalf("读取配置失败: %v", err)
+	}
+	if !reflect.DeepEqual(got, config) {
+		t.Fatalf("导入后配置不一致:\n got  %+v\n want %+v", got, config)
+	}
+
+	// 缺失字段使用默认值
+	if err := ss.ImportBlacklistConfig([]byte(`{"name":"partial","config":{"failureThreshold":6}}`)); err != nil {
+		t.Fatalf("导入部分配置失败: %v", err)
+	}
+	got, _ = ss.GetBlacklistLevelConfig()
+	if got.FailureThreshold != 6 || got.L5DurationMinutes != DefaultBlacklistLevelConfig().L5DurationMinutes {
+		t.Fatalf("部分配置未与默认值合并: %+v", got)
+	}
+
+	invalid := []string{
+		`not json`,
+		`{"version":99,"config":{}}`,
+		`{"name":"bad","config":{"l2DurationMinutes":1}}`,
+	}
+	for _, raw := range invalid {
+		if err := ss.ImportBlacklistConfig([]byte(raw)); err == nil {
+			t.Fatalf("非法预设应导入失败: %s", raw)
+		}
+	}
+	got, _ = ss.GetBlacklistLevelConfig()
+	if got.FailureThreshold != 6 {
+		t.Fatalf("导入失败不应覆盖已有配置: %+v", got)
+	}
+}
+
+func TestApplyBuiltinBlacklistPresets(t *testing.T) {
+	setupTestEnv(t)
+	ss := &SettingsService{}
+
+	for _, preset := range ss.GetBlacklistPresets() {
+		if err := ss.ApplyPreset(preset.Name); err != nil {
+			t.Fatalf("应用预设 %s 失败: %v", preset.Name, err)
+		}
+		got, err := ss.GetBlacklistLevelConfig()
+		if err != nil {
+			t.Fatalf("读取配置失败: %v", err)
+		}
+		if !reflect.DeepEqual(got, preset.Config) {
+			t.Fatalf("预设 %s 未完整应用: %+v", preset.Name, got)
+		}
+	}
+
+	if err := ss.ApplyPreset("missing"); err == nil {
+		t.Fatalf("未知预设应返回错误")
+	}
+}
+
+func TestBlacklistLevelConfigStoredInAppSettings(t *testing.T) {
+	setupTestEnv(t)
+	ss := &SettingsService{}
+
+	// 旧版本：配置保存在 blacklist-config.json，开关保存在 blacklist_level_enabled
+	legacyPath, err := GetBlacklistLevelConfigPath()
+	if err != nil {
+		t.Fatalf("获取旧版配置路径失败: %v", err)
+	}
+	if err := os.WriteFile(legacyPath, []byte(`{"failureThreshold":5,"l1DurationMinutes":2}`), 0644); err != nil {
+		t.Fatalf("写入旧版配置失败: %v", err)
+	}
+	if err := setSettingValue("blacklist_level_enabled", "true"); err != nil {
+		t.Fatalf("写入旧版开关失败: %v", err)
+	}
+	got, err := ss.GetBlacklistLevelConfig()
+	if err != nil {
+		t.Fatalf("读取配置失败: %v", err)
+	}
+	if !got.EnableLevelBlacklist || got.FailureThreshold != 5 || got.L1DurationMinutes != 2 || got.L2DurationMinutes != DefaultBlacklistLevelConfig().L2DurationMinutes {
+		t.Fatalf("应读取旧版配置并与默认值合并: %+v", got)
+	}
+
+	// 开关与完整配置保存在同一条 app_settings 记录中
+	if err := ss.SetLevelBlacklistEnabled(false); err != nil {
+		t.Fatalf("设置开关失败: %v", err)
+	}
+	value, found, err := getSettingValue(blacklistLevelConfigKey)
+	if err != nil || !found {
+		t.Fatalf("配置应写入 app_settings: %v, found=%v", err, found)
+	}
+	var stored BlacklistLevelConfig
+	if err := json.Unmarshal([]byte(value), &stored); err != nil || stored.EnableLevelBlacklist || stored.FailureThreshold != 5 {
+		t.Fatalf("保存的配置不正确: %v, %s", err, value)
+	}
+	if enabled, err := ss.GetLevelBlacklistEnabled(); err != nil || enabled {
+		t.Fatalf("开关应已关闭: %v, %v", enabled, err)
+	}
+
+	invalid := []func(c *BlacklistLevelConfig){
+		func(c *BlacklistLevelConfig) { c.ForgivenessHours = 0 },
+		func(c *BlacklistLevelConfig) { c.L1DurationMinutes = 0 },
+		func(c *BlacklistLevelConfig) { c.L3DurationMinutes = c.L2DurationMinutes },
+	}
+	for i, mutate := range invalid {
+		config := DefaultBlacklistLevelConfig()
+		mutate(config)
+		if err := ss.UpdateBlacklistLevelConfig(config); err == nil {
+			t.Fatalf("第 %d 个非法配置应校验失败", i)
+		}
+	}
+	if got, _ := ss.GetBlacklistLevelConfig(); got.FailureThreshold != 5 {
+		t.Fatalf("校验失败不应覆盖已有配置: %+v", got)
+	}
+}
@@ -1,9 +1,11 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/daodao97/xgo/xdb"
@@ -12,12 +14,53 @@ import (
 // BlacklistService 管理供应商黑名单
 type BlacklistService struct {
 	settingsService *SettingsService
+
+	clock Clock
+
+	clockMu          sync.Mutex
+	lastRecoverCheck time.Time // 上次 AutoRecoverExpired 的时间（含单调时钟读数）
+
+	recoverMu        sync.Mutex
+	recoverBatchSize int           // 每个事务恢复的 provider 数，<=0 时使用默认值
+	recoverTimeout   time.Duration // 单次自动恢复的总超时，<=0 时使用默认值
+	onRecovered      []func([]BlacklistRecovery)
+
+	providerService *ProviderService
+}
+
+const (
+	// clockJumpThreshold 墙上时钟与单调时钟的偏差超过该值时视为时钟跳变
+	clockJumpThreshold = time.Minute
+	// clockSkewTolerance 剩余拉黑时长超出原始时长的容差，超过则视为时钟被回拨
+	clockSkewTolerance = time.Minute
+
+	// defaultRecoverBatchSize 自动恢复时每个事务处理的 provider 数，分批提交避免长时间占用写锁
+	defaultRecoverBatchSize = 50
+	// defaultRecoverTimeout 单次自动恢复的总超时，超时后剩余的留到下次检查
+	defaultRecoverTimeout = 10 * time.Second
+)
+
+// BlacklistRecoveredEvent provider 自动恢复后的前端事件名
+const BlacklistRecoveredEvent = "blacklist:recovered"
+
+// BlacklistRecovery 一次自动恢复的 provider
+type BlacklistRecovery struct {
+	Platform     string `json:"platform"`
+	ProviderName string `json:"providerName"`
+}
+
+// recoverItem 待自动恢复的黑名单记录
+type recoverItem struct {
+	Platform     string
+	ProviderName string
+	CappedUntil  time.Time // 非零表示时钟回拨，仅将剩余时长收敛到原始时长，不恢复
 }
 
 // BlacklistStatus 黑名单状态（用于前端展示）
 type BlacklistStatus struct {
 	Platform         string     `json:"platform"`
 	ProviderName     string     `json:"providerName"`
+	Note             string     `json:"note,omitempty"` // provider 备注
 	FailureCount     int        `json:"failureCount"`
 	BlacklistedAt    *time.Time `json:"blacklistedAt"`
 	BlacklistedUntil *time.Time `json:"blacklistedUntil"`
@@ -29,11 +72,22 @@ type BlacklistStatus struct {
 	BlacklistLevel       int        `json:"blacklistLevel"`       // 当前黑名单等级 (0-5)
 	LastRecoveredAt      *time.Time `json:"lastRecoveredAt"`      // 最后恢复时间
 	ForgivenessRemaining int        `json:"forgivenessRemaining"` // 距离宽恕还剩多少秒（3小时倒计时）
+
+	// 429 限流冷却：不计入失败和等级
+	IsRateLimited    bool       `json:"isRateLimited"`
+	RateLimitedUntil *time.Time `json:"rateLimitedUntil,omitempty"`
+
+	// 观察期相关字段
+	InProbation   bool `json:"inProbation"`   // 是否处于恢复后的观察期
+	SuccessStreak int  `json:"successStreak"` // 观察期内的连续成功次数
+
+	HealthScore float64 `json:"healthScore"` // 0-100 健康分，见 HealthScore
 }
 
 func NewBlacklistService(settingsService *SettingsService) *BlacklistService {
 	return &BlacklistService{
 		settingsService: settingsService,
+		clock:           systemClock,
 	}
 }
 
@@ -57,12 +111,14 @@ func (bs *BlacklistService) RecordSuccess(platform string, providerName string)
 	var lastRecoveredAt sql.NullTime
 	var lastDegradeHour int
 	var blacklistedUntil sql.NullTime
+	var inProbation bool
+	var successStreak int
 
 	err = db.QueryRow(`
-		SELECT id, blacklist_level, last_recovered_at, last_degrade_hour, blacklisted_until
+		SELECT id, blacklist_level, last_recovered_at, last_degrade_hour, blacklisted_until, in_probation, success_streak
 		FROM provider_blacklist
 		WHERE platform = ? AND provider_name = ?
-	`, platform, providerName).Scan(&id, &blacklistLevel, &lastRecoveredAt, &lastDegradeHour, &blacklistedUntil)
+	`, platform, providerName).Scan(&id, &blacklistLevel, &lastRecoveredAt, &lastDegradeHour, &blacklistedUntil, &inProbation, &successStreak)
 
 	if err == sql.ErrNoRows {
 		// 没有失败记录，无需操作
@@ -71,7 +127,14 @@ func (bs *BlacklistService) RecordSuccess(platform string, providerName string)
 		return fmt.Errorf("查询黑名单记录失败: %w", err)
 	}
 
-	now := time.Now()
+	now := bs.clock.Now()
+
+	// 观察期：累计连续成功次数，达到阈值后退出观察期
+	if inProbation {
+		if err := bs.advanceProbation(db, id, platform, providerName, successStreak+1, levelConfig.ProbationSuccessThreshold); err != nil {
+			return err
+		}
+	}
 
 	// 检查是否刚从拉黑中恢复（blacklisted_until 刚过期且 last_recovered_at 未设置）
 	justRecovered := false
@@ -171,6 +234,10 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 		log.Printf("🚫 拉黑功能已关闭，跳过 provider %s/%s 的失败记录", platform, providerName)
 		return nil
 	}
+	if bs.providerService.neverBlacklisted(platform, providerName) {
+		log.Printf("🛡️  Provider %s/%s 设置了从不拉黑，跳过失败记录", platform, providerName)
+		return nil
+	}
 
 	db, err := xdb.DB("default")
 	if err != nil {
@@ -193,10 +260,10 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 			threshold = levelConfig.FailureThreshold
 			duration = levelConfig.FallbackDurationMinutes
 		}
-		return bs.recordFailureFixedMode(platform, providerName, levelConfig.FallbackMode, duration, threshold)
+		return bs.recordFailureFixedMode(platform, providerName, levelConfig.FallbackMode, duration, threshold, levelConfig.ProbationSuccessThreshold > 0)
 	}
 
-	now := time.Now()
+	now := bs.clock.Now()
 
 	// 查询现有记录
 	var id int
@@ -291,11 +358,14 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 				last_failure_at = ?,
 				blacklisted_at = ?,
 				blacklisted_until = ?,
+				blacklist_duration_sec = ?,
 				blacklist_level = ?,
 				auto_recovered = 0,
-				last_failure_window_start = ?
+				last_failure_window_start = ?,
+				in_probation = ?,
+				success_streak = 0
 			WHERE id = ?
-		`, now, blacklistedAt, blacklistedUntil, newLevel, now, id)
+		`, now, blacklistedAt, blacklistedUntil, duration*60, newLevel, now, levelConfig.ProbationSuccessThreshold > 0, id)
 
 		if err != nil {
 			return fmt.Errorf("更新拉黑状态失败: %w", err)
@@ -308,7 +378,7 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 		// 未达到阈值，仅更新失败计数和窗口起始时间
 		_, err = db.Exec(`
 			UPDATE provider_blacklist
-			SET failure_count = ?, last_failure_at = ?, last_failure_window_start = ?
+			SET failure_count = ?, last_failure_at = ?, last_failure_window_start = ?, success_streak = 0
 			WHERE id = ?
 		`, failureCount, now, now, id)
 
@@ -324,7 +394,7 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 }
 
 // recordFailureFixedMode 固定拉黑模式（向后兼容）
-func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName string, fallbackMode string, fallbackDuration int, failureThreshold int) error {
+func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName string, fallbackMode string, fallbackDuration int, failureThreshold int, probation bool) error {
 	if fallbackMode == "none" {
 		log.Printf("🚫 Provider %s/%s 失败，但等级拉黑已关闭且 fallbackMode=none，不拉黑", platform, providerName)
 		return nil
@@ -336,7 +406,7 @@ func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName
 		return fmt.Errorf("获取数据库连接失败: %w", err)
 	}
 
-	now := time.Now()
+	now := bs.clock.Now()
 
 	// 查询现有记录
 	var id int
@@ -387,9 +457,12 @@ func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName
 				last_failure_at = ?,
 				blacklisted_at = ?,
 				blacklisted_until = ?,
-				auto_recovered = 0
+				blacklist_duration_sec = ?,
+				auto_recovered = 0,
+				in_probation = ?,
+				success_streak = 0
 			WHERE id = ?
-		`, failureCount, now, blacklistedAt, blacklistedUntil, id)
+		`, failureCount, now, blacklistedAt, blacklistedUntil, fallbackDuration*60, probation, id)
 
 		if err != nil {
 			return fmt.Errorf("更新拉黑状态失败: %w", err)
@@ -402,7 +475,7 @@ func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName
 		// 更新失败计数
 		_, err = db.Exec(`
 			UPDATE provider_blacklist
-			SET failure_count = ?, last_failure_at = ?
+			SET failure_count = ?, last_failure_at = ?, success_streak = 0
 			WHERE id = ?
 		`, failureCount, now, id)
 
@@ -416,6 +489,64 @@ func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName
 	return nil
 }
 
+// advanceProbation 记录观察期内的一次成功，连续成功达到阈值后退出观察期
+func (bs *BlacklistService) advanceProbation(db *sql.DB, id int, platform string, providerName string, streak int, threshold int) error {
+	if threshold <= 0 || streak >= threshold {
+		if _, err := db.Exec(`
+			UPDATE provider_blacklist
+			SET in_probation = 0, success_streak = 0
+			WHERE id = ?
+		`, id); err != nil {
+			return fmt.Errorf("退出观察期失败: %w", err)
+		}
+		log.Printf("🟢 Provider %s/%s 连续成功 %d 次，退出观察期", platform, providerName, streak)
+		return nil
+	}
+
+	if _, err := db.Exec(`
+		UPDATE provider_blacklist
+		SET success_streak = ?
+		WHERE id = ?
+	`, streak, id); err != nil {
+		return fmt.Errorf("更新观察期连续成功次数失败: %w", err)
+	}
+	log.Printf("🟡 Provider %s/%s 观察期连续成功: %d/%d", platform, providerName, streak, threshold)
+	return nil
+}
+
+// IsInProbation 检查 provider 是否处于恢复后的观察期（拉黑中的 provider 不算观察期）
+func (bs *BlacklistService) IsInProbation(platform string, providerName string) bool {
+	levelConfig, err := bs.settingsService.GetBlacklistLevelConfig()
+	if err != nil || levelConfig.ProbationSuccessThreshold <= 0 {
+		return false
+	}
+
+	db, err := xdb.DB("default")
+	if err != nil {
+		log.Printf("⚠️  获取数据库连接失败: %v", err)
+		return false
+	}
+
+	var inProbation bool
+	var blacklistedUntil sql.NullTime
+	err = db.QueryRow(`
+		SELECT in_probation, blacklisted_until
+		FROM provider_blacklist
+		WHERE platform = ? AND provider_name = ?
+	`, platform, providerName).Scan(&inProbation, &blacklistedUntil)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("⚠️  查询观察期状态失败: %v", err)
+		}
+		return false
+	}
+
+	if blacklistedUntil.Valid && blacklistedUntil.Time.After(bs.clock.Now()) {
+		return false
+	}
+	return inProbation
+}
+
 // getLevelDuration 根据等级获取拉黑时长（分钟）
 func (bs *BlacklistService) getLevelDuration(level int, config *BlacklistLevelConfig) int {
 	switch level {
@@ -434,7 +565,7 @@ func (bs *BlacklistService) getLevelDuration(level int, config *BlacklistLevelCo
 	}
 }
 
-// IsBlacklisted 检查 provider 是否在黑名单中
+// IsBlacklisted 检查 provider 是否在黑名单中（含 429 限流冷却），返回较晚的恢复时间
 func (bs *BlacklistService) IsBlacklisted(platform string, providerName string) (bool, *time.Time) {
 	// 如果拉黑功能已关闭，始终返回未拉黑
 	if !bs.settingsService.IsBlacklistEnabled() {
@@ -447,14 +578,15 @@ func (bs *BlacklistService) IsBlacklisted(platform string, providerName string)
 		return false, nil
 	}
 
-	var blacklistedUntil sql.NullTime
+	var blacklistedUntil, rateLimitedUntil sql.NullTime
 
 	// 移除 SQL 时间比较，改为 Go 代码判断（修复时区 bug）
 	err = db.QueryRow(`
-		SELECT blacklisted_until
+		SELECT blacklisted_until, rate_limited_until
 		FROM provider_blacklist
-		WHERE platform = ? AND provider_name = ? AND blacklisted_until IS NOT NULL
-	`, platform, providerName).Scan(&blacklistedUntil)
+		WHERE platform = ? AND provider_name = ?
+			AND (blacklisted_until IS NOT NULL OR rate_limited_until IS NOT NULL)
+	`, platform, providerName).Scan(&blacklistedUntil, &rateLimitedUntil)
 
 	if err == sql.ErrNoRows {
 		return false, nil
@@ -463,12 +595,18 @@ func (bs *BlacklistService) IsBlacklisted(platform string, providerName string)
 		return false, nil
 	}
 
-	if blacklistedUntil.Valid {
-		// 使用 Go 代码比较时间（正确处理时区）
-		if blacklistedUntil.Time.After(time.Now()) {
-			return true, &blacklistedUntil.Time
+	// 使用 Go 代码比较时间（正确处理时区）
+	now := bs.clock.Now()
+	var until *time.Time
+	for _, t := range []sql.NullTime{blacklistedUntil, rateLimitedUntil} {
+		if t.Valid && t.Time.After(now) && (until == nil || t.Time.After(*until)) {
+			value := t.Time
+			until = &value
 		}
 	}
+	if until != nil && !bs.providerService.neverBlacklisted(platform, providerName) {
+		return true, until
+	}
 
 	return false, nil
 }
@@ -480,17 +618,20 @@ func (bs *BlacklistService) ManualUnblockAndReset(platform string, providerName
 		return fmt.Errorf("获取数据库连接失败: %w", err)
 	}
 
-	now := time.Now()
+	now := bs.clock.Now()
 
 	result, err := db.Exec(`
 		UPDATE provider_blacklist
 		SET blacklisted_at = NULL,
 			blacklisted_until = NULL,
+			rate_limited_until = NULL,
 			failure_count = 0,
 			blacklist_level = 0,
 			last_recovered_at = ?,
 			last_degrade_hour = 0,
-			auto_recovered = 0
+			auto_recovered = 0,
+			in_probation = 0,
+			success_streak = 0
 		WHERE platform = ? AND provider_name = ?
 	`, now, platform, providerName)
 
@@ -540,16 +681,25 @@ func (bs *BlacklistService) ManualResetLevel(platform string, providerName strin
 }
 
 // AutoRecoverExpired 自动恢复过期的黑名单（由定时器调用）
-// 使用事务批量处理，避免多次单独写入导致的并发锁冲突
+// 按批次使用事务处理（见 SetAutoRecoverOptions），大批量写入期间跳过，恢复后通知 OnRecovered 回调
 func (bs *BlacklistService) AutoRecoverExpired() error {
 	db, err := xdb.DB("default")
 	if err != nil {
 		return fmt.Errorf("获取数据库连接失败: %w", err)
 	}
 
+	now := bs.clock.Now()
+	bs.detectClockJump(now)
+
+	// 清空日志、数据库快照等大批量写入期间跳过，下次检查再恢复
+	if bulkWriteInProgress() {
+		log.Printf("⏸️  有大批量写入正在进行，跳过本次自动恢复")
+		return nil
+	}
+
 	// 查询需要恢复的 provider（移除 SQL 时间比较，改为 Go 代码判断）
 	rows, err := db.Query(`
-		SELECT platform, provider_name, blacklisted_until
+		SELECT platform, provider_name, blacklisted_at, blacklisted_until, blacklist_duration_sec
 		FROM provider_blacklist
 		WHERE blacklisted_until IS NOT NULL
 			AND auto_recovered = 0
@@ -560,29 +710,42 @@ func (bs *BlacklistService) AutoRecoverExpired() error {
 	}
 	defer rows.Close()
 
-	now := time.Now()
-	type RecoverItem struct {
-		Platform     string
-		ProviderName string
-	}
-	var toRecover []RecoverItem
+	var toRecover []recoverItem
 
 	// 收集所有需要恢复的 provider
 	for rows.Next() {
 		var platform, providerName string
-		var blacklistedUntil sql.NullTime
+		var blacklistedAt, blacklistedUntil sql.NullTime
+		var durationSec sql.NullInt64
 
-		if err := rows.Scan(&platform, &providerName, &blacklistedUntil); err != nil {
+		if err := rows.Scan(&platform, &providerName, &blacklistedAt, &blacklistedUntil, &durationSec); err != nil {
 			log.Printf("⚠️  读取恢复记录失败: %v", err)
 			continue
 		}
 
 		// 使用 Go 代码判断是否过期（正确处理时区）
-		if !blacklistedUntil.Valid || blacklistedUntil.Time.After(now) {
-			continue // 未过期，跳过
+		if !blacklistedUntil.Valid {
+			continue
+		}
+		if blacklistedUntil.Time.After(now) {
+			// 未过期：剩余时长超过原始拉黑时长说明系统时钟被回拨，收敛剩余冷却时间
+			total := time.Duration(durationSec.Int64) * time.Second
+			if total <= 0 && blacklistedAt.Valid {
+				total = blacklistedUntil.Time.Sub(blacklistedAt.Time) // 旧记录没有保存时长
+			}
+			if total > 0 && blacklistedUntil.Time.Sub(now) > total+clockSkewTolerance {
+				log.Printf("⏰ Provider %s/%s 剩余拉黑时长 %s 超过原始时长 %s（系统时钟可能被回拨），已收敛",
+					platform, providerName, blacklistedUntil.Time.Sub(now).Round(time.Second), total)
+				toRecover = append(toRecover, recoverItem{
+					Platform:     platform,
+					ProviderName: providerName,
+					CappedUntil:  now.Add(total),
+				})
+			}
+			continue
 		}
 
-		toRecover = append(toRecover, RecoverItem{
+		toRecover = append(toRecover, recoverItem{
 			Platform:     platform,
 			ProviderName: providerName,
 		})
@@ -593,18 +756,67 @@ func (bs *BlacklistService) AutoRecoverExpired() error {
 		return nil
 	}
 
-	// 使用事务批量更新，避免多次单独写入导致的锁冲突
-	tx, err := db.Begin()
+	batchSize, timeout := bs.autoRecoverOptions()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// 分批提交：每批一个事务，批次之间让出写锁给正常请求
+	var recovered []BlacklistRecovery
+	var firstErr error
+	for start := 0; start < len(toRecover); start += batchSize {
+		if start > 0 && bulkWriteInProgress() {
+			log.Printf("⏸️  有大批量写入正在进行，剩余 %d 个待恢复的 provider 留到下次检查", len(toRecover)-start)
+			break
+		}
+		end := min(start+batchSize, len(toRecover))
+		batch, err := recoverBatch(ctx, db, now, toRecover[start:end])
+		recovered = append(recovered, batch...)
+		if err != nil {
+			log.Printf("⚠️  %v", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			if ctx.Err() != nil {
+				log.Printf("⏱️  自动恢复超时（%s），剩余 %d 个待恢复的 provider 留到下次检查", timeout, len(toRecover)-end)
+				break
+			}
+		}
+	}
+
+	if len(recovered) > 0 {
+		names := make([]string, 0, len(recovered))
+		for _, item := range recovered {
+			names = append(names, fmt.Sprintf("%s/%s", item.Platform, item.ProviderName))
+		}
+		log.Printf("✅ 自动恢复 %d 个过期拉黑: %v", len(recovered), names)
+		bs.notifyRecovered(recovered)
+	}
+
+	return firstErr
+}
+
+// recoverBatch 在一个事务中恢复一批过期的 provider，事务提交失败时整批回滚
+func recoverBatch(ctx context.Context, db *sql.DB, now time.Time, items []recoverItem) ([]BlacklistRecovery, error) {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("开启事务失败: %w", err)
+		return nil, fmt.Errorf("开启事务失败: %w", err)
 	}
 
-	var recovered []string
+	var recovered []BlacklistRecovery
 	var failed []string
+	for _, item := range items {
+		if !item.CappedUntil.IsZero() {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE provider_blacklist
+				SET blacklisted_at = ?, blacklisted_until = ?
+				WHERE platform = ? AND provider_name = ?
+			`, now, item.CappedUntil, item.Platform, item.ProviderName); err != nil {
+				log.Printf("⚠️  收敛拉黑时长失败: %s/%s - %v", item.Platform, item.ProviderName, err)
+			}
+			continue
+		}
 
-	// 批量更新所有过期的 provider
-	for _, item := range toRecover {
-		_, err := tx.Exec(`
+		_, err := tx.ExecContext(ctx, `
 			UPDATE provider_blacklist
 			SET auto_recovered = 1, failure_count = 0
 			WHERE platform = ? AND provider_name = ?
@@ -614,25 +826,78 @@ func (bs *BlacklistService) AutoRecoverExpired() error {
 			failed = append(failed, fmt.Sprintf("%s/%s", item.Platform, item.ProviderName))
 			log.Printf("⚠️  标记恢复状态失败: %s/%s - %v", item.Platform, item.ProviderName, err)
 		} else {
-			recovered = append(recovered, fmt.Sprintf("%s/%s", item.Platform, item.ProviderName))
+			recovered = append(recovered, BlacklistRecovery{Platform: item.Platform, ProviderName: item.ProviderName})
 		}
 	}
 
-	// 提交事务（一次性提交所有更新）
 	if err := tx.Commit(); err != nil {
-		log.Printf("⚠️  提交恢复事务失败: %v，所有更新已回滚", err)
-		return fmt.Errorf("提交事务失败: %w", err)
+		return nil, fmt.Errorf("提交恢复事务失败: %w，本批 %d 个更新已回滚", err, len(items))
 	}
+	if len(failed) > 0 {
+		log.Printf("⚠️  恢复失败 %d 个: %v", len(failed), failed)
+	}
+	return recovered, nil
+}
 
-	if len(recovered) > 0 {
-		log.Printf("✅ 自动恢复 %d 个过期拉黑: %v", len(recovered), recovered)
+// SetAutoRecoverOptions 设置自动恢复的批大小和总超时，传 0 表示使用默认值（50 个 / 10 秒）
+func (bs *BlacklistService) SetAutoRecoverOptions(batchSize int, timeout time.Duration) {
+	bs.recoverMu.Lock()
+	defer bs.recoverMu.Unlock()
+	bs.recoverBatchSize = batchSize
+	bs.recoverTimeout = timeout
+}
+
+func (bs *BlacklistService) autoRecoverOptions() (int, time.Duration) {
+	bs.recoverMu.Lock()
+	defer bs.recoverMu.Unlock()
+	batchSize, timeout := bs.recoverBatchSize, bs.recoverTimeout
+	if batchSize <= 0 {
+		batchSize = defaultRecoverBatchSize
+	}
+	if timeout <= 0 {
+		timeout = defaultRecoverTimeout
 	}
+	return batchSize, timeout
+}
 
-	if len(failed) > 0 {
-		log.Printf("⚠️  恢复失败 %d 个: %v", len(failed), failed)
+// BindProviderService 关联供应商服务，据此识别从不拉黑的 provider，GetBlacklistStatus 附带 provider 备注
+func (bs *BlacklistService) BindProviderService(providerService *ProviderService) {
+	bs.providerService = providerService
+}
+
+// OnRecovered 注册 provider 自动恢复回调（main.go 据此向前端发送 BlacklistRecoveredEvent）
+func (bs *BlacklistService) OnRecovered(fn func(recovered []BlacklistRecovery)) {
+	bs.recoverMu.Lock()
+	defer bs.recoverMu.Unlock()
+	bs.onRecovered = append(bs.onRecovered, fn)
+}
+
+func (bs *BlacklistService) notifyRecovered(recovered []BlacklistRecovery) {
+	bs.recoverMu.Lock()
+	listeners := append([]func([]BlacklistRecovery){}, bs.onRecovered...)
+	bs.recoverMu.Unlock()
+	for _, fn := range listeners {
+		fn(recovered)
 	}
+}
 
-	return nil
+// detectClockJump 比较墙上时钟与单调时钟的流逝时间，检测两次检查之间的系统时钟跳变（休眠唤醒、NTP 校时等）
+func (bs *BlacklistService) detectClockJump(now time.Time) {
+	bs.clockMu.Lock()
+	last := bs.lastRecoverCheck
+	bs.lastRecoverCheck = now
+	bs.clockMu.Unlock()
+
+	if last.IsZero() {
+		return
+	}
+	wallElapsed := now.Round(0).Sub(last.Round(0))
+	monoElapsed := now.Sub(last) // 两者都带单调时钟读数时按单调时钟计算
+	jump := wallElapsed - monoElapsed
+	if jump > clockJumpThreshold || jump < -clockJumpThreshold {
+		log.Printf("⏰ 检测到系统时钟跳变 %s（墙上时钟流逝 %s，实际流逝 %s），黑名单到期时间按当前时钟重新校验",
+			jump.Round(time.Second), wallElapsed.Round(time.Second), monoElapsed.Round(time.Second))
+	}
 }
 
 // GetBlacklistStatus 获取所有黑名单状态（用于前端展示，支持等级拉黑）
@@ -657,7 +922,10 @@ func (bs *BlacklistService) GetBlacklistStatus(platform string) ([]BlacklistStat
 			blacklisted_until,
 			last_failure_at,
 			blacklist_level,
-			last_recovered_at
+			last_recovered_at,
+			in_probation,
+			success_streak,
+			rate_limited_until
 		FROM provider_blacklist
 		WHERE platform = ?
 		ORDER BY last_failure_at DESC
@@ -669,11 +937,12 @@ func (bs *BlacklistService) GetBlacklistStatus(platform string) ([]BlacklistStat
 	defer rows.Close()
 
 	var statuses []BlacklistStatus
-	now := time.Now()
+	now := bs.clock.Now()
+	notes := bs.providerService.providerNotes(platform)
 
 	for rows.Next() {
 		var s BlacklistStatus
-		var blacklistedAt, blacklistedUntil, lastFailureAt, lastRecoveredAt sql.NullTime
+		var blacklistedAt, blacklistedUntil, lastFailureAt, lastRecoveredAt, rateLimitedUntil sql.NullTime
 
 		err := rows.Scan(
 			&s.Platform,
@@ -684,6 +953,9 @@ func (bs *BlacklistService) GetBlacklistStatus(platform string) ([]BlacklistStat
 			&lastFailureAt,
 			&s.BlacklistLevel,
 			&lastRecoveredAt,
+			&s.InProbation,
+			&s.SuccessStreak,
+			&rateLimitedUntil,
 		)
 
 		if err != nil {
@@ -702,6 +974,13 @@ func (bs *BlacklistService) GetBlacklistStatus(platform string) ([]BlacklistStat
 				s.RemainingSeconds = int(blacklistedUntil.Time.Sub(now).Seconds())
 			}
 		}
+		if rateLimitedUntil.Valid && rateLimitedUntil.Time.After(now) {
+			s.IsRateLimited = true
+			s.RateLimitedUntil = &rateLimitedUntil.Time
+			if remaining := int(rateLimitedUntil.Time.Sub(now).Seconds()); remaining > s.RemainingSeconds {
+				s.RemainingSeconds = remaining
+			}
+		}
 		if lastFailureAt.Valid {
 			s.LastFailureAt = &lastFailureAt.Time
 		}
@@ -721,8 +1000,23 @@ func (bs *BlacklistService) GetBlacklistStatus(platform string) ([]BlacklistStat
 			}
 		}
 
+		s.Note = notes[s.ProviderName]
+
+		// 观察期仅在拉黑结束且功能开启时生效
+		if s.IsBlacklisted || levelConfig.ProbationSuccessThreshold <= 0 {
+			s.InProbation = false
+		}
+
 		statuses = append(statuses, s)
 	}
+	rows.Close()
+
+	weights := bs.healthScoreWeights()
+	for i := range statuses {
+		if signals, err := loadHealthSignals(db, statuses[i].Platform, statuses[i].ProviderName, now); err == nil {
+			statuses[i].HealthScore = computeHealthScore(signals, weights, now)
+		}
+	}
 
 	return statuses, nil
 }
@@ -0,0 +1,507 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestProbationLifecycle(t *testing.T) {
+	setupTestEnv(t)
+
+	settings := &SettingsService{}
+	config := DefaultBlacklistLevelConfig()
+	config.ProbationSuccessThreshold = 2
+	if err := settings.UpdateBlacklistLevelConfig(config); err != nil {
+		t.Fatalf("保存等级拉黑配置失败: %v", err)
+	}
+	bs := NewBlacklistService(settings)
+
+	// 固定模式默认阈值为 3 次
+	for i := 0; i < 3; i++ {
+		if err := bs.RecordFailure("claude", "flaky"); err != nil {
+			t.Fatalf("记录失败出错: %v", err)
+		}
+	}
+	if blacklisted, _ := bs.IsBlacklisted("claude", "flaky"); !blacklisted {
+		t.Fatalf("连续失败达到阈值后应被拉黑")
+	}
+	if bs.IsInProbation("claude", "flaky") {
+		t.Fatalf("拉黑期间不应视为观察期")
+	}
+
+	// 模拟拉黑到期
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatalf("获取数据库失败: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE provider_blacklist SET blacklisted_until = ? WHERE provider_name = ?`,
+		time.Now().Add(-time.Minute), "flaky"); err != nil {
+		t.Fatalf("更新拉黑时间失败: %v", err)
+	}
+	if err := bs.AutoRecoverExpired(); err != nil {
+		t.Fatalf("自动恢复失败: %v", err)
+	}
+	if !bs.IsInProbation("claude", "flaky") {
+		t.Fatalf("恢复后应进入观察期")
+	}
+
+	streak := func() int {
+		statuses, err := bs.GetBlacklistStatus("claude")
+		if err != nil || len(statuses) != 1 {
+			t.Fatalf("获取黑名单状态失败: %v (%d 条)", err, len(statuses))
+		}
+		return statuses[0].SuccessStreak
+	}
+
+	if err := bs.RecordSuccess("claude", "flaky"); err != nil {
+		t.Fatalf("记录成功出错: %v", err)
+	}
+	if got := streak(); got != 1 {
+		t.Fatalf("连续成功次数 = %d, 期望 1", got)
+	}
+
+	// 观察期内失败会重置连续成功次数
+	if err := bs.RecordFailure("claude", "flaky"); err != nil {
+		t.Fatalf("记录失败出错: %v", err)
+	}
+	if got := streak(); got != 0 {
+		t.Fatalf("失败后连续成功次数 = %d, 期望 0", got)
+	}
+	if !bs.IsInProbation("claude", "flaky") {
+		t.Fatalf("未达阈值前应保持观察期")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := bs.RecordSuccess("claude", "flaky"); err != nil {
+			t.Fatalf("记录成功出错: %v", err)
+		}
+	}
+	if bs.IsInProbation("claude", "flaky") {
+		t.Fatalf("连续成功达到阈值后应退出观察期")
+	}
+}
+
+func TestFilterProbationProviders(t *testing.T) {
+	active := []Provider{{Name: "healthy"}, {Name: "probation"}}
+	probation := map[string]bool{"probation": true}
+
+	skipped := filterProbationProviders(active, probation, 10, func(n int) int { return 50 })
+	if len(skipped) != 1 || skipped[0].Name != "healthy" {
+		t.Fatalf("未抽中时应跳过观察期 provider，得到 %v", skipped)
+	}
+
+	kept := filterProbationProviders(active, probation, 10, func(n int) int { return 5 })
+	if len(kept) != 2 {
+		t.Fatalf("抽中时应保留观察期 provider，得到 %v", kept)
+	}
+
+	only := filterProbationProviders(active[1:], probation, 0, func(n int) int { return 99 })
+	if len(only) != 1 {
+		t.Fatalf("只剩观察期 provider 时应退回原列表，得到 %v", only)
+	}
+}
+
+func TestAutoRecoverCapsCooldownAfterClockRollback(t *testing.T) {
+	setupTestEnv(t)
+
+	settings := &SettingsService{}
+	bs := NewBlacklistService(settings)
+	clock := newFakeClock(time.Date(2025, 6, 1, 12, 0, 0, 0, time.Local))
+	bs.clock = clock
+
+	// 固定模式默认阈值 3 次、拉黑 30 分钟
+	for i := 0; i < 3; i++ {
+		if err := bs.RecordFailure("claude", "sleepy"); err != nil {
+			t.Fatalf("记录失败出错: %v", err)
+		}
+	}
+	_, until := bs.IsBlacklisted("claude", "sleepy")
+	if until == nil {
+		t.Fatalf("连续失败达到阈值后应被拉黑")
+	}
+	cooldown := until.Sub(clock.Now())
+
+	// 时钟回拨 5 小时：按绝对时间计算会被多拉黑 5 小时
+	clock.Set(clock.Now().Add(-5 * time.Hour))
+	if err := bs.AutoRecoverExpired(); err != nil {
+		t.Fatalf("自动恢复失败: %v", err)
+	}
+	blacklisted, until := bs.IsBlacklisted("claude", "sleepy")
+	if !blacklisted || until == nil {
+		t.Fatalf("时钟回拨后不应直接恢复")
+	}
+	if remaining := until.Sub(clock.Now()); remaining > cooldown+time.Second {
+		t.Fatalf("剩余拉黑时长 = %s, 应收敛到不超过 %s", remaining, cooldown)
+	}
+
+	// 冷却时间过后正常恢复
+	clock.Advance(cooldown + time.Minute)
+	if err := bs.AutoRecoverExpired(); err != nil {
+		t.Fatalf("自动恢复失败: %v", err)
+	}
+	if blacklisted, _ := bs.IsBlacklisted("claude", "sleepy"); blacklisted {
+		t.Fatalf("冷却时间过后应恢复")
+	}
+}
+
+func TestLevelBlacklistEscalationAndForgiveness(t *testing.T) {
+	setupTestEnv(t)
+
+	settings := &SettingsService{}
+	config := DefaultBlacklistLevelConfig()
+	config.EnableLevelBlacklist = true
+	if err := settings.UpdateBlacklistLevelConfig(config); err != nil {
+		t.Fatalf("保存等级拉黑配置失败: %v", err)
+	}
+	bs := NewBlacklistService(settings)
+	clock := newFakeClock(time.Date(2025, 6, 1, 9, 0, 0, 0, time.Local))
+	bs.clock = clock
+
+	// 每次失败间隔超过 30 秒去重窗口
+	failUntilBlacklisted := func() {
+		t.Helper()
+		for i := 0; i < config.FailureThreshold; i++ {
+			if err := bs.RecordFailure("claude", "escalate"); err != nil {
+				t.Fatalf("记录失败出错: %v", err)
+			}
+			clock.Advance(time.Duration(config.DedupeWindowSeconds+1) * time.Second)
+		}
+	}
+	level := func() int {
+		t.Helper()
+		statuses, err := bs.GetBlacklistStatus("claude")
+		if err != nil || len(statuses) != 1 {
+			t.Fatalf("获取黑名单状态失败: %v (%d 条)", err, len(statuses))
+		}
+		return statuses[0].BlacklistLevel
+	}
+
+	failUntilBlacklisted()
+	if got := level(); got != 1 {
+		t.Fatalf("首次拉黑等级 = L%d, 期望 L1", got)
+	}
+
+	// L1 到期后恢复，开始计时
+	clock.Advance(time.Duration(config.L1DurationMinutes) * time.Minute)
+	if err := bs.RecordSuccess("claude", "escalate"); err != nil {
+		t.Fatalf("记录成功出错: %v", err)
+	}
+
+	// 恢复后 1 小时内再次失败：跳级惩罚 L1 → L3
+	clock.Advance(time.Hour)
+	failUntilBlacklisted()
+	if got := level(); got != 3 {
+		t.Fatalf("跳级惩罚后等级 = L%d, 期望 L3", got)
+	}
+	if blacklisted, _ := bs.IsBlacklisted("claude", "escalate"); !blacklisted {
+		t.Fatalf("L3 期间应处于拉黑状态")
+	}
+
+	// L3 到期且距恢复超过宽恕时长，成功一次即清零
+	clock.Advance(time.Duration(config.ForgivenessHours*float64(time.Hour)) + time.Duration(config.L3DurationMinutes)*time.Minute)
+	if err := bs.RecordSuccess("claude", "escalate"); err != nil {
+		t.Fatalf("记录成功出错: %v", err)
+	}
+	if got := level(); got != 0 {
+		t.Fatalf("宽恕后等级 = L%d, 期望 L0", got)
+	}
+}
+
+func TestHealthScore(t *testing.T) {
+	setupTestEnv(t)
+
+	settings := &SettingsService{}
+	bs := NewBlacklistService(settings)
+	clock := newFakeClock(time.Date(2025, 6, 1, 9, 0, 0, 0, time.Local))
+	bs.clock = clock
+
+	logRequests := func(provider string, ok int, failed int, durationSec float64) {
+		t.Helper()
+		for i := 0; i < ok+failed; i++ {
+			code := 200
+			if i >= ok {
+				code = 500
+			}
+			insertTestRequestLog(t, xdb.Record{
+				"platform":     "claude",
+				"provider":     provider,
+				"http_code":    code,
+				"duration_sec": durationSec,
+			})
+		}
+	}
+	score := func(provider string) float64 {
+		t.Helper()
+		s, err := bs.HealthScore("claude", provider)
+		if err != nil {
+			t.Fatalf("计算健康分失败: %v", err)
+		}
+		return s
+	}
+
+	logRequests("healthy", 10, 0, 1)
+	if s := score("healthy"); s < 95 || s > 100 {
+		t.Fatalf("健康 provider 得分 = %.1f, 期望 95-100", s)
+	}
+
+	// 60% 成功率、10 秒延迟、30 分钟前失败过一次
+	logRequests("flaky", 6, 4, 10)
+	if err := bs.RecordFailure("claude", "flaky"); err != nil {
+		t.Fatalf("记录失败出错: %v", err)
+	}
+	clock.Advance(30 * time.Minute)
+	if s := score("flaky"); s != 68.3 {
+		t.Fatalf("不稳定 provider 得分 = %.1f, 期望 68.3", s)
+	}
+
+	logRequests("blocked", 10, 0, 1)
+	for i := 0; i < 3; i++ {
+		if err := bs.RecordFailure("claude", "blocked"); err != nil {
+			t.Fatalf("记录失败出错: %v", err)
+		}
+		clock.Advance(time.Minute)
+	}
+	if s := score("blocked"); s != 0 {
+		t.Fatalf("拉黑中的 provider 得分 = %.1f, 期望 0", s)
+	}
+	statuses, err := bs.GetBlacklistStatus("claude")
+	if err != nil {
+		t.Fatalf("获取黑名单状态失败: %v", err)
+	}
+	for _, status := range statuses {
+		if status.ProviderName == "blocked" && (!status.IsBlacklisted || status.HealthScore != 0) {
+			t.Fatalf("状态中的健康分不正确: %+v", status)
+		}
+	}
+
+	// 只看成功率
+	if err := settings.SetHealthScoreWeights(HealthScoreWeights{SuccessRate: 1}); err != nil {
+		t.Fatalf("保存权重失败: %v", err)
+	}
+	if s := score("flaky"); s != 60 {
+		t.Fatalf("仅成功率权重时得分 = %.1f, 期望 60", s)
+	}
+	if err := settings.SetHealthScoreWeights(HealthScoreWeights{}); err == nil {
+		t.Fatalf("权重全为 0 时应返回错误")
+	}
+}
+
+func TestAutoRecoverExpiredInBatches(t *testing.T) {
+	setupTestEnv(t)
+
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatalf("获取数据库失败: %v", err)
+	}
+	const total = 120
+	expired := time.Now().Add(-time.Minute)
+	for i := 0; i < total; i++ {
+		if _, err := db.Exec(`
+			INSERT INTO provider_blacklist (platform, provider_name, failure_count, blacklisted_at, blacklisted_until, blacklist_duration_sec)
+			VALUES (?, ?, 3, ?, ?, 1800)
+		`, "claude", fmt.Sprintf("p-%03d", i), expired.Add(-30*time.Minute), expired); err != nil {
+			t.Fatalf("插入黑名单记录失败: %v", err)
+		}
+	}
+
+	bs := NewBlacklistService(&SettingsService{})
+	bs.SetAutoRecoverOptions(25, 0)
+	var batches [][]BlacklistRecovery
+	bs.OnRecovered(func(recovered []BlacklistRecovery) {
+		batches = append(batches, recovered)
+	})
+
+	// 大批量写入期间跳过
+	done := beginBulkWrite()
+	if err := bs.AutoRecoverExpired(); err != nil {
+		t.Fatalf("自动恢复失败: %v", err)
+	}
+	done()
+	if len(batches) != 0 {
+		t.Fatalf("大批量写入期间不应恢复")
+	}
+
+	if err := bs.AutoRecoverExpired(); err != nil {
+		t.Fatalf("自动恢复失败: %v", err)
+	}
+	var remaining int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM provider_blacklist WHERE auto_recovered = 0`).Scan(&remaining); err != nil {
+		t.Fatalf("查询黑名单失败: %v", err)
+	}
+	if remaining != 0 {
+		t.Fatalf("所有过期记录应跨批次全部恢复, 剩余 %d 个", remaining)
+	}
+	if len(batches) != 1 || len(batches[0]) != total {
+		t.Fatalf("应通知一次且包含全部 %d 个 provider, 实际 %d 次", total, len(batches))
+	}
+	if blacklisted, _ := bs.IsBlacklisted("claude", "p-119"); blacklisted {
+		t.Fatalf("恢复后不应处于拉黑状态")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"120", 120 * time.Second},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{"", defaultRateLimitCooldown},
+		{"soon", defaultRateLimitCooldown},
+		{"0", time.Second},
+		{"86400", maxRateLimitCooldown},
+	}
+	for _, tc := range cases {
+		if got := parseRetryAfter(tc.value, now); got != tc.want {
+			t.Fatalf("Retry-After %q 应解析为 %s，实际 %s", tc.value, tc.want, got)
+		}
+	}
+}
+
+func TestRateLimitedProviderCooldown(t *testing.T) {
+	setupTestEnv(t)
+
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":"rate limited"}`))
+	}))
+	defer limited.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1"}`))
+	}))
+	defer backup.Close()
+
+	relay, router := newTestRelay(t)
+	clock := newFakeClock(time.Now())
+	relay.blacklistService.clock = clock
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "limited", APIURL: limited.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+		{ID: 2, Name: "backup", APIURL: backup.URL, APIKey: "sk-test", Enabled: true, Level: 2},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`))
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "msg_1") {
+		t.Fatalf("被限流后应切换到 backup，实际 %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if blacklisted, until := relay.blacklistService.IsBlacklisted("claude", "limited"); !blacklisted ||
+		until.Sub(clock.Now()) != 120*time.Second {
+		t.Fatalf("限流的 provider 应按 Retry-After 冷却 120 秒，实际 %v %v", blacklisted, until)
+	}
+	statuses, err := relay.blacklistService.GetBlacklistStatus("claude")
+	if err != nil {
+		t.Fatalf("获取黑名单状态失败: %v", err)
+	}
+	if len(statuses) != 1 {
+		t.Fatalf("应只有 limited 一条记录，实际 %+v", statuses)
+	}
+	if s := statuses[0]; !s.IsRateLimited || s.IsBlacklisted || s.BlacklistLevel != 0 || s.FailureCount != 0 || s.RemainingSeconds != 120 {
+		t.Fatalf("限流不应计入失败或提升等级: %+v", s)
+	}
+	if open, _ := relay.providerCircuits().IsOpen("claude", "limited"); open {
+		t.Fatalf("限流不应计入熔断")
+	}
+
+	clock.Advance(121 * time.Second)
+	if blacklisted, _ := relay.blacklistService.IsBlacklisted("claude", "limited"); blacklisted {
+		t.Fatalf("冷却结束后应恢复可用")
+	}
+}
+
+func TestNeverBlacklistProvider(t *testing.T) {
+	setupTestEnv(t)
+
+	var primaryHits int
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1"}`))
+	}))
+	defer backup.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.settingsService.UpdateBlacklistSettings(1, 30); err != nil {
+		t.Fatalf("更新拉黑配置失败: %v", err)
+	}
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "primary", APIURL: primary.URL, APIKey: "sk-test", Enabled: true, Level: 1, NeverBlacklist: true},
+		{ID: 2, Name: "backup", APIURL: backup.URL, APIKey: "sk-test", Enabled: true, Level: 2},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	// 每次请求都先尝试 primary，失败后切换到 backup
+	for i := 0; i < 4; i++ {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`))
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("第 %d 次请求应由 backup 返回，实际 %d: %s", i+1, rec.Code, rec.Body.String())
+		}
+	}
+	if primaryHits != 4 {
+		t.Fatalf("从不拉黑的 provider 应始终保留在可用列表中，实际只收到 %d 次请求", primaryHits)
+	}
+	states, err := relay.GetProviderCircuitStates("claude")
+	if err != nil {
+		t.Fatalf("查询熔断状态失败: %v", err)
+	}
+	for _, state := range states {
+		if state.Provider == "primary" && (state.State != "closed" || state.RecentFailures != 0) {
+			t.Fatalf("从不拉黑的 provider 不应计入短时熔断: %+v", state)
+		}
+	}
+	if blacklisted, _ := relay.blacklistService.IsBlacklisted("claude", "primary"); blacklisted {
+		t.Fatalf("从不拉黑的 provider 不应被拉黑")
+	}
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatalf("获取数据库失败: %v", err)
+	}
+	var rows, failures int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM provider_blacklist WHERE provider_name = 'primary'`).Scan(&rows); err != nil {
+		t.Fatalf("查询黑名单失败: %v", err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM request_log WHERE provider = 'primary'`).Scan(&failures); err != nil {
+		t.Fatalf("查询请求日志失败: %v", err)
+	}
+	if rows != 0 || failures != 4 {
+		t.Fatalf("失败应只写入请求日志而不计入黑名单，黑名单记录 %d 条，失败日志 %d 条", rows, failures)
+	}
+
+	// 已有的拉黑记录同样不生效
+	if _, err := db.Exec(`INSERT INTO provider_blacklist (platform, provider_name, blacklisted_at, blacklisted_until) VALUES (?, ?, ?, ?)`,
+		"claude", "primary", time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("插入黑名单记录失败: %v", err)
+	}
+	if blacklisted, _ := relay.blacklistService.IsBlacklisted("claude", "primary"); blacklisted {
+		t.Fatalf("从不拉黑的 provider 的 IsBlacklisted 应始终返回 false")
+	}
+
+	warnings := neverBlacklistWarnings([]Provider{
+		{Name: "a", Enabled: true, Level: 1, NeverBlacklist: true},
+		{Name: "b", Enabled: true, NeverBlacklist: true},
+		{Name: "c", Enabled: false, Level: 2, NeverBlacklist: true},
+		{Name: "d", Enabled: true, Level: 2, NeverBlacklist: true},
+	})
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "Level 1") || !strings.Contains(warnings[0], "a, b") {
+		t.Fatalf("同一 Level 有多个从不拉黑的 provider 时应给出警告: %v", warnings)
+	}
+}
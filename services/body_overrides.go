@@ -0,0 +1,92 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	bodyOverrideSet    = "set"
+	bodyOverrideDelete = "delete"
+)
+
+// BodyOverride 转发前对请求体执行的改写规则，Path 使用 sjson 路径语法（如 "stream_options.include_usage"）
+//
+//	{"op": "set", "path": "stream_options.include_usage", "value": true}
+//	{"op": "delete", "path": "metadata"}
+type BodyOverride struct {
+	Op    string          `json:"op"` // set / delete
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"` // op 为 set 时写入的 JSON 值
+}
+
+// validateBodyOverrides 校验改写规则，返回错误描述列表
+func validateBodyOverrides(rules []BodyOverride) []string {
+	errs := make([]string, 0)
+	for i, rule := range rules {
+		path := strings.TrimSpace(rule.Path)
+		if path == "" {
+			errs = append(errs, fmt.Sprintf("请求体改写规则 #%d 缺少 path", i+1))
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(rule.Op)) {
+		case bodyOverrideSet:
+			if len(rule.Value) == 0 || !json.Valid(rule.Value) {
+				errs = append(errs, fmt.Sprintf("请求体改写规则 #%d (%s) 的 value 不是合法的 JSON", i+1, path))
+				continue
+			}
+			if _, err := sjson.SetRawBytes([]byte(`{}`), path, rule.Value); err != nil {
+				errs = append(errs, fmt.Sprintf("请求体改写规则 #%d 的 path '%s' 无效: %v", i+1, path, err))
+			}
+		case bodyOverrideDelete:
+			if _, err := sjson.DeleteBytes([]byte(`{}`), path); err != nil {
+				errs = append(errs, fmt.Sprintf("请求体改写规则 #%d 的 path '%s' 无效: %v", i+1, path, err))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("请求体改写规则 #%d 的 op '%s' 无效，只支持 set 或 delete", i+1, rule.Op))
+		}
+	}
+	return errs
+}
+
+// applyBodyOverrides 按顺序对 JSON 请求体执行改写规则，非 JSON 请求体原样返回
+func applyBodyOverrides(body []byte, rules []BodyOverride) ([]byte, error) {
+	if len(rules) == 0 || !gjson.ValidBytes(body) {
+		return body, nil
+	}
+	modified := body
+	for _, rule := range rules {
+		path := strings.TrimSpace(rule.Path)
+		var err error
+		switch strings.ToLower(strings.TrimSpace(rule.Op)) {
+		case bodyOverrideSet:
+			modified, err = sjson.SetRawBytes(modified, path, rule.Value)
+		case bodyOverrideDelete:
+			if !gjson.GetBytes(modified, path).Exists() {
+				continue
+			}
+			modified, err = sjson.DeleteBytes(modified, path)
+		default:
+			err = fmt.Errorf("不支持的 op '%s'", rule.Op)
+		}
+		if err != nil {
+			return body, fmt.Errorf("执行请求体改写规则 %s %s 失败: %w", rule.Op, path, err)
+		}
+	}
+	return modified, nil
+}
+
+func cloneBodyOverrides(rules []BodyOverride) []BodyOverride {
+	if rules == nil {
+		return nil
+	}
+	cloned := make([]BodyOverride, len(rules))
+	for i, rule := range rules {
+		cloned[i] = BodyOverride{Op: rule.Op, Path: rule.Path, Value: append(json.RawMessage(nil), rule.Value...)}
+	}
+	return cloned
+}
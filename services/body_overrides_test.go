@@ -0,0 +1,59 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestProviderBodyOverrides(t *testing.T) {
+	setupTestEnv(t)
+
+	var received atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received.Store(string(body))
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("codex", []Provider{
+		{ID: 1, Name: "bad", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true,
+			BodyOverrides: []BodyOverride{{Op: "set", Path: "x"}}},
+	}); err == nil {
+		t.Fatalf("非法改写规则应在保存时被拒绝")
+	}
+	if err := relay.providerService.SaveProviders("codex", []Provider{
+		{ID: 1, Name: "relay", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1,
+			ModelMapping:    map[string]string{"gpt-4o": "openai/gpt-4o"},
+			SupportedModels: map[string]bool{"openai/gpt-4o": true},
+			BodyOverrides: []BodyOverride{
+				{Op: "set", Path: "stream_options.include_usage", Value: json.RawMessage(`true`)},
+				{Op: "delete", Path: "metadata"},
+			}},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	body := `{"model":"gpt-4o","stream":false,"metadata":{"user_id":"u1"},"messages":[]}`
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	got, _ := received.Load().(string)
+	if gjson.Get(got, "model").String() != "openai/gpt-4o" {
+		t.Fatalf("改写应在模型映射之后执行: %s", got)
+	}
+	if !gjson.Get(got, "stream_options.include_usage").Bool() || gjson.Get(got, "metadata").Exists() {
+		t.Fatalf("上游收到的请求体未按规则改写: %s", got)
+	}
+}
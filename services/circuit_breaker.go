@@ -0,0 +1,188 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// circuitFailureThreshold 时间窗口内所有 provider 连续失败达到该次数时熔断
+	circuitFailureThreshold = 5
+	// circuitFailureWindow 连续失败的统计窗口，第一次失败超过该时长后重新计数
+	circuitFailureWindow = time.Minute
+	// circuitCooldown 熔断后暂停转发的时长，到期后放行一个探测请求
+	circuitCooldown = 30 * time.Second
+)
+
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// CircuitBreakerStatus 某个平台的全局熔断状态
+type CircuitBreakerStatus struct {
+	Platform            string     `json:"platform"`
+	State               string     `json:"state"` // closed / open / half_open
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+	RetryAfterSeconds   int        `json:"retryAfterSeconds"` // open 状态下距离放行探测请求的秒数
+}
+
+type circuitState struct {
+	state         string
+	failures      int
+	firstFailure  time.Time
+	openedAt      time.Time
+	openUntil     time.Time
+	probeInFlight bool
+}
+
+// globalCircuitBreaker 按平台统计所有 provider 的连续失败：全部上游持续失败时暂停转发，
+// 避免在整体故障期间反复请求并把所有 provider 拉黑
+type globalCircuitBreaker struct {
+	mu     sync.Mutex
+	clock  Clock
+	states map[string]*circuitState
+}
+
+func newGlobalCircuitBreaker(clock Clock) *globalCircuitBreaker {
+	return &globalCircuitBreaker{clock: clock, states: make(map[string]*circuitState)}
+}
+
+func (b *globalCircuitBreaker) stateLocked(kind string) *circuitState {
+	st, ok := b.states[kind]
+	if !ok {
+		st = &circuitState{state: circuitClosed}
+		b.states[kind] = st
+	}
+	return st
+}
+
+// allow 判断是否放行请求；half-open 时只放行一个探测请求，probe 为 true 表示本次请求是探测请求
+// 拒绝时返回距离下次探测的等待时长
+func (b *globalCircuitBreaker) allow(kind string) (allowed bool, probe bool, retryAfter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.stateLocked(kind)
+	now := b.clock.Now()
+	switch st.state {
+	case circuitOpen:
+		if now.Before(st.openUntil) {
+			return false, false, st.openUntil.Sub(now)
+		}
+		st.state = circuitHalfOpen
+		st.probeInFlight = false
+		fmt.Printf("[INFO] %s 全局熔断冷却结束，放行探测请求\n", kind)
+		fallthrough
+	case circuitHalfOpen:
+		if st.probeInFlight {
+			return false, false, time.Second
+		}
+		st.probeInFlight = true
+		return true, true, 0
+	}
+	return true, false, 0
+}
+
+// releaseProbe 探测请求没有产生成功/失败结果（如没有可用 provider、请求被取消）时释放名额
+func (b *globalCircuitBreaker) releaseProbe(kind string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if st := b.stateLocked(kind); st.state == circuitHalfOpen {
+		st.probeInFlight = false
+	}
+}
+
+func (b *globalCircuitBreaker) recordSuccess(kind string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := b.stateLocked(kind)
+	if st.state != circuitClosed {
+		fmt.Printf("[INFO] %s 探测请求成功，全局熔断已关闭\n", kind)
+	}
+	*st = circuitState{state: circuitClosed}
+}
+
+func (b *globalCircuitBreaker) recordFailure(kind string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.stateLocked(kind)
+	now := b.clock.Now()
+	switch st.state {
+	case circuitHalfOpen:
+		st.failures++
+		b.openLocked(kind, st, now)
+		return
+	case circuitOpen:
+		return
+	}
+
+	if st.failures == 0 || now.Sub(st.firstFailure) > circuitFailureWindow {
+		st.failures = 0
+		st.firstFailure = now
+	}
+	st.failures++
+	if st.failures >= circuitFailureThreshold {
+		b.openLocked(kind, st, now)
+	}
+}
+
+func (b *globalCircuitBreaker) openLocked(kind string, st *circuitState, now time.Time) {
+	st.state = circuitOpen
+	st.openedAt = now
+	st.openUntil = now.Add(circuitCooldown)
+	st.probeInFlight = false
+	fmt.Printf("[WARN] %s 所有上游连续失败 %d 次，全局熔断 %s\n", kind, st.failures, circuitCooldown)
+}
+
+func (b *globalCircuitBreaker) reset(kind string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.states, kind)
+}
+
+func (b *globalCircuitBreaker) status(kind string) CircuitBreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.stateLocked(kind)
+	status := CircuitBreakerStatus{
+		Platform:            kind,
+		State:               st.state,
+		ConsecutiveFailures: st.failures,
+	}
+	if st.state != circuitClosed {
+		openedAt := st.openedAt
+		status.OpenedAt = &openedAt
+	}
+	if st.state == circuitOpen {
+		if remaining := st.openUntil.Sub(b.clock.Now()); remaining > 0 {
+			status.RetryAfterSeconds = int(remaining.Round(time.Second).Seconds())
+		}
+	}
+	return status
+}
+
+func (prs *ProviderRelayService) circuitBreaker() *globalCircuitBreaker {
+	prs.stateMu.Lock()
+	defer prs.stateMu.Unlock()
+	if prs.breaker == nil {
+		prs.breaker = newGlobalCircuitBreaker(systemClock)
+	}
+	return prs.breaker
+}
+
+// GetCircuitBreakerStatus 获取平台的全局熔断状态
+func (prs *ProviderRelayService) GetCircuitBreakerStatus(kind string) CircuitBreakerStatus {
+	return prs.circuitBreaker().status(strings.ToLower(strings.TrimSpace(kind)))
+}
+
+// ResetCircuitBreaker 手动关闭平台的全局熔断
+func (prs *ProviderRelayService) ResetCircuitBreaker(kind string) {
+	prs.circuitBreaker().reset(strings.ToLower(strings.TrimSpace(kind)))
+}
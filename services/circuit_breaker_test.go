@@ -0,0 +1,201 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGlobalCircuitBreakerTransitions(t *testing.T) {
+	clock := newFakeClock(time.Date(2025, 6, 1, 9, 0, 0, 0, time.Local))
+	b := newGlobalCircuitBreaker(clock)
+
+	expectState := func(want string) {
+		t.Helper()
+		if got := b.status("claude").State; got != want {
+			t.Fatalf("熔断状态 = %s, 期望 %s", got, want)
+		}
+	}
+
+	// 窗口外的失败不累计
+	for i := 0; i < circuitFailureThreshold-1; i++ {
+		b.recordFailure("claude")
+	}
+	clock.Advance(circuitFailureWindow + time.Second)
+	b.recordFailure("claude")
+	expectState(circuitClosed)
+
+	// 成功清零计数
+	b.recordSuccess("claude")
+	for i := 0; i < circuitFailureThreshold; i++ {
+		if allowed, _, _ := b.allow("claude"); !allowed {
+			t.Fatalf("第 %d 次请求不应被拒绝", i+1)
+		}
+		b.recordFailure("claude")
+	}
+	expectState(circuitOpen)
+	if allowed, _, retry := b.allow("claude"); allowed || retry <= 0 {
+		t.Fatalf("熔断期间应拒绝请求 (allowed=%v, retry=%s)", allowed, retry)
+	}
+	if b.status("codex").State != circuitClosed {
+		t.Fatalf("熔断应按平台隔离")
+	}
+
+	// 冷却结束：只放行一个探测请求，探测失败重新熔断
+	clock.Advance(circuitCooldown)
+	if allowed, probe, _ := b.allow("claude"); !allowed || !probe {
+		t.Fatalf("冷却结束后应放行探测请求")
+	}
+	expectState(circuitHalfOpen)
+	if allowed, _, _ := b.allow("claude"); allowed {
+		t.Fatalf("探测请求未完成时应拒绝其他请求")
+	}
+	b.recordFailure("claude")
+	expectState(circuitOpen)
+
+	// 探测请求没有结果时释放名额
+	clock.Advance(circuitCooldown)
+	if allowed, _, _ := b.allow("claude"); !allowed {
+		t.Fatalf("冷却结束后应放行探测请求")
+	}
+	b.releaseProbe("claude")
+	if allowed, probe, _ := b.allow("claude"); !allowed || !probe {
+		t.Fatalf("释放后应重新放行探测请求")
+	}
+
+	// 探测成功关闭熔断
+	b.recordSuccess("claude")
+	expectState(circuitClosed)
+	if allowed, probe, _ := b.allow("claude"); !allowed || probe {
+		t.Fatalf("关闭后应正常放行")
+	}
+}
+
+func TestRelayRejectsWhileCircuitOpen(t *testing.T) {
+	setupTestEnv(t)
+
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	clock := newFakeClock(time.Now())
+	relay.breaker = newGlobalCircuitBreaker(clock)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "upstream", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	for i := 0; i < circuitFailureThreshold; i++ {
+		relay.breaker.recordFailure("claude")
+	}
+
+	send := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`)))
+		return rec
+	}
+
+	rec := send()
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("熔断期间状态码 = %d, Retry-After = %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if atomic.LoadInt32(&hits) != 0 {
+		t.Fatalf("熔断期间不应请求上游")
+	}
+	if status := relay.GetCircuitBreakerStatus("claude"); status.State != circuitOpen || status.RetryAfterSeconds <= 0 {
+		t.Fatalf("熔断状态不正确: %+v", status)
+	}
+
+	clock.Advance(circuitCooldown)
+	if rec := send(); rec.Code != http.StatusOK {
+		t.Fatalf("探测请求状态码 = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	if status := relay.GetCircuitBreakerStatus("claude"); status.State != circuitClosed {
+		t.Fatalf("探测成功后应关闭熔断: %+v", status)
+	}
+}
+
+func TestProviderCircuitBreaker(t *testing.T) {
+	setupTestEnv(t)
+
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	// 调高拉黑阈值，确认跳过 provider 的是熔断而不是黑名单
+	if err := relay.settingsService.UpdateBlacklistSettings(9, 30); err != nil {
+		t.Fatalf("更新拉黑设置失败: %v", err)
+	}
+	clock := newFakeClock(time.Now())
+	relay.providerBreaker = NewCircuitBreaker(clock)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "flaky", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	send := func() int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`)))
+		return rec.Code
+	}
+	expectState := func(want string) {
+		t.Helper()
+		states, err := relay.GetProviderCircuitStates("claude")
+		if err != nil || len(states) != 1 {
+			t.Fatalf("获取熔断状态失败: %v, %+v", err, states)
+		}
+		if states[0].State != want {
+			t.Fatalf("熔断状态 = %+v, 期望 %s", states[0], want)
+		}
+	}
+
+	for i := 0; i < providerCircuitFailureThreshold; i++ {
+		send()
+	}
+	expectState(circuitOpen)
+
+	// 熔断期间不请求上游
+	before := atomic.LoadInt32(&hits)
+	if code := send(); code == http.StatusOK {
+		t.Fatalf("熔断期间不应成功")
+	}
+	if atomic.LoadInt32(&hits) != before {
+		t.Fatalf("熔断期间不应请求上游")
+	}
+	if blacklisted, _ := relay.blacklistService.IsBlacklisted("claude", "flaky"); blacklisted {
+		t.Fatalf("短时熔断不应拉黑 provider")
+	}
+
+	// 冷却结束进入 half-open，再次失败立即重新熔断
+	clock.Advance(providerCircuitCooldown)
+	expectState(circuitHalfOpen)
+	send()
+	if atomic.LoadInt32(&hits) != before+1 {
+		t.Fatalf("half-open 时应放行请求")
+	}
+	expectState(circuitOpen)
+
+	// half-open 时请求成功则关闭熔断
+	clock.Advance(providerCircuitCooldown)
+	relay.providerBreaker.RecordSuccess("claude", "flaky")
+	expectState(circuitClosed)
+
+	// 窗口外的失败不累计
+	for i := 0; i < providerCircuitFailureThreshold-1; i++ {
+		relay.providerBreaker.RecordFailure("claude", "flaky")
+	}
+	clock.Advance(providerCircuitFailureWindow + time.Second)
+	relay.providerBreaker.RecordFailure("claude", "flaky")
+	expectState(circuitClosed)
+}
@@ -3,16 +3,21 @@ package services
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 )
 
 const (
 	claudeSettingsDir      = ".claude"
 	claudeSettingsFileName = "settings.json"
 	claudeBackupFileName   = "cc-studio.back.settings.json"
-	claudeAuthTokenValue   = "code-switch"
+	// claudeManagedEnvFileName 记录 EnableProxyWithEnv 写入的额外 env 变量名，再次启用时据此清理不再需要的变量
+	claudeManagedEnvFileName = "cc-studio.managed-env.json"
+	claudeAuthTokenValue     = "code-switch"
 )
 
 type ClaudeProxyStatus struct {
@@ -21,6 +26,7 @@ type ClaudeProxyStatus struct {
 }
 
 type ClaudeSettingsService struct {
+	addrMu    sync.RWMutex // 保护 relayAddr（SetRelayAddr 可能与前端调用并发）
 	relayAddr string
 }
 
@@ -45,14 +51,31 @@ func (css *ClaudeSettingsService) ProxyStatus() (ClaudeProxyStatus, error) {
 	if err := json.Unmarshal(data, &payload); err != nil {
 		return status, nil
 	}
-	baseURL := css.baseURL()
-	enabled := strings.EqualFold(payload.Env["ANTHROPIC_AUTH_TOKEN"], claudeAuthTokenValue) &&
-		strings.EqualFold(payload.Env["ANTHROPIC_BASE_URL"], baseURL)
+	// env 中可能有 EnableProxyWithEnv 写入的其他变量，只看 token 和 base URL
+	token, _ := payload.Env["ANTHROPIC_AUTH_TOKEN"].(string)
+	baseURL, _ := payload.Env["ANTHROPIC_BASE_URL"].(string)
+	enabled := strings.EqualFold(token, claudeAuthTokenValue) &&
+		strings.EqualFold(baseURL, css.baseURL())
 	status.Enabled = enabled
 	return status, nil
 }
 
 func (css *ClaudeSettingsService) EnableProxy() error {
+	return css.EnableProxyWithEnv(nil)
+}
+
+// EnableProxyWithEnv 启用代理，并把额外的环境变量（如 ANTHROPIC_MODEL、ANTHROPIC_CUSTOM_HEADERS）一并写入 settings.json 的 env
+// ANTHROPIC_AUTH_TOKEN 和 ANTHROPIC_BASE_URL 由代理管理，不能通过 extra 覆盖；
+// 已启用代理时再次调用不覆盖原备份，上次写入而本次 extra 中没有的变量会被移除
+func (css *ClaudeSettingsService) EnableProxyWithEnv(extra map[string]string) error {
+	env, err := claudeExtraEnv(extra)
+	if err != nil {
+		return err
+	}
+	status, err := css.ProxyStatus()
+	if err != nil {
+		return err
+	}
 	settingsPath, backupPath, err := css.paths()
 	if err != nil {
 		return err
@@ -60,26 +83,138 @@ func (css *ClaudeSettingsService) EnableProxy() error {
 	if err := os.MkdirAll(filepath.Dir(settingsPath), 0o755); err != nil {
 		return err
 	}
+	var existing []byte
 	if _, err := os.Stat(settingsPath); err == nil {
 		content, readErr := os.ReadFile(settingsPath)
 		if readErr != nil {
 			return readErr
 		}
-		if err := os.WriteFile(backupPath, content, 0o600); err != nil {
+		// 已指向代理时 settings.json 不再是用户原来的配置，保留首次启用时的备份
+		if !status.Enabled {
+			if err := os.WriteFile(backupPath, content, 0o600); err != nil {
+				return err
+			}
+		}
+		existing = content
+	}
+	var stale []string
+	if status.Enabled {
+		for _, key := range css.managedEnvKeys() {
+			if _, ok := env[key]; !ok {
+				stale = append(stale, key)
+			}
+		}
+	}
+	payload, err := css.renderSettings(existing, env, stale...)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(settingsPath, payload, 0o600); err != nil {
+		return err
+	}
+	return css.saveManagedEnvKeys(env)
+}
+
+// managedEnvKeys 读取上次 EnableProxyWithEnv 写入的额外 env 变量名，文件不存在或无法解析时返回空
+func (css *ClaudeSettingsService) managedEnvKeys() []string {
+	path, err := css.managedEnvPath()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil
+	}
+	return keys
+}
+
+// saveManagedEnvKeys 记录本次写入的额外 env 变量名，没有额外变量时删除记录
+func (css *ClaudeSettingsService) saveManagedEnvKeys(env map[string]string) error {
+	path, err := css.managedEnvPath()
+	if err != nil {
+		return err
+	}
+	if len(env) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
 			return err
 		}
+		return nil
 	}
-	settings := claudeSettingsFile{
-		Env: map[string]string{
-			"ANTHROPIC_AUTH_TOKEN": claudeAuthTokenValue,
-			"ANTHROPIC_BASE_URL":   css.baseURL(),
-		},
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
 	}
-	payload, err := json.MarshalIndent(settings, "", "  ")
+	sort.Strings(keys)
+	data, err := json.Marshal(keys)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(settingsPath, payload, 0o600)
+	return os.WriteFile(path, data, 0o600)
+}
+
+// claudeExtraEnv 校验额外的环境变量名，去掉首尾空白
+func claudeExtraEnv(extra map[string]string) (map[string]string, error) {
+	env := make(map[string]string, len(extra))
+	for key, value := range extra {
+		key = strings.TrimSpace(key)
+		if key == "" || !isValidEnvKey(key) {
+			return nil, fmt.Errorf("无效的环境变量名: %q", key)
+		}
+		if key == "ANTHROPIC_AUTH_TOKEN" || key == "ANTHROPIC_BASE_URL" {
+			return nil, fmt.Errorf("环境变量 %s 由代理管理，不能自定义", key)
+		}
+		env[key] = value
+	}
+	return env, nil
+}
+
+// PreviewConfig 返回 EnableProxy 将写入的文件内容，不修改磁盘
+// kind: "settings"（或空）为 ~/.claude/settings.json
+func (css *ClaudeSettingsService) PreviewConfig(kind string) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "", "settings":
+		settingsPath, _, err := css.paths()
+		if err != nil {
+			return nil, err
+		}
+		existing, err := os.ReadFile(settingsPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return css.renderSettings(existing, nil)
+	default:
+		return nil, fmt.Errorf("未知的 Claude 配置类型: %s", kind)
+	}
+}
+
+// renderSettings 在现有 settings.json 内容（可为空）基础上写入代理的 env 配置和额外的环境变量，
+// 并从 env 中移除 remove 列出的变量，其余配置保持不变
+func (css *ClaudeSettingsService) renderSettings(existing []byte, extra map[string]string, remove ...string) ([]byte, error) {
+	var raw map[string]any
+	if len(strings.TrimSpace(string(existing))) > 0 {
+		// 解析失败时不覆盖，避免丢失用户的 Claude Code 配置
+		if err := json.Unmarshal(existing, &raw); err != nil {
+			return nil, fmt.Errorf("解析 Claude 配置失败: %w", err)
+		}
+	}
+	env := map[string]any{
+		"ANTHROPIC_AUTH_TOKEN": claudeAuthTokenValue,
+		"ANTHROPIC_BASE_URL":   css.baseURL(),
+	}
+	for key, value := range extra {
+		env[key] = value
+	}
+	settings := deepMerge(raw, map[string]any{"env": env})
+	if merged, ok := settings["env"].(map[string]any); ok {
+		for _, key := range remove {
+			delete(merged, key)
+		}
+	}
+	return json.MarshalIndent(settings, "", "  ")
 }
 
 func (css *ClaudeSettingsService) DisableProxy() error {
@@ -90,6 +225,9 @@ func (css *ClaudeSettingsService) DisableProxy() error {
 	if err := os.Remove(settingsPath); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
+	if err := css.saveManagedEnvKeys(nil); err != nil {
+		return err
+	}
 	if _, err := os.Stat(backupPath); err == nil {
 		if err := os.Rename(backupPath, settingsPath); err != nil {
 			return err
@@ -109,8 +247,16 @@ func (css *ClaudeSettingsService) paths() (settingsPath string, backupPath strin
 	return filepath.Join(dir, claudeSettingsFileName), filepath.Join(dir, claudeBackupFileName), nil
 }
 
+func (css *ClaudeSettingsService) managedEnvPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, claudeSettingsDir, claudeManagedEnvFileName), nil
+}
+
 func (css *ClaudeSettingsService) baseURL() string {
-	addr := strings.TrimSpace(css.relayAddr)
+	addr := strings.TrimSpace(css.proxyAddr())
 	if addr == "" {
 		addr = ":18100"
 	}
@@ -128,5 +274,5 @@ func (css *ClaudeSettingsService) baseURL() string {
 }
 
 type claudeSettingsFile struct {
-	Env map[string]string `json:"env"`
+	Env map[string]any `json:"env"`
 }
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClaudeEnableProxyPreservesSettings(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	dir := filepath.Join(home, claudeSettingsDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	original := `{
+  "model": "opus",
+  "permissions": {"allow": ["Bash(go test:*)"], "deny": []},
+  "hooks": {"Stop": [{"hooks": [{"type": "command", "command": "notify"}]}]},
+  "env": {"FOO": "bar", "ANTHROPIC_BASE_URL": "https://api.example.com"}
+}`
+	settingsPath := filepath.Join(dir, claudeSettingsFileName)
+	if err := os.WriteFile(settingsPath, []byte(original), 0o600); err != nil {
+		t.Fatalf("写入 settings.json 失败: %v", err)
+	}
+
+	css := NewClaudeSettingsService(":18100")
+	if err := css.EnableProxy(); err != nil {
+		t.Fatalf("EnableProxy 失败: %v", err)
+	}
+	data, err := os.ReadFile(settingsPath)
+	if err != nil {
+		t.Fatalf("读取 settings.json 失败: %v", err)
+	}
+	var settings map[string]any
+	if err := json.Unmarshal(data, &settings); err != nil {
+		t.Fatalf("settings.json 不是有效 JSON: %v", err)
+	}
+	if settings["model"] != "opus" {
+		t.Fatalf("model 应保留: %s", data)
+	}
+	if permissions, ok := settings["permissions"].(map[string]any); !ok || len(permissions["allow"].([]any)) != 1 {
+		t.Fatalf("permissions 应保留: %s", data)
+	}
+	if _, ok := settings["hooks"].(map[string]any)["Stop"]; !ok {
+		t.Fatalf("hooks 应保留: %s", data)
+	}
+	env := settings["env"].(map[string]any)
+	if env["FOO"] != "bar" || env["ANTHROPIC_AUTH_TOKEN"] != claudeAuthTokenValue || env["ANTHROPIC_BASE_URL"] != "http://127.0.0.1:18100" {
+		t.Fatalf("env 合并结果不正确: %v", env)
+	}
+	if status, err := css.ProxyStatus(); err != nil || !status.Enabled {
+		t.Fatalf("代理应已启用: %+v, %v", status, err)
+	}
+
+	if backup, err := os.ReadFile(filepath.Join(dir, claudeBackupFileName)); err != nil || string(backup) != original {
+		t.Fatalf("备份应为原始内容: %s, %v", backup, err)
+	}
+	if err := css.DisableProxy(); err != nil {
+		t.Fatalf("DisableProxy 失败: %v", err)
+	}
+	if restored, _ := os.ReadFile(settingsPath); string(restored) != original {
+		t.Fatalf("关闭代理后应恢复原始配置: %s", restored)
+	}
+
+	// 无法解析的配置不覆盖
+	if err := os.WriteFile(settingsPath, []byte("{broken"), 0o600); err != nil {
+		t.Fatalf("写入 settings.json 失败: %v", err)
+	}
+	if err := css.EnableProxy(); err == nil {
+		t.Fatalf("无法解析的 settings.json 应返回错误")
+	}
+	if data, _ := os.ReadFile(settingsPath); string(data) != "{broken" {
+		t.Fatalf("解析失败时不应覆盖配置: %s", data)
+	}
+}
+
+func TestClaudeEnableProxyWithEnv(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	css := NewClaudeSettingsService(":18100")
+	for _, extra := range []map[string]string{
+		{"BAD-KEY": "x"},
+		{" ": "x"},
+		{"ANTHROPIC_BASE_URL": "https://api.example.com"},
+	} {
+		if err := css.EnableProxyWithEnv(extra); err == nil {
+			t.Fatalf("EnableProxyWithEnv(%v) 应返回错误", extra)
+		}
+	}
+	settingsPath := filepath.Join(home, claudeSettingsDir, claudeSettingsFileName)
+	if _, err := os.Stat(settingsPath); !os.IsNotExist(err) {
+		t.Fatalf("校验失败时不应写入 settings.json")
+	}
+
+	if err := css.EnableProxyWithEnv(map[string]string{
+		" ANTHROPIC_MODEL ":        "claude-sonnet-4",
+		"ANTHROPIC_CUSTOM_HEADERS": "X-Team: infra",
+	}); err != nil {
+		t.Fatalf("EnableProxyWithEnv 失败: %v", err)
+	}
+	data, _ := os.ReadFile(settingsPath)
+	var settings claudeSettingsFile
+	if err := json.Unmarshal(data, &settings); err != nil {
+		t.Fatalf("settings.json 不是有效 JSON: %v", err)
+	}
+	if settings.Env["ANTHROPIC_MODEL"] != "claude-sonnet-4" || settings.Env["ANTHROPIC_CUSTOM_HEADERS"] != "X-Team: infra" ||
+		settings.Env["ANTHROPIC_AUTH_TOKEN"] != claudeAuthTokenValue {
+		t.Fatalf("额外的 env 应写入 settings.json: %s", data)
+	}
+	if status, err := css.ProxyStatus(); err != nil || !status.Enabled {
+		t.Fatalf("带额外 env 时代理应显示已启用: %+v, %v", status, err)
+	}
+
+	// env 中有非字符串值时不影响状态判断
+	if err := os.WriteFile(settingsPath, []byte(`{"env":{"ANTHROPIC_AUTH_TOKEN":"code-switch","ANTHROPIC_BASE_URL":"http://127.0.0.1:18100","MAX_TOKENS":8192}}`), 0o600); err != nil {
+		t.Fatalf("写入 settings.json 失败: %v", err)
+	}
+	if status, err := css.ProxyStatus(); err != nil || !status.Enabled {
+		t.Fatalf("非字符串 env 不应影响代理状态: %+v, %v", status, err)
+	}
+}
+
+func TestClaudeEnableProxyWithEnvKeepsBackup(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	claudeDir := filepath.Join(home, claudeSettingsDir)
+	if err := os.MkdirAll(claudeDir, 0o755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	settingsPath := filepath.Join(claudeDir, claudeSettingsFileName)
+	original := `{"env":{"FOO":"bar"}}`
+	if err := os.WriteFile(settingsPath, []byte(original), 0o600); err != nil {
+		t.Fatalf("写入配置失败: %v", err)
+	}
+
+	css := NewClaudeSettingsService(":18100")
+	if err := css.EnableProxy(); err != nil {
+		t.Fatalf("启用代理失败: %v", err)
+	}
+	// 代理已启用时前端再调用 EnableProxyWithEnv，备份仍应是用户原来的配置
+	if err := css.EnableProxyWithEnv(map[string]string{
+		"ANTHROPIC_MODEL":          "claude-sonnet-4",
+		"ANTHROPIC_CUSTOM_HEADERS": "X-Team: infra",
+	}); err != nil {
+		t.Fatalf("EnableProxyWithEnv 失败: %v", err)
+	}
+	backup, err := os.ReadFile(filepath.Join(claudeDir, claudeBackupFileName))
+	if err != nil || string(backup) != original {
+		t.Fatalf("备份不应被代理配置覆盖: %s, %v", backup, err)
+	}
+
+	// 本次 extra 中去掉的变量应从 settings.json 移除
+	if err := css.EnableProxyWithEnv(map[string]string{"ANTHROPIC_MODEL": "claude-opus-4"}); err != nil {
+		t.Fatalf("EnableProxyWithEnv 失败: %v", err)
+	}
+	data, _ := os.ReadFile(settingsPath)
+	var settings claudeSettingsFile
+	if err := json.Unmarshal(data, &settings); err != nil {
+		t.Fatalf("settings.json 不是有效 JSON: %v", err)
+	}
+	if _, ok := settings.Env["ANTHROPIC_CUSTOM_HEADERS"]; ok {
+		t.Fatalf("不再需要的额外 env 应被移除: %s", data)
+	}
+	if settings.Env["ANTHROPIC_MODEL"] != "claude-opus-4" || settings.Env["FOO"] != "bar" {
+		t.Fatalf("其他 env 应保留: %s", data)
+	}
+
+	if err := css.DisableProxy(); err != nil {
+		t.Fatalf("关闭代理失败: %v", err)
+	}
+	restored, err := os.ReadFile(settingsPath)
+	if err != nil || string(restored) != original {
+		t.Fatalf("关闭代理后应恢复原配置: %s, %v", restored, err)
+	}
+	if _, err := os.Stat(filepath.Join(claudeDir, claudeManagedEnvFileName)); !os.IsNotExist(err) {
+		t.Fatalf("关闭代理后应删除额外 env 记录")
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPreviewConfigMatchesEnableProxy(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	// 已有配置需要被保留（codex config.toml、gemini .env）
+	codexDir := filepath.Join(home, codexSettingsDir)
+	geminiDir := filepath.Join(home, ".gemini")
+	for _, dir := range []string{codexDir, geminiDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("创建目录失败: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(codexDir, codexConfigFileName), []byte("approval_policy = \"never\"\n"), 0o600); err != nil {
+		t.Fatalf("写入 config.toml 失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(geminiDir, ".env"), []byte("GEMINI_MODEL=gemini-2.5-pro\nZ_KEY=z\nA_KEY=a\n"), 0o600); err != nil {
+		t.Fatalf("写入 .env 失败: %v", err)
+	}
+
+	claude := NewClaudeSettingsService(":18100")
+	codex := NewCodexSettingsService(":18100")
+	gemini := &GeminiService{relayAddr: ":18100"}
+
+	cases := []struct {
+		name    string
+		preview func() ([]byte, error)
+		enable  func() error
+		path    string
+	}{
+		{"claude", func() ([]byte, error) { return claude.PreviewConfig("") }, claude.EnableProxy, filepath.Join(home, claudeSettingsDir, claudeSettingsFileName)},
+		{"codex config", func() ([]byte, error) { return codex.PreviewConfig("config") }, codex.EnableProxy, filepath.Join(codexDir, codexConfigFileName)},
+		{"codex auth", func() ([]byte, error) { return codex.PreviewConfig("auth") }, nil, filepath.Join(codexDir, codexAuthFileName)},
+		{"gemini", func() ([]byte, error) { return gemini.PreviewConfig("env") }, gemini.EnableProxy, filepath.Join(geminiDir, ".env")},
+	}
+
+	previews := make(map[string][]byte, len(cases))
+	for _, tc := range cases {
+		preview, err := tc.preview()
+		if err != nil {
+			t.Fatalf("%s 预览失败: %v", tc.name, err)
+		}
+		previews[tc.name] = preview
+	}
+	if _, err := os.Stat(filepath.Join(home, claudeSettingsDir)); !os.IsNotExist(err) {
+		t.Fatalf("预览不应写入磁盘")
+	}
+	if data, _ := os.ReadFile(filepath.Join(codexDir, codexConfigFileName)); string(data) != "approval_policy = \"never\"\n" {
+		t.Fatalf("预览不应修改现有配置: %s", data)
+	}
+
+	for _, tc := range cases {
+		if tc.enable != nil {
+			if err := tc.enable(); err != nil {
+				t.Fatalf("%s EnableProxy 失败: %v", tc.name, err)
+			}
+		}
+	}
+	for _, tc := range cases {
+		written, err := os.ReadFile(tc.path)
+		if err != nil {
+			t.Fatalf("%s 读取写入结果失败: %v", tc.name, err)
+		}
+		if !bytes.Equal(previews[tc.name], written) {
+			t.Fatalf("%s 预览与实际写入不一致:\n预览:\n%s\n实际:\n%s", tc.name, previews[tc.name], written)
+		}
+	}
+
+	if !strings.Contains(string(previews["codex config"]), "approval_policy") {
+		t.Fatalf("codex 预览应保留已有配置: %s", previews["codex config"])
+	}
+	if _, err := claude.PreviewConfig("unknown"); err == nil {
+		t.Fatalf("未知配置类型应返回错误")
+	}
+}
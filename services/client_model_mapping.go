@@ -0,0 +1,109 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientIDHeader 客户端标识请求头，用于按客户端选择模型映射；未携带时使用 User-Agent 匹配
+const clientIDHeader = "X-Client-Id"
+
+// requestClient 发起请求的客户端
+type requestClient struct {
+	ID        string
+	UserAgent string
+}
+
+func clientFromRequest(c *gin.Context) requestClient {
+	return requestClient{
+		ID:        strings.TrimSpace(c.GetHeader(clientIDHeader)),
+		UserAgent: c.GetHeader("User-Agent"),
+	}
+}
+
+// clientModelMapping 返回与客户端匹配的模型映射
+// 优先按 X-Client-Id 精确匹配（不区分大小写），其次按 User-Agent 包含 key 匹配（取最长的 key）
+func (p *Provider) clientModelMapping(client requestClient) (string, map[string]string) {
+	if len(p.ClientModelMapping) == 0 {
+		return "", nil
+	}
+	if client.ID != "" {
+		for key, mapping := range p.ClientModelMapping {
+			if strings.EqualFold(key, client.ID) {
+				return key, mapping
+			}
+		}
+	}
+	userAgent := strings.ToLower(client.UserAgent)
+	if userAgent == "" {
+		return "", nil
+	}
+	matched := ""
+	for key := range p.ClientModelMapping {
+		if len(key) > len(matched) && strings.Contains(userAgent, strings.ToLower(key)) {
+			matched = key
+		}
+	}
+	if matched == "" {
+		return "", nil
+	}
+	return matched, p.ClientModelMapping[matched]
+}
+
+// GetEffectiveModelForClient 获取指定客户端实际应该使用的模型名
+// 客户端专属映射命中时使用专属映射，否则回退到默认的 ModelMapping
+func (p *Provider) GetEffectiveModelForClient(requestedModel string, client requestClient) string {
+	if _, mapping := p.clientModelMapping(client); mapping != nil {
+		if mapped, ok := lookupModelMapping(mapping, requestedModel, p.CaseSensitiveModels); ok {
+			return mapped
+		}
+	}
+	return p.GetEffectiveModel(requestedModel)
+}
+
+func cloneClientModelMapping(source map[string]map[string]string) map[string]map[string]string {
+	if source == nil {
+		return nil
+	}
+	cloned := make(map[string]map[string]string, len(source))
+	for client, mapping := range source {
+		entries := make(map[string]string, len(mapping))
+		for k, v := range mapping {
+			entries[k] = v
+		}
+		cloned[client] = entries
+	}
+	return cloned
+}
+
+// validateClientModelMapping 校验客户端专属映射，规则与 ModelMapping 一致：精确映射的目标模型需在 SupportedModels 中
+func validateClientModelMapping(p *Provider) []string {
+	errors := make([]string, 0)
+	clients := make([]string, 0, len(p.ClientModelMapping))
+	for client := range p.ClientModelMapping {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+	for _, client := range clients {
+		if strings.TrimSpace(client) == "" {
+			errors = append(errors, "客户端模型映射的客户端标识不能为空")
+			continue
+		}
+		if len(p.SupportedModels) == 0 {
+			continue
+		}
+		for external, internal := range p.ClientModelMapping[client] {
+			if strings.Contains(internal, "*") || p.supportsNativeModel(internal) {
+				continue
+			}
+			errors = append(errors, fmt.Sprintf(
+				"客户端 '%s' 的模型映射无效：'%s' -> '%s'，目标模型 '%s' 不在 supportedModels 中",
+				client, external, internal, internal,
+			))
+		}
+	}
+	return errors
+}
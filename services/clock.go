@@ -0,0 +1,24 @@
+package services
+
+import "time"
+
+// Clock 时间源，黑名单、定时检查更新、日志清理等基于时间的逻辑通过它取时间，便于测试中模拟时间流逝
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer 由 Clock.AfterFunc 返回的定时器
+type Timer interface {
+	Stop() bool
+}
+
+// realClock 系统时钟
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// systemClock 各服务默认使用的时钟
+var systemClock Clock = realClock{}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// codexRootKeys 代理管理的 config.toml 顶层键（按写入顺序）
+var codexRootKeys = []string{"preferred_auth_method", "model", "model_provider"}
+
+// mergeCodexConfig 按行改写 config.toml：只替换顶层的 preferred_auth_method / model / model_provider
+// 和 [model_providers.code-switch] 表，其余内容（注释、顺序、其他表）原样保留
+// 合并后重新解析校验，非托管内容有任何变化（如多行字符串、点号键等特殊写法）时返回 false，由调用方整体重新生成
+func mergeCodexConfig(existing []byte, before map[string]any, rootValues map[string]string, provider codexProvider) ([]byte, bool) {
+	rootLines := make(map[string]string, len(rootValues))
+	for key, value := range rootValues {
+		line, err := tomlKeyLine(key, value)
+		if err != nil {
+			return nil, false
+		}
+		rootLines[key] = line
+	}
+	tableLines, err := codexProviderTableLines(provider)
+	if err != nil {
+		return nil, false
+	}
+
+	lines := strings.Split(strings.TrimRight(string(existing), "\n"), "\n")
+	if len(strings.TrimSpace(string(existing))) == 0 {
+		lines = nil
+	}
+	out := make([]string, 0, len(lines)+len(rootLines)+len(tableLines)+2)
+	seen := make(map[string]bool, len(rootLines))
+	inRoot, skipping := true, false
+	rootEnd, providerAt := -1, -1
+	// 跳过 code-switch 表时暂存空行和注释：若紧接着是下一个表头，它们属于下一个表
+	var pending []string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if path, ok := tomlHeaderPath(line); ok {
+			if inRoot {
+				inRoot, rootEnd = false, len(out)
+			}
+			wasSkipping := skipping
+			skipping = len(path) >= 2 && path[0] == "model_providers" && path[1] == codexProviderKey
+			if skipping {
+				if providerAt < 0 {
+					providerAt = len(out)
+				}
+				pending = nil
+				continue
+			}
+			if wasSkipping {
+				out = append(out, pending...)
+				pending = nil
+			}
+		} else if skipping {
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				pending = append(pending, line)
+			} else {
+				pending = nil
+			}
+			continue
+		}
+		if inRoot {
+			if key, ok := tomlLineKey(line); ok {
+				if rendered, managed := rootLines[key]; managed {
+					if !seen[key] {
+						out = append(out, rendered)
+						seen[key] = true
+					}
+					continue
+				}
+			}
+		}
+		out = append(out, line)
+	}
+	if inRoot {
+		rootEnd = len(out)
+	}
+
+	if providerAt >= 0 {
+		block := append([]string{}, tableLines...)
+		if providerAt < len(out) && strings.TrimSpace(out[providerAt]) != "" {
+			block = append(block, "")
+		}
+		out = insertLines(out, providerAt, block)
+	} else {
+		for len(out) > 0 && strings.TrimSpace(out[len(out)-1]) == "" {
+			out = out[:len(out)-1]
+		}
+		if len(out) > 0 {
+			out = append(out, "")
+		}
+		out = append(out, tableLines...)
+	}
+
+	missing := make([]string, 0, len(codexRootKeys))
+	for _, key := range codexRootKeys {
+		if rendered, ok := rootLines[key]; ok && !seen[key] {
+			missing = append(missing, rendered)
+		}
+	}
+	if len(missing) > 0 {
+		pos := rootEnd
+		for pos > 0 && strings.TrimSpace(out[pos-1]) == "" {
+			pos--
+		}
+		if pos == 0 && rootEnd < len(out) {
+			missing = append(missing, "")
+		}
+		out = insertLines(out, pos, missing)
+	}
+
+	merged := []byte(strings.Join(out, "\n") + "\n")
+	if !verifyCodexMerge(before, merged, rootValues, provider) {
+		return nil, false
+	}
+	return merged, true
+}
+
+// verifyCodexMerge 校验合并结果：托管的值已写入，其余内容与原配置一致
+func verifyCodexMerge(before map[string]any, merged []byte, rootValues map[string]string, provider codexProvider) bool {
+	var after map[string]any
+	if err := toml.Unmarshal(merged, &after); err != nil {
+		return false
+	}
+	for key, value := range rootValues {
+		if got, _ := after[key].(string); got != value {
+			return false
+		}
+	}
+	var cfg codexConfig
+	if err := toml.Unmarshal(merged, &cfg); err != nil || cfg.ModelProviders[codexProviderKey] != provider {
+		return false
+	}
+	return reflect.DeepEqual(withoutCodexManaged(before), withoutCodexManaged(after))
+}
+
+// withoutCodexManaged 去掉代理管理的键，用于比较合并前后的其余内容
+func withoutCodexManaged(raw map[string]any) map[string]any {
+	result := make(map[string]any, len(raw))
+	for key, value := range raw {
+		result[key] = value
+	}
+	for _, key := range codexRootKeys {
+		delete(result, key)
+	}
+	if providers, ok := result["model_providers"].(map[string]any); ok {
+		rest := make(map[string]any, len(providers))
+		for key, value := range providers {
+			if key != codexProviderKey {
+				rest[key] = value
+			}
+		}
+		if len(rest) == 0 {
+			delete(result, "model_providers")
+		} else {
+			result["model_providers"] = rest
+		}
+	}
+	return result
+}
+
+// codexProviderTableLines 渲染 [model_providers.code-switch] 表（不含 [model_providers] 父表头）
+func codexProviderTableLines(provider codexProvider) ([]string, error) {
+	data, err := toml.Marshal(struct {
+		ModelProviders map[string]codexProvider `toml:"model_providers"`
+	}{map[string]codexProvider{codexProviderKey: provider}})
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSpace(string(stripModelProvidersHeader(data))), "\n"), nil
+}
+
+// tomlKeyLine 渲染一行 key = "value"，由 go-toml 负责字符串转义
+func tomlKeyLine(key, value string) (string, error) {
+	data, err := toml.Marshal(map[string]string{key: value})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// tomlHeaderPath 解析 [a.b] / [[a.b]] 表头，返回各段键名（去掉引号）
+func tomlHeaderPath(line string) ([]string, bool) {
+	s := strings.TrimSpace(line)
+	if !strings.HasPrefix(s, "[") {
+		return nil, false
+	}
+	s = strings.TrimLeft(s, "[")
+	var path []string
+	var segment strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, false
+			}
+			segment.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case '.':
+			path = append(path, strings.TrimSpace(segment.String()))
+			segment.Reset()
+		case ']':
+			return append(path, strings.TrimSpace(segment.String())), true
+		default:
+			segment.WriteByte(c)
+		}
+	}
+	return nil, false
+}
+
+// tomlLineKey 返回 key = value 行的键名；注释、空行和点号键返回 false
+func tomlLineKey(line string) (string, bool) {
+	s := strings.TrimSpace(line)
+	if s == "" || strings.HasPrefix(s, "#") {
+		return "", false
+	}
+	idx := strings.Index(s, "=")
+	if idx <= 0 {
+		return "", false
+	}
+	key := strings.TrimSpace(s[:idx])
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') && key[len(key)-1] == key[0] {
+		return key[1 : len(key)-1], true
+	}
+	if strings.ContainsAny(key, ".\"' ") {
+		return "", false
+	}
+	return key, true
+}
+
+func insertLines(lines []string, at int, block []string) []string {
+	result := make([]string, 0, len(lines)+len(block))
+	result = append(result, lines[:at]...)
+	result = append(result, block...)
+	return append(result, lines[at:]...)
+}
@@ -3,9 +3,11 @@ package services
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/pelletier/go-toml/v2"
 )
@@ -25,13 +27,20 @@ const (
 )
 
 type CodexSettingsService struct {
-	relayAddr string
+	addrMu      sync.RWMutex // 保护 relayAddr（SetRelayAddr 可能与前端调用并发）
+	relayAddr   string
+	appSettings *AppSettingsService
 }
 
 func NewCodexSettingsService(relayAddr string) *CodexSettingsService {
 	return &CodexSettingsService{relayAddr: relayAddr}
 }
 
+// BindAppSettings 关联应用设置，EnableProxy 据此写入 model 和 wire_api（未关联时使用默认值）
+func (css *CodexSettingsService) BindAppSettings(appSettings *AppSettingsService) {
+	css.appSettings = appSettings
+}
+
 func (css *CodexSettingsService) ProxyStatus() (ClaudeProxyStatus, error) {
 	status := ClaudeProxyStatus{Enabled: false, BaseURL: css.baseURL()}
 	config, err := css.readConfig()
@@ -60,7 +69,7 @@ func (css *CodexSettingsService) EnableProxy() error {
 	if err := os.MkdirAll(filepath.Dir(settingsPath), 0o755); err != nil {
 		return err
 	}
-	var raw map[string]any
+	var existing []byte
 	if _, err := os.Stat(settingsPath); err == nil {
 		content, readErr := os.ReadFile(settingsPath)
 		if readErr != nil {
@@ -69,37 +78,108 @@ func (css *CodexSettingsService) EnableProxy() error {
 		if err := os.WriteFile(backupPath, content, 0o600); err != nil {
 			return err
 		}
-		if err := toml.Unmarshal(content, &raw); err != nil {
-			return err
+		existing = content
+	}
+	cleaned, err := css.renderConfig(existing)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(settingsPath, cleaned, 0o600); err != nil {
+		return err
+	}
+	return css.writeAuthFile()
+}
+
+// PreviewConfig 返回 EnableProxy 将写入的文件内容，不修改磁盘
+// kind: "config"（或空）为 ~/.codex/config.toml，"auth" 为 ~/.codex/auth.json
+func (css *CodexSettingsService) PreviewConfig(kind string) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "", "config":
+		settingsPath, _, err := css.paths()
+		if err != nil {
+			return nil, err
+		}
+		existing, err := os.ReadFile(settingsPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return css.renderConfig(existing)
+	case "auth":
+		return renderCodexAuth()
+	default:
+		return nil, fmt.Errorf("未知的 Codex 配置类型: %s", kind)
+	}
+}
+
+// renderConfig 在现有 config.toml 内容（可为空）基础上写入代理配置
+// 优先按行合并，保留注释、顺序和无关的表；无法安全合并时整体重新序列化
+func (css *CodexSettingsService) renderConfig(existing []byte) ([]byte, error) {
+	var raw map[string]any
+	if len(existing) > 0 {
+		if err := toml.Unmarshal(existing, &raw); err != nil {
+			return nil, err
 		}
-	} else {
-		raw = make(map[string]any)
 	}
 	if raw == nil {
 		raw = make(map[string]any)
 	}
-	raw["preferred_auth_method"] = codexPreferredAuth
-	raw["model"] = codexDefaultModel
-	raw["model_provider"] = codexProviderKey
+	model, wireAPI, err := css.modelOptions()
+	if err != nil {
+		return nil, err
+	}
+	rootValues := map[string]string{
+		"preferred_auth_method": codexPreferredAuth,
+		"model":                 model,
+		"model_provider":        codexProviderKey,
+	}
+	provider := codexProvider{
+		Name:               codexProviderKey,
+		BaseURL:            css.baseURL(),
+		EnvKey:             codexEnvKey,
+		WireAPI:            wireAPI,
+		RequiresOpenAIAuth: false,
+	}
+	if merged, ok := mergeCodexConfig(existing, raw, rootValues, provider); ok {
+		return merged, nil
+	}
+	fmt.Printf("[WARN] config.toml 无法按行合并，将重新生成（注释和原有顺序不会保留）\n")
 
+	for key, value := range rootValues {
+		raw[key] = value
+	}
 	modelProviders := ensureTomlTable(raw, "model_providers")
-	provider := ensureProviderTable(modelProviders, codexProviderKey)
-	provider["name"] = codexProviderKey
-	provider["base_url"] = css.baseURL()
-	provider["env_key"] = codexEnvKey
-	provider["wire_api"] = codexWireAPI
-	provider["requires_openai_auth"] = false
-	modelProviders[codexProviderKey] = provider
+	table := ensureProviderTable(modelProviders, codexProviderKey)
+	table["name"] = provider.Name
+	table["base_url"] = provider.BaseURL
+	table["env_key"] = provider.EnvKey
+	table["wire_api"] = provider.WireAPI
+	table["requires_openai_auth"] = provider.RequiresOpenAIAuth
+	modelProviders[codexProviderKey] = table
 
 	data, err := toml.Marshal(raw)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	cleaned := stripModelProvidersHeader(data)
-	if err := os.WriteFile(settingsPath, cleaned, 0o600); err != nil {
-		return err
+	return stripModelProvidersHeader(data), nil
+}
+
+// modelOptions 返回应用设置中的 Codex model 和 wire_api，未配置时为 gpt-5-codex / responses
+func (css *CodexSettingsService) modelOptions() (string, string, error) {
+	model, wireAPI := codexDefaultModel, codexWireAPI
+	if css.appSettings == nil {
+		return model, wireAPI, nil
 	}
-	return css.writeAuthFile()
+	settings, err := css.appSettings.GetAppSettings()
+	if err != nil {
+		return "", "", fmt.Errorf("读取应用设置失败: %w", err)
+	}
+	if value := strings.TrimSpace(settings.CodexModel); value != "" {
+		model = value
+	}
+	if value := strings.TrimSpace(settings.CodexWireAPI); value != "" {
+		wireAPI = value
+	}
+	return model, wireAPI, nil
 }
 
 func (css *CodexSettingsService) DisableProxy() error {
@@ -156,7 +236,7 @@ func (css *CodexSettingsService) authPaths() (string, string, error) {
 }
 
 func (css *CodexSettingsService) baseURL() string {
-	addr := strings.TrimSpace(css.relayAddr)
+	addr := strings.TrimSpace(css.proxyAddr())
 	if addr == "" {
 		addr = ":18100"
 	}
@@ -248,16 +328,20 @@ func (css *CodexSettingsService) writeAuthFile() error {
 			return err
 		}
 	}
-	payload := map[string]string{
-		codexEnvKey: codexTokenValue,
-	}
-	data, err := json.MarshalIndent(payload, "", "  ")
+	data, err := renderCodexAuth()
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(authPath, data, 0o600)
 }
 
+func renderCodexAuth() ([]byte, error) {
+	payload := map[string]string{
+		codexEnvKey: codexTokenValue,
+	}
+	return json.MarshalIndent(payload, "", "  ")
+}
+
 func (css *CodexSettingsService) restoreAuthFile() error {
 	authPath, backupPath, err := css.authPaths()
 	if err != nil {
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+func TestCodexEnableProxyModelOptions(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	css := NewCodexSettingsService(":18100")
+	app := NewAppSettingsService(nil)
+	css.BindAppSettings(app)
+	configPath := filepath.Join(home, codexSettingsDir, codexConfigFileName)
+	readConfig := func() codexConfig {
+		t.Helper()
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatalf("读取 config.toml 失败: %v", err)
+		}
+		var cfg codexConfig
+		if err := toml.Unmarshal(data, &cfg); err != nil {
+			t.Fatalf("config.toml 无效: %v", err)
+		}
+		return cfg
+	}
+
+	// 未配置时保持默认值
+	if err := css.EnableProxy(); err != nil {
+		t.Fatalf("EnableProxy 失败: %v", err)
+	}
+	if cfg := readConfig(); cfg.Model != codexDefaultModel || cfg.ModelProviders[codexProviderKey].WireAPI != codexWireAPI {
+		t.Fatalf("未配置时应使用默认值: %+v", cfg)
+	}
+
+	settings, err := app.GetAppSettings()
+	if err != nil {
+		t.Fatalf("读取应用设置失败: %v", err)
+	}
+	settings.CodexWireAPI = "completions"
+	if _, err := app.SaveAppSettings(settings); err == nil || !strings.Contains(err.Error(), "wire_api") {
+		t.Fatalf("应拒绝不支持的 wire_api, err = %v", err)
+	}
+	settings.CodexModel = " gpt-4.1 "
+	settings.CodexWireAPI = "Chat"
+	if _, err := app.SaveAppSettings(settings); err != nil {
+		t.Fatalf("保存应用设置失败: %v", err)
+	}
+	if err := css.EnableProxy(); err != nil {
+		t.Fatalf("EnableProxy 失败: %v", err)
+	}
+	if cfg := readConfig(); cfg.Model != "gpt-4.1" || cfg.ModelProviders[codexProviderKey].WireAPI != "chat" {
+		t.Fatalf("应写入配置的 model 和 wire_api: %+v", cfg)
+	}
+	if status, err := css.ProxyStatus(); err != nil || !status.Enabled {
+		t.Fatalf("修改 model 后代理应显示已启用: %+v, %v", status, err)
+	}
+}
+
+func TestCodexEnableProxyPreservesConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	dir := filepath.Join(home, codexSettingsDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	original := `# 团队共享的 Codex 配置
+model = "o3"
+approval_policy = "never" # 不再询问
+
+[tui]
+theme = "dark"
+
+[history]
+persistence = "save-all"
+max_bytes = 1048576
+
+[model_providers.azure]
+name = "Azure"
+base_url = "https://example.openai.azure.com"
+
+[model_providers.azure.query_params]
+api-version = "2025-04-01"
+
+[model_providers."code-switch"]
+base_url = "http://127.0.0.1:9999"
+wire_api = "chat"
+
+[model_providers.code-switch.query_params]
+stale = "1"
+
+# MCP servers
+[mcp_servers.docs]
+command = "npx"
+args = ["-y", "docs"]
+`
+	configPath := filepath.Join(dir, codexConfigFileName)
+	if err := os.WriteFile(configPath, []byte(original), 0o600); err != nil {
+		t.Fatalf("写入 config.toml 失败: %v", err)
+	}
+
+	css := NewCodexSettingsService(":18100")
+	if err := css.EnableProxy(); err != nil {
+		t.Fatalf("EnableProxy 失败: %v", err)
+	}
+	data, _ := os.ReadFile(configPath)
+	enabled := string(data)
+	for _, want := range []string{
+		"# 团队共享的 Codex 配置\nmodel = 'gpt-5-codex'\napproval_policy = \"never\" # 不再询问\n",
+		"[tui]\ntheme = \"dark\"\n\n[history]\npersistence = \"save-all\"\nmax_bytes = 1048576\n",
+		"[model_providers.azure.query_params]\napi-version = \"2025-04-01\"\n",
+		"\n# MCP servers\n[mcp_servers.docs]\ncommand = \"npx\"\nargs = [\"-y\", \"docs\"]\n",
+	} {
+		if !strings.Contains(enabled, want) {
+			t.Fatalf("无关配置应原样保留 %q:\n%s", want, enabled)
+		}
+	}
+	if strings.Contains(enabled, "9999") || strings.Contains(enabled, "stale") || strings.Contains(enabled, "[model_providers]\n") {
+		t.Fatalf("code-switch 表应整体替换，且不应出现多余的表头:\n%s", enabled)
+	}
+	if strings.Index(enabled, "[model_providers.code-switch]") > strings.Index(enabled, "# MCP servers") {
+		t.Fatalf("code-switch 表应留在原位置:\n%s", enabled)
+	}
+	var cfg codexConfig
+	if err := toml.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("config.toml 无效: %v", err)
+	}
+	if cfg.PreferredAuthMethod != codexPreferredAuth || cfg.ModelProvider != codexProviderKey ||
+		cfg.ModelProviders[codexProviderKey].WireAPI != codexWireAPI || cfg.ModelProviders["azure"].Name != "Azure" {
+		t.Fatalf("托管配置不正确: %+v", cfg)
+	}
+
+	// 重复启用结果不变
+	again, err := css.renderConfig(data)
+	if err != nil || string(again) != enabled {
+		t.Fatalf("重复合并应保持不变: %v\n%s", err, again)
+	}
+
+	if err := css.DisableProxy(); err != nil {
+		t.Fatalf("DisableProxy 失败: %v", err)
+	}
+	if restored, _ := os.ReadFile(configPath); string(restored) != original {
+		t.Fatalf("关闭代理后应恢复原始配置:\n%s", restored)
+	}
+}
+
+func TestCodexRenderConfigFallback(t *testing.T) {
+	css := NewCodexSettingsService(":18100")
+	// 多行字符串中的 [tui] 不是表头，按行合并无法安全处理时回退为整体重新生成
+	existing := "instructions = \"\"\"\n[tui]\nmodel = \"x\"\n\"\"\"\n\n[tui]\ntheme = \"dark\"\n"
+	data, err := css.renderConfig([]byte(existing))
+	if err != nil {
+		t.Fatalf("renderConfig 失败: %v", err)
+	}
+	var raw map[string]any
+	if err := toml.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("生成的 config.toml 无效: %v\n%s", err, data)
+	}
+	if raw["instructions"] != "[tui]\nmodel = \"x\"\n" || raw["model"] != codexDefaultModel || raw["tui"].(map[string]any)["theme"] != "dark" {
+		t.Fatalf("回退后内容不正确: %s", data)
+	}
+}
@@ -24,6 +24,7 @@ type ConsoleService struct {
 	writer    *consoleWriter
 	oldStdout *os.File
 	oldStderr *os.File
+	clock     Clock
 }
 
 // consoleWriter 自定义 writer，同时写入控制台和缓存
@@ -45,6 +46,7 @@ func (w *consoleWriter) Write(p []byte) (n int, err error) {
 
 func NewConsoleService() *ConsoleService {
 	cs := &ConsoleService{
+		clock:   systemClock,
 		logs:    make([]ConsoleLog, 0, 1000),
 		maxLogs: 1000, // 最多保留 1000 条日志
 	}
@@ -103,7 +105,7 @@ func (cs *ConsoleService) addLog(level, message string) {
 	defer cs.mutex.Unlock()
 
 	log := ConsoleLog{
-		Timestamp: time.Now(),
+		Timestamp: cs.clock.Now(),
 		Level:     level,
 		Message:   message,
 	}
@@ -122,7 +124,7 @@ func (cs *ConsoleService) addLog(level, message string) {
 // cleanOldLogs 清理3天前的日志
 func (cs *ConsoleService) cleanOldLogs() {
 	// 无需加锁，因为调用者 addLog 已经加锁
-	threeDaysAgo := time.Now().Add(-72 * time.Hour)
+	threeDaysAgo := cs.clock.Now().Add(-72 * time.Hour)
 
 	// 找到第一个在3天内的日志索引
 	cutoffIndex := 0
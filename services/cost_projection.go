@@ -0,0 +1,187 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// costRecentWindow 计算近期日均费用的窗口，月初时会使用上个月末的数据
+const costRecentWindow = 7 * 24 * time.Hour
+
+// CostProjectionItem 某个平台 + 模型的本月费用预测
+type CostProjectionItem struct {
+	Platform       string  `json:"platform"`
+	Model          string  `json:"model"`
+	Requests       int64   `json:"requests"`
+	SpentToDate    float64 `json:"spent_to_date"`
+	DailyAverage   float64 `json:"daily_average"`
+	ProjectedTotal float64 `json:"projected_total"`
+}
+
+// CostProjection 本月费用预测：已花费 + 近期日均费用 × 本月剩余天数
+type CostProjection struct {
+	Month          string               `json:"month"`           // 2006-01
+	DaysInMonth    int                  `json:"days_in_month"`   // 本月天数
+	DaysElapsed    float64              `json:"days_elapsed"`    // 本月已过去的天数（含小数）
+	DaysRemaining  float64              `json:"days_remaining"`  // 本月剩余天数（含小数）
+	SampleDays     float64              `json:"sample_days"`     // 计算日均费用实际参考的天数，最多 7 天
+	SpentToDate    float64              `json:"spent_to_date"`   // 本月已花费
+	DailyAverage   float64              `json:"daily_average"`   // 近期日均费用
+	ProjectedTotal float64              `json:"projected_total"` // 预计本月总费用
+	Confidence     string               `json:"confidence"`      // none / low / medium / high，数据越少越不可靠
+	Breakdown      []CostProjectionItem `json:"breakdown"`       // 按预计费用降序
+}
+
+// ProjectMonthlyCost 根据请求日志和模型价格预测本月费用
+func (ls *LogService) ProjectMonthlyCost() (*CostProjection, error) {
+	return ls.projectMonthlyCost(time.Now())
+}
+
+type costBucket struct {
+	item       CostProjectionItem
+	recentCost float64
+}
+
+func (ls *LogService) projectMonthlyCost(now time.Time) (*CostProjection, error) {
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	monthEnd := monthStart.AddDate(0, 1, 0)
+	recentStart := now.Add(-costRecentWindow)
+	queryStart := monthStart
+	if recentStart.Before(queryStart) {
+		queryStart = recentStart
+	}
+
+	projection := &CostProjection{
+		Month:         monthStart.Format("2006-01"),
+		DaysInMonth:   int(monthEnd.Sub(monthStart).Hours()/24 + 0.5),
+		DaysElapsed:   roundDays(now.Sub(monthStart)),
+		DaysRemaining: roundDays(monthEnd.Sub(now)),
+		Confidence:    "none",
+		Breakdown:     make([]CostProjectionItem, 0),
+	}
+
+	records, err := xdb.New("request_log").Selects(
+		// created_at 的时区与写入方式有关，这里放宽一天预筛选，再按解析后的时间精确过滤
+		xdb.WhereGte("created_at", queryStart.Add(-24*time.Hour).Format(timeLayout)),
+		xdb.Field(
+			"id",
+			"platform",
+			"model",
+			"input_tokens",
+			"output_tokens",
+			"cache_create_tokens",
+			"cache_read_tokens",
+			"ephemeral_5m_tokens",
+			"ephemeral_1h_tokens",
+			"created_at",
+		),
+	)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+			return projection, nil
+		}
+		return nil, err
+	}
+	tiered, err := loadTieredPricing(queryStart)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make(map[string]*costBucket)
+	var earliest time.Time
+	for _, record := range records {
+		createdAt, hasTime := parseCreatedAt(record)
+		if !hasTime || createdAt.Before(queryStart) || createdAt.After(now) {
+			continue
+		}
+		inMonth := !createdAt.Before(monthStart)
+		inRecent := !createdAt.Before(recentStart)
+		if !inMonth && !inRecent {
+			continue
+		}
+		if earliest.IsZero() || createdAt.Before(earliest) {
+			earliest = createdAt
+		}
+
+		platform := strings.TrimSpace(record.GetString("platform"))
+		model := strings.TrimSpace(record.GetString("model"))
+		if model == "" {
+			model = unknownModelBucket
+		}
+		cost := ls.calculateCost(model, modelpricing.UsageSnapshot{
+			InputTokens:       record.GetInt("input_tokens"),
+			OutputTokens:      record.GetInt("output_tokens"),
+			CacheCreateTokens: record.GetInt("cache_create_tokens"),
+			CacheReadTokens:   record.GetInt("cache_read_tokens"),
+			CacheCreation:     recordCacheCreation(record),
+		}).TotalCost * tiered.multiplier(record.GetInt64("id"))
+
+		key := platform + "\x00" + model
+		bucket := buckets[key]
+		if bucket == nil {
+			bucket = &costBucket{item: CostProjectionItem{Platform: platform, Model: model}}
+			buckets[key] = bucket
+		}
+		if inMonth {
+			bucket.item.Requests++
+			bucket.item.SpentToDate += cost
+		}
+		if inRecent {
+			bucket.recentCost += cost
+		}
+	}
+	if earliest.IsZero() {
+		return projection, nil
+	}
+
+	// 近期日均：窗口内实际有数据的天数（至少 1 天），避免刚开始使用时用 7 天平摊导致低估
+	sample := now.Sub(earliest)
+	if sample > costRecentWindow {
+		sample = costRecentWindow
+	}
+	if sample < 24*time.Hour {
+		sample = 24 * time.Hour
+	}
+	sampleDays := sample.Hours() / 24
+	remainingDays := monthEnd.Sub(now).Hours() / 24
+
+	projection.SampleDays = roundDays(sample)
+	for _, bucket := range buckets {
+		item := bucket.item
+		item.DailyAverage = bucket.recentCost / sampleDays
+		item.ProjectedTotal = item.SpentToDate + item.DailyAverage*remainingDays
+		projection.SpentToDate += item.SpentToDate
+		projection.DailyAverage += item.DailyAverage
+		projection.ProjectedTotal += item.ProjectedTotal
+		projection.Breakdown = append(projection.Breakdown, item)
+	}
+	sort.Slice(projection.Breakdown, func(i, j int) bool {
+		a, b := projection.Breakdown[i], projection.Breakdown[j]
+		if a.ProjectedTotal == b.ProjectedTotal {
+			return a.Platform+a.Model < b.Platform+b.Model
+		}
+		return a.ProjectedTotal > b.ProjectedTotal
+	})
+
+	switch {
+	case sampleDays >= 7:
+		projection.Confidence = "high"
+	case sampleDays >= 3:
+		projection.Confidence = "medium"
+	default:
+		projection.Confidence = "low"
+	}
+	return projection, nil
+}
+
+// roundDays 将时长转换为天数，保留两位小数
+func roundDays(d time.Duration) float64 {
+	return math.Round(d.Hours()/24*100) / 100
+}
@@ -2,10 +2,28 @@ package services
 
 import (
 	"database/sql"
+	"sync"
+	"sync/atomic"
 
 	"github.com/daodao97/xgo/xdb"
 )
 
+// bulkWrites 进行中的大批量写入数（清空日志、数据库快照等），期间跳过黑名单自动恢复以免争用写锁
+var bulkWrites atomic.Int32
+
+// beginBulkWrite 标记大批量写入开始，返回的函数用于标记结束（可重复调用）
+func beginBulkWrite() func() {
+	bulkWrites.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() { bulkWrites.Add(-1) })
+	}
+}
+
+func bulkWriteInProgress() bool {
+	return bulkWrites.Load() > 0
+}
+
 // ensureBlacklistTables 初始化黑名单相关的数据库表
 func ensureBlacklistTables() error {
 	db, err := xdb.DB("default")
@@ -35,6 +53,16 @@ func ensureBlacklistTablesWithDB(db *sql.DB) error {
 		last_degrade_hour INTEGER DEFAULT 0,
 		last_failure_window_start DATETIME,
 
+		-- 观察期字段：恢复后需连续成功达到阈值才退出观察期
+		in_probation INTEGER DEFAULT 0,
+		success_streak INTEGER DEFAULT 0,
+
+		-- 本次拉黑的时长（秒），用于在系统时钟跳变时校正 blacklisted_until
+		blacklist_duration_sec INTEGER DEFAULT 0,
+
+		-- 上游 429 限流的冷却截止时间，与等级拉黑相互独立
+		rate_limited_until DATETIME,
+
 		UNIQUE(platform, provider_name)
 	)`
 
@@ -48,6 +76,10 @@ func ensureBlacklistTablesWithDB(db *sql.DB) error {
 		"ALTER TABLE provider_blacklist ADD COLUMN last_recovered_at DATETIME",
 		"ALTER TABLE provider_blacklist ADD COLUMN last_degrade_hour INTEGER DEFAULT 0",
 		"ALTER TABLE provider_blacklist ADD COLUMN last_failure_window_start DATETIME",
+		"ALTER TABLE provider_blacklist ADD COLUMN in_probation INTEGER DEFAULT 0",
+		"ALTER TABLE provider_blacklist ADD COLUMN success_streak INTEGER DEFAULT 0",
+		"ALTER TABLE provider_blacklist ADD COLUMN blacklist_duration_sec INTEGER DEFAULT 0",
+		"ALTER TABLE provider_blacklist ADD COLUMN rate_limited_until DATETIME",
 	}
 
 	for _, stmt := range alterTableStatements {
@@ -65,6 +97,19 @@ func ensureBlacklistTablesWithDB(db *sql.DB) error {
 		return err
 	}
 
+	// 创建 provider_debug 表：记录开启了请求/响应抓取的 provider，重启后保留
+	const createProviderDebugTableSQL = `CREATE TABLE IF NOT EXISTS provider_debug (
+		platform TEXT NOT NULL,
+		provider_name TEXT NOT NULL,
+		debug_enabled INTEGER DEFAULT 0,
+		updated_at DATETIME,
+		UNIQUE(platform, provider_name)
+	)`
+
+	if _, err := db.Exec(createProviderDebugTableSQL); err != nil {
+		return err
+	}
+
 	// 插入默认配置（如果不存在）
 	const insertDefaultSettings = `
 		INSERT OR IGNORE INTO app_settings (key, value) VALUES
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+const (
+	databaseFileName  = "app.db"
+	databaseDSNParams = "?cache=shared&mode=rwc&_busy_timeout=10000&_journal_mode=WAL"
+
+	// SQLite 主错误码：数据库损坏 / 不是数据库文件
+	sqliteCorrupt = 11
+	sqliteNotADB  = 26
+
+	// maxIntegrityMessages integrity_check 最多保留的问题条数
+	maxIntegrityMessages = 5
+)
+
+// DatabaseRepair 数据库损坏后的重建记录
+type DatabaseRepair struct {
+	Path       string    `json:"path"`
+	BackupPath string    `json:"backupPath"` // 损坏文件的备份位置
+	Reason     string    `json:"reason"`     // integrity_check 报告的问题或打开失败的原因
+	RepairedAt time.Time `json:"repairedAt"`
+}
+
+// Warning 面向用户的说明：重建后拉黑状态、请求统计等历史数据丢失
+func (r *DatabaseRepair) Warning() string {
+	return fmt.Sprintf("数据库已损坏并重建，拉黑状态和请求统计历史已丢失，损坏的文件已备份到 %s（%s）", r.BackupPath, r.Reason)
+}
+
+var (
+	databaseMu         sync.Mutex
+	lastDatabaseRepair *DatabaseRepair
+)
+
+// LastDatabaseRepair 返回本次运行期间最近一次数据库重建记录，未发生过重建时为 nil
+func LastDatabaseRepair() *DatabaseRepair {
+	databaseMu.Lock()
+	defer databaseMu.Unlock()
+	return lastDatabaseRepair
+}
+
+func databasePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户目录失败: %w", err)
+	}
+	return filepath.Join(home, ".code-switch", databaseFileName), nil
+}
+
+// initDatabase 检查数据库完整性（损坏时备份并重建），然后初始化连接和表结构
+func initDatabase(path string) (*DatabaseRepair, error) {
+	databaseMu.Lock()
+	defer databaseMu.Unlock()
+
+	repair, err := recoverCorruptDatabase(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := openDatabase(path); err != nil {
+		return repair, err
+	}
+	return repair, nil
+}
+
+// RepairDatabase 检查正在使用的数据库，损坏时备份损坏文件并重建表结构
+// 数据库正常时返回 nil, nil；重建会丢失拉黑状态和请求统计历史
+func (prs *ProviderRelayService) RepairDatabase() (*DatabaseRepair, error) {
+	path, err := databasePath()
+	if err != nil {
+		return nil, err
+	}
+
+	databaseMu.Lock()
+	defer databaseMu.Unlock()
+
+	// 先关闭当前连接，否则 Windows 上无法移动数据库文件
+	current, _ := xdb.DB("default")
+	repair, err := recoverCorruptDatabase(path, current)
+	if err != nil {
+		// 备份失败时当前连接可能已被关闭，重新打开原文件保持现状
+		if current != nil {
+			_ = openDatabase(path)
+		}
+		return nil, err
+	}
+	if repair == nil {
+		return nil, nil
+	}
+	if err := openDatabase(path); err != nil {
+		return repair, err
+	}
+	return repair, nil
+}
+
+func openDatabase(path string) error {
+	if err := xdb.Inits([]xdb.Config{
+		{
+			Name:   "default",
+			Driver: "sqlite",
+			DSN:    path + databaseDSNParams,
+		},
+	}); err != nil {
+		return fmt.Errorf("初始化数据库失败: %w", err)
+	}
+	if err := ensureRequestLogTable(); err != nil {
+		return fmt.Errorf("初始化 request_log 表失败: %w", err)
+	}
+	if err := ensureBlacklistTables(); err != nil {
+		return fmt.Errorf("初始化黑名单表失败: %w", err)
+	}
+	return nil
+}
+
+// recoverCorruptDatabase 检查数据库文件，损坏时将其（连同 -wal/-shm）移动为备份
+// current 为正在使用的连接，检查结果为损坏时会先关闭；为 nil 时使用独立连接检查
+func recoverCorruptDatabase(path string, current *sql.DB) (*DatabaseRepair, error) {
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取数据库文件失败: %w", err)
+	}
+
+	db := current
+	if db == nil {
+		opened, err := sql.Open("sqlite", path+databaseDSNParams)
+		if err != nil {
+			return nil, fmt.Errorf("打开数据库失败: %w", err)
+		}
+		defer opened.Close()
+		db = opened
+	}
+	problem, err := integrityProblem(db)
+	if err != nil {
+		return nil, fmt.Errorf("检查数据库完整性失败: %w", err)
+	}
+	if problem == "" {
+		return nil, nil
+	}
+	_ = db.Close()
+
+	now := time.Now()
+	backupPath := fmt.Sprintf("%s.corrupt-%s", path, now.Format("20060102-150405"))
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(path+suffix, backupPath+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("备份损坏的数据库失败: %w", err)
+		}
+	}
+
+	repair := &DatabaseRepair{Path: path, BackupPath: backupPath, Reason: problem, RepairedAt: now}
+	lastDatabaseRepair = repair
+	fmt.Printf("[ERROR] %s\n", repair.Warning())
+	return repair, nil
+}
+
+// integrityProblem 执行 PRAGMA integrity_check，返回发现的问题（正常时为空）
+// 文件损坏到无法读取时同样视为问题；其他错误（如无权限）原样返回，避免误删正常数据
+func integrityProblem(db *sql.DB) (string, error) {
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		if isCorruptionErr(err) {
+			return err.Error(), nil
+		}
+		return "", err
+	}
+	defer rows.Close()
+
+	messages := make([]string, 0, 1)
+	for rows.Next() {
+		var message string
+		if err := rows.Scan(&message); err != nil {
+			return "", err
+		}
+		if len(messages) < maxIntegrityMessages {
+			messages = append(messages, message)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		if isCorruptionErr(err) {
+			return err.Error(), nil
+		}
+		return "", err
+	}
+	if len(messages) == 1 && messages[0] == "ok" {
+		return "", nil
+	}
+	if len(messages) == 0 {
+		return "integrity_check 无返回结果", nil
+	}
+	return strings.Join(messages, "; "), nil
+}
+
+func isCorruptionErr(err error) bool {
+	var coder interface{ Code() int }
+	if errors.As(err, &coder) {
+		switch coder.Code() & 0xff {
+		case sqliteCorrupt, sqliteNotADB:
+			return true
+		}
+	}
+	return false
+}
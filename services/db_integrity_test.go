@@ -0,0 +1,62 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestInitDatabaseRecoversCorruptFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	path := filepath.Join(home, ".code-switch", databaseFileName)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("创建配置目录失败: %v", err)
+	}
+	corrupt := bytes.Repeat([]byte("this is not a sqlite database "), 200)
+	if err := os.WriteFile(path, corrupt, 0o644); err != nil {
+		t.Fatalf("写入损坏的数据库失败: %v", err)
+	}
+
+	repair, err := initDatabase(path)
+	if err != nil {
+		t.Fatalf("损坏的数据库应被重建: %v", err)
+	}
+	if repair == nil || repair.Reason == "" {
+		t.Fatalf("应返回重建记录, 得到 %+v", repair)
+	}
+	if LastDatabaseRepair() != repair {
+		t.Fatalf("重建记录应可通过 LastDatabaseRepair 获取")
+	}
+	if backup, err := os.ReadFile(repair.BackupPath); err != nil || !bytes.Equal(backup, corrupt) {
+		t.Fatalf("损坏的文件应原样备份到 %s: %v", repair.BackupPath, err)
+	}
+
+	// 重建后表结构和默认配置可用
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatalf("获取数据库连接失败: %v", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM request_log").Scan(&count); err != nil || count != 0 {
+		t.Fatalf("重建后 request_log 应为空表: count=%d err=%v", count, err)
+	}
+	var enabled string
+	if err := db.QueryRow("SELECT value FROM app_settings WHERE key = 'enable_blacklist'").Scan(&enabled); err != nil || enabled != "true" {
+		t.Fatalf("重建后应写入默认配置: value=%q err=%v", enabled, err)
+	}
+
+	// 正常的数据库不应再次重建
+	again, err := (&ProviderRelayService{}).RepairDatabase()
+	if err != nil || again != nil {
+		t.Fatalf("正常的数据库不应重建: repair=%+v err=%v", again, err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM request_log").Scan(&count); err != nil {
+		t.Fatalf("检查后连接应保持可用: %v", err)
+	}
+}
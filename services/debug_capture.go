@@ -0,0 +1,88 @@
+package services
+
+import "sync"
+
+const (
+	// debugCaptureEnabledKey app_settings 中全局请求/响应抓取开关的配置键
+	debugCaptureEnabledKey = "debug_capture_enabled"
+	// maxCapturedExchanges 全局抓取保留的最近请求数；单个请求体/响应体按 maxExchangeBodyBytes 截取
+	maxCapturedExchanges = 50
+)
+
+// capturedExchanges 全局抓取的环形缓冲区：relay 写入，LogService 读取
+var capturedExchanges = newExchangeRing(maxCapturedExchanges)
+
+// exchangeRing 保存最近 size 条请求/响应，写满后覆盖最旧的记录
+type exchangeRing struct {
+	mu    sync.Mutex
+	items []ProviderExchange
+	next  int
+	full  bool
+}
+
+func newExchangeRing(size int) *exchangeRing {
+	return &exchangeRing{items: make([]ProviderExchange, size)}
+}
+
+func (r *exchangeRing) add(exchange ProviderExchange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items[r.next] = exchange
+	r.next = (r.next + 1) % len(r.items)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list 按时间倒序返回记录
+func (r *exchangeRing) list() []ProviderExchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := r.next
+	if r.full {
+		count = len(r.items)
+	}
+	result := make([]ProviderExchange, 0, count)
+	for i := 1; i <= count; i++ {
+		result = append(result, r.items[(r.next-i+len(r.items))%len(r.items)])
+	}
+	return result
+}
+
+func (r *exchangeRing) clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items = make([]ProviderExchange, len(r.items))
+	r.next, r.full = 0, false
+}
+
+// IsDebugCaptureEnabled 是否抓取所有经 relay 转发的请求/响应（默认关闭）
+func (ss *SettingsService) IsDebugCaptureEnabled() bool {
+	return getBoolSetting(debugCaptureEnabledKey, false)
+}
+
+// SetDebugCaptureEnabled 设置全局请求/响应抓取开关，关闭时清空已抓取的记录
+func (ss *SettingsService) SetDebugCaptureEnabled(enabled bool) error {
+	if err := setBoolSetting(debugCaptureEnabledKey, enabled); err != nil {
+		return err
+	}
+	if !enabled {
+		capturedExchanges.clear()
+	}
+	return nil
+}
+
+// debugCaptureEnabled 全局抓取是否开启，未注入 SettingsService 时视为关闭
+func (prs *ProviderRelayService) debugCaptureEnabled() bool {
+	return prs.settingsService != nil && prs.settingsService.IsDebugCaptureEnabled()
+}
+
+// GetCapturedExchanges 返回全局抓取的最近请求/响应（最新在前，已脱敏），需先通过 SetDebugCaptureEnabled 开启
+func (ls *LogService) GetCapturedExchanges() []ProviderExchange {
+	return capturedExchanges.list()
+}
+
+// ClearCapturedExchanges 清空全局抓取的请求/响应
+func (ls *LogService) ClearCapturedExchanges() {
+	capturedExchanges.clear()
+}
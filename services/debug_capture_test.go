@@ -0,0 +1,82 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGlobalDebugCapture(t *testing.T) {
+	setupTestEnv(t)
+	capturedExchanges.clear()
+	t.Cleanup(capturedExchanges.clear)
+
+	large := strings.Repeat("x", maxExchangeBodyBytes+1024)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(string(body), "large") {
+			_, _ = w.Write([]byte(`{"id":"msg_large","text":"` + large + `"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"msg_1","echo":"sk-global-456"}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "main", APIURL: upstream.URL, APIKey: "sk-global-456", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	logs := &LogService{}
+
+	send := func(body string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+		}
+	}
+
+	send(`{"model":"claude-sonnet-4"}`)
+	if relay.settingsService.IsDebugCaptureEnabled() || len(logs.GetCapturedExchanges()) != 0 {
+		t.Fatalf("全局抓取应默认关闭")
+	}
+
+	if err := relay.settingsService.SetDebugCaptureEnabled(true); err != nil {
+		t.Fatalf("开启全局抓取失败: %v", err)
+	}
+	for i := 0; i < maxCapturedExchanges+3; i++ {
+		send(fmt.Sprintf(`{"model":"claude-sonnet-4","n":%d}`, i))
+	}
+	send(`{"model":"claude-sonnet-4","large":true}`)
+
+	exchanges := logs.GetCapturedExchanges()
+	if len(exchanges) != maxCapturedExchanges {
+		t.Fatalf("全局抓取应限制为 %d 条, 得到 %d", maxCapturedExchanges, len(exchanges))
+	}
+	if latest := exchanges[0]; !latest.Truncated || len(latest.ResponseBody) > maxExchangeBodyBytes {
+		t.Fatalf("超出上限的响应体应截断: truncated=%v, len=%d", latest.Truncated, len(latest.ResponseBody))
+	}
+	previous := exchanges[1]
+	if !strings.Contains(previous.RequestBody, fmt.Sprintf(`"n":%d`, maxCapturedExchanges+2)) {
+		t.Fatalf("应按时间倒序返回: %s", previous.RequestBody)
+	}
+	if previous.RequestHeaders["Authorization"] != redactedValue || strings.Contains(previous.ResponseBody, "sk-global-456") {
+		t.Fatalf("Authorization 和 API Key 应脱敏: %+v", previous)
+	}
+
+	if err := relay.settingsService.SetDebugCaptureEnabled(false); err != nil {
+		t.Fatalf("关闭全局抓取失败: %v", err)
+	}
+	send(`{"model":"claude-sonnet-4"}`)
+	if got := logs.GetCapturedExchanges(); len(got) != 0 {
+		t.Fatalf("关闭全局抓取后应清空并停止抓取, 得到 %d 条", len(got))
+	}
+}
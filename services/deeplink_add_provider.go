@@ -0,0 +1,174 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	// DeepLinkHandledEvent 处理 bmai:// 链接后通知前端的事件名，payload 为 DeepLinkResult
+	DeepLinkHandledEvent = "deeplink:handled"
+
+	// DeepLinkScheme 应用注册的链接协议
+	DeepLinkScheme = "bmai"
+
+	deepLinkAddProvider = "add-provider"
+)
+
+// DeepLinkResult 链接处理结果，前端据此弹出确认或错误提示（不包含 API Key）
+type DeepLinkResult struct {
+	Action       string `json:"action"`
+	Kind         string `json:"kind,omitempty"`
+	ProviderID   int64  `json:"providerId,omitempty"`
+	ProviderName string `json:"providerName,omitempty"`
+	APIURL       string `json:"apiUrl,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// OnHandled 注册链接处理回调（main 中据此向前端发送 DeepLinkHandledEvent）
+func (s *DeepLinkService) OnHandled(fn func(DeepLinkResult)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onHandled = append(s.onHandled, fn)
+}
+
+// HandleURL 处理系统转交的 bmai:// 链接，目前支持：
+// bmai://add-provider?kind=claude&name=...&apiUrl=...&apiKey=...[&site=...]
+// 添加的供应商默认不启用，用户在前端确认后再手动启用；无论成功与否都会通知 OnHandled 回调
+func (s *DeepLinkService) HandleURL(rawURL string) (*DeepLinkResult, error) {
+	result, err := s.handleURL(rawURL)
+	if err != nil {
+		result.Error = err.Error()
+		fmt.Printf("[WARN] 处理链接失败: %v\n", err)
+	} else {
+		fmt.Printf("[INFO] 已通过链接添加 %s 供应商: %s（未启用）\n", result.Kind, result.ProviderName)
+	}
+
+	s.mu.Lock()
+	last := *result
+	s.lastResult = &last
+	listeners := append([]func(DeepLinkResult){}, s.onHandled...)
+	s.mu.Unlock()
+	for _, fn := range listeners {
+		go fn(*result)
+	}
+	return result, err
+}
+
+// GetLastResult 最近一次链接处理结果
+// 应用由链接冷启动时事件可能早于前端加载，前端启动后据此补弹提示
+func (s *DeepLinkService) GetLastResult() *DeepLinkResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastResult
+}
+
+func (s *DeepLinkService) handleURL(rawURL string) (*DeepLinkResult, error) {
+	result := &DeepLinkResult{}
+	// 链接中带有 API Key：错误信息中不能包含原始链接
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return result, fmt.Errorf("链接格式无效")
+	}
+	if !strings.EqualFold(parsed.Scheme, DeepLinkScheme) {
+		return result, fmt.Errorf("不支持的链接协议: %s", parsed.Scheme)
+	}
+	// 部分浏览器会在 host 后补一个 "/"
+	action := strings.ToLower(parsed.Host)
+	if parsed.Path != "" && parsed.Path != "/" {
+		action += parsed.Path
+	}
+	result.Action = action
+	if action != deepLinkAddProvider {
+		return result, fmt.Errorf("不支持的链接操作: %s", action)
+	}
+
+	// 不用 parsed.Query()：它会静默丢弃格式错误的参数
+	params, err := url.ParseQuery(parsed.RawQuery)
+	if err != nil {
+		return result, fmt.Errorf("链接参数格式无效")
+	}
+	kind, provider, err := parseAddProviderQuery(params)
+	result.Kind = kind
+	result.ProviderName = provider.Name
+	result.APIURL = provider.APIURL
+	if err != nil {
+		return result, err
+	}
+	if s.providerService == nil {
+		return result, fmt.Errorf("供应商服务未初始化")
+	}
+	id, err := s.providerService.addProviderFromLink(kind, provider)
+	if err != nil {
+		return result, err
+	}
+	result.ProviderID = id
+	return result, nil
+}
+
+// parseAddProviderQuery 从 add-provider 链接的参数构建供应商，缺少的必填参数一次性列出
+func parseAddProviderQuery(params url.Values) (string, Provider, error) {
+	get := func(key string) string {
+		return strings.TrimSpace(params.Get(key))
+	}
+	kind := strings.ToLower(get("kind"))
+	provider := Provider{
+		Name:   get("name"),
+		APIURL: get("apiUrl"),
+		APIKey: get("apiKey"),
+		Site:   get("site"),
+		Level:  1,
+	}
+
+	missing := make([]string, 0)
+	for _, field := range []struct{ key, value string }{
+		{"kind", kind}, {"name", provider.Name}, {"apiUrl", provider.APIURL}, {"apiKey", provider.APIKey},
+	} {
+		if field.value == "" {
+			missing = append(missing, field.key)
+		}
+	}
+	if len(missing) > 0 {
+		return kind, provider, fmt.Errorf("链接缺少参数: %s", strings.Join(missing, ", "))
+	}
+	switch kind {
+	case "claude", "codex":
+	case "gemini":
+		return kind, provider, fmt.Errorf("Gemini 供应商暂不支持通过链接添加，请在 Gemini 页面手动添加")
+	default:
+		return kind, provider, fmt.Errorf("不支持的供应商类型: %s", kind)
+	}
+	if provider.Site != "" {
+		if err := validateHTTPURL(provider.Site, "site"); err != nil {
+			return kind, provider, err
+		}
+	}
+	provider.Accent, provider.Tint = defaultVisual(kind)
+	return kind, provider, nil
+}
+
+// addProviderFromLink 校验并追加链接中的供应商（默认不启用），同名供应商已存在时拒绝添加
+func (ps *ProviderService) addProviderFromLink(kind string, provider Provider) (int64, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return 0, fmt.Errorf("加载供应商列表失败: %w", err)
+	}
+	for _, existing := range providers {
+		if normalizeName(existing.Name) == normalizeName(provider.Name) {
+			return 0, fmt.Errorf("已存在同名供应商: %s", existing.Name)
+		}
+	}
+	provider.ID = nextProviderID(providers)
+	provider.Enabled = false
+	if errs := provider.ValidateConfiguration(); len(errs) > 0 {
+		return 0, fmt.Errorf("链接中的供应商配置无效：%s", strings.Join(errs, "；"))
+	}
+	if err := ps.saveProvidersLocked(kind, append(providers, provider)); err != nil {
+		return 0, fmt.Errorf("保存供应商失败: %w", err)
+	}
+	return provider.ID, nil
+}
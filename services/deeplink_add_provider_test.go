@@ -0,0 +1,67 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeepLinkAddProvider(t *testing.T) {
+	setupTestEnv(t)
+	ps := NewProviderService()
+	s := NewDeepLinkService(ps)
+	if err := ps.SaveProviders("claude", []Provider{{ID: 3, Name: "Existing", APIURL: "https://existing.example.com", APIKey: "sk-old", Enabled: true, Level: 1}}); err != nil {
+		t.Fatalf("保存供应商失败: %v", err)
+	}
+	handled := make(chan DeepLinkResult, 8)
+	s.OnHandled(func(result DeepLinkResult) { handled <- result })
+
+	query := url.Values{"kind": {"claude"}, "name": {"relay"}, "apiUrl": {"https://relay.example.com"}, "apiKey": {"sk-link"}, "site": {"https://relay.example.com/console"}}
+	result, err := s.HandleURL("bmai://add-provider/?" + query.Encode())
+	if err != nil {
+		t.Fatalf("添加失败: %v", err)
+	}
+	if result.ProviderID != 4 || result.Kind != "claude" || result.ProviderName != "relay" {
+		t.Fatalf("处理结果不正确: %+v", result)
+	}
+	select {
+	case got := <-handled:
+		if got.ProviderID != 4 || got.Error != "" {
+			t.Fatalf("回调结果不正确: %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("未收到处理回调")
+	}
+	providers, _ := ps.LoadProviders("claude")
+	if len(providers) != 2 || providers[1].APIKey != "sk-link" || providers[1].Site != "https://relay.example.com/console" || providers[1].Enabled || providers[1].Accent == "" {
+		t.Fatalf("链接添加的供应商应默认不启用: %+v", providers)
+	}
+
+	for _, tc := range []struct{ link, want string }{
+		{"bmai://add-provider?kind=claude&name=x", "链接缺少参数: apiUrl, apiKey"},
+		{"bmai://add-provider?kind=claude&name=EXISTING&apiUrl=https://a.example.com&apiKey=sk", "已存在同名供应商"},
+		{"bmai://add-provider?kind=codex&name=x&apiUrl=relay.example.com&apiKey=sk", "链接中的供应商配置无效"},
+		{"bmai://add-provider?kind=gemini&name=x&apiUrl=https://a.example.com&apiKey=sk", "Gemini"},
+		{"bmai://add-provider?kind=other&name=x&apiUrl=https://a.example.com&apiKey=sk", "不支持的供应商类型"},
+		{"bmai://remove-provider?name=x", "不支持的链接操作"},
+		{"https://add-provider?name=x", "不支持的链接协议"},
+		{"bmai://add provider?apiKey=sk-secret", "链接格式无效"},
+		{"bmai://add-provider?kind=claude&name=x&apiUrl=%zz&apiKey=sk-secret", "链接参数格式无效"},
+	} {
+		result, err := s.HandleURL(tc.link)
+		if err == nil || !strings.Contains(err.Error(), tc.want) || result.Error != err.Error() {
+			t.Errorf("HandleURL(%s) err = %v, 期望包含 %q", tc.link, err, tc.want)
+			continue
+		}
+		if strings.Contains(err.Error(), "sk-secret") {
+			t.Errorf("错误信息不应包含 API Key: %v", err)
+		}
+	}
+	if providers, _ := ps.LoadProviders("codex"); len(providers) != 0 {
+		t.Fatalf("无效链接不应写入供应商: %+v", providers)
+	}
+	if last := s.GetLastResult(); last == nil || last.Error == "" {
+		t.Fatalf("应记录最近一次处理结果: %+v", last)
+	}
+}
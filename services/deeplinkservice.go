@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -33,6 +34,10 @@ type DeepLinkImportRequest struct {
 // DeepLinkService 深度链接服务
 type DeepLinkService struct {
 	providerService *ProviderService
+
+	mu         sync.Mutex
+	onHandled  []func(DeepLinkResult)
+	lastResult *DeepLinkResult
 }
 
 // NewDeepLinkService 创建深度链接服务
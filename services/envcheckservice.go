@@ -3,6 +3,7 @@ package services
 import (
 	"bufio"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -197,3 +198,87 @@ func (s *EnvCheckService) checkFile(filePath string, keywords []string) ([]EnvCo
 
 	return conflicts, scanner.Err()
 }
+
+// EnvConflictReport 与 relay 配置冲突的环境变量及处理建议
+type EnvConflictReport struct {
+	EnvConflict
+	Platform string `json:"platform"` // claude / codex / gemini
+	Severity string `json:"severity"` // "error"：请求会绕过 relay；"warning"：可能覆盖 relay 的认证配置
+	Guidance string `json:"guidance"` // 处理建议
+}
+
+// relayConflictVar 会覆盖 relay 配置的环境变量
+type relayConflictVar struct {
+	Platform string
+	Name     string
+	BaseURL  bool // 为 true 表示该变量覆盖请求地址
+}
+
+var relayConflictVars = []relayConflictVar{
+	{Platform: "claude", Name: "ANTHROPIC_BASE_URL", BaseURL: true},
+	{Platform: "claude", Name: "ANTHROPIC_AUTH_TOKEN"},
+	{Platform: "claude", Name: "ANTHROPIC_API_KEY"},
+	{Platform: "codex", Name: "OPENAI_BASE_URL", BaseURL: true},
+	{Platform: "codex", Name: "OPENAI_API_BASE", BaseURL: true},
+	{Platform: "codex", Name: "OPENAI_API_KEY"},
+	{Platform: "gemini", Name: "GOOGLE_GEMINI_BASE_URL", BaseURL: true},
+	{Platform: "gemini", Name: "GEMINI_API_KEY"},
+}
+
+// EnvConflictCheck 检查会导致 CLI 绕过 relay 的环境变量（进程环境 + 常见 Shell 配置文件）
+// 即使 ~/.claude/settings.json 等已指向 relay，Shell 中导出的同名变量仍可能覆盖它们
+func (s *EnvCheckService) EnvConflictCheck() ([]EnvConflictReport, error) {
+	keywords := make([]string, 0, len(relayConflictVars))
+	byName := make(map[string]relayConflictVar, len(relayConflictVars))
+	for _, v := range relayConflictVars {
+		keywords = append(keywords, v.Name)
+		byName[v.Name] = v
+	}
+
+	candidates := s.checkSystemEnv(keywords)
+	if runtime.GOOS != "windows" {
+		if shellConflicts, err := s.checkShellConfigs(keywords); err == nil {
+			candidates = append(candidates, shellConflicts...)
+		}
+	}
+
+	reports := make([]EnvConflictReport, 0)
+	for _, candidate := range candidates {
+		v, ok := byName[strings.ToUpper(candidate.VarName)]
+		if !ok || strings.TrimSpace(candidate.VarValue) == "" {
+			continue
+		}
+		report := EnvConflictReport{EnvConflict: candidate, Platform: v.Platform}
+		if v.BaseURL {
+			if pointsToLocalRelay(candidate.VarValue) {
+				continue
+			}
+			report.Severity = "error"
+			report.Guidance = fmt.Sprintf("%s 会覆盖 relay 地址，请求将直接发往 %s；请删除该变量后重新打开终端", v.Name, candidate.VarValue)
+		} else {
+			if strings.EqualFold(candidate.VarValue, claudeAuthTokenValue) {
+				continue
+			}
+			report.Severity = "warning"
+			report.Guidance = fmt.Sprintf("%s 可能覆盖 relay 使用的认证配置，如非必要请删除后重新打开终端", v.Name)
+		}
+		if candidate.SourceType == "file" {
+			report.Guidance += fmt.Sprintf("（定义于 %s）", candidate.SourcePath)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// pointsToLocalRelay 判断 URL 是否指向本机（视为与 relay 一致）
+func pointsToLocalRelay(raw string) bool {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(parsed.Hostname()) {
+	case "127.0.0.1", "localhost", "::1":
+		return true
+	}
+	return false
+}
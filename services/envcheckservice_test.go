@@ -0,0 +1,49 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestEnvConflictCheck(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	for _, v := range relayConflictVars {
+		t.Setenv(v.Name, "")
+	}
+	t.Setenv("ANTHROPIC_BASE_URL", "https://api.anthropic.com")
+	t.Setenv("ANTHROPIC_AUTH_TOKEN", claudeAuthTokenValue)
+	t.Setenv("GOOGLE_GEMINI_BASE_URL", "http://127.0.0.1:18100/gemini")
+	t.Setenv("ANTHROPIC_MODEL", "claude-sonnet-4")
+
+	rc := "export OPENAI_API_KEY=\"sk-shell\"\n# export OPENAI_BASE_URL=https://ignored\n"
+	if err := os.WriteFile(filepath.Join(home, ".zshrc"), []byte(rc), 0o644); err != nil {
+		t.Fatalf("写入 .zshrc 失败: %v", err)
+	}
+
+	reports, err := NewEnvCheckService().EnvConflictCheck()
+	if err != nil {
+		t.Fatalf("检查失败: %v", err)
+	}
+
+	found := make(map[string]EnvConflictReport)
+	for _, report := range reports {
+		found[report.VarName+"|"+report.SourceType] = report
+	}
+	if report, ok := found["ANTHROPIC_BASE_URL|system"]; !ok || report.Severity != "error" || report.Platform != "claude" {
+		t.Fatalf("应报告 ANTHROPIC_BASE_URL 冲突: %+v", reports)
+	}
+	for _, key := range []string{"ANTHROPIC_AUTH_TOKEN|system", "GOOGLE_GEMINI_BASE_URL|system", "ANTHROPIC_MODEL|system"} {
+		if _, ok := found[key]; ok {
+			t.Errorf("%s 不应报告为冲突", key)
+		}
+	}
+	if runtime.GOOS != "windows" {
+		if report, ok := found["OPENAI_API_KEY|file"]; !ok || report.Severity != "warning" {
+			t.Fatalf("应报告 .zshrc 中的 OPENAI_API_KEY: %+v", reports)
+		}
+	}
+}
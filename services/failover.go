@@ -0,0 +1,50 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxProviderAttempts 单个请求最多尝试的 provider 数（含第一次）
+const maxProviderAttempts = 3
+
+// retrySafe 上游失败时客户端尚未收到任何字节，可以换其他 provider 重试
+// 已写出部分响应（流式响应中途中断）时重试会让客户端收到两份拼接的响应，不能重试
+func retrySafe(c *gin.Context, err error) bool {
+	if errors.Is(err, errStreamInterrupted) {
+		return false
+	}
+	return !c.Writer.Written()
+}
+
+// nextFailoverProvider 从候选列表中选出下一个未尝试过的 provider（同样按 Level、轮询和黑名单选择）
+// candidates 为空（强制指定了 provider）或已达到尝试上限时返回 false
+func (prs *ProviderRelayService) nextFailoverProvider(kind string, requestedModel string, inputTokens int, candidates []Provider, tried map[string]bool, attempts int) (Provider, int, bool) {
+	if len(candidates) == 0 || attempts >= maxProviderAttempts {
+		return Provider{}, 0, false
+	}
+	remaining := make([]Provider, 0, len(candidates))
+	for _, provider := range candidates {
+		if !tried[provider.Name] {
+			remaining = append(remaining, provider)
+		}
+	}
+	if len(remaining) == 0 {
+		return Provider{}, 0, false
+	}
+	provider, level, _, ok := prs.pickProvider(kind, requestedModel, inputTokens, remaining)
+	return provider, level, ok
+}
+
+// resetResponseHeader 撤销失败的上游响应已复制但尚未发送的响应头，避免混入重试的响应
+func resetResponseHeader(c *gin.Context, base http.Header) {
+	header := c.Writer.Header()
+	for key := range header {
+		delete(header, key)
+	}
+	for key, values := range base {
+		header[key] = append([]string(nil), values...)
+	}
+}
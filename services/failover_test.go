@@ -0,0 +1,99 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+func TestFailoverOnlyBeforeFirstByte(t *testing.T) {
+	setupTestEnv(t)
+
+	// 首个事件之前断开：客户端尚未收到任何字节
+	var earlyHits int32
+	early := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&earlyHits, 1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("X-Early", "1")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer early.Close()
+
+	// 写出超过 1KB 后断开：已开始的流式响应
+	var midHits int32
+	mid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&midHits, 1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 20; i++ {
+			_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"hello world\"}}\n\n"))
+		}
+		w.(http.Flusher).Flush()
+		if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer mid.Close()
+
+	var healthyHits int32
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&healthyHits, 1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message_stop\ndata: {\"type\":\"message_stop\",\"from\":\"healthy\"}\n\n"))
+	}))
+	defer healthy.Close()
+
+	send := func(router *gin.Engine) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4","stream":true}`))
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "early", APIURL: early.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+		{ID: 2, Name: "healthy", APIURL: healthy.URL, APIKey: "sk-test", Enabled: true, Level: 2},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	rec := send(router)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"from":"healthy"`) {
+		t.Fatalf("首字节前失败应切换到下一个 provider: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("X-Early") != "" {
+		t.Fatalf("失败 provider 的响应头不应混入重试的响应")
+	}
+	if atomic.LoadInt32(&earlyHits) == 0 || atomic.LoadInt32(&healthyHits) != 1 {
+		t.Fatalf("调用次数不正确: early=%d healthy=%d", earlyHits, healthyHits)
+	}
+	var failures int
+	db, _ := xdb.DB("default")
+	if err := db.QueryRow(`SELECT failure_count FROM provider_blacklist WHERE platform = ? AND provider_name = ?`, "claude", "early").Scan(&failures); err != nil || failures == 0 {
+		t.Fatalf("首字节前失败的 provider 应记录失败: %d, %v", failures, err)
+	}
+
+	atomic.StoreInt32(&healthyHits, 0)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 3, Name: "mid", APIURL: mid.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+		{ID: 2, Name: "healthy", APIURL: healthy.URL, APIKey: "sk-test", Enabled: true, Level: 2},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	rec = send(router)
+	if atomic.LoadInt32(&midHits) != 1 || atomic.LoadInt32(&healthyHits) != 0 {
+		t.Fatalf("流式响应中途中断后不应重试: mid=%d healthy=%d", midHits, healthyHits)
+	}
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), ErrCodeStreamInterrupted) {
+		t.Fatalf("中途中断应以错误事件结束响应: %d %s", rec.Code, rec.Body.String())
+	}
+}
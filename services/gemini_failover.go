@@ -0,0 +1,265 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+// geminiUpstreamError 上游返回非 2xx：保留原始响应，所有 provider 都失败时原样返回给客户端
+type geminiUpstreamError struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+func (e *geminiUpstreamError) Error() string {
+	return fmt.Sprintf("upstream status %d", e.status)
+}
+
+// geminiModelPath 匹配 Gemini 请求路径中的模型名，例如 /v1beta/models/gemini-2.5-pro:generateContent
+var geminiModelPath = regexp.MustCompile(`^(.*/models/)([^/:]+)(.*)$`)
+
+// geminiModelFromEndpoint 提取请求路径中的模型名，路径中没有模型时返回空
+func geminiModelFromEndpoint(endpoint string) string {
+	if match := geminiModelPath.FindStringSubmatch(endpoint); match != nil {
+		return match[2]
+	}
+	return ""
+}
+
+// replaceGeminiModelInEndpoint 将请求路径中的模型名替换为 model
+func replaceGeminiModelInEndpoint(endpoint string, model string) string {
+	match := geminiModelPath.FindStringSubmatch(endpoint)
+	if match == nil {
+		return endpoint
+	}
+	return match[1] + model + match[3]
+}
+
+// modelRules 以 Provider 的白名单和映射规则（含通配符）判断模型支持情况
+func (p *GeminiProvider) modelRules() *Provider {
+	return &Provider{SupportedModels: p.SupportedModels, ModelMapping: p.ModelMapping, CaseSensitiveModels: p.CaseSensitiveModels}
+}
+
+// IsModelSupported 检查 Gemini provider 是否支持指定的模型（与 Provider.IsModelSupported 规则相同）
+func (p *GeminiProvider) IsModelSupported(modelName string) bool {
+	return p.modelRules().IsModelSupported(modelName)
+}
+
+// GetEffectiveModel 获取映射后实际请求的模型名，没有映射时返回原模型名
+func (p *GeminiProvider) GetEffectiveModel(requestedModel string) string {
+	return p.modelRules().GetEffectiveModel(requestedModel)
+}
+
+// geminiCandidates 按配置顺序返回可用的 Gemini provider：已启用、配置了 BaseURL、支持请求的模型，且未被拉黑或熔断
+// unsupported 为因不支持该模型而跳过的 provider 数
+func (prs *ProviderRelayService) geminiCandidates(providers []GeminiProvider, model string) (candidates []GeminiProvider, unsupported int) {
+	candidates = make([]GeminiProvider, 0, len(providers))
+	for _, provider := range providers {
+		if !provider.Enabled || provider.BaseURL == "" {
+			continue
+		}
+		if model != "" && !provider.IsModelSupported(model) {
+			fmt.Printf("[Gemini] Provider %s 不支持模型 %s，已跳过\n", provider.Name, model)
+			unsupported++
+			continue
+		}
+		if open, until := prs.providerCircuits().IsOpen("gemini", provider.Name); open {
+			fmt.Printf("[Gemini] Provider %s 熔断中，恢复时间: %v，已跳过\n", provider.Name, until.Format("15:04:05"))
+			continue
+		}
+		if isBlacklisted, until := prs.blacklistService.IsBlacklisted("gemini", provider.Name); isBlacklisted {
+			fmt.Printf("⛔ Provider %s 已拉黑，过期时间: %v\n", provider.Name, until.Format("15:04:05"))
+			continue
+		}
+		candidates = append(candidates, provider)
+	}
+	return candidates, unsupported
+}
+
+// forwardGeminiRequest 将请求转发给单个 Gemini provider 并写入请求日志
+// 非 2xx、连接失败、流式响应在首个字节前断开时不向客户端写出任何内容，由调用方切换 provider 重试
+func (prs *ProviderRelayService) forwardGeminiRequest(
+	c *gin.Context,
+	ctx context.Context,
+	provider GeminiProvider,
+	endpoint string,
+	requestedModel string,
+	bodyBytes []byte,
+	isStream bool,
+) (success bool, forwardErr error) {
+	fmt.Printf("[Gemini] 使用 Provider: %s | BaseURL: %s\n", provider.Name, provider.BaseURL)
+
+	// 模型映射：改写 URL 中的模型名
+	model := provider.Model
+	if requestedModel != "" {
+		model = provider.GetEffectiveModel(requestedModel)
+		if model != requestedModel {
+			fmt.Printf("[Gemini] Provider %s 映射模型: %s -> %s\n", provider.Name, requestedModel, model)
+			endpoint = replaceGeminiModelInEndpoint(endpoint, model)
+		}
+	}
+
+	// 创建请求日志
+	requestLog := &ReqeustLog{
+		Provider:     provider.Name,
+		Platform:     "gemini",
+		Model:        model,
+		SessionID:    sessionFromRequest(c),
+		IsStream:     isStream,
+		InputTokens:  0,
+		OutputTokens: 0,
+	}
+
+	// 记录开始时间并在函数结束时保存日志（关闭请求日志时跳过，也不解析 token 用量）
+	logEnabled := prs.requestLogEnabled()
+	start := time.Now()
+	defer func() {
+		if !logEnabled {
+			return
+		}
+		requestLog.DurationSec = time.Since(start).Seconds()
+		applyRequestCost(requestLog)
+		if _, err := xdb.New("request_log").Insert(xdb.Record{
+			"platform":            requestLog.Platform,
+			"model":               requestLog.Model,
+			"provider":            requestLog.Provider,
+			"http_code":           requestLog.HttpCode,
+			"input_tokens":        requestLog.InputTokens,
+			"output_tokens":       requestLog.OutputTokens,
+			"cache_create_tokens": requestLog.CacheCreateTokens,
+			"cache_read_tokens":   requestLog.CacheReadTokens,
+			"reasoning_tokens":    requestLog.ReasoningTokens,
+			"is_stream":           boolToInt(requestLog.IsStream),
+			"duration_sec":        requestLog.DurationSec,
+			"session_id":          requestLog.SessionID,
+			"partial":             boolToInt(requestLog.Partial),
+			"has_pricing":         boolToInt(requestLog.HasPricing),
+			"input_cost":          requestLog.InputCost,
+			"output_cost":         requestLog.OutputCost,
+			"cache_create_cost":   requestLog.CacheCreateCost,
+			"cache_read_cost":     requestLog.CacheReadCost,
+			"ephemeral_5m_cost":   requestLog.Ephemeral5mCost,
+			"ephemeral_1h_cost":   requestLog.Ephemeral1hCost,
+			"total_cost":          requestLog.TotalCost,
+		}); err != nil {
+			fmt.Printf("[Gemini] 写入 request_log 失败: %v\n", err)
+		}
+	}()
+
+	// 构建目标 URL
+	targetURL := strings.TrimSuffix(provider.BaseURL, "/") + endpoint
+	fmt.Printf("[Gemini] 转发到: %s\n", targetURL)
+
+	// 创建 HTTP 请求
+	req, err := http.NewRequestWithContext(ctx, "POST", targetURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		requestLog.HttpCode = http.StatusInternalServerError
+		return false, fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	// 复制请求头（会话标识只用于本地统计，不转发）
+	for key, values := range c.Request.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Del(sessionIDHeader)
+
+	// 全局请求头覆盖客户端同名请求头，API Key 最后设置，优先级最高
+	for key, value := range loadGlobalHeaders(prs.settingsService) {
+		req.Header.Set(key, value)
+	}
+
+	// 设置 API Key（如果有）
+	if provider.APIKey != "" {
+		// Gemini API 使用 x-goog-api-key 头
+		req.Header.Set("x-goog-api-key", provider.APIKey)
+	}
+
+	// 发送请求
+	client, err := upstreamHTTPClient(provider.Name, provider.InsecureSkipVerify, upstreamOverride{}, 300*time.Second)
+	if err != nil {
+		requestLog.HttpCode = http.StatusInternalServerError
+		return false, fmt.Errorf("构建上游 TLS 配置失败: %w", err)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 300 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		requestLog.HttpCode = http.StatusBadGateway
+		return false, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	requestLog.HttpCode = resp.StatusCode
+	fmt.Printf("[Gemini] Provider %s 响应: %d | 耗时: %.2fs\n", provider.Name, resp.StatusCode, time.Since(start).Seconds())
+
+	// 非成功响应：保留原始响应，由调用方决定重试或原样返回
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		errorBody, _ := io.ReadAll(resp.Body)
+		return false, &geminiUpstreamError{status: resp.StatusCode, contentType: resp.Header.Get("Content-Type"), body: errorBody}
+	}
+
+	body := watchUpstreamBody(resp)
+	if isStream {
+		// 流式响应 - 先等到首个字节再写响应头，首个字节前断开仍可切换 provider
+		reader := bufio.NewReader(resp.Body)
+		if _, err := reader.Peek(1); err != nil {
+			return false, fmt.Errorf("流式响应在首个事件前断开: %w", err)
+		}
+		prs.writeGeminiResponseHeader(c, resp)
+
+		// 转发的同时解析每个 chunk 中的 usageMetadata
+		var source io.Reader = reader
+		if logEnabled {
+			lines := newSSELineParser(GeminiParseTokenUsageFromResponse, requestLog)
+			defer lines.Flush()
+			source = io.TeeReader(reader, sseUsageWriter{lines: lines})
+		}
+		c.Writer.Flush()
+		if _, err := io.Copy(c.Writer, source); err != nil {
+			fmt.Printf("[Gemini] 流式传输失败: %v\n", err)
+			if body.err != nil && ctx.Err() == nil {
+				requestLog.Partial = true
+				writeStreamErrorEvent(c, "gemini", endpoint, fmt.Sprintf("Provider %s 响应中途中断: %v", provider.Name, body.err), provider.Name)
+				return false, fmt.Errorf("%w: %v", errStreamInterrupted, body.err)
+			}
+		}
+		return true, nil
+	}
+
+	// 非流式响应 - 读取完整响应后再写给客户端
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if logEnabled {
+		parseGeminiResponseUsage(data, requestLog)
+	}
+	prs.writeGeminiResponseHeader(c, resp)
+	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), data)
+	return true, nil
+}
+
+// writeGeminiResponseHeader 复制上游响应头（剔除黑名单中的响应头）并写入状态码
+func (prs *ProviderRelayService) writeGeminiResponseHeader(c *gin.Context, resp *http.Response) {
+	stripResponseHeaders(resp.Header, loadResponseHeaderDenylist(prs.settingsService))
+	for key, values := range resp.Header {
+		for _, value := range values {
+			c.Header(key, value)
+		}
+	}
+	c.Status(resp.StatusCode)
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestGeminiFailover(t *testing.T) {
+	setupTestEnv(t)
+
+	var downHits, earlyHits, okHits int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&downHits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":{"code":500,"message":"boom"}}`))
+	}))
+	defer down.Close()
+	// 返回 200 但在首个字节前断开
+	early := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&earlyHits, 1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer early.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&okHits, 1)
+		if r.Header.Get("x-goog-api-key") != "key-ok" {
+			t.Errorf("x-goog-api-key = %q", r.Header.Get("x-goog-api-key"))
+		}
+		if strings.Contains(r.URL.Path, ":streamGenerateContent") {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte(`data: {"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":2}}` + "\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":2}}`))
+	}))
+	defer healthy.Close()
+
+	relay, router := newTestRelay(t)
+	relay.geminiService = NewGeminiService(relay.addr)
+	for _, provider := range []GeminiProvider{
+		{ID: "g1", Name: "down", BaseURL: down.URL, APIKey: "key-down", Enabled: true},
+		{ID: "g2", Name: "disabled", BaseURL: healthy.URL, APIKey: "key-ok"},
+		{ID: "g3", Name: "ok", BaseURL: healthy.URL, APIKey: "key-ok", Enabled: true},
+	} {
+		if err := relay.geminiService.AddProvider(provider); err != nil {
+			t.Fatalf("添加 provider 失败: %v", err)
+		}
+	}
+	send := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"contents":[]}`)))
+		return rec
+	}
+
+	// 非 2xx 时切换到下一个启用的 provider，失败计入 gemini 平台的黑名单计数
+	rec := send("/gemini/v1beta/models/gemini-2.5-pro:generateContent")
+	if rec.Code != http.StatusOK || atomic.LoadInt32(&downHits) != 1 || atomic.LoadInt32(&okHits) != 1 {
+		t.Fatalf("应切换到可用的 provider: code=%d down=%d ok=%d", rec.Code, atomic.LoadInt32(&downHits), atomic.LoadInt32(&okHits))
+	}
+	statuses, err := relay.blacklistService.GetBlacklistStatus("gemini")
+	if err != nil {
+		t.Fatalf("查询黑名单失败: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].ProviderName != "down" || statuses[0].FailureCount != 1 {
+		t.Fatalf("失败应以 gemini 平台记录: %+v", statuses)
+	}
+
+	// 流式响应在首个字节前断开同样可以切换
+	if err := relay.geminiService.UpdateProvider(GeminiProvider{ID: "g1", Name: "down", BaseURL: early.URL, APIKey: "key-down", Enabled: true}); err != nil {
+		t.Fatalf("更新 provider 失败: %v", err)
+	}
+	rec = send("/gemini/v1beta/models/gemini-2.5-pro:streamGenerateContent?alt=sse")
+	if rec.Code != http.StatusOK || atomic.LoadInt32(&earlyHits) != 1 || !strings.Contains(rec.Body.String(), "usageMetadata") {
+		t.Fatalf("首个字节前断开应切换 provider: code=%d early=%d body=%s", rec.Code, atomic.LoadInt32(&earlyHits), rec.Body.String())
+	}
+
+	// 所有 provider 都失败时原样返回上游的错误响应
+	if err := relay.geminiService.UpdateProvider(GeminiProvider{ID: "g1", Name: "down", BaseURL: down.URL, APIKey: "key-down", Enabled: true}); err != nil {
+		t.Fatalf("更新 provider 失败: %v", err)
+	}
+	if err := relay.geminiService.DeleteProvider("g3"); err != nil {
+		t.Fatalf("删除 provider 失败: %v", err)
+	}
+	rec = send("/gemini/v1beta/models/gemini-2.5-pro:generateContent")
+	if rec.Code != http.StatusInternalServerError || gjson.Get(rec.Body.String(), "error.message").String() != "boom" {
+		t.Fatalf("应返回上游错误响应: code=%d body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestGeminiModelMapping(t *testing.T) {
+	setupTestEnv(t)
+
+	paths := make(chan string, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.Header.Get("x-goog-api-key") + " " + r.URL.Path
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	relay.geminiService = NewGeminiService(relay.addr)
+	for _, provider := range []GeminiProvider{
+		{ID: "g1", Name: "pro-only", BaseURL: upstream.URL, APIKey: "key-pro", Enabled: true,
+			SupportedModels: map[string]bool{"gemini-2.5-pro": true}},
+		{ID: "g2", Name: "mapper", BaseURL: upstream.URL, APIKey: "key-mapper", Enabled: true,
+			SupportedModels: map[string]bool{"gemini-2.5-flash": true},
+			ModelMapping:    map[string]string{"gemini-flash-*": "gemini-2.5-flash"}},
+	} {
+		if err := relay.geminiService.AddProvider(provider); err != nil {
+			t.Fatalf("添加 provider 失败: %v", err)
+		}
+	}
+	send := func(model string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/gemini/v1beta/models/"+model+":generateContent", strings.NewReader(`{}`)))
+		return rec
+	}
+
+	if rec := send("gemini-2.5-pro"); rec.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	if got := <-paths; got != "key-pro /v1beta/models/gemini-2.5-pro:generateContent" {
+		t.Fatalf("应由白名单匹配的 provider 处理: %s", got)
+	}
+
+	if rec := send("gemini-flash-latest"); rec.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	if got := <-paths; got != "key-mapper /v1beta/models/gemini-2.5-flash:generateContent" {
+		t.Fatalf("应按映射改写路径中的模型名: %s", got)
+	}
+	logs, err := NewLogService().ListRequestLogs("gemini", "mapper", 0)
+	if err != nil || len(logs) != 1 || logs[0].Model != "gemini-2.5-flash" {
+		t.Fatalf("请求日志应记录映射后的模型: %v, %+v", err, logs)
+	}
+
+	// 关闭请求日志后 Gemini 请求同样不写入
+	if err := relay.settingsService.SetRequestLogEnabled(false); err != nil {
+		t.Fatalf("关闭请求日志失败: %v", err)
+	}
+	if rec := send("gemini-flash-latest"); rec.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	<-paths
+	if logs, err := NewLogService().ListRequestLogs("gemini", "mapper", 0); err != nil || len(logs) != 1 {
+		t.Fatalf("关闭请求日志后不应写入新记录: %v, %d", err, len(logs))
+	}
+	if err := relay.settingsService.SetRequestLogEnabled(true); err != nil {
+		t.Fatalf("开启请求日志失败: %v", err)
+	}
+
+	rec := send("gemini-1.0-ultra")
+	if rec.Code != http.StatusNotFound || gjson.Get(rec.Body.String(), "error.reason").String() != ErrCodeModelUnsupported {
+		t.Fatalf("没有 provider 支持该模型时应返回 404: code=%d body=%s", rec.Code, rec.Body.String())
+	}
+}
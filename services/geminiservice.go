@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -35,6 +36,10 @@ type GeminiProvider struct {
 	Enabled             bool              `json:"enabled"`
 	EnvConfig           map[string]string `json:"envConfig,omitempty"`           // .env 配置
 	SettingsConfig      map[string]any    `json:"settingsConfig,omitempty"`      // settings.json 配置
+	InsecureSkipVerify  bool              `json:"insecureSkipVerify,omitempty"`  // 跳过 TLS 证书校验（不推荐）
+	SupportedModels     map[string]bool   `json:"supportedModels,omitempty"`    // 模型白名单，规则与 Claude / Codex 相同
+	ModelMapping        map[string]string `json:"modelMapping,omitempty"`       // 模型映射，转发时改写 URL 中的模型名
+	CaseSensitiveModels bool              `json:"caseSensitiveModels,omitempty"` // 模型名区分大小写（默认忽略大小写和首尾空白）
 }
 
 // GeminiPreset 预设供应商
@@ -60,12 +65,27 @@ type GeminiStatus struct {
 	Model          string         `json:"model,omitempty"`
 }
 
+// geminiSchemaVersion 当前 gemini-providers.json 的格式版本
+// 版本历史：
+//   0 - 顶层为供应商数组，无版本信息
+//   1 - 顶层为 {"schemaVersion": 1, "providers": [...]}，补齐缺失 ID
+const geminiSchemaVersion = 1
+
+// geminiProviderEnvelope gemini-providers.json 的文件结构
+type geminiProviderEnvelope struct {
+	SchemaVersion int              `json:"schemaVersion,omitempty"`
+	Providers     []GeminiProvider `json:"providers"`
+}
+
 // GeminiService Gemini 配置管理服务
 type GeminiService struct {
 	mu        sync.Mutex
 	providers []GeminiProvider
 	presets   []GeminiPreset
+	addrMu    sync.RWMutex // 保护 relayAddr（SetRelayAddr 可能与前端调用并发）
 	relayAddr string
+	// newerSchema 配置文件由更新版本的应用写入时记录其 schema 版本，此时只读，拒绝保存
+	newerSchema int
 }
 
 // NewGeminiService 创建 Gemini 服务
@@ -428,7 +448,17 @@ func writeGeminiEnv(envConfig map[string]string) error {
 		return err
 	}
 
-	// 构建 .env 内容
+	// 原子写入
+	path := getGeminiEnvPath()
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, renderGeminiEnv(envConfig), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// renderGeminiEnv 构建 .env 内容：固定键在前，其他键按字母顺序，保证输出稳定
+func renderGeminiEnv(envConfig map[string]string) []byte {
 	var lines []string
 	// 按固定顺序写入
 	keys := []string{"GOOGLE_GEMINI_BASE_URL", "GEMINI_API_KEY", "GEMINI_MODEL"}
@@ -438,26 +468,22 @@ func writeGeminiEnv(envConfig map[string]string) error {
 		}
 	}
 	// 写入其他键
+	others := make([]string, 0, len(envConfig))
 	for key, value := range envConfig {
-		if key != "GOOGLE_GEMINI_BASE_URL" && key != "GEMINI_API_KEY" && key != "GEMINI_MODEL" {
-			if value != "" {
-				lines = append(lines, fmt.Sprintf("%s=%s", key, value))
-			}
+		if key != "GOOGLE_GEMINI_BASE_URL" && key != "GEMINI_API_KEY" && key != "GEMINI_MODEL" && value != "" {
+			others = append(others, key)
 		}
 	}
+	sort.Strings(others)
+	for _, key := range others {
+		lines = append(lines, fmt.Sprintf("%s=%s", key, envConfig[key]))
+	}
 
 	content := strings.Join(lines, "\n")
 	if len(lines) > 0 {
 		content += "\n"
 	}
-
-	// 原子写入
-	path := getGeminiEnvPath()
-	tmpPath := path + ".tmp"
-	if err := os.WriteFile(tmpPath, []byte(content), 0600); err != nil {
-		return err
-	}
-	return os.Rename(tmpPath, path)
+	return []byte(content)
 }
 
 // readGeminiSettings 读取 settings.json
@@ -544,18 +570,87 @@ func (s *GeminiService) loadProviders() error {
 		return err
 	}
 
-	return json.Unmarshal(data, &s.providers)
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" {
+		s.providers = []GeminiProvider{}
+		return nil
+	}
+
+	// v0：顶层为数组
+	if strings.HasPrefix(trimmed, "[") {
+		var legacy []GeminiProvider
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return err
+		}
+		s.providers = migrateGeminiProviders(legacy, 0)
+		if err := s.saveProviders(); err != nil {
+			fmt.Printf("[Gemini] 回写迁移后的配置失败: %v\n", err)
+		} else {
+			fmt.Printf("[Gemini] 配置已从 schema v0 迁移到 v%d\n", geminiSchemaVersion)
+		}
+		return nil
+	}
+
+	var envelope geminiProviderEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return err
+	}
+	if envelope.Providers == nil {
+		envelope.Providers = []GeminiProvider{}
+	}
+	s.providers = envelope.Providers
+	s.newerSchema = 0
+	if envelope.SchemaVersion > geminiSchemaVersion {
+		s.newerSchema = envelope.SchemaVersion
+		fmt.Printf("[WARN] %v\n", newerSchemaError(path, envelope.SchemaVersion, geminiSchemaVersion))
+	}
+	if envelope.SchemaVersion < geminiSchemaVersion {
+		s.providers = migrateGeminiProviders(envelope.Providers, envelope.SchemaVersion)
+		if err := s.saveProviders(); err != nil {
+			fmt.Printf("[Gemini] 回写迁移后的配置失败: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// migrateGeminiProviders 将旧版本的 Gemini 供应商列表升级到当前 schema 版本
+func migrateGeminiProviders(providers []GeminiProvider, fromVersion int) []GeminiProvider {
+	if providers == nil {
+		return []GeminiProvider{}
+	}
+	if fromVersion < 1 {
+		seen := make(map[string]bool, len(providers))
+		for i := range providers {
+			p := &providers[i]
+			p.BaseURL = strings.TrimSpace(p.BaseURL)
+			// 旧版本可能存在空 ID 或重复 ID，导致无法编辑/删除
+			if p.ID == "" || seen[p.ID] {
+				p.ID = fmt.Sprintf("gemini-%d", i+1)
+				for seen[p.ID] {
+					p.ID += "-migrated"
+				}
+			}
+			seen[p.ID] = true
+		}
+	}
+	return providers
 }
 
 // saveProviders 保存供应商配置
 func (s *GeminiService) saveProviders() error {
 	path := getGeminiProvidersPath()
+	if s.newerSchema > geminiSchemaVersion {
+		return newerSchemaError(path, s.newerSchema, geminiSchemaVersion)
+	}
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
 
-	data, err := json.MarshalIndent(s.providers, "", "  ")
+	data, err := json.MarshalIndent(geminiProviderEnvelope{
+		SchemaVersion: geminiSchemaVersion,
+		Providers:     s.providers,
+	}, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -624,7 +719,7 @@ type GeminiProxyStatus struct {
 func (s *GeminiService) ProxyStatus() (*GeminiProxyStatus, error) {
 	status := &GeminiProxyStatus{
 		Enabled: false,
-		BaseURL: buildProxyURL(s.relayAddr),
+		BaseURL: buildProxyURL(s.proxyAddr()),
 	}
 
 	// 读取 .env 文件
@@ -639,7 +734,7 @@ func (s *GeminiService) ProxyStatus() (*GeminiProxyStatus, error) {
 
 	// 检查是否指向代理
 	baseURL := envConfig["GOOGLE_GEMINI_BASE_URL"]
-	proxyURL := buildProxyURL(s.relayAddr)
+	proxyURL := buildProxyURL(s.proxyAddr())
 	status.Enabled = strings.EqualFold(baseURL, proxyURL)
 
 	return status, nil
@@ -666,6 +761,16 @@ func (s *GeminiService) EnableProxy() error {
 		}
 	}
 
+	// 写入 .env
+	if err := writeGeminiEnv(s.proxyEnv()); err != nil {
+		return fmt.Errorf("写入 .env 失败: %w", err)
+	}
+
+	return nil
+}
+
+// proxyEnv 在现有 .env 配置基础上设置代理 URL
+func (s *GeminiService) proxyEnv() map[string]string {
 	// 读取现有配置（如果有）
 	existingEnv, _ := readGeminiEnv()
 	if existingEnv == nil {
@@ -673,14 +778,19 @@ func (s *GeminiService) EnableProxy() error {
 	}
 
 	// 设置代理 URL
-	existingEnv["GOOGLE_GEMINI_BASE_URL"] = buildProxyURL(s.relayAddr)
+	existingEnv["GOOGLE_GEMINI_BASE_URL"] = buildProxyURL(s.proxyAddr())
+	return existingEnv
+}
 
-	// 写入 .env
-	if err := writeGeminiEnv(existingEnv); err != nil {
-		return fmt.Errorf("写入 .env 失败: %w", err)
+// PreviewConfig 返回 EnableProxy 将写入的文件内容，不修改磁盘
+// kind: "env"（或空）为 ~/.gemini/.env
+func (s *GeminiService) PreviewConfig(kind string) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "", "env":
+		return renderGeminiEnv(s.proxyEnv()), nil
+	default:
+		return nil, fmt.Errorf("未知的 Gemini 配置类型: %s", kind)
 	}
-
-	return nil
 }
 
 // DisableProxy 禁用代理
@@ -756,6 +866,7 @@ func (s *GeminiService) DuplicateProvider(sourceID string) (*GeminiProvider, err
 		Description:         source.Description,
 		Category:            source.Category,
 		PartnerPromotionKey: source.PartnerPromotionKey,
+		CaseSensitiveModels: source.CaseSensitiveModels,
 		Enabled:             false, // 默认禁用，避免与源供应商冲突
 	}
 
@@ -767,6 +878,17 @@ func (s *GeminiService) DuplicateProvider(sourceID string) (*GeminiProvider, err
 		}
 	}
 
+	if source.SupportedModels != nil {
+		cloned.SupportedModels = make(map[string]bool, len(source.SupportedModels))
+		for k, v := range source.SupportedModels {
+			cloned.SupportedModels[k] = v
+		}
+	}
+
+	if source.ModelMapping != nil {
+		cloned.ModelMapping = cloneMap(source.ModelMapping)
+	}
+
 	if source.SettingsConfig != nil {
 		cloned.SettingsConfig = make(map[string]any, len(source.SettingsConfig))
 		for k, v := range source.SettingsConfig {
@@ -1,11 +1,14 @@
 package services
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
 func TestGeminiService_GetPresets(t *testing.T) {
-	svc := NewGeminiService()
+	svc := NewGeminiService(":18100")
 	presets := svc.GetPresets()
 
 	if len(presets) == 0 {
@@ -86,13 +89,13 @@ func TestDetectGeminiAuthType(t *testing.T) {
 			expected: GeminiAuthGeneric,
 		},
 		{
-			name: "Gemini API Key (native - no base URL)",
+			name: "API Key without base URL falls back to generic",
 			provider: GeminiProvider{
 				Name:    "Native Gemini",
 				BaseURL: "",
 				APIKey:  "AIza-xxx",
 			},
-			expected: GeminiAuthAPIKey,
+			expected: GeminiAuthGeneric,
 		},
 	}
 
@@ -230,7 +233,7 @@ func TestGeminiProvider_DeepCopyMaps(t *testing.T) {
 }
 
 func TestGeminiPreset_Fields(t *testing.T) {
-	svc := NewGeminiService()
+	svc := NewGeminiService(":18100")
 	presets := svc.GetPresets()
 
 	for _, p := range presets {
@@ -239,8 +242,8 @@ func TestGeminiPreset_Fields(t *testing.T) {
 			t.Error("Preset has empty name")
 		}
 
-		// All presets should have WebsiteURL
-		if p.WebsiteURL == "" {
+		// All non-custom presets should have WebsiteURL
+		if p.Category != "custom" && p.WebsiteURL == "" {
 			t.Errorf("Preset %q has empty WebsiteURL", p.Name)
 		}
 
@@ -260,3 +263,76 @@ func TestGeminiPreset_Fields(t *testing.T) {
 		}
 	}
 }
+
+func TestGeminiLoadProvidersMigratesV0(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	dir := filepath.Join(home, ".code-switch")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("failed to create config dir: %v", err)
+	}
+
+	// v0: top-level array, one provider without ID
+	legacy := `[
+  {"id": "", "name": "NoID", "baseUrl": " https://relay.example.com ", "enabled": true},
+  {"id": "gemini-1", "name": "Existing", "enabled": false}
+]`
+	path := filepath.Join(dir, "gemini-providers.json")
+	if err := os.WriteFile(path, []byte(legacy), 0o644); err != nil {
+		t.Fatalf("failed to write v0 file: %v", err)
+	}
+
+	svc := NewGeminiService(":18100")
+	providers := svc.GetProviders()
+	if len(providers) != 2 {
+		t.Fatalf("expected 2 providers, got %d", len(providers))
+	}
+	if providers[0].ID == "" || providers[0].ID == providers[1].ID {
+		t.Errorf("expected unique non-empty IDs after migration, got %q and %q", providers[0].ID, providers[1].ID)
+	}
+	if providers[0].BaseURL != "https://relay.example.com" {
+		t.Errorf("expected trimmed BaseURL, got %q", providers[0].BaseURL)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read migrated file: %v", err)
+	}
+	var envelope geminiProviderEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		t.Fatalf("migrated file should be an envelope object: %v", err)
+	}
+	if envelope.SchemaVersion != geminiSchemaVersion {
+		t.Errorf("expected schemaVersion %d, got %d", geminiSchemaVersion, envelope.SchemaVersion)
+	}
+	if len(envelope.Providers) != 2 {
+		t.Errorf("expected 2 providers in migrated file, got %d", len(envelope.Providers))
+	}
+}
+
+func TestGeminiSaveProvidersRefusesNewerSchema(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	dir := filepath.Join(home, ".code-switch")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("failed to create config dir: %v", err)
+	}
+	newer := `{"schemaVersion": 99, "providers": [{"id": "g1", "name": "Future", "enabled": false}]}`
+	path := filepath.Join(dir, "gemini-providers.json")
+	if err := os.WriteFile(path, []byte(newer), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	svc := NewGeminiService(":18100")
+	if providers := svc.GetProviders(); len(providers) != 1 || providers[0].Name != "Future" {
+		t.Fatalf("expected newer config to load read-only, got %+v", providers)
+	}
+	if err := svc.AddProvider(GeminiProvider{ID: "g2", Name: "Local"}); err == nil {
+		t.Fatal("expected save to be refused for a newer schema version")
+	}
+	if data, _ := os.ReadFile(path); string(data) != newer {
+		t.Errorf("file should be left untouched, got %s", data)
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// globalHeadersKey app_settings 中全局请求头的配置键（JSON 对象）
+const globalHeadersKey = "global_headers"
+
+// reservedGlobalHeaders 由 relay 或 HTTP 客户端维护的请求头，不允许全局覆盖
+var reservedGlobalHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+}
+
+// GetGlobalHeaders 获取注入到每个上游请求中的全局请求头
+func (ss *SettingsService) GetGlobalHeaders() (map[string]string, error) {
+	value, found, err := getSettingValue(globalHeadersKey)
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{}
+	if !found || strings.TrimSpace(value) == "" {
+		return headers, nil
+	}
+	if err := json.Unmarshal([]byte(value), &headers); err != nil {
+		return nil, fmt.Errorf("解析全局请求头失败: %w", err)
+	}
+	return headers, nil
+}
+
+// SetGlobalHeaders 保存全局请求头（例如组织要求的 X-Org-Id），传空表示清除
+// 优先级：客户端请求头 < 全局请求头 < provider 专属请求头（如 Authorization）
+func (ss *SettingsService) SetGlobalHeaders(headers map[string]string) error {
+	normalized := make(map[string]string, len(headers))
+	var invalid []string
+	for name, value := range headers {
+		name = strings.TrimSpace(name)
+		if !validHeaderName(name) || strings.ContainsAny(value, "\r\n") {
+			invalid = append(invalid, name)
+			continue
+		}
+		canonical := http.CanonicalHeaderKey(name)
+		if reservedGlobalHeaders[canonical] {
+			invalid = append(invalid, name)
+			continue
+		}
+		normalized[canonical] = strings.TrimSpace(value)
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return fmt.Errorf("无效的请求头: %s", strings.Join(invalid, ", "))
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return err
+	}
+	return setSettingValue(globalHeadersKey, string(data))
+}
+
+// loadGlobalHeaders 读取全局请求头，读取失败时仅记录警告，不阻塞转发
+func loadGlobalHeaders(ss *SettingsService) map[string]string {
+	if ss == nil {
+		return nil
+	}
+	headers, err := ss.GetGlobalHeaders()
+	if err != nil {
+		fmt.Printf("[WARN] 读取全局请求头失败: %v\n", err)
+		return nil
+	}
+	return headers
+}
+
+// applyGlobalHeaders 将全局请求头合并到转发请求头中（覆盖客户端同名请求头）
+func applyGlobalHeaders(headers map[string]string, global map[string]string) {
+	for name, value := range global {
+		for existing := range headers {
+			if strings.EqualFold(existing, name) {
+				delete(headers, existing)
+			}
+		}
+		headers[name] = value
+	}
+}
+
+// validHeaderName 校验请求头名称是否为合法的 HTTP token
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
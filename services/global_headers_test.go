@@ -0,0 +1,59 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGlobalHeadersApplied(t *testing.T) {
+	setupTestEnv(t)
+
+	received := make(chan http.Header, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "upstream", APIURL: upstream.URL, APIKey: "sk-provider", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	if err := relay.settingsService.SetGlobalHeaders(map[string]string{
+		"x-org-id":      "org-42",
+		"X-Client-Tag":  "global",
+		"Authorization": "Bearer global-should-lose",
+	}); err != nil {
+		t.Fatalf("保存全局请求头失败: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`))
+	req.Header.Set("X-Client-Tag", "client")
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	header := <-received
+	if got := header.Get("X-Org-Id"); got != "org-42" {
+		t.Errorf("X-Org-Id = %q, 期望 org-42", got)
+	}
+	if got := header.Values("X-Client-Tag"); len(got) != 1 || got[0] != "global" {
+		t.Errorf("全局请求头应覆盖客户端请求头: %v", got)
+	}
+	if got := header.Get("Authorization"); got != "Bearer sk-provider" {
+		t.Errorf("provider 认证头应优先于全局请求头: %q", got)
+	}
+
+	if err := relay.settingsService.SetGlobalHeaders(map[string]string{"Bad Header": "x"}); err == nil {
+		t.Fatalf("非法请求头名称应返回错误")
+	}
+	if err := relay.settingsService.SetGlobalHeaders(map[string]string{"Host": "x"}); err == nil {
+		t.Fatalf("保留请求头应返回错误")
+	}
+}
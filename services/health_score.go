@@ -0,0 +1,201 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+const (
+	// healthScoreWeightsKey app_settings 中健康分权重的配置键（JSON）
+	healthScoreWeightsKey = "health_score_weights"
+	// healthScoreSampleSize 计算成功率和平均延迟时参考的最近请求数
+	healthScoreSampleSize = 50
+	// healthLatencyCeiling 平均延迟达到该值时延迟得分为 0
+	healthLatencyCeiling = 30 * time.Second
+	// healthRecoveryWindow 距上次失败超过该时长后，"最近失败"得分恢复满分
+	healthRecoveryWindow = time.Hour
+)
+
+// HealthScoreWeights 健康分各项指标的权重，按比例归一化，无需相加等于 1
+//
+//	SuccessRate    最近 50 次请求的成功率（2xx 视为成功）
+//	Latency        最近成功请求的平均耗时，0 秒满分，30 秒及以上 0 分
+//	BlacklistLevel 当前拉黑等级，L0 满分，L5 为 0 分
+//	Recency        距上次失败的时间，刚失败为 0 分，1 小时后满分
+//
+// 当前处于拉黑状态的 provider 健康分固定为 0
+type HealthScoreWeights struct {
+	SuccessRate    float64 `json:"successRate"`
+	Latency        float64 `json:"latency"`
+	BlacklistLevel float64 `json:"blacklistLevel"`
+	Recency        float64 `json:"recency"`
+}
+
+// DefaultHealthScoreWeights 默认权重：成功率 50%，延迟 20%，拉黑等级 20%，最近失败 10%
+func DefaultHealthScoreWeights() HealthScoreWeights {
+	return HealthScoreWeights{
+		SuccessRate:    0.5,
+		Latency:        0.2,
+		BlacklistLevel: 0.2,
+		Recency:        0.1,
+	}
+}
+
+func (w HealthScoreWeights) total() float64 {
+	return w.SuccessRate + w.Latency + w.BlacklistLevel + w.Recency
+}
+
+// GetHealthScoreWeights 获取健康分权重（未配置时返回默认值）
+func (ss *SettingsService) GetHealthScoreWeights() (HealthScoreWeights, error) {
+	value, found, err := getSettingValue(healthScoreWeightsKey)
+	if err != nil {
+		return HealthScoreWeights{}, err
+	}
+	if !found || strings.TrimSpace(value) == "" {
+		return DefaultHealthScoreWeights(), nil
+	}
+	var weights HealthScoreWeights
+	if err := json.Unmarshal([]byte(value), &weights); err != nil {
+		return HealthScoreWeights{}, fmt.Errorf("解析健康分权重失败: %w", err)
+	}
+	return weights, nil
+}
+
+// SetHealthScoreWeights 保存健康分权重
+func (ss *SettingsService) SetHealthScoreWeights(weights HealthScoreWeights) error {
+	for _, w := range []float64{weights.SuccessRate, weights.Latency, weights.BlacklistLevel, weights.Recency} {
+		if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return fmt.Errorf("健康分权重不能为负数")
+		}
+	}
+	if weights.total() <= 0 {
+		return fmt.Errorf("健康分权重不能全部为 0")
+	}
+	data, err := json.Marshal(weights)
+	if err != nil {
+		return err
+	}
+	return setSettingValue(healthScoreWeightsKey, string(data))
+}
+
+// healthSignals 计算健康分所需的原始数据
+type healthSignals struct {
+	samples       int
+	successes     int
+	avgLatency    time.Duration
+	level         int
+	isBlacklisted bool
+	lastFailureAt *time.Time
+}
+
+// HealthScore 综合最近成功率、平均延迟、拉黑等级和距上次失败的时间计算 0-100 的健康分
+func (bs *BlacklistService) HealthScore(platform string, providerName string) (float64, error) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return 0, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	signals, err := loadHealthSignals(db, platform, providerName, bs.clock.Now())
+	if err != nil {
+		return 0, err
+	}
+	return computeHealthScore(signals, bs.healthScoreWeights(), bs.clock.Now()), nil
+}
+
+func (bs *BlacklistService) healthScoreWeights() HealthScoreWeights {
+	if bs.settingsService == nil {
+		return DefaultHealthScoreWeights()
+	}
+	weights, err := bs.settingsService.GetHealthScoreWeights()
+	if err != nil || weights.total() <= 0 {
+		return DefaultHealthScoreWeights()
+	}
+	return weights
+}
+
+func loadHealthSignals(db *sql.DB, platform string, providerName string, now time.Time) (healthSignals, error) {
+	var signals healthSignals
+
+	var successes sql.NullInt64
+	var avgLatency sql.NullFloat64
+	err := db.QueryRow(`
+		SELECT
+			COUNT(*),
+			SUM(CASE WHEN http_code >= 200 AND http_code < 300 THEN 1 ELSE 0 END),
+			AVG(CASE WHEN http_code >= 200 AND http_code < 300 THEN duration_sec END)
+		FROM (
+			SELECT http_code, duration_sec FROM request_log
+			WHERE platform = ? AND provider = ?
+			ORDER BY id DESC
+			LIMIT ?
+		)
+	`, platform, providerName, healthScoreSampleSize).Scan(&signals.samples, &successes, &avgLatency)
+	if err != nil {
+		return signals, fmt.Errorf("查询请求日志失败: %w", err)
+	}
+	signals.successes = int(successes.Int64)
+	if avgLatency.Valid {
+		signals.avgLatency = time.Duration(avgLatency.Float64 * float64(time.Second))
+	}
+
+	var blacklistedUntil, lastFailureAt sql.NullTime
+	err = db.QueryRow(`
+		SELECT blacklist_level, blacklisted_until, last_failure_at
+		FROM provider_blacklist
+		WHERE platform = ? AND provider_name = ?
+	`, platform, providerName).Scan(&signals.level, &blacklistedUntil, &lastFailureAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return signals, fmt.Errorf("查询黑名单状态失败: %w", err)
+	}
+	if blacklistedUntil.Valid && blacklistedUntil.Time.After(now) {
+		signals.isBlacklisted = true
+	}
+	if lastFailureAt.Valid {
+		signals.lastFailureAt = &lastFailureAt.Time
+	}
+	return signals, nil
+}
+
+// computeHealthScore 按权重合成健康分，没有请求记录时成功率和延迟按满分计
+func computeHealthScore(signals healthSignals, weights HealthScoreWeights, now time.Time) float64 {
+	if signals.isBlacklisted {
+		return 0
+	}
+
+	successRate := 1.0
+	if signals.samples > 0 {
+		successRate = float64(signals.successes) / float64(signals.samples)
+	}
+
+	latency := 1.0
+	if signals.avgLatency > 0 {
+		latency = clamp01(1 - float64(signals.avgLatency)/float64(healthLatencyCeiling))
+	}
+
+	level := clamp01(1 - float64(signals.level)/5)
+
+	recency := 1.0
+	if signals.lastFailureAt != nil {
+		recency = clamp01(float64(now.Sub(*signals.lastFailureAt)) / float64(healthRecoveryWindow))
+	}
+
+	total := weights.total()
+	if total <= 0 {
+		weights, total = DefaultHealthScoreWeights(), DefaultHealthScoreWeights().total()
+	}
+	score := (weights.SuccessRate*successRate +
+		weights.Latency*latency +
+		weights.BlacklistLevel*level +
+		weights.Recency*recency) / total
+	return math.Round(score*1000) / 10
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,484 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// providerBundleVersion 配置包格式版本
+	providerBundleVersion = 1
+
+	// BundleImportMerge 合并导入：保留本地配置，只添加名称不重复的条目（默认）
+	BundleImportMerge = "merge"
+	// BundleImportReplace 替换导入：配置包中包含的平台以配置包为准，本地其余条目会被删除
+	BundleImportReplace = "replace"
+
+	bundleKindMCP = "mcp"
+)
+
+// bundleKinds 配置包支持的内容，按导出/导入顺序排列
+var bundleKinds = []string{"claude", "codex", "gemini", bundleKindMCP}
+
+// providerBundle 可分享的配置包：Claude/Codex/Gemini 供应商与 MCP server
+type providerBundle struct {
+	Version    int              `json:"version"`
+	ExportedAt string           `json:"exportedAt,omitempty"`
+	Redacted   bool             `json:"redacted"`
+	Kinds      []string         `json:"kinds"` // 配置包包含的内容，替换导入只影响这些平台
+	Claude     []Provider       `json:"claude,omitempty"`
+	Codex      []Provider       `json:"codex,omitempty"`
+	Gemini     []GeminiProvider `json:"gemini,omitempty"`
+	MCP        *mcpExportBundle `json:"mcp,omitempty"`
+}
+
+// ExportBundle 导出配置包（kinds 可选 claude/codex/gemini/mcp，为空时导出全部），默认去掉 API Key 等密钥，适合直接分享
+func (is *ImportService) ExportBundle(kinds []string) ([]byte, error) {
+	return is.ExportBundleWithOptions(kinds, true)
+}
+
+// ExportBundleWithOptions 导出配置包；stripSecrets 为 true 时去掉 API Key、敏感请求头和 .env 密钥，
+// MCP server 的密钥替换为 {占位符}（与 ExportServers 一致）
+func (is *ImportService) ExportBundleWithOptions(kinds []string, stripSecrets bool) ([]byte, error) {
+	kinds, err := is.resolveBundleKinds(kinds)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := providerBundle{
+		Version:    providerBundleVersion,
+		ExportedAt: time.Now().Format(time.RFC3339),
+		Redacted:   stripSecrets,
+		Kinds:      kinds,
+	}
+	for _, kind := range kinds {
+		switch kind {
+		case "claude", "codex":
+			providers, err := is.providerService.LoadProviders(kind)
+			if err != nil {
+				return nil, fmt.Errorf("加载 %s 供应商失败: %w", kind, err)
+			}
+			exported := make([]Provider, 0, len(providers))
+			for _, p := range providers {
+				if stripSecrets {
+					p = stripProviderSecrets(p)
+				}
+				exported = append(exported, p)
+			}
+			if kind == "claude" {
+				bundle.Claude = exported
+			} else {
+				bundle.Codex = exported
+			}
+		case "gemini":
+			providers := is.geminiService.GetProviders()
+			exported := make([]GeminiProvider, 0, len(providers))
+			for _, p := range providers {
+				if stripSecrets {
+					p = stripGeminiSecrets(p)
+				}
+				exported = append(exported, p)
+			}
+			bundle.Gemini = exported
+		case bundleKindMCP:
+			data, err := is.mcpService.ExportServersWithOptions(stripSecrets)
+			if err != nil {
+				return nil, err
+			}
+			var servers mcpExportBundle
+			if err := json.Unmarshal(data, &servers); err != nil {
+				return nil, fmt.Errorf("导出 MCP server 失败: %w", err)
+			}
+			bundle.MCP = &servers
+		}
+	}
+	return json.MarshalIndent(bundle, "", "  ")
+}
+
+// ImportBundleFile 从本地文件导入配置包，mode 为 merge 或 replace
+func (is *ImportService) ImportBundleFile(path string, mode string) error {
+	data, err := os.ReadFile(strings.TrimSpace(path))
+	if err != nil {
+		return fmt.Errorf("读取配置包失败: %w", err)
+	}
+	return is.ImportBundle(data, mode)
+}
+
+// ImportBundleFromURL 下载并导入配置包（必须是 https 地址，不能指向本机或内网），mode 为 merge 或 replace
+func (is *ImportService) ImportBundleFromURL(rawURL string, mode string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), manifestFetchTimeout)
+	defer cancel()
+	data, err := is.fetchBundle(ctx, strings.TrimSpace(rawURL))
+	if err != nil {
+		return err
+	}
+	return is.ImportBundle(data, mode)
+}
+
+// ImportBundle 导入配置包：
+//   - merge：保留本地配置，名称（不区分大小写）与本地重复的条目跳过
+//   - replace：配置包中包含的平台整体替换为配置包的内容，同名条目沿用本地 ID，配置包中去掉的密钥沿用本地值
+//
+// 供应商 ID 由本地重新分配；所有条目先校验，全部通过后才写入
+func (is *ImportService) ImportBundle(data []byte, mode string) error {
+	var bundle providerBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return fmt.Errorf("解析配置包失败: %w", err)
+	}
+	if bundle.Version <= 0 || bundle.Version > providerBundleVersion {
+		return fmt.Errorf("不支持的配置包版本: %d", bundle.Version)
+	}
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		mode = BundleImportMerge
+	}
+	if mode != BundleImportMerge && mode != BundleImportReplace {
+		return fmt.Errorf("不支持的导入模式: %s（可选 merge / replace）", mode)
+	}
+	sections := bundleSections(bundle)
+	if len(sections) == 0 {
+		return fmt.Errorf("配置包中没有可导入的内容")
+	}
+	kinds, err := is.resolveBundleKinds(sections)
+	if err != nil {
+		return err
+	}
+
+	// 先计算并校验所有平台的导入结果，避免只写入一部分
+	providers := make(map[string][]Provider)
+	var gemini []GeminiProvider
+	var servers *mcpExportBundle
+	changed := make(map[string]bool)
+	var invalid []string
+	for _, kind := range kinds {
+		switch kind {
+		case "claude", "codex":
+			existing, err := is.providerService.LoadProviders(kind)
+			if err != nil {
+				return fmt.Errorf("加载 %s 供应商失败: %w", kind, err)
+			}
+			incoming := bundle.Claude
+			if kind == "codex" {
+				incoming = bundle.Codex
+			}
+			merged, added, errs := mergeBundleProviders(kind, existing, incoming, mode, bundle.Redacted)
+			providers[kind] = merged
+			changed[kind] = added > 0 || mode == BundleImportReplace
+			invalid = append(invalid, errs...)
+		case "gemini":
+			merged, added, errs := mergeBundleGemini(is.geminiService.GetProviders(), bundle.Gemini, mode)
+			gemini = merged
+			changed[kind] = added > 0 || mode == BundleImportReplace
+			invalid = append(invalid, errs...)
+		case bundleKindMCP:
+			filtered, errs, err := is.filterBundleServers(bundle.MCP, mode)
+			if err != nil {
+				return err
+			}
+			servers = filtered
+			changed[kind] = len(filtered.Servers) > 0 || mode == BundleImportReplace
+			invalid = append(invalid, errs...)
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("配置包校验失败：\n  - %s", strings.Join(invalid, "\n  - "))
+	}
+
+	for _, kind := range kinds {
+		if !changed[kind] {
+			continue
+		}
+		switch kind {
+		case "claude", "codex":
+			if err := is.providerService.SaveProviders(kind, providers[kind]); err != nil {
+				return fmt.Errorf("保存 %s 供应商失败: %w", kind, err)
+			}
+		case "gemini":
+			if err := is.geminiService.replaceProviders(gemini); err != nil {
+				return fmt.Errorf("保存 Gemini 供应商失败: %w", err)
+			}
+		case bundleKindMCP:
+			if err := is.mcpService.importServers(*servers, true, mode == BundleImportReplace); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveBundleKinds 规范化要导出/导入的内容并按固定顺序返回；为空时包含所有已初始化的平台
+func (is *ImportService) resolveBundleKinds(kinds []string) ([]string, error) {
+	available := map[string]bool{
+		"claude":      is.providerService != nil,
+		"codex":       is.providerService != nil,
+		"gemini":      is.geminiService != nil,
+		bundleKindMCP: is.mcpService != nil,
+	}
+	requested := make(map[string]bool, len(kinds))
+	for _, kind := range kinds {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		if _, known := available[kind]; !known {
+			return nil, fmt.Errorf("不支持的配置类型: %s（可选 claude / codex / gemini / mcp）", kind)
+		}
+		if !available[kind] {
+			return nil, fmt.Errorf("%s 服务未初始化", kind)
+		}
+		requested[kind] = true
+	}
+
+	resolved := make([]string, 0, len(bundleKinds))
+	for _, kind := range bundleKinds {
+		if (len(kinds) == 0 && available[kind]) || requested[kind] {
+			resolved = append(resolved, kind)
+		}
+	}
+	return resolved, nil
+}
+
+// bundleSections 配置包包含的内容；未声明 kinds 时按非空的部分推断，避免替换导入清空配置包中没有的平台
+func bundleSections(bundle providerBundle) []string {
+	if len(bundle.Kinds) > 0 {
+		return bundle.Kinds
+	}
+	var kinds []string
+	if bundle.Claude != nil {
+		kinds = append(kinds, "claude")
+	}
+	if bundle.Codex != nil {
+		kinds = append(kinds, "codex")
+	}
+	if bundle.Gemini != nil {
+		kinds = append(kinds, "gemini")
+	}
+	if bundle.MCP != nil {
+		kinds = append(kinds, bundleKindMCP)
+	}
+	return kinds
+}
+
+// mergeBundleProviders 计算导入后的 Claude/Codex 供应商列表，返回新增数量和校验错误
+func mergeBundleProviders(kind string, existing []Provider, incoming []Provider, mode string, redacted bool) ([]Provider, int, []string) {
+	local := make(map[string]Provider, len(existing))
+	for _, p := range existing {
+		local[normalizeName(p.Name)] = p
+	}
+
+	merged := make([]Provider, 0, len(existing)+len(incoming))
+	seen := make(map[string]bool, len(existing)+len(incoming))
+	if mode == BundleImportMerge {
+		merged = append(merged, existing...)
+		for name := range local {
+			seen[name] = true
+		}
+	}
+
+	nextID := nextProviderID(existing)
+	accent, tint := defaultVisual(kind)
+	added := 0
+	var errs []string
+	for _, p := range incoming {
+		p.Name = strings.TrimSpace(p.Name)
+		key := normalizeName(p.Name)
+		if key == "" {
+			errs = append(errs, fmt.Sprintf("%s: 供应商名称不能为空", kind))
+			continue
+		}
+		if seen[key] {
+			fmt.Printf("[INFO] 配置包中的 %s 供应商 %s 已存在，已跳过\n", kind, p.Name)
+			continue
+		}
+		seen[key] = true
+
+		if current, ok := local[key]; ok {
+			// 替换导入：沿用本地 ID 和名称（name 不可修改），配置包中去掉的 API Key 沿用本地值
+			p.ID = current.ID
+			p.Name = current.Name
+			if strings.TrimSpace(p.APIKey) == "" {
+				p.APIKey = current.APIKey
+			}
+		} else {
+			p.ID = nextID
+			nextID++
+			added++
+		}
+		if p.Accent == "" || p.Tint == "" {
+			p.Accent, p.Tint = accent, tint
+		}
+		if redacted && p.Enabled && strings.TrimSpace(p.APIKey) == "" {
+			// 去掉密钥的配置包：未填写 API Key 前不参与转发
+			p.Enabled = false
+		}
+		for _, msg := range p.ValidateConfiguration() {
+			errs = append(errs, fmt.Sprintf("%s/%s: %s", kind, p.Name, msg))
+		}
+		merged = append(merged, p)
+	}
+	return merged, added, errs
+}
+
+// mergeBundleGemini 计算导入后的 Gemini 供应商列表；导入的供应商默认不启用，需切换后才会写入 ~/.gemini/.env
+func mergeBundleGemini(existing []GeminiProvider, incoming []GeminiProvider, mode string) ([]GeminiProvider, int, []string) {
+	local := make(map[string]GeminiProvider, len(existing))
+	for _, p := range existing {
+		local[normalizeName(p.Name)] = p
+	}
+
+	merged := make([]GeminiProvider, 0, len(existing)+len(incoming))
+	seen := make(map[string]bool, len(existing)+len(incoming))
+	if mode == BundleImportMerge {
+		merged = append(merged, existing...)
+		for name := range local {
+			seen[name] = true
+		}
+	}
+
+	base := time.Now().UnixNano()
+	added := 0
+	var errs []string
+	for i, p := range incoming {
+		p.Name = strings.TrimSpace(p.Name)
+		key := normalizeName(p.Name)
+		if key == "" {
+			errs = append(errs, "gemini: 供应商名称不能为空")
+			continue
+		}
+		if seen[key] {
+			fmt.Printf("[INFO] 配置包中的 Gemini 供应商 %s 已存在，已跳过\n", p.Name)
+			continue
+		}
+		seen[key] = true
+
+		p.EnvConfig = cloneMap(p.EnvConfig)
+		if current, ok := local[key]; ok {
+			p.ID = current.ID
+			p.Enabled = current.Enabled
+			if strings.TrimSpace(p.APIKey) == "" {
+				p.APIKey = current.APIKey
+			}
+			for name, value := range p.EnvConfig {
+				if value == "" && current.EnvConfig[name] != "" {
+					p.EnvConfig[name] = current.EnvConfig[name]
+				}
+			}
+		} else {
+			p.ID = fmt.Sprintf("gemini-import-%d", base+int64(i))
+			p.Enabled = false
+			added++
+		}
+		if strings.TrimSpace(p.BaseURL) != "" {
+			for _, msg := range validateAPIURL(p.BaseURL) {
+				errs = append(errs, fmt.Sprintf("gemini/%s: %s", p.Name, strings.Replace(msg, "apiUrl", "baseUrl", 1)))
+			}
+		}
+		merged = append(merged, p)
+	}
+	return merged, added, errs
+}
+
+// filterBundleServers 校验配置包中的 MCP server；合并导入时去掉与本地同名的 server
+func (is *ImportService) filterBundleServers(bundle *mcpExportBundle, mode string) (*mcpExportBundle, []string, error) {
+	filtered := &mcpExportBundle{Version: mcpExportVersion, Servers: map[string]rawMCPServer{}}
+	if bundle == nil {
+		return filtered, nil, nil
+	}
+	if bundle.Version > mcpExportVersion {
+		return nil, nil, fmt.Errorf("不支持的 MCP 导入文件版本: %d", bundle.Version)
+	}
+
+	existingNames := make(map[string]bool)
+	if mode == BundleImportMerge {
+		existing, err := is.mcpService.ListServers()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, server := range existing {
+			existingNames[normalizeName(server.Name)] = true
+		}
+	}
+
+	var errs []string
+	for _, name := range sortedRawNames(bundle.Servers) {
+		entry := bundle.Servers[name]
+		if err := validateRawMCPServer(strings.TrimSpace(name), normalizeRawEntry(entry)); err != nil {
+			errs = append(errs, fmt.Sprintf("mcp: %v", err))
+			continue
+		}
+		if existingNames[normalizeName(name)] {
+			fmt.Printf("[INFO] 配置包中的 MCP server %s 已存在，已跳过\n", name)
+			continue
+		}
+		filtered.Servers[name] = entry
+	}
+	return filtered, errs, nil
+}
+
+// stripProviderSecrets 去掉 API Key 和敏感的自定义请求头
+func stripProviderSecrets(p Provider) Provider {
+	p.APIKey = ""
+	p.Headers = stripSecretValues(p.Headers)
+	return p
+}
+
+// stripGeminiSecrets 去掉 API Key 和 .env 中的密钥
+func stripGeminiSecrets(p GeminiProvider) GeminiProvider {
+	p.APIKey = ""
+	p.EnvConfig = stripSecretValues(p.EnvConfig)
+	return p
+}
+
+// stripSecretValues 清空键名看起来是密钥的值（占位符保留），返回新的 map
+func stripSecretValues(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	stripped := make(map[string]string, len(values))
+	for key, value := range values {
+		if isSecretKey(key) && !placeholderPattern.MatchString(value) {
+			value = ""
+		}
+		stripped[key] = value
+	}
+	return stripped
+}
+
+// replaceProviders 整体替换 Gemini 供应商列表并保存
+func (s *GeminiService) replaceProviders(providers []GeminiProvider) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.providers = providers
+	return s.saveProviders()
+}
+
+// fetchProviderBundle 下载配置包（与团队清单相同的地址限制），最大 1MB
+func fetchProviderBundle(ctx context.Context, rawURL string) ([]byte, error) {
+	if err := validateManifestURL(rawURL); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := manifestHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("下载配置包失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载配置包失败: HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取配置包失败: %w", err)
+	}
+	if len(data) > maxManifestSize {
+		return nil, fmt.Errorf("配置包超过 1MB")
+	}
+	return data, nil
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExportImportBundle(t *testing.T) {
+	setupTestEnv(t)
+	ps := NewProviderService()
+	ms := NewMCPService()
+	gs := NewGeminiService(":18100")
+	is := NewImportService(ps, ms, gs)
+
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "relay", APIURL: "https://relay.example.com", APIKey: "sk-relay", Enabled: true, Level: 1,
+			Headers: map[string]string{"X-Team-Token": "tok-team", "X-Region": "us"}},
+		{ID: 2, Name: "backup", APIURL: "https://backup.example.com", APIKey: "sk-backup", Enabled: true, Level: 2},
+	}); err != nil {
+		t.Fatalf("保存 claude 供应商失败: %v", err)
+	}
+	if err := gs.AddProvider(GeminiProvider{ID: "g1", Name: "gemini-relay", BaseURL: "https://gemini.example.com", APIKey: "sk-gemini", Enabled: true,
+		EnvConfig: map[string]string{"GEMINI_API_KEY": "sk-gemini", "GEMINI_MODEL": "gemini-2.5-pro"}}); err != nil {
+		t.Fatalf("保存 Gemini 供应商失败: %v", err)
+	}
+	if err := ms.SaveServers([]MCPServer{{Name: "search", Type: "http", URL: "https://example.com/mcp", EnablePlatform: []string{platClaudeCode}}}); err != nil {
+		t.Fatalf("保存 MCP server 失败: %v", err)
+	}
+
+	data, err := is.ExportBundle(nil)
+	if err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+	for _, secret := range []string{"sk-relay", "sk-backup", "sk-gemini", "tok-team"} {
+		if strings.Contains(string(data), secret) {
+			t.Fatalf("默认导出不应包含密钥 %s: %s", secret, data)
+		}
+	}
+	var bundle providerBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatalf("导出内容不是有效 JSON: %v", err)
+	}
+	if strings.Join(bundle.Kinds, ",") != "claude,codex,gemini,mcp" || len(bundle.Claude) != 2 || len(bundle.Gemini) != 1 || bundle.MCP == nil {
+		t.Fatalf("导出内容不完整: %+v", bundle)
+	}
+	if bundle.Claude[0].Headers["X-Region"] != "us" {
+		t.Fatalf("非敏感请求头应保留: %+v", bundle.Claude[0].Headers)
+	}
+	full, err := is.ExportBundleWithOptions([]string{"claude"}, false)
+	if err != nil || !strings.Contains(string(full), "sk-relay") || strings.Contains(string(full), "gemini-relay") {
+		t.Fatalf("保留密钥且只导出 claude: %s, %v", full, err)
+	}
+
+	// 在另一台机器上合并导入：同名条目跳过，ID 重新分配，去掉密钥的供应商导入后不启用
+	setupTestEnv(t)
+	ps = NewProviderService()
+	gs = NewGeminiService(":18100")
+	is = NewImportService(ps, NewMCPService(), gs)
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "local", APIURL: "https://local.example.com", APIKey: "sk-local", Enabled: true, Level: 1},
+		{ID: 2, Name: "Relay", APIURL: "https://old-relay.example.com", APIKey: "sk-old", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 claude 供应商失败: %v", err)
+	}
+	if err := is.ImportBundle(data, BundleImportMerge); err != nil {
+		t.Fatalf("合并导入失败: %v", err)
+	}
+	providers, _ := ps.LoadProviders("claude")
+	if len(providers) != 3 || providers[2].Name != "backup" || providers[2].ID != 3 || providers[2].Enabled {
+		t.Fatalf("合并导入结果不正确: %+v", providers)
+	}
+	if providers[1].APIURL != "https://old-relay.example.com" {
+		t.Fatalf("合并导入不应覆盖同名供应商: %+v", providers[1])
+	}
+	if got := gs.GetProviders(); len(got) != 1 || got[0].Name != "gemini-relay" || got[0].Enabled || got[0].ID == "g1" {
+		t.Fatalf("Gemini 供应商应以新 ID 导入且不启用: %+v", got)
+	}
+	servers, _ := NewMCPService().ListServers()
+	imported := false
+	for _, server := range servers {
+		imported = imported || (server.Name == "search" && server.URL == "https://example.com/mcp")
+	}
+	if !imported {
+		t.Fatalf("MCP server 应被导入: %+v", servers)
+	}
+
+	// 替换导入：只保留配置包中的供应商，同名供应商沿用本地 ID、名称和 API Key
+	if err := is.ImportBundle(data, BundleImportReplace); err != nil {
+		t.Fatalf("替换导入失败: %v", err)
+	}
+	providers, _ = ps.LoadProviders("claude")
+	if len(providers) != 2 || providers[0].ID != 2 || providers[0].Name != "Relay" || providers[0].APIKey != "sk-old" ||
+		providers[0].APIURL != "https://relay.example.com" || !providers[0].Enabled {
+		t.Fatalf("替换导入结果不正确: %+v", providers)
+	}
+	if providers[1].Name != "backup" || providers[1].ID != 3 {
+		t.Fatalf("backup 应沿用合并导入时的 ID: %+v", providers[1])
+	}
+}
+
+func TestImportBundleValidation(t *testing.T) {
+	setupTestEnv(t)
+	ps := NewProviderService()
+	is := NewImportService(ps, NewMCPService(), nil)
+	if err := ps.SaveProviders("claude", []Provider{{ID: 1, Name: "local", APIURL: "https://local.example.com", Level: 1}}); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+
+	invalid := `{"version":1,"kinds":["claude","codex"],
+		"claude":[{"name":"ok","apiUrl":"https://ok.example.com"}],
+		"codex":[{"name":"broken","apiUrl":"relay.example.com"}]}`
+	if err := is.ImportBundle([]byte(invalid), BundleImportMerge); err == nil || !strings.Contains(err.Error(), "codex/broken") {
+		t.Fatalf("无效供应商应拒绝导入, err = %v", err)
+	}
+	if providers, _ := ps.LoadProviders("claude"); len(providers) != 1 {
+		t.Fatalf("校验失败时不应写入任何平台: %+v", providers)
+	}
+
+	for _, tc := range []struct{ data, mode, want string }{
+		{`{"version":1,"claude":[]}`, "overwrite", "不支持的导入模式"},
+		{`{"version":9,"claude":[]}`, BundleImportMerge, "不支持的配置包版本"},
+		{`{"version":1}`, BundleImportMerge, "没有可导入的内容"},
+		{`{"version":1,"kinds":["gemini"]}`, BundleImportMerge, "gemini 服务未初始化"},
+	} {
+		if err := is.ImportBundle([]byte(tc.data), tc.mode); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("ImportBundle(%s, %s) err = %v, 期望包含 %q", tc.data, tc.mode, err, tc.want)
+		}
+	}
+
+	// 远程导入：未声明 kinds 时只替换配置包中出现的平台
+	var fetched string
+	is.fetchBundle = func(ctx context.Context, rawURL string) ([]byte, error) {
+		fetched = rawURL
+		return []byte(`{"version":1,"codex":[{"name":"remote","apiUrl":"https://remote.example.com","apiKey":"sk-remote"}]}`), nil
+	}
+	if err := is.ImportBundleFromURL(" https://team.example.com/bundle.json ", BundleImportReplace); err != nil {
+		t.Fatalf("远程导入失败: %v", err)
+	}
+	if fetched != "https://team.example.com/bundle.json" {
+		t.Fatalf("下载地址 = %q", fetched)
+	}
+	codex, _ := ps.LoadProviders("codex")
+	claude, _ := ps.LoadProviders("claude")
+	if len(codex) != 1 || codex[0].Name != "remote" || len(claude) != 1 {
+		t.Fatalf("远程导入结果不正确: codex=%+v claude=%+v", codex, claude)
+	}
+
+	is.fetchBundle = func(ctx context.Context, rawURL string) ([]byte, error) {
+		return nil, fmt.Errorf("下载配置包失败: HTTP 404")
+	}
+	if err := is.ImportBundleFromURL("https://team.example.com/missing.json", BundleImportMerge); err == nil {
+		t.Fatalf("下载失败时应返回错误")
+	}
+	if _, err := fetchProviderBundle(context.Background(), "http://127.0.0.1/bundle.json"); err == nil {
+		t.Fatalf("应拒绝非 https 或内网地址")
+	}
+}
@@ -0,0 +1,388 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	externalFormatClaudeCodeRouter = "claude-code-router"
+	externalFormatOneAPI           = "one-api"
+
+	// oneAPIChannelTypeAnthropic one-api 中 Anthropic Claude 渠道的 type 值
+	oneAPIChannelTypeAnthropic = 14
+	// oneAPIChannelStatusEnabled one-api 中渠道启用状态
+	oneAPIChannelStatusEnabled = 1
+)
+
+// ExternalImportResult 从其它代理工具导入供应商的结果
+type ExternalImportResult struct {
+	Format   string         `json:"format"`   // 识别出的配置格式
+	Imported map[string]int `json:"imported"` // 各平台导入数量
+	Skipped  []string       `json:"skipped"`  // 已存在或信息不全而跳过的条目
+	Unmapped []string       `json:"unmapped"` // 无法映射到 Provider 的字段
+}
+
+// externalProvider 解析出的待导入供应商
+type externalProvider struct {
+	Platform string
+	Provider Provider
+}
+
+// ccrConfig claude-code-router 的 config.json（新版为 Providers/Router，旧版为小写 providers）
+type ccrConfig struct {
+	Providers      []map[string]json.RawMessage `json:"Providers"`
+	LegacyProvider []map[string]json.RawMessage `json:"providers"`
+	Router         map[string]json.RawMessage   `json:"Router"`
+}
+
+// ccrProviderKnownFields 已映射的 claude-code-router provider 字段
+var ccrProviderKnownFields = map[string]bool{"name": true, "api_base_url": true, "api_key": true, "models": true}
+
+// oneAPIChannelKnownFields 已映射（或无需映射）的 one-api 渠道字段
+var oneAPIChannelKnownFields = map[string]bool{
+	"id": true, "type": true, "key": true, "name": true, "base_url": true, "models": true,
+	"model_mapping": true, "priority": true, "status": true, "created_time": true,
+	"test_time": true, "response_time": true, "used_quota": true, "balance": true, "balance_updated_time": true,
+}
+
+// endpointSuffixes 外部工具中常见的完整端点后缀，导入时去掉以得到 base URL
+var endpointSuffixes = []string{"/v1/chat/completions", "/chat/completions", "/v1/messages"}
+
+// ImportExternalConfigFile 从其它代理工具（claude-code-router、one-api 等）的配置文件导入供应商
+// 根据文件结构自动识别格式；与已有供应商 URL 或名称重复的条目会被跳过
+func (is *ImportService) ImportExternalConfigFile(path string) (*ExternalImportResult, error) {
+	data, err := os.ReadFile(strings.TrimSpace(path))
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	return is.ImportExternalConfig(data)
+}
+
+// ImportExternalConfig 从其它代理工具的配置内容导入供应商
+func (is *ImportService) ImportExternalConfig(data []byte) (*ExternalImportResult, error) {
+	format, err := detectExternalFormat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExternalImportResult{Format: format, Imported: map[string]int{}}
+	var parsed []externalProvider
+	switch format {
+	case externalFormatClaudeCodeRouter:
+		parsed, err = parseClaudeCodeRouterConfig(data, result)
+	case externalFormatOneAPI:
+		parsed, err = parseOneAPIChannels(data, result)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	byPlatform := make(map[string][]Provider)
+	for _, item := range parsed {
+		byPlatform[item.Platform] = append(byPlatform[item.Platform], item.Provider)
+	}
+	for _, platform := range []string{"claude", "codex"} {
+		candidates := byPlatform[platform]
+		if len(candidates) == 0 {
+			continue
+		}
+		added, err := is.mergeExternalProviders(platform, candidates, result)
+		if err != nil {
+			return nil, err
+		}
+		result.Imported[platform] = added
+	}
+	sort.Strings(result.Unmapped)
+	return result, nil
+}
+
+// mergeExternalProviders 去重后追加到对应平台的供应商列表
+func (is *ImportService) mergeExternalProviders(platform string, candidates []Provider, result *ExternalImportResult) (int, error) {
+	existing, err := is.providerService.LoadProviders(platform)
+	if err != nil {
+		return 0, err
+	}
+	existingURL := make(map[string]bool, len(existing))
+	existingNames := make(map[string]bool, len(existing))
+	for _, provider := range existing {
+		existingURL[normalizeURL(provider.APIURL)] = true
+		existingNames[normalizeName(provider.Name)] = true
+	}
+
+	nextID := nextProviderID(existing)
+	accent, tint := defaultVisual(platform)
+	merged := existing
+	added := 0
+	for _, candidate := range candidates {
+		if existingURL[normalizeURL(candidate.APIURL)] || existingNames[normalizeName(candidate.Name)] {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s/%s: 已存在", platform, candidate.Name))
+			continue
+		}
+		existingURL[normalizeURL(candidate.APIURL)] = true
+		existingNames[normalizeName(candidate.Name)] = true
+
+		candidate.ID = nextID
+		candidate.Accent = accent
+		candidate.Tint = tint
+		merged = append(merged, candidate)
+		nextID++
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	if err := is.providerService.SaveProviders(platform, merged); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// detectExternalFormat 根据文件结构识别外部配置格式
+func detectExternalFormat(data []byte) (string, error) {
+	var probe any
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return "", fmt.Errorf("解析配置文件失败: %w", err)
+	}
+
+	switch value := probe.(type) {
+	case map[string]any:
+		for _, key := range []string{"Providers", "providers"} {
+			if items, ok := value[key].([]any); ok && itemsHaveField(items, "api_base_url") {
+				return externalFormatClaudeCodeRouter, nil
+			}
+		}
+		if items, ok := value["data"].([]any); ok && itemsHaveField(items, "base_url") && itemsHaveField(items, "key") {
+			return externalFormatOneAPI, nil
+		}
+	case []any:
+		if itemsHaveField(value, "base_url") && itemsHaveField(value, "key") {
+			return externalFormatOneAPI, nil
+		}
+	}
+	return "", fmt.Errorf("无法识别的配置格式（支持 claude-code-router config.json、one-api 渠道导出）")
+}
+
+func itemsHaveField(items []any, field string) bool {
+	for _, item := range items {
+		if entry, ok := item.(map[string]any); ok {
+			if _, exists := entry[field]; exists {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseClaudeCodeRouterConfig 解析 claude-code-router 配置
+// Router.default（"provider,model"）指向的供应商放在 Level 1 并将所有模型映射到该模型，其余供应商放在 Level 2
+func parseClaudeCodeRouterConfig(data []byte, result *ExternalImportResult) ([]externalProvider, error) {
+	var cfg ccrConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("解析 claude-code-router 配置失败: %w", err)
+	}
+	entries := cfg.Providers
+	if len(entries) == 0 {
+		entries = cfg.LegacyProvider
+	}
+
+	defaultProvider, defaultModel := "", ""
+	routeKeys := make([]string, 0, len(cfg.Router))
+	for key := range cfg.Router {
+		routeKeys = append(routeKeys, key)
+	}
+	sort.Strings(routeKeys)
+	for _, key := range routeKeys {
+		if key == "default" {
+			var route string
+			if err := json.Unmarshal(cfg.Router[key], &route); err == nil {
+				defaultProvider, defaultModel, _ = strings.Cut(route, ",")
+				defaultProvider = strings.TrimSpace(defaultProvider)
+				defaultModel = strings.TrimSpace(defaultModel)
+			}
+			continue
+		}
+		result.Unmapped = append(result.Unmapped, "Router."+key)
+	}
+
+	var parsed []externalProvider
+	for i, entry := range entries {
+		name := rawString(entry["name"])
+		baseURL := trimEndpointSuffix(rawString(entry["api_base_url"]))
+		apiKey := rawString(entry["api_key"])
+		label := name
+		if label == "" {
+			label = fmt.Sprintf("Providers[%d]", i)
+		}
+		if name == "" || baseURL == "" || apiKey == "" {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: 缺少 name/api_base_url/api_key", label))
+			continue
+		}
+		collectUnmappedFields(result, label, entry, ccrProviderKnownFields)
+
+		provider := Provider{
+			Name:    name,
+			APIURL:  baseURL,
+			APIKey:  apiKey,
+			Site:    inferHomepage(baseURL, baseURL),
+			Enabled: true,
+			Level:   2,
+		}
+		var models []string
+		if raw, ok := entry["models"]; ok {
+			_ = json.Unmarshal(raw, &models)
+		}
+		provider.SupportedModels = modelSet(models)
+
+		if strings.EqualFold(name, defaultProvider) {
+			provider.Level = 1
+			if defaultModel != "" {
+				provider.ModelMapping = map[string]string{"*": defaultModel}
+				if provider.SupportedModels == nil {
+					provider.SupportedModels = map[string]bool{}
+				}
+				provider.SupportedModels[defaultModel] = true
+			}
+		}
+		parsed = append(parsed, externalProvider{Platform: "claude", Provider: provider})
+	}
+	return parsed, nil
+}
+
+// parseOneAPIChannels 解析 one-api 渠道列表（/api/channel 响应或渠道数组）
+// Anthropic 渠道导入到 claude，其余导入到 codex；priority 越大越优先，按降序映射为 Level 1..n
+func parseOneAPIChannels(data []byte, result *ExternalImportResult) ([]externalProvider, error) {
+	var channels []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &channels); err != nil {
+		var wrapped struct {
+			Data []map[string]json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return nil, fmt.Errorf("解析 one-api 渠道失败: %w", err)
+		}
+		channels = wrapped.Data
+	}
+
+	priorities := make(map[int64]bool)
+	for _, channel := range channels {
+		priorities[rawInt(channel["priority"])] = true
+	}
+	ordered := make([]int64, 0, len(priorities))
+	for priority := range priorities {
+		ordered = append(ordered, priority)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i] > ordered[j] })
+	levels := make(map[int64]int, len(ordered))
+	for i, priority := range ordered {
+		levels[priority] = i + 1
+	}
+
+	var parsed []externalProvider
+	for i, channel := range channels {
+		name := rawString(channel["name"])
+		baseURL := trimEndpointSuffix(rawString(channel["base_url"]))
+		apiKey := rawString(channel["key"])
+		label := name
+		if label == "" {
+			label = fmt.Sprintf("channel[%d]", i)
+		}
+		if name == "" || baseURL == "" || apiKey == "" {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: 缺少 name/base_url/key", label))
+			continue
+		}
+		collectUnmappedFields(result, label, channel, oneAPIChannelKnownFields)
+
+		// one-api 的 key 字段可能是多行（每行一个 key），只取第一个
+		apiKey, rest, _ := strings.Cut(apiKey, "\n")
+		if strings.TrimSpace(rest) != "" {
+			result.Unmapped = append(result.Unmapped, label+".key(多个 key 仅导入第一个)")
+		}
+
+		platform := "codex"
+		if rawInt(channel["type"]) == oneAPIChannelTypeAnthropic {
+			platform = "claude"
+		}
+		provider := Provider{
+			Name:            name,
+			APIURL:          baseURL,
+			APIKey:          strings.TrimSpace(apiKey),
+			Site:            inferHomepage(baseURL, baseURL),
+			Enabled:         rawInt(channel["status"]) == oneAPIChannelStatusEnabled,
+			Level:           levels[rawInt(channel["priority"])],
+			SupportedModels: modelSet(strings.Split(rawString(channel["models"]), ",")),
+		}
+		if mapping := rawString(channel["model_mapping"]); mapping != "" {
+			if err := json.Unmarshal([]byte(mapping), &provider.ModelMapping); err != nil {
+				result.Unmapped = append(result.Unmapped, label+".model_mapping(格式无效)")
+			}
+		}
+		parsed = append(parsed, externalProvider{Platform: platform, Provider: provider})
+	}
+	return parsed, nil
+}
+
+// collectUnmappedFields 记录条目中未映射的非空字段
+func collectUnmappedFields(result *ExternalImportResult, label string, entry map[string]json.RawMessage, known map[string]bool) {
+	for key, raw := range entry {
+		if known[key] {
+			continue
+		}
+		value := strings.TrimSpace(string(raw))
+		if value == "" || value == "null" || value == `""` || value == "0" || value == "{}" || value == "[]" || value == "false" {
+			continue
+		}
+		result.Unmapped = append(result.Unmapped, label+"."+key)
+	}
+}
+
+// rawString 读取字符串字段（兼容数字）
+func rawString(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return strings.TrimSpace(value)
+	}
+	var number json.Number
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return number.String()
+	}
+	return ""
+}
+
+// rawInt 读取整数字段（兼容字符串形式）
+func rawInt(raw json.RawMessage) int64 {
+	value, err := strconv.ParseInt(rawString(raw), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+func modelSet(models []string) map[string]bool {
+	set := make(map[string]bool, len(models))
+	for _, model := range models {
+		if model = strings.TrimSpace(model); model != "" {
+			set[model] = true
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	return set
+}
+
+func trimEndpointSuffix(raw string) string {
+	trimmed := strings.TrimRight(strings.TrimSpace(raw), "/")
+	for _, suffix := range endpointSuffixes {
+		if strings.HasSuffix(trimmed, suffix) {
+			return strings.TrimSuffix(trimmed, suffix)
+		}
+	}
+	return trimmed
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportClaudeCodeRouterConfig(t *testing.T) {
+	setupTestEnv(t)
+	ps := NewProviderService()
+	is := NewImportService(ps, NewMCPService(), nil)
+
+	data, err := os.ReadFile(filepath.Join("testdata", "claude-code-router-config.json"))
+	if err != nil {
+		t.Fatalf("读取 fixture 失败: %v", err)
+	}
+	result, err := is.ImportExternalConfig(data)
+	if err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+	if result.Format != externalFormatClaudeCodeRouter {
+		t.Fatalf("格式 = %s", result.Format)
+	}
+	if result.Imported["claude"] != 2 || len(result.Skipped) != 1 {
+		t.Fatalf("导入 %v, 跳过 %v", result.Imported, result.Skipped)
+	}
+	for _, field := range []string{"Router.background", "Router.think", "openrouter.transformer"} {
+		if !hasItem(result.Unmapped, field) {
+			t.Errorf("未映射字段应包含 %s: %v", field, result.Unmapped)
+		}
+	}
+
+	providers, err := ps.LoadProviders("claude")
+	if err != nil || len(providers) != 2 {
+		t.Fatalf("claude providers = %+v, %v", providers, err)
+	}
+	openrouter := providers[0]
+	if openrouter.Name != "openrouter" || openrouter.APIURL != "https://openrouter.ai/api" || openrouter.Level != 1 {
+		t.Fatalf("openrouter 映射不正确: %+v", openrouter)
+	}
+	if got := openrouter.GetEffectiveModel("claude-sonnet-4-5"); got != "anthropic/claude-sonnet-4" {
+		t.Fatalf("默认路由模型映射 = %s", got)
+	}
+	if providers[1].Level != 2 || providers[1].APIURL != "https://api.deepseek.com" {
+		t.Fatalf("deepseek 映射不正确: %+v", providers[1])
+	}
+
+	// 再次导入时全部视为已存在
+	again, err := is.ImportExternalConfig(data)
+	if err != nil {
+		t.Fatalf("重复导入失败: %v", err)
+	}
+	if again.Imported["claude"] != 0 {
+		t.Fatalf("重复导入不应新增: %v", again.Imported)
+	}
+}
+
+func TestImportOneAPIChannels(t *testing.T) {
+	setupTestEnv(t)
+	ps := NewProviderService()
+	is := NewImportService(ps, NewMCPService(), nil)
+
+	result, err := is.ImportExternalConfigFile(filepath.Join("testdata", "one-api-channels.json"))
+	if err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+	if result.Format != externalFormatOneAPI || result.Imported["claude"] != 1 || result.Imported["codex"] != 1 {
+		t.Fatalf("导入结果不符合预期: %+v", result)
+	}
+
+	claude, _ := ps.LoadProviders("claude")
+	if len(claude) != 1 || claude[0].Level != 1 || !claude[0].Enabled ||
+		claude[0].GetEffectiveModel("claude-3-haiku") != "claude-3-5-haiku-20241022" {
+		t.Fatalf("claude 渠道映射不正确: %+v", claude)
+	}
+	codex, _ := ps.LoadProviders("codex")
+	if len(codex) != 1 || codex[0].Level != 2 || codex[0].Enabled || codex[0].APIKey != "sk-openai-a" {
+		t.Fatalf("codex 渠道映射不正确: %+v", codex)
+	}
+	if !hasItem(result.Unmapped, "Claude 主渠道.group") {
+		t.Fatalf("未映射字段应包含 group: %v", result.Unmapped)
+	}
+
+	if _, err := is.ImportExternalConfig([]byte(`{"foo": 1}`)); err == nil {
+		t.Fatalf("未知格式应返回错误")
+	}
+}
+
+func hasItem(items []string, target string) bool {
+	for _, item := range items {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
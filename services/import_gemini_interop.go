@@ -0,0 +1,191 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ProviderInteropResult Gemini 与 Claude/Codex 供应商互相复制的结果
+type ProviderInteropResult struct {
+	Copied  int      `json:"copied"`
+	Skipped []string `json:"skipped"`
+}
+
+// CopyGeminiProvidersTo 将 Gemini 供应商复制为指定平台（claude/codex）的供应商
+// 仅复制使用 API Key 的供应商；OAuth（Google 官方登录）没有可复用的 URL/Key，会被跳过
+func (is *ImportService) CopyGeminiProvidersTo(kind string) (*ProviderInteropResult, error) {
+	if is.geminiService == nil {
+		return nil, fmt.Errorf("Gemini 服务未初始化")
+	}
+	existing, err := is.providerService.LoadProviders(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ProviderInteropResult{Skipped: []string{}}
+	seen := interopSeen(existing)
+	nextID := nextProviderID(existing)
+	accent, tint := defaultVisual(kind)
+	merged := existing
+	for _, gemini := range is.geminiService.GetProviders() {
+		provider, ok := geminiToProvider(gemini)
+		if !ok {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: 未配置 Base URL 或 API Key（OAuth 供应商无法复用）", gemini.Name))
+			continue
+		}
+		if seen.has(provider.Name, provider.APIURL) {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: 已存在", gemini.Name))
+			continue
+		}
+		seen.add(provider.Name, provider.APIURL)
+
+		provider.ID = nextID
+		provider.Accent = accent
+		provider.Tint = tint
+		merged = append(merged, provider)
+		nextID++
+		result.Copied++
+	}
+
+	if result.Copied > 0 {
+		if err := is.providerService.SaveProviders(kind, merged); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// CopyProvidersToGemini 将指定平台（claude/codex）的供应商复制为 Gemini 供应商
+// 复制出的 Gemini 供应商默认不启用，需在 Gemini 页面切换后才会写入 ~/.gemini/.env
+func (is *ImportService) CopyProvidersToGemini(kind string) (*ProviderInteropResult, error) {
+	if is.geminiService == nil {
+		return nil, fmt.Errorf("Gemini 服务未初始化")
+	}
+	providers, err := is.providerService.LoadProviders(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := is.geminiService.GetProviders()
+	seen := interopSeen(nil)
+	for _, gemini := range existing {
+		seen.add(gemini.Name, geminiBaseURL(gemini))
+	}
+
+	result := &ProviderInteropResult{Skipped: []string{}}
+	base := time.Now().UnixNano()
+	for i, provider := range providers {
+		if strings.TrimSpace(provider.APIURL) == "" || strings.TrimSpace(provider.APIKey) == "" {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: 未配置 API URL 或 API Key", provider.Name))
+			continue
+		}
+		if seen.has(provider.Name, provider.APIURL) {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: 已存在", provider.Name))
+			continue
+		}
+		seen.add(provider.Name, provider.APIURL)
+
+		gemini := providerToGemini(provider)
+		gemini.ID = fmt.Sprintf("gemini-%s-%d", kind, base+int64(i))
+		if err := is.geminiService.AddProvider(gemini); err != nil {
+			return nil, fmt.Errorf("添加 Gemini 供应商 %s 失败: %w", provider.Name, err)
+		}
+		result.Copied++
+	}
+	return result, nil
+}
+
+// geminiToProvider 将 Gemini 供应商转换为 Claude/Codex 供应商
+// Gemini 的 URL/Key 可能只存在于 EnvConfig（.env 配置）中，转换时优先使用显式字段
+// 配置了模型时，映射所有请求模型到该模型（CLI 发出的 claude/gpt 模型名在 Gemini 中转上无效）
+func geminiToProvider(gemini GeminiProvider) (Provider, bool) {
+	apiURL := geminiBaseURL(gemini)
+	apiKey := pickFirstNonEmpty(gemini.APIKey, gemini.EnvConfig["GEMINI_API_KEY"])
+	if apiURL == "" || apiKey == "" {
+		return Provider{}, false
+	}
+
+	provider := Provider{
+		Name:               strings.TrimSpace(gemini.Name),
+		APIURL:             apiURL,
+		APIKey:             apiKey,
+		Site:               gemini.WebsiteURL,
+		Note:               gemini.Description,
+		Enabled:            gemini.Enabled,
+		Level:              1,
+		InsecureSkipVerify: gemini.InsecureSkipVerify,
+	}
+	if model := pickFirstNonEmpty(gemini.Model, gemini.EnvConfig["GEMINI_MODEL"]); model != "" {
+		provider.SupportedModels = map[string]bool{model: true}
+		provider.ModelMapping = map[string]string{"*": model}
+	}
+	return provider, true
+}
+
+// providerToGemini 将 Claude/Codex 供应商转换为 Gemini 供应商（同时写入 EnvConfig，与 SwitchProvider 的 .env 写法一致）
+func providerToGemini(provider Provider) GeminiProvider {
+	gemini := GeminiProvider{
+		Name:               strings.TrimSpace(provider.Name),
+		WebsiteURL:         provider.Site,
+		BaseURL:            strings.TrimSpace(provider.APIURL),
+		APIKey:             strings.TrimSpace(provider.APIKey),
+		Model:              interopModel(provider),
+		Description:        provider.Note,
+		Category:           "third_party",
+		Enabled:            false,
+		InsecureSkipVerify: provider.InsecureSkipVerify,
+		EnvConfig: map[string]string{
+			"GOOGLE_GEMINI_BASE_URL": strings.TrimSpace(provider.APIURL),
+			"GEMINI_API_KEY":         strings.TrimSpace(provider.APIKey),
+		},
+	}
+	if gemini.Model != "" {
+		gemini.EnvConfig["GEMINI_MODEL"] = gemini.Model
+	}
+	return gemini
+}
+
+// interopModel 推断 Gemini 使用的模型：优先取通配映射的目标，其次取唯一的白名单模型
+func interopModel(provider Provider) string {
+	if model := strings.TrimSpace(provider.ModelMapping["*"]); model != "" && !strings.Contains(model, "*") {
+		return model
+	}
+	if len(provider.SupportedModels) == 1 {
+		for model := range provider.SupportedModels {
+			if !strings.Contains(model, "*") {
+				return model
+			}
+		}
+	}
+	return ""
+}
+
+func geminiBaseURL(gemini GeminiProvider) string {
+	return pickFirstNonEmpty(gemini.BaseURL, gemini.EnvConfig["GOOGLE_GEMINI_BASE_URL"])
+}
+
+// interopIndex 按名称和 URL 去重
+type interopIndex struct {
+	names map[string]bool
+	urls  map[string]bool
+}
+
+func interopSeen(providers []Provider) *interopIndex {
+	index := &interopIndex{names: map[string]bool{}, urls: map[string]bool{}}
+	for _, provider := range providers {
+		index.add(provider.Name, provider.APIURL)
+	}
+	return index
+}
+
+func (i *interopIndex) add(name string, url string) {
+	i.names[normalizeName(name)] = true
+	if url = normalizeURL(url); url != "" {
+		i.urls[url] = true
+	}
+}
+
+func (i *interopIndex) has(name string, url string) bool {
+	return i.names[normalizeName(name)] || (normalizeURL(url) != "" && i.urls[normalizeURL(url)])
+}
@@ -0,0 +1,110 @@
+package services
+
+import "testing"
+
+func TestGeminiToProviderMapping(t *testing.T) {
+	// URL/Key 只存在于 .env 配置中
+	provider, ok := geminiToProvider(GeminiProvider{
+		Name:        "PackyCode",
+		WebsiteURL:  "https://www.packyapi.com",
+		Description: "中转",
+		Enabled:     true,
+		EnvConfig: map[string]string{
+			"GOOGLE_GEMINI_BASE_URL": "https://www.packyapi.com",
+			"GEMINI_API_KEY":         "sk-env",
+			"GEMINI_MODEL":           "gemini-2.5-pro",
+		},
+	})
+	if !ok {
+		t.Fatalf("带 .env 配置的供应商应可转换")
+	}
+	if provider.APIURL != "https://www.packyapi.com" || provider.APIKey != "sk-env" || provider.Site != "https://www.packyapi.com" {
+		t.Fatalf("URL/Key/Site 映射不正确: %+v", provider)
+	}
+	if provider.Note != "中转" || !provider.Enabled || provider.Level != 1 {
+		t.Fatalf("备注/启用/Level 映射不正确: %+v", provider)
+	}
+	if got := provider.GetEffectiveModel("claude-sonnet-4"); got != "gemini-2.5-pro" {
+		t.Fatalf("模型应映射到 gemini-2.5-pro，实际 %s", got)
+	}
+	if errs := provider.ValidateConfiguration(); len(errs) > 0 {
+		t.Fatalf("转换后的配置应通过校验: %v", errs)
+	}
+
+	// 显式字段优先于 .env
+	provider, _ = geminiToProvider(GeminiProvider{
+		Name:      "explicit",
+		BaseURL:   "https://explicit.example.com",
+		APIKey:    "sk-explicit",
+		EnvConfig: map[string]string{"GOOGLE_GEMINI_BASE_URL": "https://env.example.com", "GEMINI_API_KEY": "sk-env"},
+	})
+	if provider.APIURL != "https://explicit.example.com" || provider.APIKey != "sk-explicit" || provider.ModelMapping != nil {
+		t.Fatalf("显式字段应优先: %+v", provider)
+	}
+
+	// OAuth 供应商没有 URL/Key
+	if _, ok := geminiToProvider(GeminiProvider{Name: "Google Official", EnvConfig: map[string]string{}}); ok {
+		t.Fatalf("OAuth 供应商不应转换")
+	}
+}
+
+func TestProviderToGeminiMapping(t *testing.T) {
+	gemini := providerToGemini(Provider{
+		Name:            "relay",
+		APIURL:          "https://relay.example.com",
+		APIKey:          "sk-relay",
+		Site:            "https://relay.example.com/home",
+		Note:            "多平台中转",
+		Enabled:         true,
+		SupportedModels: map[string]bool{"gemini-2.5-flash": true},
+		ModelMapping:    map[string]string{"*": "gemini-2.5-flash"},
+	})
+	if gemini.BaseURL != "https://relay.example.com" || gemini.APIKey != "sk-relay" || gemini.WebsiteURL != "https://relay.example.com/home" {
+		t.Fatalf("字段映射不正确: %+v", gemini)
+	}
+	if gemini.Enabled || gemini.Category != "third_party" || gemini.Description != "多平台中转" {
+		t.Fatalf("Gemini 供应商应默认禁用: %+v", gemini)
+	}
+	if gemini.Model != "gemini-2.5-flash" || gemini.EnvConfig["GEMINI_MODEL"] != "gemini-2.5-flash" {
+		t.Fatalf("模型映射不正确: %+v", gemini)
+	}
+	if gemini.EnvConfig["GOOGLE_GEMINI_BASE_URL"] != "https://relay.example.com" || gemini.EnvConfig["GEMINI_API_KEY"] != "sk-relay" {
+		t.Fatalf(".env 配置不正确: %+v", gemini.EnvConfig)
+	}
+
+	if model := interopModel(Provider{SupportedModels: map[string]bool{"a": true, "b": true}}); model != "" {
+		t.Fatalf("多个白名单模型时不应推断模型，实际 %s", model)
+	}
+}
+
+func TestCopyProvidersBetweenGeminiAndClaude(t *testing.T) {
+	setupTestEnv(t)
+	ps := NewProviderService()
+	gs := NewGeminiService(":18100")
+	is := NewImportService(ps, NewMCPService(), gs)
+
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "relay", APIURL: "https://relay.example.com", APIKey: "sk-relay", Level: 1},
+		{ID: 2, Name: "no-key", APIURL: "https://nokey.example.com", Level: 1},
+	}); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+
+	result, err := is.CopyProvidersToGemini("claude")
+	if err != nil || result.Copied != 1 || len(result.Skipped) != 1 {
+		t.Fatalf("复制到 Gemini 结果不正确: %+v, %v", result, err)
+	}
+	if providers := gs.GetProviders(); len(providers) != 1 || providers[0].BaseURL != "https://relay.example.com" {
+		t.Fatalf("Gemini 供应商不正确: %+v", providers)
+	}
+
+	// 复制回 codex：relay 被复制，重复复制时跳过
+	result, err = is.CopyGeminiProvidersTo("codex")
+	if err != nil || result.Copied != 1 {
+		t.Fatalf("复制到 codex 结果不正确: %+v, %v", result, err)
+	}
+	result, err = is.CopyGeminiProvidersTo("codex")
+	if err != nil || result.Copied != 0 || len(result.Skipped) != 1 {
+		t.Fatalf("重复复制应跳过: %+v, %v", result, err)
+	}
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"os"
@@ -28,10 +29,12 @@ type ConfigImportResult struct {
 type ImportService struct {
 	providerService *ProviderService
 	mcpService      *MCPService
+	geminiService   *GeminiService
+	fetchBundle     func(ctx context.Context, rawURL string) ([]byte, error)
 }
 
-func NewImportService(ps *ProviderService, ms *MCPService) *ImportService {
-	return &ImportService{providerService: ps, mcpService: ms}
+func NewImportService(ps *ProviderService, ms *MCPService, gs *GeminiService) *ImportService {
+	return &ImportService{providerService: ps, mcpService: ms, geminiService: gs, fetchBundle: fetchProviderBundle}
 }
 
 func (is *ImportService) Start() error { return nil }
@@ -184,6 +187,7 @@ type ccMCPServerConfig struct {
 	Args    []string          `json:"args"`
 	Env     map[string]string `json:"env"`
 	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
 }
 
 type providerCandidate struct {
@@ -476,7 +480,7 @@ func (is *ImportService) importMCPServers(candidates []MCPServer) (int, error) {
 	merged := make([]MCPServer, 0, len(existing)+len(candidates))
 	merged = append(merged, existing...)
 	merged = append(merged, candidates...)
-	if err := is.mcpService.SaveServers(merged); err != nil {
+	if err := ignoreServersDisabled(is.mcpService.SaveServers(merged)); err != nil {
 		return 0, err
 	}
 	return len(candidates), nil
@@ -524,7 +528,7 @@ func appendMCPEntries(target map[string]*MCPServer, entries map[string]ccMCPServ
 		if serverType == "" {
 			continue
 		}
-		if serverType == "http" && url == "" {
+		if isURLServerType(serverType) && url == "" {
 			continue
 		}
 		if serverType == "stdio" && command == "" {
@@ -540,13 +544,14 @@ func appendMCPEntries(target map[string]*MCPServer, entries map[string]ccMCPServ
 				Args:           cloneStringSlice(serverCfg.Args),
 				Env:            cloneStringMap(serverCfg.Env),
 				URL:            url,
+				Headers:        cloneStringMap(serverCfg.Headers),
 				Website:        strings.TrimSpace(entry.Homepage),
 				Tips:           strings.TrimSpace(entry.Description),
 				EnablePlatform: []string{},
 			}
 			target[normalizedName] = existing
 		} else {
-			if existing.Type == "http" && existing.URL == "" {
+			if isURLServerType(existing.Type) && existing.URL == "" {
 				existing.URL = url
 			}
 			if existing.Type == "stdio" && existing.Command == "" {
@@ -558,6 +563,9 @@ func appendMCPEntries(target map[string]*MCPServer, entries map[string]ccMCPServ
 			if len(existing.Env) == 0 {
 				existing.Env = cloneStringMap(serverCfg.Env)
 			}
+			if len(existing.Headers) == 0 {
+				existing.Headers = cloneStringMap(serverCfg.Headers)
+			}
 			if existing.Website == "" {
 				existing.Website = strings.TrimSpace(entry.Homepage)
 			}
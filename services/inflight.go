@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// statusRequestCanceled 请求被取消（手动取消或客户端断开）时返回的状态码，沿用 nginx 的 499 约定
+const statusRequestCanceled = 499
+
+// InflightRequest 正在处理中的请求
+type InflightRequest struct {
+	ID        string    `json:"id"`
+	Platform  string    `json:"platform"`
+	Provider  string    `json:"provider"`
+	Model     string    `json:"model"`
+	IsStream  bool      `json:"isStream"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+type inflightEntry struct {
+	info   InflightRequest
+	cancel context.CancelFunc
+}
+
+// inflightTracker 记录进行中的请求及其取消函数
+type inflightTracker struct {
+	mu      sync.Mutex
+	seq     atomic.Uint64
+	entries map[string]*inflightEntry
+}
+
+func newInflightTracker() *inflightTracker {
+	return &inflightTracker{entries: make(map[string]*inflightEntry)}
+}
+
+// add 登记请求并返回请求 ID，请求结束后需调用 remove
+func (t *inflightTracker) add(info InflightRequest, cancel context.CancelFunc) string {
+	info.ID = fmt.Sprintf("%d-%d", info.StartedAt.UnixMilli(), t.seq.Add(1))
+
+	t.mu.Lock()
+	t.entries[info.ID] = &inflightEntry{info: info, cancel: cancel}
+	t.mu.Unlock()
+	return info.ID
+}
+
+func (t *inflightTracker) remove(id string) {
+	t.mu.Lock()
+	delete(t.entries, id)
+	t.mu.Unlock()
+}
+
+func (t *inflightTracker) list() []InflightRequest {
+	t.mu.Lock()
+	result := make([]InflightRequest, 0, len(t.entries))
+	for _, entry := range t.entries {
+		result = append(result, entry.info)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartedAt.Before(result[j].StartedAt)
+	})
+	return result
+}
+
+func (t *inflightTracker) cancel(id string) bool {
+	t.mu.Lock()
+	entry, ok := t.entries[id]
+	t.mu.Unlock()
+	if ok {
+		entry.cancel()
+	}
+	return ok
+}
+
+// GetInflightRequests 获取正在处理中的请求（按开始时间排序）
+func (prs *ProviderRelayService) GetInflightRequests() []InflightRequest {
+	return prs.inflight.list()
+}
+
+// CancelRequest 取消进行中的请求（中断上游连接），被取消的请求不会计入 provider 失败次数
+func (prs *ProviderRelayService) CancelRequest(id string) error {
+	if !prs.inflight.cancel(id) {
+		return fmt.Errorf("未找到进行中的请求 %s", id)
+	}
+	fmt.Printf("[INFO] 已取消请求 %s\n", id)
+	return nil
+}
+
+// trackRequest 为请求创建可取消的上下文并登记，返回的 done 需在请求结束时调用
+func (prs *ProviderRelayService) trackRequest(ctx context.Context, info InflightRequest) (context.Context, string, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	info.StartedAt = time.Now()
+	id := prs.inflight.add(info, cancel)
+	return ctx, id, func() {
+		prs.inflight.remove(id)
+		cancel()
+	}
+}
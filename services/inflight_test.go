@@ -0,0 +1,80 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCancelInflightRequest(t *testing.T) {
+	setupTestEnv(t)
+
+	upstreamStarted := make(chan struct{})
+	upstreamCanceled := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 读完请求体后服务端才会检测连接断开
+		_, _ = io.ReadAll(r.Body)
+		close(upstreamStarted)
+		select {
+		case <-r.Context().Done():
+			close(upstreamCanceled)
+		case <-time.After(5 * time.Second):
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "slow", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4","stream":true}`))
+		router.ServeHTTP(rec, req)
+	}()
+
+	select {
+	case <-upstreamStarted:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("请求未到达上游")
+	}
+	inflight := relay.GetInflightRequests()
+	if len(inflight) != 1 {
+		t.Fatalf("应有 1 个进行中的请求，实际 %d", len(inflight))
+	}
+	if inflight[0].Provider != "slow" || !inflight[0].IsStream || inflight[0].Model != "claude-sonnet-4" {
+		t.Fatalf("进行中请求信息不正确: %+v", inflight[0])
+	}
+
+	if err := relay.CancelRequest(inflight[0].ID); err != nil {
+		t.Fatalf("取消请求失败: %v", err)
+	}
+	select {
+	case <-upstreamCanceled:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("上游请求的 context 应被取消")
+	}
+	<-finished
+
+	if rec.Code != statusRequestCanceled {
+		t.Fatalf("状态码 = %d, 期望 %d", rec.Code, statusRequestCanceled)
+	}
+	if got := relay.GetInflightRequests(); len(got) != 0 {
+		t.Fatalf("请求结束后应移除登记: %+v", got)
+	}
+	if err := relay.CancelRequest(inflight[0].ID); err == nil {
+		t.Fatalf("已结束的请求不应能再次取消")
+	}
+	if blacklisted, _ := relay.blacklistService.IsBlacklisted("claude", "slow"); blacklisted {
+		t.Fatalf("取消的请求不应导致拉黑")
+	}
+}
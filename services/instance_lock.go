@@ -0,0 +1,283 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	instanceLockFileName = "instance.lock"
+	instanceActivateMsg  = "activate"
+	instanceAckMsg       = "ok"
+	instanceOpenPrefix   = "open "
+	instanceDialTimeout  = 2 * time.Second
+)
+
+// activeInstanceLock 当前进程持有的实例锁，应用自重启前需要先释放，否则新进程会把自己当作第二个实例退出
+var (
+	activeInstanceMu   sync.Mutex
+	activeInstanceLock *InstanceLock
+)
+
+// ErrInstanceRunning 已有实例在运行（已通知其显示窗口），当前进程应直接退出
+var ErrInstanceRunning = errors.New("已有 Code Switch 实例在运行")
+
+// instanceLockInfo 锁文件内容
+type instanceLockInfo struct {
+	PID       int       `json:"pid"`
+	Port      int       `json:"port"` // 本机激活端口，第二个实例通过它通知首个实例显示窗口
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// InstanceLock 单实例锁：~/.code-switch/instance.lock 记录 PID 和本机激活端口
+type InstanceLock struct {
+	path     string
+	listener net.Listener
+
+	mu         sync.Mutex
+	onActivate func()
+	onOpenURL  func(string)
+}
+
+// AcquireInstanceLock 获取单实例锁
+// 已有实例在运行时通知其显示窗口并返回 ErrInstanceRunning；崩溃残留的锁文件会被清理后重新获取
+// 由系统通过 bmai:// 链接启动时，链接会一并转交给已运行的实例处理
+func AcquireInstanceLock() (*InstanceLock, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("获取用户目录失败: %w", err)
+	}
+	dir := filepath.Join(home, ".code-switch")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建配置目录失败: %w", err)
+	}
+	lock, err := acquireInstanceLock(filepath.Join(dir, instanceLockFileName), launchURLFromArgs(os.Args[1:]))
+	if err != nil {
+		return nil, err
+	}
+	activeInstanceMu.Lock()
+	activeInstanceLock = lock
+	activeInstanceMu.Unlock()
+	return lock, nil
+}
+
+// releaseActiveInstanceLock 释放当前进程持有的实例锁（重启应用前调用）
+func releaseActiveInstanceLock() {
+	activeInstanceMu.Lock()
+	lock := activeInstanceLock
+	activeInstanceMu.Unlock()
+	lock.Release()
+}
+
+// launchURLFromArgs 取出系统启动应用时传入的 bmai:// 链接（Windows/Linux 以命令行参数传入）
+func launchURLFromArgs(args []string) string {
+	prefix := DeepLinkScheme + "://"
+	for _, arg := range args {
+		if len(arg) > len(prefix) && strings.EqualFold(arg[:len(prefix)], prefix) {
+			return arg
+		}
+	}
+	return ""
+}
+
+func acquireInstanceLock(path string, openURL string) (*InstanceLock, error) {
+	// 先监听激活端口再写锁文件，保证锁文件中的端口始终可用
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("监听实例激活端口失败: %w", err)
+	}
+	lock := &InstanceLock{path: path, listener: listener}
+	info := instanceLockInfo{
+		PID:       os.Getpid(),
+		Port:      listener.Addr().(*net.TCPAddr).Port,
+		StartedAt: time.Now(),
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	// 最多尝试两次：第一次失败且锁已失效时清理后重试
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, writeErr := file.Write(data)
+			closeErr := file.Close()
+			if writeErr != nil || closeErr != nil {
+				_ = os.Remove(path)
+				listener.Close()
+				return nil, fmt.Errorf("写入实例锁失败: %w", errors.Join(writeErr, closeErr))
+			}
+			go lock.serve()
+			return lock, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			listener.Close()
+			return nil, fmt.Errorf("创建实例锁失败: %w", err)
+		}
+
+		existing, ok := readInstanceLock(path)
+		if ok && processAlive(existing.PID) && activateInstance(existing.Port, openURL) == nil {
+			listener.Close()
+			return nil, ErrInstanceRunning
+		}
+		log.Printf("🧹 清理失效的实例锁: %s (PID %d)", path, existing.PID)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			listener.Close()
+			return nil, fmt.Errorf("清理失效的实例锁失败: %w", err)
+		}
+	}
+	listener.Close()
+	return nil, fmt.Errorf("获取实例锁失败: %s 被反复占用", path)
+}
+
+// readInstanceLock 读取锁文件；其他实例可能刚创建文件还未写入内容，短暂重试
+func readInstanceLock(path string) (instanceLockInfo, bool) {
+	var info instanceLockInfo
+	for i := 0; i < 3; i++ {
+		data, err := os.ReadFile(path)
+		if err == nil && json.Unmarshal(data, &info) == nil && info.PID > 0 {
+			return info, true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return info, false
+}
+
+// processAlive 判断进程是否存在（Windows 上 FindProcess 对不存在的进程返回错误）
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		_ = process.Release()
+		return true
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// activateInstance 通知已运行的实例显示窗口，对方确认后返回 nil
+// openURL 非空时在确认后追加一行 "open <url>"，旧版本实例读完激活消息即关闭连接，会忽略这一行
+func activateInstance(port int, openURL string) error {
+	if port <= 0 {
+		return fmt.Errorf("实例激活端口无效")
+	}
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), instanceDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(instanceDialTimeout))
+	if _, err := fmt.Fprintln(conn, instanceActivateMsg); err != nil {
+		return err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(reply) != instanceAckMsg {
+		return fmt.Errorf("实例激活端口响应无效: %q", reply)
+	}
+	if openURL != "" {
+		_, _ = fmt.Fprintln(conn, instanceOpenPrefix+openURL)
+	}
+	return nil
+}
+
+func (l *InstanceLock) serve() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			return
+		}
+		go l.handle(conn)
+	}
+}
+
+func (l *InstanceLock) handle(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(instanceDialTimeout))
+	reader := bufio.NewReader(conn)
+	msg, err := reader.ReadString('\n')
+	if err != nil || strings.TrimSpace(msg) != instanceActivateMsg {
+		return
+	}
+	_, _ = fmt.Fprintln(conn, instanceAckMsg)
+
+	// 可选的第二行：新实例由链接启动时转交的 URL，没有时对方直接关闭连接
+	openURL := ""
+	if line, err := reader.ReadString('\n'); err == nil && strings.HasPrefix(line, instanceOpenPrefix) {
+		openURL = strings.TrimSpace(strings.TrimPrefix(line, instanceOpenPrefix))
+	}
+
+	l.mu.Lock()
+	callback := l.onActivate
+	openCallback := l.onOpenURL
+	l.mu.Unlock()
+	log.Printf("🔔 检测到新启动的实例，显示当前窗口")
+	if callback != nil {
+		callback()
+	}
+	if openURL != "" && openCallback != nil {
+		openCallback(openURL)
+	}
+}
+
+// OnActivate 设置其他实例启动时的回调（通常用于显示主窗口）
+func (l *InstanceLock) OnActivate(callback func()) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.onActivate = callback
+	l.mu.Unlock()
+}
+
+// OnOpenURL 设置其他实例转交链接时的回调（在 OnActivate 回调之后调用）
+func (l *InstanceLock) OnOpenURL(callback func(string)) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.onOpenURL = callback
+	l.mu.Unlock()
+}
+
+// Release 释放单实例锁，仅删除属于当前进程的锁文件
+func (l *InstanceLock) Release() {
+	if l == nil {
+		return
+	}
+	activeInstanceMu.Lock()
+	if activeInstanceLock == l {
+		activeInstanceLock = nil
+	}
+	activeInstanceMu.Unlock()
+
+	_ = l.listener.Close()
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return
+	}
+	var info instanceLockInfo
+	if json.Unmarshal(data, &info) == nil && info.PID == os.Getpid() {
+		_ = os.Remove(l.path)
+	}
+}
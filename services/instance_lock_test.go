@@ -0,0 +1,78 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInstanceLockStaleCleanup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), instanceLockFileName)
+
+	// 模拟崩溃残留：进程不存在、激活端口已关闭
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	stalePort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+	stale, _ := json.Marshal(instanceLockInfo{PID: 1 << 30, Port: stalePort, StartedAt: time.Now().Add(-time.Hour)})
+	if err := os.WriteFile(path, stale, 0600); err != nil {
+		t.Fatalf("写入残留锁失败: %v", err)
+	}
+
+	lock, err := acquireInstanceLock(path, "")
+	if err != nil {
+		t.Fatalf("残留锁应被清理并重新获取: %v", err)
+	}
+	defer lock.Release()
+	info, ok := readInstanceLock(path)
+	if !ok || info.PID != os.Getpid() {
+		t.Fatalf("锁文件应记录当前 PID, 得到 %+v", info)
+	}
+
+	// 锁有效时第二个实例应通知第一个实例并退出
+	activated := make(chan struct{}, 1)
+	lock.OnActivate(func() { activated <- struct{}{} })
+	if _, err := acquireInstanceLock(path, ""); !errors.Is(err, ErrInstanceRunning) {
+		t.Fatalf("锁有效时应返回 ErrInstanceRunning, 得到 %v", err)
+	}
+	select {
+	case <-activated:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("第一个实例未收到激活通知")
+	}
+
+	// 由链接启动的第二个实例应把链接转交给第一个实例
+	opened := make(chan string, 1)
+	lock.OnOpenURL(func(rawURL string) { opened <- rawURL })
+	link := "bmai://add-provider?kind=claude&name=relay"
+	if _, err := acquireInstanceLock(path, link); !errors.Is(err, ErrInstanceRunning) {
+		t.Fatalf("锁有效时应返回 ErrInstanceRunning, 得到 %v", err)
+	}
+	select {
+	case got := <-opened:
+		if got != link {
+			t.Fatalf("转交的链接 = %q, 期望 %q", got, link)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("第一个实例未收到转交的链接")
+	}
+	if got := launchURLFromArgs([]string{"--hidden", "BMAI://add-provider?kind=codex"}); got != "BMAI://add-provider?kind=codex" {
+		t.Fatalf("launchURLFromArgs = %q", got)
+	}
+
+	lock.Release()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("释放后应删除锁文件: %v", err)
+	}
+	again, err := acquireInstanceLock(path, "")
+	if err != nil {
+		t.Fatalf("释放后应能重新获取: %v", err)
+	}
+	again.Release()
+}
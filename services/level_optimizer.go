@@ -0,0 +1,302 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+const (
+	// levelOptimizerConfigKey app_settings 中自动调级配置的配置键（JSON）
+	levelOptimizerConfigKey = "level_optimizer_config"
+	// LevelAdjustedEvent 自动调级后通知前端的事件名，payload 为 []LevelAdjustment
+	LevelAdjustedEvent = "providers:level-adjusted"
+	// minLevelOptimizerInterval 最短调级间隔，避免根据过少的新数据频繁调整
+	minLevelOptimizerInterval = 10
+)
+
+// LevelOptimizerConfig 自动调级配置
+//
+// 每隔 IntervalMinutes 按健康分（最近成功率、延迟、拉黑状态，权重见 HealthScoreWeights）调整已启用 provider 的 Level：
+// 健康分 >= PromoteScore 时提升一级，< DemoteScore 时降低一级，介于两者之间保持不变（滞回区间，避免来回跳动）
+// 每次最多调整一级，且始终在 [MinLevel, MaxLevel] 范围内（范围外的 provider 不调整）；最近请求数少于 MinSamples 的 provider 不调整
+type LevelOptimizerConfig struct {
+	Enabled         bool    `json:"enabled"`
+	IntervalMinutes int     `json:"intervalMinutes"`
+	MinLevel        int     `json:"minLevel"`
+	MaxLevel        int     `json:"maxLevel"`
+	PromoteScore    float64 `json:"promoteScore"`
+	DemoteScore     float64 `json:"demoteScore"`
+	MinSamples      int     `json:"minSamples"`
+}
+
+// DefaultLevelOptimizerConfig 默认配置：关闭，每小时评估一次，健康分 90 以上提升、70 以下降低
+func DefaultLevelOptimizerConfig() LevelOptimizerConfig {
+	return LevelOptimizerConfig{
+		Enabled:         false,
+		IntervalMinutes: 60,
+		MinLevel:        1,
+		MaxLevel:        10,
+		PromoteScore:    90,
+		DemoteScore:     70,
+		MinSamples:      20,
+	}
+}
+
+func (c LevelOptimizerConfig) validate() error {
+	if c.IntervalMinutes < minLevelOptimizerInterval {
+		return fmt.Errorf("自动调级间隔不能少于 %d 分钟", minLevelOptimizerInterval)
+	}
+	if c.MinLevel < 1 || c.MaxLevel > 10 || c.MinLevel > c.MaxLevel {
+		return fmt.Errorf("Level 范围必须在 1-10 之间，且最小值不大于最大值")
+	}
+	if c.DemoteScore < 0 || c.PromoteScore > 100 || c.DemoteScore >= c.PromoteScore {
+		return fmt.Errorf("健康分阈值必须在 0-100 之间，且降级阈值小于升级阈值")
+	}
+	if c.MinSamples < 1 {
+		return fmt.Errorf("最少请求数必须大于 0")
+	}
+	return nil
+}
+
+// LevelAdjustment 一次自动调级记录
+type LevelAdjustment struct {
+	Platform     string  `json:"platform"`
+	ProviderID   int64   `json:"providerId"`
+	ProviderName string  `json:"providerName"`
+	FromLevel    int     `json:"fromLevel"`
+	ToLevel      int     `json:"toLevel"`
+	HealthScore  float64 `json:"healthScore"`
+}
+
+// LevelOptimizerService 根据健康分定时自动调整 provider 的 Level（需手动开启）
+type LevelOptimizerService struct {
+	providerService  *ProviderService
+	blacklistService *BlacklistService
+
+	mu         sync.Mutex
+	timer      *time.Timer
+	onAdjusted []func([]LevelAdjustment)
+}
+
+func NewLevelOptimizerService(providerService *ProviderService, blacklistService *BlacklistService) *LevelOptimizerService {
+	return &LevelOptimizerService{
+		providerService:  providerService,
+		blacklistService: blacklistService,
+	}
+}
+
+// GetLevelOptimizerConfig 获取自动调级配置（未配置时返回默认值）
+func (lo *LevelOptimizerService) GetLevelOptimizerConfig() (LevelOptimizerConfig, error) {
+	value, found, err := getSettingValue(levelOptimizerConfigKey)
+	if err != nil {
+		return LevelOptimizerConfig{}, err
+	}
+	if !found || strings.TrimSpace(value) == "" {
+		return DefaultLevelOptimizerConfig(), nil
+	}
+	config := DefaultLevelOptimizerConfig()
+	if err := json.Unmarshal([]byte(value), &config); err != nil {
+		return LevelOptimizerConfig{}, fmt.Errorf("解析自动调级配置失败: %w", err)
+	}
+	return config, nil
+}
+
+// SetLevelOptimizerConfig 保存自动调级配置，并按新的间隔重新调度
+func (lo *LevelOptimizerService) SetLevelOptimizerConfig(config LevelOptimizerConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := setSettingValue(levelOptimizerConfigKey, string(data)); err != nil {
+		return err
+	}
+	lo.mu.Lock()
+	active := lo.timer != nil
+	lo.mu.Unlock()
+	if active {
+		lo.StartScheduler()
+	}
+	return nil
+}
+
+// OnAdjusted 注册自动调级回调（main 中据此向前端发送 LevelAdjustedEvent）
+func (lo *LevelOptimizerService) OnAdjusted(fn func([]LevelAdjustment)) {
+	lo.mu.Lock()
+	defer lo.mu.Unlock()
+	lo.onAdjusted = append(lo.onAdjusted, fn)
+}
+
+// StartScheduler 启动定时自动调级（未开启时每个间隔只检查配置，不做调整）
+func (lo *LevelOptimizerService) StartScheduler() {
+	interval := time.Duration(DefaultLevelOptimizerConfig().IntervalMinutes) * time.Minute
+	if config, err := lo.GetLevelOptimizerConfig(); err == nil && config.IntervalMinutes >= minLevelOptimizerInterval {
+		interval = time.Duration(config.IntervalMinutes) * time.Minute
+	}
+
+	lo.mu.Lock()
+	defer lo.mu.Unlock()
+
+	if lo.timer != nil {
+		lo.timer.Stop()
+	}
+	lo.timer = time.AfterFunc(interval, func() {
+		if _, err := lo.runScheduled(); err != nil {
+			log.Printf("⚠️  自动调级失败: %v", err)
+		}
+
+		// StopScheduler 后不再重新调度
+		lo.mu.Lock()
+		active := lo.timer != nil
+		lo.mu.Unlock()
+		if active {
+			lo.StartScheduler()
+		}
+	})
+}
+
+// StopScheduler 停止定时自动调级
+func (lo *LevelOptimizerService) StopScheduler() {
+	lo.mu.Lock()
+	defer lo.mu.Unlock()
+
+	if lo.timer != nil {
+		lo.timer.Stop()
+		lo.timer = nil
+	}
+}
+
+func (lo *LevelOptimizerService) runScheduled() ([]LevelAdjustment, error) {
+	config, err := lo.GetLevelOptimizerConfig()
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled {
+		return nil, nil
+	}
+	return lo.optimize(config)
+}
+
+// OptimizeLevelsNow 按当前配置立即执行一次自动调级（无论是否开启），返回本次的调整
+func (lo *LevelOptimizerService) OptimizeLevelsNow() ([]LevelAdjustment, error) {
+	config, err := lo.GetLevelOptimizerConfig()
+	if err != nil {
+		return nil, err
+	}
+	return lo.optimize(config)
+}
+
+func (lo *LevelOptimizerService) optimize(config LevelOptimizerConfig) ([]LevelAdjustment, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	weights := lo.blacklistService.healthScoreWeights()
+	now := lo.blacklistService.clock.Now()
+
+	adjustments := make([]LevelAdjustment, 0)
+	for _, kind := range []string{"claude", "codex"} {
+		changed, err := lo.optimizePlatform(db, kind, config, weights, now)
+		if err != nil {
+			return adjustments, err
+		}
+		for _, adj := range changed {
+			fmt.Printf("[INFO] 自动调级: %s/%s Level %d -> %d（健康分 %.1f）\n",
+				adj.Platform, adj.ProviderName, adj.FromLevel, adj.ToLevel, adj.HealthScore)
+		}
+		adjustments = append(adjustments, changed...)
+	}
+
+	sort.SliceStable(adjustments, func(i, j int) bool {
+		if adjustments[i].Platform == adjustments[j].Platform {
+			return adjustments[i].ProviderName < adjustments[j].ProviderName
+		}
+		return adjustments[i].Platform < adjustments[j].Platform
+	})
+	if len(adjustments) > 0 {
+		lo.mu.Lock()
+		listeners := append([]func([]LevelAdjustment){}, lo.onAdjusted...)
+		lo.mu.Unlock()
+		for _, fn := range listeners {
+			go fn(adjustments)
+		}
+	}
+	return adjustments, nil
+}
+
+// optimizePlatform 调整单个平台的 provider Level，加载和保存期间持有 ProviderService 的锁，避免覆盖用户同时做的修改
+func (lo *LevelOptimizerService) optimizePlatform(db *sql.DB, kind string, config LevelOptimizerConfig, weights HealthScoreWeights, now time.Time) ([]LevelAdjustment, error) {
+	ps := lo.providerService
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return nil, fmt.Errorf("加载 %s 供应商失败: %w", kind, err)
+	}
+	changed := make([]LevelAdjustment, 0)
+	for i := range providers {
+		p := &providers[i]
+		if !p.Enabled {
+			continue
+		}
+		signals, err := loadHealthSignals(db, kind, p.Name, now)
+		if err != nil {
+			return nil, err
+		}
+		if signals.samples < config.MinSamples {
+			continue
+		}
+		score := computeHealthScore(signals, weights, now)
+		level := p.Level
+		if level <= 0 {
+			level = 1
+		}
+		target := nextOptimizedLevel(level, score, config)
+		if target == level {
+			continue
+		}
+		changed = append(changed, LevelAdjustment{
+			Platform:     kind,
+			ProviderID:   p.ID,
+			ProviderName: p.Name,
+			FromLevel:    level,
+			ToLevel:      target,
+			HealthScore:  score,
+		})
+		p.Level = target
+	}
+	if len(changed) == 0 {
+		return changed, nil
+	}
+	if err := ps.saveProvidersLocked(kind, providers); err != nil {
+		return nil, fmt.Errorf("保存 %s 供应商失败: %w", kind, err)
+	}
+	return changed, nil
+}
+
+// nextOptimizedLevel 计算调整后的 Level：按阈值最多调整一级，Level 不在范围内的 provider 视为手动固定，不调整
+func nextOptimizedLevel(level int, score float64, config LevelOptimizerConfig) int {
+	switch {
+	case level < config.MinLevel || level > config.MaxLevel:
+		return level
+	case score >= config.PromoteScore && level > config.MinLevel:
+		return level - 1
+	case score < config.DemoteScore && level < config.MaxLevel:
+		return level + 1
+	}
+	return level
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestLevelOptimizerAdjustsLevelsFromStats(t *testing.T) {
+	setupTestEnv(t)
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "fast", APIURL: "https://fast.example.com", APIKey: "sk", Enabled: true, Level: 3},
+		{ID: 2, Name: "flaky", APIURL: "https://flaky.example.com", APIKey: "sk", Enabled: true, Level: 1},
+		{ID: 3, Name: "steady", APIURL: "https://steady.example.com", APIKey: "sk", Enabled: true, Level: 2},
+		{ID: 4, Name: "capped", APIURL: "https://capped.example.com", APIKey: "sk", Enabled: true, Level: 3},
+		{ID: 5, Name: "sparse", APIURL: "https://sparse.example.com", APIKey: "sk", Enabled: true, Level: 3},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	// 每个 provider 写入 total 条请求，其中 failures 条失败，成功请求耗时 1 秒
+	insert := func(provider string, total, failures int) {
+		for i := 0; i < total; i++ {
+			code := 200
+			if i < failures {
+				code = 502
+			}
+			insertTestRequestLog(t, xdb.Record{
+				"platform":     "claude",
+				"provider":     provider,
+				"model":        "claude-sonnet-4",
+				"http_code":    code,
+				"duration_sec": 1.0,
+			})
+		}
+	}
+	insert("fast", 30, 0)    // 健康分 99.3：提升
+	insert("flaky", 30, 20)  // 健康分 66.0：降低
+	insert("steady", 30, 6)  // 健康分 89.3：处于滞回区间，不变
+	insert("capped", 30, 30) // 已是允许的最低优先级，不再降低
+	insert("sparse", 5, 0)   // 样本不足，不调整
+
+	lo := NewLevelOptimizerService(ps, NewBlacklistService(NewSettingsService()))
+	notified := make(chan []LevelAdjustment, 1)
+	lo.OnAdjusted(func(adjustments []LevelAdjustment) { notified <- adjustments })
+
+	config := DefaultLevelOptimizerConfig()
+	config.Enabled = true
+	config.MaxLevel = 3
+	if err := lo.SetLevelOptimizerConfig(config); err != nil {
+		t.Fatalf("保存自动调级配置失败: %v", err)
+	}
+	adjustments, err := lo.runScheduled()
+	if err != nil {
+		t.Fatalf("自动调级失败: %v", err)
+	}
+	if len(adjustments) != 2 ||
+		adjustments[0].ProviderName != "fast" || adjustments[0].FromLevel != 3 || adjustments[0].ToLevel != 2 ||
+		adjustments[1].ProviderName != "flaky" || adjustments[1].FromLevel != 1 || adjustments[1].ToLevel != 2 {
+		t.Fatalf("调级结果不正确: %+v", adjustments)
+	}
+
+	providers, err := ps.LoadProviders("claude")
+	if err != nil {
+		t.Fatalf("加载 provider 失败: %v", err)
+	}
+	expected := map[string]int{"fast": 2, "flaky": 2, "steady": 2, "capped": 3, "sparse": 3}
+	for _, p := range providers {
+		if p.Level != expected[p.Name] {
+			t.Fatalf("%s 的 Level = %d, 期望 %d", p.Name, p.Level, expected[p.Name])
+		}
+	}
+
+	select {
+	case got := <-notified:
+		if len(got) != 2 {
+			t.Fatalf("事件应包含 2 条调整: %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("调级后应发出通知")
+	}
+
+	// 关闭后定时任务不再调整
+	config.Enabled = false
+	if err := lo.SetLevelOptimizerConfig(config); err != nil {
+		t.Fatalf("保存自动调级配置失败: %v", err)
+	}
+	if adjustments, err := lo.runScheduled(); err != nil || len(adjustments) != 0 {
+		t.Fatalf("关闭时不应调整: %+v, %v", adjustments, err)
+	}
+}
+
+func TestAutoAssignLevelsFromSpeedTest(t *testing.T) {
+	setupTestEnv(t)
+
+	ps := NewProviderService()
+	offWeight := 5
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "slow", APIURL: "https://slow.example.com", APIKey: "sk", Enabled: true, Level: 1},
+		{ID: 2, Name: "off", APIURL: "https://off.example.com", APIKey: "sk", Enabled: false, Level: 4, Weight: &offWeight},
+		{ID: 3, Name: "dead", APIURL: "https://dead.example.com", APIKey: "sk", Enabled: true, Level: 1},
+		{ID: 4, Name: "fast", APIURL: "https://fast.example.com", APIKey: "sk", Enabled: true, Level: 3},
+		{ID: 5, Name: "near", APIURL: "https://near.example.com", APIKey: "sk", Enabled: true, Level: 2},
+		{ID: 6, Name: "untested", APIURL: "https://untested.example.com", APIKey: "sk", Enabled: true, Level: 7},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	results := []SpeedTestResult{
+		{Provider: "fast", Successes: 3, MedianTotalMs: 100},
+		{Provider: "near", Successes: 3, MedianTotalMs: 130}, // 与 fast 相差不超过 50ms，同一 Level
+		{Provider: "slow", Successes: 3, MedianTotalMs: 600},
+		{Provider: "dead", Successes: 0, Error: "connection refused"},
+		{Provider: "off", Successes: 3, MedianTotalMs: 10}, // 未启用，不参与调整
+	}
+
+	preview, err := ps.PreviewAutoAssignLevels("claude", results)
+	if err != nil {
+		t.Fatalf("预览调级失败: %v", err)
+	}
+	assignments, err := ps.AutoAssignLevels("claude", results)
+	if err != nil {
+		t.Fatalf("按测速调级失败: %v", err)
+	}
+	if len(preview) != len(assignments) {
+		t.Fatalf("预览结果应与实际调整一致: %+v / %+v", preview, assignments)
+	}
+
+	want := []struct {
+		name  string
+		level int
+	}{{"fast", 1}, {"off", 4}, {"near", 1}, {"slow", 2}, {"dead", 3}, {"untested", 7}}
+	providers, err := ps.LoadProviders("claude")
+	if err != nil {
+		t.Fatalf("加载 provider 失败: %v", err)
+	}
+	for i, w := range want {
+		if providers[i].Name != w.name || providers[i].Level != w.level {
+			t.Fatalf("第 %d 个 provider 应为 %s(Level %d)，实际 %s(Level %d)", i, w.name, w.level, providers[i].Name, providers[i].Level)
+		}
+		if assignments[i].ProviderName != w.name || assignments[i].ToLevel != w.level || preview[i] != assignments[i] {
+			t.Fatalf("返回的第 %d 项不正确: %+v", i, assignments[i])
+		}
+	}
+	if assignments[0].FromLevel != 3 || assignments[0].MedianTotalMs != 100 {
+		t.Fatalf("应记录调整前的 Level 和延迟: %+v", assignments[0])
+	}
+	if off := providers[1]; off.Enabled || off.effectiveWeight() != 5 || assignments[1].Measured {
+		t.Fatalf("未启用的 provider 配置应保持不变: %+v", off)
+	}
+
+	// 再次使用相同的测速结果不产生变化
+	again, err := ps.AutoAssignLevels("claude", results)
+	if err != nil {
+		t.Fatalf("重复调级失败: %v", err)
+	}
+	for i := range again {
+		if again[i].ProviderName != want[i].name || again[i].FromLevel != again[i].ToLevel {
+			t.Fatalf("重复调级应保持不变: %+v", again[i])
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+)
+
+// levelRotation 同一 Level 内多个 provider 的轮询游标，零值可用，随 relay 生命周期保存在内存中
+//
+// 游标记录上次选中的 provider 在配置列表中的位置（而不是在可用列表中的下标），
+// 这样拉黑、不支持模型等被过滤掉的 provider 只会被跳过，不会让轮询越过下一个可用的 provider
+type levelRotation struct {
+	mu   sync.Mutex
+	last map[string]int // kind + level -> 上次选中的 provider 在配置列表中的位置
+}
+
+// next 从 group（同一 Level 的可用 provider，保持配置顺序）中选出上次之后的下一个 provider
+// order 为 provider 名称在配置列表中的位置
+func (r *levelRotation) next(kind string, level int, group []Provider, order map[string]int) Provider {
+	if len(group) == 1 {
+		return group[0]
+	}
+	key := fmt.Sprintf("%s:%d", kind, level)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.last == nil {
+		r.last = make(map[string]int)
+	}
+	selected := group[0]
+	if last, ok := r.last[key]; ok {
+		for _, provider := range group {
+			if order[provider.Name] > last {
+				selected = provider
+				break
+			}
+		}
+	}
+	r.last[key] = order[selected.Name]
+	return selected
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestRoundRobinWithinLevel(t *testing.T) {
+	setupTestEnv(t)
+
+	relay, _ := newTestRelay(t)
+	providers := []Provider{
+		{ID: 1, Name: "a", APIURL: "https://a.example.com", APIKey: "sk", Enabled: true, Level: 1},
+		{ID: 2, Name: "b", APIURL: "https://b.example.com", APIKey: "sk", Enabled: true, Level: 1},
+		{ID: 3, Name: "haiku-only", APIURL: "https://h.example.com", APIKey: "sk", Enabled: true, Level: 1,
+			SupportedModels: map[string]bool{"claude-haiku-4": true}},
+		{ID: 4, Name: "c", APIURL: "https://c.example.com", APIKey: "sk", Enabled: true, Level: 1},
+		{ID: 5, Name: "backup", APIURL: "https://backup.example.com", APIKey: "sk", Enabled: true, Level: 2},
+	}
+	pick := func() string {
+		t.Helper()
+		provider, level, _, ok := relay.pickProvider("claude", "claude-sonnet-4", 0, providers)
+		if !ok || level != 1 {
+			t.Fatalf("应选中 Level 1 的 provider: %+v (level %d)", provider, level)
+		}
+		return provider.Name
+	}
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, pick())
+	}
+	if strings.Join(got, ",") != "a,b,c,a" {
+		t.Fatalf("同一 Level 内应轮流选择并跳过不支持模型的 provider，实际 %v", got)
+	}
+
+	// 上次选中 a，b 被拉黑后应选中 c，而不是越过 c 回到 a
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatalf("获取数据库失败: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO provider_blacklist (platform, provider_name, blacklisted_at, blacklisted_until) VALUES (?, ?, ?, ?)`,
+		"claude", "b", time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("写入黑名单失败: %v", err)
+	}
+	if name := pick(); name != "c" {
+		t.Fatalf("拉黑的 provider 应被跳过，期望 c，实际 %s", name)
+	}
+	if name := pick(); name != "a" {
+		t.Fatalf("游标应回到第一个可用 provider，期望 a，实际 %s", name)
+	}
+
+	// 轮询按平台和 Level 分别计数
+	if provider, _, _, _ := relay.pickProvider("codex", "", 0, providers); provider.Name != "a" {
+		t.Fatalf("其他平台的游标应独立，实际 %s", provider.Name)
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+const (
+	// logRetentionDaysKey app_settings 中请求日志保留天数的配置键
+	logRetentionDaysKey = "log_retention_days"
+	// DefaultLogRetentionDays 未配置时请求日志保留 90 天
+	DefaultLogRetentionDays = 90
+	maxLogRetentionDays     = 3650
+	// LogPruneInterval 后台清理过期请求日志的间隔
+	LogPruneInterval = time.Hour
+)
+
+// logRetentionDays 读取请求日志保留天数，未配置时为 90，0 表示永久保留
+func logRetentionDays() (int, error) {
+	value, found, err := getSettingValue(logRetentionDaysKey)
+	if err != nil {
+		return 0, err
+	}
+	value = strings.TrimSpace(value)
+	if !found || value == "" {
+		return DefaultLogRetentionDays, nil
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 || days > maxLogRetentionDays {
+		return 0, fmt.Errorf("请求日志保留天数配置无效: %s", value)
+	}
+	return days, nil
+}
+
+// GetLogRetentionDays 获取请求日志保留天数（未配置时为 90，0 表示永久保留）
+func (ss *SettingsService) GetLogRetentionDays() (int, error) {
+	return logRetentionDays()
+}
+
+// SetLogRetentionDays 设置请求日志保留天数（0-3650，0 表示永久保留），下次后台清理时生效
+func (ss *SettingsService) SetLogRetentionDays(days int) error {
+	if days < 0 || days > maxLogRetentionDays {
+		return fmt.Errorf("保留天数必须在 0-%d 之间", maxLogRetentionDays)
+	}
+	return setSettingValue(logRetentionDaysKey, strconv.Itoa(days))
+}
+
+// PruneOldLogs 删除 retentionDays 天之前的请求日志，返回删除的记录数
+func (ls *LogService) PruneOldLogs(retentionDays int) (int64, error) {
+	if retentionDays <= 0 {
+		return 0, fmt.Errorf("保留天数必须大于 0")
+	}
+	db, err := xdb.DB("default")
+	if err != nil {
+		return 0, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	// created_at 以 UTC 保存（CURRENT_TIMESTAMP），按同样格式比较以命中索引
+	cutoff := time.Now().UTC().AddDate(0, 0, -retentionDays).Format(timeLayout)
+	defer beginBulkWrite()()
+	result, err := db.Exec("DELETE FROM request_log WHERE created_at < ?", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("清理过期请求日志失败: %w", err)
+	}
+	deleted, _ := result.RowsAffected()
+	return deleted, nil
+}
+
+// PruneExpiredLogs 按配置的保留天数清理请求日志（由后台定时器调用），保留天数为 0 时不清理
+func (ls *LogService) PruneExpiredLogs() (int64, error) {
+	days, err := logRetentionDays()
+	if err != nil {
+		return 0, err
+	}
+	if days == 0 {
+		return 0, nil
+	}
+	return ls.PruneOldLogs(days)
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"sort"
 	"strings"
@@ -15,7 +16,8 @@ import (
 const timeLayout = "2006-01-02 15:04:05"
 
 type LogService struct {
-	pricing *modelpricing.Service
+	pricing         *modelpricing.Service
+	providerService *ProviderService
 }
 
 func NewLogService() *LogService {
@@ -26,7 +28,31 @@ func NewLogService() *LogService {
 	return &LogService{pricing: svc}
 }
 
+// BindProviderService 关联供应商服务，ProviderDailyStats 据此附带 provider 备注
+func (ls *LogService) BindProviderService(providerService *ProviderService) {
+	ls.providerService = providerService
+}
+
+// RequestLogQuery 请求日志查询条件（为空的字段不参与过滤）
+type RequestLogQuery struct {
+	Platform string `json:"platform"`
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Session  string `json:"session"` // X-Session-Id 会话标识
+	Since    string `json:"since"` // 起始时间（含），格式 2006-01-02 15:04:05
+	Until    string `json:"until"` // 结束时间（不含），格式同上
+	Limit    int    `json:"limit"`
+	Offset   int    `json:"offset"`
+}
+
 func (ls *LogService) ListRequestLogs(platform string, provider string, limit int) ([]ReqeustLog, error) {
+	return ls.QueryLogs(RequestLogQuery{Platform: platform, Provider: provider, Limit: limit})
+}
+
+// QueryLogs 按条件查询请求日志，并在查询时按当前价格表计算每条请求的费用
+// 历史记录即使写入时未计价，也会以当前费率展示；未知模型的 HasPricing 为 false
+func (ls *LogService) QueryLogs(query RequestLogQuery) ([]ReqeustLog, error) {
+	limit := query.Limit
 	if limit <= 0 {
 		limit = 100
 	}
@@ -38,13 +64,41 @@ func (ls *LogService) ListRequestLogs(platform string, provider string, limit in
 		xdb.OrderByDesc("id"),
 		xdb.Limit(limit),
 	}
-	if platform != "" {
-		options = append(options, xdb.WhereEq("platform", platform))
+	if query.Offset > 0 {
+		options = append(options, xdb.Offset(query.Offset))
+	}
+	if query.Platform != "" {
+		options = append(options, xdb.WhereEq("platform", query.Platform))
+	}
+	if query.Provider != "" {
+		options = append(options, xdb.WhereEq("provider", query.Provider))
 	}
-	if provider != "" {
-		options = append(options, xdb.WhereEq("provider", provider))
+	if query.Model != "" {
+		options = append(options, xdb.WhereEq("model", query.Model))
+	}
+	if query.Session != "" {
+		options = append(options, xdb.WhereEq("session_id", query.Session))
+	}
+	if query.Since != "" {
+		options = append(options, xdb.WhereGte("created_at", query.Since))
+	}
+	if query.Until != "" {
+		options = append(options, xdb.WhereLt("created_at", query.Until))
 	}
 	records, err := model.Selects(options...)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) {
+			return []ReqeustLog{}, nil
+		}
+		return nil, err
+	}
+	var oldest time.Time
+	for _, record := range records {
+		if createdAt, ok := parseCreatedAt(record); ok && (oldest.IsZero() || createdAt.Before(oldest)) {
+			oldest = createdAt
+		}
+	}
+	tiered, err := loadTieredPricing(oldest)
 	if err != nil {
 		return nil, err
 	}
@@ -61,11 +115,20 @@ func (ls *LogService) ListRequestLogs(platform string, provider string, limit in
 			CacheCreateTokens: record.GetInt("cache_create_tokens"),
 			CacheReadTokens:   record.GetInt("cache_read_tokens"),
 			ReasoningTokens:   record.GetInt("reasoning_tokens"),
+			Ephemeral5mTokens: record.GetInt("ephemeral_5m_tokens"),
+			Ephemeral1hTokens: record.GetInt("ephemeral_1h_tokens"),
 			CreatedAt:         record.GetString("created_at"),
 			IsStream:          record.GetBool("is_stream"),
 			DurationSec:       record.GetFloat64("duration_sec"),
+			SessionID:         record.GetString("session_id"),
+			Partial:           record.GetBool("partial"),
 		}
-		ls.decorateCost(&logEntry)
+		if cost, ok := storedRecordCost(record); ok {
+			setLogCost(&logEntry, cost)
+		} else {
+			ls.decorateCost(&logEntry)
+		}
+		tiered.applyLog(&logEntry)
 		logs = append(logs, logEntry)
 	}
 	return logs, nil
@@ -95,6 +158,21 @@ func (ls *LogService) ListProviders(platform string) ([]string, error) {
 	return providers, nil
 }
 
+// PurgeRequestLog 清空全部请求日志，返回删除的记录数
+func (ls *LogService) PurgeRequestLog() (int64, error) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return 0, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	defer beginBulkWrite()()
+	result, err := db.Exec("DELETE FROM request_log")
+	if err != nil {
+		return 0, fmt.Errorf("清空请求日志失败: %w", err)
+	}
+	deleted, _ := result.RowsAffected()
+	return deleted, nil
+}
+
 func (ls *LogService) HeatmapStats(days int) ([]HeatmapStat, error) {
 	if days <= 0 {
 		days = 30
@@ -111,12 +189,23 @@ func (ls *LogService) HeatmapStats(days int) ([]HeatmapStat, error) {
 	options := []xdb.Option{
 		xdb.WhereGe("created_at", rangeStart.Format(timeLayout)),
 		xdb.Field(
+			"id",
 			"model",
 			"input_tokens",
 			"output_tokens",
 			"reasoning_tokens",
 			"cache_create_tokens",
 			"cache_read_tokens",
+			"ephemeral_5m_tokens",
+			"ephemeral_1h_tokens",
+			"has_pricing",
+			"input_cost",
+			"output_cost",
+			"cache_create_cost",
+			"cache_read_cost",
+			"ephemeral_5m_cost",
+			"ephemeral_1h_cost",
+			"total_cost",
 			"created_at",
 		),
 		xdb.OrderByDesc("created_at"),
@@ -128,6 +217,10 @@ func (ls *LogService) HeatmapStats(days int) ([]HeatmapStat, error) {
 		}
 		return nil, err
 	}
+	tiered, err := loadTieredPricing(rangeStart)
+	if err != nil {
+		return nil, err
+	}
 	hourBuckets := map[int64]*HeatmapStat{}
 	for _, record := range records {
 		createdAt, _ := parseCreatedAt(record)
@@ -155,8 +248,9 @@ func (ls *LogService) HeatmapStats(days int) ([]HeatmapStat, error) {
 			OutputTokens:      output,
 			CacheCreateTokens: cacheCreate,
 			CacheReadTokens:   cacheRead,
+			CacheCreation:     recordCacheCreation(record),
 		}
-		cost := ls.calculateCost(record.GetString("model"), usage)
+		cost := tiered.apply(record.GetInt64("id"), ls.recordCost(record, usage))
 		bucket.TotalCost += cost.TotalCost
 	}
 	if len(hourBuckets) == 0 {
@@ -191,12 +285,23 @@ func (ls *LogService) StatsSince(platform string) (LogStats, error) {
 	options := []xdb.Option{
 		xdb.WhereGte("created_at", queryStart.Format(timeLayout)),
 		xdb.Field(
+			"id",
 			"model",
 			"input_tokens",
 			"output_tokens",
 			"reasoning_tokens",
 			"cache_create_tokens",
 			"cache_read_tokens",
+			"ephemeral_5m_tokens",
+			"ephemeral_1h_tokens",
+			"has_pricing",
+			"input_cost",
+			"output_cost",
+			"cache_create_cost",
+			"cache_read_cost",
+			"ephemeral_5m_cost",
+			"ephemeral_1h_cost",
+			"total_cost",
 			"created_at",
 		),
 		xdb.OrderByAsc("created_at"),
@@ -211,6 +316,10 @@ func (ls *LogService) StatsSince(platform string) (LogStats, error) {
 		}
 		return stats, err
 	}
+	tiered, err := loadTieredPricing(seriesStart)
+	if err != nil {
+		return stats, err
+	}
 
 	seriesBuckets := make([]*LogStatsSeries, seriesHours)
 	for i := 0; i < seriesHours; i++ {
@@ -257,8 +366,9 @@ func (ls *LogService) StatsSince(platform string) (LogStats, error) {
 			OutputTokens:      output,
 			CacheCreateTokens: cacheCreate,
 			CacheReadTokens:   cacheRead,
+			CacheCreation:     recordCacheCreation(record),
 		}
-		cost := ls.calculateCost(record.GetString("model"), usage)
+		cost := tiered.apply(record.GetInt64("id"), ls.recordCost(record, usage))
 
 		bucket.TotalRequests++
 		bucket.InputTokens += int64(input)
@@ -306,6 +416,7 @@ func (ls *LogService) ProviderDailyStats(platform string) ([]ProviderDailyStat,
 	options := []xdb.Option{
 		xdb.WhereGte("created_at", queryStart.Format(timeLayout)),
 		xdb.Field(
+			"id",
 			"provider",
 			"model",
 			"http_code",
@@ -314,6 +425,16 @@ func (ls *LogService) ProviderDailyStats(platform string) ([]ProviderDailyStat,
 			"reasoning_tokens",
 			"cache_create_tokens",
 			"cache_read_tokens",
+			"ephemeral_5m_tokens",
+			"ephemeral_1h_tokens",
+			"has_pricing",
+			"input_cost",
+			"output_cost",
+			"cache_create_cost",
+			"cache_read_cost",
+			"ephemeral_5m_cost",
+			"ephemeral_1h_cost",
+			"total_cost",
 			"created_at",
 		),
 	}
@@ -327,6 +448,10 @@ func (ls *LogService) ProviderDailyStats(platform string) ([]ProviderDailyStat,
 		}
 		return nil, err
 	}
+	tiered, err := loadTieredPricing(start)
+	if err != nil {
+		return nil, err
+	}
 	statMap := map[string]*ProviderDailyStat{}
 	for _, record := range records {
 		provider := strings.TrimSpace(record.GetString("provider"))
@@ -360,8 +485,9 @@ func (ls *LogService) ProviderDailyStats(platform string) ([]ProviderDailyStat,
 			OutputTokens:      output,
 			CacheCreateTokens: cacheCreate,
 			CacheReadTokens:   cacheRead,
+			CacheCreation:     recordCacheCreation(record),
 		}
-		cost := ls.calculateCost(record.GetString("model"), usage)
+		cost := tiered.apply(record.GetInt64("id"), ls.recordCost(record, usage))
 		stat.TotalRequests++
 		// 只有 HTTP 200-299 才算成功，其他（包括 0）都算失败
 		if httpCode >= 200 && httpCode < 300 {
@@ -376,11 +502,13 @@ func (ls *LogService) ProviderDailyStats(platform string) ([]ProviderDailyStat,
 		stat.CacheReadTokens += int64(cacheRead)
 		stat.CostTotal += cost.TotalCost
 	}
+	notes := ls.providerService.providerNotes(platform)
 	stats := make([]ProviderDailyStat, 0, len(statMap))
 	for _, stat := range statMap {
 		if stat.TotalRequests > 0 {
 			stat.SuccessRate = float64(stat.SuccessfulRequests) / float64(stat.TotalRequests)
 		}
+		stat.Note = notes[stat.Provider]
 		stats = append(stats, *stat)
 	}
 	sort.Slice(stats, func(i, j int) bool {
@@ -392,6 +520,100 @@ func (ls *LogService) ProviderDailyStats(platform string) ([]ProviderDailyStat,
 	return stats, nil
 }
 
+// unknownModelBucket 未指定模型的请求在统计中的分组名
+const unknownModelBucket = "(unknown)"
+
+// ModelStats 按模型统计最近 days 天的请求数、token 用量和费用（按请求数降序）
+// 历史记录中 model 为空的请求归入 "(unknown)"
+func (ls *LogService) ModelStats(platform string, days int) ([]ModelStat, error) {
+	if days <= 0 {
+		days = 30
+	}
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	since := startOfDay(time.Now()).AddDate(0, 0, -(days - 1))
+	query := `SELECT
+		CASE WHEN TRIM(COALESCE(model, '')) = '' THEN ? ELSE TRIM(model) END AS model_key,
+		COUNT(*),
+		SUM(CASE WHEN http_code >= 200 AND http_code < 300 THEN 1 ELSE 0 END),
+		COALESCE(SUM(input_tokens), 0),
+		COALESCE(SUM(output_tokens), 0),
+		COALESCE(SUM(reasoning_tokens), 0),
+		COALESCE(SUM(cache_create_tokens), 0),
+		COALESCE(SUM(cache_read_tokens), 0),
+		COALESCE(SUM(ephemeral_5m_tokens), 0),
+		COALESCE(SUM(ephemeral_1h_tokens), 0)
+	FROM request_log
+	WHERE created_at >= ?`
+	args := []any{unknownModelBucket, since.Format(timeLayout)}
+	if platform != "" {
+		query += " AND platform = ?"
+		args = append(args, platform)
+	}
+	query += " GROUP BY model_key"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []ModelStat{}, nil
+		}
+		return nil, fmt.Errorf("统计模型用量失败: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make([]ModelStat, 0)
+	for rows.Next() {
+		var stat ModelStat
+		var ephemeral5m, ephemeral1h int64
+		if err := rows.Scan(
+			&stat.Model,
+			&stat.TotalRequests,
+			&stat.SuccessfulRequests,
+			&stat.InputTokens,
+			&stat.OutputTokens,
+			&stat.ReasoningTokens,
+			&stat.CacheCreateTokens,
+			&stat.CacheReadTokens,
+			&ephemeral5m,
+			&ephemeral1h,
+		); err != nil {
+			return nil, fmt.Errorf("读取模型统计失败: %w", err)
+		}
+		if stat.Model != unknownModelBucket {
+			stat.CostTotal = ls.calculateCost(stat.Model, modelpricing.UsageSnapshot{
+				InputTokens:       int(stat.InputTokens),
+				OutputTokens:      int(stat.OutputTokens),
+				CacheCreateTokens: int(stat.CacheCreateTokens),
+				CacheReadTokens:   int(stat.CacheReadTokens),
+				CacheCreation:     cacheCreationDetail(int(ephemeral5m), int(ephemeral1h)),
+			}).TotalCost
+		}
+		stats = append(stats, stat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取模型统计失败: %w", err)
+	}
+	tiered, err := loadTieredPricing(since)
+	if err != nil {
+		return nil, err
+	}
+	adjustments := tiered.costAdjustments(ls, platform)
+	for i := range stats {
+		stats[i].CostTotal += adjustments[stats[i].Model]
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].TotalRequests == stats[j].TotalRequests {
+			return stats[i].Model < stats[j].Model
+		}
+		return stats[i].TotalRequests > stats[j].TotalRequests
+	})
+	return stats, nil
+}
+
 func (ls *LogService) decorateCost(logEntry *ReqeustLog) {
 	if ls == nil || ls.pricing == nil || logEntry == nil {
 		return
@@ -401,8 +623,12 @@ func (ls *LogService) decorateCost(logEntry *ReqeustLog) {
 		OutputTokens:      logEntry.OutputTokens,
 		CacheCreateTokens: logEntry.CacheCreateTokens,
 		CacheReadTokens:   logEntry.CacheReadTokens,
+		CacheCreation:     cacheCreationDetail(logEntry.Ephemeral5mTokens, logEntry.Ephemeral1hTokens),
 	}
-	cost := ls.pricing.CalculateCost(logEntry.Model, usage)
+	setLogCost(logEntry, effectivePricing(ls.pricing).CalculateCost(logEntry.Model, usage))
+}
+
+func setLogCost(logEntry *ReqeustLog, cost modelpricing.CostBreakdown) {
 	logEntry.HasPricing = cost.HasPricing
 	logEntry.InputCost = cost.InputCost
 	logEntry.OutputCost = cost.OutputCost
@@ -413,11 +639,34 @@ func (ls *LogService) decorateCost(logEntry *ReqeustLog) {
 	logEntry.TotalCost = cost.TotalCost
 }
 
+// cacheCreationDetail 构造缓存创建 tokens 的 TTL 细分；旧记录无细分时返回 nil，按 5 分钟缓存计费
+func cacheCreationDetail(ephemeral5m, ephemeral1h int) *modelpricing.CacheCreationDetail {
+	if ephemeral5m == 0 && ephemeral1h == 0 {
+		return nil
+	}
+	return &modelpricing.CacheCreationDetail{
+		Ephemeral5mTokens: ephemeral5m,
+		Ephemeral1hTokens: ephemeral1h,
+	}
+}
+
+func recordCacheCreation(record xdb.Record) *modelpricing.CacheCreationDetail {
+	return cacheCreationDetail(record.GetInt("ephemeral_5m_tokens"), record.GetInt("ephemeral_1h_tokens"))
+}
+
 func (ls *LogService) calculateCost(model string, usage modelpricing.UsageSnapshot) modelpricing.CostBreakdown {
 	if ls == nil || ls.pricing == nil {
 		return modelpricing.CostBreakdown{}
 	}
-	return ls.pricing.CalculateCost(model, usage)
+	return effectivePricing(ls.pricing).CalculateCost(model, usage)
+}
+
+// recordCost 优先使用写入日志时保存的费用，旧记录或当时没有单价的记录按当前单价计算
+func (ls *LogService) recordCost(record xdb.Record, usage modelpricing.UsageSnapshot) modelpricing.CostBreakdown {
+	if cost, ok := storedRecordCost(record); ok {
+		return cost
+	}
+	return ls.calculateCost(record.GetString("model"), usage)
 }
 
 func parseCreatedAt(record xdb.Record) (time.Time, bool) {
@@ -522,6 +771,7 @@ type LogStats struct {
 
 type ProviderDailyStat struct {
 	Provider          string  `json:"provider"`
+	Note              string  `json:"note,omitempty"`
 	TotalRequests     int64   `json:"total_requests"`
 	SuccessfulRequests int64   `json:"successful_requests"`
 	FailedRequests    int64   `json:"failed_requests"`
@@ -534,6 +784,18 @@ type ProviderDailyStat struct {
 	CostTotal         float64 `json:"cost_total"`
 }
 
+type ModelStat struct {
+	Model              string  `json:"model"`
+	TotalRequests      int64   `json:"total_requests"`
+	SuccessfulRequests int64   `json:"successful_requests"`
+	InputTokens        int64   `json:"input_tokens"`
+	OutputTokens       int64   `json:"output_tokens"`
+	ReasoningTokens    int64   `json:"reasoning_tokens"`
+	CacheCreateTokens  int64   `json:"cache_create_tokens"`
+	CacheReadTokens    int64   `json:"cache_read_tokens"`
+	CostTotal          float64 `json:"cost_total"`
+}
+
 type LogStatsSeries struct {
 	Day               string  `json:"day"`
 	TotalRequests     int64   `json:"total_requests"`
@@ -0,0 +1,422 @@
+package services
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func insertTestRequestLog(t *testing.T, record xdb.Record) {
+	t.Helper()
+	if _, err := xdb.New("request_log").Insert(record); err != nil {
+		t.Fatalf("写入测试日志失败: %v", err)
+	}
+}
+
+func TestQueryLogsComputesCost(t *testing.T) {
+	setupTestEnv(t)
+
+	insertTestRequestLog(t, xdb.Record{
+		"platform":          "claude",
+		"model":             "claude-sonnet-4-20250514",
+		"provider":          "official",
+		"http_code":         200,
+		"input_tokens":      1000,
+		"output_tokens":     500,
+		"cache_read_tokens": 2000,
+	})
+	insertTestRequestLog(t, xdb.Record{
+		"platform":      "claude",
+		"model":         "totally-unknown-model",
+		"provider":      "custom",
+		"http_code":     200,
+		"input_tokens":  1000,
+		"output_tokens": 500,
+	})
+
+	ls := NewLogService()
+	logs, err := ls.QueryLogs(RequestLogQuery{Platform: "claude"})
+	if err != nil {
+		t.Fatalf("查询日志失败: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("日志条数 = %d, 期望 2", len(logs))
+	}
+
+	byModel := map[string]ReqeustLog{}
+	for _, entry := range logs {
+		byModel[entry.Model] = entry
+	}
+
+	priced := byModel["claude-sonnet-4-20250514"]
+	if !priced.HasPricing {
+		t.Fatalf("已知模型应有价格")
+	}
+	if math.Abs(priced.InputCost-0.003) > 1e-9 || math.Abs(priced.OutputCost-0.0075) > 1e-9 {
+		t.Fatalf("费用计算错误: input=%v output=%v", priced.InputCost, priced.OutputCost)
+	}
+	if priced.CacheReadCost <= 0 {
+		t.Fatalf("缓存读取费用应大于 0")
+	}
+	sum := priced.InputCost + priced.OutputCost + priced.CacheCreateCost + priced.CacheReadCost
+	if math.Abs(priced.TotalCost-sum) > 1e-9 {
+		t.Fatalf("TotalCost = %v, 各项之和 = %v", priced.TotalCost, sum)
+	}
+
+	unknown := byModel["totally-unknown-model"]
+	if unknown.HasPricing || unknown.TotalCost != 0 {
+		t.Fatalf("未知模型不应计价: %+v", unknown)
+	}
+
+	filtered, err := ls.QueryLogs(RequestLogQuery{Provider: "custom"})
+	if err != nil || len(filtered) != 1 || filtered[0].Provider != "custom" {
+		t.Fatalf("按 provider 过滤失败: %v %+v", err, filtered)
+	}
+}
+
+func TestModelStatsGroupsByModel(t *testing.T) {
+	setupTestEnv(t)
+
+	for i := 0; i < 2; i++ {
+		insertTestRequestLog(t, xdb.Record{
+			"platform":      "claude",
+			"model":         "claude-sonnet-4-20250514",
+			"provider":      "official",
+			"http_code":     200,
+			"input_tokens":  1000,
+			"output_tokens": 500,
+		})
+	}
+	insertTestRequestLog(t, xdb.Record{"platform": "claude", "model": "", "provider": "official", "http_code": 502})
+	insertTestRequestLog(t, xdb.Record{"platform": "codex", "model": "gpt-5", "provider": "openai", "http_code": 200})
+
+	stats, err := NewLogService().ModelStats("claude", 7)
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("模型数 = %d, 期望 2: %+v", len(stats), stats)
+	}
+
+	sonnet := stats[0]
+	if sonnet.Model != "claude-sonnet-4-20250514" || sonnet.TotalRequests != 2 || sonnet.SuccessfulRequests != 2 {
+		t.Fatalf("sonnet 统计不正确: %+v", sonnet)
+	}
+	if sonnet.InputTokens != 2000 || math.Abs(sonnet.CostTotal-(0.006+0.015)) > 1e-9 {
+		t.Fatalf("sonnet 用量或费用不正确: %+v", sonnet)
+	}
+	if unknown := stats[1]; unknown.Model != unknownModelBucket || unknown.TotalRequests != 1 || unknown.SuccessfulRequests != 0 {
+		t.Fatalf("空模型应归入 (unknown): %+v", unknown)
+	}
+}
+
+func insertCostLog(t *testing.T, model string, at time.Time) {
+	t.Helper()
+	insertTestRequestLog(t, xdb.Record{
+		"platform":      "claude",
+		"model":         model,
+		"provider":      "official",
+		"http_code":     200,
+		"input_tokens":  1000,
+		"output_tokens": 500,
+		"created_at":    at.UTC().Format(timeLayout),
+	})
+}
+
+func TestProjectMonthlyCost(t *testing.T) {
+	setupTestEnv(t)
+
+	// 每天中午一次 sonnet 请求（0.0105），从 2 月 26 日到 3 月 10 日
+	const perRequest = 0.003 + 0.0075
+	// 固定时区，避免夏令时切换影响天数计算
+	zone := time.FixedZone("UTC+8", 8*3600)
+	now := time.Date(2025, 3, 11, 0, 0, 0, 0, zone)
+	for day := time.Date(2025, 2, 26, 12, 0, 0, 0, zone); day.Before(now); day = day.AddDate(0, 0, 1) {
+		insertCostLog(t, "claude-sonnet-4-20250514", day)
+	}
+	insertCostLog(t, "totally-unknown-model", now.Add(-time.Hour))
+
+	projection, err := NewLogService().projectMonthlyCost(now)
+	if err != nil {
+		t.Fatalf("预测失败: %v", err)
+	}
+	if projection.Month != "2025-03" || projection.DaysInMonth != 31 || projection.DaysElapsed != 10 || projection.DaysRemaining != 21 {
+		t.Fatalf("月份信息不正确: %+v", projection)
+	}
+	if projection.SampleDays != 7 || projection.Confidence != "high" {
+		t.Fatalf("样本天数或可信度不正确: %+v", projection)
+	}
+	// 本月已花费 10 次；近 7 天日均 1 次；剩余 21 天
+	if math.Abs(projection.SpentToDate-10*perRequest) > 1e-9 ||
+		math.Abs(projection.DailyAverage-perRequest) > 1e-9 ||
+		math.Abs(projection.ProjectedTotal-(10+21)*perRequest) > 1e-9 {
+		t.Fatalf("预测费用不正确: %+v", projection)
+	}
+	if len(projection.Breakdown) != 2 || projection.Breakdown[0].Model != "claude-sonnet-4-20250514" || projection.Breakdown[0].Requests != 10 {
+		t.Fatalf("按模型拆分不正确: %+v", projection.Breakdown)
+	}
+	if unknown := projection.Breakdown[1]; unknown.Model != "totally-unknown-model" || unknown.ProjectedTotal != 0 {
+		t.Fatalf("未知模型不应计价: %+v", unknown)
+	}
+}
+
+func TestProjectMonthlyCostSparseData(t *testing.T) {
+	setupTestEnv(t)
+
+	now := time.Date(2025, 3, 2, 12, 0, 0, 0, time.FixedZone("UTC+8", 8*3600))
+	ls := NewLogService()
+	empty, err := ls.projectMonthlyCost(now)
+	if err != nil {
+		t.Fatalf("预测失败: %v", err)
+	}
+	if empty.ProjectedTotal != 0 || empty.Confidence != "none" || len(empty.Breakdown) != 0 {
+		t.Fatalf("没有数据时预测应为 0: %+v", empty)
+	}
+
+	// 月初只有 6 小时前的一次请求：日均按 1 天计算，而不是按 6 小时外推
+	const perRequest = 0.003 + 0.0075
+	insertCostLog(t, "claude-sonnet-4-20250514", now.Add(-6*time.Hour))
+	projection, err := ls.projectMonthlyCost(now)
+	if err != nil {
+		t.Fatalf("预测失败: %v", err)
+	}
+	if projection.SampleDays != 1 || projection.Confidence != "low" {
+		t.Fatalf("稀疏数据的样本天数或可信度不正确: %+v", projection)
+	}
+	if math.Abs(projection.ProjectedTotal-(1+29.5)*perRequest) > 1e-9 {
+		t.Fatalf("预测费用 = %v, 期望 %v", projection.ProjectedTotal, (1+29.5)*perRequest)
+	}
+}
+
+func TestTieredPricingCrossesBoundaryWithinMonth(t *testing.T) {
+	setupTestEnv(t)
+
+	// 每次请求 1500 tokens；本月累计超过 2000 tokens 后按 5 折计费
+	if err := NewProviderService().SaveProviders("claude", []Provider{
+		{ID: 1, Name: "volume", APIURL: "https://volume.example.com", APIKey: "sk-test", Enabled: true, Level: 1,
+			PricingTiers: []PricingTier{{AboveTokens: 2000, Multiplier: 0.5}}},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	insert := func(provider string, at time.Time) {
+		insertTestRequestLog(t, xdb.Record{
+			"platform":      "claude",
+			"model":         "claude-sonnet-4-20250514",
+			"provider":      provider,
+			"http_code":     200,
+			"input_tokens":  1000,
+			"output_tokens": 500,
+			"created_at":    at.UTC().Format(timeLayout),
+		})
+	}
+	const perRequest = 0.003 + 0.0075
+	now := time.Date(2025, 3, 20, 12, 0, 0, 0, time.Local)
+	insert("volume", time.Date(2025, 2, 27, 12, 0, 0, 0, time.Local)) // 上月用量不计入本月累计
+	insert("volume", now.AddDate(0, 0, -5))                           // 0-1500：标价
+	insert("volume", now.AddDate(0, 0, -4))                           // 1500-3000：500 标价 + 1000 五折
+	insert("volume", now.AddDate(0, 0, -3))                           // 3000-4500：五折
+	insert("official", now.AddDate(0, 0, -2))                         // 未配置阶梯：标价
+
+	logs, err := NewLogService().QueryLogs(RequestLogQuery{Provider: "volume"})
+	if err != nil || len(logs) != 4 {
+		t.Fatalf("查询日志失败: %v, %d 条", err, len(logs))
+	}
+	// 按 id 降序：本月第 3、2、1 次，上月 1 次
+	expected := []float64{0.5, 2.0 / 3, 1, 1}
+	for i, entry := range logs {
+		if math.Abs(entry.TotalCost-perRequest*expected[i]) > 1e-9 {
+			t.Fatalf("第 %d 条费用 = %v, 期望 %v", i, entry.TotalCost, perRequest*expected[i])
+		}
+	}
+	if sum := logs[1].InputCost + logs[1].OutputCost + logs[1].CacheCreateCost + logs[1].CacheReadCost; math.Abs(logs[1].TotalCost-sum) > 1e-9 {
+		t.Fatalf("阶梯计价后各项之和应等于 TotalCost: %+v", logs[1])
+	}
+
+	projection, err := NewLogService().projectMonthlyCost(now)
+	if err != nil {
+		t.Fatalf("预测失败: %v", err)
+	}
+	if want := perRequest * (1 + 2.0/3 + 0.5 + 1); math.Abs(projection.SpentToDate-want) > 1e-9 {
+		t.Fatalf("本月已花费 = %v, 期望 %v", projection.SpentToDate, want)
+	}
+}
+
+func TestSeedMockDataRequiresDevMode(t *testing.T) {
+	setupTestEnv(t)
+	ls := NewLogService()
+
+	t.Setenv(devModeEnv, "")
+	if _, err := ls.SeedMockData(1); err == nil {
+		t.Fatalf("未开启开发模式时不应写入模拟数据")
+	}
+
+	t.Setenv(devModeEnv, "1")
+	inserted, err := ls.SeedMockData(1)
+	if err != nil || inserted == 0 {
+		t.Fatalf("写入模拟数据失败: %d, %v", inserted, err)
+	}
+	logs, err := ls.QueryLogs(RequestLogQuery{Limit: inserted + 10})
+	if err != nil || len(logs) != inserted {
+		t.Fatalf("写入条数应与返回值一致: %d != %d, %v", len(logs), inserted, err)
+	}
+	daily, err := NewLogStatsService().DailyTokenTotals("", 30)
+	if err != nil || len(daily) == 0 {
+		t.Fatalf("模拟数据应出现在每日统计中: %v, %v", daily, err)
+	}
+
+	t.Setenv(devModeEnv, "")
+	if _, err := ls.ClearLogs(); err == nil {
+		t.Fatalf("未开启开发模式时不应清空日志")
+	}
+
+	t.Setenv(devModeEnv, "1")
+	deleted, err := ls.ClearLogs()
+	if err != nil || deleted != int64(inserted) {
+		t.Fatalf("ClearLogs = %d, %v, 期望 %d", deleted, err, inserted)
+	}
+}
+
+func TestPruneOldLogs(t *testing.T) {
+	setupTestEnv(t)
+
+	now := time.Now().UTC()
+	for _, age := range []time.Duration{0, 10 * 24 * time.Hour, 100 * 24 * time.Hour, 400 * 24 * time.Hour} {
+		insertTestRequestLog(t, xdb.Record{
+			"platform":   "claude",
+			"provider":   "official",
+			"http_code":  200,
+			"created_at": now.Add(-age).Format(timeLayout),
+		})
+	}
+	count := func() int {
+		db, err := xdb.DB("default")
+		if err != nil {
+			t.Fatalf("获取数据库失败: %v", err)
+		}
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM request_log").Scan(&n); err != nil {
+			t.Fatalf("统计 request_log 失败: %v", err)
+		}
+		return n
+	}
+
+	ls := &LogService{}
+	if _, err := ls.PruneOldLogs(0); err == nil {
+		t.Fatalf("保留天数为 0 时应报错")
+	}
+
+	// 默认保留 90 天
+	settings := &SettingsService{}
+	if days, err := settings.GetLogRetentionDays(); err != nil || days != DefaultLogRetentionDays {
+		t.Fatalf("未配置时应返回默认保留天数: %d, %v", days, err)
+	}
+	if deleted, err := ls.PruneExpiredLogs(); err != nil || deleted != 2 || count() != 2 {
+		t.Fatalf("应删除 90 天前的 2 条日志: deleted=%d, err=%v, 剩余 %d", deleted, err, count())
+	}
+
+	if err := settings.SetLogRetentionDays(-1); err == nil {
+		t.Fatalf("负数保留天数应被拒绝")
+	}
+	if err := settings.SetLogRetentionDays(0); err != nil {
+		t.Fatalf("设置保留天数失败: %v", err)
+	}
+	if deleted, err := ls.PruneExpiredLogs(); err != nil || deleted != 0 {
+		t.Fatalf("保留天数为 0 时不应清理: deleted=%d, err=%v", deleted, err)
+	}
+
+	if deleted, err := ls.PruneOldLogs(7); err != nil || deleted != 1 || count() != 1 {
+		t.Fatalf("应删除 7 天前的日志: deleted=%d, err=%v, 剩余 %d", deleted, err, count())
+	}
+}
+
+func TestRequestLogDisabledWritesNoRows(t *testing.T) {
+	setupTestEnv(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"usage":{"input_tokens":3,"output_tokens":5}}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "upstream", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	countRows := func() int {
+		db, err := xdb.DB("default")
+		if err != nil {
+			t.Fatalf("获取数据库失败: %v", err)
+		}
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM request_log").Scan(&count); err != nil {
+			t.Fatalf("统计 request_log 失败: %v", err)
+		}
+		return count
+	}
+	send := func() {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4","messages":[]}`))
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+		}
+	}
+
+	send()
+	if got := countRows(); got != 1 {
+		t.Fatalf("默认开启时应写入 1 条日志，实际 %d", got)
+	}
+
+	if err := relay.settingsService.SetRequestLogEnabled(false); err != nil {
+		t.Fatalf("关闭请求日志失败: %v", err)
+	}
+	send()
+	if got := countRows(); got != 1 {
+		t.Fatalf("关闭请求日志后不应写入新记录，实际 %d", got)
+	}
+
+	// Gemini 流式请求同样不写日志，响应原样转发
+	stream := "data: {\"usageMetadata\":{\"promptTokenCount\":3,\"candidatesTokenCount\":5}}\n\n"
+	gemini := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte(stream))
+	}))
+	defer gemini.Close()
+	relay.geminiService = NewGeminiService(relay.addr)
+	if err := relay.geminiService.AddProvider(GeminiProvider{ID: "g1", Name: "gemini", BaseURL: gemini.URL, APIKey: "key", Enabled: true}); err != nil {
+		t.Fatalf("添加 provider 失败: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/gemini/v1beta/models/gemini-2.5-pro:streamGenerateContent?alt=sse", strings.NewReader(`{"contents":[]}`)))
+	if rec.Code != http.StatusOK || rec.Body.String() != stream {
+		t.Fatalf("关闭请求日志后 Gemini 流式响应应原样转发: %d %q", rec.Code, rec.Body.String())
+	}
+	if got := countRows(); got != 1 {
+		t.Fatalf("关闭请求日志后 Gemini 请求不应写入新记录，实际 %d", got)
+	}
+
+	// 重新开启后立即恢复写入，无需重启
+	if err := relay.settingsService.SetRequestLogEnabled(true); err != nil {
+		t.Fatalf("开启请求日志失败: %v", err)
+	}
+	send()
+	if got := countRows(); got != 2 {
+		t.Fatalf("重新开启请求日志后应恢复写入，实际 %d", got)
+	}
+
+	deleted, err := NewLogService().PurgeRequestLog()
+	if err != nil || deleted != 2 {
+		t.Fatalf("PurgeRequestLog = %d, %v", deleted, err)
+	}
+	if got := countRows(); got != 0 {
+		t.Fatalf("清空后应无记录，实际 %d", got)
+	}
+}
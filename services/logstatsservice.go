@@ -0,0 +1,225 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// LogStatsService 基于分组 SQL 的请求日志聚合查询，供前端热力图和统计视图绑定
+// 只统计请求数与 token 用量；费用相关统计（含阶梯计价）见 LogService
+//
+// created_at 由 SQLite CURRENT_TIMESTAMP 写入，为 UTC 时间：
+// 查询范围换算为 UTC 比较，按天分组时换算为本地日期
+type LogStatsService struct{}
+
+func NewLogStatsService() *LogStatsService {
+	return &LogStatsService{}
+}
+
+// DailyTokenTotal 某一本地自然日的用量
+type DailyTokenTotal struct {
+	Day               string `json:"day"` // 本地日期，2006-01-02
+	TotalRequests     int64  `json:"total_requests"`
+	InputTokens       int64  `json:"input_tokens"`
+	OutputTokens      int64  `json:"output_tokens"`
+	ReasoningTokens   int64  `json:"reasoning_tokens"`
+	CacheCreateTokens int64  `json:"cache_create_tokens"`
+	CacheReadTokens   int64  `json:"cache_read_tokens"`
+}
+
+// ProviderUsage 某个平台下单个 provider 在时间范围内的用量
+type ProviderUsage struct {
+	Platform           string  `json:"platform"`
+	Provider           string  `json:"provider"`
+	TotalRequests      int64   `json:"total_requests"`
+	SuccessfulRequests int64   `json:"successful_requests"`
+	FailedRequests     int64   `json:"failed_requests"`
+	InputTokens        int64   `json:"input_tokens"`
+	OutputTokens       int64   `json:"output_tokens"`
+	ReasoningTokens    int64   `json:"reasoning_tokens"`
+	CacheCreateTokens  int64   `json:"cache_create_tokens"`
+	CacheReadTokens    int64   `json:"cache_read_tokens"`
+	AvgDurationSec     float64 `json:"avg_duration_sec"`
+}
+
+// ModelUsageStat 单个模型的累计用量
+type ModelUsageStat struct {
+	Model              string `json:"model"`
+	TotalRequests      int64  `json:"total_requests"`
+	SuccessfulRequests int64  `json:"successful_requests"`
+	InputTokens        int64  `json:"input_tokens"`
+	OutputTokens       int64  `json:"output_tokens"`
+	ReasoningTokens    int64  `json:"reasoning_tokens"`
+	CacheCreateTokens  int64  `json:"cache_create_tokens"`
+	CacheReadTokens    int64  `json:"cache_read_tokens"`
+}
+
+// DailyTokenTotals 按本地自然日汇总最近 days 天（含今天，默认 30 天）的用量，按日期升序
+// platform 为空时统计全部平台；没有请求的日期不返回
+func (s *LogStatsService) DailyTokenTotals(platform string, days int) ([]DailyTokenTotal, error) {
+	if days <= 0 {
+		days = 30
+	}
+	since := startOfDay(time.Now()).AddDate(0, 0, -(days - 1))
+	query := `SELECT
+		date(created_at, 'localtime') AS day,
+		COUNT(*),
+		COALESCE(SUM(input_tokens), 0),
+		COALESCE(SUM(output_tokens), 0),
+		COALESCE(SUM(reasoning_tokens), 0),
+		COALESCE(SUM(cache_create_tokens), 0),
+		COALESCE(SUM(cache_read_tokens), 0)
+	FROM request_log
+	WHERE created_at >= ?`
+	args := []any{since.UTC().Format(timeLayout)}
+	if platform != "" {
+		query += " AND platform = ?"
+		args = append(args, platform)
+	}
+	query += " GROUP BY day ORDER BY day"
+
+	totals := make([]DailyTokenTotal, 0)
+	err := queryLogStats(query, args, func(rows *sql.Rows) error {
+		var item DailyTokenTotal
+		if err := rows.Scan(
+			&item.Day,
+			&item.TotalRequests,
+			&item.InputTokens,
+			&item.OutputTokens,
+			&item.ReasoningTokens,
+			&item.CacheCreateTokens,
+			&item.CacheReadTokens,
+		); err != nil {
+			return err
+		}
+		totals = append(totals, item)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询每日用量失败: %w", err)
+	}
+	return totals, nil
+}
+
+// ProviderBreakdown 按平台和 provider 汇总 [start, end) 内的用量，按请求数降序
+// start 为零值时不限制起点，end 为零值时统计到当前
+func (s *LogStatsService) ProviderBreakdown(start, end time.Time) ([]ProviderUsage, error) {
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		return nil, fmt.Errorf("结束时间不能早于开始时间")
+	}
+	query := `SELECT
+		COALESCE(platform, ''),
+		COALESCE(provider, ''),
+		COUNT(*),
+		SUM(CASE WHEN http_code >= 200 AND http_code < 300 THEN 1 ELSE 0 END),
+		COALESCE(SUM(input_tokens), 0),
+		COALESCE(SUM(output_tokens), 0),
+		COALESCE(SUM(reasoning_tokens), 0),
+		COALESCE(SUM(cache_create_tokens), 0),
+		COALESCE(SUM(cache_read_tokens), 0),
+		COALESCE(AVG(duration_sec), 0)
+	FROM request_log
+	WHERE 1 = 1`
+	var args []any
+	if !start.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, start.UTC().Format(timeLayout))
+	}
+	if !end.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, end.UTC().Format(timeLayout))
+	}
+	query += " GROUP BY 1, 2 ORDER BY 3 DESC, 1, 2"
+
+	usage := make([]ProviderUsage, 0)
+	err := queryLogStats(query, args, func(rows *sql.Rows) error {
+		var item ProviderUsage
+		if err := rows.Scan(
+			&item.Platform,
+			&item.Provider,
+			&item.TotalRequests,
+			&item.SuccessfulRequests,
+			&item.InputTokens,
+			&item.OutputTokens,
+			&item.ReasoningTokens,
+			&item.CacheCreateTokens,
+			&item.CacheReadTokens,
+			&item.AvgDurationSec,
+		); err != nil {
+			return err
+		}
+		item.FailedRequests = item.TotalRequests - item.SuccessfulRequests
+		usage = append(usage, item)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询 provider 用量失败: %w", err)
+	}
+	return usage, nil
+}
+
+// ModelUsage 按模型汇总全部历史用量，按请求数降序；platform 为空时统计全部平台
+// model 为空的请求归入 "(unknown)"
+func (s *LogStatsService) ModelUsage(platform string) ([]ModelUsageStat, error) {
+	query := `SELECT
+		CASE WHEN TRIM(COALESCE(model, '')) = '' THEN ? ELSE TRIM(model) END AS model_key,
+		COUNT(*),
+		SUM(CASE WHEN http_code >= 200 AND http_code < 300 THEN 1 ELSE 0 END),
+		COALESCE(SUM(input_tokens), 0),
+		COALESCE(SUM(output_tokens), 0),
+		COALESCE(SUM(reasoning_tokens), 0),
+		COALESCE(SUM(cache_create_tokens), 0),
+		COALESCE(SUM(cache_read_tokens), 0)
+	FROM request_log`
+	args := []any{unknownModelBucket}
+	if platform != "" {
+		query += " WHERE platform = ?"
+		args = append(args, platform)
+	}
+	query += " GROUP BY model_key ORDER BY 2 DESC, model_key"
+
+	stats := make([]ModelUsageStat, 0)
+	err := queryLogStats(query, args, func(rows *sql.Rows) error {
+		var item ModelUsageStat
+		if err := rows.Scan(
+			&item.Model,
+			&item.TotalRequests,
+			&item.SuccessfulRequests,
+			&item.InputTokens,
+			&item.OutputTokens,
+			&item.ReasoningTokens,
+			&item.CacheCreateTokens,
+			&item.CacheReadTokens,
+		); err != nil {
+			return err
+		}
+		stats = append(stats, item)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询模型用量失败: %w", err)
+	}
+	return stats, nil
+}
+
+// queryLogStats 执行聚合查询并逐行回调
+func queryLogStats(query string, args []any, scan func(rows *sql.Rows) error) error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestLogStatsServiceAggregates(t *testing.T) {
+	setupTestEnv(t)
+	stats := NewLogStatsService()
+
+	// 空表：返回空切片而不是 nil
+	daily, err := stats.DailyTokenTotals("", 7)
+	if err != nil || daily == nil || len(daily) != 0 {
+		t.Fatalf("空表应返回空切片: %#v, %v", daily, err)
+	}
+	providers, err := stats.ProviderBreakdown(time.Time{}, time.Time{})
+	if err != nil || providers == nil || len(providers) != 0 {
+		t.Fatalf("空表应返回空切片: %#v, %v", providers, err)
+	}
+	models, err := stats.ModelUsage("")
+	if err != nil || models == nil || len(models) != 0 {
+		t.Fatalf("空表应返回空切片: %#v, %v", models, err)
+	}
+
+	today := startOfDay(time.Now()).Add(time.Hour)
+	yesterday := today.AddDate(0, 0, -1)
+	old := today.AddDate(0, 0, -30)
+	insert := func(platform, provider, model string, code, input int, at time.Time) {
+		insertTestRequestLog(t, xdb.Record{
+			"platform":      platform,
+			"provider":      provider,
+			"model":         model,
+			"http_code":     code,
+			"input_tokens":  input,
+			"output_tokens": input / 2,
+			"duration_sec":  2,
+			"created_at":    at.UTC().Format(timeLayout),
+		})
+	}
+	insert("claude", "official", "claude-sonnet-4", 200, 100, today)
+	insert("claude", "official", "claude-sonnet-4", 502, 0, today)
+	insert("claude", "backup", "", 200, 40, yesterday)
+	insert("codex", "openai", "gpt-5", 200, 10, today)
+	insert("claude", "official", "claude-sonnet-4", 200, 1000, old)
+
+	daily, err = stats.DailyTokenTotals("claude", 7)
+	if err != nil {
+		t.Fatalf("查询每日用量失败: %v", err)
+	}
+	if len(daily) != 2 {
+		t.Fatalf("应返回 2 天的数据: %+v", daily)
+	}
+	if daily[0].Day != yesterday.Format("2006-01-02") || daily[0].InputTokens != 40 {
+		t.Fatalf("昨天的用量不正确: %+v", daily[0])
+	}
+	if daily[1].Day != today.Format("2006-01-02") || daily[1].TotalRequests != 2 || daily[1].InputTokens != 100 || daily[1].OutputTokens != 50 {
+		t.Fatalf("今天的用量不正确（应按本地日期分组）: %+v", daily[1])
+	}
+
+	providers, err = stats.ProviderBreakdown(startOfDay(yesterday), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("查询 provider 用量失败: %v", err)
+	}
+	if len(providers) != 3 {
+		t.Fatalf("范围内应有 3 个 provider: %+v", providers)
+	}
+	official := providers[0]
+	if official.Platform != "claude" || official.Provider != "official" || official.TotalRequests != 2 ||
+		official.SuccessfulRequests != 1 || official.FailedRequests != 1 || official.AvgDurationSec != 2 {
+		t.Fatalf("official 统计不正确（不应包含范围外的记录）: %+v", official)
+	}
+	if _, err := stats.ProviderBreakdown(today, yesterday); err == nil {
+		t.Fatalf("结束时间早于开始时间应返回错误")
+	}
+
+	models, err = stats.ModelUsage("claude")
+	if err != nil {
+		t.Fatalf("查询模型用量失败: %v", err)
+	}
+	if len(models) != 2 || models[0].Model != "claude-sonnet-4" || models[0].TotalRequests != 3 || models[0].InputTokens != 1100 {
+		t.Fatalf("模型用量不正确: %+v", models)
+	}
+	if models[1].Model != unknownModelBucket || models[1].TotalRequests != 1 {
+		t.Fatalf("空模型应归入 (unknown): %+v", models[1])
+	}
+}
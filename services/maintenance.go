@@ -0,0 +1,70 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaintenanceWindow provider 的一次性维护窗口 [Start, End)，窗口内不参与选择，结束后自动恢复
+//
+//	{"start": "2025-01-01T02:00:00+08:00", "end": "2025-01-01T04:00:00+08:00", "reason": "上游升级"}
+type MaintenanceWindow struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// Contains 判断 now 是否处于维护窗口内
+func (w MaintenanceWindow) Contains(now time.Time) bool {
+	return !now.Before(w.Start) && now.Before(w.End)
+}
+
+// ActiveMaintenance 返回 now 所在的维护窗口
+func (p *Provider) ActiveMaintenance(now time.Time) (MaintenanceWindow, bool) {
+	for _, w := range p.MaintenanceWindows {
+		if w.Contains(now) {
+			return w, true
+		}
+	}
+	return MaintenanceWindow{}, false
+}
+
+// validateMaintenanceWindows 校验维护窗口，返回错误描述列表
+func validateMaintenanceWindows(windows []MaintenanceWindow) []string {
+	errs := make([]string, 0)
+	for i, w := range windows {
+		if w.Start.IsZero() || w.End.IsZero() {
+			errs = append(errs, fmt.Sprintf("维护窗口 #%d 缺少开始或结束时间", i+1))
+			continue
+		}
+		if !w.End.After(w.Start) {
+			errs = append(errs, fmt.Sprintf("维护窗口 #%d 的结束时间必须晚于开始时间", i+1))
+		}
+	}
+	return errs
+}
+
+func cloneMaintenanceWindows(windows []MaintenanceWindow) []MaintenanceWindow {
+	if windows == nil {
+		return nil
+	}
+	cloned := make([]MaintenanceWindow, len(windows))
+	copy(cloned, windows)
+	return cloned
+}
+
+func formatMaintenance(w MaintenanceWindow) string {
+	text := fmt.Sprintf("维护中，预计 %s 恢复", w.End.Local().Format("01-02 15:04"))
+	if w.Reason != "" {
+		text += "（" + w.Reason + "）"
+	}
+	return text
+}
+
+// now 返回 relay 使用的当前时间
+func (prs *ProviderRelayService) now() time.Time {
+	if prs.clock == nil {
+		return systemClock.Now()
+	}
+	return prs.clock.Now()
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/tidwall/gjson"
+)
+
+func TestMaintenanceWindowSkipsProvider(t *testing.T) {
+	setupTestEnv(t)
+
+	var primaryHits, backupHits int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryHits, 1)
+		_, _ = w.Write([]byte(`{"id":"primary"}`))
+	}))
+	defer primary.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backupHits, 1)
+		_, _ = w.Write([]byte(`{"id":"backup"}`))
+	}))
+	defer backup.Close()
+
+	now := time.Date(2025, 1, 1, 2, 0, 0, 0, time.UTC)
+	clock := newFakeClock(now)
+	relay, router := newTestRelay(t)
+	relay.clock = clock
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "primary", APIURL: primary.URL, APIKey: "sk-test", Enabled: true, Level: 1,
+			MaintenanceWindows: []MaintenanceWindow{{Start: now.Add(-time.Minute), End: now.Add(time.Hour), Reason: "上游升级"}}},
+		{ID: 2, Name: "backup", APIURL: backup.URL, APIKey: "sk-test", Enabled: true, Level: 2},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	send := func() string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`))
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+		}
+		return gjson.Get(rec.Body.String(), "id").String()
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := send(); got != "backup" {
+			t.Fatalf("维护窗口内应使用 backup, 实际 %s", got)
+		}
+	}
+	if got := atomic.LoadInt32(&primaryHits); got != 0 {
+		t.Fatalf("维护中的 provider 不应收到请求, 实际 %d 次", got)
+	}
+
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatalf("获取数据库失败: %v", err)
+	}
+	var entries int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM provider_blacklist WHERE platform = ? AND provider_name = ?`, "claude", "primary").Scan(&entries); err != nil {
+		t.Fatalf("查询黑名单失败: %v", err)
+	}
+	if entries != 0 {
+		t.Fatalf("维护期间不应产生黑名单记录, 实际 %d 条", entries)
+	}
+
+	clock.Advance(time.Hour)
+	if got := send(); got != "primary" {
+		t.Fatalf("维护窗口结束后应恢复 primary, 实际 %s", got)
+	}
+
+	invalid := Provider{Name: "bad", MaintenanceWindows: []MaintenanceWindow{{Start: now, End: now.Add(-time.Hour)}}}
+	if errs := invalid.ValidateConfiguration(); len(errs) == 0 {
+		t.Fatalf("结束时间早于开始时间的维护窗口应校验失败")
+	}
+}
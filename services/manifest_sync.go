@@ -0,0 +1,552 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// manifestSyncConfigKey app_settings 中团队清单同步配置的配置键（JSON）
+	manifestSyncConfigKey = "manifest_sync_config"
+	// manifestSyncStateFile 记录上次同步时清单中各 provider 的字段值，用于识别本地修改
+	manifestSyncStateFile = "manifest-sync-state.json"
+	// ManifestSyncedEvent 每次同步后通知前端的事件名，payload 为 ManifestSyncSummary
+	ManifestSyncedEvent = "providers:manifest-synced"
+
+	// ManifestPolicyPreserveLocal 本地修改过的字段保留本地值，其余字段跟随清单（默认）
+	ManifestPolicyPreserveLocal = "preserve_local"
+	// ManifestPolicyManifestWins 清单中出现的字段一律以清单为准
+	ManifestPolicyManifestWins = "manifest_wins"
+
+	minManifestSyncInterval = 5
+	maxManifestSize         = 1 << 20
+	manifestFetchTimeout    = 15 * time.Second
+)
+
+// ManifestSyncConfig 团队清单同步配置
+type ManifestSyncConfig struct {
+	Enabled         bool   `json:"enabled"`
+	URL             string `json:"url"`             // 清单地址，必须是 https
+	IntervalMinutes int    `json:"intervalMinutes"` // 同步间隔（分钟），默认 60
+	Policy          string `json:"policy"`          // preserve_local / manifest_wins
+}
+
+// DefaultManifestSyncConfig 默认配置：关闭，每小时同步一次，保留本地修改
+func DefaultManifestSyncConfig() ManifestSyncConfig {
+	return ManifestSyncConfig{
+		IntervalMinutes: 60,
+		Policy:          ManifestPolicyPreserveLocal,
+	}
+}
+
+func (c ManifestSyncConfig) validate() error {
+	if c.Enabled || strings.TrimSpace(c.URL) != "" {
+		if err := validateManifestURL(c.URL); err != nil {
+			return err
+		}
+	}
+	if c.IntervalMinutes < minManifestSyncInterval {
+		return fmt.Errorf("同步间隔不能少于 %d 分钟", minManifestSyncInterval)
+	}
+	switch c.Policy {
+	case ManifestPolicyPreserveLocal, ManifestPolicyManifestWins:
+	default:
+		return fmt.Errorf("不支持的合并策略: %s", c.Policy)
+	}
+	return nil
+}
+
+// ManifestSyncSummary 一次同步的结果，Added/Updated 为 "平台/名称"
+type ManifestSyncSummary struct {
+	URL       string   `json:"url"`
+	SyncedAt  string   `json:"syncedAt"`
+	Added     []string `json:"added"`
+	Updated   []string `json:"updated"`
+	Unchanged int      `json:"unchanged"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// teamManifest 团队清单格式，provider 按 name 匹配，字段与本地 provider 配置一致：
+//
+//	{"claude": [{"name": "team-relay", "apiUrl": "https://relay.example.com", "level": 1, "enabled": true}], "codex": []}
+//
+// 清单中未出现的字段不做修改；id 由本地分配
+type teamManifest struct {
+	Claude []map[string]json.RawMessage `json:"claude"`
+	Codex  []map[string]json.RawMessage `json:"codex"`
+}
+
+// manifestSyncState 上次同步时清单中各 provider 的字段值：平台 -> 名称 -> 字段
+type manifestSyncState map[string]map[string]map[string]json.RawMessage
+
+// ManifestSyncService 定时从团队维护的 HTTPS 清单同步 provider（需手动开启）
+// 只新增和更新清单中的 provider，用户自己添加的 provider 以及从清单中移除的 provider 不受影响
+type ManifestSyncService struct {
+	providerService *ProviderService
+
+	mu       sync.Mutex
+	syncMu   sync.Mutex
+	timer    *time.Timer
+	onSynced []func(ManifestSyncSummary)
+	fetch    func(ctx context.Context, rawURL string) ([]byte, error)
+}
+
+func NewManifestSyncService(providerService *ProviderService) *ManifestSyncService {
+	return &ManifestSyncService{
+		providerService: providerService,
+		fetch:           fetchManifest,
+	}
+}
+
+// GetManifestSyncConfig 获取团队清单同步配置（未配置时返回默认值）
+func (ms *ManifestSyncService) GetManifestSyncConfig() (ManifestSyncConfig, error) {
+	value, found, err := getSettingValue(manifestSyncConfigKey)
+	if err != nil {
+		return ManifestSyncConfig{}, err
+	}
+	if !found || strings.TrimSpace(value) == "" {
+		return DefaultManifestSyncConfig(), nil
+	}
+	config := DefaultManifestSyncConfig()
+	if err := json.Unmarshal([]byte(value), &config); err != nil {
+		return ManifestSyncConfig{}, fmt.Errorf("解析清单同步配置失败: %w", err)
+	}
+	return config, nil
+}
+
+// SetManifestSyncConfig 保存团队清单同步配置，并按新的间隔重新调度
+func (ms *ManifestSyncService) SetManifestSyncConfig(config ManifestSyncConfig) error {
+	config.URL = strings.TrimSpace(config.URL)
+	if config.Policy == "" {
+		config.Policy = ManifestPolicyPreserveLocal
+	}
+	if err := config.validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := setSettingValue(manifestSyncConfigKey, string(data)); err != nil {
+		return err
+	}
+	ms.mu.Lock()
+	active := ms.timer != nil
+	ms.mu.Unlock()
+	if active {
+		ms.StartScheduler()
+	}
+	return nil
+}
+
+// OnSynced 注册同步回调（main 中据此向前端发送 ManifestSyncedEvent）
+func (ms *ManifestSyncService) OnSynced(fn func(ManifestSyncSummary)) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.onSynced = append(ms.onSynced, fn)
+}
+
+// StartScheduler 启动定时同步（未开启时每个间隔只检查配置）
+func (ms *ManifestSyncService) StartScheduler() {
+	interval := time.Duration(DefaultManifestSyncConfig().IntervalMinutes) * time.Minute
+	if config, err := ms.GetManifestSyncConfig(); err == nil && config.IntervalMinutes >= minManifestSyncInterval {
+		interval = time.Duration(config.IntervalMinutes) * time.Minute
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.timer != nil {
+		ms.timer.Stop()
+	}
+	ms.timer = time.AfterFunc(interval, func() {
+		if config, err := ms.GetManifestSyncConfig(); err != nil {
+			log.Printf("⚠️  读取清单同步配置失败: %v", err)
+		} else if config.Enabled {
+			if _, err := ms.sync(config); err != nil {
+				log.Printf("⚠️  团队清单同步失败: %v", err)
+			}
+		}
+
+		// StopScheduler 后不再重新调度
+		ms.mu.Lock()
+		active := ms.timer != nil
+		ms.mu.Unlock()
+		if active {
+			ms.StartScheduler()
+		}
+	})
+}
+
+// StopScheduler 停止定时同步
+func (ms *ManifestSyncService) StopScheduler() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.timer != nil {
+		ms.timer.Stop()
+		ms.timer = nil
+	}
+}
+
+// SyncNow 按当前配置立即同步一次（无论是否开启定时同步）
+func (ms *ManifestSyncService) SyncNow() (*ManifestSyncSummary, error) {
+	config, err := ms.GetManifestSyncConfig()
+	if err != nil {
+		return nil, err
+	}
+	return ms.sync(config)
+}
+
+func (ms *ManifestSyncService) sync(config ManifestSyncConfig) (*ManifestSyncSummary, error) {
+	ms.syncMu.Lock()
+	defer ms.syncMu.Unlock()
+
+	summary := &ManifestSyncSummary{
+		URL:      config.URL,
+		SyncedAt: time.Now().Format(time.RFC3339),
+		Added:    []string{},
+		Updated:  []string{},
+	}
+	err := ms.apply(config, summary)
+	if err != nil {
+		summary.Error = err.Error()
+	} else if len(summary.Added) > 0 || len(summary.Updated) > 0 {
+		fmt.Printf("[INFO] 团队清单同步完成: 新增 %d，更新 %d，未变化 %d\n", len(summary.Added), len(summary.Updated), summary.Unchanged)
+	}
+
+	ms.mu.Lock()
+	listeners := append([]func(ManifestSyncSummary){}, ms.onSynced...)
+	ms.mu.Unlock()
+	for _, fn := range listeners {
+		go fn(*summary)
+	}
+	return summary, err
+}
+
+func (ms *ManifestSyncService) apply(config ManifestSyncConfig, summary *ManifestSyncSummary) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	if strings.TrimSpace(config.URL) == "" {
+		return fmt.Errorf("未配置团队清单地址")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), manifestFetchTimeout)
+	defer cancel()
+	data, err := ms.fetch(ctx, config.URL)
+	if err != nil {
+		return err
+	}
+	var manifest teamManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("解析团队清单失败: %w", err)
+	}
+
+	state, err := loadManifestSyncState()
+	if err != nil {
+		return err
+	}
+	for _, platform := range []struct {
+		kind    string
+		entries []map[string]json.RawMessage
+	}{{"claude", manifest.Claude}, {"codex", manifest.Codex}} {
+		applied, err := ms.applyPlatform(platform.kind, platform.entries, state[platform.kind], config.Policy, summary)
+		if err != nil {
+			return err
+		}
+		state[platform.kind] = applied
+	}
+	return saveManifestSyncState(state)
+}
+
+// applyPlatform 将清单合并到单个平台的 provider 配置，返回本次同步后的字段基准
+func (ms *ManifestSyncService) applyPlatform(
+	kind string,
+	entries []map[string]json.RawMessage,
+	base map[string]map[string]json.RawMessage,
+	policy string,
+	summary *ManifestSyncSummary,
+) (map[string]map[string]json.RawMessage, error) {
+	ps := ms.providerService
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return nil, fmt.Errorf("加载 %s 供应商失败: %w", kind, err)
+	}
+	index := make(map[string]int, len(providers))
+	for i, p := range providers {
+		index[p.Name] = i
+	}
+
+	applied := make(map[string]map[string]json.RawMessage, len(entries))
+	changed := false
+	for _, entry := range entries {
+		var name string
+		if err := json.Unmarshal(entry["name"], &name); err != nil || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("团队清单中的 %s 供应商缺少 name", kind)
+		}
+		name = strings.TrimSpace(name)
+		fields := make(map[string]json.RawMessage, len(entry))
+		for key, value := range entry {
+			if key != "id" && key != "name" {
+				fields[key] = value
+			}
+		}
+		applied[name] = fields
+
+		i, exists := index[name]
+		if !exists {
+			provider, err := providerFromFields(Provider{ID: nextProviderID(providers), Name: name}, fields)
+			if err != nil {
+				return nil, fmt.Errorf("团队清单中的供应商 %s 无效: %w", name, err)
+			}
+			providers = append(providers, provider)
+			index[name] = len(providers) - 1
+			summary.Added = append(summary.Added, kind+"/"+name)
+			changed = true
+			continue
+		}
+
+		merged, updated, err := mergeManifestProvider(providers[i], base[name], fields, policy)
+		if err != nil {
+			return nil, fmt.Errorf("合并供应商 %s 失败: %w", name, err)
+		}
+		if !updated {
+			summary.Unchanged++
+			continue
+		}
+		providers[i] = merged
+		summary.Updated = append(summary.Updated, kind+"/"+name)
+		changed = true
+	}
+	if changed {
+		if err := ps.saveProvidersLocked(kind, providers); err != nil {
+			return nil, err
+		}
+	}
+	return applied, nil
+}
+
+// mergeManifestProvider 按合并策略将清单字段合并到本地 provider
+// preserve_local：本地值与上次同步的清单值不同（用户改过）的字段保留本地值；从未同步过的字段仅在本地为空时填充
+func mergeManifestProvider(local Provider, base map[string]json.RawMessage, fields map[string]json.RawMessage, policy string) (Provider, bool, error) {
+	localFields, err := providerFields(local)
+	if err != nil {
+		return local, false, err
+	}
+	updated := false
+	for key, value := range fields {
+		localValue, hasLocal := localFields[key]
+		if hasLocal && canonicalJSON(localValue) == canonicalJSON(value) {
+			continue
+		}
+		if policy != ManifestPolicyManifestWins {
+			baseValue, hasBase := base[key]
+			followsManifest := (!hasLocal && !hasBase) ||
+				(hasLocal && hasBase && canonicalJSON(localValue) == canonicalJSON(baseValue))
+			if !followsManifest {
+				continue
+			}
+		}
+		localFields[key] = value
+		updated = true
+	}
+	if !updated {
+		return local, false, nil
+	}
+	merged, err := providerFromFields(Provider{ID: local.ID, Name: local.Name}, localFields)
+	if err != nil {
+		return local, false, err
+	}
+	return merged, true, nil
+}
+
+func providerFields(p Provider) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "id")
+	delete(fields, "name")
+	return fields, nil
+}
+
+// providerFromFields 在 id/name 固定的前提下按字段构造 provider
+func providerFromFields(identity Provider, fields map[string]json.RawMessage) (Provider, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return Provider{}, err
+	}
+	var p Provider
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Provider{}, err
+	}
+	p.ID = identity.ID
+	p.Name = identity.Name
+	return p, nil
+}
+
+// canonicalJSON 去除空白和 key 顺序差异，用于比较字段值
+func canonicalJSON(raw json.RawMessage) string {
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return string(raw)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return string(raw)
+	}
+	return string(data)
+}
+
+func manifestSyncStatePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户目录失败: %w", err)
+	}
+	return filepath.Join(home, ".code-switch", manifestSyncStateFile), nil
+}
+
+func loadManifestSyncState() (manifestSyncState, error) {
+	state := manifestSyncState{}
+	path, err := manifestSyncStatePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("读取清单同步状态失败: %w", err)
+	}
+	if len(data) == 0 {
+		return state, nil
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("解析清单同步状态失败: %w", err)
+	}
+	return state, nil
+}
+
+func saveManifestSyncState(state manifestSyncState) error {
+	path, err := manifestSyncStatePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("创建配置目录失败: %w", err)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("写入清单同步状态失败: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// validateManifestURL 清单地址必须是 https，且不能直接指向本机或内网地址
+func validateManifestURL(rawURL string) error {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return fmt.Errorf("清单地址无效: %w", err)
+	}
+	if parsed.Scheme != "https" {
+		return fmt.Errorf("清单地址必须使用 https")
+	}
+	host := parsed.Hostname()
+	if host == "" {
+		return fmt.Errorf("清单地址缺少主机名")
+	}
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("清单地址不能指向本机")
+	}
+	if ip := net.ParseIP(host); ip != nil && isDisallowedManifestIP(ip) {
+		return fmt.Errorf("清单地址不能指向本机或内网地址: %s", host)
+	}
+	return nil
+}
+
+// isDisallowedManifestIP 本机、内网、链路本地（含云厂商元数据地址）等不允许访问的地址
+func isDisallowedManifestIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast()
+}
+
+// manifestDialControl 在建立连接时检查解析后的地址，防止域名解析到内网地址（包括 DNS rebinding）
+func manifestDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || isDisallowedManifestIP(ip) {
+		return fmt.Errorf("拒绝连接本机或内网地址: %s", host)
+	}
+	return nil
+}
+
+var manifestHTTPClient = &http.Client{
+	Timeout: manifestFetchTimeout,
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: manifestDialControl}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return fmt.Errorf("重定向次数过多")
+		}
+		return validateManifestURL(req.URL.String())
+	},
+}
+
+// fetchManifest 下载团队清单，最大 1MB
+func fetchManifest(ctx context.Context, rawURL string) ([]byte, error) {
+	if err := validateManifestURL(rawURL); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := manifestHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("下载团队清单失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载团队清单失败: HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取团队清单失败: %w", err)
+	}
+	if len(data) > maxManifestSize {
+		return nil, fmt.Errorf("团队清单超过 1MB")
+	}
+	return data, nil
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestManifestSyncAddUpdateAndNoop(t *testing.T) {
+	setupTestEnv(t)
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "mine", APIURL: "https://mine.example.com", APIKey: "sk-mine", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	manifest := `{"claude": [{"name": "team-a", "apiUrl": "https://a.example.com", "apiKey": "sk-team", "enabled": true, "level": 2}]}`
+	ms := NewManifestSyncService(ps)
+	ms.fetch = func(ctx context.Context, rawURL string) ([]byte, error) {
+		return []byte(manifest), nil
+	}
+	notified := make(chan ManifestSyncSummary, 4)
+	ms.OnSynced(func(summary ManifestSyncSummary) { notified <- summary })
+
+	config := DefaultManifestSyncConfig()
+	config.Enabled = true
+	config.URL = "https://manifest.example.com/providers.json"
+	if err := ms.SetManifestSyncConfig(config); err != nil {
+		t.Fatalf("保存清单同步配置失败: %v", err)
+	}
+
+	load := func() map[string]Provider {
+		providers, err := ps.LoadProviders("claude")
+		if err != nil {
+			t.Fatalf("加载 provider 失败: %v", err)
+		}
+		byName := make(map[string]Provider, len(providers))
+		for _, p := range providers {
+			byName[p.Name] = p
+		}
+		return byName
+	}
+
+	// 第一次同步：新增清单中的 provider，用户自己的 provider 不变
+	summary, err := ms.SyncNow()
+	if err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if len(summary.Added) != 1 || summary.Added[0] != "claude/team-a" || len(summary.Updated) != 0 {
+		t.Fatalf("第一次同步应新增 team-a，实际 %+v", summary)
+	}
+	providers := load()
+	if team := providers["team-a"]; team.APIURL != "https://a.example.com" || team.Level != 2 || team.ID == 1 {
+		t.Fatalf("新增的 provider 不正确: %+v", team)
+	}
+	if mine := providers["mine"]; mine.APIURL != "https://mine.example.com" || mine.APIKey != "sk-mine" {
+		t.Fatalf("用户添加的 provider 不应被修改: %+v", mine)
+	}
+	select {
+	case event := <-notified:
+		if len(event.Added) != 1 {
+			t.Fatalf("同步事件摘要不正确: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("同步后应触发回调")
+	}
+
+	// 清单未变化：不做修改
+	summary, err = ms.SyncNow()
+	if err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if len(summary.Added) != 0 || len(summary.Updated) != 0 || summary.Unchanged != 1 {
+		t.Fatalf("清单未变化时不应有修改，实际 %+v", summary)
+	}
+
+	// 用户在本地调整了 Level，清单同时更新了地址和 Level：保留本地 Level，地址跟随清单
+	local := load()
+	list := []Provider{local["mine"], local["team-a"]}
+	list[1].Level = 5
+	if err := ps.SaveProviders("claude", list); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	manifest = `{"claude": [{"name": "team-a", "apiUrl": "https://a2.example.com", "apiKey": "sk-team", "enabled": true, "level": 3}]}`
+	summary, err = ms.SyncNow()
+	if err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if len(summary.Updated) != 1 || summary.Updated[0] != "claude/team-a" {
+		t.Fatalf("清单更新后应更新 team-a，实际 %+v", summary)
+	}
+	team := load()["team-a"]
+	if team.APIURL != "https://a2.example.com" || team.Level != 5 {
+		t.Fatalf("preserve_local 应保留本地 Level 并更新地址，实际 %+v", team)
+	}
+
+	// manifest_wins：清单中的字段覆盖本地修改
+	config.Policy = ManifestPolicyManifestWins
+	if err := ms.SetManifestSyncConfig(config); err != nil {
+		t.Fatalf("保存清单同步配置失败: %v", err)
+	}
+	if _, err := ms.SyncNow(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if team := load()["team-a"]; team.Level != 3 {
+		t.Fatalf("manifest_wins 应以清单 Level 为准，实际 %d", team.Level)
+	}
+	if len(load()) != 2 {
+		t.Fatalf("同步不应增删其他 provider")
+	}
+}
+
+func TestManifestSyncRejectsUnsafeURL(t *testing.T) {
+	for _, rawURL := range []string{
+		"http://manifest.example.com/providers.json",
+		"https://127.0.0.1/providers.json",
+		"https://10.0.0.8/providers.json",
+		"https://169.254.169.254/latest/meta-data",
+		"https://localhost/providers.json",
+	} {
+		if err := validateManifestURL(rawURL); err == nil {
+			t.Fatalf("不安全的清单地址应被拒绝: %s", rawURL)
+		}
+	}
+	if err := validateManifestURL("https://manifest.example.com/providers.json"); err != nil {
+		t.Fatalf("合法的清单地址不应被拒绝: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// mcpSuppressedFile 记录用户删除过的内置 server，加载配置时不再自动补充
+const mcpSuppressedFile = "mcp-suppressed.json"
+
+func (ms *MCPService) suppressedPath() (string, error) {
+	path, err := ms.configPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), mcpSuppressedFile), nil
+}
+
+// loadSuppressedBuiltIns 读取被删除的内置 server 名称，文件不存在时返回空集合
+func (ms *MCPService) loadSuppressedBuiltIns() (map[string]struct{}, error) {
+	path, err := ms.suppressedPath()
+	if err != nil {
+		return nil, err
+	}
+	suppressed := make(map[string]struct{})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return suppressed, nil
+		}
+		return nil, err
+	}
+	if len(data) == 0 {
+		return suppressed, nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", mcpSuppressedFile, err)
+	}
+	for _, name := range names {
+		if _, ok := builtInServers[name]; ok {
+			suppressed[name] = struct{}{}
+		}
+	}
+	return suppressed, nil
+}
+
+func (ms *MCPService) saveSuppressedBuiltIns(suppressed map[string]struct{}) error {
+	path, err := ms.suppressedPath()
+	if err != nil {
+		return err
+	}
+	if len(suppressed) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	names := make([]string, 0, len(suppressed))
+	for name := range suppressed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	data, err := json.MarshalIndent(names, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// updateSuppressedBuiltIns 根据保存前后的配置更新删除记录：
+// 原本存在、保存后消失的内置 server 视为用户删除；重新添加的同名 server 取消删除记录
+func (ms *MCPService) updateSuppressedBuiltIns(previous, current map[string]rawMCPServer) error {
+	suppressed, err := ms.loadSuppressedBuiltIns()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for name := range builtInServers {
+		_, wasPresent := previous[name]
+		_, isPresent := current[name]
+		_, isSuppressed := suppressed[name]
+		switch {
+		case isPresent && isSuppressed:
+			delete(suppressed, name)
+			changed = true
+		case wasPresent && !isPresent && !isSuppressed:
+			suppressed[name] = struct{}{}
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return ms.saveSuppressedBuiltIns(suppressed)
+}
+
+// RestoreBuiltInServers 清除内置 server 的删除记录并重新添加（恢复默认）
+func (ms *MCPService) RestoreBuiltInServers() error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if err := ms.saveSuppressedBuiltIns(nil); err != nil {
+		return fmt.Errorf("清除内置 server 删除记录失败: %w", err)
+	}
+	_, err := ms.loadConfig()
+	return err
+}
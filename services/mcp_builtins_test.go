@@ -0,0 +1,59 @@
+package services
+
+import "testing"
+
+func TestDeletedBuiltInServerStaysRemoved(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	ms := NewMCPService()
+	servers, err := ms.ListServers()
+	if err != nil {
+		t.Fatalf("加载 MCP server 失败: %v", err)
+	}
+	if !hasMCPServer(servers, "reftools") || !hasMCPServer(servers, "chrome-devtools") {
+		t.Fatalf("首次加载应包含内置 server: %+v", servers)
+	}
+
+	// 删除 reftools 后重新加载（新实例模拟重启），不应被自动补回
+	kept := make([]MCPServer, 0, len(servers))
+	for _, server := range servers {
+		if server.Name != "reftools" {
+			kept = append(kept, server)
+		}
+	}
+	if err := ms.SaveServers(kept); err != nil {
+		t.Fatalf("保存 MCP server 失败: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		servers, err = NewMCPService().ListServers()
+		if err != nil {
+			t.Fatalf("重新加载失败: %v", err)
+		}
+		if hasMCPServer(servers, "reftools") {
+			t.Fatalf("已删除的内置 server 不应被重新添加")
+		}
+		if !hasMCPServer(servers, "chrome-devtools") {
+			t.Fatalf("未删除的内置 server 应保留")
+		}
+	}
+
+	if err := ms.RestoreBuiltInServers(); err != nil {
+		t.Fatalf("恢复内置 server 失败: %v", err)
+	}
+	servers, err = ms.ListServers()
+	if err != nil {
+		t.Fatalf("重新加载失败: %v", err)
+	}
+	if !hasMCPServer(servers, "reftools") {
+		t.Fatalf("恢复后应重新包含 reftools")
+	}
+}
+
+func hasMCPServer(servers []MCPServer, name string) bool {
+	for _, server := range servers {
+		if server.Name == name {
+			return true
+		}
+	}
+	return false
+}
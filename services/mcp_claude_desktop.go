@@ -0,0 +1,120 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	platClaudeDesktop       = "claude-desktop"
+	claudeDesktopConfigFile = "claude_desktop_config.json"
+)
+
+// claudeDesktopConfigPath Claude Desktop 配置文件路径：
+// macOS ~/Library/Application Support/Claude，Windows %APPDATA%\Claude，Linux $XDG_CONFIG_HOME/Claude（默认 ~/.config/Claude）
+func claudeDesktopConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	var dir string
+	switch runtime.GOOS {
+	case "darwin":
+		dir = filepath.Join(home, "Library", "Application Support")
+	case "windows":
+		dir = os.Getenv("APPDATA")
+		if dir == "" {
+			dir = filepath.Join(home, "AppData", "Roaming")
+		}
+	default:
+		dir = os.Getenv("XDG_CONFIG_HOME")
+		if dir == "" {
+			dir = filepath.Join(home, ".config")
+		}
+	}
+	return filepath.Join(dir, "Claude", claudeDesktopConfigFile), nil
+}
+
+// syncClaudeDesktopServers 将启用 claude-desktop 平台的 server 写入 claude_desktop_config.json
+// 只改写 mcpServers 中由本应用管理的条目（当前或上次保存的 server），其余 server 和非 MCP 配置保持不变
+// 配置文件不存在且没有需要写入的 server 时不创建文件（未安装 Claude Desktop）
+func (ms *MCPService) syncClaudeDesktopServers(servers []MCPServer, previous map[string]rawMCPServer) error {
+	path, err := claudeDesktopConfigPath()
+	if err != nil {
+		return err
+	}
+	desired := make(map[string]claudeDesktopServer)
+	managed := make(map[string]struct{}, len(servers)+len(previous))
+	for name := range previous {
+		managed[strings.ToLower(name)] = struct{}{}
+	}
+	for _, server := range servers {
+		managed[strings.ToLower(server.Name)] = struct{}{}
+		if platformContains(server.EnablePlatform, platClaudeDesktop) {
+			desired[server.Name] = buildClaudeDesktopEntry(server)
+		}
+	}
+
+	payload := make(map[string]any)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil && len(strings.TrimSpace(string(data))) > 0:
+		// 解析失败时不覆盖，避免丢失用户的 Claude Desktop 配置
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return fmt.Errorf("解析 Claude Desktop 配置失败: %w", err)
+		}
+	case errors.Is(err, os.ErrNotExist):
+		if len(desired) == 0 {
+			return nil
+		}
+	case err != nil:
+		return err
+	}
+
+	merged := make(map[string]any)
+	if existing, ok := payload["mcpServers"].(map[string]any); ok {
+		for name, entry := range existing {
+			if _, ok := managed[strings.ToLower(strings.TrimSpace(name))]; !ok {
+				merged[name] = entry
+			}
+		}
+	}
+	for name, entry := range desired {
+		merged[name] = entry
+	}
+	payload["mcpServers"] = merged
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err = json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func loadClaudeDesktopEnabledServers() map[string]struct{} {
+	result := map[string]struct{}{}
+	path, err := claudeDesktopConfigPath()
+	if err != nil {
+		return result
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return result
+	}
+	var payload claudeMcpFilePayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return result
+	}
+	for name := range payload.Servers {
+		result[strings.ToLower(strings.TrimSpace(name))] = struct{}{}
+	}
+	return result
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// MCPDefinition 用于比较的 server 定义（stdio 比较 command/args/env，http/sse 比较 url/headers）
+type MCPDefinition struct {
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// MCPConflict mcp.json 中保存的定义与某个平台配置文件中的同名 server 不一致
+type MCPConflict struct {
+	Name     string        `json:"name"`
+	Platform string        `json:"platform"`
+	Path     string        `json:"path"`
+	Fields   []string      `json:"fields"`
+	Stored   MCPDefinition `json:"stored"`
+	Actual   MCPDefinition `json:"actual"`
+}
+
+// DetectConflicts 比较 mcp.json 与 Claude Code、Codex、Claude Desktop 配置中的同名 server，返回定义不一致的条目
+// 平台配置中有、mcp.json 中没有的 server 不算冲突；配置文件不存在时跳过该平台
+func (ms *MCPService) DetectConflicts() ([]MCPConflict, error) {
+	ms.mu.Lock()
+	stored, err := ms.readConfig()
+	ms.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]string, len(stored))
+	for name := range stored {
+		byName[strings.ToLower(name)] = name
+	}
+
+	conflicts := make([]MCPConflict, 0)
+	for _, platform := range []string{platClaudeCode, platCodex, platClaudeDesktop} {
+		path, actual, err := readPlatformDefinitions(platform)
+		if err != nil {
+			return nil, err
+		}
+		for actualName, definition := range actual {
+			name, ok := byName[strings.ToLower(strings.TrimSpace(actualName))]
+			if !ok {
+				continue
+			}
+			entry := stored[name]
+			want := storedDefinition(entry)
+			definition = comparableDefinition(entry.Type, definition)
+			if fields := diffDefinitions(want, definition); len(fields) > 0 {
+				conflicts = append(conflicts, MCPConflict{
+					Name:     name,
+					Platform: platform,
+					Path:     path,
+					Fields:   fields,
+					Stored:   want,
+					Actual:   definition,
+				})
+			}
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Name != conflicts[j].Name {
+			return conflicts[i].Name < conflicts[j].Name
+		}
+		return conflicts[i].Platform < conflicts[j].Platform
+	})
+	return conflicts, nil
+}
+
+// readPlatformDefinitions 读取平台配置文件中的 server 定义，文件不存在时返回空集合
+func readPlatformDefinitions(platform string) (string, map[string]MCPDefinition, error) {
+	var path string
+	var err error
+	switch platform {
+	case platClaudeCode:
+		path, err = claudeConfigPath()
+	case platCodex:
+		// 不用 codexConfigPath：只读取，不创建 ~/.codex 目录
+		var home string
+		if home, err = os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, codexDirName, codexConfigFile)
+		}
+	default:
+		path, err = claudeDesktopConfigPath()
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return path, nil, nil
+		}
+		return path, nil, err
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return path, nil, nil
+	}
+
+	definitions := make(map[string]MCPDefinition)
+	if platform == platCodex {
+		var payload codexMcpFilePayload
+		if err := toml.Unmarshal(data, &payload); err != nil {
+			return path, nil, fmt.Errorf("解析 %s 失败: %w", path, err)
+		}
+		for name, entry := range payload.Servers {
+			definitions[name] = codexDefinition(entry)
+		}
+		return path, definitions, nil
+	}
+
+	var payload struct {
+		Servers map[string]claudeDesktopServer `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return path, nil, fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+	for name, entry := range payload.Servers {
+		definitions[name] = MCPDefinition{
+			Command: entry.Command,
+			Args:    entry.Args,
+			Env:     entry.Env,
+			URL:     entry.URL,
+			Headers: entry.Headers,
+		}
+	}
+	return path, definitions, nil
+}
+
+// codexDefinition 从 config.toml 的 mcp_servers 条目中取出用于比较的字段
+func codexDefinition(entry map[string]any) MCPDefinition {
+	definition := MCPDefinition{}
+	definition.Command, _ = entry["command"].(string)
+	definition.URL, _ = entry["url"].(string)
+	if args, ok := entry["args"].([]any); ok {
+		for _, arg := range args {
+			if value, ok := arg.(string); ok {
+				definition.Args = append(definition.Args, value)
+			}
+		}
+	}
+	definition.Env = stringValues(entry["env"])
+	definition.Headers = stringValues(entry["http_headers"])
+	return definition
+}
+
+func stringValues(value any) map[string]string {
+	values, ok := value.(map[string]any)
+	if !ok {
+		return nil
+	}
+	result := make(map[string]string, len(values))
+	for key, item := range values {
+		if text, ok := item.(string); ok {
+			result[key] = text
+		}
+	}
+	return result
+}
+
+// storedDefinition mcp.json 条目同步到各平台时实际写出的字段
+func storedDefinition(entry rawMCPServer) MCPDefinition {
+	entry = normalizeRawEntry(entry)
+	return comparableDefinition(entry.Type, MCPDefinition{
+		Command: entry.Command,
+		Args:    entry.Args,
+		Env:     entry.Env,
+		URL:     entry.URL,
+		Headers: entry.Headers,
+	})
+}
+
+// comparableDefinition 规范化定义，只保留该类型同步时会写出的字段
+// 平台配置中出现了该类型不使用的字段（如 stdio server 带 url）时保留，以便报告为冲突
+func comparableDefinition(typ string, definition MCPDefinition) MCPDefinition {
+	definition.Command = strings.TrimSpace(definition.Command)
+	definition.URL = strings.TrimSpace(definition.URL)
+	definition.Args = cleanArgs(definition.Args)
+	definition.Env = cleanEnv(definition.Env)
+	definition.Headers = cleanEnv(definition.Headers)
+	if isURLServerType(normalizeServerType(typ)) {
+		if definition.Command == "" {
+			definition.Args = []string{}
+			definition.Env = map[string]string{}
+		}
+	} else if definition.URL == "" {
+		definition.Headers = map[string]string{}
+	}
+	return definition
+}
+
+// diffDefinitions 返回两个定义中不一致的字段名
+func diffDefinitions(stored, actual MCPDefinition) []string {
+	fields := make([]string, 0)
+	if stored.Command != actual.Command {
+		fields = append(fields, "command")
+	}
+	if !reflect.DeepEqual(stored.Args, actual.Args) {
+		fields = append(fields, "args")
+	}
+	if !reflect.DeepEqual(stored.Env, actual.Env) {
+		fields = append(fields, "env")
+	}
+	if stored.URL != actual.URL {
+		fields = append(fields, "url")
+	}
+	if !reflect.DeepEqual(stored.Headers, actual.Headers) {
+		fields = append(fields, "headers")
+	}
+	return fields
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMCPDetectConflicts(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("APPDATA", filepath.Join(home, "AppData", "Roaming"))
+
+	ms := NewMCPService()
+	if err := ms.SaveServers([]MCPServer{
+		{Name: "local", Type: "stdio", Command: "npx", Args: []string{"-y", "local-mcp"}, Env: map[string]string{"LOG_LEVEL": "debug"}, EnablePlatform: []string{platClaudeCode, platCodex}},
+		{Name: "search", Type: "http", URL: "https://example.com/mcp", Env: map[string]string{"UNUSED": "1"}, EnablePlatform: []string{platClaudeCode}},
+	}); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	// 刚同步完时各平台与 mcp.json 一致（http server 的 env 不会同步，也不算冲突）
+	conflicts, err := ms.DetectConflicts()
+	if err != nil || len(conflicts) != 0 {
+		t.Fatalf("同步后不应有冲突: %+v, %v", conflicts, err)
+	}
+
+	// 用户手动修改了 Claude Code 和 Codex 中的定义
+	claude := `{"mcpServers":{"local":{"command":"node","args":["-y","local-mcp"],"env":{"LOG_LEVEL":"debug"}},"Search":{"type":"http","url":"https://other.example.com/mcp"},"manual":{"command":"uvx"}}}`
+	if err := os.WriteFile(filepath.Join(home, claudeMcpFile), []byte(claude), 0o600); err != nil {
+		t.Fatalf("写入 Claude 配置失败: %v", err)
+	}
+	codex := "[mcp_servers.local]\ncommand = \"npx\"\nargs = [\"-y\", \"local-mcp\", \"--debug\"]\n[mcp_servers.local.env]\nLOG_LEVEL = \"info\"\n"
+	if err := os.WriteFile(filepath.Join(home, codexDirName, codexConfigFile), []byte(codex), 0o644); err != nil {
+		t.Fatalf("写入 Codex 配置失败: %v", err)
+	}
+
+	conflicts, err = ms.DetectConflicts()
+	if err != nil {
+		t.Fatalf("检测冲突失败: %v", err)
+	}
+	got := make([]string, 0, len(conflicts))
+	for _, conflict := range conflicts {
+		got = append(got, conflict.Name+"@"+conflict.Platform+":"+strings.Join(conflict.Fields, ","))
+	}
+	want := []string{"local@claude-code:command", "local@codex:args,env", "search@claude-code:url"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("冲突列表 = %v, 期望 %v", got, want)
+	}
+	if conflicts[0].Stored.Command != "npx" || conflicts[0].Actual.Command != "node" || conflicts[0].Path != filepath.Join(home, claudeMcpFile) {
+		t.Fatalf("冲突详情不正确: %+v", conflicts[0])
+	}
+
+	if err := os.WriteFile(filepath.Join(home, claudeMcpFile), []byte("{broken"), 0o600); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if _, err := ms.DetectConflicts(); err == nil {
+		t.Fatalf("配置文件无法解析时应返回错误")
+	}
+}
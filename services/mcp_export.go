@@ -0,0 +1,271 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mcpExportVersion 导出文件格式版本
+const mcpExportVersion = 1
+
+// secretKeyHints 键名包含这些片段时视为敏感信息
+var secretKeyHints = []string{"key", "token", "secret", "password", "passwd", "auth", "credential"}
+
+// mcpExportBundle 可分享的 MCP server 集合
+type mcpExportBundle struct {
+	Version    int                     `json:"version"`
+	ExportedAt string                  `json:"exportedAt,omitempty"`
+	Redacted   bool                    `json:"redacted"`
+	Servers    map[string]rawMCPServer `json:"servers"`
+}
+
+// ExportServers 导出所有 MCP server 定义（默认脱敏，适合直接分享）
+func (ms *MCPService) ExportServers() ([]byte, error) {
+	return ms.ExportServersWithOptions(true)
+}
+
+// ExportServersWithOptions 导出所有 MCP server 定义
+// redactSecrets 为 true 时，敏感的 env 值和 URL 查询参数会被替换为 {占位符}，导入后需重新填写
+func (ms *MCPService) ExportServersWithOptions(redactSecrets bool) ([]byte, error) {
+	ms.mu.Lock()
+	config, err := ms.loadConfig()
+	ms.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := mcpExportBundle{
+		Version:    mcpExportVersion,
+		ExportedAt: time.Now().Format(time.RFC3339),
+		Redacted:   redactSecrets,
+		Servers:    make(map[string]rawMCPServer, len(config)),
+	}
+	for name, entry := range config {
+		entry = normalizeRawEntry(entry)
+		if redactSecrets {
+			entry = redactMCPServer(entry)
+		}
+		bundle.Servers[name] = entry
+	}
+
+	return json.MarshalIndent(bundle, "", "  ")
+}
+
+// ImportServers 将导出的 MCP server 定义合并到本地并同步到各平台
+// overwrite 为 false 时，若存在同名但内容不同的 server，则整体拒绝导入并返回冲突列表
+// 含未填写占位符的 server 会被禁用（与 SaveServers 行为一致）
+func (ms *MCPService) ImportServers(data []byte, overwrite bool) error {
+	var bundle mcpExportBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return fmt.Errorf("解析 MCP 导入文件失败: %w", err)
+	}
+	if bundle.Version > mcpExportVersion {
+		return fmt.Errorf("不支持的 MCP 导入文件版本: %d", bundle.Version)
+	}
+	if len(bundle.Servers) == 0 {
+		return fmt.Errorf("导入文件中没有 MCP server")
+	}
+	return ms.importServers(bundle, overwrite, false)
+}
+
+// importServers 校验并合并 bundle 中的 server；replace 为 true 时以 bundle 为准，删除本地其余的 server
+func (ms *MCPService) importServers(bundle mcpExportBundle, overwrite bool, replace bool) error {
+	names := make([]string, 0, len(bundle.Servers))
+	for name := range bundle.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	imported := make(map[string]rawMCPServer, len(names))
+	var invalid []string
+	for _, name := range names {
+		trimmed := strings.TrimSpace(name)
+		entry := normalizeRawEntry(bundle.Servers[name])
+		if err := validateRawMCPServer(trimmed, entry); err != nil {
+			invalid = append(invalid, err.Error())
+			continue
+		}
+		imported[trimmed] = entry
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("MCP 导入校验失败: %s", strings.Join(invalid, "; "))
+	}
+
+	existing, err := ms.ListServers()
+	if err != nil {
+		return err
+	}
+
+	existingIndex := make(map[string]int, len(existing))
+	var conflicts []string
+	for i, server := range existing {
+		existingIndex[server.Name] = i
+		if entry, ok := imported[server.Name]; ok && !sameMCPDefinition(server, entry) {
+			conflicts = append(conflicts, server.Name)
+		}
+	}
+	if len(conflicts) > 0 && !overwrite && !replace {
+		return fmt.Errorf("以下 MCP server 已存在且内容不同: %s", strings.Join(conflicts, ", "))
+	}
+
+	merged := existing
+	if replace {
+		merged = make([]MCPServer, 0, len(imported))
+		existingIndex = map[string]int{}
+	}
+	for _, name := range sortedRawNames(imported) {
+		entry := imported[name]
+		server := MCPServer{
+			Name:           name,
+			Type:           entry.Type,
+			Command:        entry.Command,
+			Args:           entry.Args,
+			Env:            entry.Env,
+			URL:            entry.URL,
+			Headers:        entry.Headers,
+			Website:        entry.Website,
+			Tips:           entry.Tips,
+			EnablePlatform: entry.EnablePlatform,
+		}
+		// env 中的占位符同样视为未填写，避免把 {TOKEN} 原样传给进程
+		if len(detectEnvPlaceholders(entry.Env)) > 0 {
+			server.EnablePlatform = []string{}
+		}
+		if idx, ok := existingIndex[name]; ok {
+			merged[idx] = server
+		} else {
+			merged = append(merged, server)
+		}
+	}
+
+	return ignoreServersDisabled(ms.SaveServers(merged))
+}
+
+// validateRawMCPServer 校验导入的 server 定义
+func validateRawMCPServer(name string, entry rawMCPServer) error {
+	if name == "" {
+		return fmt.Errorf("server name 不能为空")
+	}
+	if entry.Type == "stdio" && entry.Command == "" {
+		return fmt.Errorf("%s 需要提供 command", name)
+	}
+	if isURLServerType(entry.Type) && entry.URL == "" {
+		return fmt.Errorf("%s 需要提供 url", name)
+	}
+	return nil
+}
+
+// sameMCPDefinition 比较已有 server 与导入定义是否一致（忽略启用平台）
+func sameMCPDefinition(server MCPServer, entry rawMCPServer) bool {
+	current := normalizeRawEntry(rawMCPServer{
+		Type:    server.Type,
+		Command: server.Command,
+		Args:    server.Args,
+		Env:     server.Env,
+		URL:     server.URL,
+		Headers: server.Headers,
+		Website: server.Website,
+		Tips:    server.Tips,
+	})
+	entry.EnablePlatform = nil
+	current.EnablePlatform = nil
+	return reflect.DeepEqual(current, entry)
+}
+
+func sortedRawNames(servers map[string]rawMCPServer) []string {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// redactMCPServer 将敏感字段替换为占位符
+func redactMCPServer(entry rawMCPServer) rawMCPServer {
+	entry.Env = redactSecretValues(entry.Env)
+	entry.Headers = redactSecretValues(entry.Headers)
+	entry.URL = redactURLQuery(entry.URL)
+	return entry
+}
+
+// redactSecretValues 将敏感键（env 变量、Authorization 等请求头）的值替换为以键名命名的占位符
+func redactSecretValues(values map[string]string) map[string]string {
+	if len(values) == 0 {
+		return values
+	}
+	redacted := make(map[string]string, len(values))
+	for key, value := range values {
+		if isSecretKey(key) && value != "" && !placeholderPattern.MatchString(value) {
+			value = "{" + placeholderName(key) + "}"
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// redactURLQuery 将 URL 中敏感的查询参数替换为占位符，其余参数保持原样
+func redactURLQuery(raw string) string {
+	base, query, found := strings.Cut(raw, "?")
+	if !found || query == "" {
+		return raw
+	}
+
+	parts := strings.Split(query, "&")
+	for i, part := range parts {
+		key, value, hasValue := strings.Cut(part, "=")
+		if !hasValue || value == "" || placeholderPattern.MatchString(value) {
+			continue
+		}
+		name, err := url.QueryUnescape(key)
+		if err != nil || !isSecretKey(name) {
+			continue
+		}
+		parts[i] = key + "={" + placeholderName(name) + "}"
+	}
+	return base + "?" + strings.Join(parts, "&")
+}
+
+func isSecretKey(key string) bool {
+	lower := strings.ToLower(key)
+	for _, hint := range secretKeyHints {
+		if strings.Contains(lower, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// placeholderName 将键名转换为合法的占位符名称
+func placeholderName(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "secret"
+	}
+	return b.String()
+}
+
+func detectEnvPlaceholders(env map[string]string) []string {
+	set := make(map[string]struct{})
+	for _, value := range env {
+		collectPlaceholders(set, value)
+	}
+	result := make([]string, 0, len(set))
+	for key := range set {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMCPExportImportRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	ms := NewMCPService()
+	if err := ms.SaveServers([]MCPServer{
+		{
+			Name:           "search",
+			Type:           "http",
+			URL:            "https://example.com/mcp?apiKey=sk-secret&region=us",
+			EnablePlatform: []string{platClaudeCode},
+		},
+		{
+			Name:           "local",
+			Type:           "stdio",
+			Command:        "npx",
+			Args:           []string{"-y", "local-mcp"},
+			Env:            map[string]string{"API_TOKEN": "tok-123", "LOG_LEVEL": "debug"},
+			EnablePlatform: []string{platCodex},
+		},
+	}); err != nil {
+		t.Fatalf("保存 MCP server 失败: %v", err)
+	}
+
+	data, err := ms.ExportServers()
+	if err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+	if strings.Contains(string(data), "sk-secret") || strings.Contains(string(data), "tok-123") {
+		t.Fatalf("默认导出应脱敏: %s", data)
+	}
+	var bundle mcpExportBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatalf("导出内容不是有效 JSON: %v", err)
+	}
+	if got := bundle.Servers["search"].URL; got != "https://example.com/mcp?apiKey={apiKey}&region=us" {
+		t.Fatalf("URL 脱敏结果 = %q", got)
+	}
+	if got := bundle.Servers["local"].Env["LOG_LEVEL"]; got != "debug" {
+		t.Fatalf("非敏感 env 不应被脱敏, 得到 %q", got)
+	}
+
+	// 在另一台机器导入
+	t.Setenv("HOME", t.TempDir())
+	target := NewMCPService()
+	if err := target.ImportServers(data, false); err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+	servers, err := target.ListServers()
+	if err != nil {
+		t.Fatalf("列出 MCP server 失败: %v", err)
+	}
+	found := 0
+	for _, server := range servers {
+		if server.Name == "search" || server.Name == "local" {
+			found++
+			if len(server.EnablePlatform) != 0 {
+				t.Errorf("%s 含未填写占位符，应被禁用", server.Name)
+			}
+		}
+	}
+	if found != 2 {
+		t.Fatalf("导入后应包含 2 个 server，找到 %d", found)
+	}
+
+	// 同名不同内容：未开启覆盖时报告冲突
+	for i := range servers {
+		if servers[i].Name == "local" {
+			servers[i].Command = "node"
+		}
+	}
+	if err := target.SaveServers(servers); err != nil {
+		t.Fatalf("修改 server 失败: %v", err)
+	}
+	if err := target.ImportServers(data, false); err == nil || !strings.Contains(err.Error(), "local") {
+		t.Fatalf("期望返回冲突错误，得到 %v", err)
+	}
+	if err := target.ImportServers(data, true); err != nil {
+		t.Fatalf("覆盖导入失败: %v", err)
+	}
+}
+
+func TestMCPImportValidation(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	ms := NewMCPService()
+	if err := ms.ImportServers([]byte(`{"version":1,"servers":{"broken":{"type":"http"}}}`), false); err == nil {
+		t.Fatalf("缺少 url 的 http server 应校验失败")
+	}
+	if err := ms.ImportServers([]byte(`not json`), false); err == nil {
+		t.Fatalf("无效 JSON 应返回错误")
+	}
+	if err := ms.ImportServers([]byte(`{"version":99,"servers":{}}`), false); err == nil {
+		t.Fatalf("不支持的版本应返回错误")
+	}
+}
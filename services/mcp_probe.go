@@ -0,0 +1,294 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	mcpStdioTestTimeout = 15 * time.Second // npx 首次运行需要下载依赖，留出足够时间
+	mcpHTTPTestTimeout  = 8 * time.Second
+	mcpOutputSnippetMax = 2048
+	mcpProtocolVersion  = "2024-11-05"
+)
+
+// MCPTestResult MCP server 连通性测试结果
+type MCPTestResult struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Success    bool   `json:"success"`
+	Handshake  bool   `json:"handshake"`            // 是否完成 MCP initialize 握手
+	ServerInfo string `json:"serverInfo,omitempty"` // 握手返回的 serverInfo（名称 + 版本）
+	StatusCode int    `json:"statusCode,omitempty"` // http 类型的响应状态码
+	LatencyMs  int64  `json:"latencyMs"`
+	Message    string `json:"message"`
+	Stdout     string `json:"stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty"`
+}
+
+// TestServer 测试指定 MCP server 是否可用
+// stdio：启动命令并发送 initialize 请求；http/sse：探测 URL 是否可达
+func (ms *MCPService) TestServer(name string) (*MCPTestResult, error) {
+	ms.mu.Lock()
+	config, err := ms.loadConfig()
+	ms.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	entry, ok := config[name]
+	if !ok {
+		return nil, fmt.Errorf("未找到 MCP server '%s'", name)
+	}
+	entry = normalizeRawEntry(entry)
+
+	result := &MCPTestResult{Name: name, Type: normalizeServerType(entry.Type)}
+	if missing := detectPlaceholders(entry.URL, entry.Args, entry.Headers); len(missing) > 0 {
+		result.Message = fmt.Sprintf("存在未填写的占位符: %s", strings.Join(missing, ", "))
+		return result, nil
+	}
+
+	if isURLServerType(result.Type) {
+		testMCPHTTPServer(entry, result)
+	} else {
+		testMCPStdioServer(entry, result, mcpStdioTestTimeout)
+	}
+	return result, nil
+}
+
+// testMCPHTTPServer 探测 http 类型 server：收到任意 HTTP 响应即视为可达，5xx 视为失败
+func testMCPHTTPServer(entry rawMCPServer, result *MCPTestResult) {
+	if err := validateHTTPURL(entry.URL, "MCP server URL"); err != nil {
+		result.Message = err.Error()
+		return
+	}
+
+	body, _ := json.Marshal(mcpInitializeRequest())
+	req, err := http.NewRequest(http.MethodPost, entry.URL, bytes.NewReader(body))
+	if err != nil {
+		result.Message = fmt.Sprintf("构建请求失败: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for key, value := range entry.Headers {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{Timeout: mcpHTTPTestTimeout}
+	start := time.Now()
+	resp, err := client.Do(req)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Message = fmt.Sprintf("无法连接 %s: %v", entry.URL, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, mcpOutputSnippetMax))
+	result.StatusCode = resp.StatusCode
+	result.Stdout = string(snippet)
+	if info, ok := parseMCPInitializeResponse(snippet); ok {
+		result.Handshake = true
+		result.ServerInfo = info
+	}
+
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		result.Message = fmt.Sprintf("服务端错误: HTTP %d", resp.StatusCode)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		result.Success = true
+		result.Message = fmt.Sprintf("地址可达，但认证失败（HTTP %d），请检查 API Key", resp.StatusCode)
+	case result.Handshake:
+		result.Success = true
+		result.Message = fmt.Sprintf("MCP 握手成功（%s），耗时 %dms", result.ServerInfo, result.LatencyMs)
+	default:
+		result.Success = true
+		result.Message = fmt.Sprintf("地址可达（HTTP %d），耗时 %dms", resp.StatusCode, result.LatencyMs)
+	}
+}
+
+// testMCPStdioServer 启动 stdio server 并发送 initialize 请求
+// 超时前收到握手响应视为成功；进程仍在运行但未响应视为已启动（可能在下载依赖）；进程提前退出视为失败
+func testMCPStdioServer(entry rawMCPServer, result *MCPTestResult, timeout time.Duration) {
+	command := strings.TrimSpace(entry.Command)
+	if command == "" {
+		result.Message = "未配置启动命令"
+		return
+	}
+	if _, err := exec.LookPath(command); err != nil {
+		result.Message = fmt.Sprintf("未找到命令 %s，请确认已安装并在 PATH 中", command)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command, entry.Args...)
+	cmd.Env = os.Environ()
+	for key, value := range entry.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		result.Message = fmt.Sprintf("创建 stdin 失败: %v", err)
+		return
+	}
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		result.Message = fmt.Sprintf("创建 stdout 失败: %v", err)
+		return
+	}
+	stderr := &limitedBuffer{max: mcpOutputSnippetMax}
+	cmd.Stderr = stderr
+	// npx 等启动器派生的子进程可能继续占用输出管道，避免 Wait 长时间阻塞
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		result.Message = fmt.Sprintf("启动失败: %v", err)
+		return
+	}
+
+	request, _ := json.Marshal(mcpInitializeRequest())
+	_, _ = stdin.Write(append(request, '\n'))
+
+	// 逐行读取 stdout，直到读到 initialize 响应或进程退出
+	stdout := &limitedBuffer{max: mcpOutputSnippetMax}
+	handshake := make(chan string, 1)
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		scanner := bufio.NewScanner(stdoutPipe)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			_, _ = stdout.Write(append(line, '\n'))
+			if info, ok := parseMCPInitializeResponse(line); ok {
+				handshake <- info
+				return
+			}
+		}
+	}()
+
+	select {
+	case info := <-handshake:
+		result.Success = true
+		result.Handshake = true
+		result.ServerInfo = info
+		result.LatencyMs = time.Since(start).Milliseconds()
+		result.Message = fmt.Sprintf("MCP 握手成功（%s），耗时 %dms", info, result.LatencyMs)
+	case <-readDone:
+		// stdout 关闭：进程已退出
+		waitErr := cmd.Wait()
+		result.LatencyMs = time.Since(start).Milliseconds()
+		result.Message = describeMCPExit(waitErr)
+		result.Stdout = stdout.String()
+		result.Stderr = stderr.String()
+		return
+	case <-ctx.Done():
+		result.LatencyMs = time.Since(start).Milliseconds()
+		result.Success = true
+		result.Message = fmt.Sprintf("进程已启动，但 %s 内未响应 MCP 握手（首次运行可能仍在下载依赖）", timeout)
+	}
+
+	_ = stdin.Close()
+	cancel()
+	_ = cmd.Wait()
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+}
+
+func describeMCPExit(err error) string {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Sprintf("进程提前退出（退出码 %d），请查看 stderr", exitErr.ExitCode())
+	}
+	if err != nil {
+		return fmt.Sprintf("进程提前退出: %v", err)
+	}
+	return "进程未完成 MCP 握手即退出"
+}
+
+func mcpInitializeRequest() map[string]any {
+	return map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "initialize",
+		"params": map[string]any{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]any{},
+			"clientInfo": map[string]any{
+				"name":    "code-switch",
+				"version": "1.0.0",
+			},
+		},
+	}
+}
+
+// parseMCPInitializeResponse 解析 initialize 响应（兼容 SSE 格式的 data: 行），返回 serverInfo 描述
+func parseMCPInitializeResponse(data []byte) (string, bool) {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		line = bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var resp struct {
+			ID     json.RawMessage `json:"id"`
+			Result *struct {
+				ServerInfo struct {
+					Name    string `json:"name"`
+					Version string `json:"version"`
+				} `json:"serverInfo"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(line, &resp); err != nil || resp.Result == nil || string(resp.ID) != "1" {
+			continue
+		}
+		info := strings.TrimSpace(resp.Result.ServerInfo.Name + " " + resp.Result.ServerInfo.Version)
+		if info == "" {
+			info = "未知 server"
+		}
+		return info, true
+	}
+	return "", false
+}
+
+// limitedBuffer 只保留前 max 字节的并发安全缓冲区，用于截取诊断输出
+type limitedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if remaining := b.max - b.buf.Len(); remaining > 0 {
+		if len(p) > remaining {
+			b.buf.Write(p[:remaining])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fakeInitializeResponse = `{"jsonrpc":"2.0","id":1,"result":{"protocolVersion":"2024-11-05","serverInfo":{"name":"fake-mcp","version":"0.1.0"}}}`
+
+func TestMCPTestServerHTTP(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message\ndata: " + fakeInitializeResponse + "\n\n"))
+	}))
+	defer upstream.Close()
+
+	ms := NewMCPService()
+	if err := ms.SaveServers([]MCPServer{
+		{Name: "remote", Type: "http", URL: upstream.URL, EnablePlatform: []string{platClaudeCode}},
+	}); err != nil {
+		t.Fatalf("保存 MCP server 失败: %v", err)
+	}
+
+	result, err := ms.TestServer("remote")
+	if err != nil {
+		t.Fatalf("测试失败: %v", err)
+	}
+	if !result.Success || !result.Handshake || result.ServerInfo != "fake-mcp 0.1.0" {
+		t.Fatalf("http 握手结果不符合预期: %+v", result)
+	}
+
+	if _, err := ms.TestServer("missing"); err == nil {
+		t.Fatalf("不存在的 server 应返回错误")
+	}
+}
+
+func TestMCPTestServerStdio(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("依赖 sh")
+	}
+
+	handshake := &MCPTestResult{}
+	testMCPStdioServer(rawMCPServer{
+		Command: "sh",
+		Args:    []string{"-c", "read line; echo '" + fakeInitializeResponse + "'; sleep 5"},
+	}, handshake, 5*time.Second)
+	if !handshake.Success || !handshake.Handshake || handshake.ServerInfo != "fake-mcp 0.1.0" {
+		t.Fatalf("stdio 握手结果不符合预期: %+v", handshake)
+	}
+
+	crashed := &MCPTestResult{}
+	testMCPStdioServer(rawMCPServer{
+		Command: "sh",
+		Args:    []string{"-c", "echo 'missing API_KEY' >&2; exit 3"},
+	}, crashed, 5*time.Second)
+	if crashed.Success || !strings.Contains(crashed.Message, "3") || !strings.Contains(crashed.Stderr, "missing API_KEY") {
+		t.Fatalf("进程提前退出应失败并返回 stderr: %+v", crashed)
+	}
+
+	notFound := &MCPTestResult{}
+	testMCPStdioServer(rawMCPServer{Command: "definitely-not-a-real-mcp-binary"}, notFound, time.Second)
+	if notFound.Success || !strings.Contains(notFound.Message, "未找到命令") {
+		t.Fatalf("命令不存在应失败: %+v", notFound)
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MCPDisabledServer 保存时被自动取消启用的 server 及原因
+type MCPDisabledServer struct {
+	Name    string   `json:"name"`
+	Reasons []string `json:"reasons"`
+}
+
+// MCPServersDisabledError SaveServers 已保存配置，但部分 server 因配置不完整被自动取消启用
+type MCPServersDisabledError struct {
+	Servers []MCPDisabledServer `json:"servers"`
+}
+
+func (e *MCPServersDisabledError) Error() string {
+	parts := make([]string, 0, len(e.Servers))
+	for _, server := range e.Servers {
+		parts = append(parts, fmt.Sprintf("%s（%s）", server.Name, strings.Join(server.Reasons, "；")))
+	}
+	return fmt.Sprintf("配置已保存，以下 MCP server 已自动取消启用: %s", strings.Join(parts, ", "))
+}
+
+// ValidateServer 检查 server 配置，返回无法启用的原因；为空表示可以启用
+func (ms *MCPService) ValidateServer(server MCPServer) []string {
+	reasons := make([]string, 0)
+	if strings.TrimSpace(server.Name) == "" {
+		reasons = append(reasons, "server name 不能为空")
+	}
+	url := strings.TrimSpace(server.URL)
+	switch typ := normalizeServerType(server.Type); typ {
+	case "stdio":
+		if strings.TrimSpace(server.Command) == "" {
+			reasons = append(reasons, "stdio 类型需要提供 command")
+		}
+	case "http", "sse":
+		if url == "" {
+			reasons = append(reasons, fmt.Sprintf("%s 类型需要提供 url", typ))
+		}
+	}
+	return append(reasons, placeholderReasons(detectPlaceholders(url, cleanArgs(server.Args), cleanEnv(server.Headers)))...)
+}
+
+// placeholderReasons 将未填写的占位符转为提示文本
+func placeholderReasons(placeholders []string) []string {
+	if len(placeholders) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(placeholders))
+	for _, name := range placeholders {
+		names = append(names, "{"+name+"}")
+	}
+	return []string{fmt.Sprintf("url/args/headers 中的占位符尚未填写实际值: %s", strings.Join(names, ", "))}
+}
+
+// ignoreServersDisabled 导入流程已约定禁用含占位符的 server，只把自动禁用记入日志，不视为失败
+func ignoreServersDisabled(err error) error {
+	var disabled *MCPServersDisabledError
+	if errors.As(err, &disabled) {
+		fmt.Printf("[INFO] %s\n", disabled.Error())
+		return nil
+	}
+	return err
+}
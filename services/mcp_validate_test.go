@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMCPValidateServer(t *testing.T) {
+	ms := NewMCPService()
+	for _, tc := range []struct {
+		server MCPServer
+		want   []string
+	}{
+		{MCPServer{Name: "ok", Type: "stdio", Command: "npx", Args: []string{"-y", "ok-mcp"}}, nil},
+		{MCPServer{Name: "local", Type: "stdio", Args: []string{"--token={token}"}}, []string{"stdio 类型需要提供 command", "{token}"}},
+		{MCPServer{Name: "remote", Type: "http"}, []string{"http 类型需要提供 url"}},
+		{MCPServer{Type: "http", URL: "https://example.com/mcp?apiKey={apiKey}&team={team}"}, []string{"server name 不能为空", "{apiKey}, {team}"}},
+	} {
+		got := ms.ValidateServer(tc.server)
+		if len(got) != len(tc.want) {
+			t.Errorf("ValidateServer(%+v) = %v, 期望 %d 条", tc.server, got, len(tc.want))
+			continue
+		}
+		for i, want := range tc.want {
+			if !strings.Contains(got[i], want) {
+				t.Errorf("ValidateServer(%+v)[%d] = %q, 期望包含 %q", tc.server, i, got[i], want)
+			}
+		}
+	}
+}
+
+func TestSaveServersReportsAutoDisabled(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	ms := NewMCPService()
+
+	err := ms.SaveServers([]MCPServer{
+		{Name: "search", Type: "http", URL: "https://example.com/mcp?apiKey={apiKey}", EnablePlatform: []string{platClaudeCode}},
+		{Name: "draft", Type: "http", URL: "https://example.com/mcp?apiKey={apiKey}"},
+		{Name: "local", Type: "stdio", Command: "npx", EnablePlatform: []string{platCodex}},
+	})
+	var disabled *MCPServersDisabledError
+	if !errors.As(err, &disabled) {
+		t.Fatalf("期望返回 MCPServersDisabledError, 得到 %v", err)
+	}
+	// 未启用任何平台的 server 没有被禁用，不出现在列表中
+	if len(disabled.Servers) != 1 || disabled.Servers[0].Name != "search" || !strings.Contains(err.Error(), "{apiKey}") {
+		t.Fatalf("被禁用的 server 列表不正确: %+v", disabled.Servers)
+	}
+
+	// 自动禁用后配置仍然保存
+	servers, err := ms.ListServers()
+	if err != nil {
+		t.Fatalf("列出 MCP server 失败: %v", err)
+	}
+	found := 0
+	for _, server := range servers {
+		switch server.Name {
+		case "search":
+			found++
+			if len(server.EnablePlatform) != 0 || len(server.MissingPlaceholders) != 1 {
+				t.Errorf("search 应被取消启用: %+v", server)
+			}
+		case "local":
+			found++
+			if !platformContains(server.EnablePlatform, platCodex) {
+				t.Errorf("local 应保持启用: %+v", server)
+			}
+		}
+	}
+	if found != 2 {
+		t.Fatalf("配置应已保存, 得到 %+v", servers)
+	}
+	if err := ms.SaveServers(servers); err != nil {
+		t.Fatalf("没有 server 被禁用时不应返回错误: %v", err)
+	}
+}
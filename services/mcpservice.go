@@ -51,18 +51,20 @@ func NewMCPService() *MCPService {
 }
 
 type MCPServer struct {
-	Name                string            `json:"name"`
-	Type                string            `json:"type"`
-	Command             string            `json:"command,omitempty"`
-	Args                []string          `json:"args,omitempty"`
-	Env                 map[string]string `json:"env,omitempty"`
-	URL                 string            `json:"url,omitempty"`
-	Website             string            `json:"website,omitempty"`
-	Tips                string            `json:"tips,omitempty"`
-	EnablePlatform      []string          `json:"enable_platform"`
-	EnabledInClaude     bool              `json:"enabled_in_claude"`
-	EnabledInCodex      bool              `json:"enabled_in_codex"`
-	MissingPlaceholders []string          `json:"missing_placeholders"`
+	Name                   string            `json:"name"`
+	Type                   string            `json:"type"`
+	Command                string            `json:"command,omitempty"`
+	Args                   []string          `json:"args,omitempty"`
+	Env                    map[string]string `json:"env,omitempty"`
+	URL                    string            `json:"url,omitempty"`
+	Headers                map[string]string `json:"headers,omitempty"`
+	Website                string            `json:"website,omitempty"`
+	Tips                   string            `json:"tips,omitempty"`
+	EnablePlatform         []string          `json:"enable_platform"`
+	EnabledInClaude        bool              `json:"enabled_in_claude"`
+	EnabledInCodex         bool              `json:"enabled_in_codex"`
+	EnabledInClaudeDesktop bool              `json:"enabled_in_claude_desktop"`
+	MissingPlaceholders    []string          `json:"missing_placeholders"`
 }
 
 type rawMCPServer struct {
@@ -71,6 +73,7 @@ type rawMCPServer struct {
 	Args           []string          `json:"args,omitempty"`
 	Env            map[string]string `json:"env,omitempty"`
 	URL            string            `json:"url,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
 	Website        string            `json:"website,omitempty"`
 	Tips           string            `json:"tips,omitempty"`
 	EnablePlatform []string          `json:"enable_platform"`
@@ -90,6 +93,7 @@ type claudeDesktopServer struct {
 	Args    []string          `json:"args,omitempty"`
 	Env     map[string]string `json:"env,omitempty"`
 	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 func (ms *MCPService) ListServers() ([]MCPServer, error) {
@@ -103,6 +107,7 @@ func (ms *MCPService) ListServers() ([]MCPServer, error) {
 
 	claudeEnabled := loadClaudeEnabledServers()
 	codexEnabled := loadCodexEnabledServers()
+	desktopEnabled := loadClaudeDesktopEnabledServers()
 
 	names := make([]string, 0, len(config))
 	for name := range config {
@@ -116,30 +121,41 @@ func (ms *MCPService) ListServers() ([]MCPServer, error) {
 		typ := normalizeServerType(entry.Type)
 		platforms := normalizePlatforms(entry.EnablePlatform)
 		server := MCPServer{
-			Name:            name,
-			Type:            typ,
-			Command:         strings.TrimSpace(entry.Command),
-			Args:            cloneArgs(entry.Args),
-			Env:             cloneEnv(entry.Env),
-			URL:             strings.TrimSpace(entry.URL),
-			Website:         strings.TrimSpace(entry.Website),
-			Tips:            strings.TrimSpace(entry.Tips),
-			EnablePlatform:  platforms,
-			EnabledInClaude: containsNormalized(claudeEnabled, name),
-			EnabledInCodex:  containsNormalized(codexEnabled, name),
-		}
-		server.MissingPlaceholders = detectPlaceholders(server.URL, server.Args)
+			Name:                   name,
+			Type:                   typ,
+			Command:                strings.TrimSpace(entry.Command),
+			Args:                   cloneArgs(entry.Args),
+			Env:                    cloneEnv(entry.Env),
+			URL:                    strings.TrimSpace(entry.URL),
+			Headers:                cloneEnv(entry.Headers),
+			Website:                strings.TrimSpace(entry.Website),
+			Tips:                   strings.TrimSpace(entry.Tips),
+			EnablePlatform:         platforms,
+			EnabledInClaude:        containsNormalized(claudeEnabled, name),
+			EnabledInCodex:         containsNormalized(codexEnabled, name),
+			EnabledInClaudeDesktop: containsNormalized(desktopEnabled, name),
+		}
+		server.MissingPlaceholders = detectPlaceholders(server.URL, server.Args, server.Headers)
 		servers = append(servers, server)
 	}
 
 	return servers, nil
 }
 
+// SaveServers 保存 server 列表并同步到 Claude/Codex
+// 含未填写占位符的 server 会被取消启用，此时配置已保存，返回的 *MCPServersDisabledError 列出被禁用的 server 及原因
 func (ms *MCPService) SaveServers(servers []MCPServer) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
+	return ms.saveServersLocked(servers)
+}
+
+// saveServersLocked 校验并保存 server 列表，同步到 Claude/Codex 配置，调用方需持有 ms.mu
+// 含未填写占位符的 server 会被取消启用后照常保存，此时返回 *MCPServersDisabledError 列出原因
+func (ms *MCPService) saveServersLocked(servers []MCPServer) error {
 	normalized := make([]MCPServer, len(servers))
+	var disabled []MCPDisabledServer
 	raw := make(map[string]rawMCPServer, len(servers))
 	for i := range servers {
 		server := servers[i]
@@ -151,26 +167,29 @@ func (ms *MCPService) SaveServers(servers []MCPServer) error {
 		platforms := normalizePlatforms(server.EnablePlatform)
 		args := cleanArgs(server.Args)
 		env := cleanEnv(server.Env)
+		headers := cleanEnv(server.Headers)
 		command := strings.TrimSpace(server.Command)
 		url := strings.TrimSpace(server.URL)
 		if typ == "stdio" && command == "" {
 			return fmt.Errorf("%s 需要提供 command", name)
 		}
-		if typ == "http" && url == "" {
+		if isURLServerType(typ) && url == "" {
 			return fmt.Errorf("%s 需要提供 url", name)
 		}
 		normalized[i] = MCPServer{
-			Name:            name,
-			Type:            typ,
-			Command:         command,
-			Args:            args,
-			Env:             env,
-			URL:             url,
-			Website:         strings.TrimSpace(server.Website),
-			Tips:            strings.TrimSpace(server.Tips),
-			EnablePlatform:  platforms,
-			EnabledInClaude: server.EnabledInClaude,
-			EnabledInCodex:  server.EnabledInCodex,
+			Name:                   name,
+			Type:                   typ,
+			Command:                command,
+			Args:                   args,
+			Env:                    env,
+			URL:                    url,
+			Headers:                headers,
+			Website:                strings.TrimSpace(server.Website),
+			Tips:                   strings.TrimSpace(server.Tips),
+			EnablePlatform:         platforms,
+			EnabledInClaude:        server.EnabledInClaude,
+			EnabledInCodex:         server.EnabledInCodex,
+			EnabledInClaudeDesktop: server.EnabledInClaudeDesktop,
 		}
 		raw[name] = rawMCPServer{
 			Type:           typ,
@@ -178,13 +197,17 @@ func (ms *MCPService) SaveServers(servers []MCPServer) error {
 			Args:           args,
 			Env:            env,
 			URL:            url,
+			Headers:        headers,
 			Website:        normalized[i].Website,
 			Tips:           normalized[i].Tips,
 			EnablePlatform: platforms,
 		}
-		placeholders := detectPlaceholders(url, args)
+		placeholders := detectPlaceholders(url, args, headers)
 		normalized[i].MissingPlaceholders = placeholders
 		if len(placeholders) > 0 {
+			if len(platforms) > 0 {
+				disabled = append(disabled, MCPDisabledServer{Name: name, Reasons: placeholderReasons(placeholders)})
+			}
 			normalized[i].EnablePlatform = []string{}
 			rawEntry := raw[name]
 			rawEntry.EnablePlatform = []string{}
@@ -192,15 +215,28 @@ func (ms *MCPService) SaveServers(servers []MCPServer) error {
 		}
 	}
 
+	previous, err := ms.readConfig()
+	if err != nil {
+		return err
+	}
 	if err := ms.saveConfig(raw); err != nil {
 		return err
 	}
+	if err := ms.updateSuppressedBuiltIns(previous, raw); err != nil {
+		return err
+	}
 	if err := ms.syncClaudeServers(normalized); err != nil {
 		return err
 	}
 	if err := ms.syncCodexServers(normalized); err != nil {
 		return err
 	}
+	if err := ms.syncClaudeDesktopServers(normalized, previous); err != nil {
+		return err
+	}
+	if len(disabled) > 0 {
+		return &MCPServersDisabledError{Servers: disabled}
+	}
 	return nil
 }
 
@@ -217,24 +253,10 @@ func (ms *MCPService) configPath() (string, error) {
 }
 
 func (ms *MCPService) loadConfig() (map[string]rawMCPServer, error) {
-	path, err := ms.configPath()
+	payload, err := ms.readConfig()
 	if err != nil {
 		return nil, err
 	}
-	payload := map[string]rawMCPServer{}
-	if data, err := os.ReadFile(path); err == nil {
-		if len(data) > 0 {
-			if err := json.Unmarshal(data, &payload); err != nil {
-				return nil, err
-			}
-		}
-	} else if !errors.Is(err, os.ErrNotExist) {
-		return nil, err
-	}
-
-	for name, entry := range payload {
-		payload[name] = normalizeRawEntry(entry)
-	}
 
 	changed := false
 	if imported, err := ms.importFromClaude(payload); err == nil {
@@ -245,7 +267,11 @@ func (ms *MCPService) loadConfig() (map[string]rawMCPServer, error) {
 		return nil, err
 	}
 
-	if ensureBuiltInServers(payload) {
+	suppressed, err := ms.loadSuppressedBuiltIns()
+	if err != nil {
+		return nil, err
+	}
+	if ensureBuiltInServers(payload, suppressed) {
 		changed = true
 	}
 
@@ -258,6 +284,29 @@ func (ms *MCPService) loadConfig() (map[string]rawMCPServer, error) {
 	return payload, nil
 }
 
+// readConfig 读取 mcp.json 中保存的 server，不导入 Claude 配置也不补充内置 server
+func (ms *MCPService) readConfig() (map[string]rawMCPServer, error) {
+	path, err := ms.configPath()
+	if err != nil {
+		return nil, err
+	}
+	payload := map[string]rawMCPServer{}
+	if data, err := os.ReadFile(path); err == nil {
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &payload); err != nil {
+				return nil, err
+			}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for name, entry := range payload {
+		payload[name] = normalizeRawEntry(entry)
+	}
+	return payload, nil
+}
+
 func (ms *MCPService) importFromClaude(existing map[string]rawMCPServer) (map[string]rawMCPServer, error) {
 	path, err := claudeConfigPath()
 	if err != nil {
@@ -298,7 +347,7 @@ func (ms *MCPService) importFromClaude(existing map[string]rawMCPServer) (map[st
 			typeHint = "stdio"
 		}
 		typ := normalizeServerType(typeHint)
-		if typ == "http" && entry.URL == "" {
+		if isURLServerType(typ) && entry.URL == "" {
 			continue
 		}
 		if typ == "stdio" && entry.Command == "" {
@@ -310,6 +359,7 @@ func (ms *MCPService) importFromClaude(existing map[string]rawMCPServer) (map[st
 			Args:           cleanArgs(entry.Args),
 			Env:            cleanEnv(entry.Env),
 			URL:            strings.TrimSpace(entry.URL),
+			Headers:        cleanEnv(entry.Headers),
 			EnablePlatform: []string{platClaudeCode},
 		}
 	}
@@ -336,11 +386,18 @@ func normalizeServerType(value string) string {
 	switch strings.ToLower(strings.TrimSpace(value)) {
 	case "http":
 		return "http"
+	case "sse":
+		return "sse"
 	default:
 		return "stdio"
 	}
 }
 
+// isURLServerType http 与 sse 都通过 url 连接远程 server，不需要 command
+func isURLServerType(typ string) bool {
+	return typ == "http" || typ == "sse"
+}
+
 func normalizePlatforms(values []string) []string {
 	seen := make(map[string]struct{})
 	result := make([]string, 0, len(values))
@@ -362,6 +419,8 @@ func normalizePlatform(value string) (string, bool) {
 		return "claude-code", true
 	case "codex":
 		return "codex", true
+	case "claude-desktop", "claude_desktop":
+		return platClaudeDesktop, true
 	default:
 		return "", false
 	}
@@ -381,6 +440,7 @@ func normalizeRawEntry(entry rawMCPServer) rawMCPServer {
 	entry.Tips = strings.TrimSpace(entry.Tips)
 	entry.Args = cleanArgs(entry.Args)
 	entry.Env = cleanEnv(entry.Env)
+	entry.Headers = cleanEnv(entry.Headers)
 	entry.EnablePlatform = normalizePlatforms(entry.EnablePlatform)
 	return entry
 }
@@ -506,9 +566,13 @@ func (ms *MCPService) mergeImportedServers(target, imported map[string]rawMCPSer
 	return changed
 }
 
-func ensureBuiltInServers(target map[string]rawMCPServer) bool {
+// ensureBuiltInServers 补充缺失的内置 server，用户删除过的（suppressed）不再补充
+func ensureBuiltInServers(target map[string]rawMCPServer, suppressed map[string]struct{}) bool {
 	changed := false
 	for name, builtIn := range builtInServers {
+		if _, ok := suppressed[name]; ok {
+			continue
+		}
 		builtIn = normalizeRawEntry(builtIn)
 		if existing, ok := target[name]; ok {
 			merged := existing
@@ -525,6 +589,9 @@ func ensureBuiltInServers(target map[string]rawMCPServer) bool {
 			if merged.URL == "" {
 				merged.URL = builtIn.URL
 			}
+			if len(merged.Headers) == 0 {
+				merged.Headers = builtIn.Headers
+			}
 			if merged.Website == "" {
 				merged.Website = builtIn.Website
 			}
@@ -611,8 +678,11 @@ func platformContains(platforms []string, target string) bool {
 
 func buildClaudeDesktopEntry(server MCPServer) claudeDesktopServer {
 	entry := claudeDesktopServer{Type: server.Type}
-	if server.Type == "http" {
+	if isURLServerType(server.Type) {
 		entry.URL = server.URL
+		if len(server.Headers) > 0 {
+			entry.Headers = server.Headers
+		}
 	} else {
 		entry.Command = server.Command
 		if len(server.Args) > 0 {
@@ -628,8 +698,12 @@ func buildClaudeDesktopEntry(server MCPServer) claudeDesktopServer {
 func buildCodexEntry(server MCPServer) map[string]any {
 	entry := make(map[string]any)
 	entry["type"] = server.Type
-	if server.Type == "http" {
+	if isURLServerType(server.Type) {
 		entry["url"] = server.URL
+		// Codex 以 http_headers 配置远程 server 的固定请求头
+		if len(server.Headers) > 0 {
+			entry["http_headers"] = server.Headers
+		}
 	} else {
 		entry["command"] = server.Command
 		if len(server.Args) > 0 {
@@ -662,12 +736,15 @@ func codexConfigPath() (string, error) {
 	return filepath.Join(dir, codexConfigFile), nil
 }
 
-func detectPlaceholders(url string, args []string) []string {
+func detectPlaceholders(url string, args []string, headers map[string]string) []string {
 	set := make(map[string]struct{})
 	collectPlaceholders(set, url)
 	for _, arg := range args {
 		collectPlaceholders(set, arg)
 	}
+	for _, value := range headers {
+		collectPlaceholders(set, value)
+	}
 	if len(set) == 0 {
 		return []string{}
 	}
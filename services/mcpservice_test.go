@@ -0,0 +1,241 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+func TestMCPServerSSETransport(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// Claude 配置中已有的 sse server 导入后保持 sse 类型
+	claudeConfig := `{"mcpServers":{"events":{"type":"sse","url":"https://example.com/sse"},"broken":{"type":"sse"}}}`
+	if err := os.WriteFile(filepath.Join(home, claudeMcpFile), []byte(claudeConfig), 0o600); err != nil {
+		t.Fatalf("写入 Claude 配置失败: %v", err)
+	}
+	ms := NewMCPService()
+	servers, err := ms.ListServers()
+	if err != nil {
+		t.Fatalf("列出 MCP server 失败: %v", err)
+	}
+	var events *MCPServer
+	for i := range servers {
+		if servers[i].Name == "broken" {
+			t.Fatalf("缺少 url 的 sse server 不应导入")
+		}
+		if servers[i].Name == "events" {
+			events = &servers[i]
+		}
+	}
+	if events == nil || events.Type != "sse" || events.URL != "https://example.com/sse" {
+		t.Fatalf("sse server 应原样导入, 得到 %+v", events)
+	}
+
+	if err := ms.SaveServers([]MCPServer{{Name: "events", Type: "sse", EnablePlatform: []string{platClaudeCode}}}); err == nil {
+		t.Fatalf("缺少 url 的 sse server 应保存失败")
+	}
+	if reasons := ms.ValidateServer(MCPServer{Name: "events", Type: "SSE"}); len(reasons) != 1 || reasons[0] != "sse 类型需要提供 url" {
+		t.Fatalf("ValidateServer = %v", reasons)
+	}
+
+	events.URL = "https://example.com/sse?token={token}"
+	events.EnablePlatform = []string{platClaudeCode, platCodex}
+	if err := ms.SaveServers([]MCPServer{*events}); err == nil {
+		t.Fatalf("sse url 中的占位符应导致自动禁用")
+	}
+
+	events.URL = "https://example.com/sse"
+	if err := ms.SaveServers([]MCPServer{*events}); err != nil {
+		t.Fatalf("保存 sse server 失败: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(home, claudeMcpFile))
+	if err != nil {
+		t.Fatalf("读取 Claude 配置失败: %v", err)
+	}
+	var claude struct {
+		Servers map[string]claudeDesktopServer `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(data, &claude); err != nil {
+		t.Fatalf("解析 Claude 配置失败: %v", err)
+	}
+	if got := claude.Servers["events"]; got.Type != "sse" || got.URL != "https://example.com/sse" || got.Command != "" {
+		t.Fatalf("Claude 配置中的 sse server 不正确: %+v", got)
+	}
+
+	data, err = os.ReadFile(filepath.Join(home, codexDirName, codexConfigFile))
+	if err != nil {
+		t.Fatalf("读取 Codex 配置失败: %v", err)
+	}
+	var codex codexMcpFilePayload
+	if err := toml.Unmarshal(data, &codex); err != nil {
+		t.Fatalf("解析 Codex 配置失败: %v", err)
+	}
+	if got := codex.Servers["events"]; got["type"] != "sse" || got["url"] != "https://example.com/sse" {
+		t.Fatalf("Codex 配置中的 sse server 不正确: %+v", got)
+	}
+}
+
+func TestMCPServerHeaders(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	ms := NewMCPService()
+
+	server := MCPServer{
+		Name:           "search",
+		Type:           "http",
+		URL:            "https://example.com/mcp",
+		Headers:        map[string]string{"Authorization": "Bearer {token}", " X-Region ": "us"},
+		EnablePlatform: []string{platClaudeCode, platCodex},
+	}
+	if err := ms.SaveServers([]MCPServer{server}); err == nil || !strings.Contains(err.Error(), "{token}") {
+		t.Fatalf("请求头中的占位符应导致自动禁用, err = %v", err)
+	}
+	servers, _ := ms.ListServers()
+	for _, s := range servers {
+		if s.Name == "search" && (len(s.MissingPlaceholders) != 1 || s.MissingPlaceholders[0] != "token") {
+			t.Fatalf("请求头中的占位符应被记录: %+v", s)
+		}
+	}
+
+	server.Headers["Authorization"] = "Bearer tok-123"
+	if err := ms.SaveServers([]MCPServer{server}); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(home, claudeMcpFile))
+	var claude struct {
+		Servers map[string]claudeDesktopServer `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(data, &claude); err != nil {
+		t.Fatalf("解析 Claude 配置失败: %v", err)
+	}
+	if got := claude.Servers["search"].Headers; got["Authorization"] != "Bearer tok-123" || got["X-Region"] != "us" {
+		t.Fatalf("Claude 配置中的请求头不正确: %+v", got)
+	}
+	data, _ = os.ReadFile(filepath.Join(home, codexDirName, codexConfigFile))
+	var codex codexMcpFilePayload
+	if err := toml.Unmarshal(data, &codex); err != nil {
+		t.Fatalf("解析 Codex 配置失败: %v", err)
+	}
+	if got, ok := codex.Servers["search"]["http_headers"].(map[string]any); !ok || got["Authorization"] != "Bearer tok-123" {
+		t.Fatalf("Codex 配置中的请求头不正确: %+v", codex.Servers["search"])
+	}
+
+	// 导出时敏感请求头替换为占位符，普通请求头保留
+	exported, err := ms.ExportServers()
+	if err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+	var bundle mcpExportBundle
+	if err := json.Unmarshal(exported, &bundle); err != nil {
+		t.Fatalf("导出内容不是有效 JSON: %v", err)
+	}
+	if got := bundle.Servers["search"].Headers; got["Authorization"] != "{Authorization}" || got["X-Region"] != "us" {
+		t.Fatalf("导出的请求头不正确: %+v", got)
+	}
+
+	// 内置 server 补全时保留用户配置的请求头
+	servers, _ = ms.ListServers()
+	for i := range servers {
+		if servers[i].Name == "reftools" {
+			servers[i].URL = "https://api.ref.tools/mcp"
+			servers[i].Headers = map[string]string{"x-ref-api-key": "ref-123"}
+		}
+	}
+	if err := ms.SaveServers(servers); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	servers, _ = ms.ListServers()
+	for _, s := range servers {
+		if s.Name == "reftools" && s.Headers["x-ref-api-key"] != "ref-123" {
+			t.Fatalf("内置 server 的请求头应被保留: %+v", s)
+		}
+	}
+}
+
+func TestMCPSyncClaudeDesktop(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("APPDATA", filepath.Join(home, "AppData", "Roaming"))
+	path, err := claudeDesktopConfigPath()
+	if err != nil {
+		t.Fatalf("获取 Claude Desktop 配置路径失败: %v", err)
+	}
+	if !strings.HasPrefix(path, home) || filepath.Base(filepath.Dir(path)) != "Claude" {
+		t.Fatalf("Claude Desktop 配置路径 = %s", path)
+	}
+
+	// 没有启用 claude-desktop 的 server 时不创建配置文件
+	ms := NewMCPService()
+	local := MCPServer{Name: "local", Type: "stdio", Command: "npx", Args: []string{"-y", "local-mcp"}, EnablePlatform: []string{platClaudeCode}}
+	if err := ms.SaveServers([]MCPServer{local}); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("未启用 Claude Desktop 时不应创建配置文件: %v", err)
+	}
+
+	// 已有配置中的其他字段和非本应用管理的 server 保持不变
+	existing := `{"globalShortcut":"Ctrl+Space","mcpServers":{"manual":{"command":"uvx","args":["manual-mcp"]},"local":{"command":"old"}}}`
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(existing), 0o600); err != nil {
+		t.Fatalf("写入 Claude Desktop 配置失败: %v", err)
+	}
+	local.EnablePlatform = []string{"claude_desktop"}
+	if err := ms.SaveServers([]MCPServer{local}); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	readDesktop := func() map[string]any {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("读取 Claude Desktop 配置失败: %v", err)
+		}
+		payload := map[string]any{}
+		if err := json.Unmarshal(data, &payload); err != nil {
+			t.Fatalf("解析 Claude Desktop 配置失败: %v", err)
+		}
+		return payload
+	}
+	payload := readDesktop()
+	servers, _ := payload["mcpServers"].(map[string]any)
+	entry, _ := servers["local"].(map[string]any)
+	if payload["globalShortcut"] != "Ctrl+Space" || servers["manual"] == nil || entry["command"] != "npx" {
+		t.Fatalf("Claude Desktop 配置不正确: %+v", payload)
+	}
+	listed, _ := ms.ListServers()
+	for _, server := range listed {
+		if server.Name == "local" && (!server.EnabledInClaudeDesktop || server.EnabledInClaude) {
+			t.Fatalf("local 应只启用 Claude Desktop: %+v", server)
+		}
+	}
+
+	// 取消启用后只移除本应用管理的 server
+	local.EnablePlatform = nil
+	if err := ms.SaveServers([]MCPServer{local}); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	servers, _ = readDesktop()["mcpServers"].(map[string]any)
+	if servers["local"] != nil || servers["manual"] == nil {
+		t.Fatalf("取消启用后的 Claude Desktop 配置不正确: %+v", servers)
+	}
+
+	// 无法解析的配置文件不被覆盖
+	if err := os.WriteFile(path, []byte("{broken"), 0o600); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := ms.SaveServers([]MCPServer{local}); err == nil {
+		t.Fatalf("Claude Desktop 配置无法解析时应返回错误")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "{broken" {
+		t.Fatalf("无法解析的配置不应被覆盖: %s", data)
+	}
+}
@@ -0,0 +1,47 @@
+package services
+
+import "strings"
+
+// normalizeModelName 生成模型名的比较键：去掉首尾空白，不区分大小写时转为小写
+// 只用于匹配，转发给上游的仍是原始模型名或映射表中配置的目标模型名
+func normalizeModelName(model string, caseSensitive bool) string {
+	model = strings.TrimSpace(model)
+	if !caseSensitive {
+		model = strings.ToLower(model)
+	}
+	return model
+}
+
+// modelWildcardCaptures 按 normalizeModelName 的规则匹配通配符模式，返回每个 * 匹配到的部分
+// 不区分大小写时匹配部分仍取自请求中的模型名，保留客户端原本的大小写（如 "Claude-*" 映射 "claude-Opus" 得到 "Opus"）
+func modelWildcardCaptures(pattern string, model string, caseSensitive bool) ([]string, bool) {
+	normalizedPattern := normalizeModelName(pattern, caseSensitive)
+	if !strings.Contains(normalizedPattern, "*") {
+		return nil, normalizedPattern == normalizeModelName(model, caseSensitive)
+	}
+	model = strings.TrimSpace(model)
+	folded := normalizeModelName(model, caseSensitive)
+	captures, ok := wildcardCaptures(normalizedPattern, folded)
+	if !ok || caseSensitive || !isASCII(model) {
+		// 非 ASCII 字符转小写后字节长度可能变化，无法按位置取回原始大小写
+		return captures, ok
+	}
+
+	// ASCII 转小写不改变字节位置：按匹配位置从原始模型名中取回各部分
+	parts := strings.Split(normalizedPattern, "*")
+	offset := len(parts[0])
+	for i, capture := range captures {
+		captures[i] = model[offset : offset+len(capture)]
+		offset += len(capture) + len(parts[i+1])
+	}
+	return captures, true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
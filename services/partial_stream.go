@@ -0,0 +1,97 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errStreamInterrupted 上游在返回 2xx 并写出部分响应后中断，此时已无法重试或改写状态码
+var errStreamInterrupted = errors.New("上游响应中途中断")
+
+// upstreamBodyReader 记录读取上游响应体时的错误，用于区分"上游中断"与"客户端写入失败"
+type upstreamBodyReader struct {
+	io.ReadCloser
+	err error
+}
+
+func (r *upstreamBodyReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// watchUpstreamBody 包装上游响应体，返回的 reader 在读取失败时记录错误
+func watchUpstreamBody(resp *http.Response) *upstreamBodyReader {
+	if resp == nil || resp.Body == nil {
+		return &upstreamBodyReader{ReadCloser: http.NoBody}
+	}
+	watched := &upstreamBodyReader{ReadCloser: resp.Body}
+	resp.Body = watched
+	return watched
+}
+
+// writeStreamErrorEvent 在已经开始的 SSE 响应末尾追加一个终止错误事件，格式与各平台流式错误一致：
+//
+//	claude            event: error / data: {"type": "error", "error": {"type": "api_error", "code": "stream_interrupted", ...}}
+//	codex (responses) event: error / data: {"type": "error", "code": "stream_interrupted", "message": ...}
+//	chat completions  data: {"error": {"type": "server_error", "code": "stream_interrupted", ...}}
+//	gemini            data: {"error": {"code": 502, "status": "UNAVAILABLE", "reason": "stream_interrupted", ...}}
+func writeStreamErrorEvent(c *gin.Context, kind string, endpoint string, message string, provider string) {
+	var event string
+	var payload any
+	switch {
+	case kind == "claude":
+		event = "error"
+		payload = gin.H{"type": "error", "error": gin.H{
+			"type":     anthropicErrorType(http.StatusBadGateway),
+			"code":     ErrCodeStreamInterrupted,
+			"message":  message,
+			"provider": provider,
+		}}
+	case kind == "gemini":
+		payload = gin.H{"error": gin.H{
+			"code":     http.StatusBadGateway,
+			"status":   googleErrorStatus(http.StatusBadGateway),
+			"reason":   ErrCodeStreamInterrupted,
+			"message":  message,
+			"provider": provider,
+		}}
+	case endpoint == chatCompletionsEndpoint:
+		payload = gin.H{"error": gin.H{
+			"type":     openAIErrorType(http.StatusBadGateway),
+			"code":     ErrCodeStreamInterrupted,
+			"message":  message,
+			"provider": provider,
+		}}
+	default:
+		event = "error"
+		payload = gin.H{
+			"type":     "error",
+			"code":     ErrCodeStreamInterrupted,
+			"message":  message,
+			"provider": provider,
+		}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	// 上游中断时最后一行可能不完整，先换行结束它
+	frame := "\n"
+	if event != "" {
+		frame += "event: " + event + "\n"
+	}
+	frame += "data: " + string(data) + "\n\n"
+	if _, err := c.Writer.WriteString(frame); err != nil {
+		fmt.Printf("[WARN] 写入流式错误事件失败: %v\n", err)
+		return
+	}
+	c.Writer.Flush()
+}
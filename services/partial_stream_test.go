@@ -0,0 +1,63 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMidStreamDisconnectRecordedAsPartial(t *testing.T) {
+	setupTestEnv(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":12}}}\n\n"))
+		// 中断前已输出的内容需超过 relay 预读的 1KB，否则会按普通上游错误处理
+		for i := 0; i < 20; i++ {
+			_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"hello world\"}}\n\n"))
+		}
+		_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"hel"))
+		w.(http.Flusher).Flush()
+		// 不发送结束块直接断开连接，模拟上游中途掉线
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "flaky", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4","stream":true}`))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("已开始的流式响应状态码应保持 200，实际 %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "message_start") {
+		t.Fatalf("客户端应收到中断前的部分响应: %s", body)
+	}
+	if !strings.Contains(body, "\nevent: error\ndata: ") || !strings.Contains(body, ErrCodeStreamInterrupted) {
+		t.Fatalf("响应末尾应追加流式错误事件: %s", body)
+	}
+	if strings.Contains(body, ErrCodeUpstreamError) {
+		t.Fatalf("已写出部分响应后不应再写入 JSON 错误响应: %s", body)
+	}
+
+	logs, err := NewLogService().QueryLogs(RequestLogQuery{Platform: "claude"})
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("查询日志失败: %v, %d 条", err, len(logs))
+	}
+	if !logs[0].Partial || logs[0].HttpCode != http.StatusOK {
+		t.Fatalf("中途中断的请求应记录为 partial: %+v", logs[0])
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// pricingConfigFile 自定义模型单价（相对于 ~/.code-switch），内容形如
+//
+//	{"my-model": {"input": 3, "output": 15, "cache_create": 3.75, "cache_read": 0.3}}
+//
+// 单位为美元 / 百万 tokens，优先于内置价格表；文件不存在时只使用内置价格表
+const pricingConfigFile = "pricing.json"
+
+// pricingOverrides 按文件修改时间缓存已解析的自定义单价，修改 pricing.json 后无需重启即可生效
+var pricingOverrides struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	service *modelpricing.Service
+	base    *modelpricing.Service
+}
+
+// pricingConfigPath 获取自定义单价文件路径
+func pricingConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户目录失败: %w", err)
+	}
+	return filepath.Join(home, ".code-switch", pricingConfigFile), nil
+}
+
+// loadPricingOverrides 读取自定义单价，文件不存在时返回 nil
+func loadPricingOverrides(path string) (map[string]modelpricing.ModelPrice, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取自定义单价失败: %w", err)
+	}
+	var overrides map[string]modelpricing.ModelPrice
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", pricingConfigFile, err)
+	}
+	for model, price := range overrides {
+		if price.Input < 0 || price.Output < 0 || price.CacheCreate < 0 || price.CacheRead < 0 {
+			return nil, fmt.Errorf("模型 %s 的单价不能为负数", model)
+		}
+	}
+	return overrides, nil
+}
+
+// effectivePricing 返回叠加 pricing.json 后的价格服务；自定义单价无效时记录警告并回退到内置价格表
+func effectivePricing(base *modelpricing.Service) *modelpricing.Service {
+	if base == nil {
+		return nil
+	}
+	path, err := pricingConfigPath()
+	if err != nil {
+		return base
+	}
+	var modTime time.Time
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		modTime, size = info.ModTime(), info.Size()
+	}
+
+	pricingOverrides.mu.Lock()
+	defer pricingOverrides.mu.Unlock()
+	if pricingOverrides.service != nil && pricingOverrides.base == base && pricingOverrides.path == path &&
+		pricingOverrides.modTime.Equal(modTime) && pricingOverrides.size == size {
+		return pricingOverrides.service
+	}
+	service := base
+	if overrides, err := loadPricingOverrides(path); err != nil {
+		log.Printf("⚠️  %v，使用内置价格表", err)
+	} else {
+		service = base.WithOverrides(overrides)
+	}
+	pricingOverrides.path = path
+	pricingOverrides.modTime = modTime
+	pricingOverrides.size = size
+	pricingOverrides.base = base
+	pricingOverrides.service = service
+	return service
+}
+
+// applyRequestCost 按模型单价计算本次请求费用并写入 requestLog；未知模型 HasPricing 为 false、费用为 0
+func applyRequestCost(requestLog *ReqeustLog) {
+	base, err := modelpricing.DefaultService()
+	if err != nil || requestLog == nil {
+		return
+	}
+	cost := effectivePricing(base).CalculateCost(requestLog.Model, modelpricing.UsageSnapshot{
+		InputTokens:       requestLog.InputTokens,
+		OutputTokens:      requestLog.OutputTokens,
+		CacheCreateTokens: requestLog.CacheCreateTokens,
+		CacheReadTokens:   requestLog.CacheReadTokens,
+		CacheCreation:     cacheCreationDetail(requestLog.Ephemeral5mTokens, requestLog.Ephemeral1hTokens),
+	})
+	if !cost.HasPricing {
+		cost = modelpricing.CostBreakdown{}
+	}
+	setLogCost(requestLog, cost)
+}
+
+// storedRecordCost 读取写入日志时保存的费用；旧记录或当时没有单价的记录返回 false，由调用方按当前单价重新计算
+func storedRecordCost(record xdb.Record) (modelpricing.CostBreakdown, bool) {
+	if !record.GetBool("has_pricing") {
+		return modelpricing.CostBreakdown{}, false
+	}
+	return modelpricing.CostBreakdown{
+		InputCost:       record.GetFloat64("input_cost"),
+		OutputCost:      record.GetFloat64("output_cost"),
+		CacheCreateCost: record.GetFloat64("cache_create_cost"),
+		CacheReadCost:   record.GetFloat64("cache_read_cost"),
+		Ephemeral5mCost: record.GetFloat64("ephemeral_5m_cost"),
+		Ephemeral1hCost: record.GetFloat64("ephemeral_1h_cost"),
+		TotalCost:       record.GetFloat64("total_cost"),
+		HasPricing:      true,
+	}, true
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestRequestCostStoredInLog(t *testing.T) {
+	setupTestEnv(t)
+	home, _ := os.UserHomeDir()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte(`data: {"type":"message_start","message":{"usage":{"input_tokens":1000}}}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "upstream", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	send := func(model string) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"`+model+`","stream":true}`))
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+		}
+	}
+	type storedCost struct {
+		hasPricing bool
+		input      float64
+		total      float64
+	}
+	lastRow := func() storedCost {
+		db, err := xdb.DB("default")
+		if err != nil {
+			t.Fatalf("获取数据库失败: %v", err)
+		}
+		var row storedCost
+		if err := db.QueryRow("SELECT has_pricing, input_cost, total_cost FROM request_log ORDER BY id DESC LIMIT 1").Scan(&row.hasPricing, &row.input, &row.total); err != nil {
+			t.Fatalf("读取 request_log 失败: %v", err)
+		}
+		return row
+	}
+	writePricing := func(content string) {
+		if err := os.MkdirAll(filepath.Join(home, ".code-switch"), 0o755); err != nil {
+			t.Fatalf("创建目录失败: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(home, ".code-switch", pricingConfigFile), []byte(content), 0o644); err != nil {
+			t.Fatalf("写入 pricing.json 失败: %v", err)
+		}
+	}
+
+	send("claude-sonnet-4-20250514")
+	if row := lastRow(); !row.hasPricing || row.input <= 0 || row.total != row.input {
+		t.Fatalf("已知模型应写入费用: %+v", row)
+	}
+
+	send("totally-unknown-model")
+	if row := lastRow(); row.hasPricing || row.total != 0 {
+		t.Fatalf("未知模型应记录为无单价、费用为 0: %+v", row)
+	}
+
+	// pricing.json 中的自定义单价（美元 / 百万 tokens）无需重启即可生效
+	writePricing(`{"totally-unknown-model": {"input": 2, "output": 10}}`)
+	send("totally-unknown-model")
+	if row := lastRow(); !row.hasPricing || math.Abs(row.total-0.002) > 1e-9 {
+		t.Fatalf("自定义单价应参与计费: %+v", row)
+	}
+
+	// 已写入的费用不随单价调整而变化
+	writePricing(`{"totally-unknown-model": {"input": 40, "output": 10}}`)
+	logs, err := NewLogService().ListRequestLogs("claude", "", 10)
+	if err != nil || len(logs) != 3 {
+		t.Fatalf("查询日志失败: %d, %v", len(logs), err)
+	}
+	if math.Abs(logs[0].TotalCost-0.002) > 1e-9 {
+		t.Fatalf("已保存的费用不应按新单价重算: %v", logs[0].TotalCost)
+	}
+	// 写入时没有单价的旧记录按当前单价计算
+	if !logs[1].HasPricing || math.Abs(logs[1].TotalCost-0.04) > 1e-9 {
+		t.Fatalf("无单价的记录应按当前单价计算: %+v", logs[1])
+	}
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// projectRootHeader CLI 传入的工作目录，relay 据此读取项目级路由配置
+	projectRootHeader = "X-Project-Root"
+	// projectConfigFileName 项目根目录下的路由配置文件
+	projectConfigFileName = ".bmai.json"
+	// maxProjectConfigSize 项目配置文件大小上限
+	maxProjectConfigSize = 64 * 1024
+	// maxCachedProjects 缓存的项目数上限，超过后清空重建
+	maxCachedProjects = 64
+)
+
+// ProjectRouting 某个平台的项目级路由：Provider 指定使用的 provider，Tags 只在带有任一标签的 provider 中选择
+// 两者同时配置时需同时满足
+type ProjectRouting struct {
+	Provider string   `json:"provider,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// ProjectConfig 项目根目录下 .bmai.json 的内容，按平台配置路由，未配置的平台使用全局配置
+//
+//	{"claude": {"provider": "work-relay"}, "codex": {"tags": ["cheap"]}}
+type ProjectConfig struct {
+	Claude *ProjectRouting `json:"claude,omitempty"`
+	Codex  *ProjectRouting `json:"codex,omitempty"`
+}
+
+func (pc *ProjectConfig) routing(kind string) *ProjectRouting {
+	if pc == nil {
+		return nil
+	}
+	switch kind {
+	case "claude":
+		return pc.Claude
+	case "codex":
+		return pc.Codex
+	}
+	return nil
+}
+
+// validate 校验并规范化项目配置
+func (pc *ProjectConfig) validate() error {
+	for _, kind := range []string{"claude", "codex"} {
+		r := pc.routing(kind)
+		if r == nil {
+			continue
+		}
+		r.Provider = strings.TrimSpace(r.Provider)
+		tags := make([]string, 0, len(r.Tags))
+		for _, tag := range r.Tags {
+			if tag = strings.TrimSpace(tag); tag == "" {
+				return fmt.Errorf("%s.tags 不能包含空标签", kind)
+			}
+			tags = append(tags, tag)
+		}
+		r.Tags = tags
+		if r.Provider == "" && len(r.Tags) == 0 {
+			return fmt.Errorf("%s 需要配置 provider 或 tags", kind)
+		}
+	}
+	return nil
+}
+
+// filter 按项目路由筛选 provider，没有匹配的 provider 时返回错误
+func (r *ProjectRouting) filter(kind string, providers []Provider) ([]Provider, error) {
+	scoped := make([]Provider, 0, len(providers))
+	for _, p := range providers {
+		if r.Provider != "" && p.Name != r.Provider {
+			continue
+		}
+		if len(r.Tags) > 0 && !p.HasAnyTag(r.Tags) {
+			continue
+		}
+		scoped = append(scoped, p)
+	}
+	if len(scoped) > 0 {
+		return scoped, nil
+	}
+	if r.Provider != "" && len(r.Tags) > 0 {
+		return nil, fmt.Errorf("%s provider '%s' 不存在或没有标签 %v", kind, r.Provider, r.Tags)
+	}
+	if r.Provider != "" {
+		return nil, fmt.Errorf("%s provider '%s' 不存在", kind, r.Provider)
+	}
+	return nil, fmt.Errorf("没有 %s provider 带有标签 %v", kind, r.Tags)
+}
+
+// cachedProjectConfig 缓存的项目配置，文件修改时间或大小变化时重新加载
+type cachedProjectConfig struct {
+	modTime time.Time
+	size    int64
+	config  *ProjectConfig // 文件不存在时为 nil
+	err     error
+}
+
+// projectConfigCache 按项目根目录缓存 .bmai.json
+type projectConfigCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedProjectConfig
+}
+
+func newProjectConfigCache() *projectConfigCache {
+	return &projectConfigCache{entries: make(map[string]cachedProjectConfig)}
+}
+
+// load 读取项目配置；文件不存在时返回 nil, nil
+func (pc *projectConfigCache) load(root string) (*ProjectConfig, error) {
+	path := filepath.Join(root, projectConfigFileName)
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取项目配置失败: %w", err)
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if cached, ok := pc.entries[root]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.config, cached.err
+	}
+
+	config, err := readProjectConfig(path, info)
+	if len(pc.entries) >= maxCachedProjects {
+		pc.entries = make(map[string]cachedProjectConfig)
+	}
+	pc.entries[root] = cachedProjectConfig{modTime: info.ModTime(), size: info.Size(), config: config, err: err}
+	return config, err
+}
+
+func readProjectConfig(path string, info os.FileInfo) (*ProjectConfig, error) {
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s 不是文件", path)
+	}
+	if info.Size() > maxProjectConfigSize {
+		return nil, fmt.Errorf("%s 超过 %d 字节", path, maxProjectConfigSize)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取项目配置失败: %w", err)
+	}
+	var config ProjectConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("%s 无效: %w", path, err)
+	}
+	return &config, nil
+}
+
+func (prs *ProviderRelayService) projectConfigs() *projectConfigCache {
+	prs.stateMu.Lock()
+	defer prs.stateMu.Unlock()
+	if prs.projects == nil {
+		prs.projects = newProjectConfigCache()
+	}
+	return prs.projects
+}
+
+// projectProviders 按请求头 X-Project-Root 指向的 .bmai.json 筛选 provider
+// 未携带请求头、项目没有配置文件或未配置该平台时原样返回；配置无效时返回错误
+func (prs *ProviderRelayService) projectProviders(c *gin.Context, kind string, providers []Provider) ([]Provider, error) {
+	root := strings.TrimSpace(c.GetHeader(projectRootHeader))
+	if root == "" {
+		return providers, nil
+	}
+	// 与 X-Force-Provider 一致，只接受本机请求，避免远程请求探测本机文件
+	if !isLoopbackRequest(c.Request) {
+		fmt.Printf("[WARN] 忽略非本机请求的 %s: %s\n", projectRootHeader, root)
+		return providers, nil
+	}
+	if !filepath.IsAbs(root) {
+		return nil, fmt.Errorf("%s 必须是绝对路径: %s", projectRootHeader, root)
+	}
+	root = filepath.Clean(root)
+
+	config, err := prs.projectConfigs().load(root)
+	if err != nil {
+		return nil, err
+	}
+	routing := config.routing(kind)
+	if routing == nil {
+		return providers, nil
+	}
+	scoped, err := routing.filter(kind, providers)
+	if err != nil {
+		return nil, fmt.Errorf("%s 无效: %w", filepath.Join(root, projectConfigFileName), err)
+	}
+	fmt.Printf("[INFO] 使用项目路由 %s: %d 个候选 provider\n", root, len(scoped))
+	return scoped, nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestProjectRouting(t *testing.T) {
+	setupTestEnv(t)
+
+	newUpstream := func(id string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(projectRootHeader) != "" {
+				t.Errorf("%s 不应转发给上游", projectRootHeader)
+			}
+			_, _ = w.Write([]byte(`{"id":"` + id + `"}`))
+		}))
+	}
+	global, work, cheap := newUpstream("global"), newUpstream("work"), newUpstream("cheap")
+	defer global.Close()
+	defer work.Close()
+	defer cheap.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "global", APIURL: global.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+		{ID: 2, Name: "work", APIURL: work.URL, APIKey: "sk-test", Enabled: true, Level: 2},
+		{ID: 3, Name: "cheap", APIURL: cheap.URL, APIKey: "sk-test", Enabled: true, Level: 3, Tags: []string{"Cheap"}},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	send := func(root string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`))
+		req.RemoteAddr = "127.0.0.1:50000"
+		if root != "" {
+			req.Header.Set(projectRootHeader, root)
+		}
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	expectProvider := func(root string, want string) {
+		t.Helper()
+		rec := send(root)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+		}
+		if got := gjson.Get(rec.Body.String(), "id").String(); got != want {
+			t.Fatalf("应使用 %s, 实际 %s", want, got)
+		}
+	}
+	version := 0
+	writeConfig := func(root string, content string) {
+		t.Helper()
+		version++
+		// 修改时间精度可能较粗，显式推进 mtime 确保缓存失效
+		path := filepath.Join(root, projectConfigFileName)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("写入项目配置失败: %v", err)
+		}
+		mtime := time.Now().Add(time.Duration(version) * time.Second)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("修改时间失败: %v", err)
+		}
+	}
+
+	// 未携带请求头、项目没有配置文件：使用全局配置
+	root := t.TempDir()
+	expectProvider("", "global")
+	expectProvider(root, "global")
+
+	writeConfig(root, `{"claude": {"provider": "work"}}`)
+	expectProvider(root, "work")
+
+	writeConfig(root, `{"claude": {"tags": ["cheap"]}}`)
+	expectProvider(root, "cheap")
+
+	writeConfig(root, `{"codex": {"provider": "other"}}`)
+	expectProvider(root, "global")
+
+	for _, invalid := range []string{`{"claude": `, `{"claude": {}}`, `{"claude": {"provider": "missing"}}`} {
+		writeConfig(root, invalid)
+		rec := send(root)
+		if rec.Code != http.StatusBadRequest || gjson.Get(rec.Body.String(), "error.code").String() != ErrCodeInvalidProjectConfig {
+			t.Fatalf("无效配置 %s 应返回 %s, 得到 %d %s", invalid, ErrCodeInvalidProjectConfig, rec.Code, rec.Body.String())
+		}
+	}
+
+	if rec := send("relative/path"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("相对路径应被拒绝, 得到 %d", rec.Code)
+	}
+}
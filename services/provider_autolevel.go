@@ -0,0 +1,156 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// autoLevelBandRatio 与同组最快 provider 的中位耗时相差不超过该比例时归为同一 Level
+	autoLevelBandRatio = 0.2
+	// autoLevelBandMinMs 延迟区间的最小宽度，避免几毫秒的抖动把延迟都很低的 provider 拆到不同 Level
+	autoLevelBandMinMs = 50
+	autoLevelMaxLevel  = 10
+)
+
+// LevelAssignment 按测速结果调整后的单个 provider（按调整后的顺序返回，便于前端展示差异）
+type LevelAssignment struct {
+	ProviderID    int64  `json:"providerId"`
+	ProviderName  string `json:"providerName"`
+	Enabled       bool   `json:"enabled"`
+	Measured      bool   `json:"measured"` // 是否参与了本次调整（已启用且有测速结果）
+	FromLevel     int    `json:"fromLevel"`
+	ToLevel       int    `json:"toLevel"`
+	MedianTotalMs int64  `json:"medianTotalMs,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// PreviewAutoAssignLevels 计算 AutoAssignLevels 的调整结果但不保存
+func (ps *ProviderService) PreviewAutoAssignLevels(kind string, results []SpeedTestResult) ([]LevelAssignment, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return nil, fmt.Errorf("加载 %s 供应商失败: %w", kind, err)
+	}
+	_, assignments := assignLevelsByLatency(providers, results)
+	return assignments, nil
+}
+
+// AutoAssignLevels 按测速结果重排 provider 并写回 Level：最快的为 Level 1，延迟相近（同一区间内）的归为同一 Level，
+// 测速全部失败的排在最后一个 Level 之后。未启用或没有测速结果的 provider 保持原配置和位置不变；
+// 相同的测速结果重复调用不会再产生变化。返回调整后的顺序
+func (ps *ProviderService) AutoAssignLevels(kind string, results []SpeedTestResult) ([]LevelAssignment, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return nil, fmt.Errorf("加载 %s 供应商失败: %w", kind, err)
+	}
+	reordered, assignments := assignLevelsByLatency(providers, results)
+
+	changed := false
+	for i := range providers {
+		if providers[i].ID != reordered[i].ID || providers[i].Level != reordered[i].Level {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return assignments, nil
+	}
+	if err := ps.saveProvidersLocked(kind, reordered); err != nil {
+		return nil, fmt.Errorf("保存 %s 供应商失败: %w", kind, err)
+	}
+	for _, a := range assignments {
+		if a.Measured && a.FromLevel != a.ToLevel {
+			fmt.Printf("[INFO] 测速调级: %s/%s Level %d -> %d\n", kind, a.ProviderName, a.FromLevel, a.ToLevel)
+		}
+	}
+	return assignments, nil
+}
+
+// assignLevelsByLatency 计算新的顺序和 Level：参与调整的 provider 按延迟排序后依次填回它们原来占据的位置，
+// 其余 provider 位置不变
+func assignLevelsByLatency(providers []Provider, results []SpeedTestResult) ([]Provider, []LevelAssignment) {
+	byName := make(map[string]SpeedTestResult, len(results))
+	for _, result := range results {
+		byName[strings.TrimSpace(result.Provider)] = result
+	}
+
+	slots := make([]int, 0, len(providers))
+	for i, p := range providers {
+		if _, ok := byName[p.Name]; ok && p.Enabled {
+			slots = append(slots, i)
+		}
+	}
+	measured := make([]int, len(slots))
+	copy(measured, slots)
+	sort.SliceStable(measured, func(i, j int) bool {
+		a, b := byName[providers[measured[i]].Name], byName[providers[measured[j]].Name]
+		if (a.Successes > 0) != (b.Successes > 0) {
+			return a.Successes > 0
+		}
+		return a.MedianTotalMs < b.MedianTotalMs
+	})
+
+	// 按延迟区间分组：与当前组最快者相差不超过区间宽度的归为同一 Level
+	levels := make(map[int]int, len(measured))
+	level, leader, failedLevel := 0, int64(0), 0
+	for _, idx := range measured {
+		result := byName[providers[idx].Name]
+		if result.Successes == 0 {
+			if failedLevel == 0 {
+				failedLevel = level + 1
+			}
+			levels[idx] = failedLevel
+			continue
+		}
+		band := int64(float64(leader) * autoLevelBandRatio)
+		if band < autoLevelBandMinMs {
+			band = autoLevelBandMinMs
+		}
+		if level == 0 || result.MedianTotalMs-leader > band {
+			level++
+			leader = result.MedianTotalMs
+		}
+		levels[idx] = level
+	}
+
+	reordered := make([]Provider, len(providers))
+	copy(reordered, providers)
+	for i, slot := range slots {
+		p := providers[measured[i]]
+		p.Level = levels[measured[i]]
+		if p.Level > autoLevelMaxLevel {
+			p.Level = autoLevelMaxLevel
+		}
+		reordered[slot] = p
+	}
+
+	fromLevels := make(map[int64]int, len(providers))
+	for _, p := range providers {
+		fromLevels[p.ID] = p.Level
+	}
+	assignments := make([]LevelAssignment, 0, len(reordered))
+	for _, p := range reordered {
+		result, ok := byName[p.Name]
+		a := LevelAssignment{
+			ProviderID:   p.ID,
+			ProviderName: p.Name,
+			Enabled:      p.Enabled,
+			Measured:     ok && p.Enabled,
+			FromLevel:    fromLevels[p.ID],
+			ToLevel:      p.Level,
+		}
+		if a.Measured {
+			a.MedianTotalMs = result.MedianTotalMs
+			a.Error = result.Error
+		}
+		assignments = append(assignments, a)
+	}
+	return reordered, assignments
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// providerCheckTimeout 手动测试 provider 的超时时间
+	providerCheckTimeout = 15 * time.Second
+	// providerCheckSnippetBytes 失败时返回的响应体片段长度
+	providerCheckSnippetBytes = 512
+)
+
+// providerCheckDefaultModels 未配置模型白名单时测试请求使用的模型
+var providerCheckDefaultModels = map[string]string{
+	"claude": "claude-haiku-4-5-20251001",
+	"codex":  "gpt-5",
+}
+
+// TestResult 手动测试 provider 的结果
+type TestResult struct {
+	Provider   string `json:"provider"`
+	Model      string `json:"model"`
+	Success    bool   `json:"success"`
+	StatusCode int    `json:"statusCode"` // 0 表示没有收到响应
+	LatencyMs  int64  `json:"latencyMs"`
+	Error      string `json:"error,omitempty"` // 连接错误或失败响应体的片段
+}
+
+// TestProvider 向 provider 发送一个最小请求（Claude 为 max_tokens=1 的 /v1/messages，Codex 为 /responses），
+// 用于在启用前验证 URL 和 API Key；不写请求日志，也不影响黑名单和熔断状态
+// 只有找不到 provider 等无法发起测试的情况返回 error，上游失败体现在 TestResult 中
+func (prs *ProviderRelayService) TestProvider(kind, providerName string) (TestResult, error) {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if _, ok := providerCheckDefaultModels[kind]; !ok {
+		return TestResult{}, fmt.Errorf("不支持测试平台 %s 的 provider", kind)
+	}
+	providers, err := prs.providerService.LoadProviders(kind)
+	if err != nil {
+		return TestResult{}, fmt.Errorf("加载 provider 失败: %w", err)
+	}
+	for _, provider := range providers {
+		if provider.Name == providerName {
+			return prs.checkProvider(kind, provider)
+		}
+	}
+	return TestResult{}, fmt.Errorf("未找到 provider '%s'", providerName)
+}
+
+// checkProvider 发送测试请求并记录状态码与耗时
+func (prs *ProviderRelayService) checkProvider(kind string, provider Provider) (TestResult, error) {
+	if strings.TrimSpace(provider.APIURL) == "" {
+		return TestResult{}, fmt.Errorf("provider '%s' 未配置 API 地址", provider.Name)
+	}
+	model := provider.GetEffectiveModel(providerCheckModel(kind, provider))
+	result := TestResult{Provider: provider.Name, Model: model}
+
+	endpoint, payload := "/v1/messages", map[string]any{
+		"model":      model,
+		"max_tokens": 1,
+		"messages":   []map[string]string{{"role": "user", "content": "ping"}},
+	}
+	if kind == "codex" {
+		endpoint, payload = "/responses", map[string]any{
+			"model":             model,
+			"input":             "ping",
+			"max_output_tokens": 16,
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return TestResult{}, fmt.Errorf("构建测试请求失败: %w", err)
+	}
+	if len(provider.BodyOverrides) > 0 {
+		if modified, err := applyBodyOverrides(body, provider.BodyOverrides); err == nil {
+			body = modified
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, joinURL(provider.APIURL, endpoint), bytes.NewReader(body))
+	if err != nil {
+		return TestResult{}, fmt.Errorf("创建测试请求失败: %w", err)
+	}
+	headers := map[string]string{
+		"Content-Type": "application/json",
+		"Accept":       "application/json",
+	}
+	if kind == "claude" {
+		headers["Anthropic-Version"] = "2023-06-01"
+	}
+	applyGlobalHeaders(headers, loadGlobalHeaders(prs.settingsService))
+	applyProviderHeaders(headers, provider)
+	applyProviderAuth(headers, provider)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	client, err := upstreamHTTPClient(provider.Name, provider.InsecureSkipVerify, provider.upstreamOverride(), providerCheckTimeout)
+	if err != nil {
+		return TestResult{}, fmt.Errorf("构建上游 TLS 配置失败: %w", err)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: providerCheckTimeout}
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = fmt.Sprintf("请求失败: %v", err)
+		return result, nil
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	result.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !result.Success {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, providerCheckSnippetBytes))
+		result.Error = strings.TrimSpace(string(snippet))
+	}
+	return result, nil
+}
+
+// providerCheckModel 测试请求使用的模型：优先使用白名单中第一个非通配符模型，否则使用平台默认模型
+func providerCheckModel(kind string, provider Provider) string {
+	models := make([]string, 0, len(provider.SupportedModels))
+	for model, supported := range provider.SupportedModels {
+		if supported && !strings.Contains(model, "*") {
+			models = append(models, model)
+		}
+	}
+	if len(models) == 0 {
+		return providerCheckDefaultModels[kind]
+	}
+	sort.Strings(models)
+	return models[0]
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/tidwall/gjson"
+)
+
+func TestTestProvider(t *testing.T) {
+	setupTestEnv(t)
+
+	type seen struct {
+		path   string
+		auth   string
+		model  string
+		tokens int64
+	}
+	requests := make(chan seen, 2)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- seen{
+			path:   r.URL.Path,
+			auth:   r.Header.Get("Authorization"),
+			model:  gjson.GetBytes(body, "model").String(),
+			tokens: gjson.GetBytes(body, "max_tokens").Int(),
+		}
+		if r.Header.Get("Authorization") != "Bearer sk-good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	relay, _ := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "good", APIURL: upstream.URL, APIKey: "sk-good", Level: 1, ModelMapping: map[string]string{"claude-haiku-4-5-20251001": "haiku-proxy"},
+			SupportedModels: map[string]bool{"haiku-proxy": true}},
+		{ID: 2, Name: "bad-key", APIURL: upstream.URL, APIKey: "sk-bad", Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	result, err := relay.TestProvider("claude", "good")
+	if err != nil || !result.Success || result.StatusCode != http.StatusOK {
+		t.Fatalf("测试应成功: %v, %+v", err, result)
+	}
+	if got := <-requests; got.path != "/v1/messages" || got.model != "haiku-proxy" || got.tokens != 1 {
+		t.Fatalf("测试请求不正确: %+v", got)
+	}
+
+	result, err = relay.TestProvider("claude", "bad-key")
+	if err != nil || result.Success || result.StatusCode != http.StatusUnauthorized || !strings.Contains(result.Error, "invalid api key") {
+		t.Fatalf("失败结果应包含状态码和响应片段: %v, %+v", err, result)
+	}
+	<-requests
+
+	// 不写请求日志，也不计入黑名单
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatalf("获取数据库失败: %v", err)
+	}
+	var logs int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM request_log`).Scan(&logs); err != nil || logs != 0 {
+		t.Fatalf("测试请求不应写入请求日志: %v, %d 条", err, logs)
+	}
+	if statuses, err := relay.blacklistService.GetBlacklistStatus("claude"); err != nil || len(statuses) != 0 {
+		t.Fatalf("测试请求不应影响黑名单: %v, %+v", err, statuses)
+	}
+
+	if _, err := relay.TestProvider("claude", "missing"); err == nil {
+		t.Fatalf("不存在的 provider 应返回错误")
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// providerCircuitFailureThreshold 单个 provider 在统计窗口内失败达到该次数时熔断
+	providerCircuitFailureThreshold = 3
+	// providerCircuitFailureWindow 失败次数的统计窗口，第一次失败超过该时长后重新计数
+	providerCircuitFailureWindow = 10 * time.Second
+	// providerCircuitCooldown 熔断后跳过该 provider 的时长，到期后进入 half-open
+	providerCircuitCooldown = 5 * time.Second
+)
+
+// ProviderCircuitStatus 单个 provider 的短时熔断状态
+type ProviderCircuitStatus struct {
+	Platform          string     `json:"platform"`
+	Provider          string     `json:"provider"`
+	State             string     `json:"state"` // closed / open / half_open
+	RecentFailures    int        `json:"recentFailures"`
+	OpenedAt          *time.Time `json:"openedAt,omitempty"`
+	RetryAfterSeconds int        `json:"retryAfterSeconds"` // open 状态下距离 half-open 的秒数
+}
+
+// CircuitBreaker 按 kind + provider 在内存中统计短时间内的失败：短时间内连续失败的 provider 暂时跳过，
+// 冷却结束后进入 half-open，下一次请求成功即关闭、失败则重新熔断
+//
+// 与黑名单相互独立：黑名单针对持续失败、按等级冷却并持久化到 SQLite；
+// 熔断只在内存中生效，用于挡住瞬时的失败风暴，不会因每次抖动写数据库
+type CircuitBreaker struct {
+	mu     sync.Mutex
+	clock  Clock
+	states map[string]*circuitState
+}
+
+func NewCircuitBreaker(clock Clock) *CircuitBreaker {
+	if clock == nil {
+		clock = systemClock
+	}
+	return &CircuitBreaker{clock: clock, states: make(map[string]*circuitState)}
+}
+
+func (b *CircuitBreaker) stateLocked(kind, name string) *circuitState {
+	key := concurrencyKey(kind, name)
+	st, ok := b.states[key]
+	if !ok {
+		st = &circuitState{state: circuitClosed}
+		b.states[key] = st
+	}
+	return st
+}
+
+// advanceLocked 冷却结束的熔断转为 half-open
+func (b *CircuitBreaker) advanceLocked(st *circuitState, now time.Time) {
+	if st.state == circuitOpen && !now.Before(st.openUntil) {
+		st.state = circuitHalfOpen
+	}
+}
+
+// IsOpen 判断 provider 是否处于熔断中，熔断时返回恢复时间；half-open 状态视为可用
+func (b *CircuitBreaker) IsOpen(kind, name string) (bool, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st, ok := b.states[concurrencyKey(kind, name)]
+	if !ok {
+		return false, time.Time{}
+	}
+	b.advanceLocked(st, b.clock.Now())
+	if st.state == circuitOpen {
+		return true, st.openUntil
+	}
+	return false, time.Time{}
+}
+
+// RecordSuccess 请求成功：关闭熔断并清零失败计数
+func (b *CircuitBreaker) RecordSuccess(kind, name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := concurrencyKey(kind, name)
+	if st, ok := b.states[key]; ok && st.state != circuitClosed {
+		fmt.Printf("[INFO] Provider %s/%s 请求成功，熔断已关闭\n", kind, name)
+	}
+	delete(b.states, key)
+}
+
+// RecordFailure 请求失败：窗口内失败达到阈值时熔断，half-open 状态下失败立即重新熔断
+func (b *CircuitBreaker) RecordFailure(kind, name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.stateLocked(kind, name)
+	now := b.clock.Now()
+	b.advanceLocked(st, now)
+	switch st.state {
+	case circuitHalfOpen:
+		st.failures++
+		b.openLocked(kind, name, st, now)
+		return
+	case circuitOpen:
+		return
+	}
+
+	if st.failures == 0 || now.Sub(st.firstFailure) > providerCircuitFailureWindow {
+		st.failures = 0
+		st.firstFailure = now
+	}
+	st.failures++
+	if st.failures >= providerCircuitFailureThreshold {
+		b.openLocked(kind, name, st, now)
+	}
+}
+
+func (b *CircuitBreaker) openLocked(kind, name string, st *circuitState, now time.Time) {
+	st.state = circuitOpen
+	st.openedAt = now
+	st.openUntil = now.Add(providerCircuitCooldown)
+	fmt.Printf("[WARN] Provider %s/%s 短时间内失败 %d 次，熔断 %s\n", kind, name, st.failures, providerCircuitCooldown)
+}
+
+// Status 获取 provider 的熔断状态，未记录过失败的 provider 为 closed
+func (b *CircuitBreaker) Status(kind, name string) ProviderCircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := ProviderCircuitStatus{Platform: kind, Provider: name, State: circuitClosed}
+	st, ok := b.states[concurrencyKey(kind, name)]
+	if !ok {
+		return status
+	}
+	now := b.clock.Now()
+	b.advanceLocked(st, now)
+	status.State = st.state
+	status.RecentFailures = st.failures
+	if st.state != circuitClosed {
+		openedAt := st.openedAt
+		status.OpenedAt = &openedAt
+	}
+	if st.state == circuitOpen {
+		if remaining := st.openUntil.Sub(now); remaining > 0 {
+			status.RetryAfterSeconds = int(remaining.Round(time.Second).Seconds())
+		}
+	}
+	return status
+}
+
+// Reset 手动关闭 provider 的熔断
+func (b *CircuitBreaker) Reset(kind, name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.states, concurrencyKey(kind, name))
+}
+
+func (prs *ProviderRelayService) providerCircuits() *CircuitBreaker {
+	prs.stateMu.Lock()
+	defer prs.stateMu.Unlock()
+	if prs.providerBreaker == nil {
+		prs.providerBreaker = NewCircuitBreaker(systemClock)
+	}
+	return prs.providerBreaker
+}
+
+// GetProviderCircuitStates 获取平台下所有 provider 的短时熔断状态（按配置顺序）
+func (prs *ProviderRelayService) GetProviderCircuitStates(kind string) ([]ProviderCircuitStatus, error) {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	providers, err := prs.providerService.LoadProviders(kind)
+	if err != nil {
+		return nil, fmt.Errorf("加载 provider 失败: %w", err)
+	}
+	breaker := prs.providerCircuits()
+	states := make([]ProviderCircuitStatus, 0, len(providers))
+	for _, provider := range providers {
+		states = append(states, breaker.Status(kind, provider.Name))
+	}
+	return states, nil
+}
+
+// ResetProviderCircuit 手动关闭 provider 的短时熔断
+func (prs *ProviderRelayService) ResetProviderCircuit(kind, name string) {
+	prs.providerCircuits().Reset(strings.ToLower(strings.TrimSpace(kind)), name)
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultConcurrencyWait 未配置 MaxConcurrentWaitSeconds 时等待空闲并发槽位的最长时间
+const defaultConcurrencyWait = 10 * time.Second
+
+// errProviderBusy provider 并发已满且等待超时：视为暂时不可用，切换到其他 provider，但不计入失败次数
+var errProviderBusy = errors.New("provider 并发已满")
+
+// concurrencyWait 并发已满时等待空闲槽位的最长时间
+func (p *Provider) concurrencyWait() time.Duration {
+	if p.MaxConcurrentWaitSeconds > 0 {
+		return time.Duration(p.MaxConcurrentWaitSeconds) * time.Second
+	}
+	return defaultConcurrencyWait
+}
+
+// providerConcurrency 按 kind + provider 名称统计进行中的请求，并对配置了 MaxConcurrent 的 provider 限流；零值可用
+type providerConcurrency struct {
+	mu       sync.Mutex
+	inflight map[string]int
+	// waiters 等待空闲槽位的请求，槽位释放时通知
+	waiters map[string][]chan struct{}
+}
+
+func concurrencyKey(kind, name string) string {
+	return kind + ":" + name
+}
+
+// acquire 占用一个并发槽位，返回的函数用于释放（可重复调用）
+// limit <= 0 表示不限制，只计数；槽位已满时最多等待 wait，超时返回 errProviderBusy，ctx 取消时返回 ctx.Err()
+func (pc *providerConcurrency) acquire(ctx context.Context, kind, name string, limit int, wait time.Duration) (func(), error) {
+	key := concurrencyKey(kind, name)
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		pc.mu.Lock()
+		if pc.inflight == nil {
+			pc.inflight = make(map[string]int)
+			pc.waiters = make(map[string][]chan struct{})
+		}
+		if limit <= 0 || pc.inflight[key] < limit {
+			pc.inflight[key]++
+			pc.mu.Unlock()
+			var once sync.Once
+			return func() { once.Do(func() { pc.release(key) }) }, nil
+		}
+		notify := make(chan struct{})
+		pc.waiters[key] = append(pc.waiters[key], notify)
+		pc.mu.Unlock()
+
+		if timer == nil {
+			timer = time.NewTimer(wait)
+		}
+		select {
+		case <-notify:
+			// 有槽位释放，重新竞争
+		case <-timer.C:
+			pc.removeWaiter(key, notify)
+			return nil, fmt.Errorf("%w（上限 %d，等待 %s 仍无空闲）", errProviderBusy, limit, wait)
+		case <-ctx.Done():
+			pc.removeWaiter(key, notify)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (pc *providerConcurrency) release(key string) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.inflight[key] > 0 {
+		pc.inflight[key]--
+	}
+	if pc.inflight[key] == 0 {
+		delete(pc.inflight, key)
+	}
+	// 唤醒最早的等待者
+	if waiters := pc.waiters[key]; len(waiters) > 0 {
+		close(waiters[0])
+		pc.waiters[key] = waiters[1:]
+		if len(pc.waiters[key]) == 0 {
+			delete(pc.waiters, key)
+		}
+	}
+}
+
+func (pc *providerConcurrency) removeWaiter(key string, notify chan struct{}) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	waiters := pc.waiters[key]
+	for i, ch := range waiters {
+		if ch == notify {
+			pc.waiters[key] = append(waiters[:i:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(pc.waiters[key]) == 0 {
+		delete(pc.waiters, key)
+	}
+	// 等待超时的同时恰好收到了通知：把通知转交给下一个等待者，避免槽位空闲却无人被唤醒
+	select {
+	case <-notify:
+		if next := pc.waiters[key]; len(next) > 0 {
+			close(next[0])
+			pc.waiters[key] = next[1:]
+		}
+	default:
+	}
+}
+
+// count 进行中的请求数
+func (pc *providerConcurrency) count(kind, name string) int {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.inflight[concurrencyKey(kind, name)]
+}
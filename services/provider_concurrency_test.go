@@ -0,0 +1,90 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestProviderMaxConcurrent(t *testing.T) {
+	setupTestEnv(t)
+
+	started := make(chan struct{}, 4)
+	release := make(chan struct{})
+	var active, peak int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		if n > atomic.LoadInt32(&peak) {
+			atomic.StoreInt32(&peak, n)
+		}
+		started <- struct{}{}
+		<-release
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "limited", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1, MaxConcurrent: 1, MaxConcurrentWaitSeconds: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	send := func() <-chan *httptest.ResponseRecorder {
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`))
+			router.ServeHTTP(rec, req)
+			done <- rec
+		}()
+		return done
+	}
+
+	first := send()
+	<-started
+	if got := relay.health().Providers["claude"].InFlight["limited"]; got != 1 {
+		t.Fatalf("/health 应显示 1 个进行中的请求，实际 %d", got)
+	}
+
+	// 槽位已满：第二个请求等待而不是立即失败，第一个完成后获得槽位
+	second := send()
+	time.Sleep(200 * time.Millisecond)
+	release <- struct{}{}
+	if rec := <-first; rec.Code != http.StatusOK {
+		t.Fatalf("第一个请求状态码 = %d", rec.Code)
+	}
+	<-started
+	release <- struct{}{}
+	if rec := <-second; rec.Code != http.StatusOK {
+		t.Fatalf("等待到空闲槽位的请求应成功，实际 %d: %s", rec.Code, rec.Body.String())
+	}
+	if atomic.LoadInt32(&peak) != 1 {
+		t.Fatalf("并发不应超过上限，峰值 %d", peak)
+	}
+
+	// 等待超时：返回 provider_busy，且不计入失败次数
+	third := send()
+	<-started
+	rec := <-send()
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), ErrCodeProviderBusy) {
+		t.Fatalf("等待超时应返回 provider_busy: %d %s", rec.Code, rec.Body.String())
+	}
+	release <- struct{}{}
+	<-third
+	var failures int
+	db, _ := xdb.DB("default")
+	_ = db.QueryRow(`SELECT COALESCE(SUM(failure_count), 0) FROM provider_blacklist WHERE provider_name = ?`, "limited").Scan(&failures)
+	if failures != 0 {
+		t.Fatalf("并发已满不应计入失败次数，实际 %d", failures)
+	}
+	if got := relay.health().Providers["claude"].InFlight["limited"]; got != 0 {
+		t.Fatalf("请求结束后进行中的请求数应归零，实际 %d", got)
+	}
+}
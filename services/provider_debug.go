@@ -0,0 +1,253 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+const (
+	// maxProviderExchanges 每个 provider 保留的最近请求/响应数量
+	maxProviderExchanges = 20
+	// maxExchangeBodyBytes 单个请求体/响应体的截取上限
+	maxExchangeBodyBytes = 64 * 1024
+	redactedValue        = "***"
+)
+
+// ProviderExchange 一次经 relay 转发的请求/响应记录（已脱敏）
+type ProviderExchange struct {
+	Platform        string            `json:"platform"`
+	Provider        string            `json:"provider"`
+	Method          string            `json:"method"`
+	URL             string            `json:"url"`
+	RequestHeaders  map[string]string `json:"requestHeaders"`
+	RequestBody     string            `json:"requestBody"`
+	StatusCode      int               `json:"statusCode"`
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
+	ResponseBody    string            `json:"responseBody,omitempty"`
+	Truncated       bool              `json:"truncated"`
+	Error           string            `json:"error,omitempty"`
+	DurationMs      int64             `json:"durationMs"`
+	CapturedAt      time.Time         `json:"capturedAt"`
+}
+
+// exchangeRecorder 按 platform + provider 保存最近的请求/响应，超出上限时丢弃最旧的记录
+type exchangeRecorder struct {
+	mu      sync.Mutex
+	entries map[string][]ProviderExchange
+}
+
+func newExchangeRecorder() *exchangeRecorder {
+	return &exchangeRecorder{entries: make(map[string][]ProviderExchange)}
+}
+
+func exchangeKey(platform, provider string) string {
+	return strings.ToLower(platform) + "/" + provider
+}
+
+func (r *exchangeRecorder) add(exchange ProviderExchange) {
+	key := exchangeKey(exchange.Platform, exchange.Provider)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := append(r.entries[key], exchange)
+	if len(list) > maxProviderExchanges {
+		list = append([]ProviderExchange(nil), list[len(list)-maxProviderExchanges:]...)
+	}
+	r.entries[key] = list
+}
+
+// list 按时间倒序返回记录
+func (r *exchangeRecorder) list(platform, provider string) []ProviderExchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := r.entries[exchangeKey(platform, provider)]
+	result := make([]ProviderExchange, len(list))
+	for i, exchange := range list {
+		result[len(list)-1-i] = exchange
+	}
+	return result
+}
+
+func (r *exchangeRecorder) clear(platform, provider string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, exchangeKey(platform, provider))
+}
+
+// SetProviderDebug 开启/关闭指定 provider 的请求/响应抓取，设置持久化到数据库，重启后保留
+func (prs *ProviderRelayService) SetProviderDebug(kind string, name string, enabled bool) error {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	name = strings.TrimSpace(name)
+	if kind == "" || name == "" {
+		return fmt.Errorf("platform 和 provider 不能为空")
+	}
+
+	db, err := xdb.DB("default")
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO provider_debug (platform, provider_name, debug_enabled, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(platform, provider_name) DO UPDATE SET
+			debug_enabled = excluded.debug_enabled,
+			updated_at = excluded.updated_at
+	`, kind, name, boolToInt(enabled), time.Now()); err != nil {
+		return fmt.Errorf("保存调试开关失败: %w", err)
+	}
+
+	if !enabled {
+		prs.exchangeRecorder().clear(kind, name)
+	}
+	return nil
+}
+
+// GetDebugProviders 返回开启了请求/响应抓取的 provider 名称
+func (prs *ProviderRelayService) GetDebugProviders(kind string) ([]string, error) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	rows, err := db.Query(
+		"SELECT provider_name FROM provider_debug WHERE platform = ? AND debug_enabled = 1",
+		strings.ToLower(strings.TrimSpace(kind)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("查询调试开关失败: %w", err)
+	}
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, rows.Err()
+}
+
+// GetProviderExchanges 返回指定 provider 最近抓取的请求/响应（最新在前）
+func (prs *ProviderRelayService) GetProviderExchanges(kind string, name string) []ProviderExchange {
+	return prs.exchangeRecorder().list(strings.ToLower(strings.TrimSpace(kind)), strings.TrimSpace(name))
+}
+
+// ClearProviderExchanges 清空指定 provider 已抓取的请求/响应
+func (prs *ProviderRelayService) ClearProviderExchanges(kind string, name string) {
+	prs.exchangeRecorder().clear(strings.ToLower(strings.TrimSpace(kind)), strings.TrimSpace(name))
+}
+
+// providerDebugEnabled 查询 provider 是否开启了请求/响应抓取，查询失败时视为关闭
+func providerDebugEnabled(kind string, name string) bool {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return false
+	}
+	var enabled int
+	err = db.QueryRow(
+		"SELECT debug_enabled FROM provider_debug WHERE platform = ? AND provider_name = ?",
+		strings.ToLower(kind), name,
+	).Scan(&enabled)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			fmt.Printf("[WARN] 查询 provider 调试开关失败: %v\n", err)
+		}
+		return false
+	}
+	return enabled == 1
+}
+
+func (prs *ProviderRelayService) exchangeRecorder() *exchangeRecorder {
+	prs.stateMu.Lock()
+	defer prs.stateMu.Unlock()
+	if prs.exchanges == nil {
+		prs.exchanges = newExchangeRecorder()
+	}
+	return prs.exchanges
+}
+
+// exchangeCapture 抓取一次转发的请求/响应，响应体通过 xrequest 钩子累积
+type exchangeCapture struct {
+	exchange ProviderExchange
+	apiKey   string
+	body     limitedBuffer
+	bodySize int
+	start    time.Time
+}
+
+func newExchangeCapture(kind string, provider Provider, url string, headers map[string]string, body []byte) *exchangeCapture {
+	capture := &exchangeCapture{
+		apiKey: provider.APIKey,
+		body:   limitedBuffer{max: maxExchangeBodyBytes},
+		start:  time.Now(),
+	}
+	requestBody, truncated := body, false
+	if len(requestBody) > maxExchangeBodyBytes {
+		requestBody, truncated = requestBody[:maxExchangeBodyBytes], true
+	}
+	capture.exchange = ProviderExchange{
+		Platform:       strings.ToLower(kind),
+		Provider:       provider.Name,
+		Method:         http.MethodPost,
+		URL:            redactURLQuery(url),
+		RequestHeaders: capture.redactHeaders(headers),
+		RequestBody:    capture.redactText(string(requestBody)),
+		Truncated:      truncated,
+		CapturedAt:     capture.start,
+	}
+	return capture
+}
+
+// hook 累积响应体，不修改转发给客户端的数据
+func (c *exchangeCapture) hook(data []byte) (bool, []byte) {
+	c.bodySize += len(data)
+	_, _ = c.body.Write(data)
+	return true, data
+}
+
+func (c *exchangeCapture) finish(status int, header http.Header, err error) ProviderExchange {
+	exchange := c.exchange
+	exchange.StatusCode = status
+	exchange.DurationMs = time.Since(c.start).Milliseconds()
+	if header != nil {
+		exchange.ResponseHeaders = c.redactHeaders(cloneHeaders(header))
+	}
+	exchange.ResponseBody = c.redactText(c.body.String())
+	if c.bodySize > maxExchangeBodyBytes {
+		exchange.Truncated = true
+	}
+	if err != nil {
+		exchange.Error = c.redactText(err.Error())
+	}
+	return exchange
+}
+
+// redactHeaders 隐藏认证相关的请求头/响应头
+func (c *exchangeCapture) redactHeaders(headers map[string]string) map[string]string {
+	redacted := make(map[string]string, len(headers))
+	for key, value := range headers {
+		lower := strings.ToLower(key)
+		if isSecretKey(lower) || strings.Contains(lower, "cookie") {
+			value = redactedValue
+		}
+		redacted[key] = c.redactText(value)
+	}
+	return redacted
+}
+
+// redactText 将文本中出现的 provider API Key 替换为 ***
+func (c *exchangeCapture) redactText(text string) string {
+	if c.apiKey == "" {
+		return text
+	}
+	return strings.ReplaceAll(text, c.apiKey, redactedValue)
+}
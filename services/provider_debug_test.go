@@ -0,0 +1,73 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProviderDebugCapture(t *testing.T) {
+	setupTestEnv(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","echo":"` + r.Header.Get("Authorization") + `"}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "flaky", APIURL: upstream.URL, APIKey: "sk-secret-123", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	send := func() {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`))
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+		}
+	}
+
+	send()
+	if got := relay.GetProviderExchanges("claude", "flaky"); len(got) != 0 {
+		t.Fatalf("未开启调试时不应抓取, 得到 %d 条", len(got))
+	}
+
+	if err := relay.SetProviderDebug("claude", "flaky", true); err != nil {
+		t.Fatalf("开启调试失败: %v", err)
+	}
+	if names, err := relay.GetDebugProviders("claude"); err != nil || len(names) != 1 || names[0] != "flaky" {
+		t.Fatalf("调试开关未持久化: %v, %v", names, err)
+	}
+	for i := 0; i < maxProviderExchanges+5; i++ {
+		send()
+	}
+
+	exchanges := relay.GetProviderExchanges("claude", "flaky")
+	if len(exchanges) != maxProviderExchanges {
+		t.Fatalf("抓取记录应限制为 %d 条, 得到 %d", maxProviderExchanges, len(exchanges))
+	}
+	latest := exchanges[0]
+	if latest.StatusCode != http.StatusOK || !strings.Contains(latest.RequestBody, "claude-sonnet-4") {
+		t.Fatalf("抓取内容不完整: %+v", latest)
+	}
+	if latest.RequestHeaders["Authorization"] != redactedValue {
+		t.Fatalf("Authorization 应脱敏, 得到 %q", latest.RequestHeaders["Authorization"])
+	}
+	if strings.Contains(latest.ResponseBody, "sk-secret-123") || !strings.Contains(latest.ResponseBody, "msg_1") {
+		t.Fatalf("响应体应保留内容并隐藏 API Key: %s", latest.ResponseBody)
+	}
+
+	if err := relay.SetProviderDebug("claude", "flaky", false); err != nil {
+		t.Fatalf("关闭调试失败: %v", err)
+	}
+	send()
+	if got := relay.GetProviderExchanges("claude", "flaky"); len(got) != 0 {
+		t.Fatalf("关闭调试后应清空并停止抓取, 得到 %d 条", len(got))
+	}
+}
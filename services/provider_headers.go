@@ -0,0 +1,81 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// providerAuthHeaders 由 apiKey / authScheme 决定的鉴权头，不允许通过 provider 请求头配置
+var providerAuthHeaders = map[string]bool{
+	"Authorization": true,
+	"X-Api-Key":     true,
+}
+
+// validateProviderHeaders 校验 provider 的自定义请求头；空名称在转发时跳过，不视为错误
+func validateProviderHeaders(headers map[string]string) []string {
+	errors := make([]string, 0)
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		trimmed := strings.TrimSpace(name)
+		if trimmed == "" {
+			continue
+		}
+		canonical := http.CanonicalHeaderKey(trimmed)
+		switch {
+		case !validHeaderName(trimmed):
+			errors = append(errors, fmt.Sprintf("headers 中的请求头名称无效：'%s'", name))
+		case reservedGlobalHeaders[canonical]:
+			errors = append(errors, fmt.Sprintf("headers 不能设置 %s", canonical))
+		case providerAuthHeaders[canonical]:
+			errors = append(errors, fmt.Sprintf("headers 不能设置 %s，请使用 apiKey / authScheme 配置鉴权", canonical))
+		case strings.ContainsAny(headers[name], "\r\n"):
+			errors = append(errors, fmt.Sprintf("headers 中 %s 的值不能包含换行", trimmed))
+		}
+	}
+	return errors
+}
+
+// resolveHeaderPlaceholders 将值中的 {NAME} 占位符替换为同名环境变量（与 MCP 配置的占位符写法一致），
+// 用于注入不适合明文保存在配置中的密钥；返回未设置的占位符
+func resolveHeaderPlaceholders(value string) (string, []string) {
+	var missing []string
+	resolved := placeholderPattern.ReplaceAllStringFunc(value, func(match string) string {
+		name := match[1 : len(match)-1]
+		if env, ok := os.LookupEnv(name); ok {
+			return env
+		}
+		missing = append(missing, name)
+		return match
+	})
+	return resolved, missing
+}
+
+// applyProviderHeaders 将 provider 的自定义请求头合并到转发请求头中（覆盖客户端和全局同名请求头）
+// 需在 applyProviderAuth 之前调用，鉴权头始终以 provider 的 apiKey 为准；占位符缺少对应环境变量的请求头不发送
+func applyProviderHeaders(headers map[string]string, p Provider) {
+	resolved := make(map[string]string, len(p.Headers))
+	for name, value := range p.Headers {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		canonical := http.CanonicalHeaderKey(name)
+		if reservedGlobalHeaders[canonical] || providerAuthHeaders[canonical] {
+			continue
+		}
+		value, missing := resolveHeaderPlaceholders(strings.TrimSpace(value))
+		if len(missing) > 0 {
+			fmt.Printf("[WARN] Provider %s 的请求头 %s 缺少环境变量 %s，已跳过\n", p.Name, canonical, strings.Join(missing, ", "))
+			continue
+		}
+		resolved[canonical] = value
+	}
+	applyGlobalHeaders(headers, resolved)
+}
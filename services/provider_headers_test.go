@@ -0,0 +1,71 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProviderCustomHeaders(t *testing.T) {
+	setupTestEnv(t)
+	t.Setenv("CODE_SWITCH_TEST_ORG", "team-42")
+
+	received := make(chan http.Header, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "upstream", APIURL: upstream.URL, APIKey: "sk-provider", Enabled: true, Level: 1, Headers: map[string]string{
+			"x-org-id":       "org-{CODE_SWITCH_TEST_ORG}",
+			"anthropic-beta": "prompt-caching-2024-07-31",
+			" ":              "ignored",
+			"X-Secret":       "{CODE_SWITCH_TEST_UNSET}",
+		}},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`))
+	req.Header.Set("X-Org-Id", "from-client")
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	header := <-received
+	if got := header.Values("X-Org-Id"); len(got) != 1 || got[0] != "org-team-42" {
+		t.Errorf("X-Org-Id = %v, 期望替换占位符并覆盖客户端请求头", got)
+	}
+	if got := header.Get("Anthropic-Beta"); got != "prompt-caching-2024-07-31" {
+		t.Errorf("anthropic-beta = %q", got)
+	}
+	if got := header.Get("X-Secret"); got != "" {
+		t.Errorf("缺少环境变量的请求头不应发送，实际 %q", got)
+	}
+	if got := header.Get("Authorization"); got != "Bearer sk-provider" {
+		t.Errorf("Authorization = %q", got)
+	}
+
+	// 即使配置中带有鉴权头，也不会覆盖 provider 的鉴权
+	headers := map[string]string{}
+	provider := Provider{Name: "p", APIKey: "sk-provider", Headers: map[string]string{"authorization": "Bearer other"}}
+	applyProviderHeaders(headers, provider)
+	applyProviderAuth(headers, provider)
+	if len(headers) != 1 || headers["Authorization"] != "Bearer sk-provider" {
+		t.Fatalf("provider 请求头不应覆盖鉴权: %v", headers)
+	}
+
+	invalid := Provider{Name: "p", APIURL: "https://example.com", APIKey: "k", Headers: map[string]string{
+		"Authorization": "Bearer x",
+		"bad header":    "v",
+		"X-Ok":          "a\r\nInjected: 1",
+	}}
+	if errs := invalid.ValidateConfiguration(); len(errs) != 3 {
+		t.Fatalf("非法请求头应校验失败: %v", errs)
+	}
+}
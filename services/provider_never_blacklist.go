@@ -0,0 +1,52 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// neverBlacklisted 判断 provider 是否设置了从不拉黑（按名称在缓存的配置中查找，找不到或 ps 为 nil 时视为未设置）
+func (ps *ProviderService) neverBlacklisted(platform string, providerName string) bool {
+	if ps == nil || (platform != "claude" && platform != "codex") {
+		return false
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, p := range ps.snapshotLocked(platform) {
+		if p.Name == providerName {
+			return p.NeverBlacklist
+		}
+	}
+	return false
+}
+
+// neverBlacklistWarnings 检查同一 Level 内是否有多个已启用且从不拉黑的 provider，
+// 这类 provider 失败时不会被跳过，多个同时存在通常是配置失误
+func neverBlacklistWarnings(providers []Provider) []string {
+	byLevel := make(map[int][]string)
+	for _, p := range providers {
+		if !p.Enabled || !p.NeverBlacklist {
+			continue
+		}
+		level := p.Level
+		if level <= 0 {
+			level = 1
+		}
+		byLevel[level] = append(byLevel[level], p.Name)
+	}
+
+	levels := make([]int, 0, len(byLevel))
+	for level, names := range byLevel {
+		if len(names) > 1 {
+			levels = append(levels, level)
+		}
+	}
+	sort.Ints(levels)
+	warnings := make([]string, 0, len(levels))
+	for _, level := range levels {
+		warnings = append(warnings, fmt.Sprintf("Level %d 有多个从不拉黑的 provider（%s），失败时都不会被跳过",
+			level, strings.Join(byLevel[level], ", ")))
+	}
+	return warnings
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// relayEndpointPaths forwardRequest 会拼接到 apiUrl 之后的接口路径
+var relayEndpointPaths = []string{"/v1/messages", "/responses"}
+
+// validateAPIURL 校验 provider 的 apiUrl：必须是 http/https 地址且包含主机名
+func validateAPIURL(raw string) []string {
+	if strings.TrimSpace(raw) == "" {
+		return []string{"apiUrl 不能为空"}
+	}
+	if strings.TrimSpace(raw) != raw {
+		return []string{"apiUrl 首尾不能包含空白字符"}
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return []string{fmt.Sprintf("apiUrl 格式无效：'%s'", raw)}
+	}
+	errors := make([]string, 0)
+	if scheme := strings.ToLower(parsed.Scheme); scheme != "http" && scheme != "https" {
+		errors = append(errors, fmt.Sprintf("apiUrl 必须以 http:// 或 https:// 开头：'%s'", raw))
+	} else if parsed.Host == "" {
+		errors = append(errors, fmt.Sprintf("apiUrl 缺少主机名：'%s'", raw))
+	}
+	return errors
+}
+
+// apiURLWarnings 检查 apiUrl 的路径是否已包含接口路径：转发时会再拼接一次，导致路径重复
+func apiURLWarnings(p Provider) []string {
+	parsed, err := url.Parse(strings.TrimSpace(p.APIURL))
+	if err != nil {
+		return nil
+	}
+	path := strings.ToLower(strings.TrimSuffix(parsed.Path, "/"))
+	warnings := make([]string, 0)
+	for _, endpoint := range relayEndpointPaths {
+		if strings.Contains(path, endpoint) {
+			warnings = append(warnings, fmt.Sprintf("[%s] apiUrl 已包含 %s，转发时会再次拼接导致路径重复，请去掉该路径", p.Name, endpoint))
+			break
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// defaultProviderWeight 未配置 Weight 时的权重
+const defaultProviderWeight = 1
+
+// effectiveWeight 返回 provider 的选择权重：未配置时为 1，0 表示只在同一 Level 没有其他 provider 可用时才使用
+func (p *Provider) effectiveWeight() int {
+	if p.Weight == nil {
+		return defaultProviderWeight
+	}
+	return *p.Weight
+}
+
+// cloneWeight 复制权重，避免复制出的 provider 共享同一个指针
+func cloneWeight(weight *int) *int {
+	if weight == nil {
+		return nil
+	}
+	copied := *weight
+	return &copied
+}
+
+// weightedPicker 同一 Level 内按权重随机选择 provider，零值可用（首次使用时以当前时间为种子）
+// 测试中可通过 seed 固定随机序列
+type weightedPicker struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// seed 以固定种子重置随机序列，使选择结果可复现
+func (w *weightedPicker) seed(seed int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.rng = rand.New(rand.NewSource(seed))
+}
+
+// intn 返回 [0, n) 内的随机数
+func (w *weightedPicker) intn(n int) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.rng == nil {
+		w.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return w.rng.Intn(n)
+}
+
+// selectFromLevel 从同一 Level 的可用 provider 中选出本次使用的 provider
+//
+//   - 权重为 0 的 provider 只在该 Level 没有正权重 provider 时参与选择
+//   - 参与选择的 provider 权重都相同时（包括都未配置权重），保持按配置顺序轮流使用
+//   - 否则按权重随机选择
+func (prs *ProviderRelayService) selectFromLevel(kind string, level int, group []Provider, order map[string]int) Provider {
+	weighted := make([]Provider, 0, len(group))
+	total := 0
+	uniform := true
+	for _, provider := range group {
+		weight := provider.effectiveWeight()
+		if weight <= 0 {
+			continue
+		}
+		if len(weighted) > 0 && weight != weighted[0].effectiveWeight() {
+			uniform = false
+		}
+		weighted = append(weighted, provider)
+		total += weight
+	}
+	if len(weighted) == 0 {
+		// 只剩权重为 0 的 provider：作为兜底轮流使用
+		return prs.rotation.next(kind, level, group, order)
+	}
+	if uniform {
+		return prs.rotation.next(kind, level, weighted, order)
+	}
+
+	target := prs.picker.intn(total)
+	for _, provider := range weighted {
+		target -= provider.effectiveWeight()
+		if target < 0 {
+			return provider
+		}
+	}
+	return weighted[len(weighted)-1]
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestWeightedSelectionWithinLevel(t *testing.T) {
+	setupTestEnv(t)
+
+	weight := func(w int) *int { return &w }
+	providers := []Provider{
+		{ID: 1, Name: "heavy", APIURL: "https://heavy.example.com", APIKey: "sk", Enabled: true, Level: 1, Weight: weight(3)},
+		{ID: 2, Name: "light", APIURL: "https://light.example.com", APIKey: "sk", Enabled: true, Level: 1},
+		{ID: 3, Name: "standby", APIURL: "https://standby.example.com", APIKey: "sk", Enabled: true, Level: 1, Weight: weight(0)},
+		{ID: 4, Name: "backup", APIURL: "https://backup.example.com", APIKey: "sk", Enabled: true, Level: 2},
+	}
+	sequence := func(relay *ProviderRelayService, n int) []string {
+		t.Helper()
+		var names []string
+		for i := 0; i < n; i++ {
+			provider, _, _, ok := relay.pickProvider("claude", "", 0, providers)
+			if !ok {
+				t.Fatalf("应选中 provider")
+			}
+			names = append(names, provider.Name)
+		}
+		return names
+	}
+
+	relay, _ := newTestRelay(t)
+	relay.picker.seed(42)
+	got := sequence(relay, 400)
+	counts := make(map[string]int)
+	for _, name := range got {
+		counts[name]++
+	}
+	if counts["standby"] != 0 || counts["backup"] != 0 {
+		t.Fatalf("权重为 0 或低优先级的 provider 不应被选中: %v", counts)
+	}
+	if counts["heavy"] < 250 || counts["heavy"] > 350 {
+		t.Fatalf("权重 3:1 时 heavy 应约占 3/4，实际 %v", counts)
+	}
+
+	// 相同种子得到相同的选择序列
+	other, _ := newTestRelay(t)
+	other.picker.seed(42)
+	if again := sequence(other, 400); strings.Join(again, ",") != strings.Join(got, ",") {
+		t.Fatalf("相同种子的选择序列应一致")
+	}
+
+	// 正权重的 provider 都不可用时才使用权重为 0 的 provider，而不是降级到下一个 Level
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatalf("获取数据库失败: %v", err)
+	}
+	for _, name := range []string{"heavy", "light"} {
+		if _, err := db.Exec(`INSERT INTO provider_blacklist (platform, provider_name, blacklisted_at, blacklisted_until) VALUES (?, ?, ?, ?)`,
+			"claude", name, time.Now(), time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("写入黑名单失败: %v", err)
+		}
+	}
+	if provider, level, _, _ := relay.pickProvider("claude", "", 0, providers); provider.Name != "standby" || level != 1 {
+		t.Fatalf("只剩权重为 0 的 provider 时应选中它，实际 %s (level %d)", provider.Name, level)
+	}
+
+	invalid := Provider{ID: 5, Name: "negative", APIURL: "https://n.example.com", APIKey: "sk", Weight: weight(-1)}
+	if errs := invalid.ValidateConfiguration(); !strings.Contains(strings.Join(errs, ";"), "weight 不能为负数") {
+		t.Fatalf("负数权重应校验失败: %v", errs)
+	}
+}
@@ -4,13 +4,21 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/daodao97/xgo/xdb"
@@ -25,55 +33,80 @@ type ProviderRelayService struct {
 	providerService  *ProviderService
 	geminiService    *GeminiService
 	blacklistService *BlacklistService
+	settingsService  *SettingsService
+	coalescer        *requestCoalescer
+	inflight         *inflightTracker
+	exchanges        *exchangeRecorder
+	breaker          *globalCircuitBreaker
+	providerBreaker  *CircuitBreaker // 单个 provider 的短时熔断
+	recorder         *sessionRecorder
+	clock            Clock // 为 nil 时使用系统时钟
+	projects         *projectConfigCache
+	tokenEstimator   InputTokenEstimator // 为 nil 时按请求体字节数估算
+	shadowInflight   atomic.Int32        // 进行中的影子请求数
+	rotation         levelRotation       // 同一 Level 内的轮询游标
+	picker           weightedPicker      // 同一 Level 内按权重随机选择
+	concurrency      providerConcurrency // 各 provider 进行中的请求数与并发上限
 	server           *http.Server
+	listener         net.Listener
+	active           *sync.WaitGroup // 当前 server 上进行中的请求，停止时等待其完成
 	addr             string
+	listenAddr       string    // 实际绑定的地址（addr 端口为 0 时由系统分配）
+	startedAt        time.Time // 最近一次成功启动的时间，用于 /health 的运行时长
+
+	// 运行状态：端口绑定成功后置为 true，服务退出后置为 false
+	running atomic.Bool
+	stateMu sync.Mutex
+	ready   chan struct{} // 就绪时关闭，停止后重建
 }
 
-func NewProviderRelayService(providerService *ProviderService, geminiService *GeminiService, blacklistService *BlacklistService, addr string) *ProviderRelayService {
+func NewProviderRelayService(providerService *ProviderService, geminiService *GeminiService, blacklistService *BlacklistService, settingsService *SettingsService, addr string) *ProviderRelayService {
 	if addr == "" {
 		addr = ":18100"
 	}
 
 	home, _ := os.UserHomeDir()
 
-	if err := xdb.Inits([]xdb.Config{
-		{
-			Name:   "default",
-			Driver: "sqlite",
-			DSN:    filepath.Join(home, ".code-switch", "app.db?cache=shared&mode=rwc&_busy_timeout=10000&_journal_mode=WAL"),
-		},
-	}); err != nil {
-		fmt.Printf("初始化数据库失败: %v\n", err)
-	} else {
-		if err := ensureRequestLogTable(); err != nil {
-			fmt.Printf("初始化 request_log 表失败: %v\n", err)
-		}
-		if err := ensureBlacklistTables(); err != nil {
-			fmt.Printf("初始化黑名单表失败: %v\n", err)
-		}
+	// 启动时检查数据库完整性，损坏时备份并重建（启动报告中会提示历史数据丢失）
+	if _, err := initDatabase(filepath.Join(home, ".code-switch", databaseFileName)); err != nil {
+		fmt.Printf("%v\n", err)
+	}
 
-		// 预热连接池：强制建立数据库连接，避免首次写入时失败
-		// 解决问题：首次启动时 xdb 连接池未完全初始化导致写入失败
-		db, err := xdb.DB("default")
-		if err == nil && db != nil {
-			var count int
-			if err := db.QueryRow("SELECT COUNT(*) FROM request_log").Scan(&count); err != nil {
-				fmt.Printf("⚠️  连接池预热查询失败: %v\n", err)
-			} else {
-				fmt.Printf("✅ 数据库连接已预热（request_log 记录数: %d）\n", count)
-			}
+	// 预热连接池：强制建立数据库连接，避免首次写入时失败
+	// 解决问题：首次启动时 xdb 连接池未完全初始化导致写入失败
+	if db, err := xdb.DB("default"); err == nil && db != nil {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM request_log").Scan(&count); err != nil {
+			fmt.Printf("⚠️  连接池预热查询失败: %v\n", err)
+		} else {
+			fmt.Printf("✅ 数据库连接已预热（request_log 记录数: %d）\n", count)
 		}
 	}
 
-	return &ProviderRelayService{
+	relay := &ProviderRelayService{
 		providerService:  providerService,
 		geminiService:    geminiService,
 		blacklistService: blacklistService,
+		settingsService:  settingsService,
+		coalescer:        newRequestCoalescer(),
+		inflight:         newInflightTracker(),
+		exchanges:        newExchangeRecorder(),
+		breaker:          newGlobalCircuitBreaker(systemClock),
+		providerBreaker:  NewCircuitBreaker(systemClock),
 		addr:             addr,
+		ready:            make(chan struct{}),
 	}
+	// 数据库就绪后才能读取配置的端口，其他服务应通过 Addr() 获取实际地址
+	relay.addr = relay.configuredAddr(addr)
+	return relay
 }
 
+// Start 按配置的端口（见 SettingsService.SetRelayPort）启动 relay
 func (prs *ProviderRelayService) Start() error {
+	return prs.start(prs.configuredAddr(prs.Addr()))
+}
+
+func (prs *ProviderRelayService) start(addr string) error {
 	// 启动前验证配置
 	if warnings := prs.validateConfig(); len(warnings) > 0 {
 		fmt.Println("======== Provider 配置验证警告 ========")
@@ -83,24 +116,89 @@ func (prs *ProviderRelayService) Start() error {
 		fmt.Println("========================================")
 	}
 
+	prs.stateMu.Lock()
+	defer prs.stateMu.Unlock()
+
+	if prs.running.Load() {
+		return fmt.Errorf("provider relay 已在运行: %s", prs.addr)
+	}
+
 	router := gin.Default()
+	active := &sync.WaitGroup{}
+	router.Use(trackActive(active))
 	prs.registerRoutes(router)
 
-	prs.server = &http.Server{
-		Addr:    prs.addr,
+	// 先同步绑定端口，端口被占用时直接返回错误，而不是在后台 goroutine 中静默失败
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		if errors.Is(err, syscall.EADDRINUSE) {
+			return fmt.Errorf("端口 %s 已被占用: %w", addr, err)
+		}
+		return fmt.Errorf("监听 %s 失败: %w", addr, err)
+	}
+
+	server := &http.Server{
+		Addr:    addr,
 		Handler: router,
 	}
+	prs.addr = addr
+	prs.server = server
+	prs.listener = listener
+	prs.active = active
+	prs.listenAddr = listener.Addr().String()
+	prs.startedAt = time.Now()
+	prs.running.Store(true)
+	close(prs.ready)
 
-	fmt.Printf("provider relay server listening on %s\n", prs.addr)
+	fmt.Printf("provider relay server listening on %s\n", listener.Addr().String())
 
 	go func() {
-		if err := prs.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			fmt.Printf("provider relay server error: %v\n", err)
 		}
+		prs.markStopped(server)
 	}()
 	return nil
 }
 
+// markStopped 服务退出后重置运行状态（仅当退出的是当前 server 时生效，避免重启后被旧 goroutine 覆盖）
+func (prs *ProviderRelayService) markStopped(server *http.Server) {
+	prs.stateMu.Lock()
+	defer prs.stateMu.Unlock()
+
+	if prs.server != server || !prs.running.Load() {
+		return
+	}
+	prs.running.Store(false)
+	prs.ready = make(chan struct{})
+}
+
+// IsRunning 返回 relay 是否已成功绑定端口并正在提供服务
+func (prs *ProviderRelayService) IsRunning() bool {
+	return prs.running.Load()
+}
+
+// WaitUntilReady 等待 relay 就绪，超时返回错误
+func (prs *ProviderRelayService) WaitUntilReady(timeout time.Duration) error {
+	if prs.running.Load() {
+		return nil
+	}
+
+	prs.stateMu.Lock()
+	ready := prs.ready
+	prs.stateMu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("provider relay 在 %s 内未就绪", timeout)
+	}
+}
+
 // validateConfig 验证所有 provider 的配置
 // 返回警告列表（非阻塞性错误）
 func (prs *ProviderRelayService) validateConfig() []string {
@@ -127,6 +225,10 @@ func (prs *ProviderRelayService) validateConfig() []string {
 				}
 			}
 
+			if p.InsecureSkipVerify {
+				warnings = append(warnings, fmt.Sprintf("[%s/%s] 已关闭 TLS 证书校验（InsecureSkipVerify），存在中间人攻击风险", kind, p.Name))
+			}
+
 			// 检查是否配置了模型白名单或映射
 			if (p.SupportedModels == nil || len(p.SupportedModels) == 0) &&
 				(p.ModelMapping == nil || len(p.ModelMapping) == 0) {
@@ -144,26 +246,48 @@ func (prs *ProviderRelayService) validateConfig() []string {
 	return warnings
 }
 
+// Stop 停止 relay：不再接受新连接，最多等待 GetRelayDrainSeconds 秒让进行中的请求完成，超时后强制关闭
 func (prs *ProviderRelayService) Stop() error {
-	if prs.server == nil {
+	prs.stateMu.Lock()
+	server := prs.server
+	listener := prs.listener
+	active := prs.active
+	prs.stateMu.Unlock()
+
+	if server == nil {
 		return nil
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	return prs.server.Shutdown(ctx)
+	err := prs.drainServer(server, active)
+	// Serve 尚未开始时 Shutdown 不会关闭 listener，这里主动关闭，确保返回后端口已释放（重启时可立即重新绑定）
+	_ = listener.Close()
+	prs.markStopped(server)
+	return err
 }
 
 func (prs *ProviderRelayService) Addr() string {
+	prs.stateMu.Lock()
+	defer prs.stateMu.Unlock()
 	return prs.addr
 }
 
 func (prs *ProviderRelayService) registerRoutes(router gin.IRouter) {
 	router.POST("/v1/messages", prs.proxyHandler("claude", "/v1/messages"))
+	router.POST("/v1/messages/count_tokens", prs.proxyHandler("claude", "/v1/messages/count_tokens"))
 	router.POST("/responses", prs.proxyHandler("codex", "/responses"))
 
+	// OpenAI Chat Completions 格式，复用 codex 供应商（APIURL 通常已包含 /v1）
+	router.POST("/chat/completions", prs.proxyHandler("codex", chatCompletionsEndpoint))
+	router.POST("/v1/chat/completions", prs.proxyHandler("codex", chatCompletionsEndpoint))
+
 	// Gemini API 端点（使用专门的路径前缀避免与 Claude 冲突）
 	router.POST("/gemini/v1beta/*any", prs.geminiProxyHandler("/v1beta"))
 	router.POST("/gemini/v1/*any", prs.geminiProxyHandler("/v1"))
+
+	// 健康检查：无需鉴权，进程存活即返回 200
+	router.GET("/health", prs.healthHandler)
+
+	// Prometheus 格式的请求统计，聚合自 request_log
+	router.GET("/metrics", prs.metricsHandler)
 }
 
 func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.HandlerFunc {
@@ -172,115 +296,218 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 		if c.Request.Body != nil {
 			data, err := io.ReadAll(c.Request.Body)
 			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+				writeRelayError(c, kind, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request body", nil)
 				return
 			}
 			bodyBytes = data
 			c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 		}
 
-		isStream := gjson.GetBytes(bodyBytes, "stream").Bool()
-		requestedModel := gjson.GetBytes(bodyBytes, "model").String()
-
-		// 如果未指定模型，记录警告但不拦截
-		if requestedModel == "" {
-			fmt.Printf("[WARN] 请求未指定模型名，无法执行模型智能降级\n")
+		// JSON 端点必须是合法 JSON，否则 stream/model 解析为空，会绕过模型过滤并把错误请求转发给上游
+		if requiresJSONBody(kind, endpoint) && !gjson.ValidBytes(bodyBytes) {
+			fmt.Printf("[WARN] %s %s 请求体不是合法 JSON，已拒绝\n", kind, endpoint)
+			writeRelayError(c, kind, http.StatusBadRequest, ErrCodeInvalidRequest, "请求体不是合法的 JSON", nil)
+			return
 		}
 
-		providers, err := prs.providerService.LoadProviders(kind)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load providers"})
+		// 录制模式（默认关闭）：保存脱敏后的请求，供 ReplaySession 回放
+		prs.recordRequest(c, kind, bodyBytes)
+
+		// 可选的请求合并：相同的并发幂等请求共享一次上游调用
+		if c.GetHeader(forceProviderHeader) == "" && c.GetHeader(projectRootHeader) == "" && prs.shouldCoalesce(kind, endpoint, bodyBytes) {
+			key := coalesceKey(kind, endpoint, c.Request.URL.RawQuery, clientFromRequest(c), c.Request.Header, bodyBytes)
+			result, shared := prs.coalescer.Do(kind, key, func() *coalescedResponse {
+				original, request := c.Writer, c.Request
+				recorder := newRecordingResponseWriter(original)
+				c.Writer = recorder
+				// 共享的上游调用不跟随发起者的连接：发起者断开时其他合并的请求仍在等待结果（CancelRequest 仍可取消）
+				c.Request = request.WithContext(context.WithoutCancel(request.Context()))
+				defer func() { c.Writer, c.Request = original, request }()
+				prs.serveProxy(c, kind, endpoint, bodyBytes)
+				return recorder.result()
+			})
+			if shared && result.status == statusRequestCanceled && c.Request.Context().Err() == nil {
+				// 共享调用被 CancelRequest 取消，但本请求仍在等待：单独重新执行
+				fmt.Printf("[INFO] 合并的请求已被取消，单独重试: %s %s\n", kind, endpoint)
+				prs.serveProxy(c, kind, endpoint, bodyBytes)
+				return
+			}
+			if shared {
+				fmt.Printf("[INFO] 请求已合并: %s %s\n", kind, endpoint)
+			}
+			result.writeTo(c.Writer)
 			return
 		}
 
-		active := make([]Provider, 0, len(providers))
-		skippedCount := 0
-		for _, provider := range providers {
-			// 基础过滤：enabled、URL、APIKey
-			if !provider.Enabled || provider.APIURL == "" || provider.APIKey == "" {
-				continue
-			}
+		prs.serveProxy(c, kind, endpoint, bodyBytes)
+	}
+}
 
-			// 配置验证：失败则自动跳过
-			if errs := provider.ValidateConfiguration(); len(errs) > 0 {
-				fmt.Printf("[WARN] Provider %s 配置验证失败，已自动跳过: %v\n", provider.Name, errs)
-				skippedCount++
-				continue
-			}
+// jsonBodyEndpoints 要求请求体为 JSON 的端点，未列出的端点按原样透传
+var jsonBodyEndpoints = map[string]bool{
+	"claude:/v1/messages":              true,
+	"claude:/v1/messages/count_tokens": true,
+	"codex:/responses":                 true,
+	"codex:" + chatCompletionsEndpoint: true,
+}
 
-			// 核心过滤：只保留支持请求模型的 provider
-			if requestedModel != "" && !provider.IsModelSupported(requestedModel) {
-				fmt.Printf("[INFO] Provider %s 不支持模型 %s，已跳过\n", provider.Name, requestedModel)
-				skippedCount++
-				continue
-			}
+// chatCompletionsEndpoint OpenAI Chat Completions 端点（相对于 codex 供应商的 APIURL）
+const chatCompletionsEndpoint = "/chat/completions"
 
-			// 黑名单检查：跳过已拉黑的 provider
-			if isBlacklisted, until := prs.blacklistService.IsBlacklisted(kind, provider.Name); isBlacklisted {
-				fmt.Printf("⛔ Provider %s 已拉黑，过期时间: %v\n", provider.Name, until.Format("15:04:05"))
-				skippedCount++
-				continue
-			}
+// requiresJSONBody 判断端点是否要求 JSON 请求体
+func requiresJSONBody(kind string, endpoint string) bool {
+	return jsonBodyEndpoints[kind+":"+endpoint]
+}
 
-			active = append(active, provider)
-		}
+// shouldCoalesce 判断请求是否走合并：需开启开关、端点在白名单内且为非流式请求
+func (prs *ProviderRelayService) shouldCoalesce(kind string, endpoint string, bodyBytes []byte) bool {
+	if prs.settingsService == nil || !isCoalescableEndpoint(kind, endpoint) {
+		return false
+	}
+	if gjson.GetBytes(bodyBytes, "stream").Bool() {
+		return false
+	}
+	return prs.settingsService.IsRequestCoalescingEnabled()
+}
 
-		if len(active) == 0 {
-			if requestedModel != "" {
-				c.JSON(http.StatusNotFound, gin.H{
-					"error": fmt.Sprintf("没有可用的 provider 支持模型 '%s'（已跳过 %d 个不兼容的 provider）", requestedModel, skippedCount),
-				})
-			} else {
-				c.JSON(http.StatusNotFound, gin.H{"error": "no providers available"})
+// serveProxy 选择 provider 并转发请求
+func (prs *ProviderRelayService) serveProxy(c *gin.Context, kind string, endpoint string, bodyBytes []byte) {
+	isStream := gjson.GetBytes(bodyBytes, "stream").Bool()
+	requestedModel := gjson.GetBytes(bodyBytes, "model").String()
+
+	// 如果未指定模型，记录警告但不拦截
+	if requestedModel == "" {
+		fmt.Printf("[WARN] 请求未指定模型名，无法执行模型智能降级\n")
+	}
+
+	// 全局熔断：所有上游持续失败时直接拒绝，不再请求上游
+	breaker := prs.circuitBreaker()
+	allowed, probe, retryAfter := breaker.allow(kind)
+	if !allowed {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		writeRelayError(c, kind, http.StatusServiceUnavailable, ErrCodeRelayPaused,
+			fmt.Sprintf("%s 所有上游持续失败，已暂停转发，%d 秒后重试", kind, seconds),
+			gin.H{"retry_after": seconds})
+		return
+	}
+	if probe {
+		defer breaker.releaseProbe(kind)
+	}
+
+	providers, err := prs.providerService.LoadProviders(kind)
+	if err != nil {
+		writeRelayError(c, kind, http.StatusInternalServerError, ErrCodeInternal, "failed to load providers", nil)
+		return
+	}
+
+	// 估算输入 token 数，用于按 provider 的输入 token 范围过滤
+	inputTokens := prs.estimateInputTokens(bodyBytes)
+
+	var firstProvider Provider
+	var firstLevel int
+	// candidates 为空表示强制指定了 provider，失败时不切换到其他 provider
+	var candidates []Provider
+	if forcedName := strings.TrimSpace(c.GetHeader(forceProviderHeader)); forcedName != "" {
+		provider, status, reason := prs.resolveForcedProvider(c, kind, forcedName, requestedModel, inputTokens, providers)
+		if reason != "" {
+			fmt.Printf("[WARN] 强制指定 Provider %s 未生效: %s\n", forcedName, reason)
+			code := ErrCodeProviderUnavailable
+			if status == http.StatusForbidden {
+				code = ErrCodeForbidden
 			}
+			writeRelayError(c, kind, status, code, reason, gin.H{"provider": forcedName})
 			return
 		}
-
-		fmt.Printf("[INFO] 找到 %d 个可用的 provider（已过滤 %d 个）：", len(active), skippedCount)
-		for _, p := range active {
-			fmt.Printf("%s ", p.Name)
+		firstProvider = provider
+		firstLevel = normalizedLevel(provider.Level)
+		fmt.Printf("[INFO] 强制使用 Provider: %s (Level %d)，跳过等级选择\n", firstProvider.Name, firstLevel)
+	} else {
+		// 项目级路由：X-Project-Root 指向的 .bmai.json 可限定候选 provider
+		candidates, err = prs.projectProviders(c, kind, providers)
+		if err != nil {
+			fmt.Printf("[WARN] 项目路由配置无效: %v\n", err)
+			writeRelayError(c, kind, http.StatusBadRequest, ErrCodeInvalidProjectConfig, err.Error(), nil)
+			return
 		}
-		fmt.Println()
 
-		// 按 Level 分组
-		levelGroups := make(map[int][]Provider)
-		for _, provider := range active {
-			level := provider.Level
-			if level <= 0 {
-				level = 1 // 未配置或零值时默认为 Level 1
-			}
-			levelGroups[level] = append(levelGroups[level], provider)
+		var selectedModel string
+		var ok bool
+		firstProvider, firstLevel, selectedModel, ok = prs.selectProvider(c, kind, requestedModel, inputTokens, candidates)
+		if !ok {
+			return
 		}
-
-		// 获取所有 level 并升序排序
-		levels := make([]int, 0, len(levelGroups))
-		for level := range levelGroups {
-			levels = append(levels, level)
+		if selectedModel != requestedModel {
+			// 降级模型：改写请求体，后续的模型映射基于降级后的模型
+			modifiedBody, err := ReplaceModelInRequestBody(bodyBytes, selectedModel)
+			if err != nil {
+				fmt.Printf("[ERROR] 替换模型名失败: %v\n", err)
+				writeRelayError(c, kind, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("模型降级失败: %v", err), nil)
+				return
+			}
+			fmt.Printf("[INFO] 请求模型已降级: %s -> %s (Provider %s)\n", requestedModel, selectedModel, firstProvider.Name)
+			bodyBytes = modifiedBody
+			requestedModel = selectedModel
 		}
-		sort.Ints(levels)
+	}
 
-		// 取第一个 Level 的第一个 provider（最高优先级）
-		firstLevel := levels[0]
-		firstProvider := levelGroups[firstLevel][0]
+	query := flattenQuery(c.Request.URL.Query())
+	clientHeaders := cloneHeaders(c.Request.Header)
+	delete(clientHeaders, forceProviderHeader)
+	delete(clientHeaders, projectRootHeader)
+	delete(clientHeaders, clientIDHeader)
+	delete(clientHeaders, sessionIDHeader)
 
-		fmt.Printf("[INFO] 选择 Provider: %s (Level %d) | 可用备选: %d 个 provider 分布在 %d 个 Level\n",
-			firstProvider.Name, firstLevel, len(active), len(levels))
+	// 登记为进行中的请求，CancelRequest 或客户端断开时取消上游调用
+	ctx, requestID, done := prs.trackRequest(c.Request.Context(), InflightRequest{
+		Platform: kind,
+		Provider: firstProvider.Name,
+		Model:    firstProvider.GetEffectiveModelForClient(requestedModel, clientFromRequest(c)),
+		IsStream: isStream,
+	})
+	defer done()
+	c.Request = c.Request.WithContext(ctx)
+
+	// 还没有向客户端写出任何字节时失败（连接失败、非 2xx、首个事件前断开）可以安全地换其他 provider 重试；
+	// 已写出部分响应后失败则不再重试，错误事件已追加在响应末尾
+	provider, level := firstProvider, firstLevel
+	tried := map[string]bool{}
+	baseHeader := c.Writer.Header().Clone()
+
+	// 影子流量：按采样比例把非流式请求异步复制给影子 provider，响应只记录不返回给客户端（以最终结果对比）
+	mirror := func(primary string, success bool, duration time.Duration) {
+		if isStream || ctx.Err() != nil {
+			return
+		}
+		prs.mirrorToShadow(shadowRequest{
+			kind:            kind,
+			endpoint:        endpoint,
+			query:           query,
+			headers:         clientHeaders,
+			body:            bodyBytes,
+			model:           requestedModel,
+			client:          clientFromRequest(c),
+			primary:         primary,
+			primarySuccess:  success,
+			primaryDuration: duration,
+		})
+	}
 
-		query := flattenQuery(c.Request.URL.Query())
-		clientHeaders := cloneHeaders(c.Request.Header)
+	for attempt := 1; ; attempt++ {
+		tried[provider.Name] = true
 
-		// 获取实际应该使用的模型名
-		effectiveModel := firstProvider.GetEffectiveModel(requestedModel)
+		// 获取实际应该使用的模型名（客户端专属映射优先）
+		effectiveModel := provider.GetEffectiveModelForClient(requestedModel, clientFromRequest(c))
 
 		// 如果需要映射，修改请求体
 		currentBodyBytes := bodyBytes
 		if effectiveModel != requestedModel && requestedModel != "" {
-			fmt.Printf("[INFO] Provider %s 映射模型: %s -> %s\n", firstProvider.Name, requestedModel, effectiveModel)
+			fmt.Printf("[INFO] Provider %s 映射模型: %s -> %s\n", provider.Name, requestedModel, effectiveModel)
 
 			modifiedBody, err := ReplaceModelInRequestBody(bodyBytes, effectiveModel)
 			if err != nil {
 				fmt.Printf("[ERROR] 替换模型名失败: %v\n", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("模型映射失败: %v", err)})
+				writeRelayError(c, kind, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("模型映射失败: %v", err), nil)
 				return
 			}
 			currentBodyBytes = modifiedBody
@@ -288,42 +515,339 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 
 		// 尝试发送请求
 		startTime := time.Now()
-		ok, err := prs.forwardRequest(c, kind, firstProvider, endpoint, query, clientHeaders, currentBodyBytes, isStream, effectiveModel)
+		ok, err := prs.forwardRequest(c, kind, provider, endpoint, query, clientHeaders, currentBodyBytes, isStream, effectiveModel)
 		duration := time.Since(startTime)
 
 		if ok {
-			fmt.Printf("[INFO] ✓ 成功: %s (Level %d) | 耗时: %.2fs\n", firstProvider.Name, firstLevel, duration.Seconds())
+			mirror(provider.Name, true, duration)
+			fmt.Printf("[INFO] ✓ 成功: %s (Level %d) | 耗时: %.2fs\n", provider.Name, level, duration.Seconds())
+
+			breaker.recordSuccess(kind)
+			prs.providerCircuits().RecordSuccess(kind, provider.Name)
 
 			// 成功：清零连续失败计数
-			if err := prs.blacklistService.RecordSuccess(kind, firstProvider.Name); err != nil {
+			if err := prs.blacklistService.RecordSuccess(kind, provider.Name); err != nil {
 				fmt.Printf("[WARN] 清零失败计数失败: %v\n", err)
 			}
 
 			return
 		}
 
-		// 失败：记录到黑名单并返回错误
+		// 被取消的请求不是 provider 的问题，不计入失败次数
+		if ctx.Err() != nil {
+			fmt.Printf("[INFO] 请求 %s 已取消: %s (Level %d) | 耗时: %.2fs\n", requestID, provider.Name, level, duration.Seconds())
+			writeRelayError(c, kind, statusRequestCanceled, ErrCodeRequestCanceled, "请求已取消", gin.H{"provider": provider.Name})
+			return
+		}
+
 		errorMsg := "未知错误"
 		if err != nil {
 			errorMsg = err.Error()
 		}
-		fmt.Printf("[ERROR] ✗ 失败: %s (Level %d) | 错误: %s | 耗时: %.2fs\n",
-			firstProvider.Name, firstLevel, errorMsg, duration.Seconds())
+		busy := errors.Is(err, errProviderBusy)
+		var rateLimited *rateLimitedError
+		if busy {
+			// 并发已满：暂时不可用，不计入失败次数
+			fmt.Printf("[WARN] Provider %s (Level %d) %s\n", provider.Name, level, errorMsg)
+		} else if errors.As(err, &rateLimited) {
+			// 限流：provider 可用，只按 Retry-After 冷却，不计入失败次数和熔断
+			fmt.Printf("[WARN] Provider %s (Level %d) %s\n", provider.Name, level, errorMsg)
+			if err := prs.blacklistService.RecordRateLimited(kind, provider.Name, rateLimited.retryAfter); err != nil {
+				fmt.Printf("[ERROR] 记录限流状态失败: %v\n", err)
+			}
+		} else {
+			// 失败：记录到黑名单并返回错误
+			fmt.Printf("[ERROR] ✗ 失败: %s (Level %d) | 错误: %s | 耗时: %.2fs\n",
+				provider.Name, level, errorMsg, duration.Seconds())
+
+			breaker.recordFailure(kind)
+			if provider.NeverBlacklist {
+				// 从不拉黑：不计入短时熔断和黑名单，失败只写入请求日志
+				fmt.Printf("[INFO] Provider %s 设置了从不拉黑，不计入熔断和黑名单\n", provider.Name)
+			} else {
+				prs.providerCircuits().RecordFailure(kind, provider.Name)
 
-		// 记录失败到黑名单系统
-		if err := prs.blacklistService.RecordFailure(kind, firstProvider.Name); err != nil {
-			fmt.Printf("[ERROR] 记录失败到黑名单失败: %v\n", err)
+				// 记录失败到黑名单系统
+				if err := prs.blacklistService.RecordFailure(kind, provider.Name); err != nil {
+					fmt.Printf("[ERROR] 记录失败到黑名单失败: %v\n", err)
+				}
+			}
 		}
 
-		// 直接返回 502，不尝试其他 provider
-		c.JSON(http.StatusBadGateway, gin.H{
-			"error":    fmt.Sprintf("Provider %s 请求失败: %s", firstProvider.Name, errorMsg),
-			"provider": firstProvider.Name,
-			"duration": fmt.Sprintf("%.2fs", duration.Seconds()),
-		})
+		// 已写出部分响应：错误事件已追加在响应末尾，不能再写入错误响应，直接结束让客户端感知中断
+		if !retrySafe(c, err) {
+			mirror(provider.Name, false, duration)
+			return
+		}
+
+		if next, nextLevel, found := prs.nextFailoverProvider(kind, requestedModel, inputTokens, candidates, tried, attempt); found {
+			fmt.Printf("[INFO] 尚未向客户端写出响应，切换到 Provider %s (Level %d) 重试\n", next.Name, nextLevel)
+			resetResponseHeader(c, baseHeader)
+			provider, level = next, nextLevel
+			continue
+		}
+
+		mirror(provider.Name, false, duration)
+		if busy {
+			writeRelayError(c, kind, http.StatusServiceUnavailable, ErrCodeProviderBusy,
+				fmt.Sprintf("Provider %s %s", provider.Name, errorMsg), gin.H{"provider": provider.Name})
+			return
+		}
+		writeRelayError(c, kind, http.StatusBadGateway, ErrCodeUpstreamError,
+			fmt.Sprintf("Provider %s 请求失败: %s", provider.Name, errorMsg),
+			gin.H{
+				"provider": provider.Name,
+				"duration": fmt.Sprintf("%.2fs", duration.Seconds()),
+			})
+		return
 	}
 }
 
+// selectProvider 过滤不可用的 provider，并按 Level 选出最高优先级的 provider
+// 没有 provider 支持请求的模型且配置了降级模型时，改用降级模型重新选择，并返回实际使用的模型名
+// 没有可用 provider 时直接写入错误响应并返回 false
+func (prs *ProviderRelayService) selectProvider(c *gin.Context, kind string, requestedModel string, inputTokens int, providers []Provider) (Provider, int, string, bool) {
+	provider, level, skips, ok := prs.pickProvider(kind, requestedModel, inputTokens, providers)
+	if ok {
+		return provider, level, requestedModel, true
+	}
+
+	if fallback := prs.fallbackModel(kind); requestedModel != "" && fallback != "" && fallback != requestedModel {
+		fmt.Printf("[WARN] 没有可用的 provider 支持模型 %s，降级为 %s 重新选择\n", requestedModel, fallback)
+		if provider, level, _, ok := prs.pickProvider(kind, fallback, inputTokens, providers); ok {
+			return provider, level, fallback, true
+		}
+		fmt.Printf("[WARN] 降级模型 %s 同样没有可用的 provider\n", fallback)
+	}
+
+	code := skips.errorCode()
+	if requestedModel != "" {
+		writeRelayError(c, kind, http.StatusNotFound, code,
+			fmt.Sprintf("没有可用的 provider 支持模型 '%s'（%s）", requestedModel, skips.describe()), nil)
+	} else {
+		writeRelayError(c, kind, http.StatusNotFound, code, "no providers available", nil)
+	}
+	return Provider{}, 0, requestedModel, false
+}
+
+// fallbackModel 获取该平台配置的降级模型（未配置时为空）
+func (prs *ProviderRelayService) fallbackModel(kind string) string {
+	if prs.settingsService == nil {
+		return ""
+	}
+	model, err := prs.settingsService.GetFallbackModel(kind)
+	if err != nil {
+		fmt.Printf("[WARN] 读取降级模型失败: %v\n", err)
+		return ""
+	}
+	return model
+}
+
+// pickProvider 过滤不可用的 provider 并选出最高优先级的 provider，返回跳过的 provider 数量
+func (prs *ProviderRelayService) pickProvider(kind string, requestedModel string, inputTokens int, providers []Provider) (Provider, int, providerSkips, bool) {
+	active := make([]Provider, 0, len(providers))
+	var skips providerSkips
+	for _, provider := range providers {
+		// 基础过滤：enabled、URL、APIKey
+		if !provider.Enabled || provider.APIURL == "" || provider.APIKey == "" {
+			continue
+		}
+
+		// 配置验证：失败则自动跳过
+		if errs := provider.ValidateConfiguration(); len(errs) > 0 {
+			fmt.Printf("[WARN] Provider %s 配置验证失败，已自动跳过: %v\n", provider.Name, errs)
+			skips.invalid++
+			continue
+		}
+
+		// 核心过滤：只保留支持请求模型的 provider
+		if requestedModel != "" && !provider.IsModelSupported(requestedModel) {
+			fmt.Printf("[INFO] Provider %s 不支持模型 %s，已跳过\n", provider.Name, requestedModel)
+			skips.model++
+			continue
+		}
+
+		// 输入 token 范围过滤：估算值超出 provider 配置的范围时跳过
+		if !provider.AcceptsInputTokens(inputTokens) {
+			fmt.Printf("[INFO] Provider %s 输入 token 范围 [%d, %d]，本次请求约 %d tokens，已跳过\n",
+				provider.Name, provider.MinInputTokens, provider.MaxInputTokens, inputTokens)
+			skips.tokens++
+			continue
+		}
+
+		// 维护窗口：计划停机期间跳过，不计为失败
+		if window, ok := provider.ActiveMaintenance(prs.now()); ok {
+			fmt.Printf("[INFO] Provider %s %s，已跳过\n", provider.Name, formatMaintenance(window))
+			skips.unavailable++
+			continue
+		}
+
+		// 从不拉黑的 provider 不受熔断和黑名单影响，始终保留
+		if provider.NeverBlacklist {
+			active = append(active, provider)
+			continue
+		}
+
+		// 短时熔断：短时间内连续失败的 provider 暂时跳过（只在内存中生效）
+		if open, until := prs.providerCircuits().IsOpen(kind, provider.Name); open {
+			fmt.Printf("[INFO] Provider %s 熔断中，恢复时间: %v，已跳过\n", provider.Name, until.Format("15:04:05"))
+			skips.unavailable++
+			continue
+		}
+
+		// 黑名单检查：跳过已拉黑的 provider
+		if isBlacklisted, until := prs.blacklistService.IsBlacklisted(kind, provider.Name); isBlacklisted {
+			fmt.Printf("⛔ Provider %s 已拉黑，过期时间: %v\n", provider.Name, until.Format("15:04:05"))
+			skips.unavailable++
+			continue
+		}
+
+		active = append(active, provider)
+	}
+
+	if len(active) == 0 {
+		return Provider{}, 0, skips, false
+	}
+
+	fmt.Printf("[INFO] 找到 %d 个可用的 provider（已过滤 %d 个）：", len(active), skips.total())
+	for _, p := range active {
+		fmt.Printf("%s ", p.Name)
+	}
+	fmt.Println()
+
+	// 观察期 provider 只分配少量流量
+	active = prs.applyProbation(kind, active)
+
+	// 按 Level 分组
+	levelGroups := make(map[int][]Provider)
+	for _, provider := range active {
+		level := normalizedLevel(provider.Level)
+		levelGroups[level] = append(levelGroups[level], provider)
+	}
+
+	// 获取所有 level 并升序排序
+	levels := make([]int, 0, len(levelGroups))
+	for level := range levelGroups {
+		levels = append(levels, level)
+	}
+	sort.Ints(levels)
+
+	// 取第一个 Level（最高优先级），同一 Level 内的多个 provider 按权重选择（权重相同时轮流使用）
+	order := make(map[string]int, len(providers))
+	for i, provider := range providers {
+		if _, ok := order[provider.Name]; !ok {
+			order[provider.Name] = i
+		}
+	}
+	firstLevel := levels[0]
+	firstProvider := prs.selectFromLevel(kind, firstLevel, levelGroups[firstLevel], order)
+
+	fmt.Printf("[INFO] 选择 Provider: %s (Level %d) | 可用备选: %d 个 provider 分布在 %d 个 Level\n",
+		firstProvider.Name, firstLevel, len(active), len(levels))
+
+	return firstProvider, firstLevel, skips, true
+}
+
+// forceProviderHeader 强制使用指定 provider 的请求头（用于 A/B 测试）
+//
+// 安全说明：relay 本身没有鉴权，该请求头会绕过等级选择，
+// 因此只接受来自本机回环地址的请求，其他来源一律拒绝（403）。
+const forceProviderHeader = "X-Force-Provider"
+
+// normalizedLevel 未配置或零值时默认为 Level 1
+func normalizedLevel(level int) int {
+	if level <= 0 {
+		return 1
+	}
+	return level
+}
+
+// resolveForcedProvider 校验强制指定的 provider 是否可用
+// 不可用时返回对应的 HTTP 状态码和原因，不会静默回退到其他 provider
+func (prs *ProviderRelayService) resolveForcedProvider(c *gin.Context, kind string, name string, requestedModel string, inputTokens int, providers []Provider) (Provider, int, string) {
+	if !isLoopbackRequest(c.Request) {
+		return Provider{}, http.StatusForbidden, fmt.Sprintf("%s 仅允许本机请求使用", forceProviderHeader)
+	}
+
+	for _, provider := range providers {
+		if provider.Name != name {
+			continue
+		}
+		if !provider.Enabled || provider.APIURL == "" || provider.APIKey == "" {
+			return Provider{}, http.StatusConflict, fmt.Sprintf("强制指定的 provider '%s' 未启用或缺少 API 配置", name)
+		}
+		if errs := provider.ValidateConfiguration(); len(errs) > 0 {
+			return Provider{}, http.StatusConflict, fmt.Sprintf("强制指定的 provider '%s' 配置验证失败: %v", name, errs)
+		}
+		if requestedModel != "" && !provider.IsModelSupported(requestedModel) {
+			return Provider{}, http.StatusConflict, fmt.Sprintf("强制指定的 provider '%s' 不支持模型 '%s'", name, requestedModel)
+		}
+		if !provider.AcceptsInputTokens(inputTokens) {
+			return Provider{}, http.StatusConflict, fmt.Sprintf("强制指定的 provider '%s' 输入 token 范围 [%d, %d] 不包含本次请求（约 %d tokens）",
+				name, provider.MinInputTokens, provider.MaxInputTokens, inputTokens)
+		}
+		if window, ok := provider.ActiveMaintenance(prs.now()); ok {
+			return Provider{}, http.StatusConflict, fmt.Sprintf("强制指定的 provider '%s' %s", name, formatMaintenance(window))
+		}
+		if isBlacklisted, until := prs.blacklistService.IsBlacklisted(kind, provider.Name); isBlacklisted {
+			return Provider{}, http.StatusConflict, fmt.Sprintf("强制指定的 provider '%s' 已拉黑，过期时间: %s", name, until.Format("15:04:05"))
+		}
+		return provider, 0, ""
+	}
+
+	return Provider{}, http.StatusConflict, fmt.Sprintf("强制指定的 provider '%s' 不存在", name)
+}
+
+// isLoopbackRequest 判断请求是否来自本机回环地址
+func isLoopbackRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// applyProbation 对处于观察期的 provider 按配置的流量百分比进行抽样
+func (prs *ProviderRelayService) applyProbation(kind string, active []Provider) []Provider {
+	if prs.settingsService == nil {
+		return active
+	}
+	levelConfig, err := prs.settingsService.GetBlacklistLevelConfig()
+	if err != nil || levelConfig.ProbationSuccessThreshold <= 0 {
+		return active
+	}
+
+	probation := make(map[string]bool)
+	for _, provider := range active {
+		if prs.blacklistService.IsInProbation(kind, provider.Name) {
+			probation[provider.Name] = true
+		}
+	}
+	if len(probation) == 0 {
+		return active
+	}
+
+	return filterProbationProviders(active, probation, levelConfig.ProbationTrafficPercent, rand.Intn)
+}
+
+// filterProbationProviders 保留所有健康 provider，观察期 provider 仅在抽中（roll(100) < percent）时保留
+// 如果过滤后没有可用 provider，则退回原列表，避免观察期导致请求无处可去
+func filterProbationProviders(active []Provider, probation map[string]bool, percent int, roll func(n int) int) []Provider {
+	filtered := make([]Provider, 0, len(active))
+	for _, provider := range active {
+		if probation[provider.Name] && roll(100) >= percent {
+			fmt.Printf("[INFO] Provider %s 处于观察期，本次请求跳过\n", provider.Name)
+			continue
+		}
+		filtered = append(filtered, provider)
+	}
+	if len(filtered) == 0 {
+		return active
+	}
+	return filtered
+}
+
 func (prs *ProviderRelayService) forwardRequest(
 	c *gin.Context,
 	kind string,
@@ -334,50 +858,119 @@ func (prs *ProviderRelayService) forwardRequest(
 	bodyBytes []byte,
 	isStream bool,
 	model string,
-) (bool, error) {
+) (success bool, forwardErr error) {
+	// 并发上限：已满时等待空闲槽位，超时视为暂时不可用（不写请求日志，由调用方切换 provider）
+	release, err := prs.concurrency.acquire(c.Request.Context(), kind, provider.Name, provider.MaxConcurrent, provider.concurrencyWait())
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
 	targetURL := joinURL(provider.APIURL, endpoint)
+	if len(provider.BodyOverrides) > 0 {
+		if modified, err := applyBodyOverrides(bodyBytes, provider.BodyOverrides); err != nil {
+			fmt.Printf("[WARN] Provider %s 请求体改写失败，按原请求体转发: %v\n", provider.Name, err)
+		} else {
+			bodyBytes = modified
+		}
+	}
 	headers := cloneMap(clientHeaders)
-	headers["Authorization"] = fmt.Sprintf("Bearer %s", provider.APIKey)
+	applyGlobalHeaders(headers, loadGlobalHeaders(prs.settingsService))
+	applyProviderHeaders(headers, provider)
+	applyProviderAuth(headers, provider)
 	if _, ok := headers["Accept"]; !ok {
 		headers["Accept"] = "application/json"
 	}
 
 	requestLog := &ReqeustLog{
-		Platform: kind,
-		Provider: provider.Name,
-		Model:    model,
-		IsStream: isStream,
+		Platform:  kind,
+		Provider:  provider.Name,
+		Model:     model,
+		SessionID: sessionFromRequest(c),
+		IsStream:  isStream,
+	}
+	// 关闭请求日志时既不写库，也不挂载 SSE 钩子解析 token
+	var hooks []xrequest.ResponseHook
+	if prs.requestLogEnabled() {
+		hooks = append(hooks, ReqeustLogHook(c, kind, endpoint, requestLog))
+		start := time.Now()
+		defer func() {
+			requestLog.DurationSec = time.Since(start).Seconds()
+			applyRequestCost(requestLog)
+			if _, err := xdb.New("request_log").Insert(xdb.Record{
+				"platform":            requestLog.Platform,
+				"model":               requestLog.Model,
+				"provider":            requestLog.Provider,
+				"http_code":           requestLog.HttpCode,
+				"input_tokens":        requestLog.InputTokens,
+				"output_tokens":       requestLog.OutputTokens,
+				"cache_create_tokens": requestLog.CacheCreateTokens,
+				"cache_read_tokens":   requestLog.CacheReadTokens,
+				"reasoning_tokens":    requestLog.ReasoningTokens,
+				"ephemeral_5m_tokens": requestLog.Ephemeral5mTokens,
+				"ephemeral_1h_tokens": requestLog.Ephemeral1hTokens,
+				"is_stream":           boolToInt(requestLog.IsStream),
+				"duration_sec":        requestLog.DurationSec,
+				"session_id":          requestLog.SessionID,
+				"partial":             boolToInt(requestLog.Partial),
+				"has_pricing":         boolToInt(requestLog.HasPricing),
+				"input_cost":          requestLog.InputCost,
+				"output_cost":         requestLog.OutputCost,
+				"cache_create_cost":   requestLog.CacheCreateCost,
+				"cache_read_cost":     requestLog.CacheReadCost,
+				"ephemeral_5m_cost":   requestLog.Ephemeral5mCost,
+				"ephemeral_1h_cost":   requestLog.Ephemeral1hCost,
+				"total_cost":          requestLog.TotalCost,
+			}); err != nil {
+				fmt.Printf("写入 request_log 失败: %v\n", err)
+			}
+		}()
+	}
+
+	// 开启了调试抓取的 provider：记录脱敏后的请求/响应，供 GetProviderExchanges 查看；
+	// 开启全局抓取时同时写入最近请求的环形缓冲区，供 LogService.GetCapturedExchanges 查看
+	var upstreamHeader http.Header
+	providerDebug, globalCapture := providerDebugEnabled(kind, provider.Name), prs.debugCaptureEnabled()
+	if providerDebug || globalCapture {
+		capture := newExchangeCapture(kind, provider, targetURL, headers, bodyBytes)
+		hooks = append(hooks, capture.hook)
+		defer func() {
+			exchange := capture.finish(requestLog.HttpCode, upstreamHeader, forwardErr)
+			if providerDebug {
+				prs.exchangeRecorder().add(exchange)
+			}
+			if globalCapture {
+				capturedExchanges.add(exchange)
+			}
+		}()
 	}
-	start := time.Now()
-	defer func() {
-		requestLog.DurationSec = time.Since(start).Seconds()
-		if _, err := xdb.New("request_log").Insert(xdb.Record{
-			"platform":            requestLog.Platform,
-			"model":               requestLog.Model,
-			"provider":            requestLog.Provider,
-			"http_code":           requestLog.HttpCode,
-			"input_tokens":        requestLog.InputTokens,
-			"output_tokens":       requestLog.OutputTokens,
-			"cache_create_tokens": requestLog.CacheCreateTokens,
-			"cache_read_tokens":   requestLog.CacheReadTokens,
-			"reasoning_tokens":    requestLog.ReasoningTokens,
-			"is_stream":           boolToInt(requestLog.IsStream),
-			"duration_sec":        requestLog.DurationSec,
-		}); err != nil {
-			fmt.Printf("写入 request_log 失败: %v\n", err)
-		}
-	}()
 
+	// 首字节超时：连接建立到收到响应头超时则计为失败，尽快触发故障转移；总超时 3 小时，适配大型项目分析
+	ctx, cancel, firstByte := withFirstByteTimeout(c.Request.Context(), provider.firstByteTimeout())
+	defer cancel()
 	req := xrequest.New().
+		WithContext(ctx).
 		SetHeaders(headers).
 		SetQueryParams(query).
 		SetRetry(1, 500*time.Millisecond).
-		SetTimeout(3 * time.Hour) // 3小时超时，适配大型项目分析
+		SetTimeout(3 * time.Hour)
 
 	reqBody := bytes.NewReader(bodyBytes)
 	req = req.SetBody(reqBody)
 
+	// 自定义 CA / 跳过证书校验时使用专用客户端，否则沿用 xrequest 默认客户端
+	client, err := upstreamHTTPClient(provider.Name, provider.InsecureSkipVerify, provider.upstreamOverride(), 0)
+	if err != nil {
+		return false, fmt.Errorf("构建上游 TLS 配置失败: %w", err)
+	}
+	if client != nil {
+		req = req.SetClient(client)
+	}
+
 	resp, err := req.Post(targetURL)
+	if firstByte.stop() {
+		return false, fmt.Errorf("上游 %s 内未返回响应", provider.firstByteTimeout())
+	}
 	if err != nil {
 		return false, err
 	}
@@ -389,27 +982,74 @@ func (prs *ProviderRelayService) forwardRequest(
 	// 先获取状态码，确保即使后续返回错误，也能记录正确的 HTTP 状态码
 	status := resp.StatusCode()
 	requestLog.HttpCode = status
+	if resp.RawResponse != nil {
+		upstreamHeader = resp.RawResponse.Header
+	}
+
+	// 限流：按 Retry-After 短时冷却，由调用方记录，不计入失败
+	if status == http.StatusTooManyRequests {
+		return false, &rateLimitedError{retryAfter: parseRetryAfter(upstreamHeader.Get("Retry-After"), time.Now())}
+	}
 
 	if resp.Error() != nil {
 		return false, resp.Error()
 	}
 
+	if resp.RawResponse != nil {
+		stripResponseHeaders(resp.RawResponse.Header, loadResponseHeaderDenylist(prs.settingsService))
+	}
+
 	// 特殊处理：某些 provider 的非流式请求可能返回状态码 0，但实际上是成功的
 	// 如果状态码为 0 且没有错误，当作成功处理
 	if status == 0 {
 		fmt.Printf("[WARN] Provider %s 返回状态码 0，但无错误，当作成功处理\n", provider.Name)
-		_, copyErr := resp.ToHttpResponseWriter(c.Writer, ReqeustLogHook(c, kind, requestLog))
-		return copyErr == nil, copyErr
+		return prs.copyUpstreamResponse(c, resp, hooks, kind, endpoint, provider.Name, isStream, requestLog)
 	}
 
 	if status >= http.StatusOK && status < http.StatusMultipleChoices {
-		_, copyErr := resp.ToHttpResponseWriter(c.Writer, ReqeustLogHook(c, kind, requestLog))
-		return copyErr == nil, copyErr
+		return prs.copyUpstreamResponse(c, resp, hooks, kind, endpoint, provider.Name, isStream, requestLog)
 	}
 
 	return false, fmt.Errorf("upstream status %d", status)
 }
 
+// copyUpstreamResponse 将成功的上游响应写给客户端
+// 上游在写出部分响应后中断时无法再重试，在流式响应末尾追加错误事件让客户端感知，并将请求日志标记为 partial
+func (prs *ProviderRelayService) copyUpstreamResponse(
+	c *gin.Context,
+	resp *xrequest.Response,
+	hooks []xrequest.ResponseHook,
+	kind string,
+	endpoint string,
+	providerName string,
+	isStream bool,
+	requestLog *ReqeustLog,
+) (bool, error) {
+	body := watchUpstreamBody(resp.RawResponse)
+	_, copyErr := resp.ToHttpResponseWriter(c.Writer, hooks...)
+	if copyErr == nil {
+		return true, nil
+	}
+	if body.err == nil || !c.Writer.Written() || c.Request.Context().Err() != nil {
+		return false, copyErr
+	}
+
+	requestLog.Partial = true
+	fmt.Printf("[WARN] Provider %s 响应中途中断（已写出 %d 字节）: %v\n", providerName, c.Writer.Size(), body.err)
+	if isStream || strings.Contains(c.Writer.Header().Get("Content-Type"), "text/event-stream") {
+		writeStreamErrorEvent(c, kind, endpoint, fmt.Sprintf("Provider %s 响应中途中断: %v", providerName, body.err), providerName)
+	}
+	return false, fmt.Errorf("%w: %v", errStreamInterrupted, body.err)
+}
+
+// requestLogEnabled 是否记录请求日志
+func (prs *ProviderRelayService) requestLogEnabled() bool {
+	if prs.settingsService == nil {
+		return true
+	}
+	return prs.settingsService.IsRequestLogEnabled()
+}
+
 func cloneHeaders(header http.Header) map[string]string {
 	cloned := make(map[string]string, len(header))
 	for key, values := range header {
@@ -486,8 +1126,20 @@ func ensureRequestLogTableWithDB(db *sql.DB) error {
 		cache_create_tokens INTEGER,
 		cache_read_tokens INTEGER,
 		reasoning_tokens INTEGER,
+		ephemeral_5m_tokens INTEGER DEFAULT 0,
+		ephemeral_1h_tokens INTEGER DEFAULT 0,
 		is_stream INTEGER DEFAULT 0,
 		duration_sec REAL DEFAULT 0,
+		session_id TEXT DEFAULT '',
+		partial INTEGER DEFAULT 0,
+		has_pricing INTEGER DEFAULT 0,
+		input_cost REAL DEFAULT 0,
+		output_cost REAL DEFAULT 0,
+		cache_create_cost REAL DEFAULT 0,
+		cache_read_cost REAL DEFAULT 0,
+		ephemeral_5m_cost REAL DEFAULT 0,
+		ephemeral_1h_cost REAL DEFAULT 0,
+		total_cost REAL DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	)`
 
@@ -504,32 +1156,64 @@ func ensureRequestLogTableWithDB(db *sql.DB) error {
 	if err := ensureRequestLogColumn(db, "duration_sec", "REAL DEFAULT 0"); err != nil {
 		return err
 	}
+	if err := ensureRequestLogColumn(db, "ephemeral_5m_tokens", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, "ephemeral_1h_tokens", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, "session_id", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, "partial", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, "has_pricing", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	for _, column := range []string{"input_cost", "output_cost", "cache_create_cost", "cache_read_cost", "ephemeral_5m_cost", "ephemeral_1h_cost", "total_cost"} {
+		if err := ensureRequestLogColumn(db, column, "REAL DEFAULT 0"); err != nil {
+			return err
+		}
+	}
 
-	return nil
+	// 按时间清理过期日志时使用
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_request_log_created_at ON request_log(created_at)"); err != nil {
+		return err
+	}
+
+	// 影子流量的对比记录单独存放，不计入用量统计
+	return ensureShadowLogTableWithDB(db)
 }
 
-func ReqeustLogHook(c *gin.Context, kind string, usage *ReqeustLog) func(data []byte) (bool, []byte) { // SSE 钩子：累计字节和解析 token 用量
-	return func(data []byte) (bool, []byte) {
-		payload := strings.TrimSpace(string(data))
+func ReqeustLogHook(c *gin.Context, kind string, endpoint string, usage *ReqeustLog) func(data []byte) (bool, []byte) { // SSE 钩子：累计字节和解析 token 用量
+	parserFn := ClaudeCodeParseTokenUsageFromResponse
+	if endpoint == chatCompletionsEndpoint {
+		// 流式响应仅在 stream_options.include_usage 时由最后一个 chunk 携带 usage
+		parserFn = ChatCompletionsParseTokenUsageFromResponse
+	} else if kind == "codex" {
+		parserFn = CodexParseTokenUsageFromResponse
+	}
+	lines := newSSELineParser(parserFn, usage)
 
-		parserFn := ClaudeCodeParseTokenUsageFromResponse
-		if kind == "codex" {
-			parserFn = CodexParseTokenUsageFromResponse
+	return func(data []byte) (bool, []byte) {
+		// Chat Completions 非流式响应为完整 JSON
+		if endpoint == chatCompletionsEndpoint && len(lines.pending) == 0 {
+			if payload := strings.TrimSpace(string(data)); payload != "" && payload[0] == '{' && gjson.Valid(payload) {
+				ChatCompletionsParseTokenUsageFromResponse(payload, usage)
+				return true, data
+			}
 		}
-		parseEventPayload(payload, parserFn, usage)
 
+		lines.Feed(data)
 		return true, data
 	}
 }
 
 func parseEventPayload(payload string, parser func(string, *ReqeustLog), usage *ReqeustLog) {
-	lines := strings.Split(payload, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "data:") {
-			parser(strings.TrimPrefix(line, "data: "), usage)
-		}
-	}
+	lines := newSSELineParser(parser, usage)
+	lines.Feed([]byte(payload))
+	lines.Flush()
 }
 
 type ReqeustLog struct {
@@ -543,8 +1227,12 @@ type ReqeustLog struct {
 	CacheCreateTokens int     `json:"cache_create_tokens"`
 	CacheReadTokens   int     `json:"cache_read_tokens"`
 	ReasoningTokens   int     `json:"reasoning_tokens"`
+	Ephemeral5mTokens int     `json:"ephemeral_5m_tokens"` // 缓存创建 tokens 中 5 分钟 TTL 的部分
+	Ephemeral1hTokens int     `json:"ephemeral_1h_tokens"` // 缓存创建 tokens 中 1 小时 TTL 的部分
 	IsStream          bool    `json:"is_stream"`
 	DurationSec       float64 `json:"duration_sec"`
+	SessionID         string  `json:"session_id"` // X-Session-Id 请求头，未携带时为空
+	Partial           bool    `json:"partial"`    // 上游返回 2xx 后响应中途中断，客户端只收到部分响应
 	CreatedAt         string  `json:"created_at"`
 	InputCost         float64 `json:"input_cost"`
 	OutputCost        float64 `json:"output_cost"`
@@ -562,6 +1250,8 @@ func ClaudeCodeParseTokenUsageFromResponse(data string, usage *ReqeustLog) {
 	usage.OutputTokens += int(gjson.Get(data, "message.usage.output_tokens").Int())
 	usage.CacheCreateTokens += int(gjson.Get(data, "message.usage.cache_creation_input_tokens").Int())
 	usage.CacheReadTokens += int(gjson.Get(data, "message.usage.cache_read_input_tokens").Int())
+	usage.Ephemeral5mTokens += int(gjson.Get(data, "message.usage.cache_creation.ephemeral_5m_input_tokens").Int())
+	usage.Ephemeral1hTokens += int(gjson.Get(data, "message.usage.cache_creation.ephemeral_1h_input_tokens").Int())
 
 	usage.InputTokens += int(gjson.Get(data, "usage.input_tokens").Int())
 	usage.OutputTokens += int(gjson.Get(data, "usage.output_tokens").Int())
@@ -576,6 +1266,59 @@ func CodexParseTokenUsageFromResponse(data string, usage *ReqeustLog) {
 	fmt.Println("data ---->", data, fmt.Sprintf("%v", usage))
 }
 
+// chat completions usage parser
+// usage 为整次请求的累计值（部分供应商会在每个 chunk 重复下发），因此直接覆盖而不是累加
+func ChatCompletionsParseTokenUsageFromResponse(data string, usage *ReqeustLog) {
+	result := gjson.Get(data, "usage")
+	if !result.IsObject() {
+		return
+	}
+	usage.InputTokens = int(result.Get("prompt_tokens").Int())
+	usage.OutputTokens = int(result.Get("completion_tokens").Int())
+	usage.CacheReadTokens = int(result.Get("prompt_tokens_details.cached_tokens").Int())
+	usage.ReasoningTokens = int(result.Get("completion_tokens_details.reasoning_tokens").Int())
+}
+
+// gemini usage parser
+// usageMetadata 为截至当前 chunk 的累计值，因此直接覆盖而不是累加，最后一个 chunk 的值为准
+// promptTokenCount 包含缓存命中的 token，拆分为输入和缓存读取；输出包含思考 token（与 Codex 的 reasoning_tokens 口径一致）
+func GeminiParseTokenUsageFromResponse(data string, usage *ReqeustLog) {
+	result := gjson.Get(data, "usageMetadata")
+	if !result.IsObject() {
+		return
+	}
+	cached := int(result.Get("cachedContentTokenCount").Int())
+	thoughts := int(result.Get("thoughtsTokenCount").Int())
+	usage.InputTokens = max(int(result.Get("promptTokenCount").Int())-cached, 0)
+	usage.OutputTokens = int(result.Get("candidatesTokenCount").Int()) + thoughts
+	usage.CacheReadTokens = cached
+	usage.ReasoningTokens = thoughts
+}
+
+// parseGeminiResponseUsage 解析 Gemini 非流式响应体中的用量
+// streamGenerateContent 未指定 alt=sse 时返回 JSON 数组，按顺序解析每个元素
+func parseGeminiResponseUsage(body []byte, usage *ReqeustLog) {
+	parsed := gjson.ParseBytes(body)
+	if parsed.IsArray() {
+		parsed.ForEach(func(_, item gjson.Result) bool {
+			GeminiParseTokenUsageFromResponse(item.Raw, usage)
+			return true
+		})
+		return
+	}
+	GeminiParseTokenUsageFromResponse(parsed.Raw, usage)
+}
+
+// sseUsageWriter 将转发给客户端的流式响应同时喂给 SSE 行解析器
+type sseUsageWriter struct {
+	lines *sseLineParser
+}
+
+func (w sseUsageWriter) Write(p []byte) (int, error) {
+	w.lines.Feed(p)
+	return len(p), nil
+}
+
 // ReplaceModelInRequestBody 替换请求体中的模型名
 // 使用 gjson + sjson 实现高性能 JSON 操作，避免完整反序列化
 func ReplaceModelInRequestBody(bodyBytes []byte, newModel string) ([]byte, error) {
@@ -608,7 +1351,7 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 		if c.Request.Body != nil {
 			data, err := io.ReadAll(c.Request.Body)
 			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+				writeRelayError(c, "gemini", http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request body", nil)
 				return
 			}
 			bodyBytes = data
@@ -618,135 +1361,85 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 		// 判断是否为流式请求
 		isStream := strings.Contains(endpoint, ":streamGenerateContent")
 
-		// 加载 Gemini providers
+		// 加载 Gemini providers：按配置顺序尝试已启用且支持该模型的 provider，跳过已拉黑的
 		providers := prs.geminiService.GetProviders()
 		if len(providers) == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "no gemini providers configured"})
+			writeRelayError(c, "gemini", http.StatusNotFound, ErrCodeNoProviders, "no gemini providers configured", nil)
 			return
 		}
-
-		// 查找启用的 provider
-		var activeProvider *GeminiProvider
-		for i := range providers {
-			if providers[i].Enabled && providers[i].BaseURL != "" {
-				activeProvider = &providers[i]
-				break
+		requestedModel := geminiModelFromEndpoint(endpoint)
+		candidates, unsupported := prs.geminiCandidates(providers, requestedModel)
+		if len(candidates) == 0 {
+			if unsupported > 0 {
+				writeRelayError(c, "gemini", http.StatusNotFound, ErrCodeModelUnsupported,
+					fmt.Sprintf("没有可用的 Gemini provider 支持模型 '%s'", requestedModel), nil)
+				return
 			}
-		}
-
-		if activeProvider == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "no active gemini provider"})
+			writeRelayError(c, "gemini", http.StatusNotFound, ErrCodeNoProviders, "no active gemini provider", nil)
 			return
 		}
 
-		fmt.Printf("[Gemini] 使用 Provider: %s | BaseURL: %s\n", activeProvider.Name, activeProvider.BaseURL)
-
-		// 创建请求日志
-		requestLog := &ReqeustLog{
-			Provider:     activeProvider.Name,
-			Platform:     "gemini",
-			Model:        activeProvider.Model,
-			IsStream:     isStream,
-			InputTokens:  0,
-			OutputTokens: 0,
-		}
-
-		// 记录开始时间并在函数结束时保存日志
-		start := time.Now()
-		defer func() {
-			requestLog.DurationSec = time.Since(start).Seconds()
-			if _, err := xdb.New("request_log").Insert(xdb.Record{
-				"platform":            requestLog.Platform,
-				"model":               requestLog.Model,
-				"provider":            requestLog.Provider,
-				"http_code":           requestLog.HttpCode,
-				"input_tokens":        requestLog.InputTokens,
-				"output_tokens":       requestLog.OutputTokens,
-				"cache_create_tokens": requestLog.CacheCreateTokens,
-				"cache_read_tokens":   requestLog.CacheReadTokens,
-				"reasoning_tokens":    requestLog.ReasoningTokens,
-				"is_stream":           boolToInt(requestLog.IsStream),
-				"duration_sec":        requestLog.DurationSec,
-			}); err != nil {
-				fmt.Printf("[Gemini] 写入 request_log 失败: %v\n", err)
+		// 登记为进行中的请求，CancelRequest 或客户端断开时取消上游调用
+		ctx, requestID, done := prs.trackRequest(c.Request.Context(), InflightRequest{
+			Platform: "gemini",
+			Provider: candidates[0].Name,
+			Model:    requestedModel,
+			IsStream: isStream,
+		})
+		defer done()
+
+		// 与 Claude / Codex 一致：还没有向客户端写出任何字节时失败，换下一个 provider 重试
+		baseHeader := c.Writer.Header().Clone()
+		var lastErr error
+		var lastProvider GeminiProvider
+		for attempt, provider := range candidates {
+			if attempt >= maxProviderAttempts {
+				break
 			}
-		}()
-
-		// 构建目标 URL
-		targetURL := strings.TrimSuffix(activeProvider.BaseURL, "/") + endpoint
-		fmt.Printf("[Gemini] 转发到: %s\n", targetURL)
-
-		// 创建 HTTP 请求
-		req, err := http.NewRequest("POST", targetURL, bytes.NewReader(bodyBytes))
-		if err != nil {
-			requestLog.HttpCode = http.StatusInternalServerError
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("创建请求失败: %v", err)})
-			return
-		}
-
-		// 复制请求头
-		for key, values := range c.Request.Header {
-			for _, value := range values {
-				req.Header.Add(key, value)
+			if attempt > 0 {
+				fmt.Printf("[Gemini] 尚未向客户端写出响应，切换到 Provider %s 重试\n", provider.Name)
+				resetResponseHeader(c, baseHeader)
 			}
-		}
-
-		// 设置 API Key（如果有）
-		if activeProvider.APIKey != "" {
-			// Gemini API 使用 x-goog-api-key 头
-			req.Header.Set("x-goog-api-key", activeProvider.APIKey)
-		}
 
-		// 发送请求
-		client := &http.Client{Timeout: 300 * time.Second}
-		resp, err := client.Do(req)
-		if err != nil {
-			requestLog.HttpCode = http.StatusBadGateway
-			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("请求失败: %v", err)})
-			return
-		}
-		defer resp.Body.Close()
+			startTime := time.Now()
+			ok, err := prs.forwardGeminiRequest(c, ctx, provider, endpoint, requestedModel, bodyBytes, isStream)
+			duration := time.Since(startTime)
 
-		requestLog.HttpCode = resp.StatusCode
-		fmt.Printf("[Gemini] Provider %s 响应: %d | 耗时: %.2fs\n", activeProvider.Name, resp.StatusCode, time.Since(start).Seconds())
-
-		// 如果不是成功响应，直接返回错误
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			errorBody, _ := io.ReadAll(resp.Body)
-			c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), errorBody)
-			return
-		}
-
-		// 复制响应头
-		for key, values := range resp.Header {
-			for _, value := range values {
-				c.Header(key, value)
+			if ok {
+				fmt.Printf("[Gemini] ✓ 请求完成 | Provider: %s | 耗时: %.2fs\n", provider.Name, duration.Seconds())
+				prs.providerCircuits().RecordSuccess("gemini", provider.Name)
+				if err := prs.blacklistService.RecordSuccess("gemini", provider.Name); err != nil {
+					fmt.Printf("[WARN] 清零失败计数失败: %v\n", err)
+				}
+				return
 			}
-		}
-
-		c.Status(resp.StatusCode)
 
-		// 处理响应
-		if isStream {
-			// 流式响应 - 直接复制（暂不解析 token usage）
-			c.Writer.Flush()
-			if _, err := io.Copy(c.Writer, resp.Body); err != nil {
-				fmt.Printf("[Gemini] 流式传输失败: %v\n", err)
-			}
-		} else {
-			// 非流式响应 - 读取并返回
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "读取响应失败"})
+			// 被取消的请求不是 provider 的问题，不计入失败次数
+			if ctx.Err() != nil {
+				fmt.Printf("[Gemini] 请求 %s 已取消: %s | 耗时: %.2fs\n", requestID, provider.Name, duration.Seconds())
+				writeRelayError(c, "gemini", statusRequestCanceled, ErrCodeRequestCanceled, "请求已取消", gin.H{"provider": provider.Name})
 				return
 			}
 
-			// TODO: 解析 Gemini 的 token usage from body
-			// Gemini API 的 usage 格式可能在 body 中的 usageMetadata 字段
+			fmt.Printf("[Gemini] ✗ 失败: %s | 错误: %v | 耗时: %.2fs\n", provider.Name, err, duration.Seconds())
+			prs.providerCircuits().RecordFailure("gemini", provider.Name)
+			if err := prs.blacklistService.RecordFailure("gemini", provider.Name); err != nil {
+				fmt.Printf("[ERROR] 记录失败到黑名单失败: %v\n", err)
+			}
 
-			c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
+			// 已写出部分响应：错误事件已追加在响应末尾，直接结束
+			if !retrySafe(c, err) {
+				return
+			}
+			lastErr, lastProvider = err, provider
 		}
 
-		fmt.Printf("[Gemini] ✓ 请求完成 | Provider: %s | 耗时: %.2fs\n", activeProvider.Name, time.Since(start).Seconds())
+		// 所有 provider 都失败：上游返回了错误响应时原样返回最后一个，否则返回 502
+		var upstreamErr *geminiUpstreamError
+		if errors.As(lastErr, &upstreamErr) {
+			c.Data(upstreamErr.status, upstreamErr.contentType, upstreamErr.body)
+			return
+		}
+		writeRelayError(c, "gemini", http.StatusBadGateway, ErrCodeUpstreamError, fmt.Sprintf("Provider %s %v", lastProvider.Name, lastErr), gin.H{"provider": lastProvider.Name})
 	}
 }
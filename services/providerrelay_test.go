@@ -2,8 +2,16 @@ package services
 
 import (
 	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/daodao97/xgo/xdb"
 	"github.com/tidwall/gjson"
 )
 
@@ -199,10 +207,70 @@ func TestModelMappingEndToEnd(t *testing.T) {
 
 // ==================== 配置验证集成测试 ====================
 
+func TestModelMatchingIgnoresCaseAndWhitespace(t *testing.T) {
+	provider := Provider{
+		Name: "OpenRouter",
+		SupportedModels: map[string]bool{
+			"anthropic/Claude-Sonnet-4": true,
+			"deepseek-*":                true,
+		},
+		ModelMapping: map[string]string{
+			"Claude-Sonnet-4": "anthropic/Claude-Sonnet-4",
+			"claude-*-4":      "anthropic/claude-*-v4",
+		},
+	}
+
+	scenarios := []struct {
+		requestedModel string
+		shouldSupport  bool
+		effectiveModel string
+	}{
+		{" claude-sonnet-4 ", true, "anthropic/Claude-Sonnet-4"},
+		{"CLAUDE-SONNET-4", true, "anthropic/Claude-Sonnet-4"},
+		{"ANTHROPIC/claude-sonnet-4", true, "ANTHROPIC/claude-sonnet-4"},
+		{"DeepSeek-V3", true, "DeepSeek-V3"},
+		// 通配符匹配部分保留请求中的大小写，目标模型的其余部分取自映射表
+		{"Claude-Opus-4", true, "anthropic/claude-Opus-v4"},
+		{"gpt-4", false, "gpt-4"},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.requestedModel, func(t *testing.T) {
+			if supported := provider.IsModelSupported(scenario.requestedModel); supported != scenario.shouldSupport {
+				t.Errorf("IsModelSupported(%q) = %v, 期望 %v", scenario.requestedModel, supported, scenario.shouldSupport)
+			}
+			effectiveModel := provider.GetEffectiveModel(scenario.requestedModel)
+			if effectiveModel != scenario.effectiveModel {
+				t.Errorf("GetEffectiveModel(%q) = %q, 期望 %q", scenario.requestedModel, effectiveModel, scenario.effectiveModel)
+			}
+			result, err := ReplaceModelInRequestBody([]byte(`{"model":"`+scenario.requestedModel+`"}`), effectiveModel)
+			if err != nil {
+				t.Fatalf("ReplaceModelInRequestBody 失败: %v", err)
+			}
+			if actual := gjson.GetBytes(result, "model").String(); actual != scenario.effectiveModel {
+				t.Errorf("请求体中的模型 = %q, 期望 %q", actual, scenario.effectiveModel)
+			}
+		})
+	}
+
+	// 开启 CaseSensitiveModels 后只忽略首尾空白
+	provider.CaseSensitiveModels = true
+	if provider.IsModelSupported("CLAUDE-SONNET-4") {
+		t.Errorf("区分大小写时 CLAUDE-SONNET-4 不应匹配 Claude-Sonnet-4")
+	}
+	if got := provider.GetEffectiveModel(" Claude-Sonnet-4 "); got != "anthropic/Claude-Sonnet-4" {
+		t.Errorf("区分大小写时仍应忽略首尾空白, 实际 %q", got)
+	}
+	if provider.IsModelSupported("DEEPSEEK-V3") {
+		t.Errorf("区分大小写时通配符白名单不应匹配 DEEPSEEK-V3")
+	}
+}
+
 func TestProviderConfigValidation(t *testing.T) {
 	// 场景 1：完美配置
 	validProvider := Provider{
-		Name: "ValidProvider",
+		Name:   "ValidProvider",
+		APIURL: "https://api.example.com",
 		SupportedModels: map[string]bool{
 			"anthropic/claude-sonnet-4": true,
 			"anthropic/claude-opus-4":   true,
@@ -236,7 +304,8 @@ func TestProviderConfigValidation(t *testing.T) {
 
 	// 场景 3：通配符配置
 	wildcardProvider := Provider{
-		Name: "WildcardProvider",
+		Name:   "WildcardProvider",
+		APIURL: "https://api.example.com",
 		SupportedModels: map[string]bool{
 			"anthropic/claude-*": true,
 			"openai/gpt-*":       true,
@@ -302,3 +371,493 @@ func BenchmarkReplaceModelInRequestBody(b *testing.B) {
 		_, _ = ReplaceModelInRequestBody(bodyBytes, "anthropic/claude-sonnet-4")
 	}
 }
+
+// ==================== Claude 缓存 TTL 细分解析测试 ====================
+
+func TestClaudeParseTieredCacheCreation(t *testing.T) {
+	payload := `event: message_start
+data: {"type":"message_start","message":{"model":"claude-sonnet-4-20250514","usage":{"input_tokens":12,"cache_creation_input_tokens":3000,"cache_read_input_tokens":500,"cache_creation":{"ephemeral_5m_input_tokens":1000,"ephemeral_1h_input_tokens":2000},"output_tokens":1}}}
+
+event: message_delta
+data: {"type":"message_delta","usage":{"output_tokens":42}}
+`
+	usage := &ReqeustLog{Model: "claude-sonnet-4-20250514"}
+	parseEventPayload(payload, ClaudeCodeParseTokenUsageFromResponse, usage)
+
+	if usage.CacheCreateTokens != 3000 || usage.CacheReadTokens != 500 {
+		t.Fatalf("缓存 tokens 解析错误: create=%d read=%d", usage.CacheCreateTokens, usage.CacheReadTokens)
+	}
+	if usage.Ephemeral5mTokens != 1000 || usage.Ephemeral1hTokens != 2000 {
+		t.Fatalf("缓存 TTL 细分解析错误: 5m=%d 1h=%d", usage.Ephemeral5mTokens, usage.Ephemeral1hTokens)
+	}
+	if usage.InputTokens != 12 || usage.OutputTokens != 43 {
+		t.Fatalf("token 解析错误: input=%d output=%d", usage.InputTokens, usage.OutputTokens)
+	}
+
+	ls := NewLogService()
+	ls.decorateCost(usage)
+	if usage.Ephemeral5mCost <= 0 || usage.Ephemeral1hCost <= usage.Ephemeral5mCost {
+		t.Fatalf("1 小时缓存应单独计费且高于 5 分钟缓存: 5m=%v 1h=%v", usage.Ephemeral5mCost, usage.Ephemeral1hCost)
+	}
+}
+
+// ==================== Chat Completions 用量解析测试 ====================
+
+func TestChatCompletionsUsageParsing(t *testing.T) {
+	t.Run("非流式", func(t *testing.T) {
+		body := `{
+			"id": "chatcmpl-1",
+			"object": "chat.completion",
+			"model": "gpt-4o",
+			"choices": [{"index": 0, "message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}],
+			"usage": {
+				"prompt_tokens": 120,
+				"completion_tokens": 30,
+				"total_tokens": 150,
+				"prompt_tokens_details": {"cached_tokens": 64},
+				"completion_tokens_details": {"reasoning_tokens": 8}
+			}
+		}`
+		usage := &ReqeustLog{}
+		ReqeustLogHook(nil, "codex", chatCompletionsEndpoint, usage)([]byte(body))
+		if usage.InputTokens != 120 || usage.OutputTokens != 30 || usage.CacheReadTokens != 64 || usage.ReasoningTokens != 8 {
+			t.Fatalf("用量解析错误: %+v", usage)
+		}
+	})
+
+	t.Run("流式", func(t *testing.T) {
+		usage := &ReqeustLog{}
+		hook := ReqeustLogHook(nil, "codex", chatCompletionsEndpoint, usage)
+		chunks := []string{
+			`data: {"id":"chatcmpl-2","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"he"}}],"usage":null}`,
+			`data: {"id":"chatcmpl-2","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"llo"}}],"usage":null}`,
+			`data: {"id":"chatcmpl-2","object":"chat.completion.chunk","choices":[],"usage":{"prompt_tokens":50,"completion_tokens":7,"total_tokens":57}}`,
+			`data: [DONE]`,
+		}
+		for _, chunk := range chunks {
+			hook([]byte(chunk + "\n\n"))
+		}
+		if usage.InputTokens != 50 || usage.OutputTokens != 7 {
+			t.Fatalf("流式用量解析错误: %+v", usage)
+		}
+	})
+}
+
+// ==================== SSE 分片拼接测试 ====================
+
+func TestReqeustLogHookReassemblesFragmentedChunks(t *testing.T) {
+	stream := "event: message_start\n" +
+		`data: {"type":"message_start","message":{"model":"claude-sonnet-4-20250514","usage":{"input_tokens":1200,"cache_creation_input_tokens":300,"cache_read_input_tokens":4500,"output_tokens":1}}}` + "\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"` + strings.Repeat("x", 3000) + `"}}` + "\n\n" +
+		"event: message_delta\n" +
+		`data:{"type":"message_delta","usage":{"output_tokens":256}}`
+
+	for _, size := range []int{1, 7, 1024} {
+		usage := &ReqeustLog{}
+		hook := ReqeustLogHook(nil, "claude", "/v1/messages", usage)
+		for start := 0; start < len(stream); start += size {
+			end := min(start+size, len(stream))
+			hook([]byte(stream[start:end]))
+		}
+		if usage.InputTokens != 1200 || usage.CacheCreateTokens != 300 || usage.CacheReadTokens != 4500 || usage.OutputTokens != 257 {
+			t.Fatalf("分片大小 %d: 用量解析错误: %+v", size, usage)
+		}
+	}
+}
+
+// ==================== 请求体改写规则测试 ====================
+
+func TestApplyBodyOverrides(t *testing.T) {
+	body := []byte(`{"model":"gpt-4o","stream":true,"metadata":{"user_id":"u1"},"messages":[{"role":"user","content":"hi"}]}`)
+	rules := []BodyOverride{
+		{Op: "set", Path: "stream_options.include_usage", Value: json.RawMessage(`true`)},
+		{Op: "delete", Path: "metadata"},
+		{Op: "delete", Path: "not_present"},
+		{Op: "set", Path: "temperature", Value: json.RawMessage(`0.2`)},
+	}
+	if errs := validateBodyOverrides(rules); len(errs) > 0 {
+		t.Fatalf("合法规则不应报错: %v", errs)
+	}
+
+	modified, err := applyBodyOverrides(body, rules)
+	if err != nil {
+		t.Fatalf("执行改写规则失败: %v", err)
+	}
+	if !gjson.GetBytes(modified, "stream_options.include_usage").Bool() {
+		t.Fatalf("应写入 stream_options.include_usage: %s", modified)
+	}
+	if gjson.GetBytes(modified, "metadata").Exists() {
+		t.Fatalf("应删除 metadata: %s", modified)
+	}
+	if gjson.GetBytes(modified, "temperature").Float() != 0.2 || gjson.GetBytes(modified, "model").String() != "gpt-4o" {
+		t.Fatalf("改写结果不正确: %s", modified)
+	}
+
+	if out, err := applyBodyOverrides([]byte("not json"), rules); err != nil || string(out) != "not json" {
+		t.Fatalf("非 JSON 请求体应原样返回")
+	}
+
+	invalid := []BodyOverride{
+		{Op: "set", Path: "a", Value: json.RawMessage(`{bad`)},
+		{Op: "rename", Path: "b"},
+		{Op: "delete", Path: " "},
+	}
+	if errs := validateBodyOverrides(invalid); len(errs) != 3 {
+		t.Fatalf("应返回 3 条校验错误, 得到 %v", errs)
+	}
+}
+
+func TestGeminiParseTokenUsageFromResponse(t *testing.T) {
+	t.Run("非流式", func(t *testing.T) {
+		body := `{"candidates":[{"content":{"parts":[{"text":"hi"}]}}],"usageMetadata":{"promptTokenCount":120,"candidatesTokenCount":30,"cachedContentTokenCount":64,"thoughtsTokenCount":8,"totalTokenCount":158}}`
+		usage := &ReqeustLog{}
+		parseGeminiResponseUsage([]byte(body), usage)
+		if usage.InputTokens != 56 || usage.CacheReadTokens != 64 || usage.OutputTokens != 38 || usage.ReasoningTokens != 8 {
+			t.Fatalf("用量解析错误: %+v", usage)
+		}
+	})
+
+	t.Run("JSON 数组", func(t *testing.T) {
+		body := `[{"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":2}},{"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":9}}]`
+		usage := &ReqeustLog{}
+		parseGeminiResponseUsage([]byte(body), usage)
+		if usage.InputTokens != 10 || usage.OutputTokens != 9 {
+			t.Fatalf("应以最后一个元素的累计值为准: %+v", usage)
+		}
+	})
+
+	t.Run("流式累计值不重复计算", func(t *testing.T) {
+		usage := &ReqeustLog{}
+		lines := newSSELineParser(GeminiParseTokenUsageFromResponse, usage)
+		stream := `data: {"candidates":[{"content":{"parts":[{"text":"he"}]}}],"usageMetadata":{"promptTokenCount":50,"candidatesTokenCount":1}}` + "\r\n\r\n" +
+			`data: {"candidates":[{"content":{"parts":[{"text":"llo"}]}}],"usageMetadata":{"promptTokenCount":50,"candidatesTokenCount":4}}` + "\r\n\r\n" +
+			`data: {"candidates":[{"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":50,"candidatesTokenCount":7,"thoughtsTokenCount":3}}` + "\r\n\r\n"
+		w := sseUsageWriter{lines: lines}
+		for start := 0; start < len(stream); start += 13 {
+			_, _ = w.Write([]byte(stream[start:min(start+13, len(stream))]))
+		}
+		lines.Flush()
+		if usage.InputTokens != 50 || usage.OutputTokens != 10 || usage.ReasoningTokens != 3 {
+			t.Fatalf("流式用量解析错误: %+v", usage)
+		}
+	})
+}
+
+func TestForceProviderHeader(t *testing.T) {
+	setupTestEnv(t)
+
+	var primaryHits, forcedHits int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryHits, 1)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer primary.Close()
+	forced := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&forcedHits, 1)
+		if r.Header.Get(forceProviderHeader) != "" {
+			t.Errorf("%s 不应转发到上游", forceProviderHeader)
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer forced.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "primary", APIURL: primary.URL, APIKey: "sk-a", Enabled: true, Level: 1},
+		{ID: 2, Name: "forced", APIURL: forced.URL, APIKey: "sk-b", Enabled: true, Level: 3},
+		{ID: 3, Name: "limited", APIURL: forced.URL, APIKey: "sk-c", Enabled: true, Level: 2,
+			SupportedModels: map[string]bool{"claude-haiku-4": true}},
+		{ID: 4, Name: "blocked", APIURL: forced.URL, APIKey: "sk-d", Enabled: true, Level: 2},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatalf("获取数据库失败: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO provider_blacklist (platform, provider_name, blacklisted_at, blacklisted_until) VALUES (?, ?, ?, ?)`,
+		"claude", "blocked", time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("写入黑名单失败: %v", err)
+	}
+
+	send := func(name string, remoteAddr string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(forceProviderHeader, name)
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("found", func(t *testing.T) {
+		rec := send("forced", "127.0.0.1:50000")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("状态码 = %d, 期望 200, body=%s", rec.Code, rec.Body.String())
+		}
+		if atomic.LoadInt32(&forcedHits) != 1 || atomic.LoadInt32(&primaryHits) != 0 {
+			t.Fatalf("应只命中强制指定的 provider (forced=%d, primary=%d)", forcedHits, primaryHits)
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		rec := send("limited", "127.0.0.1:50000")
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("状态码 = %d, 期望 409", rec.Code)
+		}
+	})
+
+	t.Run("blacklisted", func(t *testing.T) {
+		rec := send("blocked", "127.0.0.1:50000")
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("状态码 = %d, 期望 409", rec.Code)
+		}
+	})
+
+	t.Run("remote client rejected", func(t *testing.T) {
+		rec := send("forced", "192.0.2.10:50000")
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("状态码 = %d, 期望 403", rec.Code)
+		}
+	})
+
+	if atomic.LoadInt32(&primaryHits) != 0 {
+		t.Fatalf("强制指定不可用时不应回退到其他 provider")
+	}
+}
+
+func TestRelayStartStopTransitions(t *testing.T) {
+	setupTestEnv(t)
+
+	relay, _ := newTestRelay(t)
+	if relay.IsRunning() {
+		t.Fatalf("启动前不应处于运行状态")
+	}
+	if err := relay.WaitUntilReady(50 * time.Millisecond); err == nil {
+		t.Fatalf("未启动时 WaitUntilReady 应超时")
+	}
+
+	for round := 0; round < 2; round++ {
+		if err := relay.Start(); err != nil {
+			t.Fatalf("第 %d 次启动失败: %v", round+1, err)
+		}
+		if err := relay.WaitUntilReady(time.Second); err != nil {
+			t.Fatalf("启动后应就绪: %v", err)
+		}
+		if !relay.IsRunning() {
+			t.Fatalf("启动后应处于运行状态")
+		}
+		if err := relay.Start(); err == nil {
+			t.Fatalf("重复启动应返回错误")
+		}
+		if err := relay.Stop(); err != nil {
+			t.Fatalf("停止失败: %v", err)
+		}
+		if relay.IsRunning() {
+			t.Fatalf("停止后不应处于运行状态")
+		}
+	}
+}
+
+func TestRelayStartPortInUse(t *testing.T) {
+	setupTestEnv(t)
+
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("占用端口失败: %v", err)
+	}
+	defer occupied.Close()
+
+	relay, _ := newTestRelay(t)
+	relay.addr = occupied.Addr().String()
+	if err := relay.Start(); err == nil {
+		_ = relay.Stop()
+		t.Fatalf("端口被占用时启动应失败")
+	}
+	if relay.IsRunning() {
+		t.Fatalf("启动失败后不应处于运行状态")
+	}
+	if err := relay.WaitUntilReady(50 * time.Millisecond); err == nil {
+		t.Fatalf("启动失败后 WaitUntilReady 应超时")
+	}
+}
+
+func TestProxyRejectsMalformedJSON(t *testing.T) {
+	setupTestEnv(t)
+
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("codex", []Provider{
+		{ID: 1, Name: "upstream", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "截断的 JSON", body: `{"model":"gpt-5","input":`, status: http.StatusBadRequest},
+		{name: "非 JSON 文本", body: `model=gpt-5`, status: http.StatusBadRequest},
+		{name: "空请求体", body: ``, status: http.StatusBadRequest},
+		{name: "合法 JSON", body: `{"model":"gpt-5","input":"hi"}`, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/responses", strings.NewReader(tt.body))
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("状态码 = %d, 期望 %d, body=%s", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("只有合法请求应转发到上游，实际命中 %d 次", got)
+	}
+	if requiresJSONBody("gemini", "/v1beta") {
+		t.Fatalf("未登记的端点应透传")
+	}
+}
+
+func TestChatCompletionsRoute(t *testing.T) {
+	setupTestEnv(t)
+
+	paths := make(chan string, 2)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":2}}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("codex", []Provider{
+		{ID: 1, Name: "openai-compat", APIURL: upstream.URL + "/v1", APIKey: "sk-test", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	for _, path := range []string{"/v1/chat/completions", "/chat/completions"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"model":"gpt-4o","messages":[]}`))
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s 状态码 = %d, body=%s", path, rec.Code, rec.Body.String())
+		}
+		if got := <-paths; got != "/v1/chat/completions" {
+			t.Fatalf("%s 转发路径 = %s, 期望 /v1/chat/completions", path, got)
+		}
+	}
+
+	logs, err := NewLogService().QueryLogs(RequestLogQuery{Platform: "codex"})
+	if err != nil || len(logs) != 2 {
+		t.Fatalf("请求日志 = %d 条 (%v), 期望 2", len(logs), err)
+	}
+	if logs[0].InputTokens != 10 || logs[0].OutputTokens != 2 {
+		t.Fatalf("请求日志用量错误: %+v", logs[0])
+	}
+}
+
+func TestFallbackModelWhenUnsupported(t *testing.T) {
+	setupTestEnv(t)
+
+	var upstreamModel atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		upstreamModel.Store(gjson.GetBytes(body, "model").String())
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "mainstream", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1,
+			SupportedModels: map[string]bool{"claude-sonnet-4": true}},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	send := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-exotic-9","messages":[]}`))
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(); rec.Code != http.StatusNotFound {
+		t.Fatalf("未配置降级模型时状态码 = %d, 期望 404", rec.Code)
+	}
+
+	if err := relay.settingsService.SetFallbackModel("claude", "claude-sonnet-4"); err != nil {
+		t.Fatalf("保存降级模型失败: %v", err)
+	}
+	if rec := send(); rec.Code != http.StatusOK {
+		t.Fatalf("配置降级模型后状态码 = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	if got, _ := upstreamModel.Load().(string); got != "claude-sonnet-4" {
+		t.Fatalf("上游收到的模型 = %q, 期望降级为 claude-sonnet-4", got)
+	}
+
+	if err := relay.settingsService.SetFallbackModel("gemini", "x"); err == nil {
+		t.Fatalf("不支持的平台应返回错误")
+	}
+}
+
+func TestInputTokenRouting(t *testing.T) {
+	setupTestEnv(t)
+
+	var smallHits, largeHits int32
+	small := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&smallHits, 1)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer small.Close()
+	large := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&largeHits, 1)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer large.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "fast", APIURL: small.URL, APIKey: "sk-a", Enabled: true, Level: 1, MaxInputTokens: 500},
+		{ID: 2, Name: "long-context", APIURL: large.URL, APIKey: "sk-b", Enabled: true, Level: 2, MinInputTokens: 1000, MaxInputTokens: 50000},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	send := func(content string) int {
+		rec := httptest.NewRecorder()
+		body := `{"model":"claude-sonnet-4","messages":[{"role":"user","content":"` + content + `"}]}`
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	if code := send("hi"); code != http.StatusOK || atomic.LoadInt32(&smallHits) != 1 {
+		t.Fatalf("小请求应路由到 fast (code=%d, fast=%d)", code, smallHits)
+	}
+	if code := send(strings.Repeat("x", 8000)); code != http.StatusOK || atomic.LoadInt32(&largeHits) != 1 {
+		t.Fatalf("大请求应路由到 long-context (code=%d, long-context=%d)", code, largeHits)
+	}
+	// 介于两个范围之间（约 700 tokens）：没有 provider 接受
+	if code := send(strings.Repeat("x", 2700)); code != http.StatusNotFound {
+		t.Fatalf("超出所有范围时状态码 = %d, 期望 404", code)
+	}
+
+	// 自定义估算器
+	relay.tokenEstimator = func(body []byte) int { return 100000 }
+	if code := send("hi"); code != http.StatusNotFound {
+		t.Fatalf("估算值超过所有上限时状态码 = %d, 期望 404", code)
+	}
+}
@@ -28,20 +28,97 @@ type Provider struct {
 	// 支持精确匹配和通配符（如 "claude-*" -> "anthropic/claude-*"）
 	ModelMapping map[string]string `json:"modelMapping,omitempty"`
 
+	// 客户端专属模型映射 - 客户端标识 -> (外部模型名 -> Provider 内部模型名)
+	// 客户端标识匹配 X-Client-Id 请求头，未携带时匹配 User-Agent（包含即可，如 "claude-cli"）
+	// 未命中时回退到 ModelMapping；是否支持某个模型仍由 SupportedModels/ModelMapping 决定
+	ClientModelMapping map[string]map[string]string `json:"clientModelMapping,omitempty"`
+
+	// 模型名区分大小写 - 默认匹配 SupportedModels / ModelMapping 时忽略大小写和首尾空白
+	// 只有上游确实以大小写区分不同模型时才需开启
+	CaseSensitiveModels bool `json:"caseSensitiveModels,omitempty"`
+
 	// 优先级分组 - 数字越小优先级越高（1-10，默认 1）
 	// 使用 omitempty 确保零值不序列化，向后兼容
 	Level int `json:"level,omitempty"`
 
+	// 备注 - 用户自定义的说明（如 "个人 key，每日 5M 限额"）
+	Note string `json:"note,omitempty"`
+
+	// 标签 - 用于项目级路由（.bmai.json 的 tags）筛选 provider
+	Tags []string `json:"tags,omitempty"`
+
+	// 跳过上游 TLS 证书校验（不推荐，仅用于自签名证书等特殊场景）
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+
+	// 上游 Host 请求头 / TLS SNI 覆盖 - 用于只能通过 IP 访问、按 Host 路由的共享网关（为空时按 APIURL 正常访问）
+	// 只配置 HostHeader 时 SNI 默认使用其主机名，证书按 SNI 校验；API Key 会发送到 APIURL 指向的地址，需确认该地址可信
+	HostHeader    string `json:"hostHeader,omitempty"`
+	TLSServerName string `json:"tlsServerName,omitempty"`
+
+	// 输入 token 范围 - 估算的请求输入 token 数超出范围时跳过该 provider（0 表示不限制）
+	// 可将大上下文请求路由到高限额的 provider，小请求路由到更便宜/更快的 provider
+	MinInputTokens int `json:"minInputTokens,omitempty"`
+	MaxInputTokens int `json:"maxInputTokens,omitempty"`
+
+	// 请求体改写规则 - 转发前在模型映射之后执行，用于注入或删除 provider 特有的参数
+	BodyOverrides []BodyOverride `json:"bodyOverrides,omitempty"`
+
+	// 维护窗口 - 一次性的计划停机时段，窗口内不参与选择（不计为失败、不拉黑），结束后自动恢复
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+
+	// 阶梯计价 - 按自然月累计 token 调整费用统计的费率（为空时按模型标价计费）
+	PricingTiers []PricingTier `json:"pricingTiers,omitempty"`
+
+	// 首字节超时（秒）- 建立连接到收到响应头的最长等待时间，超时计为失败（0 表示使用默认的 30 分钟）
+	// 只限制等待响应开始的阶段，已开始的流式响应不受影响
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+
+	// 鉴权方式 - bearer（默认，Authorization: Bearer）、x-api-key（只发送 x-api-key 头）、none（不发送鉴权头）
+	AuthScheme string `json:"authScheme,omitempty"`
+
+	// 并发上限 - 同时转发给该 provider 的最大请求数（0 表示不限制），已满时最多等待 MaxConcurrentWaitSeconds 秒（默认 10 秒）
+	MaxConcurrent            int `json:"maxConcurrent,omitempty"`
+	MaxConcurrentWaitSeconds int `json:"maxConcurrentWaitSeconds,omitempty"`
+
+	// 权重 - 同一 Level 内按权重随机分配流量（未配置时为 1，0 表示只在该 Level 没有其他 provider 可用时使用）
+	Weight *int `json:"weight,omitempty"`
+
+	// 自定义请求头 - 转发时附加的静态请求头（如 X-Org-Id、anthropic-beta），值中的 {NAME} 替换为同名环境变量
+	// 不能设置 Authorization / x-api-key，鉴权始终由 apiKey 和 authScheme 决定
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// 从不拉黑 - 失败不计入黑名单和短时熔断，始终保留在可用列表中（失败仍写入请求日志）
+	// 用于希望始终优先尝试的主力 provider；同一 Level 内建议只设置一个
+	NeverBlacklist bool `json:"neverBlacklist,omitempty"`
+
 	// 内部字段：配置验证错误（不持久化）
 	configErrors []string `json:"-"`
 }
 
+// providerSchemaVersion 当前 provider 配置文件的格式版本
+// 版本历史：
+//   0 - 无 schemaVersion 字段的旧文件
+//   1 - 引入 schemaVersion，Level 默认填充为 1，模型映射/白名单去除首尾空白
+const providerSchemaVersion = 1
+
 type providerEnvelope struct {
-	Providers []Provider `json:"providers"`
+	SchemaVersion int        `json:"schemaVersion,omitempty"`
+	Providers     []Provider `json:"providers"`
 }
 
 type ProviderService struct {
-	mu sync.Mutex
+	mu          sync.Mutex
+	proxies     map[string]platformProxy
+	appSettings *AppSettingsService
+	listeners   []func(kind string)
+	// snapshots 按平台缓存 provider 列表，供备注、从不拉黑等高频查询使用，保存或重置配置时失效
+	snapshots map[string][]Provider
+}
+
+// platformProxy 平台 CLI 配置的代理开关（ClaudeSettingsService / CodexSettingsService）
+type platformProxy interface {
+	ProxyStatus() (ClaudeProxyStatus, error)
+	EnableProxy() error
 }
 
 func NewProviderService() *ProviderService {
@@ -76,11 +153,20 @@ func (ps *ProviderService) SaveProviders(kind string, providers []Provider) erro
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
+	return ps.saveProvidersLocked(kind, providers)
+}
+
+// saveProvidersLocked 校验并保存 provider 配置，调用方需持有 ps.mu
+func (ps *ProviderService) saveProvidersLocked(kind string, providers []Provider) error {
 	path, err := providerFilePath(kind)
 	if err != nil {
 		return err
 	}
 
+	if version := providerFileSchemaVersion(path); version > providerSchemaVersion {
+		return newerSchemaError(path, version, providerSchemaVersion)
+	}
+
 	existingProviders, err := ps.LoadProviders(kind)
 	if err != nil {
 		return err
@@ -111,7 +197,41 @@ func (ps *ProviderService) SaveProviders(kind string, providers []Provider) erro
 		return fmt.Errorf("配置验证失败：\n  - %s", strings.Join(validationErrors, "\n  - "))
 	}
 
-	data, err := json.MarshalIndent(providerEnvelope{Providers: providers}, "", "  ")
+	// 规则 3：同一 Level 内有多个从不拉黑的 provider 时只给出警告，不阻止保存
+	for _, warning := range neverBlacklistWarnings(providers) {
+		fmt.Printf("[WARN] %s 配置: %s\n", kind, warning)
+	}
+
+	// 规则 4：apiUrl 已包含接口路径时只给出警告，不阻止保存
+	for _, p := range providers {
+		for _, warning := range apiURLWarnings(p) {
+			fmt.Printf("[WARN] %s 配置: %s\n", kind, warning)
+		}
+	}
+
+	if err := writeProviderFile(path, providers); err != nil {
+		return err
+	}
+	delete(ps.snapshots, kind)
+	for _, fn := range ps.listeners {
+		go fn(kind)
+	}
+	return nil
+}
+
+// OnProvidersChanged 注册供应商配置变更回调（异步调用，托盘菜单等据此刷新）
+func (ps *ProviderService) OnProvidersChanged(fn func(kind string)) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.listeners = append(ps.listeners, fn)
+}
+
+// writeProviderFile 以当前 schema 版本原子写入 provider 配置文件
+func writeProviderFile(path string, providers []Provider) error {
+	data, err := json.MarshalIndent(providerEnvelope{
+		SchemaVersion: providerSchemaVersion,
+		Providers:     providers,
+	}, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -145,9 +265,87 @@ func (ps *ProviderService) LoadProviders(kind string) ([]Provider, error) {
 	if err := json.Unmarshal(data, &envelope); err != nil {
 		return nil, err
 	}
+
+	// 更新版本写入的文件：只读加载，saveProvidersLocked 会拒绝保存
+	if envelope.SchemaVersion > providerSchemaVersion {
+		fmt.Printf("[WARN] %v\n", newerSchemaError(path, envelope.SchemaVersion, providerSchemaVersion))
+	}
+
+	// 旧版本文件：执行迁移并回写，保证后续读取无需重复迁移
+	if envelope.SchemaVersion < providerSchemaVersion {
+		fromVersion := envelope.SchemaVersion
+		envelope.Providers = migrateProviders(envelope.Providers, fromVersion)
+		if err := writeProviderFile(path, envelope.Providers); err != nil {
+			fmt.Printf("[WARN] 回写迁移后的 %s 配置失败: %v\n", kind, err)
+		} else {
+			fmt.Printf("[INFO] %s 配置已从 schema v%d 迁移到 v%d\n", kind, fromVersion, providerSchemaVersion)
+		}
+	}
 	return envelope.Providers, nil
 }
 
+// providerFileSchemaVersion 读取 provider 配置文件的 schema 版本，文件不存在或无法解析时返回 0
+func providerFileSchemaVersion(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	var envelope struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return 0
+	}
+	return envelope.SchemaVersion
+}
+
+// newerSchemaError 配置文件由更新版本的应用写入：按旧版本保存会丢失新版本的字段
+func newerSchemaError(path string, version, supported int) error {
+	return fmt.Errorf("%s 由更新版本的应用写入（schema v%d，当前支持 v%d），为避免丢失数据已拒绝保存，请升级应用", filepath.Base(path), version, supported)
+}
+
+// migrateProviders 将旧版本的 provider 列表逐级升级到当前 schema 版本
+func migrateProviders(providers []Provider, fromVersion int) []Provider {
+	if fromVersion < 1 {
+		for i := range providers {
+			migrateProviderV0ToV1(&providers[i])
+		}
+	}
+	return providers
+}
+
+// migrateProviderV0ToV1 v0 -> v1：填充 Level 默认值，规范化模型白名单和映射
+func migrateProviderV0ToV1(p *Provider) {
+	if p.Level <= 0 {
+		p.Level = 1
+	}
+
+	if p.SupportedModels != nil {
+		normalized := make(map[string]bool, len(p.SupportedModels))
+		for model, supported := range p.SupportedModels {
+			model = strings.TrimSpace(model)
+			if model == "" || !supported {
+				continue
+			}
+			normalized[model] = true
+		}
+		p.SupportedModels = normalized
+	}
+
+	if p.ModelMapping != nil {
+		normalized := make(map[string]string, len(p.ModelMapping))
+		for external, internal := range p.ModelMapping {
+			external = strings.TrimSpace(external)
+			internal = strings.TrimSpace(internal)
+			if external == "" || internal == "" {
+				continue
+			}
+			normalized[external] = internal
+		}
+		p.ModelMapping = normalized
+	}
+}
+
 // DuplicateProvider 复制供应商配置，生成新的副本
 // 返回新创建的 Provider 对象
 func (ps *ProviderService) DuplicateProvider(kind string, sourceID int64) (*Provider, error) {
@@ -193,6 +391,25 @@ func (ps *ProviderService) DuplicateProvider(kind string, sourceID int64) (*Prov
 		Accent:  source.Accent,
 		Enabled: false, // 默认禁用，避免与源供应商冲突
 		Level:   source.Level,
+		Note:    source.Note,
+
+		InsecureSkipVerify: source.InsecureSkipVerify,
+		HostHeader:         source.HostHeader,
+		TLSServerName:      source.TLSServerName,
+		MinInputTokens:     source.MinInputTokens,
+		MaxInputTokens:     source.MaxInputTokens,
+		BodyOverrides:      cloneBodyOverrides(source.BodyOverrides),
+		MaintenanceWindows: cloneMaintenanceWindows(source.MaintenanceWindows),
+		PricingTiers:       clonePricingTiers(source.PricingTiers),
+		TimeoutSeconds:     source.TimeoutSeconds,
+		AuthScheme:         source.AuthScheme,
+		Tags:               append([]string(nil), source.Tags...),
+
+		MaxConcurrent:            source.MaxConcurrent,
+		MaxConcurrentWaitSeconds: source.MaxConcurrentWaitSeconds,
+		Weight:                   cloneWeight(source.Weight),
+		CaseSensitiveModels:      source.CaseSensitiveModels,
+		// NeverBlacklist 不复制：副本与原 provider 同 Level，复制会产生两个从不拉黑的 provider
 	}
 
 	// 5. 深拷贝 map（避免共享引用）
@@ -209,19 +426,127 @@ func (ps *ProviderService) DuplicateProvider(kind string, sourceID int64) (*Prov
 			cloned.ModelMapping[k] = v
 		}
 	}
+	cloned.ClientModelMapping = cloneClientModelMapping(source.ClientModelMapping)
+	if source.Headers != nil {
+		cloned.Headers = cloneMap(source.Headers)
+	}
 
 	// 6. 添加到列表并保存
 	providers = append(providers, *cloned)
-	if err := ps.SaveProviders(kind, providers); err != nil {
+	if err := ps.saveProvidersLocked(kind, providers); err != nil {
 		return nil, fmt.Errorf("保存副本失败: %w", err)
 	}
 
 	return cloned, nil
 }
 
+// BindProxySettings 关联各平台的 CLI 代理配置，供 ToggleProvider 在启用供应商时确保代理已开启
+func (ps *ProviderService) BindProxySettings(claude *ClaudeSettingsService, codex *CodexSettingsService) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.proxies = map[string]platformProxy{"claude": claude, "codex": codex}
+}
+
+// ToggleProvider 启用/禁用供应商并立即保存
+// 启用后若该平台仅有这一个启用的供应商，会确保 CLI 配置已指向 relay；
+// 禁用最后一个启用的供应商时给出警告（经由 relay 的请求将无可用供应商）
+func (ps *ProviderService) ToggleProvider(kind string, id int64, enabled bool) error {
+	ps.mu.Lock()
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		ps.mu.Unlock()
+		return fmt.Errorf("加载供应商配置失败: %w", err)
+	}
+
+	found := false
+	enabledCount := 0
+	for i := range providers {
+		if providers[i].ID == id {
+			providers[i].Enabled = enabled
+			found = true
+		}
+		if providers[i].Enabled {
+			enabledCount++
+		}
+	}
+	if !found {
+		ps.mu.Unlock()
+		return fmt.Errorf("未找到 ID 为 %d 的供应商", id)
+	}
+	if err := ps.saveProvidersLocked(kind, providers); err != nil {
+		ps.mu.Unlock()
+		return err
+	}
+	proxy := ps.proxies[strings.ToLower(kind)]
+	ps.mu.Unlock()
+
+	if !enabled {
+		if enabledCount == 0 {
+			fmt.Printf("[WARN] %s 已没有启用的供应商，经由 relay 的请求将无法路由\n", kind)
+		}
+		return nil
+	}
+	if enabledCount != 1 || proxy == nil {
+		return nil
+	}
+
+	status, err := proxy.ProxyStatus()
+	if err != nil {
+		return fmt.Errorf("读取 %s 代理状态失败: %w", kind, err)
+	}
+	if status.Enabled {
+		return nil
+	}
+	if err := proxy.EnableProxy(); err != nil {
+		return fmt.Errorf("启用 %s 代理失败: %w", kind, err)
+	}
+	fmt.Printf("[INFO] %s 首个供应商已启用，CLI 配置已指向 relay\n", kind)
+	return nil
+}
+
+// snapshotLocked 返回缓存的 provider 列表（首次读取配置文件），调用方需持有 ps.mu，不得修改返回值
+func (ps *ProviderService) snapshotLocked(kind string) []Provider {
+	if providers, ok := ps.snapshots[kind]; ok {
+		return providers
+	}
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return nil
+	}
+	if ps.snapshots == nil {
+		ps.snapshots = make(map[string][]Provider)
+	}
+	ps.snapshots[kind] = providers
+	return providers
+}
+
+// providerNotes 返回 provider 名称到备注的映射，platform 为空时合并 claude 与 codex
+// 统计和黑名单状态查询使用缓存的 provider 列表，不必每次读取配置文件；ps 为 nil 时返回空映射
+func (ps *ProviderService) providerNotes(platform string) map[string]string {
+	notes := make(map[string]string)
+	if ps == nil {
+		return notes
+	}
+	kinds := []string{"claude", "codex"}
+	if platform != "" {
+		kinds = []string{platform}
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, kind := range kinds {
+		for _, p := range ps.snapshotLocked(kind) {
+			if p.Note != "" {
+				notes[p.Name] = p.Note
+			}
+		}
+	}
+	return notes
+}
+
 // IsModelSupported 检查 provider 是否支持指定的模型
 // 支持条件：1) 模型在 SupportedModels 中（精确或通配符匹配）
-//          2) 模型在 ModelMapping 的 key 中（精确或通配符匹配）
+//  2. 模型在 ModelMapping 的 key 中（精确或通配符匹配）
 func (p *Provider) IsModelSupported(modelName string) bool {
 	// 向后兼容：如果未配置白名单和映射，假设支持所有模型
 	if (p.SupportedModels == nil || len(p.SupportedModels) == 0) &&
@@ -229,32 +554,14 @@ func (p *Provider) IsModelSupported(modelName string) bool {
 		return true
 	}
 
-	// 场景 A：Provider 原生支持该模型（精确匹配）
-	if p.SupportedModels != nil && p.SupportedModels[modelName] {
+	// 场景 A：Provider 原生支持该模型（精确或通配符匹配）
+	if p.supportsNativeModel(modelName) {
 		return true
 	}
 
-	// 场景 A+：Provider 原生支持该模型（通配符匹配）
-	if p.SupportedModels != nil {
-		for supportedModel := range p.SupportedModels {
-			if matchWildcard(supportedModel, modelName) {
-				return true
-			}
-		}
-	}
-
-	// 场景 B：Provider 通过映射支持该模型（精确匹配）
-	if p.ModelMapping != nil {
-		if _, exists := p.ModelMapping[modelName]; exists {
-			return true
-		}
-
-		// 场景 B+：通过通配符映射支持
-		for pattern := range p.ModelMapping {
-			if matchWildcard(pattern, modelName) {
-				return true
-			}
-		}
+	// 场景 B：Provider 通过映射支持该模型（精确或通配符匹配）
+	if _, ok := lookupModelMapping(p.ModelMapping, modelName, p.CaseSensitiveModels); ok {
+		return true
 	}
 
 	// 场景 C：不支持
@@ -264,24 +571,48 @@ func (p *Provider) IsModelSupported(modelName string) bool {
 // GetEffectiveModel 获取实际应该使用的模型名
 // 如果存在映射（精确或通配符），返回映射后的模型名；否则返回原模型名
 func (p *Provider) GetEffectiveModel(requestedModel string) string {
-	if p.ModelMapping == nil || len(p.ModelMapping) == 0 {
-		return requestedModel
-	}
-
-	// 优先查找精确映射
-	if mappedModel, exists := p.ModelMapping[requestedModel]; exists {
+	if mappedModel, ok := lookupModelMapping(p.ModelMapping, requestedModel, p.CaseSensitiveModels); ok {
 		return mappedModel
 	}
 
-	// 查找通配符映射
-	for pattern, replacement := range p.ModelMapping {
-		if matchWildcard(pattern, requestedModel) {
-			return applyWildcardMapping(pattern, replacement, requestedModel)
+	// 无映射，返回原模型名
+	return requestedModel
+}
+
+// lookupModelMapping 在映射表中查找模型，优先精确映射，其次通配符映射
+// caseSensitive 为 false 时忽略大小写；两种情况都忽略首尾空白。返回映射表中配置的目标模型名（不做规范化）
+func lookupModelMapping(mapping map[string]string, requestedModel string, caseSensitive bool) (string, bool) {
+	if mappedModel, exists := mapping[requestedModel]; exists {
+		return mappedModel, true
+	}
+	key := normalizeModelName(requestedModel, caseSensitive)
+	for external, internal := range mapping {
+		if !strings.Contains(external, "*") && normalizeModelName(external, caseSensitive) == key {
+			return internal, true
+		}
+	}
+	for pattern, replacement := range mapping {
+		if !strings.Contains(pattern, "*") {
+			continue
+		}
+		if captures, ok := modelWildcardCaptures(pattern, requestedModel, caseSensitive); ok {
+			return fillWildcards(replacement, captures), true
 		}
 	}
+	return "", false
+}
 
-	// 无映射，返回原模型名
-	return requestedModel
+// supportsNativeModel 检查模型是否在 SupportedModels 中（精确或通配符匹配）
+func (p *Provider) supportsNativeModel(model string) bool {
+	if p.SupportedModels[model] {
+		return true
+	}
+	for supportedPattern := range p.SupportedModels {
+		if _, ok := modelWildcardCaptures(supportedPattern, model, p.CaseSensitiveModels); ok {
+			return true
+		}
+	}
+	return false
 }
 
 // ValidateConfiguration 验证 provider 的模型配置
@@ -298,21 +629,8 @@ func (p *Provider) ValidateConfiguration() []string {
 				continue
 			}
 
-			// 精确映射需要验证
-			supported := false
-			if p.SupportedModels[internalModel] {
-				supported = true
-			} else {
-				// 检查通配符白名单
-				for supportedPattern := range p.SupportedModels {
-					if matchWildcard(supportedPattern, internalModel) {
-						supported = true
-						break
-					}
-				}
-			}
-
-			if !supported {
+			// 精确映射需要验证（含通配符白名单）
+			if !p.supportsNativeModel(internalModel) {
 				errors = append(errors, fmt.Sprintf(
 					"模型映射无效：'%s' -> '%s'，目标模型 '%s' 不在 supportedModels 中",
 					externalModel, internalModel, internalModel,
@@ -341,56 +659,164 @@ func (p *Provider) ValidateConfiguration() []string {
 		}
 	}
 
+	// 规则 4：输入 token 范围必须合法
+	if p.MinInputTokens < 0 || p.MaxInputTokens < 0 {
+		errors = append(errors, "输入 token 范围不能为负数")
+	} else if p.MaxInputTokens > 0 && p.MinInputTokens > p.MaxInputTokens {
+		errors = append(errors, fmt.Sprintf(
+			"输入 token 范围无效：minInputTokens (%d) 大于 maxInputTokens (%d)",
+			p.MinInputTokens, p.MaxInputTokens,
+		))
+	}
+
+	// 规则 5：请求体改写规则必须合法
+	errors = append(errors, validateBodyOverrides(p.BodyOverrides)...)
+
+	// 规则 6：维护窗口必须合法
+	errors = append(errors, validateMaintenanceWindows(p.MaintenanceWindows)...)
+
+	// 规则 7：客户端专属模型映射必须合法
+	errors = append(errors, validateClientModelMapping(p)...)
+
+	// 规则 8：Host 头 / SNI 覆盖必须合法
+	errors = append(errors, validateUpstreamOverride(p)...)
+
+	// 规则 9：阶梯计价档位必须合法
+	errors = append(errors, validatePricingTiers(p.PricingTiers)...)
+
+	// 规则 10：超时时间不能为负数
+	if p.TimeoutSeconds < 0 {
+		errors = append(errors, "timeoutSeconds 不能为负数")
+	}
+
+	// 规则 11：鉴权方式必须是已知取值
+	errors = append(errors, validateAuthScheme(*p)...)
+
+	// 规则 12：并发上限与等待时间不能为负数
+	if p.MaxConcurrent < 0 {
+		errors = append(errors, "maxConcurrent 不能为负数")
+	}
+	if p.MaxConcurrentWaitSeconds < 0 {
+		errors = append(errors, "maxConcurrentWaitSeconds 不能为负数")
+	}
+
+	// 规则 13：权重不能为负数
+	if p.Weight != nil && *p.Weight < 0 {
+		errors = append(errors, "weight 不能为负数")
+	}
+
+	// 规则 14：自定义请求头必须合法
+	errors = append(errors, validateProviderHeaders(p.Headers)...)
+
+	// 规则 15：apiUrl 必须是 http/https 地址
+	errors = append(errors, validateAPIURL(p.APIURL)...)
+
 	p.configErrors = errors
 	return errors
 }
 
+// HasAnyTag 检查 provider 是否带有任一标签（不区分大小写）
+func (p *Provider) HasAnyTag(tags []string) bool {
+	for _, tag := range tags {
+		for _, own := range p.Tags {
+			if strings.EqualFold(strings.TrimSpace(own), tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AcceptsInputTokens 检查估算的输入 token 数是否在 provider 配置的范围内
+func (p *Provider) AcceptsInputTokens(tokens int) bool {
+	if p.MinInputTokens > 0 && tokens < p.MinInputTokens {
+		return false
+	}
+	if p.MaxInputTokens > 0 && tokens > p.MaxInputTokens {
+		return false
+	}
+	return true
+}
+
+
 // matchWildcard 通配符匹配函数
-// 支持 * 通配符，如 "claude-*" 匹配 "claude-sonnet-4"
+// 支持任意个 * 通配符，如 "claude-*" 匹配 "claude-sonnet-4"，"*-sonnet-*" 匹配 "claude-3-sonnet-4"
 func matchWildcard(pattern, text string) bool {
 	// 如果没有通配符，使用精确匹配
 	if !strings.Contains(pattern, "*") {
 		return pattern == text
 	}
+	_, ok := wildcardCaptures(pattern, text)
+	return ok
+}
 
-	// 简化实现：只支持单个 * 通配符
+// wildcardCaptures 匹配 pattern 并按从左到右的顺序返回每个 * 匹配到的部分
+// 与正则的贪婪匹配一致：靠左的 * 尽可能多地匹配，例如 "*-*" 匹配 "a-b-c" 得到 ["a-b", "c"]
+func wildcardCaptures(pattern, text string) ([]string, bool) {
 	parts := strings.Split(pattern, "*")
+	prefix, suffix := parts[0], parts[len(parts)-1]
+	if len(text) < len(prefix)+len(suffix) || !strings.HasPrefix(text, prefix) || !strings.HasSuffix(text, suffix) {
+		return nil, false
+	}
+	rest := text[len(prefix) : len(text)-len(suffix)]
+
+	// 单个 *：前缀和后缀之间的部分即为匹配结果
 	if len(parts) == 2 {
-		// 前缀 + * 或 * + 后缀
-		prefix, suffix := parts[0], parts[1]
-		return strings.HasPrefix(text, prefix) && strings.HasSuffix(text, suffix)
+		return []string{rest}, true
 	}
 
-	// 多个 * 的情况（更复杂，暂不支持）
-	return false
+	// 多个 *：从右往左依次取中间片段最靠右的位置，使靠左的 * 匹配得尽可能长
+	middles := parts[1 : len(parts)-1]
+	captures := make([]string, len(parts)-1)
+	end := len(rest)
+	for i := len(middles) - 1; i >= 0; i-- {
+		idx := strings.LastIndex(rest[:end], middles[i])
+		if idx < 0 {
+			return nil, false
+		}
+		captures[i+1] = rest[idx+len(middles[i]) : end]
+		end = idx
+	}
+	captures[0] = rest[:end]
+	return captures, true
 }
 
 // applyWildcardMapping 应用通配符映射
-// 将 pattern 中的 * 匹配部分替换到 replacement 的 * 位置
+// 将 pattern 中每个 * 匹配的部分按从左到右的顺序依次替换到 replacement 的 * 位置
+// replacement 中多出的 * 保持原样，pattern 中多出的匹配部分被忽略
 // 示例: pattern="claude-*", replacement="anthropic/claude-*", input="claude-sonnet-4"
-//      输出: "anthropic/claude-sonnet-4"
+//
+//	输出: "anthropic/claude-sonnet-4"
 func applyWildcardMapping(pattern, replacement, input string) string {
 	// 如果 pattern 或 replacement 没有通配符，直接返回 replacement
 	if !strings.Contains(pattern, "*") || !strings.Contains(replacement, "*") {
 		return replacement
 	}
 
-	// 提取通配符匹配的部分
-	parts := strings.Split(pattern, "*")
-	if len(parts) != 2 {
-		return replacement // 不支持多个通配符
+	// 提取通配符匹配的部分，input 不匹配 pattern 时直接返回 replacement
+	captures, ok := wildcardCaptures(pattern, input)
+	if !ok {
+		return replacement
 	}
 
-	prefix, suffix := parts[0], parts[1]
+	return fillWildcards(replacement, captures)
+}
 
-	// 验证 input 确实匹配 pattern
-	if !strings.HasPrefix(input, prefix) || !strings.HasSuffix(input, suffix) {
+// fillWildcards 将 captures 按从左到右的顺序依次填入 replacement 的 *，多出的 * 保持原样
+func fillWildcards(replacement string, captures []string) string {
+	if !strings.Contains(replacement, "*") {
 		return replacement
 	}
-
-	// 提取中间部分
-	wildcardPart := input[len(prefix) : len(input)-len(suffix)]
-
-	// 替换 replacement 中的 *
-	return strings.Replace(replacement, "*", wildcardPart, 1)
+	var b strings.Builder
+	for i, segment := range strings.Split(replacement, "*") {
+		if i > 0 {
+			if i-1 < len(captures) {
+				b.WriteString(captures[i-1])
+			} else {
+				b.WriteString("*")
+			}
+		}
+		b.WriteString(segment)
+	}
+	return b.String()
 }
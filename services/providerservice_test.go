@@ -2,7 +2,10 @@ package services
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 )
 
@@ -102,6 +105,56 @@ func TestMatchWildcard(t *testing.T) {
 			text:     "claude-",
 			expected: true,
 		},
+		{
+			name:     "前缀与后缀重叠",
+			pattern:  "claude-*-4",
+			text:     "claude-4",
+			expected: false,
+		},
+
+		// 多个通配符
+		{
+			name:     "两个通配符-成功",
+			pattern:  "*-sonnet-*",
+			text:     "claude-3-sonnet-4",
+			expected: true,
+		},
+		{
+			name:     "两个通配符-失败",
+			pattern:  "*-sonnet-*",
+			text:     "claude-opus-4",
+			expected: false,
+		},
+		{
+			name:     "两个通配符-带前缀",
+			pattern:  "anthropic/*/v*",
+			text:     "anthropic/claude/v4",
+			expected: true,
+		},
+		{
+			name:     "三个通配符-成功",
+			pattern:  "*/*-*",
+			text:     "openrouter/claude-sonnet-4",
+			expected: true,
+		},
+		{
+			name:     "三个通配符-缺少中间片段",
+			pattern:  "*/*-*",
+			text:     "openrouter-claude",
+			expected: false,
+		},
+		{
+			name:     "相邻通配符",
+			pattern:  "claude-**",
+			text:     "claude-sonnet",
+			expected: true,
+		},
+		{
+			name:     "中间片段顺序不符",
+			pattern:  "*-b-*-a-*",
+			text:     "x-a-y-b-z",
+			expected: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -174,6 +227,64 @@ func TestApplyWildcardMapping(t *testing.T) {
 			input:       "claude-",
 			expected:    "anthropic/claude-",
 		},
+		{
+			name:        "不匹配-前缀与后缀重叠",
+			pattern:     "claude-*-4",
+			replacement: "anthropic/claude-*-v4",
+			input:       "claude-4",
+			expected:    "anthropic/claude-*-v4",
+		},
+
+		// 多个通配符：按从左到右的顺序依次替换
+		{
+			name:        "两个通配符映射",
+			pattern:     "*-sonnet-*",
+			replacement: "anthropic/*-sonnet-*",
+			input:       "claude-3-sonnet-4",
+			expected:    "anthropic/claude-3-sonnet-4",
+		},
+		{
+			name:        "两个通配符映射-调换顺序",
+			pattern:     "anthropic/*/v*",
+			replacement: "*-v*",
+			input:       "anthropic/claude/v4",
+			expected:    "claude-v4",
+		},
+		{
+			name:        "两个通配符映射-靠左贪婪",
+			pattern:     "*-*",
+			replacement: "*/*",
+			input:       "a-b-c",
+			expected:    "a-b/c",
+		},
+		{
+			name:        "三个通配符映射",
+			pattern:     "*/*-*",
+			replacement: "*:*:*",
+			input:       "openrouter/claude-sonnet-4",
+			expected:    "openrouter:claude-sonnet:4",
+		},
+		{
+			name:        "相邻通配符映射",
+			pattern:     "claude-**",
+			replacement: "x-*-*",
+			input:       "claude-sonnet",
+			expected:    "x-sonnet-",
+		},
+		{
+			name:        "replacement 通配符较少",
+			pattern:     "*-sonnet-*",
+			replacement: "sonnet-*",
+			input:       "claude-3-sonnet-4",
+			expected:    "sonnet-claude-3",
+		},
+		{
+			name:        "replacement 通配符较多",
+			pattern:     "claude-*",
+			replacement: "*-*",
+			input:       "claude-sonnet",
+			expected:    "sonnet-*",
+		},
 	}
 
 	for _, tt := range tests {
@@ -406,6 +517,65 @@ func TestProvider_GetEffectiveModel(t *testing.T) {
 	}
 }
 
+func TestProvider_GetEffectiveModelForClient(t *testing.T) {
+	provider := Provider{
+		ModelMapping: map[string]string{
+			"claude-sonnet-4": "default-model",
+		},
+		ClientModelMapping: map[string]map[string]string{
+			"claude-cli": {"claude-sonnet-4": "cli-model"},
+			"batch-job":  {"claude-*": "batch/claude-*"},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		client         requestClient
+		requestedModel string
+		expected       string
+	}{
+		{
+			name:           "无客户端信息-默认映射",
+			requestedModel: "claude-sonnet-4",
+			expected:       "default-model",
+		},
+		{
+			name:           "User-Agent 匹配-专属映射",
+			client:         requestClient{UserAgent: "claude-cli/1.0.83 (external, cli)"},
+			requestedModel: "claude-sonnet-4",
+			expected:       "cli-model",
+		},
+		{
+			name:           "X-Client-Id 匹配-通配符专属映射",
+			client:         requestClient{ID: "Batch-Job", UserAgent: "claude-cli/1.0.83"},
+			requestedModel: "claude-sonnet-4",
+			expected:       "batch/claude-sonnet-4",
+		},
+		{
+			name:           "专属映射未命中-回退默认映射",
+			client:         requestClient{UserAgent: "claude-cli/1.0.83"},
+			requestedModel: "claude-opus-4",
+			expected:       "claude-opus-4",
+		},
+		{
+			name:           "未知客户端-默认映射",
+			client:         requestClient{ID: "other-script", UserAgent: "python-requests/2.31"},
+			requestedModel: "claude-sonnet-4",
+			expected:       "default-model",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := provider.GetEffectiveModelForClient(tt.requestedModel, tt.client)
+			if result != tt.expected {
+				t.Errorf("GetEffectiveModelForClient(%q, %+v) = %q, 期望 %q",
+					tt.requestedModel, tt.client, result, tt.expected)
+			}
+		})
+	}
+}
+
 // ==================== ValidateConfiguration 测试 ====================
 
 func TestProvider_ValidateConfiguration(t *testing.T) {
@@ -419,7 +589,8 @@ func TestProvider_ValidateConfiguration(t *testing.T) {
 		{
 			name: "有效配置-完整",
 			provider: Provider{
-				Name: "test-provider",
+				Name:   "test-provider",
+				APIURL: "https://api.example.com",
 				SupportedModels: map[string]bool{
 					"model-a":          true,
 					"internal-model-b": true,
@@ -480,7 +651,8 @@ func TestProvider_ValidateConfiguration(t *testing.T) {
 		{
 			name: "通配符映射-跳过验证",
 			provider: Provider{
-				Name: "test-provider",
+				Name:   "test-provider",
+				APIURL: "https://api.example.com",
 				SupportedModels: map[string]bool{
 					"anthropic/claude-*": true,
 				},
@@ -490,6 +662,44 @@ func TestProvider_ValidateConfiguration(t *testing.T) {
 			},
 			expectErrors: false,
 		},
+
+		// apiUrl 格式
+		{
+			name:          "无效地址-缺少协议",
+			provider:      Provider{Name: "test-provider", APIURL: "api.example.com/v1"},
+			expectErrors:  true,
+			errorContains: "必须以 http:// 或 https:// 开头",
+		},
+		{
+			name:          "无效地址-不支持的协议",
+			provider:      Provider{Name: "test-provider", APIURL: "ftp://api.example.com"},
+			expectErrors:  true,
+			errorContains: "必须以 http:// 或 https:// 开头",
+		},
+		{
+			name:          "无效地址-缺少主机名",
+			provider:      Provider{Name: "test-provider", APIURL: "https:///v1"},
+			expectErrors:  true,
+			errorContains: "缺少主机名",
+		},
+		{
+			name:          "无效地址-首尾空白",
+			provider:      Provider{Name: "test-provider", APIURL: " https://api.example.com"},
+			expectErrors:  true,
+			errorContains: "空白字符",
+		},
+		{
+			name:          "无效地址-为空",
+			provider:      Provider{Name: "test-provider"},
+			expectErrors:  true,
+			errorContains: "apiUrl 不能为空",
+		},
+		{
+			// 路径中已包含接口路径只在保存时警告，不视为错误
+			name:         "有效地址-路径包含接口路径",
+			provider:     Provider{Name: "test-provider", APIURL: "http://127.0.0.1:8080/v1/messages"},
+			expectErrors: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -520,6 +730,23 @@ func TestProvider_ValidateConfiguration(t *testing.T) {
 	}
 }
 
+func TestAPIURLWarnings(t *testing.T) {
+	cases := map[string]bool{
+		"https://api.example.com":                false,
+		"https://api.example.com/v1":             false,
+		"https://api.example.com/v1/messages":    true,
+		"https://api.example.com/v1/messages/":   true,
+		"https://api.openai.com/v1/responses":    true,
+		"https://gateway.example.com/anthropic/": false,
+	}
+	for apiURL, expectWarning := range cases {
+		warnings := apiURLWarnings(Provider{Name: "p", APIURL: apiURL})
+		if (len(warnings) > 0) != expectWarning {
+			t.Errorf("apiUrl %q 期望警告=%v, 实际 %v", apiURL, expectWarning, warnings)
+		}
+	}
+}
+
 // ==================== Level 分组测试 ====================
 
 func TestProviderLevelGrouping(t *testing.T) {
@@ -845,3 +1072,167 @@ func TestDuplicateProvider(t *testing.T) {
 		})
 	}
 }
+
+// ==================== 配置文件版本迁移测试 ====================
+
+func TestLoadProvidersMigratesV0(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	dir := filepath.Join(home, ".code-switch")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("创建配置目录失败: %v", err)
+	}
+
+	// v0 文件：无 schemaVersion，Level 缺省，映射带空白
+	legacy := `{
+  "providers": [
+    {
+      "id": 1,
+      "name": "Legacy",
+      "apiUrl": "https://api.example.com",
+      "apiKey": "sk-legacy",
+      "enabled": true,
+      "supportedModels": {" claude-sonnet-4 ": true, "": true, "disabled-model": false},
+      "modelMapping": {" claude-* ": " anthropic/claude-* ", "empty": ""}
+    }
+  ]
+}`
+	path := filepath.Join(dir, "claude-code.json")
+	if err := os.WriteFile(path, []byte(legacy), 0o644); err != nil {
+		t.Fatalf("写入 v0 配置失败: %v", err)
+	}
+
+	ps := NewProviderService()
+	providers, err := ps.LoadProviders("claude")
+	if err != nil {
+		t.Fatalf("加载 v0 配置失败: %v", err)
+	}
+	if len(providers) != 1 {
+		t.Fatalf("期望 1 个 provider，实际 %d", len(providers))
+	}
+
+	p := providers[0]
+	if p.Level != 1 {
+		t.Errorf("期望迁移后 Level = 1，实际 %d", p.Level)
+	}
+	if len(p.SupportedModels) != 1 || !p.SupportedModels["claude-sonnet-4"] {
+		t.Errorf("SupportedModels 未正确规范化: %v", p.SupportedModels)
+	}
+	if len(p.ModelMapping) != 1 || p.ModelMapping["claude-*"] != "anthropic/claude-*" {
+		t.Errorf("ModelMapping 未正确规范化: %v", p.ModelMapping)
+	}
+
+	// 文件应已回写为当前版本
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("读取回写文件失败: %v", err)
+	}
+	var envelope providerEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		t.Fatalf("解析回写文件失败: %v", err)
+	}
+	if envelope.SchemaVersion != providerSchemaVersion {
+		t.Errorf("期望回写 schemaVersion = %d，实际 %d", providerSchemaVersion, envelope.SchemaVersion)
+	}
+}
+
+func TestSaveProvidersRefusesNewerSchema(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	dir := filepath.Join(home, ".code-switch")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("创建配置目录失败: %v", err)
+	}
+	newer := `{"schemaVersion": 99, "providers": [{"id": 1, "name": "Future", "apiUrl": "https://api.example.com", "level": 1, "futureField": true}]}`
+	path := filepath.Join(dir, "claude-code.json")
+	if err := os.WriteFile(path, []byte(newer), 0o644); err != nil {
+		t.Fatalf("写入配置失败: %v", err)
+	}
+
+	ps := NewProviderService()
+	providers, err := ps.LoadProviders("claude")
+	if err != nil || len(providers) != 1 || providers[0].Name != "Future" {
+		t.Fatalf("更新版本的配置应可只读加载: %+v, %v", providers, err)
+	}
+	if err := ps.SaveProviders("claude", providers); err == nil || !strings.Contains(err.Error(), "schema v99") {
+		t.Fatalf("更新版本的配置应拒绝保存, err = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != newer {
+		t.Fatalf("拒绝保存时不应修改文件: %s", data)
+	}
+}
+
+func TestDuplicateProviderKeepsNote(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "personal", APIURL: "https://api.example.com", APIKey: "sk-1", Enabled: true, Note: "个人 key，每日 5M 限额"},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	cloned, err := ps.DuplicateProvider("claude", 1)
+	if err != nil {
+		t.Fatalf("复制 provider 失败: %v", err)
+	}
+	if cloned.Note != "个人 key，每日 5M 限额" {
+		t.Fatalf("副本备注 = %q", cloned.Note)
+	}
+
+	providers, err := ps.LoadProviders("claude")
+	if err != nil || len(providers) != 2 {
+		t.Fatalf("加载 provider 失败: %v (%d 个)", err, len(providers))
+	}
+	if notes := ps.providerNotes("claude"); notes["personal"] == "" || notes[cloned.Name] == "" {
+		t.Fatalf("providerNotes 应返回所有备注: %v", notes)
+	}
+
+	// 缓存在保存后失效
+	providers[0].Note = "团队 key"
+	if err := ps.SaveProviders("claude", providers); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	if notes := ps.providerNotes(""); notes["personal"] != "团队 key" {
+		t.Fatalf("保存后应返回新的备注: %v", notes)
+	}
+}
+
+func TestToggleProviderEnablesProxy(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	ps := NewProviderService()
+	claude := NewClaudeSettingsService(":18100")
+	ps.BindProxySettings(claude, NewCodexSettingsService(":18100"))
+
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "a", APIURL: "https://a.example.com", APIKey: "k", Level: 1},
+		{ID: 2, Name: "b", APIURL: "https://b.example.com", APIKey: "k", Level: 1},
+	}); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+
+	if err := ps.ToggleProvider("claude", 1, true); err != nil {
+		t.Fatalf("启用失败: %v", err)
+	}
+	status, err := claude.ProxyStatus()
+	if err != nil || !status.Enabled {
+		t.Fatalf("启用首个供应商后应开启代理: %+v, %v", status, err)
+	}
+
+	if err := ps.ToggleProvider("claude", 1, false); err != nil {
+		t.Fatalf("禁用失败: %v", err)
+	}
+	providers, _ := ps.LoadProviders("claude")
+	if providers[0].Enabled || providers[1].Enabled {
+		t.Fatalf("禁用后不应有启用的供应商: %+v", providers)
+	}
+
+	if err := ps.ToggleProvider("claude", 99, true); err == nil {
+		t.Fatalf("不存在的 ID 应返回错误")
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QuickSwitchItem 托盘快速切换菜单中的一个供应商
+type QuickSwitchItem struct {
+	Platform string `json:"platform"` // claude / codex
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Level    int    `json:"level"`
+	Active   bool   `json:"active"` // relay 当前优先使用的供应商
+}
+
+// BindAppSettings 关联应用设置，GetQuickSwitchMenu 据此决定展示哪些平台
+func (ps *ProviderService) BindAppSettings(appSettings *AppSettingsService) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.appSettings = appSettings
+}
+
+// GetQuickSwitchMenu 按平台返回已启用的供应商，供托盘快速切换菜单使用
+func (ps *ProviderService) GetQuickSwitchMenu() ([]QuickSwitchItem, error) {
+	ps.mu.Lock()
+	appSettings := ps.appSettings
+	ps.mu.Unlock()
+
+	platforms := []string{"claude", "codex"}
+	if appSettings != nil {
+		settings, err := appSettings.GetAppSettings()
+		if err != nil {
+			return nil, fmt.Errorf("读取应用设置失败: %w", err)
+		}
+		platforms = settings.TrayQuickSwitchPlatforms
+	}
+
+	items := make([]QuickSwitchItem, 0)
+	for _, platform := range platforms {
+		platform = strings.ToLower(strings.TrimSpace(platform))
+		if platform != "claude" && platform != "codex" {
+			continue
+		}
+		providers, err := ps.LoadProviders(platform)
+		if err != nil {
+			return nil, fmt.Errorf("加载 %s 供应商失败: %w", platform, err)
+		}
+		activeID, hasActive := activeProviderID(providers)
+		for _, p := range providers {
+			if !p.Enabled {
+				continue
+			}
+			items = append(items, QuickSwitchItem{
+				Platform: platform,
+				ID:       p.ID,
+				Name:     p.Name,
+				Level:    normalizedLevel(p.Level),
+				Active:   hasActive && p.ID == activeID,
+			})
+		}
+	}
+	return items, nil
+}
+
+// SetActiveProvider 将指定供应商设为 relay 优先使用的供应商：
+// 启用它、提升到当前最高优先级的 Level 并移到列表最前，其余供应商继续作为降级备选
+// 若该 Level 还有其他已启用的供应商，只把它们下移一级（Level 已是 10 时改为把目标上移一级），避免与目标同组轮询；
+// 其余供应商的 Level 不变，始终保持在 1-10 内
+func (ps *ProviderService) SetActiveProvider(kind string, id int64) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return fmt.Errorf("加载供应商配置失败: %w", err)
+	}
+
+	index := -1
+	topLevel := 0
+	for i, p := range providers {
+		if p.ID == id {
+			index = i
+			continue
+		}
+		if p.Enabled {
+			if level := normalizedLevel(p.Level); topLevel == 0 || level < topLevel {
+				topLevel = level
+			}
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("未找到 ID 为 %d 的供应商", id)
+	}
+
+	target := providers[index]
+	target.Enabled = true
+	if topLevel == 0 || normalizedLevel(target.Level) < topLevel {
+		topLevel = normalizedLevel(target.Level)
+	}
+	target.Level = topLevel
+
+	var peers []int
+	for i, p := range providers {
+		if i != index && p.Enabled && normalizedLevel(p.Level) == topLevel {
+			peers = append(peers, i)
+		}
+	}
+	if len(peers) > 0 {
+		if topLevel < autoLevelMaxLevel {
+			for _, i := range peers {
+				providers[i].Level = topLevel + 1
+			}
+		} else {
+			target.Level = topLevel - 1
+		}
+	}
+
+	reordered := make([]Provider, 0, len(providers))
+	reordered = append(reordered, target)
+	reordered = append(reordered, providers[:index]...)
+	reordered = append(reordered, providers[index+1:]...)
+
+	if err := ps.saveProvidersLocked(kind, reordered); err != nil {
+		return err
+	}
+	fmt.Printf("[INFO] %s 已切换到供应商: %s (Level %d)\n", kind, target.Name, target.Level)
+	return nil
+}
+
+// activeProviderID 返回 relay 按 Level 和列表顺序优先选择的已启用供应商
+func activeProviderID(providers []Provider) (int64, bool) {
+	var (
+		activeID  int64
+		bestLevel int
+		found     bool
+	)
+	for _, p := range providers {
+		if !p.Enabled {
+			continue
+		}
+		if level := normalizedLevel(p.Level); !found || level < bestLevel {
+			activeID, bestLevel, found = p.ID, level, true
+		}
+	}
+	return activeID, found
+}
@@ -0,0 +1,126 @@
+package services
+
+import "testing"
+
+func TestSetActiveProviderPromotesToFront(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "primary", APIURL: "https://a.example.com", Enabled: true, Level: 1},
+		{ID: 2, Name: "backup", APIURL: "https://b.example.com", Enabled: true, Level: 3},
+		{ID: 3, Name: "off", APIURL: "https://c.example.com", Enabled: false, Level: 2},
+	}); err != nil {
+		t.Fatalf("save providers: %v", err)
+	}
+
+	items, err := ps.GetQuickSwitchMenu()
+	if err != nil {
+		t.Fatalf("GetQuickSwitchMenu: %v", err)
+	}
+	if len(items) != 2 || !items[0].Active || items[1].Active {
+		t.Fatalf("unexpected menu before switch: %+v", items)
+	}
+
+	if err := ps.SetActiveProvider("claude", 2); err != nil {
+		t.Fatalf("SetActiveProvider: %v", err)
+	}
+	providers, err := ps.LoadProviders("claude")
+	if err != nil {
+		t.Fatalf("load providers: %v", err)
+	}
+	if providers[0].ID != 2 || providers[0].Level != 1 || len(providers) != 3 {
+		t.Fatalf("provider 2 not promoted: %+v", providers)
+	}
+
+	items, err = ps.GetQuickSwitchMenu()
+	if err != nil {
+		t.Fatalf("GetQuickSwitchMenu: %v", err)
+	}
+	for _, item := range items {
+		if item.Active != (item.ID == 2) {
+			t.Fatalf("unexpected active item after switch: %+v", items)
+		}
+	}
+
+	if err := ps.SetActiveProvider("claude", 99); err == nil {
+		t.Fatal("expected error for unknown provider")
+	}
+}
+
+func TestSetActiveProviderLeavesSameLevelRotation(t *testing.T) {
+	setupTestEnv(t)
+	relay, _ := newTestRelay(t)
+	ps := relay.providerService
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "a", APIURL: "https://a.example.com", APIKey: "sk", Enabled: true, Level: 1},
+		{ID: 2, Name: "b", APIURL: "https://b.example.com", APIKey: "sk", Enabled: true, Level: 1},
+		{ID: 3, Name: "backup", APIURL: "https://backup.example.com", APIKey: "sk", Enabled: true, Level: 2},
+	}); err != nil {
+		t.Fatalf("save providers: %v", err)
+	}
+
+	if err := ps.SetActiveProvider("claude", 2); err != nil {
+		t.Fatalf("SetActiveProvider: %v", err)
+	}
+	providers, err := ps.LoadProviders("claude")
+	if err != nil {
+		t.Fatalf("load providers: %v", err)
+	}
+	levels := map[string]int{}
+	for _, p := range providers {
+		levels[p.Name] = p.Level
+	}
+	if levels["b"] != 1 || levels["a"] != 2 || levels["backup"] != 2 {
+		t.Fatalf("only peers at the top level should shift down: %v", levels)
+	}
+
+	for i := 0; i < 3; i++ {
+		provider, _, _, ok := relay.pickProvider("claude", "claude-sonnet-4", 0, providers)
+		if !ok || provider.Name != "b" {
+			t.Fatalf("relay should keep using the switched provider, got %+v", provider)
+		}
+	}
+	items, err := ps.GetQuickSwitchMenu()
+	if err != nil {
+		t.Fatalf("GetQuickSwitchMenu: %v", err)
+	}
+	for _, item := range items {
+		if item.Active != (item.ID == 2) {
+			t.Fatalf("unexpected active item after switch: %+v", items)
+		}
+	}
+}
+
+func TestSetActiveProviderKeepsLevelsInRange(t *testing.T) {
+	setupTestEnv(t)
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "a", APIURL: "https://a.example.com", APIKey: "sk", Enabled: true, Level: 10},
+		{ID: 2, Name: "b", APIURL: "https://b.example.com", APIKey: "sk", Enabled: true, Level: 10},
+		{ID: 3, Name: "disabled", APIURL: "https://c.example.com", APIKey: "sk", Enabled: false, Level: 10},
+	}); err != nil {
+		t.Fatalf("save providers: %v", err)
+	}
+
+	// repeated switching must never push a level past 10 or touch disabled providers
+	for i := 0; i < 12; i++ {
+		if err := ps.SetActiveProvider("claude", int64(i%2+1)); err != nil {
+			t.Fatalf("SetActiveProvider: %v", err)
+		}
+		providers, err := ps.LoadProviders("claude")
+		if err != nil {
+			t.Fatalf("load providers: %v", err)
+		}
+		for _, p := range providers {
+			if p.Level < 1 || p.Level > 10 {
+				t.Fatalf("level out of range after switch: %+v", providers)
+			}
+			if p.Name == "disabled" && p.Level != 10 {
+				t.Fatalf("disabled provider should keep its level: %+v", p)
+			}
+		}
+		if providers[0].ID != int64(i%2+1) || providers[0].Level >= providers[1].Level {
+			t.Fatalf("switched provider should have an exclusive top level: %+v", providers)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+const (
+	// defaultRateLimitCooldown 429 响应没有可用的 Retry-After 时的冷却时长
+	defaultRateLimitCooldown = 30 * time.Second
+	// maxRateLimitCooldown Retry-After 的上限，避免异常值让 provider 长时间不可用
+	maxRateLimitCooldown = time.Hour
+)
+
+// rateLimitedError 上游返回 429：provider 本身可用，只是被限流，按 Retry-After 短时冷却而不计入失败
+type rateLimitedError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("upstream status %d（限流，%s 后重试）", http.StatusTooManyRequests, e.retryAfter)
+}
+
+// parseRetryAfter 解析 Retry-After 头（秒数或 HTTP 日期），缺失或无法解析时使用默认冷却时长
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultRateLimitCooldown
+	}
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		retryAfter = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		retryAfter = at.Sub(now)
+	} else {
+		return defaultRateLimitCooldown
+	}
+	if retryAfter <= 0 {
+		// 时间已过（或为 0）：仍冷却 1 秒，避免立即重复命中限流
+		return time.Second
+	}
+	if retryAfter > maxRateLimitCooldown {
+		return maxRateLimitCooldown
+	}
+	return retryAfter
+}
+
+// RecordRateLimited 记录 provider 被限流：在 retryAfter 时长内跳过该 provider
+// 与 RecordFailure 不同，不增加失败计数和拉黑等级，也不影响等级降级、宽恕计时
+func (bs *BlacklistService) RecordRateLimited(platform string, providerName string, retryAfter time.Duration) error {
+	if !bs.settingsService.IsBlacklistEnabled() {
+		log.Printf("🚫 拉黑功能已关闭，跳过 provider %s/%s 的限流记录", platform, providerName)
+		return nil
+	}
+	if retryAfter <= 0 {
+		retryAfter = defaultRateLimitCooldown
+	}
+
+	db, err := xdb.DB("default")
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	until := bs.clock.Now().Add(retryAfter)
+	if _, err := db.Exec(`
+		INSERT INTO provider_blacklist (platform, provider_name, failure_count, rate_limited_until)
+		VALUES (?, ?, 0, ?)
+		ON CONFLICT(platform, provider_name) DO UPDATE SET
+			rate_limited_until = excluded.rate_limited_until
+	`, platform, providerName, until); err != nil {
+		return fmt.Errorf("记录限流状态失败: %w", err)
+	}
+
+	log.Printf("🐢 Provider %s/%s 被限流，冷却 %s，恢复时间: %s", platform, providerName, retryAfter, until.Format("15:04:05"))
+	return nil
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+// setupTestEnv 使用临时 HOME 和临时 sqlite 数据库，避免污染本机配置
+func setupTestEnv(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	if err := xdb.Inits([]xdb.Config{
+		{
+			Name:   "default",
+			Driver: "sqlite",
+			DSN:    filepath.Join(home, "test.db?cache=shared&mode=rwc&_busy_timeout=10000&_journal_mode=WAL"),
+		},
+	}); err != nil {
+		t.Fatalf("初始化测试数据库失败: %v", err)
+	}
+	if err := ensureRequestLogTable(); err != nil {
+		t.Fatalf("初始化 request_log 表失败: %v", err)
+	}
+	if err := ensureBlacklistTables(); err != nil {
+		t.Fatalf("初始化黑名单表失败: %v", err)
+	}
+}
+
+// newTestRelay 构造一个不监听端口的 relay，并返回其路由
+func newTestRelay(t *testing.T) (*ProviderRelayService, *gin.Engine) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	settings := &SettingsService{}
+	relay := &ProviderRelayService{
+		providerService:  NewProviderService(),
+		blacklistService: NewBlacklistService(settings),
+		settingsService:  settings,
+		coalescer:        newRequestCoalescer(),
+		inflight:         newInflightTracker(),
+		addr:             "127.0.0.1:0",
+		ready:            make(chan struct{}),
+	}
+	relay.blacklistService.BindProviderService(relay.providerService)
+	router := gin.New()
+	relay.registerRoutes(router)
+	return relay, router
+}
+
+func TestCountTokensCoalescing(t *testing.T) {
+	setupTestEnv(t)
+
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(300 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"input_tokens": 42}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "upstream", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	if err := relay.settingsService.SetRequestCoalescingEnabled(true); err != nil {
+		t.Fatalf("开启请求合并失败: %v", err)
+	}
+
+	const n = 8
+	body := `{"model":"claude-sonnet-4","messages":[{"role":"user","content":"hi"}]}`
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	recorders := make([]*httptest.ResponseRecorder, n)
+	for i := 0; i < n; i++ {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			<-start
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(body))
+			router.ServeHTTP(rec, req)
+		}(recorders[i])
+	}
+	close(start)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("上游命中次数 = %d, 期望 1", got)
+	}
+	for i, rec := range recorders {
+		if rec.Code != http.StatusOK {
+			t.Errorf("请求 %d 状态码 = %d, 期望 200", i, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), `"input_tokens": 42`) {
+			t.Errorf("请求 %d 响应体 = %q", i, rec.Body.String())
+		}
+	}
+}
+
+func TestCountTokensCoalescingDisabledByDefault(t *testing.T) {
+	setupTestEnv(t)
+
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		_, _ = w.Write([]byte(`{"input_tokens": 1}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "upstream", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(`{"model":"claude-sonnet-4"}`))
+		router.ServeHTTP(rec, req)
+	}
+
+	if got := atomic.LoadInt32(&hits); got != 2 {
+		t.Fatalf("未开启合并时上游命中次数 = %d, 期望 2", got)
+	}
+}
+
+func TestCoalesceKeyIncludesForwardedHeaders(t *testing.T) {
+	body := []byte(`{"model":"claude-sonnet-4"}`)
+	key := func(header http.Header) string {
+		return coalesceKey("claude", "/v1/messages/count_tokens", "", requestClient{}, header, body)
+	}
+	base := http.Header{"Anthropic-Version": {"2023-06-01"}, "Authorization": {"Bearer a"}}
+
+	if key(base) != key(http.Header{"Anthropic-Version": {"2023-06-01"}, "Authorization": {"Bearer b"}, "X-Api-Key": {"k"}}) {
+		t.Fatalf("只有认证信息不同的请求应可合并")
+	}
+	if key(base) == key(http.Header{"Anthropic-Version": {"2023-06-01"}, "Anthropic-Beta": {"token-counting-2024-11-01"}}) {
+		t.Fatalf("anthropic-beta 不同的请求不应合并")
+	}
+	if key(base) == key(http.Header{"Anthropic-Version": {"2024-01-01"}}) {
+		t.Fatalf("anthropic-version 不同的请求不应合并")
+	}
+}
+
+func TestRequestCoalescerRecoversPanic(t *testing.T) {
+	rc := newRequestCoalescer()
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	results := make([]*coalescedResponse, 2)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _ = rc.Do("claude", "key", func() *coalescedResponse {
+			<-release
+			panic("boom")
+		})
+	}()
+	time.Sleep(20 * time.Millisecond)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[1], _ = rc.Do("claude", "key", func() *coalescedResponse {
+			t.Error("相同 key 的请求不应再次执行")
+			return nil
+		})
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, result := range results {
+		if result == nil || result.status != http.StatusInternalServerError || !strings.Contains(string(result.body), ErrCodeInternal) {
+			t.Fatalf("第 %d 个等待者应得到 500 错误响应: %+v", i, result)
+		}
+	}
+	if _, ok := rc.calls["key"]; ok {
+		t.Fatalf("panic 后应清理在途记录")
+	}
+}
+
+// coalescingRelay 启用请求合并，上游 count_tokens 每次耗时 delay
+func coalescingRelay(t *testing.T, delay time.Duration) (*ProviderRelayService, http.Handler, *int32) {
+	t.Helper()
+	setupTestEnv(t)
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"input_tokens": 42}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "upstream", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	if err := relay.settingsService.SetRequestCoalescingEnabled(true); err != nil {
+		t.Fatalf("开启请求合并失败: %v", err)
+	}
+	return relay, router, &hits
+}
+
+func TestCoalescedFollowerSurvivesLeaderDisconnect(t *testing.T) {
+	_, router, hits := coalescingRelay(t, 300*time.Millisecond)
+	body := `{"model":"claude-sonnet-4","messages":[{"role":"user","content":"hi"}]}`
+
+	leaderCtx, disconnect := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(body)).WithContext(leaderCtx)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	follower := httptest.NewRecorder()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(body))
+		router.ServeHTTP(follower, req)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	disconnect()
+	wg.Wait()
+
+	if follower.Code != http.StatusOK || !strings.Contains(follower.Body.String(), `"input_tokens": 42`) {
+		t.Fatalf("发起者断开后，合并的请求仍应得到上游结果: %d %s", follower.Code, follower.Body.String())
+	}
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Fatalf("上游命中次数 = %d, 期望 1", got)
+	}
+}
+
+func TestCoalescedFollowerRetriesAfterCancel(t *testing.T) {
+	relay, router, hits := coalescingRelay(t, 300*time.Millisecond)
+	body := `{"model":"claude-sonnet-4","messages":[{"role":"user","content":"hi"}]}`
+
+	leader, follower := httptest.NewRecorder(), httptest.NewRecorder()
+	var wg sync.WaitGroup
+	for _, rec := range []*httptest.ResponseRecorder{leader, follower} {
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(body))
+			router.ServeHTTP(rec, req)
+		}(rec)
+		time.Sleep(50 * time.Millisecond)
+	}
+	inflight := relay.GetInflightRequests()
+	if len(inflight) != 1 {
+		t.Fatalf("合并后应只有 1 个进行中的上游请求: %+v", inflight)
+	}
+	if err := relay.CancelRequest(inflight[0].ID); err != nil {
+		t.Fatalf("取消请求失败: %v", err)
+	}
+	wg.Wait()
+
+	if leader.Code != statusRequestCanceled || follower.Code != http.StatusOK {
+		t.Fatalf("被取消的请求应返回 499，仍在等待的请求应单独重试: leader=%d follower=%d %s", leader.Code, follower.Code, follower.Body.String())
+	}
+	if got := atomic.LoadInt32(hits); got != 2 {
+		t.Fatalf("上游命中次数 = %d, 期望 2", got)
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// relayDrainSecondsKey app_settings 中 relay 停止时等待进行中请求的时长配置键（秒）
+	relayDrainSecondsKey = "relay_drain_seconds"
+	// DefaultRelayDrainSeconds 未配置时停止 relay 最多等待 30 秒
+	DefaultRelayDrainSeconds = 30
+	maxRelayDrainSeconds     = 600
+	// relayForceCloseWait 强制关闭后等待处理函数退出（写完请求日志）的时长
+	relayForceCloseWait = 5 * time.Second
+)
+
+// GetRelayDrainSeconds 获取停止 relay 时等待进行中请求完成的时长（秒，未配置时为 30）
+func (ss *SettingsService) GetRelayDrainSeconds() (int, error) {
+	value, found, err := getSettingValue(relayDrainSecondsKey)
+	if err != nil {
+		return 0, err
+	}
+	value = strings.TrimSpace(value)
+	if !found || value == "" {
+		return DefaultRelayDrainSeconds, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 || seconds > maxRelayDrainSeconds {
+		return 0, fmt.Errorf("relay 停止等待时长配置无效: %s", value)
+	}
+	return seconds, nil
+}
+
+// SetRelayDrainSeconds 设置停止 relay 时等待进行中请求完成的时长（0-600 秒，0 表示不等待直接中断）
+func (ss *SettingsService) SetRelayDrainSeconds(seconds int) error {
+	if seconds < 0 || seconds > maxRelayDrainSeconds {
+		return fmt.Errorf("等待时长必须在 0-%d 秒之间", maxRelayDrainSeconds)
+	}
+	return setSettingValue(relayDrainSecondsKey, strconv.Itoa(seconds))
+}
+
+// drainTimeout 停止 relay 时等待进行中请求的时长，读取配置失败时使用默认值
+func (prs *ProviderRelayService) drainTimeout() time.Duration {
+	if prs.settingsService == nil {
+		return DefaultRelayDrainSeconds * time.Second
+	}
+	seconds, err := prs.settingsService.GetRelayDrainSeconds()
+	if err != nil {
+		fmt.Printf("[WARN] %v，使用默认值 %d 秒\n", err, DefaultRelayDrainSeconds)
+		seconds = DefaultRelayDrainSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// trackActive 统计进行中的请求；每次启动使用新的 WaitGroup，旧 server 上未退出的请求不影响重启后的计数
+func trackActive(active *sync.WaitGroup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		active.Add(1)
+		defer active.Done()
+		c.Next()
+	}
+}
+
+// waitActive 等待进行中的请求全部退出，超时返回 false
+func waitActive(active *sync.WaitGroup, timeout time.Duration) bool {
+	if active == nil {
+		return true
+	}
+	done := make(chan struct{})
+	go func() {
+		active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// drainServer 停止接受新连接并等待进行中的请求（含长时间的流式响应）完成，
+// 超过等待时长后取消剩余请求的上游调用并强制关闭连接
+func (prs *ProviderRelayService) drainServer(server *http.Server, active *sync.WaitGroup) error {
+	grace := prs.drainTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		canceled := 0
+		if prs.inflight != nil {
+			canceled = prs.inflight.cancelAll()
+		}
+		fmt.Printf("[WARN] relay 停止时等待 %s 后仍有请求未完成，已取消 %d 个请求并强制关闭连接\n", grace, canceled)
+		err = server.Close()
+	}
+	if !waitActive(active, relayForceCloseWait) {
+		fmt.Printf("[WARN] relay 强制关闭后仍有请求未退出\n")
+	}
+	return err
+}
+
+// cancelAll 取消所有进行中的请求，返回取消的数量
+func (t *inflightTracker) cancelAll() int {
+	t.mu.Lock()
+	entries := make([]*inflightEntry, 0, len(t.entries))
+	for _, entry := range t.entries {
+		entries = append(entries, entry)
+	}
+	t.mu.Unlock()
+	for _, entry := range entries {
+		entry.cancel()
+	}
+	return len(entries)
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// relay 错误响应中的稳定错误码，客户端可据此区分"需要配置 provider"和"上游故障"，错误文案可能调整，错误码不会
+const (
+	ErrCodeInvalidRequest       = "invalid_request"        // 请求体无法读取或不是合法 JSON
+	ErrCodeNoProviders          = "no_providers"           // 没有启用且配置完整的 provider
+	ErrCodeModelUnsupported     = "model_unsupported"      // 没有 provider 支持请求的模型
+	ErrCodeNoMatchingProvider   = "no_matching_provider"   // 有 provider 支持该模型，但输入 token 范围不匹配
+	ErrCodeAllBlacklisted       = "all_blacklisted"        // 支持该模型的 provider 均已拉黑或处于维护窗口
+	ErrCodeProviderUnavailable  = "provider_unavailable"   // X-Force-Provider 指定的 provider 不存在或不可用
+	ErrCodeForbidden            = "forbidden"              // 请求不允许（如非本机请求使用 X-Force-Provider）
+	ErrCodeInvalidProjectConfig = "invalid_project_config" // X-Project-Root 指向的 .bmai.json 无效
+	ErrCodeUpstreamError        = "upstream_error"         // 上游请求失败
+	ErrCodeProviderBusy         = "provider_busy"          // provider 并发已满，等待超时仍无空闲槽位
+	ErrCodeStreamInterrupted    = "stream_interrupted"     // 上游响应中途中断（以流式错误事件返回，HTTP 状态码仍为 2xx）
+	ErrCodeRelayPaused          = "relay_paused"           // 全局熔断中，暂停转发
+	ErrCodeRequestCanceled      = "request_canceled"       // 请求被取消
+	ErrCodeInternal             = "internal_error"         // relay 内部错误
+)
+
+// providerSkips pickProvider 按原因统计被过滤的 provider
+type providerSkips struct {
+	invalid     int // 配置验证失败
+	model       int // 不支持请求的模型
+	tokens      int // 输入 token 范围不匹配
+	unavailable int // 已拉黑或处于维护窗口
+}
+
+func (s providerSkips) total() int {
+	return s.invalid + s.model + s.tokens + s.unavailable
+}
+
+// errorCode 没有可用 provider 时对应的错误码
+// 过滤按 配置 -> 模型 -> token 范围 -> 维护/拉黑 的顺序进行，越靠后的原因越接近"本可以使用"
+func (s providerSkips) errorCode() string {
+	switch {
+	case s.unavailable > 0:
+		return ErrCodeAllBlacklisted
+	case s.tokens > 0:
+		return ErrCodeNoMatchingProvider
+	case s.model > 0:
+		return ErrCodeModelUnsupported
+	default:
+		return ErrCodeNoProviders
+	}
+}
+
+func (s providerSkips) describe() string {
+	return fmt.Sprintf("已跳过 %d 个：不支持该模型 %d，token 范围不匹配 %d，拉黑或维护中 %d，配置无效 %d",
+		s.total(), s.model, s.tokens, s.unavailable, s.invalid)
+}
+
+// writeRelayError 按平台客户端期望的错误格式写入错误响应，错误码位置：
+//
+//	claude  {"type": "error", "error": {"type": "...", "code": "<code>", "message": "..."}}
+//	codex   {"error": {"type": "...", "code": "<code>", "message": "..."}}
+//	gemini  {"error": {"code": 404, "status": "NOT_FOUND", "reason": "<code>", "message": "..."}}
+//
+// extra 中的字段（如 provider、retry_after）附加在 error 对象内
+func writeRelayError(c *gin.Context, kind string, status int, code string, message string, extra gin.H) {
+	c.JSON(status, relayErrorBody(kind, status, code, message, extra))
+}
+
+// relayErrorBody 构造 writeRelayError 写出的错误响应体
+func relayErrorBody(kind string, status int, code string, message string, extra gin.H) gin.H {
+	detail := gin.H{}
+	for key, value := range extra {
+		detail[key] = value
+	}
+	detail["message"] = message
+
+	switch kind {
+	case "gemini":
+		detail["code"] = status
+		detail["status"] = googleErrorStatus(status)
+		detail["reason"] = code
+		return gin.H{"error": detail}
+	case "claude":
+		detail["type"] = anthropicErrorType(status)
+		detail["code"] = code
+		return gin.H{"type": "error", "error": detail}
+	default:
+		detail["type"] = openAIErrorType(status)
+		detail["code"] = code
+		return gin.H{"error": detail}
+	}
+}
+
+func anthropicErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusConflict:
+		return "invalid_request_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusServiceUnavailable:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+func openAIErrorType(status int) string {
+	if status >= http.StatusInternalServerError {
+		return "server_error"
+	}
+	return "invalid_request_error"
+}
+
+func googleErrorStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusConflict:
+		return "FAILED_PRECONDITION"
+	case statusRequestCanceled:
+		return "CANCELLED"
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	default:
+		return "INTERNAL"
+	}
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/tidwall/gjson"
+)
+
+func TestRelayErrorCodes(t *testing.T) {
+	setupTestEnv(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":"boom"}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	relay.geminiService = NewGeminiService(relay.addr)
+
+	send := func(path string, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return rec
+	}
+	expect := func(rec *httptest.ResponseRecorder, status int, codePath string, code string) {
+		t.Helper()
+		if rec.Code != status {
+			t.Fatalf("状态码 = %d, 期望 %d, body=%s", rec.Code, status, rec.Body.String())
+		}
+		if got := gjson.Get(rec.Body.String(), codePath).String(); got != code {
+			t.Fatalf("%s = %q, 期望 %q, body=%s", codePath, got, code, rec.Body.String())
+		}
+		if gjson.Get(rec.Body.String(), "error.message").String() == "" {
+			t.Fatalf("错误响应应包含 message: %s", rec.Body.String())
+		}
+	}
+	saveClaude := func(providers ...Provider) {
+		t.Helper()
+		if err := relay.providerService.SaveProviders("claude", providers); err != nil {
+			t.Fatalf("保存 provider 失败: %v", err)
+		}
+	}
+
+	rec := send("/v1/messages", `{"model":`)
+	expect(rec, http.StatusBadRequest, "error.code", ErrCodeInvalidRequest)
+	if gjson.Get(rec.Body.String(), "type").String() != "error" || gjson.Get(rec.Body.String(), "error.type").String() != "invalid_request_error" {
+		t.Fatalf("claude 错误应使用 Anthropic 错误格式: %s", rec.Body.String())
+	}
+
+	expect(send("/v1/messages", `{"model":"claude-sonnet-4"}`), http.StatusNotFound, "error.code", ErrCodeNoProviders)
+
+	saveClaude(Provider{ID: 1, Name: "gpt-only", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1,
+		SupportedModels: map[string]bool{"gpt-5": true}})
+	expect(send("/v1/messages", `{"model":"claude-sonnet-4"}`), http.StatusNotFound, "error.code", ErrCodeModelUnsupported)
+
+	saveClaude(Provider{ID: 2, Name: "blocked", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1})
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatalf("获取数据库失败: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO provider_blacklist (platform, provider_name, blacklisted_at, blacklisted_until) VALUES (?, ?, ?, ?)`,
+		"claude", "blocked", time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("写入黑名单失败: %v", err)
+	}
+	expect(send("/v1/messages", `{"model":"claude-sonnet-4"}`), http.StatusNotFound, "error.code", ErrCodeAllBlacklisted)
+
+	if err := relay.providerService.SaveProviders("codex", []Provider{
+		{ID: 1, Name: "down", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	rec = send("/responses", `{"model":"gpt-5"}`)
+	expect(rec, http.StatusBadGateway, "error.code", ErrCodeUpstreamError)
+	if gjson.Get(rec.Body.String(), "error.type").String() != "server_error" || gjson.Get(rec.Body.String(), "error.provider").String() != "down" {
+		t.Fatalf("codex 错误应使用 OpenAI 错误格式: %s", rec.Body.String())
+	}
+
+	for i := 0; i < circuitFailureThreshold; i++ {
+		relay.circuitBreaker().recordFailure("codex")
+	}
+	rec = send("/responses", `{"model":"gpt-5"}`)
+	expect(rec, http.StatusServiceUnavailable, "error.code", ErrCodeRelayPaused)
+	if gjson.Get(rec.Body.String(), "error.retry_after").Int() <= 0 {
+		t.Fatalf("relay_paused 应包含 retry_after: %s", rec.Body.String())
+	}
+
+	rec = send("/gemini/v1beta/models/gemini-pro:generateContent", `{}`)
+	expect(rec, http.StatusNotFound, "error.reason", ErrCodeNoProviders)
+	if gjson.Get(rec.Body.String(), "error.code").Int() != http.StatusNotFound || gjson.Get(rec.Body.String(), "error.status").String() != "NOT_FOUND" {
+		t.Fatalf("gemini 错误应使用 Google 错误格式: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RelayHealth GET /health 的响应：进程存活即返回 200，没有配置 provider 时各平台列表为空
+// 负载均衡或监控可据此区分"进程存活但未配置"和"进程未运行"
+type RelayHealth struct {
+	Status        string                          `json:"status"`
+	UptimeSeconds int64                           `json:"uptimeSeconds"`
+	Port          int                             `json:"port"`
+	Providers     map[string]PlatformHealthStatus `json:"providers"`
+}
+
+// PlatformHealthStatus 单个平台的 provider 状态
+type PlatformHealthStatus struct {
+	Enabled     int            `json:"enabled"`     // 已启用的 provider 数
+	Blacklisted int            `json:"blacklisted"` // 已启用但当前被拉黑的 provider 数
+	Available   []string       `json:"available"`   // 已启用且未被拉黑的 provider 名称
+	InFlight    map[string]int `json:"inFlight"`    // 已启用 provider 当前进行中的请求数，用于调整 maxConcurrent
+}
+
+func (prs *ProviderRelayService) healthHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, prs.health())
+}
+
+func (prs *ProviderRelayService) health() RelayHealth {
+	prs.stateMu.Lock()
+	startedAt := prs.startedAt
+	addr := prs.listenAddr
+	if addr == "" {
+		addr = prs.addr
+	}
+	prs.stateMu.Unlock()
+
+	report := RelayHealth{
+		Status:    "ok",
+		Providers: make(map[string]PlatformHealthStatus, 3),
+	}
+	if !startedAt.IsZero() {
+		report.UptimeSeconds = int64(time.Since(startedAt).Seconds())
+	}
+	if _, portText, err := net.SplitHostPort(addr); err == nil {
+		report.Port, _ = strconv.Atoi(portText)
+	}
+
+	for _, kind := range []string{"claude", "codex"} {
+		names := make([]string, 0)
+		if prs.providerService != nil {
+			if providers, err := prs.providerService.LoadProviders(kind); err == nil {
+				for _, p := range providers {
+					if p.Enabled {
+						names = append(names, p.Name)
+					}
+				}
+			}
+		}
+		report.Providers[kind] = prs.platformHealth(kind, names)
+	}
+	geminiNames := make([]string, 0)
+	if prs.geminiService != nil {
+		for _, p := range prs.geminiService.GetProviders() {
+			if p.Enabled {
+				geminiNames = append(geminiNames, p.Name)
+			}
+		}
+	}
+	report.Providers["gemini"] = prs.platformHealth("gemini", geminiNames)
+	return report
+}
+
+func (prs *ProviderRelayService) platformHealth(kind string, enabled []string) PlatformHealthStatus {
+	status := PlatformHealthStatus{
+		Enabled:   len(enabled),
+		Available: make([]string, 0, len(enabled)),
+		InFlight:  make(map[string]int, len(enabled)),
+	}
+	for _, name := range enabled {
+		status.InFlight[name] = prs.concurrency.count(kind, name)
+		if prs.blacklistService != nil {
+			if blacklisted, _ := prs.blacklistService.IsBlacklisted(kind, name); blacklisted {
+				status.Blacklisted++
+				continue
+			}
+		}
+		status.Available = append(status.Available, name)
+	}
+	return status
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestHealthEndpoint(t *testing.T) {
+	setupTestEnv(t)
+
+	relay, router := newTestRelay(t)
+	get := func() RelayHealth {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("/health 状态码 = %d", rec.Code)
+		}
+		var health RelayHealth
+		if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+			t.Fatalf("解析 /health 响应失败: %v, body=%s", err, rec.Body.String())
+		}
+		return health
+	}
+
+	// 没有配置 provider 时也返回 200，各平台列表为空数组
+	health := get()
+	if health.Status != "ok" || len(health.Providers) != 3 || health.Providers["claude"].Available == nil || health.Providers["gemini"].Enabled != 0 {
+		t.Fatalf("未配置 provider 时的健康状态不正确: %+v", health)
+	}
+
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "a", APIURL: "https://a.example.com", APIKey: "sk", Enabled: true, Level: 1},
+		{ID: 2, Name: "b", APIURL: "https://b.example.com", APIKey: "sk", Enabled: true, Level: 1},
+		{ID: 3, Name: "off", APIURL: "https://c.example.com", APIKey: "sk", Enabled: false, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatalf("获取数据库失败: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO provider_blacklist (platform, provider_name, blacklisted_at, blacklisted_until) VALUES (?, ?, ?, ?)`,
+		"claude", "b", time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("写入黑名单失败: %v", err)
+	}
+
+	claude := get().Providers["claude"]
+	if claude.Enabled != 2 || claude.Blacklisted != 1 || len(claude.Available) != 1 || claude.Available[0] != "a" {
+		t.Fatalf("claude 健康状态不正确: %+v", claude)
+	}
+
+	if err := relay.Start(); err != nil {
+		t.Fatalf("启动 relay 失败: %v", err)
+	}
+	defer relay.Stop()
+	_, portText, _ := net.SplitHostPort(relay.listenAddr)
+	if health := get(); strconv.Itoa(health.Port) != portText || health.UptimeSeconds < 0 {
+		t.Fatalf("应返回实际监听端口: %+v (监听 %s)", health, relay.listenAddr)
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+// metricsDurationBuckets 请求耗时直方图的桶上界（秒）
+var metricsDurationBuckets = []float64{0.5, 1, 2, 5, 10, 30, 60, 120, 300}
+
+// requestLogAggregate request_log 按 platform/provider/http_code 分组后的一行聚合结果
+type requestLogAggregate struct {
+	platform     string
+	provider     string
+	httpCode     int
+	requests     int64
+	inputTokens  int64
+	outputTokens int64
+	cacheCreate  int64
+	cacheRead    int64
+	reasoning    int64
+	durationSum  float64
+	bucketCounts []int64 // 与 metricsDurationBuckets 一一对应，耗时 <= 上界的请求数（累计）
+}
+
+// metricsHandler GET /metrics：以 Prometheus 文本格式导出 request_log 的累计统计
+func (prs *ProviderRelayService) metricsHandler(c *gin.Context) {
+	rows, err := loadRequestLogAggregates()
+	if err != nil {
+		fmt.Printf("[ERROR] 生成 metrics 失败: %v\n", err)
+		c.String(http.StatusInternalServerError, "# 生成 metrics 失败: %v\n", err)
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(renderPrometheusMetrics(rows)))
+}
+
+// loadRequestLogAggregates 用一条分组 SQL 汇总 request_log（包括耗时直方图各桶），不把明细加载到内存
+func loadRequestLogAggregates() ([]requestLogAggregate, error) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	bucketColumns := make([]string, len(metricsDurationBuckets))
+	args := make([]any, len(metricsDurationBuckets))
+	for i, bound := range metricsDurationBuckets {
+		bucketColumns[i] = "SUM(CASE WHEN COALESCE(duration_sec, 0) <= ? THEN 1 ELSE 0 END)"
+		args[i] = bound
+	}
+	query := `SELECT COALESCE(platform, ''), COALESCE(provider, ''), COALESCE(http_code, 0),
+		COUNT(*),
+		COALESCE(SUM(input_tokens), 0),
+		COALESCE(SUM(output_tokens), 0),
+		COALESCE(SUM(cache_create_tokens), 0),
+		COALESCE(SUM(cache_read_tokens), 0),
+		COALESCE(SUM(reasoning_tokens), 0),
+		COALESCE(SUM(duration_sec), 0),
+		` + strings.Join(bucketColumns, ",\n\t\t") + `
+	FROM request_log
+	GROUP BY 1, 2, 3
+	ORDER BY 1, 2, 3`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询请求日志聚合失败: %w", err)
+	}
+	defer rows.Close()
+
+	var result []requestLogAggregate
+	for rows.Next() {
+		row := requestLogAggregate{bucketCounts: make([]int64, len(metricsDurationBuckets))}
+		dest := []any{
+			&row.platform, &row.provider, &row.httpCode,
+			&row.requests, &row.inputTokens, &row.outputTokens,
+			&row.cacheCreate, &row.cacheRead, &row.reasoning, &row.durationSum,
+		}
+		for i := range row.bucketCounts {
+			dest = append(dest, &row.bucketCounts[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("读取请求日志聚合失败: %w", err)
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// renderPrometheusMetrics 按 Prometheus 文本格式输出：
+//
+//	codeswitch_requests_total{platform,provider,http_code}     请求数
+//	codeswitch_tokens_total{platform,provider,type}            token 累计（input/output/cache_create/cache_read/reasoning）
+//	codeswitch_request_duration_seconds{platform,provider}     请求耗时直方图
+func renderPrometheusMetrics(rows []requestLogAggregate) string {
+	var b strings.Builder
+
+	b.WriteString("# HELP codeswitch_requests_total Total relayed requests recorded in request_log.\n")
+	b.WriteString("# TYPE codeswitch_requests_total counter\n")
+	for _, row := range rows {
+		fmt.Fprintf(&b, "codeswitch_requests_total{platform=\"%s\",provider=\"%s\",http_code=\"%d\"} %d\n",
+			escapeMetricLabel(row.platform), escapeMetricLabel(row.provider), row.httpCode, row.requests)
+	}
+
+	// token 与耗时不区分状态码，先按 platform/provider 合并（rows 已按这两列排序）
+	merged := mergeAggregatesByProvider(rows)
+
+	b.WriteString("# HELP codeswitch_tokens_total Total tokens recorded in request_log.\n")
+	b.WriteString("# TYPE codeswitch_tokens_total counter\n")
+	for _, row := range merged {
+		labels := fmt.Sprintf("platform=\"%s\",provider=\"%s\"", escapeMetricLabel(row.platform), escapeMetricLabel(row.provider))
+		for _, item := range []struct {
+			kind  string
+			value int64
+		}{
+			{"input", row.inputTokens},
+			{"output", row.outputTokens},
+			{"cache_create", row.cacheCreate},
+			{"cache_read", row.cacheRead},
+			{"reasoning", row.reasoning},
+		} {
+			fmt.Fprintf(&b, "codeswitch_tokens_total{%s,type=\"%s\"} %d\n", labels, item.kind, item.value)
+		}
+	}
+
+	b.WriteString("# HELP codeswitch_request_duration_seconds Relayed request duration in seconds.\n")
+	b.WriteString("# TYPE codeswitch_request_duration_seconds histogram\n")
+	for _, row := range merged {
+		labels := fmt.Sprintf("platform=\"%s\",provider=\"%s\"", escapeMetricLabel(row.platform), escapeMetricLabel(row.provider))
+		for i, bound := range metricsDurationBuckets {
+			fmt.Fprintf(&b, "codeswitch_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels, strconv.FormatFloat(bound, 'f', -1, 64), row.bucketCounts[i])
+		}
+		fmt.Fprintf(&b, "codeswitch_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, row.requests)
+		fmt.Fprintf(&b, "codeswitch_request_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(row.durationSum, 'f', -1, 64))
+		fmt.Fprintf(&b, "codeswitch_request_duration_seconds_count{%s} %d\n", labels, row.requests)
+	}
+	return b.String()
+}
+
+// mergeAggregatesByProvider 把同一 platform/provider 下不同状态码的聚合行相加
+func mergeAggregatesByProvider(rows []requestLogAggregate) []requestLogAggregate {
+	var merged []requestLogAggregate
+	for _, row := range rows {
+		last := len(merged) - 1
+		if last < 0 || merged[last].platform != row.platform || merged[last].provider != row.provider {
+			copied := row
+			copied.bucketCounts = append([]int64(nil), row.bucketCounts...)
+			merged = append(merged, copied)
+			continue
+		}
+		target := &merged[last]
+		target.requests += row.requests
+		target.inputTokens += row.inputTokens
+		target.outputTokens += row.outputTokens
+		target.cacheCreate += row.cacheCreate
+		target.cacheRead += row.cacheRead
+		target.reasoning += row.reasoning
+		target.durationSum += row.durationSum
+		for i := range target.bucketCounts {
+			target.bucketCounts[i] += row.bucketCounts[i]
+		}
+	}
+	return merged
+}
+
+// escapeMetricLabel 按 Prometheus 文本格式转义标签值
+func escapeMetricLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
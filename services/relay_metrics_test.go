@@ -0,0 +1,51 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	setupTestEnv(t)
+
+	insertTestRequestLog(t, xdb.Record{"platform": "claude", "provider": "official", "http_code": 200, "input_tokens": 100, "output_tokens": 50, "duration_sec": 0.4})
+	insertTestRequestLog(t, xdb.Record{"platform": "claude", "provider": "official", "http_code": 200, "input_tokens": 10, "output_tokens": 5, "duration_sec": 3})
+	insertTestRequestLog(t, xdb.Record{"platform": "claude", "provider": "official", "http_code": 502, "duration_sec": 400})
+	insertTestRequestLog(t, xdb.Record{"platform": "codex", "provider": `we"ird`, "http_code": 200, "reasoning_tokens": 7, "duration_sec": 1})
+
+	_, router := newTestRelay(t)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, 期望 text/plain", ct)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE codeswitch_requests_total counter",
+		`codeswitch_requests_total{platform="claude",provider="official",http_code="200"} 2`,
+		`codeswitch_requests_total{platform="claude",provider="official",http_code="502"} 1`,
+		`codeswitch_requests_total{platform="codex",provider="we\"ird",http_code="200"} 1`,
+		`codeswitch_tokens_total{platform="claude",provider="official",type="input"} 110`,
+		`codeswitch_tokens_total{platform="claude",provider="official",type="output"} 55`,
+		`codeswitch_tokens_total{platform="codex",provider="we\"ird",type="reasoning"} 7`,
+		"# TYPE codeswitch_request_duration_seconds histogram",
+		`codeswitch_request_duration_seconds_bucket{platform="claude",provider="official",le="0.5"} 1`,
+		`codeswitch_request_duration_seconds_bucket{platform="claude",provider="official",le="5"} 2`,
+		`codeswitch_request_duration_seconds_bucket{platform="claude",provider="official",le="300"} 2`,
+		`codeswitch_request_duration_seconds_bucket{platform="claude",provider="official",le="+Inf"} 3`,
+		`codeswitch_request_duration_seconds_sum{platform="claude",provider="official"} 403.4`,
+		`codeswitch_request_duration_seconds_count{platform="claude",provider="official"} 3`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics 缺少 %s\n%s", want, body)
+		}
+	}
+}
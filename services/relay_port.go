@@ -0,0 +1,239 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// relayPortKey app_settings 中 relay 监听端口的配置键
+	relayPortKey = "relay_port"
+	// DefaultRelayPort 未配置时 relay 监听的端口
+	DefaultRelayPort = 18100
+)
+
+// GetRelayPort 获取 relay 监听端口（未配置时为 18100）
+func (ss *SettingsService) GetRelayPort() (int, error) {
+	port, found, err := configuredRelayPort()
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return DefaultRelayPort, nil
+	}
+	return port, nil
+}
+
+// SetRelayPort 修改 relay 监听端口并立即生效：
+// 依次执行 OnRelayPortChanged 注册的回调（重启 relay、改写 CLI 配置），任一回调失败时恢复原端口配置并返回错误；
+// 回调需自行回滚已生效的改动（见 RestartWith）
+func (ss *SettingsService) SetRelayPort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("端口必须在 1-65535 之间")
+	}
+	previous, found, err := configuredRelayPort()
+	if err != nil {
+		return err
+	}
+	if found && previous == port {
+		return nil
+	}
+	if err := setSettingValue(relayPortKey, strconv.Itoa(port)); err != nil {
+		return err
+	}
+
+	ss.mu.Lock()
+	listeners := append([]func(int) error{}, ss.onRelayPortChanged...)
+	ss.mu.Unlock()
+	for _, fn := range listeners {
+		if err := fn(port); err != nil {
+			restore := strconv.Itoa(previous)
+			if !found {
+				restore = ""
+			}
+			if restoreErr := setSettingValue(relayPortKey, restore); restoreErr != nil {
+				fmt.Printf("[WARN] 恢复 relay 端口配置失败: %v\n", restoreErr)
+			}
+			return fmt.Errorf("切换 relay 端口到 %d 失败: %w", port, err)
+		}
+	}
+	return nil
+}
+
+// OnRelayPortChanged 注册端口变更回调（main 中据此重启 relay 并刷新各 CLI 的代理地址）
+func (ss *SettingsService) OnRelayPortChanged(fn func(port int) error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.onRelayPortChanged = append(ss.onRelayPortChanged, fn)
+}
+
+// configuredRelayPort 读取已保存的端口，未配置或为空时 found 为 false
+func configuredRelayPort() (int, bool, error) {
+	value, found, err := getSettingValue(relayPortKey)
+	if err != nil {
+		return 0, false, err
+	}
+	value = strings.TrimSpace(value)
+	if !found || value == "" {
+		return 0, false, nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, false, fmt.Errorf("relay 端口配置无效: %s", value)
+	}
+	return port, true, nil
+}
+
+// configuredAddr 按已保存的端口替换 addr 中的端口（主机部分保持不变），未配置时返回原地址
+func (prs *ProviderRelayService) configuredAddr(addr string) string {
+	if prs.settingsService == nil {
+		return addr
+	}
+	port, found, err := configuredRelayPort()
+	if err != nil {
+		fmt.Printf("[WARN] %v，使用默认地址 %s\n", err, addr)
+		return addr
+	}
+	if !found {
+		return addr
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = ""
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// Restart 按当前配置的端口重新启动 relay（与 Stop 相同，先等待进行中的请求完成）；新端口无法绑定时用原地址恢复服务并返回错误
+func (prs *ProviderRelayService) Restart() error {
+	previous := prs.Addr()
+	if err := prs.Stop(); err != nil {
+		return fmt.Errorf("停止 relay 失败: %w", err)
+	}
+	if err := prs.start(prs.configuredAddr(previous)); err != nil {
+		if restoreErr := prs.start(previous); restoreErr != nil {
+			return fmt.Errorf("%w（恢复原地址 %s 也失败: %v）", err, previous, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// RestartWith 按当前配置的端口重启 relay，再依次用新地址调用 apply（刷新各 CLI 的代理地址）；
+// 任一 apply 失败时整体回滚：relay 回到原地址，所有 apply 以原地址重新执行，返回错误
+func (prs *ProviderRelayService) RestartWith(apply ...func(addr string) error) error {
+	previous := prs.Addr()
+	if err := prs.Restart(); err != nil {
+		return err
+	}
+	addr := prs.Addr()
+	errs := make([]error, 0, len(apply))
+	for _, fn := range apply {
+		errs = append(errs, fn(addr))
+	}
+	err := errors.Join(errs...)
+	if err == nil {
+		return nil
+	}
+
+	rollbackErrs := make([]error, 0, len(apply)+1)
+	if stopErr := prs.Stop(); stopErr != nil {
+		rollbackErrs = append(rollbackErrs, fmt.Errorf("停止 relay 失败: %w", stopErr))
+	} else if startErr := prs.start(previous); startErr != nil {
+		rollbackErrs = append(rollbackErrs, fmt.Errorf("恢复原地址 %s 失败: %w", previous, startErr))
+	}
+	for _, fn := range apply {
+		rollbackErrs = append(rollbackErrs, fn(previous))
+	}
+	if rollbackErr := errors.Join(rollbackErrs...); rollbackErr != nil {
+		return fmt.Errorf("%w（回滚也失败: %v）", err, rollbackErr)
+	}
+	return err
+}
+
+// proxyAddr 返回当前 relay 地址
+func (css *ClaudeSettingsService) proxyAddr() string {
+	css.addrMu.RLock()
+	defer css.addrMu.RUnlock()
+	return css.relayAddr
+}
+
+// proxyAddr 返回当前 relay 地址
+func (css *CodexSettingsService) proxyAddr() string {
+	css.addrMu.RLock()
+	defer css.addrMu.RUnlock()
+	return css.relayAddr
+}
+
+// proxyAddr 返回当前 relay 地址
+func (s *GeminiService) proxyAddr() string {
+	s.addrMu.RLock()
+	defer s.addrMu.RUnlock()
+	return s.relayAddr
+}
+
+// setProxyAddr 加锁写入 relay 地址
+func setProxyAddr(mu *sync.RWMutex, field *string, addr string) {
+	mu.Lock()
+	defer mu.Unlock()
+	*field = addr
+}
+
+// SetRelayAddr 更新 relay 地址：原来已指向 relay 的 settings.json 会改写为新地址（不覆盖启用代理前的备份）
+func (css *ClaudeSettingsService) SetRelayAddr(addr string) error {
+	status, err := css.ProxyStatus()
+	setProxyAddr(&css.addrMu, &css.relayAddr, addr)
+	if err != nil || !status.Enabled {
+		return err
+	}
+	settingsPath, _, err := css.paths()
+	if err != nil {
+		return err
+	}
+	existing, err := os.ReadFile(settingsPath)
+	if err != nil {
+		return err
+	}
+	payload, err := css.renderSettings(existing, nil)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(settingsPath, payload, 0o600)
+}
+
+// SetRelayAddr 更新 relay 地址：原来已指向 relay 的 config.toml 会改写为新地址（不覆盖启用代理前的备份）
+func (css *CodexSettingsService) SetRelayAddr(addr string) error {
+	status, err := css.ProxyStatus()
+	setProxyAddr(&css.addrMu, &css.relayAddr, addr)
+	if err != nil || !status.Enabled {
+		return err
+	}
+	settingsPath, _, err := css.paths()
+	if err != nil {
+		return err
+	}
+	existing, err := os.ReadFile(settingsPath)
+	if err != nil {
+		return err
+	}
+	rendered, err := css.renderConfig(existing)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(settingsPath, rendered, 0o600)
+}
+
+// SetRelayAddr 更新 relay 地址：原来已指向 relay 的 .env 会改写为新地址（不覆盖启用代理前的备份）
+func (s *GeminiService) SetRelayAddr(addr string) error {
+	status, err := s.ProxyStatus()
+	setProxyAddr(&s.addrMu, &s.relayAddr, addr)
+	if err != nil || !status.Enabled {
+		return err
+	}
+	return writeGeminiEnv(s.proxyEnv())
+}
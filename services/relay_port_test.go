@@ -0,0 +1,249 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func freeTCPPort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("获取空闲端口失败: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+	return port
+}
+
+func TestSetRelayPortRestartsRelayAndRewritesConfig(t *testing.T) {
+	setupTestEnv(t)
+	home, _ := os.UserHomeDir()
+
+	relay, _ := newTestRelay(t)
+	settings := relay.settingsService
+	if port, err := settings.GetRelayPort(); err != nil || port != DefaultRelayPort {
+		t.Fatalf("未配置时应返回默认端口: %d, %v", port, err)
+	}
+	if err := settings.SetRelayPort(70000); err == nil {
+		t.Fatalf("超出范围的端口应被拒绝")
+	}
+
+	if err := relay.Start(); err != nil {
+		t.Fatalf("启动 relay 失败: %v", err)
+	}
+	defer relay.Stop()
+	oldAddr := relay.Addr()
+
+	// 启用代理前已有的用户配置，改写地址时不应覆盖这份备份
+	claudeDir := filepath.Join(home, claudeSettingsDir)
+	if err := os.MkdirAll(claudeDir, 0o755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(claudeDir, claudeSettingsFileName), []byte(`{"env":{"FOO":"bar"}}`), 0o600); err != nil {
+		t.Fatalf("写入配置失败: %v", err)
+	}
+	claude := NewClaudeSettingsService(oldAddr)
+	if err := claude.EnableProxy(); err != nil {
+		t.Fatalf("启用代理失败: %v", err)
+	}
+
+	settings.OnRelayPortChanged(func(port int) error {
+		if err := relay.Restart(); err != nil {
+			return err
+		}
+		return claude.SetRelayAddr(relay.Addr())
+	})
+
+	port := freeTCPPort(t)
+	if err := settings.SetRelayPort(port); err != nil {
+		t.Fatalf("切换端口失败: %v", err)
+	}
+	if !strings.HasSuffix(relay.Addr(), ":"+strconv.Itoa(port)) || !relay.IsRunning() {
+		t.Fatalf("relay 应在新端口运行: %s (running=%v)", relay.Addr(), relay.IsRunning())
+	}
+	if err := relay.WaitUntilReady(time.Second); err != nil {
+		t.Fatalf("重启后应就绪: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(claudeDir, claudeSettingsFileName))
+	if err != nil || !strings.Contains(string(data), "127.0.0.1:"+strconv.Itoa(port)) {
+		t.Fatalf("settings.json 应改写为新地址: %s, %v", data, err)
+	}
+	backup, err := os.ReadFile(filepath.Join(claudeDir, claudeBackupFileName))
+	if err != nil || !strings.Contains(string(backup), "FOO") {
+		t.Fatalf("启用代理前的备份不应被覆盖: %s, %v", backup, err)
+	}
+
+	// 新端口已被占用：返回错误，恢复原配置，relay 继续在原端口运行
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("占用端口失败: %v", err)
+	}
+	defer occupied.Close()
+	busyPort := occupied.Addr().(*net.TCPAddr).Port
+	if err := settings.SetRelayPort(busyPort); err == nil {
+		t.Fatalf("端口被占用时应返回错误")
+	}
+	if current, _ := settings.GetRelayPort(); current != port {
+		t.Fatalf("切换失败后应恢复原端口配置，实际 %d", current)
+	}
+	if !strings.HasSuffix(relay.Addr(), ":"+strconv.Itoa(port)) || !relay.IsRunning() {
+		t.Fatalf("切换失败后 relay 应继续在原端口运行: %s", relay.Addr())
+	}
+}
+
+func TestSetRelayPortRollsBackWhenConfigRewriteFails(t *testing.T) {
+	setupTestEnv(t)
+	home, _ := os.UserHomeDir()
+
+	relay, _ := newTestRelay(t)
+	settings := relay.settingsService
+	oldPort := freeTCPPort(t)
+	if err := setSettingValue(relayPortKey, strconv.Itoa(oldPort)); err != nil {
+		t.Fatalf("写入端口配置失败: %v", err)
+	}
+	if err := relay.Start(); err != nil {
+		t.Fatalf("启动 relay 失败: %v", err)
+	}
+	defer relay.Stop()
+	oldAddr := relay.Addr()
+
+	claude := NewClaudeSettingsService(oldAddr)
+	if err := claude.EnableProxy(); err != nil {
+		t.Fatalf("启用代理失败: %v", err)
+	}
+
+	// relay 已绑定新端口、Claude 配置也已改写后才失败：应整体回滚到原端口
+	settings.OnRelayPortChanged(func(port int) error {
+		return relay.RestartWith(claude.SetRelayAddr, func(addr string) error {
+			if addr != oldAddr {
+				return errors.New("写入配置失败")
+			}
+			return nil
+		})
+	})
+	if err := settings.SetRelayPort(freeTCPPort(t)); err == nil {
+		t.Fatalf("回调失败时应返回错误")
+	}
+	if current, _ := settings.GetRelayPort(); current != oldPort {
+		t.Fatalf("应恢复原端口配置，实际 %d", current)
+	}
+	if relay.Addr() != oldAddr || !relay.IsRunning() {
+		t.Fatalf("relay 应回到原地址运行: %s (running=%v)", relay.Addr(), relay.IsRunning())
+	}
+	if err := relay.WaitUntilReady(time.Second); err != nil {
+		t.Fatalf("回滚后应就绪: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(home, claudeSettingsDir, claudeSettingsFileName))
+	if err != nil || !strings.Contains(string(data), "127.0.0.1:"+strconv.Itoa(oldPort)) {
+		t.Fatalf("settings.json 应恢复为原地址: %s, %v", data, err)
+	}
+	if status, err := claude.ProxyStatus(); err != nil || !status.Enabled {
+		t.Fatalf("回滚后代理状态应保持启用: %+v, %v", status, err)
+	}
+}
+
+func TestStopDrainsInflightRequests(t *testing.T) {
+	setupTestEnv(t)
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_done"}`))
+	}))
+	defer upstream.Close()
+
+	relay, _ := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "slow", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	if seconds, err := relay.settingsService.GetRelayDrainSeconds(); err != nil || seconds != DefaultRelayDrainSeconds {
+		t.Fatalf("未配置时应返回默认等待时长: %d, %v", seconds, err)
+	}
+	if err := relay.settingsService.SetRelayDrainSeconds(maxRelayDrainSeconds + 1); err == nil {
+		t.Fatalf("超出范围的等待时长应被拒绝")
+	}
+
+	send := func() <-chan string {
+		result := make(chan string, 1)
+		go func() {
+			resp, err := http.Post("http://"+relay.listenAddr+"/v1/messages", "application/json",
+				strings.NewReader(`{"model":"claude-sonnet-4"}`))
+			if err != nil {
+				result <- err.Error()
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			result <- string(body)
+		}()
+		return result
+	}
+	stop := func() <-chan error {
+		stopped := make(chan error, 1)
+		go func() { stopped <- relay.Stop() }()
+		return stopped
+	}
+
+	if err := relay.Start(); err != nil {
+		t.Fatalf("启动 relay 失败: %v", err)
+	}
+	response := send()
+	<-started
+
+	// 进行中的请求完成前 Stop 不返回
+	stopped := stop()
+	select {
+	case err := <-stopped:
+		t.Fatalf("Stop 应等待进行中的请求完成，实际提前返回: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Fatalf("停止 relay 失败: %v", err)
+	}
+	if body := <-response; !strings.Contains(body, "msg_done") {
+		t.Fatalf("停止期间进行中的请求应正常完成: %s", body)
+	}
+
+	// 等待时长为 0：直接取消进行中的请求并强制关闭
+	if err := relay.settingsService.SetRelayDrainSeconds(0); err != nil {
+		t.Fatalf("设置等待时长失败: %v", err)
+	}
+	release = make(chan struct{})
+	defer close(release)
+	if err := relay.Start(); err != nil {
+		t.Fatalf("重新启动 relay 失败: %v", err)
+	}
+	response = send()
+	<-started
+	select {
+	case <-stop():
+	case <-time.After(relayForceCloseWait + time.Second):
+		t.Fatalf("超过等待时长后 Stop 应强制关闭")
+	}
+	if body := <-response; strings.Contains(body, "msg_done") {
+		t.Fatalf("强制关闭后请求不应完成: %s", body)
+	}
+	if len(relay.GetInflightRequests()) != 0 {
+		t.Fatalf("强制关闭后不应残留进行中的请求")
+	}
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// coalescableEndpoints 允许合并的端点（必须是非流式、幂等的工具类请求）
+var coalescableEndpoints = map[string]bool{
+	"claude:/v1/messages/count_tokens": true,
+}
+
+// isCoalescableEndpoint 判断端点是否允许请求合并
+func isCoalescableEndpoint(kind string, endpoint string) bool {
+	return coalescableEndpoints[kind+":"+endpoint]
+}
+
+// coalesceKeyIgnoredHeaders 不参与合并键的请求头：认证信息由 relay 替换为 provider 的 key，不影响上游响应
+var coalesceKeyIgnoredHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"X-Api-Key":           true,
+	"X-Goog-Api-Key":      true,
+	"Cookie":              true,
+}
+
+// coalesceKey 基于 (kind, endpoint, query, client, 转发的请求头, body) 计算合并键
+// anthropic-beta / anthropic-version 等请求头会转发给上游并影响响应，不同的请求不能共享
+func coalesceKey(kind string, endpoint string, rawQuery string, client requestClient, header http.Header, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(kind))
+	h.Write([]byte{0})
+	h.Write([]byte(endpoint))
+	h.Write([]byte{0})
+	h.Write([]byte(rawQuery))
+	h.Write([]byte{0})
+	// 不同客户端可能命中不同的客户端专属模型映射，不能共享响应
+	h.Write([]byte(client.ID))
+	h.Write([]byte{0})
+	h.Write([]byte(client.UserAgent))
+	h.Write([]byte{0})
+	names := make([]string, 0, len(header))
+	for name := range header {
+		name = http.CanonicalHeaderKey(name)
+		if !coalesceKeyIgnoredHeaders[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte{':'})
+		h.Write([]byte(strings.Join(header.Values(name), ",")))
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// coalescedResponse 已录制的上游响应，供同一批并发请求共享
+type coalescedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// writeTo 将录制的响应回放到客户端
+func (r *coalescedResponse) writeTo(w http.ResponseWriter) {
+	dst := w.Header()
+	for key, values := range r.header {
+		dst[key] = append([]string(nil), values...)
+	}
+	w.WriteHeader(r.status)
+	_, _ = w.Write(r.body)
+}
+
+type coalesceCall struct {
+	wg     sync.WaitGroup
+	result *coalescedResponse
+}
+
+// requestCoalescer 单飞（single-flight）合并器：相同 key 的并发请求只执行一次
+type requestCoalescer struct {
+	mu    sync.Mutex
+	calls map[string]*coalesceCall
+}
+
+func newRequestCoalescer() *requestCoalescer {
+	return &requestCoalescer{calls: make(map[string]*coalesceCall)}
+}
+
+// Do 执行 fn 并返回结果；若相同 key 已有请求在途，则等待并复用其结果
+// shared 表示结果是否来自其他请求；fn panic 时所有等待者得到按 kind 格式化的 500 错误响应
+func (rc *requestCoalescer) Do(kind string, key string, fn func() *coalescedResponse) (result *coalescedResponse, shared bool) {
+	rc.mu.Lock()
+	if call, ok := rc.calls[key]; ok {
+		rc.mu.Unlock()
+		call.wg.Wait()
+		return call.result, true
+	}
+	call := &coalesceCall{}
+	call.wg.Add(1)
+	rc.calls[key] = call
+	rc.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("[ERROR] 合并请求执行异常: %v\n", r)
+			call.result = coalescedError(kind, http.StatusInternalServerError, ErrCodeInternal, "relay 内部错误")
+			result = call.result
+		}
+		rc.mu.Lock()
+		delete(rc.calls, key)
+		rc.mu.Unlock()
+		call.wg.Done()
+	}()
+
+	call.result = fn()
+	if call.result == nil {
+		call.result = coalescedError(kind, http.StatusInternalServerError, ErrCodeInternal, "relay 内部错误")
+	}
+	return call.result, false
+}
+
+// coalescedError 构造与 writeRelayError 格式一致的错误响应
+func coalescedError(kind string, status int, code string, message string) *coalescedResponse {
+	body, _ := json.Marshal(relayErrorBody(kind, status, code, message, nil))
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	return &coalescedResponse{status: status, header: header, body: body}
+}
+
+// recordingResponseWriter 录制写入内容而不直接发送给客户端
+type recordingResponseWriter struct {
+	gin.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newRecordingResponseWriter(w gin.ResponseWriter) *recordingResponseWriter {
+	return &recordingResponseWriter{ResponseWriter: w, header: make(http.Header)}
+}
+
+func (w *recordingResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *recordingResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *recordingResponseWriter) WriteHeaderNow() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+}
+
+func (w *recordingResponseWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	return w.body.Write(data)
+}
+
+func (w *recordingResponseWriter) WriteString(s string) (int, error) {
+	w.WriteHeaderNow()
+	return w.body.WriteString(s)
+}
+
+func (w *recordingResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *recordingResponseWriter) Size() int {
+	if w.status == 0 {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *recordingResponseWriter) Written() bool {
+	return w.status != 0
+}
+
+func (w *recordingResponseWriter) Flush() {}
+
+func (w *recordingResponseWriter) result() *coalescedResponse {
+	return &coalescedResponse{
+		status: w.Status(),
+		header: w.header.Clone(),
+		body:   append([]byte(nil), w.body.Bytes()...),
+	}
+}
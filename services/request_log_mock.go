@@ -0,0 +1,221 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// devModeEnv 开发/演示模式开关，设置为 1 或 true 时才允许写入模拟数据
+const devModeEnv = "CODE_SWITCH_DEV"
+
+// maxMockMonths 模拟数据最多覆盖的月数
+const maxMockMonths = 24
+
+// devModeEnabled 是否处于开发/演示模式
+func devModeEnabled() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(devModeEnv))) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// SeedMockData 生成最近 months 个月（默认 3 个月）的模拟请求日志，返回写入的记录数
+// 仅在设置 CODE_SWITCH_DEV=1 时可用，避免误写入真实用户的数据库
+func (ls *LogService) SeedMockData(months int) (int, error) {
+	if !devModeEnabled() {
+		return 0, fmt.Errorf("模拟数据仅在开发模式下可用（设置环境变量 %s=1 后重启）", devModeEnv)
+	}
+	if months <= 0 {
+		months = 3
+	}
+	if months > maxMockMonths {
+		return 0, fmt.Errorf("模拟数据最多覆盖 %d 个月", maxMockMonths)
+	}
+	defer beginBulkWrite()()
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	inserted := 0
+	for _, day := range mockDays(months, rng) {
+		if len(day) == 0 {
+			continue
+		}
+		if _, err := xdb.New("request_log").InsertBatch(day); err != nil {
+			return inserted, fmt.Errorf("写入模拟数据失败: %w", err)
+		}
+		inserted += len(day)
+	}
+	return inserted, nil
+}
+
+// ClearLogs 清空全部请求日志（与 PurgeRequestLog 相同），返回删除的记录数，用于演示结束后复原
+// 与 SeedMockData 一样仅在开发模式下可用；正式清空请使用 PurgeRequestLog
+func (ls *LogService) ClearLogs() (int64, error) {
+	if !devModeEnabled() {
+		return 0, fmt.Errorf("清空模拟数据仅在开发模式下可用（设置环境变量 %s=1 后重启）", devModeEnv)
+	}
+	return ls.PurgeRequestLog()
+}
+
+// mockDays 按天生成模拟记录：工作日与白天更活跃，越近的日期请求越多，偶尔出现高峰
+func mockDays(months int, rng *rand.Rand) [][]xdb.Record {
+	platModels := map[string][]string{
+		"claude": {
+			"claude-sonnet-4-5-20250929",
+			"claude-opus-4-1-20250805",
+			"claude-sonnet-4-20250514",
+			"claude-haiku-4-5-20251001",
+			"claude-3-5-haiku-20241022",
+		},
+		"codex": {
+			"gpt-5-codex",
+			"gpt-5",
+		},
+	}
+	platforms := []string{"claude", "codex"}
+	providers := map[string][]string{
+		"claude": {"kimi", "deepseek", "AICoding.sh"},
+		"codex":  {"AICoding.sh"},
+	}
+	httpCodes := []int{200, 200, 200, 201, 400, 429, 500}
+	timeBands := []struct {
+		startHour int
+		endHour   int
+		weight    float64
+	}{
+		{0, 6, 0.5},
+		{6, 12, 1.1},
+		{12, 18, 1.35},
+		{18, 24, 0.9},
+	}
+	weekdayBoost := map[time.Weekday]float64{
+		time.Monday:    1.1,
+		time.Tuesday:   1.15,
+		time.Wednesday: 1.2,
+		time.Thursday:  1.15,
+		time.Friday:    1.05,
+		time.Saturday:  0.85,
+		time.Sunday:    0.8,
+	}
+	const minDaily, maxDaily = 4, 18
+
+	now := time.Now()
+	today := startOfDay(now)
+	totalDays := months * 30
+	days := make([][]xdb.Record, 0, totalDays)
+	for dayOffset := 0; dayOffset < totalDays; dayOffset++ {
+		currentDay := today.AddDate(0, 0, -dayOffset)
+		progress := float64(dayOffset) / float64(totalDays)
+		activity := (0.35 + (1-progress)*0.9) * weekdayBoost[currentDay.Weekday()] * (0.7 + rng.Float64()*0.8)
+		dailyTarget := int(math.Round(float64(minDaily) + activity*float64(maxDaily-minDaily)))
+		if dailyTarget < len(timeBands) {
+			dailyTarget = len(timeBands)
+		}
+		if rng.Float64() < 0.15 {
+			dailyTarget += 4 + rng.Intn(6)
+		}
+		if rng.Float64() < 0.05 {
+			dailyTarget += 8 + rng.Intn(12)
+		}
+		weights := make([]float64, len(timeBands))
+		for i, band := range timeBands {
+			weights[i] = band.weight
+		}
+
+		var records []xdb.Record
+		for bandIdx, count := range distributeCounts(dailyTarget, weights, rng) {
+			band := timeBands[bandIdx]
+			for i := 0; i < count; i++ {
+				timestamp := currentDay.Add(time.Duration(band.startHour+rng.Intn(band.endHour-band.startHour))*time.Hour +
+					time.Duration(rng.Intn(60))*time.Minute)
+				if timestamp.After(now) {
+					continue
+				}
+				platform := platforms[rng.Intn(len(platforms))]
+				entry := &ReqeustLog{
+					Platform:        platform,
+					Model:           platModels[platform][rng.Intn(len(platModels[platform]))],
+					Provider:        providers[platform][rng.Intn(len(providers[platform]))],
+					HttpCode:        httpCodes[rng.Intn(len(httpCodes))],
+					InputTokens:     300 + rng.Intn(6000),
+					OutputTokens:    150 + rng.Intn(2500),
+					ReasoningTokens: rng.Intn(500),
+					IsStream:        rng.Intn(100) < 35,
+					DurationSec:     0.2 + rng.Float64()*8,
+				}
+				entry.CacheCreateTokens = entry.InputTokens * rng.Intn(25) / 100
+				entry.CacheReadTokens = entry.OutputTokens * rng.Intn(15) / 100
+				applyRequestCost(entry)
+				records = append(records, xdb.Record{
+					"platform":            entry.Platform,
+					"model":               entry.Model,
+					"provider":            entry.Provider,
+					"http_code":           entry.HttpCode,
+					"input_tokens":        entry.InputTokens,
+					"output_tokens":       entry.OutputTokens,
+					"cache_create_tokens": entry.CacheCreateTokens,
+					"cache_read_tokens":   entry.CacheReadTokens,
+					"reasoning_tokens":    entry.ReasoningTokens,
+					"is_stream":           boolToInt(entry.IsStream),
+					"duration_sec":        entry.DurationSec,
+					"has_pricing":         boolToInt(entry.HasPricing),
+					"input_cost":          entry.InputCost,
+					"output_cost":         entry.OutputCost,
+					"cache_create_cost":   entry.CacheCreateCost,
+					"cache_read_cost":     entry.CacheReadCost,
+					"ephemeral_5m_cost":   entry.Ephemeral5mCost,
+					"ephemeral_1h_cost":   entry.Ephemeral1hCost,
+					"total_cost":          entry.TotalCost,
+					// 与 SQLite CURRENT_TIMESTAMP 一致，按 UTC 写入
+					"created_at": timestamp.UTC().Format(timeLayout),
+				})
+			}
+		}
+		days = append(days, records)
+	}
+	return days
+}
+
+// distributeCounts 按权重把 total 分配到各时段，每个时段至少 1 条（total 不足时按时段数计）
+func distributeCounts(total int, weights []float64, rng *rand.Rand) []int {
+	counts := make([]int, len(weights))
+	if total <= 0 || len(weights) == 0 {
+		return counts
+	}
+	if total < len(weights) {
+		total = len(weights)
+	}
+	sum := 0.0
+	for _, w := range weights {
+		sum += w
+	}
+	remaining := total
+	for i, w := range weights {
+		portion := 1
+		if sum > 0 {
+			portion = int(math.Round((w / sum) * float64(total)))
+		}
+		if portion < 1 {
+			portion = 1
+		}
+		counts[i] = portion
+		remaining -= portion
+	}
+	for remaining != 0 {
+		index := rng.Intn(len(counts))
+		if remaining > 0 {
+			counts[index]++
+			remaining--
+		} else if counts[index] > 1 {
+			counts[index]--
+			remaining++
+		}
+	}
+	return counts
+}
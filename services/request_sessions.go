@@ -0,0 +1,150 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// sessionIDHeader 会话标识请求头，用于按编码会话 / agent 运行统计用量，不会转发给上游
+	sessionIDHeader = "X-Session-Id"
+	// maxSessionIDLength 会话标识的最大长度，超出部分截断
+	maxSessionIDLength = 128
+)
+
+func sessionFromRequest(c *gin.Context) string {
+	session := strings.TrimSpace(c.GetHeader(sessionIDHeader))
+	if len(session) > maxSessionIDLength {
+		session = session[:maxSessionIDLength]
+	}
+	return session
+}
+
+// SessionStat 单个会话的请求数、token 用量和费用
+type SessionStat struct {
+	SessionID          string   `json:"session_id"`
+	Platforms          []string `json:"platforms"`
+	TotalRequests      int64    `json:"total_requests"`
+	SuccessfulRequests int64    `json:"successful_requests"`
+	InputTokens        int64    `json:"input_tokens"`
+	OutputTokens       int64    `json:"output_tokens"`
+	ReasoningTokens    int64    `json:"reasoning_tokens"`
+	CacheCreateTokens  int64    `json:"cache_create_tokens"`
+	CacheReadTokens    int64    `json:"cache_read_tokens"`
+	CostTotal          float64  `json:"cost_total"`
+	FirstAt            string   `json:"first_at"`
+	LastAt             string   `json:"last_at"`
+}
+
+// SessionStats 按 X-Session-Id 统计最近 days 天的用量和费用（按最近请求时间降序），未携带会话标识的请求不参与统计
+func (ls *LogService) SessionStats(platform string, days int) ([]SessionStat, error) {
+	if days <= 0 {
+		days = 30
+	}
+	since := startOfDay(time.Now()).AddDate(0, 0, -(days - 1))
+	options := []xdb.Option{
+		xdb.WhereGte("created_at", since.Format(timeLayout)),
+		xdb.WhereNotEq("session_id", ""),
+		xdb.Field(
+			"id",
+			"session_id",
+			"platform",
+			"model",
+			"http_code",
+			"input_tokens",
+			"output_tokens",
+			"reasoning_tokens",
+			"cache_create_tokens",
+			"cache_read_tokens",
+			"ephemeral_5m_tokens",
+			"ephemeral_1h_tokens",
+			"created_at",
+		),
+		xdb.OrderByAsc("id"),
+	}
+	if platform != "" {
+		options = append(options, xdb.WhereEq("platform", platform))
+	}
+	records, err := xdb.New("request_log").Selects(options...)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+			return []SessionStat{}, nil
+		}
+		return nil, fmt.Errorf("统计会话用量失败: %w", err)
+	}
+	tiered, err := loadTieredPricing(since)
+	if err != nil {
+		return nil, err
+	}
+
+	statMap := make(map[string]*SessionStat)
+	lastAt := make(map[string]time.Time)
+	for _, record := range records {
+		session := strings.TrimSpace(record.GetString("session_id"))
+		if session == "" {
+			continue
+		}
+		stat := statMap[session]
+		if stat == nil {
+			stat = &SessionStat{SessionID: session, Platforms: []string{}}
+			statMap[session] = stat
+		}
+		if p := record.GetString("platform"); p != "" && !slices.Contains(stat.Platforms, p) {
+			stat.Platforms = append(stat.Platforms, p)
+		}
+		input := record.GetInt("input_tokens")
+		output := record.GetInt("output_tokens")
+		cacheCreate := record.GetInt("cache_create_tokens")
+		cacheRead := record.GetInt("cache_read_tokens")
+		cost := tiered.apply(record.GetInt64("id"), ls.calculateCost(record.GetString("model"), modelpricing.UsageSnapshot{
+			InputTokens:       input,
+			OutputTokens:      output,
+			CacheCreateTokens: cacheCreate,
+			CacheReadTokens:   cacheRead,
+			CacheCreation:     recordCacheCreation(record),
+		}))
+
+		stat.TotalRequests++
+		if code := record.GetInt("http_code"); code >= 200 && code < 300 {
+			stat.SuccessfulRequests++
+		}
+		stat.InputTokens += int64(input)
+		stat.OutputTokens += int64(output)
+		stat.ReasoningTokens += int64(record.GetInt("reasoning_tokens"))
+		stat.CacheCreateTokens += int64(cacheCreate)
+		stat.CacheReadTokens += int64(cacheRead)
+		stat.CostTotal += cost.TotalCost
+
+		if createdAt, ok := parseCreatedAt(record); ok {
+			formatted := createdAt.Format(timeLayout)
+			if stat.FirstAt == "" {
+				stat.FirstAt = formatted
+			}
+			stat.LastAt = formatted
+			lastAt[session] = createdAt
+		}
+	}
+
+	stats := make([]SessionStat, 0, len(statMap))
+	for _, stat := range statMap {
+		sort.Strings(stat.Platforms)
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := lastAt[stats[i].SessionID], lastAt[stats[j].SessionID]
+		if a.Equal(b) {
+			return stats[i].SessionID < stats[j].SessionID
+		}
+		return a.After(b)
+	})
+	return stats, nil
+}
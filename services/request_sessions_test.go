@@ -0,0 +1,68 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSessionIDRecordedInRequestLog(t *testing.T) {
+	setupTestEnv(t)
+
+	var forwarded atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(sessionIDHeader) != "" {
+			forwarded.Add(1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1"}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "upstream", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	for _, session := range []string{"refactor-1", "refactor-1", ""} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`))
+		if session != "" {
+			req.Header.Set(sessionIDHeader, session)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+		}
+	}
+	if forwarded.Load() != 0 {
+		t.Fatalf("X-Session-Id 不应转发给上游")
+	}
+
+	ls := NewLogService()
+	logs, err := ls.QueryLogs(RequestLogQuery{Platform: "claude"})
+	if err != nil || len(logs) != 3 {
+		t.Fatalf("查询日志失败: %v, %d 条", err, len(logs))
+	}
+	if logs[0].SessionID != "" || logs[1].SessionID != "refactor-1" || logs[2].SessionID != "refactor-1" {
+		t.Fatalf("日志应记录会话标识: %q %q %q", logs[0].SessionID, logs[1].SessionID, logs[2].SessionID)
+	}
+	if filtered, err := ls.QueryLogs(RequestLogQuery{Session: "refactor-1"}); err != nil || len(filtered) != 2 {
+		t.Fatalf("按会话过滤失败: %v, %d 条", err, len(filtered))
+	}
+
+	stats, err := ls.SessionStats("", 1)
+	if err != nil {
+		t.Fatalf("会话统计失败: %v", err)
+	}
+	if len(stats) != 1 || stats[0].SessionID != "refactor-1" || stats[0].TotalRequests != 2 || stats[0].SuccessfulRequests != 2 {
+		t.Fatalf("会话统计不正确: %+v", stats)
+	}
+	if len(stats[0].Platforms) != 1 || stats[0].Platforms[0] != "claude" || stats[0].FirstAt == "" {
+		t.Fatalf("会话统计缺少平台或时间: %+v", stats[0])
+	}
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// errResetNotConfirmed 未确认时拒绝重置，避免误操作清空配置
+var errResetNotConfirmed = errors.New("重置为默认配置会清空当前配置，请确认后再操作")
+
+// getDefaultProviders 返回全新安装时的 provider 列表（不预置任何供应商）
+func getDefaultProviders(kind string) []Provider {
+	return []Provider{}
+}
+
+// getDefaultGeminiProviders 返回全新安装时的 Gemini 供应商列表（不预置任何供应商）
+func getDefaultGeminiProviders() []GeminiProvider {
+	return []GeminiProvider{}
+}
+
+// ResetToDefaults 将指定平台的 provider 配置恢复为默认值，confirm 必须为 true
+// 重置前当前配置文件会备份为 <文件名>.bak-<时间>，可手动恢复
+func (ps *ProviderService) ResetToDefaults(kind string, confirm bool) error {
+	if !confirm {
+		return errResetNotConfirmed
+	}
+	path, err := providerFilePath(kind)
+	if err != nil {
+		return err
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, err := backupBeforeReset(path); err != nil {
+		return err
+	}
+	if err := writeProviderFile(path, getDefaultProviders(kind)); err != nil {
+		return fmt.Errorf("写入默认配置失败: %w", err)
+	}
+	delete(ps.snapshots, kind)
+	for _, fn := range ps.listeners {
+		go fn(kind)
+	}
+	return nil
+}
+
+// ResetToDefaults 将 Gemini 供应商列表恢复为默认值，confirm 必须为 true
+// 只重置 gemini-providers.json，不修改 ~/.gemini 下的 CLI 配置
+func (s *GeminiService) ResetToDefaults(confirm bool) error {
+	if !confirm {
+		return errResetNotConfirmed
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := backupBeforeReset(getGeminiProvidersPath()); err != nil {
+		return err
+	}
+	// 已备份，允许覆盖更新版本写入的配置
+	s.newerSchema = 0
+	s.providers = getDefaultGeminiProviders()
+	if err := s.saveProviders(); err != nil {
+		return fmt.Errorf("写入默认配置失败: %w", err)
+	}
+	return nil
+}
+
+// ResetToDefaults 只保留内置 MCP server（清除删除记录），并同步到 Claude/Codex 配置，confirm 必须为 true
+func (ms *MCPService) ResetToDefaults(confirm bool) error {
+	if !confirm {
+		return errResetNotConfirmed
+	}
+	path, err := ms.configPath()
+	if err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, err := backupBeforeReset(path); err != nil {
+		return err
+	}
+	if err := ms.saveSuppressedBuiltIns(nil); err != nil {
+		return fmt.Errorf("清除内置 server 删除记录失败: %w", err)
+	}
+	names := make([]string, 0, len(builtInServers))
+	for name := range builtInServers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	servers := make([]MCPServer, 0, len(names))
+	for _, name := range names {
+		entry := normalizeRawEntry(builtInServers[name])
+		servers = append(servers, MCPServer{
+			Name:           name,
+			Type:           entry.Type,
+			Command:        entry.Command,
+			Args:           cloneArgs(entry.Args),
+			Env:            cloneEnv(entry.Env),
+			URL:            entry.URL,
+			Website:        entry.Website,
+			Tips:           entry.Tips,
+			EnablePlatform: normalizePlatforms(entry.EnablePlatform),
+		})
+	}
+	return ms.saveServersLocked(servers)
+}
+
+// backupBeforeReset 将配置文件复制为 <path>.bak-<时间>，文件不存在时无需备份，返回空路径
+func backupBeforeReset(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	// 同一秒内多次重置时不覆盖之前的备份
+	base := fmt.Sprintf("%s.bak-%s", path, time.Now().Format("20060102-150405"))
+	backupPath := base
+	for i := 1; ; i++ {
+		if _, err := os.Stat(backupPath); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		backupPath = fmt.Sprintf("%s-%d", base, i)
+	}
+	tmp := backupPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return "", fmt.Errorf("备份配置文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, backupPath); err != nil {
+		return "", fmt.Errorf("备份配置文件失败: %w", err)
+	}
+	fmt.Printf("[INFO] 已备份 %s 到 %s\n", path, backupPath)
+	return backupPath, nil
+}
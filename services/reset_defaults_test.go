@@ -0,0 +1,87 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResetToDefaultsBacksUpAndResets(t *testing.T) {
+	setupTestEnv(t)
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "messy", APIURL: "https://messy.example.com", APIKey: "sk-test", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	path, err := providerFilePath("claude")
+	if err != nil {
+		t.Fatalf("获取配置路径失败: %v", err)
+	}
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("读取配置失败: %v", err)
+	}
+
+	if err := ps.ResetToDefaults("claude", false); err == nil {
+		t.Fatalf("未确认时不应重置")
+	}
+	if providers, _ := ps.LoadProviders("claude"); len(providers) != 1 {
+		t.Fatalf("未确认时配置不应变化: %+v", providers)
+	}
+
+	if err := ps.ResetToDefaults("claude", true); err != nil {
+		t.Fatalf("重置失败: %v", err)
+	}
+	if providers, err := ps.LoadProviders("claude"); err != nil || len(providers) != len(getDefaultProviders("claude")) {
+		t.Fatalf("重置后应为默认配置: %+v, %v", providers, err)
+	}
+	backups, _ := filepath.Glob(path + ".bak-*")
+	if len(backups) != 1 {
+		t.Fatalf("应生成 1 个备份, 实际 %v", backups)
+	}
+	if backup, err := os.ReadFile(backups[0]); err != nil || !bytes.Equal(backup, original) {
+		t.Fatalf("备份内容应与重置前一致: %v", err)
+	}
+
+	// 再次重置不能覆盖之前的备份
+	if err := ps.ResetToDefaults("claude", true); err != nil {
+		t.Fatalf("再次重置失败: %v", err)
+	}
+	if backup, _ := os.ReadFile(backups[0]); !bytes.Equal(backup, original) {
+		t.Fatalf("再次重置覆盖了之前的备份")
+	}
+
+	gemini := NewGeminiService(":18100")
+	if err := gemini.AddProvider(GeminiProvider{ID: "g1", Name: "messy", Enabled: true}); err != nil {
+		t.Fatalf("添加 Gemini 供应商失败: %v", err)
+	}
+	if err := gemini.ResetToDefaults(true); err != nil {
+		t.Fatalf("重置 Gemini 失败: %v", err)
+	}
+	if providers := gemini.GetProviders(); len(providers) != 0 {
+		t.Fatalf("Gemini 重置后应为默认配置: %+v", providers)
+	}
+	if backups, _ := filepath.Glob(getGeminiProvidersPath() + ".bak-*"); len(backups) != 1 {
+		t.Fatalf("Gemini 应生成 1 个备份, 实际 %v", backups)
+	}
+
+	mcp := NewMCPService()
+	servers, err := mcp.ListServers()
+	if err != nil {
+		t.Fatalf("读取 MCP 配置失败: %v", err)
+	}
+	servers = append(servers[:0], MCPServer{Name: "custom", Type: "stdio", Command: "custom-mcp"})
+	if err := mcp.SaveServers(servers); err != nil {
+		t.Fatalf("保存 MCP 配置失败: %v", err)
+	}
+	if err := mcp.ResetToDefaults(true); err != nil {
+		t.Fatalf("重置 MCP 失败: %v", err)
+	}
+	servers, err = mcp.ListServers()
+	if err != nil || len(servers) != len(builtInServers) || hasMCPServer(servers, "custom") {
+		t.Fatalf("MCP 重置后应只保留内置 server: %+v, %v", servers, err)
+	}
+}
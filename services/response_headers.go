@@ -0,0 +1,121 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// responseHeaderDenylistKey app_settings 中响应头黑名单的配置键（JSON 数组）
+const responseHeaderDenylistKey = "response_header_denylist"
+
+// defaultResponseHeaderDenylist 默认不转发给客户端的上游响应头，支持以 * 结尾的前缀匹配
+// Set-Cookie 会泄露上游会话；Access-Control-* 与本地 relay 的来源不符；
+// relay 可能改写响应体并改用分块传输，上游的 Content-Length 不再准确
+var defaultResponseHeaderDenylist = []string{
+	"Set-Cookie",
+	"Access-Control-*",
+	"Content-Length",
+}
+
+// GetResponseHeaderDenylist 获取转发响应时剔除的上游响应头（未配置时返回默认列表）
+func (ss *SettingsService) GetResponseHeaderDenylist() ([]string, error) {
+	value, found, err := getSettingValue(responseHeaderDenylistKey)
+	if err != nil {
+		return nil, err
+	}
+	if !found || strings.TrimSpace(value) == "" {
+		return append([]string(nil), defaultResponseHeaderDenylist...), nil
+	}
+	var denylist []string
+	if err := json.Unmarshal([]byte(value), &denylist); err != nil {
+		return nil, fmt.Errorf("解析响应头黑名单失败: %w", err)
+	}
+	return denylist, nil
+}
+
+// SetResponseHeaderDenylist 保存响应头黑名单，传空列表表示全部透传
+func (ss *SettingsService) SetResponseHeaderDenylist(names []string) error {
+	seen := make(map[string]bool, len(names))
+	normalized := make([]string, 0, len(names))
+	var invalid []string
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if !validHeaderName(strings.TrimSuffix(name, "*")) {
+			invalid = append(invalid, name)
+			continue
+		}
+		canonical := canonicalDenyPattern(name)
+		if !seen[canonical] {
+			seen[canonical] = true
+			normalized = append(normalized, canonical)
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return fmt.Errorf("无效的响应头: %s", strings.Join(invalid, ", "))
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return err
+	}
+	return setSettingValue(responseHeaderDenylistKey, string(data))
+}
+
+// ResetResponseHeaderDenylist 恢复默认响应头黑名单
+func (ss *SettingsService) ResetResponseHeaderDenylist() error {
+	return setSettingValue(responseHeaderDenylistKey, "")
+}
+
+// loadResponseHeaderDenylist 读取响应头黑名单，读取失败时退回默认列表，不阻塞转发
+func loadResponseHeaderDenylist(ss *SettingsService) []string {
+	if ss == nil {
+		return defaultResponseHeaderDenylist
+	}
+	denylist, err := ss.GetResponseHeaderDenylist()
+	if err != nil {
+		fmt.Printf("[WARN] 读取响应头黑名单失败: %v\n", err)
+		return defaultResponseHeaderDenylist
+	}
+	return denylist
+}
+
+// stripResponseHeaders 从上游响应头中删除黑名单内的响应头
+func stripResponseHeaders(header http.Header, denylist []string) {
+	if len(header) == 0 || len(denylist) == 0 {
+		return
+	}
+	for name := range header {
+		if responseHeaderDenied(name, denylist) {
+			header.Del(name)
+		}
+	}
+}
+
+// responseHeaderDenied 判断响应头是否命中黑名单（不区分大小写，* 结尾为前缀匹配）
+func responseHeaderDenied(name string, denylist []string) bool {
+	lower := strings.ToLower(name)
+	for _, pattern := range denylist {
+		pattern = strings.ToLower(pattern)
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(lower, prefix) {
+				return true
+			}
+			continue
+		}
+		if lower == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func canonicalDenyPattern(name string) string {
+	if prefix, ok := strings.CutSuffix(name, "*"); ok {
+		return http.CanonicalHeaderKey(prefix) + "*"
+	}
+	return http.CanonicalHeaderKey(name)
+}
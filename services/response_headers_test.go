@@ -0,0 +1,65 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseHeaderDenylist(t *testing.T) {
+	setupTestEnv(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=upstream")
+		w.Header().Set("Access-Control-Allow-Origin", "https://upstream.example.com")
+		w.Header().Set("X-Request-Id", "req-1")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "upstream", APIURL: upstream.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	send := func() http.Header {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`))
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+		}
+		return rec.Header()
+	}
+
+	header := send()
+	if header.Get("Set-Cookie") != "" || header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("默认黑名单中的响应头不应转发: %v", header)
+	}
+	if header.Get("X-Request-Id") != "req-1" || header.Get("Content-Type") != "application/json" {
+		t.Fatalf("未命中黑名单的响应头应转发: %v", header)
+	}
+
+	if err := relay.settingsService.SetResponseHeaderDenylist([]string{"x-request-*"}); err != nil {
+		t.Fatalf("保存响应头黑名单失败: %v", err)
+	}
+	header = send()
+	if header.Get("X-Request-Id") != "" || header.Get("Set-Cookie") != "session=upstream" {
+		t.Fatalf("自定义黑名单未生效: %v", header)
+	}
+
+	if err := relay.settingsService.SetResponseHeaderDenylist([]string{"Bad Header"}); err == nil {
+		t.Fatalf("非法响应头名称应返回错误")
+	}
+	if err := relay.settingsService.ResetResponseHeaderDenylist(); err != nil {
+		t.Fatalf("恢复默认黑名单失败: %v", err)
+	}
+	if header = send(); header.Get("Set-Cookie") != "" {
+		t.Fatalf("恢复默认后 Set-Cookie 不应转发: %v", header)
+	}
+}
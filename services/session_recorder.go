@@ -0,0 +1,361 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxRecordedRequests 单次录制最多保存的请求数，超过后自动停止录制
+	maxRecordedRequests = 500
+	// maxRecordingBytes 单次录制文件的大小上限，超过后自动停止录制
+	maxRecordingBytes = 20 * 1024 * 1024
+	// replaySessionHeader 回放请求携带的请求头，避免回放时被再次录制
+	replaySessionHeader = "X-Replay-Session"
+)
+
+// secretValuePattern 请求体中疑似密钥的值（sk-xxx、AIza 开头的 Google Key 等）
+var secretValuePattern = regexp.MustCompile(`\b(sk-[A-Za-z0-9_\-]{8,}|AIza[A-Za-z0-9_\-]{20,})`)
+
+// recordSkipHeaders 录制时丢弃的请求头（与回放无关或由 HTTP 客户端自动生成）
+var recordSkipHeaders = map[string]bool{
+	"content-length":  true,
+	"host":            true,
+	"connection":      true,
+	"accept-encoding": true,
+	"user-agent":      true,
+}
+
+// RecordedRequest 录制文件中的一个请求（每行一个 JSON）
+type RecordedRequest struct {
+	Time    time.Time         `json:"time"`
+	Kind    string            `json:"kind"`
+	Path    string            `json:"path"`
+	Query   string            `json:"query,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body"`
+}
+
+// RecordingStatus 当前录制状态
+type RecordingStatus struct {
+	Active   bool   `json:"active"`
+	Path     string `json:"path,omitempty"`
+	Requests int    `json:"requests"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// ReplayItem 回放单个请求的结果
+type ReplayItem struct {
+	Path       string `json:"path"`
+	Model      string `json:"model,omitempty"`
+	StatusCode int    `json:"statusCode"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ReplayResult 回放整个录制文件的结果
+type ReplayResult struct {
+	File      string       `json:"file"`
+	Total     int          `json:"total"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Items     []ReplayItem `json:"items"`
+}
+
+// sessionRecorder 把进入 relay 的请求（已脱敏）追加写入录制文件
+type sessionRecorder struct {
+	mu       sync.Mutex
+	file     *os.File
+	path     string
+	requests int
+	bytes    int64
+}
+
+func recordingsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户目录失败: %w", err)
+	}
+	dir := filepath.Join(home, ".code-switch", "recordings")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("创建录制目录失败: %w", err)
+	}
+	return dir, nil
+}
+
+func (r *sessionRecorder) start() (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		return "", fmt.Errorf("已在录制中: %s", r.path)
+	}
+
+	dir, err := recordingsDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("session-%s.jsonl", time.Now().Format("20060102-150405")))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return "", fmt.Errorf("创建录制文件失败: %w", err)
+	}
+	r.file, r.path, r.requests, r.bytes = file, path, 0, 0
+	fmt.Printf("[INFO] 开始录制请求: %s\n", path)
+	return path, nil
+}
+
+func (r *sessionRecorder) stop() RecordingStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := r.statusLocked()
+	r.closeLocked()
+	status.Active = false
+	return status
+}
+
+func (r *sessionRecorder) closeLocked() {
+	if r.file == nil {
+		return
+	}
+	_ = r.file.Close()
+	fmt.Printf("[INFO] 停止录制请求: %s（%d 个请求）\n", r.path, r.requests)
+	r.file = nil
+}
+
+func (r *sessionRecorder) status() RecordingStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.statusLocked()
+}
+
+func (r *sessionRecorder) statusLocked() RecordingStatus {
+	return RecordingStatus{Active: r.file != nil, Path: r.path, Requests: r.requests, Bytes: r.bytes}
+}
+
+// record 录制一个请求，达到数量或大小上限时自动停止
+func (r *sessionRecorder) record(kind string, req *http.Request, body []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil || req.Header.Get(replaySessionHeader) != "" {
+		return
+	}
+
+	line, err := json.Marshal(RecordedRequest{
+		Time:    time.Now(),
+		Kind:    kind,
+		Path:    req.URL.Path,
+		Query:   req.URL.RawQuery,
+		Headers: redactRecordedHeaders(req.Header),
+		Body:    secretValuePattern.ReplaceAllString(string(body), redactedValue),
+	})
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	if r.requests >= maxRecordedRequests || r.bytes+int64(len(line)) > maxRecordingBytes {
+		fmt.Printf("[WARN] 录制已达到上限（%d 个请求 / %d 字节），自动停止\n", maxRecordedRequests, maxRecordingBytes)
+		r.closeLocked()
+		return
+	}
+	if _, err := r.file.Write(line); err != nil {
+		fmt.Printf("[WARN] 写入录制文件失败，停止录制: %v\n", err)
+		r.closeLocked()
+		return
+	}
+	r.requests++
+	r.bytes += int64(len(line))
+}
+
+// redactRecordedHeaders 丢弃认证相关和无关的请求头
+func redactRecordedHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string)
+	for key, values := range header {
+		lower := strings.ToLower(key)
+		if len(values) == 0 || recordSkipHeaders[lower] || isSecretKey(lower) || strings.Contains(lower, "cookie") {
+			continue
+		}
+		headers[key] = values[len(values)-1]
+	}
+	return headers
+}
+
+func (prs *ProviderRelayService) sessionRecorder() *sessionRecorder {
+	prs.stateMu.Lock()
+	defer prs.stateMu.Unlock()
+	if prs.recorder == nil {
+		prs.recorder = &sessionRecorder{}
+	}
+	return prs.recorder
+}
+
+// recordRequest 录制模式下保存进入 relay 的请求
+func (prs *ProviderRelayService) recordRequest(c *gin.Context, kind string, body []byte) {
+	prs.sessionRecorder().record(kind, c.Request, body)
+}
+
+// StartRecording 开启录制模式，返回录制文件路径
+// 录制的请求会去除认证头并隐藏请求体中疑似密钥的值，最多 500 个请求 / 20MB
+func (prs *ProviderRelayService) StartRecording() (string, error) {
+	return prs.sessionRecorder().start()
+}
+
+// StopRecording 停止录制
+func (prs *ProviderRelayService) StopRecording() RecordingStatus {
+	return prs.sessionRecorder().stop()
+}
+
+// GetRecordingStatus 获取录制状态
+func (prs *ProviderRelayService) GetRecordingStatus() RecordingStatus {
+	return prs.sessionRecorder().status()
+}
+
+// ReplaySession 将录制文件中的请求按顺序重新发送到正在运行的 relay，经过完整的选择、降级和日志流程
+// file 为相对路径时从 ~/.code-switch/recordings 中查找
+func (prs *ProviderRelayService) ReplaySession(file string) (*ReplayResult, error) {
+	path, err := resolveRecordingPath(file)
+	if err != nil {
+		return nil, err
+	}
+	requests, err := loadRecording(path)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL, err := prs.localBaseURL()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Minute}
+	result := &ReplayResult{File: path, Items: make([]ReplayItem, 0, len(requests))}
+	for _, recorded := range requests {
+		item := replayRequest(client, baseURL, filepath.Base(path), recorded)
+		result.Total++
+		if item.Error == "" && item.StatusCode >= 200 && item.StatusCode < 300 {
+			result.Succeeded++
+		} else {
+			result.Failed++
+		}
+		result.Items = append(result.Items, item)
+	}
+	fmt.Printf("[INFO] 回放完成: %s | 成功 %d | 失败 %d\n", path, result.Succeeded, result.Failed)
+	return result, nil
+}
+
+func replayRequest(client *http.Client, baseURL string, session string, recorded RecordedRequest) ReplayItem {
+	item := ReplayItem{Path: recorded.Path}
+	if model := extractModel(recorded.Body); model != "" {
+		item.Model = model
+	}
+
+	target := baseURL + recorded.Path
+	if recorded.Query != "" {
+		target += "?" + recorded.Query
+	}
+	req, err := http.NewRequest(http.MethodPost, target, strings.NewReader(recorded.Body))
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+	for key, value := range recorded.Headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set(replaySessionHeader, session)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	item.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	_, _ = io.Copy(io.Discard, resp.Body)
+	item.StatusCode = resp.StatusCode
+	if resp.StatusCode >= http.StatusBadRequest {
+		item.Error = strings.TrimSpace(string(snippet))
+	}
+	return item
+}
+
+func extractModel(body string) string {
+	var payload struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal([]byte(body), &payload); err != nil {
+		return ""
+	}
+	return payload.Model
+}
+
+func resolveRecordingPath(file string) (string, error) {
+	file = strings.TrimSpace(file)
+	if file == "" {
+		return "", fmt.Errorf("录制文件路径不能为空")
+	}
+	if filepath.IsAbs(file) {
+		return file, nil
+	}
+	dir, err := recordingsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, file), nil
+}
+
+func loadRecording(path string) ([]RecordedRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取录制文件失败: %w", err)
+	}
+	requests := make([]RecordedRequest, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxRecordingBytes)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var recorded RecordedRequest
+		if err := json.Unmarshal(line, &recorded); err != nil {
+			return nil, fmt.Errorf("录制文件第 %d 行格式错误: %w", lineNo, err)
+		}
+		requests = append(requests, recorded)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取录制文件失败: %w", err)
+	}
+	return requests, nil
+}
+
+// localBaseURL 返回正在运行的 relay 的本机访问地址
+func (prs *ProviderRelayService) localBaseURL() (string, error) {
+	prs.stateMu.Lock()
+	addr := prs.listenAddr
+	prs.stateMu.Unlock()
+	if !prs.IsRunning() || addr == "" {
+		return "", fmt.Errorf("relay 未运行，无法回放")
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("解析 relay 地址失败: %w", err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port), nil
+}
@@ -1,15 +1,21 @@
 package services
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/daodao97/xgo/xdb"
 )
 
 // SettingsService 管理全局配置
-type SettingsService struct{}
+type SettingsService struct {
+	mu                 sync.Mutex
+	onRelayPortChanged []func(port int) error // relay 端口变更回调
+}
 
 // BlacklistSettings 黑名单配置（基础配置，向后兼容）
 type BlacklistSettings struct {
@@ -41,6 +47,10 @@ type BlacklistLevelConfig struct {
 	// 开关关闭时的行为
 	FallbackMode            string `json:"fallbackMode"`            // fixed=固定拉黑, none=不拉黑
 	FallbackDurationMinutes int    `json:"fallbackDurationMinutes"` // 固定拉黑时长（分钟）
+
+	// 观察期配置：恢复后需连续成功 N 次才视为完全健康（0 表示关闭）
+	ProbationSuccessThreshold int `json:"probationSuccessThreshold"` // 观察期所需连续成功次数
+	ProbationTrafficPercent   int `json:"probationTrafficPercent"`   // 观察期内分配的流量百分比（0-100）
 }
 
 // DefaultBlacklistLevelConfig 返回默认的等级拉黑配置
@@ -59,6 +69,8 @@ func DefaultBlacklistLevelConfig() *BlacklistLevelConfig {
 		L5DurationMinutes:          1440, // 24小时
 		FallbackMode:               "fixed",
 		FallbackDurationMinutes:    30,
+		ProbationSuccessThreshold:  0, // 默认关闭观察期，向后兼容
+		ProbationTrafficPercent:    10,
 	}
 }
 
@@ -218,47 +230,113 @@ func (ss *SettingsService) GetBlacklistSettingsStruct() (*BlacklistSettings, err
 	}, nil
 }
 
-// GetLevelBlacklistEnabled 获取等级拉黑开关状态
+// GetLevelBlacklistEnabled 获取等级拉黑开关状态（即等级拉黑配置中的 enableLevelBlacklist）
 func (ss *SettingsService) GetLevelBlacklistEnabled() (bool, error) {
-	db, err := xdb.DB("default")
+	config, err := ss.GetBlacklistLevelConfig()
 	if err != nil {
-		return false, fmt.Errorf("获取数据库连接失败: %w", err)
+		return false, err
 	}
+	return config.EnableLevelBlacklist, nil
+}
 
-	var enabledStr string
-	err = db.QueryRow(`
-		SELECT value FROM app_settings WHERE key = 'blacklist_level_enabled'
-	`).Scan(&enabledStr)
+// SetLevelBlacklistEnabled 设置等级拉黑开关状态，其他配置项保持不变
+func (ss *SettingsService) SetLevelBlacklistEnabled(enabled bool) error {
+	config, err := ss.GetBlacklistLevelConfig()
+	if err != nil {
+		return err
+	}
+	config.EnableLevelBlacklist = enabled
+	if err := ss.SaveBlacklistLevelConfig(config); err != nil {
+		return fmt.Errorf("设置等级拉黑开关失败: %w", err)
+	}
+	return nil
+}
 
+// getSettingValue 读取 app_settings 中的原始字符串值，记录不存在时 found 为 false
+func getSettingValue(key string) (value string, found bool, err error) {
+	db, err := xdb.DB("default")
 	if err != nil {
-		// 如果找不到记录，返回默认值 false（向后兼容）
-		return false, nil
+		return "", false, fmt.Errorf("获取数据库连接失败: %w", err)
 	}
 
-	return enabledStr == "true", nil
+	err = db.QueryRow(`SELECT value FROM app_settings WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("读取配置 %s 失败: %w", key, err)
+	}
+	return value, true, nil
 }
 
-// SetLevelBlacklistEnabled 设置等级拉黑开关状态
-func (ss *SettingsService) SetLevelBlacklistEnabled(enabled bool) error {
+// setSettingValue 以 UPSERT 方式写入 app_settings
+func setSettingValue(key string, value string) error {
 	db, err := xdb.DB("default")
 	if err != nil {
 		return fmt.Errorf("获取数据库连接失败: %w", err)
 	}
 
-	enabledStr := "false"
-	if enabled {
-		enabledStr = "true"
+	if _, err := db.Exec(`
+		INSERT INTO app_settings (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, key, value); err != nil {
+		return fmt.Errorf("写入配置 %s 失败: %w", key, err)
 	}
+	return nil
+}
 
-	// 使用 UPSERT 模式：如果存在则更新，不存在则插入
-	_, err = db.Exec(`
-		INSERT INTO app_settings (key, value) VALUES ('blacklist_level_enabled', ?)
-		ON CONFLICT(key) DO UPDATE SET value = excluded.value
-	`, enabledStr)
+// getBoolSetting 读取布尔配置，读取失败或不存在时返回 defaultValue
+func getBoolSetting(key string, defaultValue bool) bool {
+	value, found, err := getSettingValue(key)
+	if err != nil || !found {
+		return defaultValue
+	}
+	return value == "true"
+}
 
-	if err != nil {
-		return fmt.Errorf("设置等级拉黑开关失败: %w", err)
+// setBoolSetting 写入布尔配置
+func setBoolSetting(key string, enabled bool) error {
+	return setSettingValue(key, strconv.FormatBool(enabled))
+}
+
+// IsRequestCoalescingEnabled 是否启用请求合并（默认关闭）
+// 启用后，完全相同的并发 count_tokens 等幂等请求只会向上游发送一次
+func (ss *SettingsService) IsRequestCoalescingEnabled() bool {
+	return getBoolSetting("enable_request_coalescing", false)
+}
+
+// SetRequestCoalescingEnabled 设置请求合并开关
+func (ss *SettingsService) SetRequestCoalescingEnabled(enabled bool) error {
+	return setBoolSetting("enable_request_coalescing", enabled)
+}
+
+// IsRequestLogEnabled 是否记录请求日志（默认开启）
+// 关闭后 relay 不再写入 request_log，用量统计、费用分析等功能将没有新数据
+func (ss *SettingsService) IsRequestLogEnabled() bool {
+	return getBoolSetting("enable_request_log", true)
+}
+
+// SetRequestLogEnabled 设置请求日志开关
+func (ss *SettingsService) SetRequestLogEnabled(enabled bool) error {
+	return setBoolSetting("enable_request_log", enabled)
+}
+
+// GetFallbackModel 获取平台的降级模型（为空表示未启用）
+// 没有 provider 支持请求的模型时，relay 会改用降级模型重新选择 provider
+func (ss *SettingsService) GetFallbackModel(kind string) (string, error) {
+	value, _, err := getSettingValue(fallbackModelKey(kind))
+	return strings.TrimSpace(value), err
+}
+
+// SetFallbackModel 设置平台的降级模型，传空字符串表示关闭
+func (ss *SettingsService) SetFallbackModel(kind string, model string) error {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if kind != "claude" && kind != "codex" {
+		return fmt.Errorf("不支持的平台: %s", kind)
 	}
+	return setSettingValue(fallbackModelKey(kind), strings.TrimSpace(model))
+}
 
-	return nil
+func fallbackModelKey(kind string) string {
+	return "fallback_model_" + strings.ToLower(strings.TrimSpace(kind))
 }
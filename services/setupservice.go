@@ -0,0 +1,502 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	setupMarkerFile    = "setup-complete.json"
+	setupCustomPreset  = "自定义"
+	setupReadyTimeout  = 3 * time.Second
+	setupVerifyTimeout = 8 * time.Second
+	// setupGeminiVerifyModel Gemini 连通性验证使用的模型
+	setupGeminiVerifyModel = "gemini-2.5-flash"
+)
+
+// SetupPreset 首次设置可选的预设供应商（各平台的 API 地址，为空表示该平台不支持）
+type SetupPreset struct {
+	Name      string `json:"name"`
+	Site      string `json:"site"`
+	ClaudeURL string `json:"claudeUrl,omitempty"`
+	CodexURL  string `json:"codexUrl,omitempty"`
+	GeminiURL string `json:"geminiUrl,omitempty"`
+}
+
+// SetupConfig 首次设置参数
+type SetupConfig struct {
+	Preset     string   `json:"preset"`     // 预设名称
+	APIKey     string   `json:"apiKey"`     // API Key
+	APIURL     string   `json:"apiUrl"`     // 自定义 API 地址（预设为"自定义"时必填，其余预设可覆盖默认地址）
+	Platforms  []string `json:"platforms"`  // 需要接入的平台：claude / codex / gemini
+	SkipVerify bool     `json:"skipVerify"` // 跳过连通性验证
+}
+
+// SetupStep 设置流程中单个步骤的结果
+type SetupStep struct {
+	Name    string `json:"name"`
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+}
+
+// SetupResult 首次设置结果
+type SetupResult struct {
+	Completed bool        `json:"completed"`
+	Steps     []SetupStep `json:"steps"`
+}
+
+// SetupStatus 首次设置状态
+type SetupStatus struct {
+	Completed   bool     `json:"completed"`
+	CompletedAt string   `json:"completedAt,omitempty"`
+	Platforms   []string `json:"platforms,omitempty"`
+}
+
+// SetupService 首次使用引导：一次完成添加供应商、启用代理、写入 CLI 配置与连通性验证
+type SetupService struct {
+	providerService *ProviderService
+	geminiService   *GeminiService
+	relay           *ProviderRelayService
+	claudeSettings  *ClaudeSettingsService
+	codexSettings   *CodexSettingsService
+}
+
+func NewSetupService(
+	providerService *ProviderService,
+	geminiService *GeminiService,
+	relay *ProviderRelayService,
+	claudeSettings *ClaudeSettingsService,
+	codexSettings *CodexSettingsService,
+) *SetupService {
+	return &SetupService{
+		providerService: providerService,
+		geminiService:   geminiService,
+		relay:           relay,
+		claudeSettings:  claudeSettings,
+		codexSettings:   codexSettings,
+	}
+}
+
+// Start Wails生命周期方法
+func (s *SetupService) Start() error {
+	return nil
+}
+
+// Stop Wails生命周期方法
+func (s *SetupService) Stop() error {
+	return nil
+}
+
+// GetSetupPresets 获取首次设置可选的预设
+func (s *SetupService) GetSetupPresets() []SetupPreset {
+	return getSetupPresets()
+}
+
+func getSetupPresets() []SetupPreset {
+	return []SetupPreset{
+		{
+			Name:      "Anthropic 官方",
+			Site:      "https://console.anthropic.com",
+			ClaudeURL: "https://api.anthropic.com",
+		},
+		{
+			Name:     "OpenAI 官方",
+			Site:     "https://platform.openai.com",
+			CodexURL: "https://api.openai.com/v1",
+		},
+		{
+			Name:      "PackyCode",
+			Site:      "https://www.packyapi.com",
+			ClaudeURL: "https://www.packyapi.com",
+			CodexURL:  "https://www.packyapi.com/v1",
+			GeminiURL: "https://www.packyapi.com",
+		},
+		{
+			Name: setupCustomPreset,
+		},
+	}
+}
+
+// GetSetupStatus 获取首次设置状态（用于决定是否展示引导页）
+func (s *SetupService) GetSetupStatus() (*SetupStatus, error) {
+	path, err := setupMarkerPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &SetupStatus{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取首次设置标记失败: %w", err)
+	}
+
+	var status SetupStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		// 标记文件损坏时按已完成处理，避免反复弹出引导
+		return &SetupStatus{Completed: true}, nil
+	}
+	status.Completed = true
+	return &status, nil
+}
+
+// ResetSetup 清除首次设置标记，下次启动重新展示引导
+func (s *SetupService) ResetSetup() error {
+	path, err := setupMarkerPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("删除首次设置标记失败: %w", err)
+	}
+	return nil
+}
+
+// RunFirstTimeSetup 按所选预设和 Key 完成首次设置，返回每一步的执行结果
+// 参数错误直接返回 error；单个平台失败不会中断其它平台，但只有全部成功才会写入完成标记
+func (s *SetupService) RunFirstTimeSetup(cfg SetupConfig) (*SetupResult, error) {
+	preset, err := findSetupPreset(cfg.Preset)
+	if err != nil {
+		return nil, err
+	}
+	apiKey := strings.TrimSpace(cfg.APIKey)
+	if apiKey == "" {
+		return nil, fmt.Errorf("API Key 不能为空")
+	}
+	platforms, err := normalizeSetupPlatforms(cfg.Platforms)
+	if err != nil {
+		return nil, err
+	}
+	customURL := strings.TrimSpace(cfg.APIURL)
+	if customURL != "" {
+		if err := validateHTTPURL(customURL, "API 地址"); err != nil {
+			return nil, err
+		}
+	} else if preset.Name == setupCustomPreset {
+		return nil, fmt.Errorf("自定义预设必须填写 API 地址")
+	}
+
+	result := &SetupResult{Completed: true}
+	record := func(name string, err error, message string) bool {
+		step := SetupStep{Name: name, Success: err == nil, Message: message}
+		if err != nil {
+			step.Message = err.Error()
+			result.Completed = false
+		}
+		result.Steps = append(result.Steps, step)
+		return err == nil
+	}
+
+	relayErr := s.relay.WaitUntilReady(setupReadyTimeout)
+	record("relay", relayErr, s.relay.Addr())
+
+	var verifyTargets []setupVerifyTarget
+	for _, platform := range platforms {
+		apiURL := customURL
+		if apiURL == "" {
+			apiURL = preset.urlFor(platform)
+		}
+		if apiURL == "" {
+			record(platform+":provider", fmt.Errorf("预设 %s 不支持 %s", preset.Name, platform), "")
+			continue
+		}
+
+		name, err := s.createProvider(platform, preset, apiURL, apiKey)
+		if !record(platform+":provider", err, name) {
+			continue
+		}
+		if !record(platform+":proxy", s.enableProxy(platform), "") {
+			continue
+		}
+		verifyTargets = append(verifyTargets, setupVerifyTarget{platform: platform, name: name, apiURL: apiURL, apiKey: apiKey})
+	}
+
+	if !cfg.SkipVerify {
+		for _, target := range verifyTargets {
+			message, err := s.verifySetupProvider(target)
+			record("verify:"+target.apiURL, err, message)
+		}
+	}
+
+	if result.Completed {
+		if err := writeSetupMarker(platforms); err != nil {
+			record("marker", err, "")
+		}
+	}
+	return result, nil
+}
+
+// createProvider 在对应平台创建供应商，返回供应商名称
+func (s *SetupService) createProvider(platform string, preset SetupPreset, apiURL string, apiKey string) (string, error) {
+	name := preset.Name
+	site := preset.Site
+	if site == "" {
+		site = inferHomepage(apiURL, apiURL)
+	}
+
+	if platform == "gemini" {
+		provider := GeminiProvider{
+			ID:         fmt.Sprintf("gemini-setup-%d", time.Now().UnixNano()),
+			Name:       name,
+			WebsiteURL: site,
+			BaseURL:    apiURL,
+			APIKey:     apiKey,
+			Category:   "third_party",
+			Enabled:    true,
+			EnvConfig: map[string]string{
+				"GOOGLE_GEMINI_BASE_URL": apiURL,
+				"GEMINI_API_KEY":         apiKey,
+			},
+		}
+		if err := s.geminiService.AddProvider(provider); err != nil {
+			return "", fmt.Errorf("添加 Gemini 供应商失败: %w", err)
+		}
+		return name, nil
+	}
+
+	providers, err := s.providerService.LoadProviders(platform)
+	if err != nil {
+		return "", fmt.Errorf("加载供应商列表失败: %w", err)
+	}
+	for _, existing := range providers {
+		if strings.EqualFold(existing.Name, name) {
+			name = fmt.Sprintf("%s %d", preset.Name, nextProviderID(providers))
+			break
+		}
+	}
+
+	accent, tint := defaultVisual(platform)
+	providers = append(providers, Provider{
+		ID:      nextProviderID(providers),
+		Name:    name,
+		APIURL:  apiURL,
+		APIKey:  apiKey,
+		Site:    site,
+		Tint:    tint,
+		Accent:  accent,
+		Enabled: true,
+		Level:   1,
+	})
+	if err := s.providerService.SaveProviders(platform, providers); err != nil {
+		return "", fmt.Errorf("保存供应商失败: %w", err)
+	}
+	return name, nil
+}
+
+// setupPlatforms 支持接入 relay 的全部平台
+var setupPlatforms = []string{"claude", "codex", "gemini"}
+
+// EnableAllProxies 将 Claude、Codex、Gemini 的配置全部重新指向本地 relay（如修改端口或配置被改动后）
+// 单个平台失败不影响其它平台；返回每个平台的结果（成功为 nil），任一平台失败时 error 汇总失败原因
+func (s *SetupService) EnableAllProxies() (map[string]error, error) {
+	return s.applyAllProxies(s.enableProxy)
+}
+
+// DisableAllProxies 恢复 Claude、Codex、Gemini 的原始配置，行为与 EnableAllProxies 对称
+func (s *SetupService) DisableAllProxies() (map[string]error, error) {
+	return s.applyAllProxies(s.disableProxy)
+}
+
+func (s *SetupService) applyAllProxies(apply func(platform string) error) (map[string]error, error) {
+	results := make(map[string]error, len(setupPlatforms))
+	var failed []error
+	for _, platform := range setupPlatforms {
+		err := apply(platform)
+		results[platform] = err
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return results, errors.Join(failed...)
+}
+
+// enableProxy 将对应 CLI 的配置指向本地 relay
+func (s *SetupService) enableProxy(platform string) error {
+	var err error
+	switch platform {
+	case "claude":
+		err = s.claudeSettings.EnableProxy()
+	case "codex":
+		err = s.codexSettings.EnableProxy()
+	case "gemini":
+		err = s.geminiService.EnableProxy()
+	}
+	if err != nil {
+		return fmt.Errorf("写入 %s 配置失败: %w", platform, err)
+	}
+	return nil
+}
+
+// disableProxy 恢复对应 CLI 的原始配置
+func (s *SetupService) disableProxy(platform string) error {
+	var err error
+	switch platform {
+	case "claude":
+		err = s.claudeSettings.DisableProxy()
+	case "codex":
+		err = s.codexSettings.DisableProxy()
+	case "gemini":
+		err = s.geminiService.DisableProxy()
+	}
+	if err != nil {
+		return fmt.Errorf("恢复 %s 配置失败: %w", platform, err)
+	}
+	return nil
+}
+
+func (p SetupPreset) urlFor(platform string) string {
+	switch platform {
+	case "claude":
+		return p.ClaudeURL
+	case "codex":
+		return p.CodexURL
+	case "gemini":
+		return p.GeminiURL
+	}
+	return ""
+}
+
+func findSetupPreset(name string) (SetupPreset, error) {
+	name = strings.TrimSpace(name)
+	for _, preset := range getSetupPresets() {
+		if preset.Name == name {
+			return preset, nil
+		}
+	}
+	return SetupPreset{}, fmt.Errorf("未找到预设 '%s'", name)
+}
+
+// normalizeSetupPlatforms 校验并去重平台列表
+func normalizeSetupPlatforms(platforms []string) ([]string, error) {
+	seen := make(map[string]bool, len(platforms))
+	var result []string
+	for _, platform := range platforms {
+		platform = strings.ToLower(strings.TrimSpace(platform))
+		switch platform {
+		case "claude", "codex", "gemini":
+		default:
+			return nil, fmt.Errorf("不支持的平台: %s", platform)
+		}
+		if !seen[platform] {
+			seen[platform] = true
+			result = append(result, platform)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("至少选择一个平台")
+	}
+	return result, nil
+}
+
+// setupVerifyTarget 首次设置中需要验证的供应商
+type setupVerifyTarget struct {
+	platform string
+	name     string
+	apiURL   string
+	apiKey   string
+}
+
+// verifySetupProvider 用刚创建的供应商发送一个最小的带认证请求，非 2xx 响应视为验证失败
+// Claude / Codex 与 TestProvider 发送相同的请求，Gemini 发送 maxOutputTokens=1 的 generateContent
+func (s *SetupService) verifySetupProvider(target setupVerifyTarget) (string, error) {
+	var (
+		result TestResult
+		err    error
+	)
+	if target.platform == "gemini" {
+		result, err = verifyGeminiEndpoint(target.apiURL, target.apiKey)
+	} else {
+		result, err = s.relay.TestProvider(target.platform, target.name)
+	}
+	if err != nil {
+		return "", err
+	}
+	if result.StatusCode == 0 {
+		return "", fmt.Errorf("无法连接 %s: %s", target.apiURL, result.Error)
+	}
+	message := fmt.Sprintf("HTTP %d，耗时 %dms", result.StatusCode, result.LatencyMs)
+	if !result.Success {
+		if result.Error != "" {
+			return "", fmt.Errorf("验证失败（%s）: %s", message, result.Error)
+		}
+		return "", fmt.Errorf("验证失败（%s）", message)
+	}
+	return message, nil
+}
+
+// verifyGeminiEndpoint 向 Gemini 上游发送一个最小的 generateContent 请求
+func verifyGeminiEndpoint(apiURL, apiKey string) (TestResult, error) {
+	result := TestResult{Model: setupGeminiVerifyModel}
+	body, err := json.Marshal(map[string]any{
+		"contents":         []map[string]any{{"role": "user", "parts": []map[string]string{{"text": "ping"}}}},
+		"generationConfig": map[string]int{"maxOutputTokens": 1},
+	})
+	if err != nil {
+		return result, fmt.Errorf("构建验证请求失败: %w", err)
+	}
+	endpoint := fmt.Sprintf("/v1beta/models/%s:generateContent", setupGeminiVerifyModel)
+	req, err := http.NewRequest(http.MethodPost, joinURL(apiURL, endpoint), bytes.NewReader(body))
+	if err != nil {
+		return result, fmt.Errorf("创建验证请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", apiKey)
+
+	client := &http.Client{Timeout: setupVerifyTimeout}
+	start := time.Now()
+	resp, err := client.Do(req)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	result.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !result.Success {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, providerCheckSnippetBytes))
+		result.Error = strings.TrimSpace(string(snippet))
+	}
+	return result, nil
+}
+
+func setupMarkerPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户目录失败: %w", err)
+	}
+	return filepath.Join(home, ".code-switch", setupMarkerFile), nil
+}
+
+// writeSetupMarker 写入首次设置完成标记
+func writeSetupMarker(platforms []string) error {
+	path, err := setupMarkerPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("创建配置目录失败: %w", err)
+	}
+	data, err := json.MarshalIndent(SetupStatus{
+		Completed:   true,
+		CompletedAt: time.Now().Format(time.RFC3339),
+		Platforms:   platforms,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("写入首次设置标记失败: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestSetupService(t *testing.T) (*SetupService, *ProviderRelayService) {
+	t.Helper()
+	relay, _ := newTestRelay(t)
+	if err := relay.Start(); err != nil {
+		t.Fatalf("启动 relay 失败: %v", err)
+	}
+	t.Cleanup(func() { _ = relay.Stop() })
+
+	svc := NewSetupService(
+		relay.providerService,
+		NewGeminiService(relay.addr),
+		relay,
+		NewClaudeSettingsService(relay.addr),
+		NewCodexSettingsService(relay.addr),
+	)
+	return svc, relay
+}
+
+func TestRunFirstTimeSetup(t *testing.T) {
+	setupTestEnv(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/messages" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"type":"message"}`))
+	}))
+	defer upstream.Close()
+
+	svc, relay := newTestSetupService(t)
+
+	status, err := svc.GetSetupStatus()
+	if err != nil || status.Completed {
+		t.Fatalf("首次启动应未完成设置: %+v, %v", status, err)
+	}
+
+	result, err := svc.RunFirstTimeSetup(SetupConfig{
+		Preset:    setupCustomPreset,
+		APIKey:    "sk-test",
+		APIURL:    upstream.URL,
+		Platforms: []string{"claude", "Claude"},
+	})
+	if err != nil {
+		t.Fatalf("首次设置失败: %v", err)
+	}
+	if !result.Completed {
+		t.Fatalf("首次设置应成功: %+v", result.Steps)
+	}
+	// relay + provider + proxy + verify
+	if len(result.Steps) != 4 {
+		t.Fatalf("步骤数 = %d, 期望 4: %+v", len(result.Steps), result.Steps)
+	}
+
+	providers, err := relay.providerService.LoadProviders("claude")
+	if err != nil || len(providers) != 1 {
+		t.Fatalf("应创建一个 claude provider: %+v, %v", providers, err)
+	}
+	if providers[0].APIURL != upstream.URL || providers[0].APIKey != "sk-test" || !providers[0].Enabled {
+		t.Fatalf("provider 字段不符合预期: %+v", providers[0])
+	}
+
+	proxy, err := svc.claudeSettings.ProxyStatus()
+	if err != nil || !proxy.Enabled {
+		t.Fatalf("claude 代理应已启用: %+v, %v", proxy, err)
+	}
+
+	status, err = svc.GetSetupStatus()
+	if err != nil || !status.Completed || len(status.Platforms) != 1 {
+		t.Fatalf("设置完成后应写入标记: %+v, %v", status, err)
+	}
+
+	if err := svc.ResetSetup(); err != nil {
+		t.Fatalf("重置设置失败: %v", err)
+	}
+	if status, _ := svc.GetSetupStatus(); status.Completed {
+		t.Fatalf("重置后应未完成设置")
+	}
+}
+
+func TestRunFirstTimeSetupPartialFailure(t *testing.T) {
+	setupTestEnv(t)
+	svc, _ := newTestSetupService(t)
+
+	// 官方 Anthropic 预设不支持 codex：claude 成功、codex 失败，不写完成标记
+	result, err := svc.RunFirstTimeSetup(SetupConfig{
+		Preset:     "Anthropic 官方",
+		APIKey:     "sk-test",
+		Platforms:  []string{"claude", "codex"},
+		SkipVerify: true,
+	})
+	if err != nil {
+		t.Fatalf("首次设置返回错误: %v", err)
+	}
+	if result.Completed {
+		t.Fatalf("codex 失败时不应标记完成: %+v", result.Steps)
+	}
+
+	home, _ := os.UserHomeDir()
+	if _, err := os.Stat(filepath.Join(home, ".code-switch", setupMarkerFile)); !os.IsNotExist(err) {
+		t.Fatalf("部分失败时不应写入标记文件")
+	}
+
+	if _, err := svc.RunFirstTimeSetup(SetupConfig{Preset: "不存在", APIKey: "k", Platforms: []string{"claude"}}); err == nil {
+		t.Fatalf("未知预设应返回错误")
+	}
+	if _, err := svc.RunFirstTimeSetup(SetupConfig{Preset: setupCustomPreset, APIKey: "k", Platforms: []string{"claude"}}); err == nil {
+		t.Fatalf("自定义预设缺少 API 地址应返回错误")
+	}
+}
+
+func TestRunFirstTimeSetupVerifyRejectsKey(t *testing.T) {
+	setupTestEnv(t)
+	var paths []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		if r.Header.Get("x-goog-api-key") == "sk-good" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"candidates":[]}`))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid api key"}`))
+	}))
+	defer upstream.Close()
+
+	svc, _ := newTestSetupService(t)
+	result, err := svc.RunFirstTimeSetup(SetupConfig{
+		Preset:    setupCustomPreset,
+		APIKey:    "sk-bad",
+		APIURL:    upstream.URL,
+		Platforms: []string{"codex"},
+	})
+	if err != nil {
+		t.Fatalf("首次设置返回错误: %v", err)
+	}
+	last := result.Steps[len(result.Steps)-1]
+	if result.Completed || last.Success || !strings.Contains(last.Message, "401") || !strings.Contains(last.Message, "invalid api key") {
+		t.Fatalf("上游拒绝 Key 时验证步骤应失败: %+v", result.Steps)
+	}
+	if len(paths) != 1 || paths[0] != "POST /responses" {
+		t.Fatalf("Codex 应发送与 TestProvider 相同的 /responses 请求: %v", paths)
+	}
+
+	paths = nil
+	result, err = svc.RunFirstTimeSetup(SetupConfig{
+		Preset:    setupCustomPreset,
+		APIKey:    "sk-good",
+		APIURL:    upstream.URL,
+		Platforms: []string{"gemini"},
+	})
+	if err != nil || !result.Completed {
+		t.Fatalf("Gemini 验证应成功: %+v, %v", result, err)
+	}
+	if len(paths) != 1 || paths[0] != "POST /v1beta/models/"+setupGeminiVerifyModel+":generateContent" {
+		t.Fatalf("Gemini 应发送最小的 generateContent 请求: %v", paths)
+	}
+}
+
+func TestEnableAllProxies(t *testing.T) {
+	setupTestEnv(t)
+	svc, _ := newTestSetupService(t)
+
+	statuses := func() map[string]bool {
+		claude, err := svc.claudeSettings.ProxyStatus()
+		if err != nil {
+			t.Fatalf("读取 claude 状态失败: %v", err)
+		}
+		codex, err := svc.codexSettings.ProxyStatus()
+		if err != nil {
+			t.Fatalf("读取 codex 状态失败: %v", err)
+		}
+		gemini, err := svc.geminiService.ProxyStatus()
+		if err != nil {
+			t.Fatalf("读取 gemini 状态失败: %v", err)
+		}
+		return map[string]bool{"claude": claude.Enabled, "codex": codex.Enabled, "gemini": gemini.Enabled}
+	}
+
+	results, err := svc.EnableAllProxies()
+	if err != nil {
+		t.Fatalf("启用全部代理失败: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("应返回 3 个平台的结果: %v", results)
+	}
+	for platform, enabled := range statuses() {
+		if results[platform] != nil || !enabled {
+			t.Fatalf("%s 配置应指向 relay: enabled=%v err=%v", platform, enabled, results[platform])
+		}
+	}
+
+	results, err = svc.DisableAllProxies()
+	if err != nil {
+		t.Fatalf("禁用全部代理失败: %v", err)
+	}
+	for platform, enabled := range statuses() {
+		if results[platform] != nil || enabled {
+			t.Fatalf("%s 配置应已恢复: enabled=%v err=%v", platform, enabled, results[platform])
+		}
+	}
+}
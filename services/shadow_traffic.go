@@ -0,0 +1,320 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/daodao97/xgo/xrequest"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// shadowTimeout 影子请求的超时时间，避免评估中的 provider 长时间占用连接
+	shadowTimeout = 5 * time.Minute
+	// maxShadowInflight 同时进行的影子请求上限，超过时直接跳过
+	maxShadowInflight = 8
+	// maxShadowLogError 记录的错误信息最大长度
+	maxShadowLogError = 500
+)
+
+// ShadowConfig 影子流量配置：按采样比例把非流式请求复制一份异步发给影子 provider
+// 影子 provider 的响应不会返回给客户端，也不影响拉黑、熔断和用量统计，只记录到 shadow_log 供对比
+type ShadowConfig struct {
+	Provider      string `json:"provider"`      // 影子 provider 名称，为空表示关闭（无需启用）
+	SamplePercent int    `json:"samplePercent"` // 采样比例（0-100）
+}
+
+// ShadowLog 一次影子请求的对比记录
+type ShadowLog struct {
+	ID                 int64   `json:"id"`
+	Platform           string  `json:"platform"`
+	Model              string  `json:"model"`
+	PrimaryProvider    string  `json:"primary_provider"`
+	PrimarySuccess     bool    `json:"primary_success"`
+	PrimaryDurationSec float64 `json:"primary_duration_sec"`
+	ShadowProvider     string  `json:"shadow_provider"`
+	ShadowHttpCode     int     `json:"shadow_http_code"`
+	ShadowDurationSec  float64 `json:"shadow_duration_sec"`
+	InputTokens        int     `json:"input_tokens"`
+	OutputTokens       int     `json:"output_tokens"`
+	Error              string  `json:"error"`
+	CreatedAt          string  `json:"created_at"`
+}
+
+// GetShadowConfig 获取平台的影子流量配置
+func (ss *SettingsService) GetShadowConfig(kind string) (*ShadowConfig, error) {
+	provider, _, err := getSettingValue(shadowSettingKey("shadow_provider_", kind))
+	if err != nil {
+		return nil, err
+	}
+	percent, _, err := getSettingValue(shadowSettingKey("shadow_sample_percent_", kind))
+	if err != nil {
+		return nil, err
+	}
+	config := &ShadowConfig{Provider: strings.TrimSpace(provider)}
+	if percent != "" {
+		config.SamplePercent, _ = strconv.Atoi(percent)
+	}
+	return config, nil
+}
+
+// SetShadowConfig 设置平台的影子流量配置，provider 为空表示关闭
+func (ss *SettingsService) SetShadowConfig(kind string, config ShadowConfig) error {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if kind != "claude" && kind != "codex" {
+		return fmt.Errorf("不支持的平台: %s", kind)
+	}
+	if config.SamplePercent < 0 || config.SamplePercent > 100 {
+		return fmt.Errorf("采样比例必须在 0-100 之间: %d", config.SamplePercent)
+	}
+	if err := setSettingValue(shadowSettingKey("shadow_provider_", kind), strings.TrimSpace(config.Provider)); err != nil {
+		return err
+	}
+	return setSettingValue(shadowSettingKey("shadow_sample_percent_", kind), strconv.Itoa(config.SamplePercent))
+}
+
+func shadowSettingKey(prefix string, kind string) string {
+	return prefix + strings.ToLower(strings.TrimSpace(kind))
+}
+
+// shadowRequest 主请求完成后复制给影子 provider 的请求
+type shadowRequest struct {
+	kind            string
+	endpoint        string
+	query           map[string]string
+	headers         map[string]string
+	body            []byte // 模型映射前的请求体，影子 provider 使用自己的映射
+	model           string
+	client          requestClient
+	primary         string
+	primarySuccess  bool
+	primaryDuration time.Duration
+}
+
+// mirrorToShadow 按配置决定是否发送影子请求，命中采样时异步执行，不阻塞客户端
+func (prs *ProviderRelayService) mirrorToShadow(req shadowRequest) {
+	if prs.settingsService == nil {
+		return
+	}
+	config, err := prs.settingsService.GetShadowConfig(req.kind)
+	if err != nil || config.Provider == "" || config.Provider == req.primary || config.SamplePercent <= 0 {
+		return
+	}
+	if config.SamplePercent < 100 && rand.Intn(100) >= config.SamplePercent {
+		return
+	}
+	if prs.shadowInflight.Add(1) > maxShadowInflight {
+		prs.shadowInflight.Add(-1)
+		fmt.Printf("[WARN] 影子请求过多，已跳过: %s\n", config.Provider)
+		return
+	}
+
+	go func() {
+		defer prs.shadowInflight.Add(-1)
+		prs.sendShadow(req, config.Provider)
+	}()
+}
+
+func (prs *ProviderRelayService) sendShadow(req shadowRequest, name string) {
+	entry := ShadowLog{
+		Platform:           req.kind,
+		Model:              req.model,
+		PrimaryProvider:    req.primary,
+		PrimarySuccess:     req.primarySuccess,
+		PrimaryDurationSec: req.primaryDuration.Seconds(),
+		ShadowProvider:     name,
+	}
+	defer func() {
+		if err := insertShadowLog(entry); err != nil {
+			fmt.Printf("[WARN] 写入 shadow_log 失败: %v\n", err)
+		}
+	}()
+
+	provider, err := prs.shadowProvider(req.kind, name, req.model)
+	if err != nil {
+		entry.Error = err.Error()
+		return
+	}
+
+	body := req.body
+	if effective := provider.GetEffectiveModelForClient(req.model, req.client); effective != req.model && req.model != "" {
+		if body, err = ReplaceModelInRequestBody(body, effective); err != nil {
+			entry.Error = err.Error()
+			return
+		}
+	}
+	if len(provider.BodyOverrides) > 0 {
+		if modified, err := applyBodyOverrides(body, provider.BodyOverrides); err == nil {
+			body = modified
+		}
+	}
+	headers := cloneMap(req.headers)
+	applyGlobalHeaders(headers, loadGlobalHeaders(prs.settingsService))
+	applyProviderHeaders(headers, provider)
+	applyProviderAuth(headers, provider)
+	if _, ok := headers["Accept"]; !ok {
+		headers["Accept"] = "application/json"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+	defer cancel()
+	httpReq := xrequest.New().
+		WithContext(ctx).
+		SetHeaders(headers).
+		SetQueryParams(req.query).
+		SetBody(bytes.NewReader(body))
+	client, err := upstreamHTTPClient(provider.Name, provider.InsecureSkipVerify, provider.upstreamOverride(), 0)
+	if err != nil {
+		entry.Error = fmt.Sprintf("构建上游 TLS 配置失败: %v", err)
+		return
+	}
+	if client != nil {
+		httpReq = httpReq.SetClient(client)
+	}
+
+	start := time.Now()
+	resp, err := httpReq.Post(joinURL(provider.APIURL, req.endpoint))
+	entry.ShadowDurationSec = time.Since(start).Seconds()
+	if err != nil {
+		entry.Error = err.Error()
+		return
+	}
+	if resp == nil {
+		entry.Error = "empty response"
+		return
+	}
+	entry.ShadowHttpCode = resp.StatusCode()
+	if resp.Error() != nil {
+		entry.Error = resp.Error().Error()
+		return
+	}
+	data := resp.Bytes()
+	entry.InputTokens, entry.OutputTokens = shadowUsage(req.kind, req.endpoint, data)
+	if entry.ShadowHttpCode >= 300 {
+		entry.Error = fmt.Sprintf("upstream status %d", entry.ShadowHttpCode)
+	}
+	fmt.Printf("[INFO] 影子请求 %s: HTTP %d | 耗时 %.2fs（主 provider %s %.2fs）\n",
+		name, entry.ShadowHttpCode, entry.ShadowDurationSec, req.primary, entry.PrimaryDurationSec)
+}
+
+// shadowProvider 查找影子 provider：无需启用，但需要配置完整并支持请求的模型
+func (prs *ProviderRelayService) shadowProvider(kind string, name string, model string) (Provider, error) {
+	providers, err := prs.providerService.LoadProviders(kind)
+	if err != nil {
+		return Provider{}, fmt.Errorf("加载 provider 失败: %w", err)
+	}
+	for _, provider := range providers {
+		if provider.Name != name {
+			continue
+		}
+		if provider.APIURL == "" || provider.APIKey == "" {
+			return Provider{}, fmt.Errorf("影子 provider %s 未配置 API URL 或 API Key", name)
+		}
+		if model != "" && !provider.IsModelSupported(model) {
+			return Provider{}, fmt.Errorf("影子 provider %s 不支持模型 %s", name, model)
+		}
+		return provider, nil
+	}
+	return Provider{}, fmt.Errorf("影子 provider %s 不存在", name)
+}
+
+// shadowUsage 从非流式响应中解析 token 用量
+func shadowUsage(kind string, endpoint string, data []byte) (int, int) {
+	usage := &ReqeustLog{}
+	payload := string(data)
+	switch {
+	case endpoint == chatCompletionsEndpoint:
+		ChatCompletionsParseTokenUsageFromResponse(payload, usage)
+	case kind == "codex":
+		usage.InputTokens = int(gjson.Get(payload, "usage.input_tokens").Int())
+		usage.OutputTokens = int(gjson.Get(payload, "usage.output_tokens").Int())
+	default:
+		ClaudeCodeParseTokenUsageFromResponse(payload, usage)
+	}
+	return usage.InputTokens, usage.OutputTokens
+}
+
+func insertShadowLog(entry ShadowLog) error {
+	if len(entry.Error) > maxShadowLogError {
+		entry.Error = entry.Error[:maxShadowLogError]
+	}
+	_, err := xdb.New("shadow_log").Insert(xdb.Record{
+		"platform":             entry.Platform,
+		"model":                entry.Model,
+		"primary_provider":     entry.PrimaryProvider,
+		"primary_success":      boolToInt(entry.PrimarySuccess),
+		"primary_duration_sec": entry.PrimaryDurationSec,
+		"shadow_provider":      entry.ShadowProvider,
+		"shadow_http_code":     entry.ShadowHttpCode,
+		"shadow_duration_sec":  entry.ShadowDurationSec,
+		"input_tokens":         entry.InputTokens,
+		"output_tokens":        entry.OutputTokens,
+		"error":                entry.Error,
+	})
+	return err
+}
+
+// ListShadowLogs 查询影子请求记录（按时间倒序），platform 为空时返回全部平台
+func (ls *LogService) ListShadowLogs(platform string, limit int) ([]ShadowLog, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	options := []xdb.Option{xdb.OrderByDesc("id"), xdb.Limit(limit)}
+	if platform != "" {
+		options = append(options, xdb.WhereEq("platform", platform))
+	}
+	records, err := xdb.New("shadow_log").Selects(options...)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+			return []ShadowLog{}, nil
+		}
+		return nil, err
+	}
+	logs := make([]ShadowLog, 0, len(records))
+	for _, record := range records {
+		logs = append(logs, ShadowLog{
+			ID:                 record.GetInt64("id"),
+			Platform:           record.GetString("platform"),
+			Model:              record.GetString("model"),
+			PrimaryProvider:    record.GetString("primary_provider"),
+			PrimarySuccess:     record.GetInt("primary_success") == 1,
+			PrimaryDurationSec: record.GetFloat64("primary_duration_sec"),
+			ShadowProvider:     record.GetString("shadow_provider"),
+			ShadowHttpCode:     record.GetInt("shadow_http_code"),
+			ShadowDurationSec:  record.GetFloat64("shadow_duration_sec"),
+			InputTokens:        record.GetInt("input_tokens"),
+			OutputTokens:       record.GetInt("output_tokens"),
+			Error:              record.GetString("error"),
+			CreatedAt:          record.GetString("created_at"),
+		})
+	}
+	return logs, nil
+}
+
+func ensureShadowLogTableWithDB(db *sql.DB) error {
+	const createTableSQL = `CREATE TABLE IF NOT EXISTS shadow_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		platform TEXT,
+		model TEXT,
+		primary_provider TEXT,
+		primary_success INTEGER DEFAULT 0,
+		primary_duration_sec REAL DEFAULT 0,
+		shadow_provider TEXT,
+		shadow_http_code INTEGER DEFAULT 0,
+		shadow_duration_sec REAL DEFAULT 0,
+		input_tokens INTEGER DEFAULT 0,
+		output_tokens INTEGER DEFAULT 0,
+		error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`
+	_, err := db.Exec(createTableSQL)
+	return err
+}
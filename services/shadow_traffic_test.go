@@ -0,0 +1,106 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/tidwall/gjson"
+)
+
+func TestShadowTrafficMirrorsToCandidate(t *testing.T) {
+	setupTestEnv(t)
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"primary","usage":{"input_tokens":1,"output_tokens":2}}`))
+	}))
+	defer primary.Close()
+	var shadowHits int32
+	shadowBodies := make(chan string, 4)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&shadowHits, 1)
+		body, _ := io.ReadAll(r.Body)
+		shadowBodies <- string(body)
+		_, _ = w.Write([]byte(`{"id":"shadow","usage":{"input_tokens":10,"output_tokens":20}}`))
+	}))
+	defer shadow.Close()
+
+	relay, router := newTestRelay(t)
+	// 影子 provider 未启用，不参与正常选择
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "primary", APIURL: primary.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+		{ID: 2, Name: "candidate", APIURL: shadow.URL, APIKey: "sk-test", Level: 1,
+			SupportedModels: map[string]bool{"candidate/claude-*": true},
+			ModelMapping:    map[string]string{"claude-*": "candidate/claude-*"}},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	if err := relay.settingsService.SetShadowConfig("claude", ShadowConfig{Provider: "candidate", SamplePercent: 100}); err != nil {
+		t.Fatalf("保存影子配置失败: %v", err)
+	}
+
+	send := func(body string) string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+		}
+		return rec.Body.String()
+	}
+
+	if got := gjson.Get(send(`{"model":"claude-sonnet-4"}`), "id").String(); got != "primary" {
+		t.Fatalf("客户端只应收到主 provider 的响应, 实际 %s", got)
+	}
+	select {
+	case body := <-shadowBodies:
+		if got := gjson.Get(body, "model").String(); got != "candidate/claude-sonnet-4" {
+			t.Fatalf("影子请求应使用影子 provider 的模型映射, 实际 %s", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("影子 provider 未收到请求")
+	}
+
+	var logs []ShadowLog
+	deadline := time.Now().Add(2 * time.Second)
+	for len(logs) == 0 && time.Now().Before(deadline) {
+		var err error
+		if logs, err = (&LogService{}).ListShadowLogs("claude", 10); err != nil {
+			t.Fatalf("查询影子记录失败: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("应记录 1 条影子请求, 实际 %d", len(logs))
+	}
+	entry := logs[0]
+	if entry.PrimaryProvider != "primary" || !entry.PrimarySuccess || entry.ShadowProvider != "candidate" ||
+		entry.ShadowHttpCode != http.StatusOK || entry.InputTokens != 10 || entry.OutputTokens != 20 {
+		t.Fatalf("影子记录不符合预期: %+v", entry)
+	}
+
+	// 影子请求不计入用量统计
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatalf("获取数据库失败: %v", err)
+	}
+	var shadowRows int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM request_log WHERE provider = ?`, "candidate").Scan(&shadowRows); err != nil {
+		t.Fatalf("查询 request_log 失败: %v", err)
+	}
+	if shadowRows != 0 {
+		t.Fatalf("影子请求不应写入 request_log, 实际 %d 条", shadowRows)
+	}
+
+	// 流式请求不复制
+	send(`{"model":"claude-sonnet-4","stream":true}`)
+	if relay.shadowInflight.Load() != 0 || atomic.LoadInt32(&shadowHits) != 1 {
+		t.Fatalf("流式请求不应发送影子请求")
+	}
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// speedTestCacheSecondsKey app_settings 中 provider 测速结果缓存时长的配置键（秒）
+	speedTestCacheSecondsKey = "speedtest_cache_seconds"
+	// defaultSpeedTestCacheSeconds 默认缓存 60 秒，避免反复点击测速时频繁请求上游
+	defaultSpeedTestCacheSeconds = 60
+	maxSpeedTestCacheSeconds     = 3600
+
+	defaultSpeedTestSamples = 3
+	maxSpeedTestSamples     = 10
+	// speedTestBodyLimit 计算总耗时时最多读取的响应体字节数
+	speedTestBodyLimit = 64 * 1024
+)
+
+// SpeedTestResult 单个 provider 的测速结果（耗时单位为毫秒）
+type SpeedTestResult struct {
+	ProviderID    int64  `json:"providerId"`
+	Provider      string `json:"provider"`
+	URL           string `json:"url"`
+	Samples       int    `json:"samples"`   // 计划采样次数
+	Successes     int    `json:"successes"` // 收到响应的次数（任意状态码都算，只衡量网络延迟）
+	Status        int    `json:"status,omitempty"`
+	MedianTTFBMs  int64  `json:"medianTtfbMs"`
+	P95TTFBMs     int64  `json:"p95TtfbMs"`
+	MedianTotalMs int64  `json:"medianTotalMs"`
+	P95TotalMs    int64  `json:"p95TotalMs"`
+	Error         string `json:"error,omitempty"` // 全部采样失败时的错误
+}
+
+type speedTestCacheEntry struct {
+	at      time.Time
+	results []SpeedTestResult
+}
+
+// GetProviderTestCacheSeconds 获取 provider 测速结果的缓存时长（秒，0 表示不缓存）
+func (s *SpeedTestService) GetProviderTestCacheSeconds() int {
+	value, found, err := getSettingValue(speedTestCacheSecondsKey)
+	if err != nil || !found {
+		return defaultSpeedTestCacheSeconds
+	}
+	seconds, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || seconds < 0 {
+		return defaultSpeedTestCacheSeconds
+	}
+	return seconds
+}
+
+// SetProviderTestCacheSeconds 设置 provider 测速结果的缓存时长（0-3600 秒，0 表示不缓存）
+func (s *SpeedTestService) SetProviderTestCacheSeconds(seconds int) error {
+	if seconds < 0 || seconds > maxSpeedTestCacheSeconds {
+		return fmt.Errorf("缓存时长必须在 0-%d 秒之间", maxSpeedTestCacheSeconds)
+	}
+	if err := setSettingValue(speedTestCacheSecondsKey, strconv.Itoa(seconds)); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.cache = nil
+	s.mu.Unlock()
+	return nil
+}
+
+// TestProviders 并发测量平台下所有已启用 provider 的 API 地址延迟，按中位总耗时从快到慢排序（全部失败的排在最后）
+// 每个 provider 依次采样 samples 次（默认 3，最多 10），每次请求的超时为 timeoutSecs（默认 8 秒）；
+// 连接失败或超时后不再继续采样该 provider，避免拖慢整个测试。缓存时长内重复调用直接返回上次结果
+func (s *SpeedTestService) TestProviders(kind string, samples int, timeoutSecs *int) ([]SpeedTestResult, error) {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if samples <= 0 {
+		samples = defaultSpeedTestSamples
+	}
+	if samples > maxSpeedTestSamples {
+		samples = maxSpeedTestSamples
+	}
+
+	cacheKey := fmt.Sprintf("%s:%d", kind, samples)
+	ttl := time.Duration(s.GetProviderTestCacheSeconds()) * time.Second
+	s.mu.Lock()
+	if entry, ok := s.cache[cacheKey]; ok && ttl > 0 && time.Since(entry.at) < ttl {
+		s.mu.Unlock()
+		return append([]SpeedTestResult(nil), entry.results...), nil
+	}
+	s.mu.Unlock()
+
+	if s.providerService == nil {
+		return nil, fmt.Errorf("测速服务未绑定 provider 服务")
+	}
+	providers, err := s.providerService.LoadProviders(kind)
+	if err != nil {
+		return nil, fmt.Errorf("加载 provider 失败: %w", err)
+	}
+
+	timeout := time.Duration(s.sanitizeTimeout(timeoutSecs)) * time.Second
+	results := make([]SpeedTestResult, 0, len(providers))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, provider := range providers {
+		if !provider.Enabled || strings.TrimSpace(provider.APIURL) == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(provider Provider) {
+			defer wg.Done()
+			result := s.measureProvider(provider, samples, timeout)
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}(provider)
+	}
+	wg.Wait()
+	sortSpeedTestResults(results)
+
+	s.mu.Lock()
+	if s.cache == nil {
+		s.cache = make(map[string]speedTestCacheEntry)
+	}
+	s.cache[cacheKey] = speedTestCacheEntry{at: time.Now(), results: append([]SpeedTestResult(nil), results...)}
+	s.mu.Unlock()
+	return results, nil
+}
+
+// measureProvider 依次对 provider 的 API 地址发送 samples 次 GET 请求，统计首字节耗时与总耗时
+func (s *SpeedTestService) measureProvider(provider Provider, samples int, timeout time.Duration) SpeedTestResult {
+	target := strings.TrimSpace(provider.APIURL)
+	result := SpeedTestResult{ProviderID: provider.ID, Provider: provider.Name, URL: target, Samples: samples}
+
+	client, err := upstreamHTTPClient(provider.Name, provider.InsecureSkipVerify, provider.upstreamOverride(), timeout)
+	if err != nil {
+		result.Error = fmt.Sprintf("构建上游 TLS 配置失败: %v", err)
+		return result
+	}
+	if client == nil {
+		client = s.buildClient(int(timeout / time.Second))
+	}
+
+	var ttfbs, totals []time.Duration
+	for i := 0; i < samples; i++ {
+		ttfb, total, status, err := s.probeOnce(client, target)
+		if err != nil {
+			// 连接失败或超时：继续采样大概率同样失败，直接结束
+			result.Error = s.formatError(err)
+			break
+		}
+		result.Status = status
+		ttfbs = append(ttfbs, ttfb)
+		totals = append(totals, total)
+	}
+
+	result.Successes = len(totals)
+	if result.Successes > 0 {
+		result.Error = ""
+		result.MedianTTFBMs = percentileMs(ttfbs, 50)
+		result.P95TTFBMs = percentileMs(ttfbs, 95)
+		result.MedianTotalMs = percentileMs(totals, 50)
+		result.P95TotalMs = percentileMs(totals, 95)
+	}
+	return result
+}
+
+// probeOnce 发送一次 GET 请求，返回首字节耗时、读取完响应体的总耗时和状态码
+func (s *SpeedTestService) probeOnce(client *http.Client, target string) (time.Duration, time.Duration, int, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	req.Header.Set("User-Agent", "cc-r-speedtest/1.0")
+
+	var firstByte time.Time
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, speedTestBodyLimit))
+	total := time.Since(start)
+
+	ttfb := total
+	if !firstByte.IsZero() {
+		ttfb = firstByte.Sub(start)
+	}
+	return ttfb, total, resp.StatusCode, nil
+}
+
+// percentileMs 按最近秩法计算百分位（毫秒）
+func percentileMs(values []time.Duration, p float64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1].Milliseconds()
+}
+
+// sortSpeedTestResults 按中位总耗时升序排序，全部失败的排在最后，耗时相同时按名称排序
+func sortSpeedTestResults(results []SpeedTestResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if (a.Successes > 0) != (b.Successes > 0) {
+			return a.Successes > 0
+		}
+		if a.MedianTotalMs != b.MedianTotalMs {
+			return a.MedianTotalMs < b.MedianTotalMs
+		}
+		return a.Provider < b.Provider
+	})
+}
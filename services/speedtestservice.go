@@ -23,11 +23,16 @@ type EndpointLatency struct {
 }
 
 // SpeedTestService 测速服务
-type SpeedTestService struct{}
+type SpeedTestService struct {
+	providerService *ProviderService
+
+	mu    sync.Mutex
+	cache map[string]speedTestCacheEntry // kind + 采样次数 -> 最近一次 provider 测速结果
+}
 
 // NewSpeedTestService 创建测速服务
-func NewSpeedTestService() *SpeedTestService {
-	return &SpeedTestService{}
+func NewSpeedTestService(providerService *ProviderService) *SpeedTestService {
+	return &SpeedTestService{providerService: providerService}
 }
 
 // Start Wails生命周期方法
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSpeedTestProvidersRanksAndCaches(t *testing.T) {
+	setupTestEnv(t)
+
+	var fastHits, slowHits int32
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fastHits, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer fast.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&slowHits, 1)
+		time.Sleep(80 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	deadURL := dead.URL
+	dead.Close()
+
+	providerService := NewProviderService()
+	if err := providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "slow", APIURL: slow.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+		{ID: 2, Name: "dead", APIURL: deadURL, APIKey: "sk-test", Enabled: true, Level: 1},
+		{ID: 3, Name: "fast", APIURL: fast.URL, APIKey: "sk-test", Enabled: true, Level: 1},
+		{ID: 4, Name: "disabled", APIURL: fast.URL, APIKey: "sk-test", Enabled: false, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	service := NewSpeedTestService(providerService)
+	results, err := service.TestProviders("claude", 3, nil)
+	if err != nil {
+		t.Fatalf("测速失败: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("应只测试已启用的 3 个 provider，实际 %d 个: %+v", len(results), results)
+	}
+	if results[0].Provider != "fast" || results[1].Provider != "slow" || results[2].Provider != "dead" {
+		t.Fatalf("排序应为 fast、slow、dead，实际: %s、%s、%s", results[0].Provider, results[1].Provider, results[2].Provider)
+	}
+	if results[0].Successes != 3 || results[0].Status != http.StatusNotFound {
+		t.Fatalf("非 2xx 响应也应计入延迟采样: %+v", results[0])
+	}
+	if results[1].MedianTotalMs < 80 || results[1].P95TotalMs < results[1].MedianTotalMs {
+		t.Fatalf("slow 的中位/p95 耗时不正确: %+v", results[1])
+	}
+	if results[1].MedianTTFBMs > results[1].MedianTotalMs {
+		t.Fatalf("首字节耗时不应大于总耗时: %+v", results[1])
+	}
+	if results[2].Successes != 0 || results[2].Error == "" {
+		t.Fatalf("无法连接的 provider 应返回错误: %+v", results[2])
+	}
+
+	// 缓存时长内重复测速不再请求上游
+	if _, err := service.TestProviders("claude", 3, nil); err != nil {
+		t.Fatalf("再次测速失败: %v", err)
+	}
+	if got := atomic.LoadInt32(&fastHits); got != 3 {
+		t.Fatalf("缓存期内不应重复请求上游，fast 共收到 %d 次请求", got)
+	}
+
+	// 关闭缓存后每次都重新测速
+	if err := service.SetProviderTestCacheSeconds(0); err != nil {
+		t.Fatalf("设置缓存时长失败: %v", err)
+	}
+	if got := service.GetProviderTestCacheSeconds(); got != 0 {
+		t.Fatalf("缓存时长应为 0，实际 %d", got)
+	}
+	if _, err := service.TestProviders("claude", 1, nil); err != nil {
+		t.Fatalf("关闭缓存后测速失败: %v", err)
+	}
+	if got := atomic.LoadInt32(&slowHits); got != 4 {
+		t.Fatalf("关闭缓存后应重新请求上游，slow 共收到 %d 次请求", got)
+	}
+	if err := service.SetProviderTestCacheSeconds(maxSpeedTestCacheSeconds + 1); err == nil {
+		t.Fatalf("超出范围的缓存时长应报错")
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// maxPendingSSELine 单行 SSE 数据的缓冲上限，超过后丢弃该行，避免异常响应占满内存
+const maxPendingSSELine = 8 * 1024 * 1024
+
+// sseLineParser 有状态的 SSE 行解析器：跨 chunk 拼接被截断的行，收到完整的 data: 行后再解析 token 用量
+// xrequest 钩子和 Gemini 流式转发拿到的 chunk 边界都是任意的，一行 JSON 可能被拆到多个 chunk 中
+type sseLineParser struct {
+	parser  func(string, *ReqeustLog)
+	usage   *ReqeustLog
+	pending []byte
+	skip    bool // 当前行超出缓冲上限，丢弃到下一个换行为止
+}
+
+func newSSELineParser(parser func(string, *ReqeustLog), usage *ReqeustLog) *sseLineParser {
+	return &sseLineParser{parser: parser, usage: usage}
+}
+
+// Feed 写入一个 chunk，解析其中所有完整的行，末尾不完整的行留待下一个 chunk 拼接
+func (p *sseLineParser) Feed(chunk []byte) {
+	for len(chunk) > 0 {
+		idx := bytes.IndexByte(chunk, '\n')
+		if idx < 0 {
+			p.appendPending(chunk)
+			break
+		}
+		p.appendPending(chunk[:idx])
+		p.completeLine()
+		chunk = chunk[idx+1:]
+	}
+
+	// 流结束时最后一行可能没有换行符：若缓冲的 data: 行已是完整 JSON，直接解析，无需等待后续 chunk
+	if data, ok := sseDataPayload(p.pending); ok && !p.skip && gjson.Valid(data) {
+		p.completeLine()
+	}
+}
+
+// Flush 解析缓冲区中剩余的内容，在响应结束时调用
+func (p *sseLineParser) Flush() {
+	p.completeLine()
+}
+
+func (p *sseLineParser) appendPending(data []byte) {
+	if p.skip {
+		return
+	}
+	if len(p.pending)+len(data) > maxPendingSSELine {
+		fmt.Printf("[WARN] SSE 单行数据超过 %d 字节，已跳过 token 解析\n", maxPendingSSELine)
+		p.pending = p.pending[:0]
+		p.skip = true
+		return
+	}
+	p.pending = append(p.pending, data...)
+}
+
+func (p *sseLineParser) completeLine() {
+	if !p.skip {
+		if data, ok := sseDataPayload(p.pending); ok {
+			p.parser(data, p.usage)
+		}
+	}
+	p.pending = p.pending[:0]
+	p.skip = false
+}
+
+// sseDataPayload 提取 data: 行的内容（兼容 "data:" 后有无空格两种写法）
+func sseDataPayload(line []byte) (string, bool) {
+	trimmed := strings.TrimSpace(string(line))
+	data, ok := strings.CutPrefix(trimmed, "data:")
+	if !ok {
+		return "", false
+	}
+	return strings.TrimSpace(data), true
+}
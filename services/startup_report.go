@@ -0,0 +1,173 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// StartupReportEvent 启动诊断报告的前端事件名
+const StartupReportEvent = "startup:report"
+
+// startupRelayWait 生成报告前等待 relay 绑定端口的最长时间
+const startupRelayWait = 5 * time.Second
+
+// StartupProviderSummary 某个平台的 provider 统计
+type StartupProviderSummary struct {
+	Platform    string `json:"platform"`
+	Total       int    `json:"total"`
+	Enabled     int    `json:"enabled"`
+	Blacklisted int    `json:"blacklisted"`
+}
+
+// StartupReport 启动时的环境快照，便于用户和支持人员排查问题
+type StartupReport struct {
+	Version        string                   `json:"version"`
+	OS             string                   `json:"os"`
+	ConfigDir      string                   `json:"configDir"`
+	RelayAddr      string                   `json:"relayAddr"`
+	RelayListening bool                     `json:"relayListening"`
+	DBPath         string                   `json:"dbPath"`
+	DBHealthy      bool                     `json:"dbHealthy"`
+	DBRepair       *DatabaseRepair          `json:"dbRepair,omitempty"` // 启动时检测到数据库损坏并已重建
+	Providers      []StartupProviderSummary `json:"providers"`
+	UpdateMode     string                   `json:"updateMode"` // portable / installer
+	AutoCheck      bool                     `json:"autoCheck"`
+	UpdateReady    bool                     `json:"updateReady"`
+	Warnings       []string                 `json:"warnings"`
+	GeneratedAt    time.Time                `json:"generatedAt"`
+}
+
+// StartupReportSources 生成启动报告所需的服务，为 nil 的项会被跳过
+type StartupReportSources struct {
+	Version   string
+	OS        string
+	Relay     *ProviderRelayService
+	Providers *ProviderService
+	Gemini    *GeminiService
+	Blacklist *BlacklistService
+	Update    *UpdateService
+}
+
+// CollectStartupReport 汇总启动诊断信息，最多等待 relay 就绪 5 秒，应在 goroutine 中调用
+func CollectStartupReport(src StartupReportSources) *StartupReport {
+	report := &StartupReport{
+		Version:     src.Version,
+		OS:          src.OS,
+		Providers:   make([]StartupProviderSummary, 0, 3),
+		Warnings:    make([]string, 0),
+		GeneratedAt: time.Now(),
+	}
+	warn := func(format string, args ...any) {
+		report.Warnings = append(report.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	if home, err := os.UserHomeDir(); err != nil {
+		warn("获取用户目录失败: %v", err)
+	} else {
+		report.ConfigDir = filepath.Join(home, ".code-switch")
+		report.DBPath = filepath.Join(report.ConfigDir, "app.db")
+		if _, err := os.Stat(report.ConfigDir); err != nil {
+			warn("配置目录不可用: %v", err)
+		}
+	}
+
+	if repair := LastDatabaseRepair(); repair != nil {
+		report.DBRepair = repair
+		warn("%s", repair.Warning())
+	}
+	if db, err := xdb.DB("default"); err != nil {
+		warn("数据库不可用: %v", err)
+	} else {
+		var one int
+		if err := db.QueryRow("SELECT 1").Scan(&one); err != nil {
+			warn("数据库查询失败: %v", err)
+		} else {
+			report.DBHealthy = true
+		}
+	}
+
+	if src.Relay != nil {
+		report.RelayAddr = src.Relay.Addr()
+		if err := src.Relay.WaitUntilReady(startupRelayWait); err != nil {
+			warn("relay 未在 %s 内完成监听（%s），请检查端口是否被占用", startupRelayWait, report.RelayAddr)
+		}
+		report.RelayListening = src.Relay.IsRunning()
+	}
+
+	if src.Providers != nil {
+		for _, kind := range []string{"claude", "codex"} {
+			providers, err := src.Providers.LoadProviders(kind)
+			if err != nil {
+				warn("加载 %s 供应商失败: %v", kind, err)
+				continue
+			}
+			summary := StartupProviderSummary{Platform: kind, Total: len(providers)}
+			for _, p := range providers {
+				if !p.Enabled {
+					continue
+				}
+				summary.Enabled++
+				if src.Blacklist != nil {
+					if blacklisted, _ := src.Blacklist.IsBlacklisted(kind, p.Name); blacklisted {
+						summary.Blacklisted++
+					}
+				}
+				if errs := p.ValidateConfiguration(); len(errs) > 0 {
+					warn("%s 供应商 %s 配置无效，relay 将跳过: %v", kind, p.Name, errs)
+				}
+			}
+			if summary.Total > 0 && summary.Enabled == summary.Blacklisted {
+				warn("%s 没有可用的供应商（已启用 %d 个，拉黑 %d 个）", kind, summary.Enabled, summary.Blacklisted)
+			}
+			report.Providers = append(report.Providers, summary)
+		}
+	}
+
+	if src.Gemini != nil {
+		summary := StartupProviderSummary{Platform: "gemini"}
+		for _, p := range src.Gemini.GetProviders() {
+			summary.Total++
+			if p.Enabled {
+				summary.Enabled++
+			}
+		}
+		report.Providers = append(report.Providers, summary)
+	}
+
+	if src.Update != nil {
+		report.UpdateMode = "installer"
+		if src.Update.IsPortable() {
+			report.UpdateMode = "portable"
+		}
+		state := src.Update.GetUpdateState()
+		report.AutoCheck = state.AutoCheckEnabled
+		report.UpdateReady = state.UpdateReady
+	}
+
+	return report
+}
+
+// Log 将启动报告作为一个整体输出到日志
+func (r *StartupReport) Log() {
+	var b strings.Builder
+	fmt.Fprintf(&b, "========== 启动诊断 ==========\n")
+	fmt.Fprintf(&b, "版本: %s (%s)\n", r.Version, r.OS)
+	fmt.Fprintf(&b, "配置目录: %s\n", r.ConfigDir)
+	fmt.Fprintf(&b, "Relay: %s | 监听中: %v\n", r.RelayAddr, r.RelayListening)
+	fmt.Fprintf(&b, "数据库: %s | 正常: %v\n", r.DBPath, r.DBHealthy)
+	for _, p := range r.Providers {
+		fmt.Fprintf(&b, "供应商 %-6s 共 %d | 启用 %d | 拉黑 %d\n", p.Platform, p.Total, p.Enabled, p.Blacklisted)
+	}
+	fmt.Fprintf(&b, "更新: %s | 自动检查: %v | 待安装更新: %v\n", r.UpdateMode, r.AutoCheck, r.UpdateReady)
+	for _, w := range r.Warnings {
+		fmt.Fprintf(&b, "⚠️  %s\n", w)
+	}
+	b.WriteString("==============================")
+	log.Printf("\n%s", b.String())
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollectStartupReport(t *testing.T) {
+	setupTestEnv(t)
+
+	relay, _ := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "main", APIURL: "https://api.example.com", APIKey: "sk-a", Enabled: true, Level: 1},
+		{ID: 2, Name: "spare", APIURL: "https://api.example.com", APIKey: "sk-b", Enabled: false, Level: 2},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	if err := relay.providerService.SaveProviders("codex", []Provider{
+		{ID: 1, Name: "off", APIURL: "https://api.example.com", APIKey: "sk-c", Enabled: false, Level: 1},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+	if err := relay.Start(); err != nil {
+		t.Fatalf("启动 relay 失败: %v", err)
+	}
+	defer relay.Stop()
+
+	report := CollectStartupReport(StartupReportSources{
+		Version:   "v1.0.0",
+		Relay:     relay,
+		Providers: relay.providerService,
+		Blacklist: relay.blacklistService,
+	})
+
+	if !report.RelayListening || !report.DBHealthy {
+		t.Fatalf("relay 与数据库应正常: %+v", report)
+	}
+	if !strings.HasSuffix(report.DBPath, "app.db") || report.ConfigDir == "" {
+		t.Fatalf("路径信息缺失: %+v", report)
+	}
+	var claude *StartupProviderSummary
+	for i := range report.Providers {
+		if report.Providers[i].Platform == "claude" {
+			claude = &report.Providers[i]
+		}
+	}
+	if claude == nil || claude.Total != 2 || claude.Enabled != 1 || claude.Blacklisted != 0 {
+		t.Fatalf("claude 供应商统计错误: %+v", report.Providers)
+	}
+	codexWarned := false
+	for _, w := range report.Warnings {
+		if strings.Contains(w, "claude") {
+			t.Fatalf("claude 有可用供应商，不应产生警告: %s", w)
+		}
+		codexWarned = codexWarned || strings.Contains(w, "codex")
+	}
+	if !codexWarned {
+		t.Fatalf("codex 没有可用供应商时应产生警告: %v", report.Warnings)
+	}
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// PricingTier provider 的阶梯计价档位：自然月内累计 token 超过 AboveTokens 后，费用按模型标价 × Multiplier 计算
+// 未配置档位时按模型标价计费；跨越档位的请求按两侧 token 数拆分计价
+//
+//	[{"aboveTokens": 100000000, "multiplier": 0.8}, {"aboveTokens": 500000000, "multiplier": 0.6}]
+type PricingTier struct {
+	AboveTokens int64   `json:"aboveTokens"`
+	Multiplier  float64 `json:"multiplier"`
+}
+
+// validatePricingTiers 校验阶梯计价档位，返回错误描述列表
+func validatePricingTiers(tiers []PricingTier) []string {
+	errs := make([]string, 0)
+	for i, tier := range tiers {
+		if tier.AboveTokens <= 0 {
+			errs = append(errs, fmt.Sprintf("阶梯计价 #%d 的 aboveTokens 必须大于 0", i+1))
+		} else if i > 0 && tier.AboveTokens <= tiers[i-1].AboveTokens {
+			errs = append(errs, fmt.Sprintf("阶梯计价 #%d 的 aboveTokens 必须大于上一档", i+1))
+		}
+		if tier.Multiplier < 0 {
+			errs = append(errs, fmt.Sprintf("阶梯计价 #%d 的 multiplier 不能为负数", i+1))
+		}
+	}
+	return errs
+}
+
+func clonePricingTiers(tiers []PricingTier) []PricingTier {
+	if tiers == nil {
+		return nil
+	}
+	cloned := make([]PricingTier, len(tiers))
+	copy(cloned, tiers)
+	return cloned
+}
+
+// tierRate 返回本月累计 used 个 token 之后的费率倍数
+func tierRate(tiers []PricingTier, used int64) float64 {
+	rate := 1.0
+	for _, tier := range tiers {
+		if used < tier.AboveTokens {
+			break
+		}
+		rate = tier.Multiplier
+	}
+	return rate
+}
+
+// tierMultiplier 计算一次请求的平均费率倍数：请求占用本月第 [used, used+tokens) 个 token
+func tierMultiplier(tiers []PricingTier, used int64, tokens int64) float64 {
+	if tokens <= 0 {
+		return tierRate(tiers, used)
+	}
+	end := used + tokens
+	weighted := 0.0
+	start := used
+	for _, tier := range tiers {
+		if tier.AboveTokens <= start {
+			continue
+		}
+		if tier.AboveTokens >= end {
+			break
+		}
+		weighted += float64(tier.AboveTokens-start) * tierRate(tiers, start)
+		start = tier.AboveTokens
+	}
+	weighted += float64(end-start) * tierRate(tiers, start)
+	return weighted / float64(tokens)
+}
+
+// tieredEntry 配置了阶梯计价的 provider 的一条请求
+type tieredEntry struct {
+	platform   string
+	model      string
+	createdAt  time.Time
+	usage      modelpricing.UsageSnapshot
+	multiplier float64
+}
+
+// tieredPricing 请求日志 id -> 阶梯计价后的费率倍数；没有 provider 配置阶梯时为空，所有请求按标价计费
+type tieredPricing struct {
+	entries map[int64]tieredEntry
+}
+
+// loadTieredPricing 为配置了阶梯计价的 provider 统计每个自然月的累计 token，计算 since 之后每条请求的费率倍数
+// 累计从 since 所在月的月初开始，因此统计窗口从月中开始时也能得到正确的档位
+func loadTieredPricing(since time.Time) (*tieredPricing, error) {
+	tp := &tieredPricing{entries: make(map[int64]tieredEntry)}
+	if since.IsZero() {
+		return tp, nil
+	}
+	tiers := providerPricingTiers()
+	if len(tiers) == 0 {
+		return tp, nil
+	}
+	names := make([]string, 0, len(tiers))
+	for key := range tiers {
+		names = append(names, key[strings.IndexByte(key, 0)+1:])
+	}
+	sort.Strings(names)
+	providers := make([]any, 0, len(names))
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			providers = append(providers, name)
+		}
+	}
+
+	since = since.In(time.Local)
+	monthStart := time.Date(since.Year(), since.Month(), 1, 0, 0, 0, 0, time.Local)
+	records, err := xdb.New("request_log").Selects(
+		// created_at 的时区与写入方式有关，这里放宽一天预筛选，再按解析后的时间精确过滤
+		xdb.WhereGte("created_at", monthStart.Add(-24*time.Hour).Format(timeLayout)),
+		xdb.WhereIn("provider", providers),
+		xdb.Field(
+			"id",
+			"platform",
+			"provider",
+			"model",
+			"input_tokens",
+			"output_tokens",
+			"cache_create_tokens",
+			"cache_read_tokens",
+			"ephemeral_5m_tokens",
+			"ephemeral_1h_tokens",
+			"created_at",
+		),
+		xdb.OrderByAsc("id"),
+	)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+			return tp, nil
+		}
+		return nil, fmt.Errorf("统计阶梯计价用量失败: %w", err)
+	}
+
+	used := make(map[string]int64)
+	for _, record := range records {
+		createdAt, hasTime := parseCreatedAt(record)
+		if !hasTime || createdAt.Before(monthStart) {
+			continue
+		}
+		platform := strings.TrimSpace(record.GetString("platform"))
+		key := platform + "\x00" + strings.TrimSpace(record.GetString("provider"))
+		providerTiers, ok := tiers[key]
+		if !ok {
+			continue
+		}
+		usage := modelpricing.UsageSnapshot{
+			InputTokens:       record.GetInt("input_tokens"),
+			OutputTokens:      record.GetInt("output_tokens"),
+			CacheCreateTokens: record.GetInt("cache_create_tokens"),
+			CacheReadTokens:   record.GetInt("cache_read_tokens"),
+			CacheCreation:     recordCacheCreation(record),
+		}
+		tokens := int64(usage.InputTokens + usage.OutputTokens + usage.CacheCreateTokens + usage.CacheReadTokens)
+		monthKey := key + "\x00" + createdAt.Format("2006-01")
+		multiplier := tierMultiplier(providerTiers, used[monthKey], tokens)
+		used[monthKey] += tokens
+		if createdAt.Before(since) {
+			continue
+		}
+		tp.entries[record.GetInt64("id")] = tieredEntry{
+			platform:   platform,
+			model:      strings.TrimSpace(record.GetString("model")),
+			createdAt:  createdAt,
+			usage:      usage,
+			multiplier: multiplier,
+		}
+	}
+	return tp, nil
+}
+
+// multiplier 返回请求日志的费率倍数，未配置阶梯计价的请求为 1
+func (tp *tieredPricing) multiplier(id int64) float64 {
+	if tp == nil {
+		return 1
+	}
+	if entry, ok := tp.entries[id]; ok {
+		return entry.multiplier
+	}
+	return 1
+}
+
+// apply 按请求日志的费率倍数调整费用明细
+func (tp *tieredPricing) apply(id int64, cost modelpricing.CostBreakdown) modelpricing.CostBreakdown {
+	m := tp.multiplier(id)
+	if m == 1 {
+		return cost
+	}
+	cost.InputCost *= m
+	cost.OutputCost *= m
+	cost.CacheCreateCost *= m
+	cost.CacheReadCost *= m
+	cost.Ephemeral5mCost *= m
+	cost.Ephemeral1hCost *= m
+	cost.TotalCost *= m
+	return cost
+}
+
+// applyLog 按费率倍数调整单条请求日志的费用
+func (tp *tieredPricing) applyLog(logEntry *ReqeustLog) {
+	m := tp.multiplier(logEntry.ID)
+	if m == 1 {
+		return
+	}
+	logEntry.InputCost *= m
+	logEntry.OutputCost *= m
+	logEntry.CacheCreateCost *= m
+	logEntry.CacheReadCost *= m
+	logEntry.Ephemeral5mCost *= m
+	logEntry.Ephemeral1hCost *= m
+	logEntry.TotalCost *= m
+}
+
+// costAdjustments 按模型汇总阶梯计价相对标价的费用差额，用于在 SQL 聚合的标价费用上修正
+func (tp *tieredPricing) costAdjustments(ls *LogService, platform string) map[string]float64 {
+	adjustments := make(map[string]float64)
+	if tp == nil {
+		return adjustments
+	}
+	for _, entry := range tp.entries {
+		if entry.multiplier == 1 || entry.model == "" || (platform != "" && entry.platform != platform) {
+			continue
+		}
+		adjustments[entry.model] += ls.calculateCost(entry.model, entry.usage).TotalCost * (entry.multiplier - 1)
+	}
+	return adjustments
+}
+
+// providerPricingTiers 读取 claude/codex 中配置了阶梯计价的 provider，key 为 platform + "\x00" + provider 名称
+func providerPricingTiers() map[string][]PricingTier {
+	ps := &ProviderService{}
+	tiers := make(map[string][]PricingTier)
+	for _, kind := range []string{"claude", "codex"} {
+		providers, err := ps.LoadProviders(kind)
+		if err != nil {
+			continue
+		}
+		for _, p := range providers {
+			if len(p.PricingTiers) > 0 {
+				tiers[kind+"\x00"+p.Name] = p.PricingTiers
+			}
+		}
+	}
+	return tiers
+}
@@ -0,0 +1,20 @@
+package services
+
+// InputTokenEstimator 估算请求体的输入 token 数，用于按 provider 的输入 token 范围过滤
+type InputTokenEstimator func(body []byte) int
+
+// bytesPerToken 字节数估算 token 的经验比例（英文约 4 字节/token，中文偏少，仅用于粗略路由）
+const bytesPerToken = 4
+
+// estimateInputTokensByBytes 默认估算方式：按请求体字节数估算，包含 JSON 结构开销
+func estimateInputTokensByBytes(body []byte) int {
+	return (len(body) + bytesPerToken - 1) / bytesPerToken
+}
+
+// estimateInputTokens 使用配置的估算器（未配置时按字节数）估算输入 token 数
+func (prs *ProviderRelayService) estimateInputTokens(body []byte) int {
+	if prs.tokenEstimator != nil {
+		return prs.tokenEstimator(body)
+	}
+	return estimateInputTokensByBytes(body)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"net/http"
 	"os"
 	"os/exec"
@@ -37,9 +38,15 @@ type UpdateState struct {
 	LatestKnownVersion  string    `json:"latest_known_version"`
 	DownloadProgress    float64   `json:"download_progress"`
 	UpdateReady         bool      `json:"update_ready"`
-	AutoCheckEnabled    bool      `json:"auto_check_enabled"` // 新增：持久化自动检查开关
+	AutoCheckEnabled    bool      `json:"auto_check_enabled"`   // 新增：持久化自动检查开关
+	CheckJitterSeconds  int       `json:"check_jitter_seconds"` // 每日检查时间的随机偏移（每个安装固定）
 }
 
+const (
+	dailyCheckHour    = 8       // 每日检查的基准时间（8 点）
+	dailyCheckJitterS = 30 * 60 // 随机偏移范围 ±30 分钟，避免所有客户端同时请求 GitHub
+)
+
 // UpdateService 更新服务
 type UpdateService struct {
 	currentVersion   string
@@ -48,14 +55,17 @@ type UpdateService struct {
 	updateFilePath   string
 	autoCheckEnabled bool
 	downloadProgress float64
-	dailyCheckTimer  *time.Timer
+	dailyCheckTimer  Timer
 	lastCheckTime    time.Time
 	checkFailures    int
 	updateReady      bool
 	isPortable       bool // 是否为便携版
+	checkJitter      time.Duration
+	checkJitterSet   bool
 	mu               sync.Mutex
 	stateFile        string
 	updateDir        string
+	clock            Clock
 }
 
 // GitHubRelease GitHub Release 结构
@@ -80,6 +90,7 @@ func NewUpdateService(currentVersion string) *UpdateService {
 	stateFile := filepath.Join(home, ".code-switch", "update-state.json")
 
 	us := &UpdateService{
+		clock:            systemClock,
 		currentVersion:   currentVersion,
 		autoCheckEnabled: true, // 默认开启自动检查
 		isPortable:       detectPortableMode(),
@@ -93,6 +104,13 @@ func NewUpdateService(currentVersion string) *UpdateService {
 	// 加载状态（如果文件不存在，会保持默认值 true）
 	_ = us.LoadState()
 
+	// 首次运行或旧版本状态文件：生成本机固定的检查时间偏移
+	if !us.checkJitterSet {
+		us.checkJitter = time.Duration(rand.Intn(2*dailyCheckJitterS+1)-dailyCheckJitterS) * time.Second
+		us.checkJitterSet = true
+		_ = us.SaveState()
+	}
+
 	log.Printf("[UpdateService] 运行模式: %s", func() string {
 		if us.isPortable {
 			return "便携版"
@@ -329,7 +347,7 @@ func (us *UpdateService) PrepareUpdate() error {
 	metadata := map[string]interface{}{
 		"version":       us.latestVersion,
 		"download_path": us.updateFilePath,
-		"download_time": time.Now().Format(time.RFC3339),
+		"download_time": us.clock.Now().Format(time.RFC3339),
 	}
 
 	data, err := json.MarshalIndent(metadata, "", "  ")
@@ -457,7 +475,8 @@ func (us *UpdateService) applyPortableUpdate(newExePath string) error {
 	pendingFile := filepath.Join(filepath.Dir(us.stateFile), ".pending-update")
 	_ = os.Remove(pendingFile)
 
-	// 重启应用
+	// 重启应用（先释放单实例锁，新进程才能正常启动）
+	releaseActiveInstanceLock()
 	cmd := exec.Command(currentExe)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -517,6 +536,9 @@ func (us *UpdateService) RestartApp() error {
 		return fmt.Errorf("获取可执行文件路径失败: %w", err)
 	}
 
+	// 先释放单实例锁，新进程才能正常启动
+	releaseActiveInstanceLock()
+
 	switch runtime.GOOS {
 	case "windows":
 		cmd := exec.Command(executable)
@@ -548,12 +570,12 @@ func (us *UpdateService) StartDailyCheck() {
 	us.stopDailyCheck()
 
 	duration := us.calculateNextCheckDuration()
-	us.dailyCheckTimer = time.AfterFunc(duration, func() {
+	us.dailyCheckTimer = us.clock.AfterFunc(duration, func() {
 		us.performDailyCheck()
 		us.StartDailyCheck() // 重新调度下次检查
 	})
 
-	log.Printf("[UpdateService] 定时检查已启动，下次检查时间: %s", time.Now().Add(duration).Format("2006-01-02 15:04:05"))
+	log.Printf("[UpdateService] 定时检查已启动，下次检查时间: %s", us.clock.Now().Add(duration).Format("2006-01-02 15:04:05"))
 }
 
 // stopDailyCheck 停止定时检查
@@ -564,16 +586,22 @@ func (us *UpdateService) stopDailyCheck() {
 	}
 }
 
-// calculateNextCheckDuration 计算距离下一个8点的时长
+// calculateNextCheckDuration 计算距离下一次检查（8 点 ± 本机固定偏移）的时长
 func (us *UpdateService) calculateNextCheckDuration() time.Duration {
-	now := time.Now()
+	us.mu.Lock()
+	jitter := us.checkJitter
+	us.mu.Unlock()
+	return nextCheckDuration(us.clock.Now(), jitter)
+}
 
-	// 今天早上8点
-	next := time.Date(now.Year(), now.Month(), now.Day(), 8, 0, 0, 0, now.Location())
+// nextCheckDuration 计算从 now 到下一个 8 点 + jitter 的时长
+func nextCheckDuration(now time.Time, jitter time.Duration) time.Duration {
+	// 今天的检查时间
+	next := time.Date(now.Year(), now.Month(), now.Day(), dailyCheckHour, 0, 0, 0, now.Location()).Add(jitter)
 
-	// 如果已经过了今天8点，调整到明天8点
-	if now.After(next) {
-		next = next.Add(24 * time.Hour)
+	// 如果已经过了今天的检查时间，调整到明天
+	if !now.Before(next) {
+		next = next.AddDate(0, 0, 1)
 	}
 
 	return next.Sub(now)
@@ -593,7 +621,7 @@ func (us *UpdateService) performDailyCheck() {
 		if err == nil {
 			// 检查成功
 			us.mu.Lock()
-			us.lastCheckTime = time.Now()
+			us.lastCheckTime = us.clock.Now()
 			us.checkFailures = 0
 			us.mu.Unlock()
 			us.SaveState()
@@ -658,7 +686,7 @@ func (us *UpdateService) CheckUpdateAsync() {
 		}
 
 		us.mu.Lock()
-		us.lastCheckTime = time.Now()
+		us.lastCheckTime = us.clock.Now()
 		us.checkFailures = 0
 		us.mu.Unlock()
 		us.SaveState()
@@ -686,6 +714,11 @@ func (us *UpdateService) GetUpdateState() *UpdateState {
 	}
 }
 
+// IsPortable 是否为便携版
+func (us *UpdateService) IsPortable() bool {
+	return us.isPortable
+}
+
 // IsAutoCheckEnabled 是否启用自动检查
 func (us *UpdateService) IsAutoCheckEnabled() bool {
 	us.mu.Lock()
@@ -721,6 +754,7 @@ func (us *UpdateService) SaveState() error {
 		DownloadProgress:    us.downloadProgress,
 		UpdateReady:         us.updateReady,
 		AutoCheckEnabled:    us.autoCheckEnabled, // 持久化自动检查开关
+		CheckJitterSeconds:  int(us.checkJitter / time.Second),
 	}
 
 	data, err := json.MarshalIndent(state, "", "  ")
@@ -768,6 +802,10 @@ func (us *UpdateService) LoadState() error {
 		us.autoCheckEnabled = state.AutoCheckEnabled
 	}
 	// 否则保持初始化时设置的默认值 true
+	if strings.Contains(dataStr, "\"check_jitter_seconds\"") {
+		us.checkJitter = time.Duration(state.CheckJitterSeconds) * time.Second
+		us.checkJitterSet = true
+	}
 	us.mu.Unlock()
 
 	return nil
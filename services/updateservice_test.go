@@ -0,0 +1,72 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextCheckDurationWithinJitterWindow(t *testing.T) {
+	window := time.Duration(dailyCheckJitterS) * time.Second
+	loc := time.FixedZone("test", 8*3600)
+	nows := []time.Time{
+		time.Date(2025, 3, 1, 0, 0, 0, 0, loc),
+		time.Date(2025, 3, 1, 7, 45, 0, 0, loc),
+		time.Date(2025, 3, 1, 8, 0, 0, 0, loc),
+		time.Date(2025, 3, 1, 23, 59, 0, 0, loc),
+	}
+	jitters := []time.Duration{-window, -10 * time.Minute, 0, 17 * time.Minute, window}
+
+	for _, now := range nows {
+		for _, jitter := range jitters {
+			d := nextCheckDuration(now, jitter)
+			if d <= 0 || d > 24*time.Hour {
+				t.Fatalf("now=%s jitter=%s: 时长 %s 超出范围", now, jitter, d)
+			}
+			next := now.Add(d)
+			base := time.Date(next.Year(), next.Month(), next.Day(), dailyCheckHour, 0, 0, 0, loc)
+			if diff := next.Sub(base); diff != jitter {
+				t.Fatalf("now=%s jitter=%s: 下次检查 %s 偏离 08:00 %s", now, jitter, next, diff)
+			}
+			if diff := next.Sub(base); diff < -window || diff > window {
+				t.Fatalf("now=%s: 下次检查 %s 超出随机偏移范围", now, next)
+			}
+		}
+	}
+}
+
+func TestCheckJitterPersistsAcrossRestarts(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	first := NewUpdateService("v1.0.0")
+	window := time.Duration(dailyCheckJitterS) * time.Second
+	if first.checkJitter < -window || first.checkJitter > window {
+		t.Fatalf("随机偏移 %s 超出 ±%s", first.checkJitter, window)
+	}
+
+	second := NewUpdateService("v1.0.0")
+	if second.checkJitter != first.checkJitter {
+		t.Fatalf("随机偏移未持久化: %s != %s", second.checkJitter, first.checkJitter)
+	}
+}
+
+func TestStartDailyCheckSchedulesOnClock(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	us := NewUpdateService("v1.0.0")
+	clock := newFakeClock(time.Date(2025, 3, 1, 6, 0, 0, 0, time.Local))
+	us.clock = clock
+	us.checkJitter = 0
+
+	us.StartDailyCheck()
+	timer, ok := us.dailyCheckTimer.(*fakeTimer)
+	if !ok {
+		t.Fatalf("定时器应由注入的时钟创建")
+	}
+	if want := time.Date(2025, 3, 1, 8, 0, 0, 0, time.Local); !timer.at.Equal(want) {
+		t.Fatalf("下次检查时间 = %s, 期望 %s", timer.at, want)
+	}
+	us.stopDailyCheck()
+	if !timer.stopped {
+		t.Fatalf("stopDailyCheck 应停止定时器")
+	}
+}
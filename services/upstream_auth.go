@@ -0,0 +1,52 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 上游鉴权方式（Provider.AuthScheme）
+const (
+	// AuthSchemeBearer Authorization: Bearer <apiKey>（默认）
+	AuthSchemeBearer = "bearer"
+	// AuthSchemeXAPIKey x-api-key: <apiKey>，不发送 Authorization（Anthropic 官方接口）
+	AuthSchemeXAPIKey = "x-api-key"
+	// AuthSchemeNone 不发送任何鉴权头（上游由内网网关或 IP 白名单鉴权）
+	AuthSchemeNone = "none"
+)
+
+// normalizedAuthScheme 返回 provider 的鉴权方式，为空时视为 bearer
+func normalizedAuthScheme(p Provider) string {
+	scheme := strings.ToLower(strings.TrimSpace(p.AuthScheme))
+	if scheme == "" {
+		return AuthSchemeBearer
+	}
+	return scheme
+}
+
+// validateAuthScheme 校验鉴权方式取值
+func validateAuthScheme(p Provider) []string {
+	switch normalizedAuthScheme(p) {
+	case AuthSchemeBearer, AuthSchemeXAPIKey, AuthSchemeNone:
+		return nil
+	default:
+		return []string{fmt.Sprintf("authScheme 不支持 %q（可选 bearer、x-api-key、none）", p.AuthScheme)}
+	}
+}
+
+// applyProviderAuth 按 provider 的鉴权方式设置上游鉴权头
+// 客户端发给 relay 的 Authorization / x-api-key 只是本地占位凭证，一律移除，避免与上游鉴权头同时出现
+func applyProviderAuth(headers map[string]string, p Provider) {
+	for key := range headers {
+		if strings.EqualFold(key, "Authorization") || strings.EqualFold(key, "X-Api-Key") {
+			delete(headers, key)
+		}
+	}
+	switch normalizedAuthScheme(p) {
+	case AuthSchemeXAPIKey:
+		headers["X-Api-Key"] = p.APIKey
+	case AuthSchemeNone:
+	default:
+		headers["Authorization"] = fmt.Sprintf("Bearer %s", p.APIKey)
+	}
+}
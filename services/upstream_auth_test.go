@@ -0,0 +1,60 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProviderAuthScheme(t *testing.T) {
+	setupTestEnv(t)
+
+	received := make(chan http.Header, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	cases := []struct {
+		scheme        string
+		authorization string
+		apiKey        string
+	}{
+		{scheme: "", authorization: "Bearer sk-provider"},
+		{scheme: "bearer", authorization: "Bearer sk-provider"},
+		{scheme: "x-api-key", apiKey: "sk-provider"},
+		{scheme: "none"},
+	}
+	for _, tc := range cases {
+		relay, router := newTestRelay(t)
+		if err := relay.providerService.SaveProviders("claude", []Provider{
+			{ID: 1, Name: "upstream", APIURL: upstream.URL, APIKey: "sk-provider", Enabled: true, Level: 1, AuthScheme: tc.scheme},
+		}); err != nil {
+			t.Fatalf("保存 provider 失败: %v", err)
+		}
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`))
+		req.Header.Set("Authorization", "Bearer local-placeholder")
+		req.Header.Set("X-Api-Key", "local-placeholder")
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("[%s] 状态码 = %d, body=%s", tc.scheme, rec.Code, rec.Body.String())
+		}
+
+		header := <-received
+		if got := header.Get("Authorization"); got != tc.authorization {
+			t.Errorf("[%s] Authorization = %q, 期望 %q", tc.scheme, got, tc.authorization)
+		}
+		if got := header.Get("X-Api-Key"); got != tc.apiKey {
+			t.Errorf("[%s] X-Api-Key = %q, 期望 %q", tc.scheme, got, tc.apiKey)
+		}
+	}
+
+	invalid := Provider{Name: "p", APIURL: "https://example.com", APIKey: "k", AuthScheme: "basic"}
+	if errs := invalid.ValidateConfiguration(); len(errs) == 0 {
+		t.Fatalf("未知的 authScheme 应校验失败")
+	}
+}
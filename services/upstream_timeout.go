@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// defaultFirstByteTimeout 未配置 TimeoutSeconds 时等待上游响应头的最长时间
+const defaultFirstByteTimeout = 30 * time.Minute
+
+// firstByteTimeout 返回 provider 的首字节超时
+func (p Provider) firstByteTimeout() time.Duration {
+	if p.TimeoutSeconds > 0 {
+		return time.Duration(p.TimeoutSeconds) * time.Second
+	}
+	return defaultFirstByteTimeout
+}
+
+// firstByteDeadline 在 timeout 内未调用 stop（即未收到响应头）时取消返回的 context
+// 收到响应头后调用 stop，后续读取响应体不受该超时限制；stop 返回是否已超时
+type firstByteDeadline struct {
+	timer    *time.Timer
+	timedOut atomic.Bool
+}
+
+func withFirstByteTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc, *firstByteDeadline) {
+	ctx, cancel := context.WithCancel(parent)
+	deadline := &firstByteDeadline{}
+	deadline.timer = time.AfterFunc(timeout, func() {
+		deadline.timedOut.Store(true)
+		cancel()
+	})
+	return ctx, cancel, deadline
+}
+
+func (d *firstByteDeadline) stop() bool {
+	d.timer.Stop()
+	return d.timedOut.Load()
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProviderFirstByteTimeout(t *testing.T) {
+	setupTestEnv(t)
+
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hanging.Close()
+	defer close(release)
+	// 立即返回响应头，流式响应在超时之后才写完：不应被首字节超时中断
+	slowBody := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(1500 * time.Millisecond)
+		_, _ = w.Write([]byte("data: {\"id\":\"msg_1\"}\n\n"))
+	}))
+	defer slowBody.Close()
+
+	if errs := (&Provider{Name: "bad", APIURL: "https://a.example.com", TimeoutSeconds: -1}).ValidateConfiguration(); len(errs) == 0 {
+		t.Fatalf("负数超时时间应校验失败")
+	}
+
+	relay, router := newTestRelay(t)
+	send := func(url string) (*httptest.ResponseRecorder, time.Duration) {
+		t.Helper()
+		if err := relay.providerService.SaveProviders("claude", []Provider{
+			{ID: 1, Name: "upstream", APIURL: url, APIKey: "sk-test", Enabled: true, Level: 1, TimeoutSeconds: 1},
+		}); err != nil {
+			t.Fatalf("保存 provider 失败: %v", err)
+		}
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4","stream":true}`)))
+		return rec, time.Since(start)
+	}
+
+	rec, elapsed := send(hanging.URL)
+	if rec.Code != http.StatusBadGateway || elapsed > 3*time.Second {
+		t.Fatalf("上游未响应时应在超时后失败: 状态码 %d, 耗时 %v", rec.Code, elapsed)
+	}
+
+	rec, _ = send(slowBody.URL)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "msg_1") {
+		t.Fatalf("已返回响应头的请求不应受首字节超时影响: %d %s", rec.Code, rec.Body.String())
+	}
+}
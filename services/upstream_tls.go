@@ -0,0 +1,226 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// upstreamCAPathKey app_settings 中额外信任的 CA 证书路径（文件或目录）
+const upstreamCAPathKey = "upstream_ca_path"
+
+// caFileExtensions 从目录加载 CA 时识别的证书文件后缀
+var caFileExtensions = map[string]bool{".pem": true, ".crt": true, ".cer": true}
+
+// upstreamTransportCache 按 (CA 路径, 是否跳过校验, SNI) 缓存 Transport，复用连接池
+var upstreamTransportCache = struct {
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}{transports: make(map[string]*http.Transport)}
+
+// GetUpstreamCAPath 获取额外信任的 CA 证书路径（为空表示仅使用系统证书）
+func (ss *SettingsService) GetUpstreamCAPath() (string, error) {
+	value, _, err := getSettingValue(upstreamCAPathKey)
+	return value, err
+}
+
+// SetUpstreamCAPath 设置额外信任的 CA 证书路径，传空字符串表示恢复默认
+// 保存前会校验路径中至少包含一个有效的 PEM 证书
+func (ss *SettingsService) SetUpstreamCAPath(path string) error {
+	path = strings.TrimSpace(path)
+	if path != "" {
+		_, count, err := loadCertPool(path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("[INFO] 已加载 %d 个自定义 CA 证书: %s\n", count, path)
+	}
+	if err := setSettingValue(upstreamCAPathKey, path); err != nil {
+		return err
+	}
+	resetUpstreamTransports()
+	return nil
+}
+
+// loadCertPool 在系统证书池基础上追加指定文件或目录中的 PEM 证书
+func loadCertPool(path string) (*x509.CertPool, int, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取 CA 证书路径失败: %w", err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, 0, fmt.Errorf("读取 CA 证书目录失败: %w", err)
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if entry.IsDir() || !caFileExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+				continue
+			}
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+
+	count := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, 0, fmt.Errorf("读取 CA 证书 %s 失败: %w", file, err)
+		}
+		if pool.AppendCertsFromPEM(data) {
+			count++
+		}
+	}
+	if count == 0 {
+		return nil, 0, fmt.Errorf("%s 中没有有效的 PEM 证书", path)
+	}
+	return pool, count, nil
+}
+
+// newUpstreamTransport 构造上游 Transport（代理策略与 xrequest 默认客户端一致）
+// serverName 非空时作为 TLS SNI，证书也按该名称校验
+func newUpstreamTransport(caPath string, insecureSkipVerify bool, serverName string) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify, ServerName: serverName}
+	if caPath != "" {
+		pool, _, err := loadCertPool(caPath)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// upstreamOverride 连接上游时覆盖的 Host 请求头和 TLS SNI（用于只能通过 IP 访问的共享网关）
+type upstreamOverride struct {
+	Target     string // APIURL 中的 host[:port]，Host 头只对发往该地址的请求生效
+	Host       string
+	ServerName string
+}
+
+func (o upstreamOverride) isZero() bool {
+	return o.Host == "" && o.ServerName == ""
+}
+
+// upstreamOverride 根据 provider 的 HostHeader / TLSServerName 构造覆盖配置
+// 只配置 HostHeader 时 SNI 默认使用其中的主机名
+func (p *Provider) upstreamOverride() upstreamOverride {
+	override := upstreamOverride{
+		Host:       strings.TrimSpace(p.HostHeader),
+		ServerName: strings.TrimSpace(p.TLSServerName),
+	}
+	if override.isZero() {
+		return override
+	}
+	if parsed, err := url.Parse(p.APIURL); err == nil {
+		override.Target = parsed.Host
+		if override.ServerName == "" && override.Host != "" && parsed.Scheme == "https" {
+			override.ServerName = hostWithoutPort(override.Host)
+		}
+	}
+	return override
+}
+
+func hostWithoutPort(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return hostport
+}
+
+// validateUpstreamOverride 校验 HostHeader / TLSServerName：只能是主机名（HostHeader 可带端口），不能包含协议或路径
+func validateUpstreamOverride(p *Provider) []string {
+	errors := make([]string, 0)
+	if host := strings.TrimSpace(p.HostHeader); host != "" {
+		if parsed, err := url.Parse("http://" + host); err != nil || parsed.Host != host || parsed.User != nil {
+			errors = append(errors, fmt.Sprintf("hostHeader 无效：'%s'，应为 host 或 host:port", p.HostHeader))
+		}
+	}
+	if name := strings.TrimSpace(p.TLSServerName); name != "" {
+		if strings.ContainsAny(name, ":/ @") {
+			errors = append(errors, fmt.Sprintf("tlsServerName 无效：'%s'，应为不带端口的主机名", p.TLSServerName))
+		}
+	}
+	return errors
+}
+
+// hostOverrideTransport 为发往目标地址的请求设置 Host 头（Go 会忽略 Header 中的 Host，需设置 Request.Host）
+type hostOverrideTransport struct {
+	base   http.RoundTripper
+	target string
+	host   string
+}
+
+func (t *hostOverrideTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.target {
+		return t.base.RoundTrip(req)
+	}
+	cloned := req.Clone(req.Context())
+	cloned.Host = t.host
+	return t.base.RoundTrip(cloned)
+}
+
+// upstreamHTTPClient 返回用于访问上游的 HTTP 客户端
+// 未配置自定义 CA、未跳过校验且没有 Host/SNI 覆盖时返回 nil，调用方使用默认客户端（保持严格校验）
+func upstreamHTTPClient(providerName string, insecureSkipVerify bool, override upstreamOverride, timeout time.Duration) (*http.Client, error) {
+	caPath, _, err := getSettingValue(upstreamCAPathKey)
+	if err != nil {
+		caPath = ""
+	}
+	if caPath == "" && !insecureSkipVerify && override.isZero() {
+		return nil, nil
+	}
+	if insecureSkipVerify {
+		fmt.Printf("[WARN] Provider %s 已关闭 TLS 证书校验（InsecureSkipVerify），存在中间人攻击风险\n", providerName)
+	}
+
+	key := caPath + "|" + strconv.FormatBool(insecureSkipVerify) + "|" + override.ServerName
+	upstreamTransportCache.mu.Lock()
+	defer upstreamTransportCache.mu.Unlock()
+
+	transport, ok := upstreamTransportCache.transports[key]
+	if !ok {
+		transport, err = newUpstreamTransport(caPath, insecureSkipVerify, override.ServerName)
+		if err != nil {
+			return nil, err
+		}
+		upstreamTransportCache.transports[key] = transport
+	}
+	// 每次返回新的 Client：xrequest 会修改 Client.Timeout，不能共享同一个实例
+	var roundTripper http.RoundTripper = transport
+	if override.Host != "" && override.Target != "" {
+		roundTripper = &hostOverrideTransport{base: transport, target: override.Target, host: override.Host}
+	}
+	return &http.Client{Transport: roundTripper, Timeout: timeout}, nil
+}
+
+// resetUpstreamTransports 清空 Transport 缓存（CA 配置变更后调用）
+func resetUpstreamTransports() {
+	upstreamTransportCache.mu.Lock()
+	defer upstreamTransportCache.mu.Unlock()
+	for key, transport := range upstreamTransportCache.transports {
+		transport.CloseIdleConnections()
+		delete(upstreamTransportCache.transports, key)
+	}
+}
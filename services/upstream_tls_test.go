@@ -0,0 +1,136 @@
+package services
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpstreamClientWithCustomCA(t *testing.T) {
+	setupTestEnv(t)
+	resetUpstreamTransports()
+	t.Cleanup(resetUpstreamTransports)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	caDir := t.TempDir()
+	caFile := filepath.Join(caDir, "corp-ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0o644); err != nil {
+		t.Fatalf("写入 CA 文件失败: %v", err)
+	}
+
+	pool, count, err := loadCertPool(caDir)
+	if err != nil || pool == nil || count != 1 {
+		t.Fatalf("从目录加载 CA 失败: count=%d err=%v", count, err)
+	}
+
+	// 默认严格：未配置 CA 时不提供专用客户端，默认客户端应拒绝自签名证书
+	client, err := upstreamHTTPClient("corp", false, upstreamOverride{}, time.Second)
+	if err != nil || client != nil {
+		t.Fatalf("未配置 CA 时应返回 nil 客户端, client=%v err=%v", client, err)
+	}
+	if _, err := (&http.Client{Timeout: time.Second}).Get(server.URL); err == nil {
+		t.Fatalf("默认客户端不应信任自签名证书")
+	}
+
+	settings := &SettingsService{}
+	if err := settings.SetUpstreamCAPath(caFile); err != nil {
+		t.Fatalf("设置 CA 路径失败: %v", err)
+	}
+	client, err = upstreamHTTPClient("corp", false, upstreamOverride{}, time.Second)
+	if err != nil || client == nil {
+		t.Fatalf("配置 CA 后应返回专用客户端: %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("使用自定义 CA 请求失败: %v", err)
+	}
+	resp.Body.Close()
+
+	if err := settings.SetUpstreamCAPath(filepath.Join(caDir, "missing.pem")); err == nil {
+		t.Fatalf("不存在的 CA 路径应返回错误")
+	}
+}
+
+func TestUpstreamClientInsecureSkipVerify(t *testing.T) {
+	setupTestEnv(t)
+	resetUpstreamTransports()
+	t.Cleanup(resetUpstreamTransports)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := upstreamHTTPClient("self-signed", true, upstreamOverride{}, time.Second)
+	if err != nil || client == nil {
+		t.Fatalf("InsecureSkipVerify 应返回专用客户端: %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("跳过证书校验后请求失败: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestProviderHostHeaderAndSNIOverride(t *testing.T) {
+	setupTestEnv(t)
+	resetUpstreamTransports()
+	t.Cleanup(resetUpstreamTransports)
+
+	type seen struct{ host, serverName string }
+	requests := make(chan seen, 4)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- seen{host: r.Host, serverName: r.TLS.ServerName}
+		_, _ = w.Write([]byte(`{"id":"ok"}`))
+	}))
+	defer server.Close()
+
+	// httptest 证书包含 example.com，SNI 覆盖后按该名称校验
+	caFile := filepath.Join(t.TempDir(), "gateway.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0o644); err != nil {
+		t.Fatalf("写入 CA 文件失败: %v", err)
+	}
+	if err := (&SettingsService{}).SetUpstreamCAPath(caFile); err != nil {
+		t.Fatalf("设置 CA 路径失败: %v", err)
+	}
+
+	relay, router := newTestRelay(t)
+	if err := relay.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "gateway", APIURL: server.URL, APIKey: "sk-test", Enabled: true, Level: 1,
+			HostHeader: "api.example.com", TLSServerName: "example.com"},
+	}); err != nil {
+		t.Fatalf("保存 provider 失败: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	got := <-requests
+	if got.host != "api.example.com" || got.serverName != "example.com" {
+		t.Fatalf("Host/SNI 应来自覆盖配置, 实际 Host=%q SNI=%q", got.host, got.serverName)
+	}
+
+	// 只配置 HostHeader 时 SNI 默认取其主机名
+	override := (&Provider{APIURL: server.URL, HostHeader: "example.com:8443"}).upstreamOverride()
+	if override.ServerName != "example.com" {
+		t.Fatalf("SNI 默认值 = %q, 期望 example.com", override.ServerName)
+	}
+
+	invalid := Provider{APIURL: "https://api.example.com", HostHeader: "https://example.com/path", TLSServerName: "example.com:443"}
+	if errs := invalid.ValidateConfiguration(); len(errs) != 2 {
+		t.Fatalf("无效的 Host/SNI 应返回 2 个错误, 实际 %v", errs)
+	}
+}
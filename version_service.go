@@ -1,15 +1,121 @@
 package main
 
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+
+	"codeswitch/services"
+)
+
 const AppVersion = "v1.1.14"
 
+// 构建信息，发布时通过 -ldflags "-X main.BuildDate=... -X main.CommitHash=..." 注入
+// 未注入时回退到 Go 自动记录的 vcs 信息（需未使用 -buildvcs=false）
+var (
+	BuildDate  = ""
+	CommitHash = ""
+)
+
+const wailsModulePath = "github.com/wailsapp/wails/v3"
+
+// VersionInfo 应用版本与构建信息（用于"关于"对话框和问题反馈）
+type VersionInfo struct {
+	AppVersion   string `json:"appVersion"`
+	WailsVersion string `json:"wailsVersion"`
+	GoVersion    string `json:"goVersion"`
+	BuildDate    string `json:"buildDate"`
+	CommitHash   string `json:"commitHash"`
+	OS           string `json:"os"`
+	Arch         string `json:"arch"`
+	Portable     bool   `json:"portable"`
+}
+
+// DiagnosticsInfo 面向技术支持的环境信息
+type DiagnosticsInfo struct {
+	VersionInfo
+	RelayAddr  string `json:"relayAddr"`
+	ConfigDir  string `json:"configDir"`
+	Executable string `json:"executable"`
+}
+
 type VersionService struct {
-	version string
+	version       string
+	relayAddr     string
+	updateService *services.UpdateService
 }
 
-func NewVersionService() *VersionService {
-	return &VersionService{version: AppVersion}
+func NewVersionService(updateService *services.UpdateService, relayAddr string) *VersionService {
+	return &VersionService{
+		version:       AppVersion,
+		relayAddr:     relayAddr,
+		updateService: updateService,
+	}
+}
+
+// SetRelayAddr relay 端口变更后更新诊断信息中的地址
+func (vs *VersionService) SetRelayAddr(addr string) {
+	vs.relayAddr = addr
 }
 
 func (vs *VersionService) CurrentVersion() string {
 	return vs.version
 }
+
+// GetVersion 获取版本与构建信息
+func (vs *VersionService) GetVersion() VersionInfo {
+	info := VersionInfo{
+		AppVersion: vs.version,
+		GoVersion:  runtime.Version(),
+		BuildDate:  BuildDate,
+		CommitHash: CommitHash,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+	}
+	if vs.updateService != nil {
+		info.Portable = vs.updateService.IsPortable()
+	}
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, dep := range buildInfo.Deps {
+		if dep.Path == wailsModulePath {
+			info.WailsVersion = dep.Version
+			if dep.Replace != nil {
+				info.WailsVersion = dep.Replace.Version
+			}
+			break
+		}
+	}
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.CommitHash == "" {
+				info.CommitHash = setting.Value
+			}
+		case "vcs.time":
+			if info.BuildDate == "" {
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+// GetDiagnostics 获取版本信息及运行环境（relay 地址、配置目录等），便于用户直接粘贴到问题反馈中
+func (vs *VersionService) GetDiagnostics() DiagnosticsInfo {
+	diagnostics := DiagnosticsInfo{
+		VersionInfo: vs.GetVersion(),
+		RelayAddr:   vs.relayAddr,
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		diagnostics.ConfigDir = filepath.Join(home, ".code-switch")
+	}
+	if exe, err := os.Executable(); err == nil {
+		diagnostics.Executable = exe
+	}
+	return diagnostics
+}